@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+	auditTimeout      = 10 * time.Second
+)
+
+type auditPage struct {
+	Data []db.AuditEntry `json:"data"`
+}
+
+// adminWrapper only allows admin API keys and records every request in the
+// audit table. It expects the handler to be wrapped by the auth middleware, so
+// admin endpoints are not available at all when there are no API keys (or the
+// auth middleware is off).
+func (app *api) adminWrapper(e string, h func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		i := time.Now().UnixMilli()
+		c, ok := clientFrom(r.Context())
+		if !ok || !c.key.Admin {
+			app.messageResponse(w, http.StatusForbidden, "Essa URL requer uma chave de API de administração.")
+			registerMetric(e, r.Method, http.StatusForbidden, i)
+			return
+		}
+		if app.audit != nil {
+			app.audit.Info(fmt.Sprintf("%s %s", r.Method, r.URL.Path), "actor", c.key.Name, "query", r.URL.RawQuery)
+		}
+		h(w, r)
+	}
+}
+
+func (app *api) auditHandler(w http.ResponseWriter, r *http.Request) {
+	i := time.Now().UnixMilli()
+	if r.Method != http.MethodGet {
+		app.messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		registerMetric("audit", r.Method, http.StatusMethodNotAllowed, i)
+		return
+	}
+	n := defaultAuditLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		n, err = strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			app.messageResponse(w, http.StatusBadRequest, fmt.Sprintf("Limite %s inválido, use um número entre 1 e %d.", v, maxAuditLimit))
+			registerMetric("audit", r.Method, http.StatusBadRequest, i)
+			return
+		}
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), auditTimeout)
+	defer cancel()
+	es, err := app.db.AuditEntries(ctx, n)
+	if err != nil {
+		slog.Error("could not read audit entries", "error", err)
+		app.messageResponse(w, http.StatusInternalServerError, "Erro buscando registros de auditoria.")
+		registerMetric("audit", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	b, err := json.Marshal(auditPage{es})
+	if err != nil {
+		app.messageResponse(w, http.StatusInternalServerError, "Erro serializando registros de auditoria.")
+		registerMetric("audit", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		slog.Error("error responding to audit request", "error", err)
+	}
+	registerMetric("audit", r.Method, http.StatusOK, i)
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+type auditRecorder struct {
+	mockDatabase
+	entries []db.AuditEntry
+}
+
+func (a *auditRecorder) SaveAuditEntry(e db.AuditEntry) error {
+	a.entries = append(a.entries, e)
+	return nil
+}
+
+func TestAuditHandler(t *testing.T) {
+	var m auditRecorder
+	l, err := db.NewAuditLogger(&m)
+	if err != nil {
+		t.Fatalf("expected no error creating the audit logger, got %s", err)
+	}
+	app := api{db: &m, audit: l}
+	admin := &client{key: db.APIKey{Name: "admin", Admin: true}, bucket: &bucket{}}
+	user := &client{key: db.APIKey{Name: "user"}, bucket: &bucket{}}
+	for _, c := range []struct {
+		method  string
+		path    string
+		client  *client
+		status  int
+		content string
+	}{
+		{http.MethodGet, "/v1/admin/audit", nil, http.StatusForbidden, `{"message":"Essa URL requer uma chave de API de administração."}`},
+		{http.MethodGet, "/v1/admin/audit", user, http.StatusForbidden, `{"message":"Essa URL requer uma chave de API de administração."}`},
+		{http.MethodPost, "/v1/admin/audit", admin, http.StatusMethodNotAllowed, `{"message":"Essa URL aceita apenas o método GET."}`},
+		{http.MethodGet, "/v1/admin/audit?limit=0", admin, http.StatusBadRequest, `{"message":"Limite 0 inválido, use um número entre 1 e 1000."}`},
+		{
+			http.MethodGet,
+			"/v1/admin/audit?limit=1",
+			admin,
+			http.StatusOK,
+			`{"data":[{"at":"2026-09-14T12:00:00Z","actor":"alice","action":"drop","parameters":{"schema":"public"}}]}`,
+		},
+	} {
+		req, err := http.NewRequest(c.method, c.path, nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		if c.client != nil {
+			req = req.WithContext(context.WithValue(req.Context(), clientContextKey{}, c.client))
+		}
+		resp := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.adminWrapper("audit", app.auditHandler))
+		handler.ServeHTTP(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("expected %s %s to return %d, got %d", c.method, c.path, c.status, resp.Code)
+		}
+		if got := strings.TrimSpace(resp.Body.String()); got != c.content {
+			t.Errorf("expected %s, got %s", c.content, got)
+		}
+	}
+	if len(m.entries) != 3 {
+		t.Fatalf("expected 3 audit entries (admin requests only), got %d", len(m.entries))
+	}
+	e := m.entries[2]
+	if e.Actor != "admin" || e.Action != "GET /v1/admin/audit" || e.Parameters["query"] != "limit=1" {
+		t.Errorf("expected admin request to be audited, got %#v", e)
+	}
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+type aggregationPage struct {
+	Data []db.Bucket `json:"data"`
+}
+
+// aggregationHandler serves the number of companies per code of a field (e.g.
+// codigo_faixa_capital_social) among the companies matching the same filters as the
+// paginated search, which are required to avoid counting the whole database.
+func (app *api) aggregationHandler(w http.ResponseWriter, r *http.Request) {
+	i := time.Now().UnixMilli()
+	if r.Method != http.MethodGet {
+		app.messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		registerMetric("aggregation", r.Method, http.StatusMethodNotAllowed, i)
+		return
+	}
+	f := r.PathValue("field")
+	if _, ok := db.AggregationFields[f]; !ok {
+		fs := slices.Sorted(maps.Keys(db.AggregationFields))
+		app.messageResponse(w, http.StatusBadRequest, fmt.Sprintf("Campo %s inválido, as opções são: %s.", f, strings.Join(fs, ", ")))
+		registerMetric("aggregation", r.Method, http.StatusBadRequest, i)
+		return
+	}
+	q, err := db.NewQuery(r.URL.Query())
+	if err != nil {
+		app.messageResponse(w, http.StatusBadRequest, invalidQueryMessage(err))
+		registerMetric("aggregation", r.Method, http.StatusBadRequest, i)
+		return
+	}
+	if q == nil {
+		app.messageResponse(w, http.StatusBadRequest, "Informe ao menos um dos filtros da busca paginada.")
+		registerMetric("aggregation", r.Method, http.StatusBadRequest, i)
+		return
+	}
+	if len(q.Tag) > 0 {
+		c, _ := clientFrom(r.Context())
+		if c == nil {
+			app.messageResponse(w, http.StatusBadRequest, "O filtro tag requer uma chave de API.")
+			registerMetric("aggregation", r.Method, http.StatusBadRequest, i)
+			return
+		}
+		q.TagNamespace = c.key.Name
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	bs, err := app.db.Aggregate(ctx, q, f)
+	if errors.Is(err, context.DeadlineExceeded) {
+		slog.Error("aggregation timed out", "query", q, "field", f)
+		app.messageResponse(w, http.StatusRequestTimeout, "Tempo de requisição esgotou (Timeout). Experimente filtros mais específicos.")
+		registerMetric("aggregation", r.Method, http.StatusRequestTimeout, i)
+		return
+	}
+	if errors.Is(err, db.ErrPostGISUnavailable) {
+		app.messageResponse(w, http.StatusBadRequest, postGISUnavailableMessage)
+		registerMetric("aggregation", r.Method, http.StatusBadRequest, i)
+		return
+	}
+	if err != nil {
+		slog.Error("aggregation error", "error", err, "query", q, "field", f)
+		app.messageResponse(w, http.StatusInternalServerError, "Erro inesperado na agregação.")
+		registerMetric("aggregation", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	b, err := json.Marshal(aggregationPage{bs})
+	if err != nil {
+		app.messageResponse(w, http.StatusInternalServerError, "Erro serializando a agregação.")
+		registerMetric("aggregation", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.Header().Set("Cache-Control", app.cacheControl())
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		slog.Error("error responding to aggregation request", "query", q, "field", f, "error", err)
+	}
+	registerMetric("aggregation", r.Method, http.StatusOK, i)
+}
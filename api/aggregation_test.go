@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/json/v2"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAggregationHandler(t *testing.T) {
+	app := api{db: mockDatabase{}}
+	for _, c := range []struct {
+		method  string
+		path    string
+		status  int
+		buckets int
+	}{
+		{http.MethodGet, "/v1/aggregation/codigo_faixa_capital_social?uf=sp", http.StatusOK, 2},
+		{http.MethodGet, "/v1/aggregation/codigo_porte?uf=rj", http.StatusOK, 0},
+		{http.MethodGet, "/v1/aggregation/codigo_porte", http.StatusBadRequest, 0},
+		{http.MethodGet, "/v1/aggregation/uf?uf=sp", http.StatusBadRequest, 0},
+		{http.MethodGet, "/v1/aggregation/codigo_porte?tag=cliente", http.StatusBadRequest, 0},
+		{http.MethodGet, "/v1/aggregation/codigo_porte?uf=sp&bbox=a,b,c,d", http.StatusBadRequest, 0},
+		{http.MethodPost, "/v1/aggregation/codigo_porte?uf=sp", http.StatusMethodNotAllowed, 0},
+	} {
+		req := httptest.NewRequest(c.method, c.path, nil)
+		resp := httptest.NewRecorder()
+		mux := http.NewServeMux()
+		mux.HandleFunc("/v1/aggregation/{field}", app.aggregationHandler)
+		mux.ServeHTTP(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("expected %s %s to return %d, got %d", c.method, c.path, c.status, resp.Code)
+		}
+		if c.status != http.StatusOK {
+			continue
+		}
+		var p aggregationPage
+		if err := json.Unmarshal(resp.Body.Bytes(), &p); err != nil {
+			t.Fatalf("expected a valid json, got %s", err)
+		}
+		if p.Data == nil {
+			t.Errorf("expected data to be a list for %s, got %s", c.path, resp.Body.String())
+		}
+		if len(p.Data) != c.buckets {
+			t.Errorf("expected %d buckets for %s, got %d", c.buckets, c.path, len(p.Data))
+		}
+		if c.buckets > 0 && (p.Data[0].Code != nil || *p.Data[1].Code != 1 || p.Data[1].Total != 40) {
+			t.Errorf("expected the buckets ordered by code, got %#v", p.Data)
+		}
+	}
+}
@@ -12,30 +12,63 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/cuducos/go-cnpj"
 	"github.com/cuducos/minha-receita/db"
+	"github.com/cuducos/minha-receita/export"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/sync/singleflight"
 )
 
-const (
-	cacheMaxAge = time.Hour * 24
-	timeout     = time.Second * 90
-)
-
-var cacheControl = fmt.Sprintf("max-age=%d", int(cacheMaxAge.Seconds()))
+const timeout = time.Second * 90
 
 type database interface {
-	GetCompany(string) (string, error)
+	GetCompany(string, db.Profile) (string, error)
 	Search(context.Context, *db.Query) (string, error)
+	Aggregate(context.Context, *db.Query, string) ([]db.Bucket, error)
 	MetaRead(string) (string, error)
+	APIKeys() ([]db.APIKey, error)
+	Capacity(context.Context) (db.Capacity, error)
+	Stats(context.Context) (db.Stats, error)
+	Sample(context.Context, int) ([]string, error)
+	Partners(context.Context, string, int, int) (string, error)
+	CrosswalkCNPJ(context.Context, string, string) (string, error)
+	Enrichment(context.Context, string) (string, error)
+	SaveEnrichment(context.Context, string, string) (string, error)
+	AddTag(context.Context, string, string, string) error
+	RemoveTag(context.Context, string, string, string) error
+	Tags(context.Context, string, string) ([]string, error)
+	SaveAuditEntry(db.AuditEntry) error
+	AuditEntries(context.Context, int) ([]db.AuditEntry, error)
+	MunicipalityPoints(context.Context, []uint32) (map[uint32]string, error)
+	Events(context.Context, string) ([]db.Event, error)
 }
 
 type api struct {
-	db   database
-	host string
+	db          database
+	host        string
+	keys        *apiKeys
+	oidc        *oidcAuth
+	updates     *updates
+	audit       *slog.Logger
+	inFlight    atomic.Int64
+	drain       drainer
+	exports     *export.ObjectStorage
+	shadow      *shadow
+	enrichment  enrichmentSchema
+	bundle      bundle
+	logLevel    *logLevel
+	cache       cachePolicy
+	middlewares middlewareChain
+	coverage    coverage
+	lookups     singleflight.Group
 }
 
 // messageResponse takes a text message and a HTTP status, wraps the message into a
@@ -53,19 +86,21 @@ func (app *api) messageResponse(w http.ResponseWriter, s int, m string) {
 	}
 }
 
-func (app *api) singleCompany(pth string, w http.ResponseWriter, r *http.Request, i int64) {
+func (app *api) singleCompany(pth string, p db.Profile, w http.ResponseWriter, r *http.Request, i int64) {
 	w.Header().Set("Content-type", "application/json")
 	if !cnpj.IsValid(pth) {
 		app.messageResponse(w, http.StatusBadRequest, fmt.Sprintf("CNPJ %s inválido.", cnpj.Mask(pth[1:])))
 		registerMetric("singleCompany", r.Method, http.StatusBadRequest, i)
 		return
 	}
-	s, err := getCompany(app.db, pth)
+	s, err := app.getCompany(pth, p)
 	if err != nil {
-		app.messageResponse(w, http.StatusNotFound, fmt.Sprintf("CNPJ %s não encontrado.", cnpj.Mask(pth)))
+		app.messageResponse(w, http.StatusNotFound, app.companyNotFound(pth))
 		registerMetric("singleCompany", r.Method, http.StatusNotFound, i)
 		return
 	}
+	s = app.enrich("company", r, pth, s)
+	w.Header().Set("Cache-Control", app.cacheControlFor("company", r))
 	w.WriteHeader(http.StatusOK)
 	if _, err := io.WriteString(w, s); err != nil {
 		slog.Error("error responding to successful single company request", "request", r, "error", err)
@@ -73,7 +108,31 @@ func (app *api) singleCompany(pth string, w http.ResponseWriter, r *http.Request
 	registerMetric("singleCompany", r.Method, http.StatusOK, i)
 }
 
+// invalidQueryMessage explains which filter of the paginated search is invalid
+// (see db.NewQuery).
+func invalidQueryMessage(err error) string {
+	switch {
+	case errors.Is(err, db.ErrInvalidBBox):
+		return "Filtro bbox inválido, informe longitude mínima, latitude mínima, longitude máxima e latitude máxima separadas por vírgula."
+	case errors.Is(err, db.ErrInvalidNear):
+		return "Filtro near inválido, informe latitude e longitude separadas por vírgula."
+	case errors.Is(err, db.ErrInvalidRadius):
+		return fmt.Sprintf("Raio inválido, informe um número de metros maior que zero e de até %d.", db.MaxRadius)
+	case errors.Is(err, db.ErrInvalidPolygon):
+		return fmt.Sprintf("Polígono inválido, informe uma geometria GeoJSON do tipo Polygon ou MultiPolygon com até %d KB.", db.MaxPolygonSize/1024)
+	}
+	return "Filtros da busca paginada inválidos."
+}
+
 func (app *api) paginatedSearch(q *db.Query, w http.ResponseWriter, r *http.Request, i int64) {
+	f := r.URL.Query().Get("format")
+	switch f {
+	case "", "json", string(export.XLSX), geoJSONFormat:
+	default:
+		app.messageResponse(w, http.StatusBadRequest, fmt.Sprintf("Formato %s inválido, as opções são: json, xlsx, geojson.", f))
+		registerMetric("paginatedSearch", r.Method, http.StatusBadRequest, i)
+		return
+	}
 	w.Header().Set("Content-type", "application/json")
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
@@ -93,12 +152,25 @@ func (app *api) paginatedSearch(q *db.Query, w http.ResponseWriter, r *http.Requ
 		registerMetric("paginatedSearch", r.Method, http.StatusRequestTimeout, i)
 		return
 	}
+	if errors.Is(err, db.ErrPostGISUnavailable) {
+		app.messageResponse(w, http.StatusBadRequest, postGISUnavailableMessage)
+		registerMetric("paginatedSearch", r.Method, http.StatusBadRequest, i)
+		return
+	}
 	if err != nil {
 		slog.Error("paginated search error", "error", err, "query", q)
 		app.messageResponse(w, http.StatusNotFound, "Erro inesperado na busca.")
 		registerMetric("paginatedSearch", r.Method, http.StatusNotFound, i)
 		return
 	}
+	switch f {
+	case string(export.XLSX):
+		app.spreadsheetPage(w, r, s, i)
+		return
+	case geoJSONFormat:
+		app.geoJSONPage(ctx, w, r, s, i)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 	if _, err := io.WriteString(w, s); err != nil {
 		slog.Error("error responding to successful paginated search request", "query", q, "request", r, "error", err)
@@ -108,10 +180,10 @@ func (app *api) paginatedSearch(q *db.Query, w http.ResponseWriter, r *http.Requ
 
 func (app *api) companyHandler(w http.ResponseWriter, r *http.Request) {
 	i := time.Now().UnixMilli()
-	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("Cache-Control", app.cacheControl())
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding")
+	w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, Content-Length, Accept-Encoding")
 
 	switch r.Method {
 	case http.MethodGet:
@@ -125,18 +197,39 @@ func (app *api) companyHandler(w http.ResponseWriter, r *http.Request) {
 		registerMetric("earlyReturn", r.Method, http.StatusMethodNotAllowed, i)
 		return
 	}
+	c, _ := clientFrom(r.Context())
+	p, err := profile(r, c)
+	if err != nil {
+		app.messageResponse(w, http.StatusBadRequest, invalidProfileMessage(r.URL.Query().Get("perfil")))
+		registerMetric("earlyReturn", r.Method, http.StatusBadRequest, i)
+		return
+	}
 	pth := r.URL.Path
 	if pth == "/" {
-		q := db.NewQuery(r.URL.Query())
+		q, err := db.NewQuery(r.URL.Query())
+		if err != nil {
+			app.messageResponse(w, http.StatusBadRequest, invalidQueryMessage(err))
+			registerMetric("paginatedSearch", r.Method, http.StatusBadRequest, i)
+			return
+		}
 		if q == nil {
 			http.Redirect(w, r, "https://docs.minhareceita.org", http.StatusFound)
 			registerMetric("redirectedToDocs", r.Method, http.StatusFound, i)
 			return
 		}
+		q.Profile = p
+		if len(q.Tag) > 0 {
+			if c == nil {
+				app.messageResponse(w, http.StatusBadRequest, "O filtro tag requer uma chave de API.")
+				registerMetric("paginatedSearch", r.Method, http.StatusBadRequest, i)
+				return
+			}
+			q.TagNamespace = c.key.Name
+		}
 		app.paginatedSearch(q, w, r, i)
 		return
 	}
-	app.singleCompany(pth, w, r, i)
+	app.singleCompany(pth, p, w, r, i)
 }
 
 func (app *api) updatedHandler(w http.ResponseWriter, r *http.Request) {
@@ -152,7 +245,7 @@ func (app *api) updatedHandler(w http.ResponseWriter, r *http.Request) {
 		registerMetric("updated", r.Method, http.StatusInternalServerError, i)
 		return
 	}
-	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("Cache-Control", app.cacheControlFor("updated", r))
 	app.messageResponse(w, http.StatusOK, s)
 	registerMetric("updated", r.Method, http.StatusOK, i)
 }
@@ -183,24 +276,174 @@ func (app *api) allowedHostWrapper(h func(http.ResponseWriter, *http.Request)) f
 	return w
 }
 
-// Serve spins up the HTTP server.
-func Serve(db database, p string) error {
-	if !strings.HasPrefix(p, ":") {
-		p = ":" + p
+// internalEndpoints are served in the internal port, when there is one.
+var internalEndpoints = []string{"health", "updated", "metrics"}
+
+func (app *api) internalOnlyHandler(w http.ResponseWriter, r *http.Request) {
+	app.messageResponse(w, http.StatusNotFound, "URL não encontrada.")
+}
+
+// routes registers the endpoints in the public mux. If internal is true, the
+// health check, the date of the last update and the metrics are registered
+// only in the internal mux, without the auth and rate limit middlewares nor
+// the allowed host validation, so probes and scrapers never depend on them.
+func (app *api) routes(internal bool) (*http.ServeMux, *http.ServeMux) {
+	pub := http.NewServeMux()
+	var in *http.ServeMux
+	if internal {
+		in = http.NewServeMux()
 	}
-	app := api{db, os.Getenv("ALLOWED_HOST")}
 	for _, r := range []struct {
-		path    string
-		handler func(http.ResponseWriter, *http.Request)
+		path     string
+		endpoint string
+		kind     routeKind
+		handler  func(http.ResponseWriter, *http.Request)
 	}{
-		{"/", app.companyHandler},
-		{"/updated", app.updatedHandler},
-		{"/healthz", app.healthHandler},
-		{"/metrics", promhttp.Handler().ServeHTTP},
+		{"/", "company", cacheableRoute, app.companyHandler},
+		{"/updated", "updated", cacheableRoute, app.updatedHandler},
+		{"/v1/aggregation/{field}", "aggregation", cacheableRoute, app.aggregationHandler},
+		{"/v1/cnpj/{cnpj}/qsa", "qsa", cacheableRoute, app.partnersHandler},
+		{"/v1/cnpj/{cnpj}/cnaes", "cnaes", cacheableRoute, app.cnaesHandler},
+		{"/v1/by/{kind}/{id}", "crosswalk", cacheableRoute, app.crosswalkHandler},
+		{"/v1/cnpj/{cnpj}/events", "events", cacheableRoute, app.eventsHandler},
+		{"/v1/status", "status", cacheableRoute, app.statusHandler},
+		{"/v1/cnpj/{cnpj}/tags", "tags", privateRoute, app.tagsHandler},
+		{"/v1/cnpj/{cnpj}/tags/{tag}", "tags", privateRoute, app.tagsHandler},
+		{"/v1/cnpj/{cnpj}/enrichment", "enrichment", privateRoute, app.adminWrapper("enrichment", app.enrichmentHandler)},
+		{"/v1/bundle/meta.tar.zst", "bundle", privateRoute, app.bundleHandler},
+		{"/v1/updated/stream", "stream", privateRoute, app.updatedStreamHandler},
+		{"/v1/ws", "websocket", privateRoute, app.websocketHandler},
+		{"/v1/exports/{format}", "exports", privateRoute, app.exportsHandler},
+		{"/v1/capacity", "capacity", privateRoute, app.capacityHandler},
+		{"/v1/slo", "slo", privateRoute, app.sloHandler},
+		{"/v1/admin/audit", "audit", privateRoute, app.adminWrapper("audit", app.auditHandler)},
+		{"/v1/admin/log-level", "log_level", privateRoute, app.adminWrapper("log_level", app.logLevelHandler)},
+		{"/openapi.json", "openapi", publicRoute, app.openAPIHandler},
+		{"/healthz", "health", publicRoute, app.healthHandler},
+		{"/metrics", "metrics", publicRoute, promhttp.Handler().ServeHTTP},
 	} {
-		http.HandleFunc(r.path, app.allowedHostWrapper(r.handler))
+		if in != nil && slices.Contains(internalEndpoints, r.endpoint) {
+			in.HandleFunc(r.path, app.chain(r.endpoint, publicRoute, r.handler))
+			pub.HandleFunc(r.path, app.allowedHostWrapper(app.internalOnlyHandler))
+			continue
+		}
+		pub.HandleFunc(r.path, app.allowedHostWrapper(app.chain(r.endpoint, r.kind, r.handler)))
+	}
+	return pub, in
+}
+
+// Serve spins up the HTTP server. If ip is not empty, the health check, the
+// date of the last update and the metrics are served only in this internal
+// port, apart from the other endpoints. If n is greater than zero, n random
+// companies are checked for data corruption every day. On SIGINT or SIGTERM,
+// the server drains the requests in flight for up to k before closing; on
+// SIGHUP, it reloads the log level. The max-age of the cacheable responses is
+// c, auto (computed from the expected date of the next dataset update) or a
+// duration.
+func Serve(d database, p, ip string, n int, k time.Duration, c string) error {
+	if !strings.HasPrefix(p, ":") {
+		p = ":" + p
+	}
+	if ip != "" && !strings.HasPrefix(ip, ":") {
+		ip = ":" + ip
+	}
+	if ip == p {
+		return fmt.Errorf("the internal port %s must be different from the port of the web api", ip)
+	}
+	ks, err := newAPIKeys(d)
+	if err != nil {
+		return err
+	}
+	al, err := db.NewAuditLogger(d)
+	if err != nil {
+		return err
+	}
+	ex, err := export.NewObjectStorageFromEnv()
+	if err != nil {
+		return fmt.Errorf("could not configure the object storage for exports: %w", err)
+	}
+	slos, err = newSLOTrackerFromEnv()
+	if err != nil {
+		return err
+	}
+	sh, err := newShadowFromEnv()
+	if err != nil {
+		return err
+	}
+	en, err := newEnrichmentSchemaFromEnv()
+	if err != nil {
+		return err
+	}
+	ll, err := newLogLevelFromEnv()
+	if err != nil {
+		return err
+	}
+	cp, err := newCachePolicy(c)
+	if err != nil {
+		return err
+	}
+	ms, err := newMiddlewareChainFromEnv()
+	if err != nil {
+		return err
+	}
+	cv, err := newCoverageFromEnv()
+	if err != nil {
+		return err
+	}
+	oa, err := newOIDCFromEnv()
+	if err != nil {
+		return err
+	}
+	app := api{db: d, host: os.Getenv("ALLOWED_HOST"), keys: ks, oidc: oa, updates: newUpdates(), audit: al, exports: ex, shadow: sh, enrichment: en, logLevel: ll, cache: cp, middlewares: ms, coverage: cv}
+	go app.updates.poll(d)
+	if n > 0 {
+		go app.sampleIntegrity(n)
+	}
+	if err := prometheus.Register(newDatabaseCollector(d)); err != nil {
+		return fmt.Errorf("could not register database metrics: %w", err)
+	}
+	if err := prometheus.Register(newSLOCollector(slos)); err != nil {
+		return fmt.Errorf("could not register slo metrics: %w", err)
+	}
+	if c, ok := cgroupDir(cgroupRoot, "/proc/self/cgroup"); ok {
+		if err := prometheus.Register(newContainerCollector(c)); err != nil {
+			return fmt.Errorf("could not register container metrics: %w", err)
+		}
+	} else {
+		slog.Debug("not running in a container with cgroup v2, container metrics are disabled")
+	}
+	pub, in := app.routes(ip != "")
+	s := &http.Server{Addr: p, Handler: app.drain.wrap(pub), ReadTimeout: timeout * 2, WriteTimeout: timeout * 2}
+	s.RegisterOnShutdown(app.updates.close)
+	errs := make(chan error, 2)
+	go func() {
+		slog.Info(fmt.Sprintf("Serving at http://0.0.0.0%s", p))
+		errs <- s.ListenAndServe()
+	}()
+	if in != nil {
+		is := &http.Server{Addr: ip, Handler: in, ReadTimeout: timeout * 2, WriteTimeout: timeout * 2}
+		defer is.Close()
+		go func() {
+			slog.Info(fmt.Sprintf("Serving health check, update date and metrics at http://0.0.0.0%s", ip))
+			errs <- is.ListenAndServe()
+		}()
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sig)
+	for {
+		select {
+		case err := <-errs:
+			return err
+		case v := <-sig:
+			if v != syscall.SIGHUP {
+				return app.shutdown(s, k)
+			}
+			if err := app.logLevel.reload(); err != nil {
+				slog.Error("could not reload the log level", "error", err)
+				continue
+			}
+			slog.Warn("Log level reloaded", "level", app.logLevel.current.Level())
+		}
 	}
-	s := &http.Server{Addr: p, ReadTimeout: timeout * 2, WriteTimeout: timeout * 2}
-	slog.Info(fmt.Sprintf("Serving at http://0.0.0.0%s", p))
-	return s.ListenAndServe()
 }
@@ -2,6 +2,8 @@ package api
 
 import (
 	"context"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
 	"errors"
 	"fmt"
 	"net/http"
@@ -10,14 +12,16 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cuducos/go-cnpj"
 	"github.com/cuducos/minha-receita/db"
+	"github.com/cuducos/minha-receita/transform"
 )
 
 type mockDatabase struct{}
 
-func (mockDatabase) GetCompany(n string) (string, error) {
+func (mockDatabase) GetCompany(n string, p db.Profile) (string, error) {
 	n = cnpj.Unmask(n)
 	if n != "19131243000197" {
 		return "", errors.New("Company not found")
@@ -27,12 +31,123 @@ func (mockDatabase) GetCompany(n string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return string(b), nil
+	if p.Fields() == nil {
+		return string(b), nil
+	}
+	var c map[string]jsontext.Value
+	if err := json.Unmarshal(b, &c); err != nil {
+		return "", err
+	}
+	r := make(map[string]jsontext.Value)
+	for _, f := range p.Fields() {
+		r[f] = c[f]
+	}
+	b, err = json.Marshal(r)
+	return string(b), err
 }
 
 func (mockDatabase) Search(ctx context.Context, q *db.Query) (string, error) { return "", nil }
 
-func (mockDatabase) MetaRead(k string) (string, error) { return "42", nil }
+func (mockDatabase) MetaRead(k string) (string, error) {
+	if k == transform.DictionariesKey {
+		return `{"cnaes":{"6204000":"Consultoria em tecnologia da informação"},"paises":{"105":"Brasil"}}`, nil
+	}
+	return "42", nil
+}
+
+func (mockDatabase) Aggregate(_ context.Context, q *db.Query, f string) ([]db.Bucket, error) {
+	if len(q.UF) == 0 || q.UF[0] != "SP" {
+		return nil, nil
+	}
+	c := 1
+	return []db.Bucket{{Code: nil, Total: 2}, {Code: &c, Total: 40}}, nil
+}
+func (mockDatabase) APIKeys() ([]db.APIKey, error) { return nil, nil }
+
+func (mockDatabase) Capacity(_ context.Context) (db.Capacity, error) {
+	r := 0.9
+	return db.Capacity{InUse: 2, Idle: 6, Max: 8, CacheHitRate: &r}, nil
+}
+
+func (mockDatabase) Stats(_ context.Context) (db.Stats, error) {
+	r := 0.9
+	return db.Stats{ActiveConnections: 3, CacheHitRate: &r, TableSize: 4096, IndexSize: 1024}, nil
+}
+
+func (mockDatabase) Sample(_ context.Context, n int) ([]string, error) {
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		return nil, err
+	}
+	cs := make([]string, n)
+	for i := range cs {
+		cs[i] = string(b)
+	}
+	return cs, nil
+}
+
+func (mockDatabase) Partners(_ context.Context, n string, o, l int) (string, error) {
+	if n != "19131243000197" {
+		return "", errors.New("Company not found")
+	}
+	return fmt.Sprintf(`{"data":[],"total":%d}`, o+l), nil
+}
+
+func (mockDatabase) CrosswalkCNPJ(_ context.Context, k, id string) (string, error) {
+	if k != "nire" || db.NormalizeCrosswalkID(id) != "53300001234" {
+		return "", errors.New("Identifier not found")
+	}
+	return "19131243000197", nil
+}
+
+func (mockDatabase) Enrichment(_ context.Context, n string) (string, error) {
+	if n != "19131243000197" {
+		return "", nil
+	}
+	return `{"gerente":"Ana"}`, nil
+}
+
+func (mockDatabase) SaveEnrichment(_ context.Context, n, p string) (string, error) {
+	return p, nil
+}
+
+func (mockDatabase) AddTag(_ context.Context, ns, n, t string) error { return nil }
+
+func (mockDatabase) RemoveTag(_ context.Context, ns, n, t string) error { return nil }
+
+func (mockDatabase) Tags(_ context.Context, ns, n string) ([]string, error) {
+	if ns != "crm" {
+		return nil, nil
+	}
+	return []string{"cliente"}, nil
+}
+
+func (mockDatabase) SaveAuditEntry(_ db.AuditEntry) error { return nil }
+
+func (mockDatabase) AuditEntries(_ context.Context, n int) ([]db.AuditEntry, error) {
+	es := []db.AuditEntry{
+		{At: time.Date(2026, 9, 14, 12, 0, 0, 0, time.UTC), Actor: "alice", Action: "drop", Parameters: map[string]string{"schema": "public"}},
+		{At: time.Date(2026, 9, 13, 12, 0, 0, 0, time.UTC), Actor: "bob", Action: "create", Parameters: map[string]string{"schema": "public"}},
+	}
+	return es[:min(n, len(es))], nil
+}
+
+func (mockDatabase) MunicipalityPoints(_ context.Context, cs []uint32) (map[uint32]string, error) {
+	return map[uint32]string{3550308: `{"type":"Point","coordinates":[-46.6,-23.5]}`}, nil
+}
+
+func (mockDatabase) Events(_ context.Context, n string) ([]db.Event, error) {
+	switch n {
+	case "19131243000197":
+		return []db.Event{
+			{At: time.Date(2026, 8, 17, 12, 0, 0, 0, time.UTC), Operation: db.EventInsert, DatasetVersion: "2026-08-10", Hash: "2a4f", Company: []byte(`{"cnpj":"19131243000197"}`)},
+			{At: time.Date(2026, 9, 14, 12, 0, 0, 0, time.UTC), Operation: db.EventUpdate, DatasetVersion: "2026-09-12", Hash: "9c1e", Company: []byte(`{"cnpj":"19131243000197","uf":"SP"}`)},
+		}, nil
+	case "33683111000280":
+		return nil, db.ErrEventLogUnavailable
+	}
+	return nil, nil
+}
 
 func TestCompanyHandler(t *testing.T) {
 	f, err := filepath.Abs(filepath.Join("..", "testdata", "response.json"))
@@ -81,6 +196,18 @@ func TestCompanyHandler(t *testing.T) {
 			http.StatusFound,
 			"",
 		},
+		{
+			http.MethodGet,
+			"/?near=-23.5505,-46.6333&radius=50001",
+			http.StatusBadRequest,
+			`{"message":"Raio inválido, informe um número de metros maior que zero e de até 50000."}`,
+		},
+		{
+			http.MethodGet,
+			`/?polygon={"type":"Point","coordinates":[-46.6,-23.5]}`,
+			http.StatusBadRequest,
+			`{"message":"Polígono inválido, informe uma geometria GeoJSON do tipo Polygon ou MultiPolygon com até 16 KB."}`,
+		},
 		{
 			http.MethodGet,
 			"/foobar",
@@ -240,3 +367,55 @@ func TestAllowedHostWrap(t *testing.T) {
 	}
 
 }
+
+func TestRoutes(t *testing.T) {
+	a, _, err := db.NewAPIKey("test", 0, 0)
+	if err != nil {
+		t.Fatalf("expected no error creating api key, got %s", err)
+	}
+	var ks apiKeys
+	ks.set([]db.APIKey{a})
+	app := api{db: &mockDatabase{}, keys: &ks, updates: newUpdates(), middlewares: defaultMiddlewares}
+	serve := func(m *http.ServeMux, pth string) int {
+		req, err := http.NewRequest(http.MethodGet, pth, nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		resp := httptest.NewRecorder()
+		m.ServeHTTP(resp, req)
+		return resp.Code
+	}
+	t.Run("without internal port", func(t *testing.T) {
+		pub, in := app.routes(false)
+		if in != nil {
+			t.Error("expected no internal mux")
+		}
+		if got := serve(pub, "/healthz"); got != http.StatusOK {
+			t.Errorf("expected /healthz to return %d, got %d", http.StatusOK, got)
+		}
+		if got := serve(pub, "/updated"); got != http.StatusUnauthorized {
+			t.Errorf("expected /updated to return %d, got %d", http.StatusUnauthorized, got)
+		}
+	})
+	t.Run("with internal port", func(t *testing.T) {
+		pub, in := app.routes(true)
+		for _, c := range []struct {
+			mux    *http.ServeMux
+			path   string
+			status int
+		}{
+			{in, "/healthz", http.StatusOK},
+			{in, "/updated", http.StatusOK},
+			{in, "/metrics", http.StatusOK},
+			{in, "/v1/slo", http.StatusNotFound},
+			{pub, "/healthz", http.StatusNotFound},
+			{pub, "/updated", http.StatusNotFound},
+			{pub, "/metrics", http.StatusNotFound},
+			{pub, "/v1/slo", http.StatusUnauthorized},
+		} {
+			if got := serve(c.mux, c.path); got != c.status {
+				t.Errorf("expected %s to return %d, got %d", c.path, c.status, got)
+			}
+		}
+	})
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+const apiKeysRefresh = time.Minute
+
+type clientContextKey struct{}
+
+// clientFrom returns the client authenticated by authWrapper, if any.
+func clientFrom(ctx context.Context) (*client, bool) {
+	c, ok := ctx.Value(clientContextKey{}).(*client)
+	return c, ok
+}
+
+// bucket is a token bucket: it holds up to burst tokens, refilled at rate
+// tokens per second, and each request takes one token.
+type bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(k db.APIKey, now time.Time) *bucket {
+	b := float64(max(1, k.Burst))
+	return &bucket{rate: k.Rate, burst: b, tokens: b, last: now}
+}
+
+// take returns whether the request is allowed, how many requests are left and,
+// if the request is not allowed, how long until the next token is available.
+func (b *bucket) take(now time.Time) (bool, int, time.Duration) {
+	if b.rate <= 0 {
+		return true, -1, 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		s := (1 - b.tokens) / b.rate
+		return false, 0, time.Duration(math.Ceil(s * float64(time.Second)))
+	}
+	b.tokens--
+	return true, int(b.tokens), 0
+}
+
+// full tells whether the bucket is back to its burst, i.e. forgetting it does
+// not change the rate limit of the client.
+func (b *bucket) full(now time.Time) bool {
+	if b.rate <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+type client struct {
+	key    db.APIKey
+	bucket *bucket
+}
+
+// apiKeys holds the clients allowed to use the API, indexed by the hash of
+// their keys.
+type apiKeys struct {
+	mu      sync.RWMutex
+	clients map[string]*client
+}
+
+func (a *apiKeys) enabled() bool {
+	if a == nil {
+		return false
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.clients) > 0
+}
+
+func (a *apiKeys) get(k string) (*client, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	c, ok := a.clients[db.HashAPIKey(k)]
+	return c, ok
+}
+
+// set replaces the keys, keeping the current bucket of unchanged keys so
+// reloading does not reset the rate limit.
+func (a *apiKeys) set(ks []db.APIKey) {
+	now := time.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cs := make(map[string]*client, len(ks))
+	for _, k := range ks {
+		if c, ok := a.clients[k.Hash]; ok && c.key == k {
+			cs[k.Hash] = c
+			continue
+		}
+		cs[k.Hash] = &client{k, newBucket(k, now)}
+	}
+	a.clients = cs
+}
+
+func (a *apiKeys) load(d database) error {
+	ks, err := d.APIKeys()
+	if err != nil {
+		return fmt.Errorf("could not load api keys: %w", err)
+	}
+	a.set(ks)
+	return nil
+}
+
+func (a *apiKeys) reload(d database) {
+	for range time.Tick(apiKeysRefresh) {
+		if err := a.load(d); err != nil {
+			slog.Error("could not reload api keys", "error", err)
+		}
+	}
+}
+
+func newAPIKeys(d database) (*apiKeys, error) {
+	var a apiKeys
+	if err := a.load(d); err != nil {
+		return nil, err
+	}
+	go a.reload(d)
+	return &a, nil
+}
+
+func keyFromHeader(r *http.Request) string {
+	s, k, ok := strings.Cut(strings.TrimSpace(r.Header.Get("Authorization")), " ")
+	if !ok || !strings.EqualFold(s, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(k)
+}
+
+// authWrapper requires a valid API key (or JWT, see oidcAuth) and enforces its
+// rate limit. If there are no API keys in the database and no OIDC issuer,
+// requests are not checked at all.
+func (app *api) authWrapper(h func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return app.keyWrapper(app.rateLimitWrapper(h))
+}
+
+// keyWrapper requires a valid API key or JWT, passing the client on in the
+// context of the request (see clientFrom). If there are no API keys in the
+// database and no OIDC issuer, requests are not checked at all.
+func (app *api) keyWrapper(h func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !app.authEnabled() || r.Method == http.MethodOptions {
+			h(w, r)
+			return
+		}
+		i := time.Now().UnixMilli()
+		c, ok := app.authenticate(keyFromHeader(r))
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			app.messageResponse(w, http.StatusUnauthorized, "Chave de API ausente ou inválida.")
+			registerMetric("auth", r.Method, http.StatusUnauthorized, i)
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), clientContextKey{}, c)))
+	}
+}
+
+// rateLimitWrapper enforces the rate limit of the API key of the request. It
+// expects to be wrapped by keyWrapper, and requests without a client are not
+// limited.
+func (app *api) rateLimitWrapper(h func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, ok := clientFrom(r.Context())
+		if !ok {
+			h(w, r)
+			return
+		}
+		i := time.Now().UnixMilli()
+		ok, n, d := c.bucket.take(time.Now())
+		if n >= 0 {
+			w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", int(c.bucket.burst)))
+			w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", n))
+		}
+		if !ok {
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(d.Seconds()))))
+			app.messageResponse(w, http.StatusTooManyRequests, "Limite de requisições excedido.")
+			registerMetric("auth", r.Method, http.StatusTooManyRequests, i)
+			return
+		}
+		h(w, r)
+	}
+}
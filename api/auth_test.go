@@ -0,0 +1,100 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+func TestBucket(t *testing.T) {
+	now := time.Now()
+	b := newBucket(db.APIKey{Rate: 2, Burst: 3}, now)
+	for i := range 3 {
+		if ok, n, _ := b.take(now); !ok || n != 2-i {
+			t.Errorf("expected request %d to be allowed with %d left, got %t and %d", i+1, 2-i, ok, n)
+		}
+	}
+	ok, _, d := b.take(now)
+	if ok {
+		t.Error("expected request over the burst to be denied")
+	}
+	if d != 500*time.Millisecond {
+		t.Errorf("expected to wait 500ms, got %s", d)
+	}
+	if ok, _, _ := b.take(now.Add(d)); !ok {
+		t.Error("expected request to be allowed after refilling")
+	}
+	u := newBucket(db.APIKey{Name: "unlimited"}, now)
+	for range 42 {
+		if ok, _, _ := u.take(now); !ok {
+			t.Error("expected requests without rate to be always allowed")
+		}
+	}
+}
+
+func TestAuthWrapper(t *testing.T) {
+	a, k, err := db.NewAPIKey("test", 1, 2)
+	if err != nil {
+		t.Fatalf("expected no error creating api key, got %s", err)
+	}
+	var ks apiKeys
+	ks.set([]db.APIKey{a})
+	for _, c := range []struct {
+		desc   string
+		keys   *apiKeys
+		header string
+		status int
+	}{
+		{"no keys configured", nil, "", http.StatusOK},
+		{"empty keys configured", &apiKeys{}, "", http.StatusOK},
+		{"missing key", &ks, "", http.StatusUnauthorized},
+		{"invalid key", &ks, "Bearer forty-two", http.StatusUnauthorized},
+		{"wrong scheme", &ks, fmt.Sprintf("Basic %s", k), http.StatusUnauthorized},
+		{"valid key", &ks, fmt.Sprintf("Bearer %s", k), http.StatusOK},
+		{"valid key within burst", &ks, fmt.Sprintf("bearer %s", k), http.StatusOK},
+		{"valid key over the limit", &ks, fmt.Sprintf("Bearer %s", k), http.StatusTooManyRequests},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/19131243000197", nil)
+			if err != nil {
+				t.Fatal("Expected an HTTP request, but got an error.")
+			}
+			if c.header != "" {
+				req.Header.Set("Authorization", c.header)
+			}
+			resp := httptest.NewRecorder()
+			app := api{db: &mockDatabase{}, keys: c.keys}
+			handler := http.HandlerFunc(app.authWrapper(app.companyHandler))
+			handler.ServeHTTP(resp, req)
+			if resp.Code != c.status {
+				t.Errorf("expected %d, got %d", c.status, resp.Code)
+			}
+			if c.status == http.StatusTooManyRequests && resp.Header().Get("Retry-After") != "1" {
+				t.Errorf("expected Retry-After to be 1, got %s", resp.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestAPIKeysSetKeepsBuckets(t *testing.T) {
+	a, _, err := db.NewAPIKey("test", 1, 1)
+	if err != nil {
+		t.Fatalf("expected no error creating api key, got %s", err)
+	}
+	var ks apiKeys
+	ks.set([]db.APIKey{a})
+	b := ks.clients[a.Hash].bucket
+	ks.set([]db.APIKey{a})
+	if ks.clients[a.Hash].bucket != b {
+		t.Error("expected unchanged key to keep its bucket")
+	}
+	a.Rate = 2
+	ks.set([]db.APIKey{a})
+	if ks.clients[a.Hash].bucket == b {
+		t.Error("expected changed key to get a new bucket")
+	}
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cuducos/minha-receita/transform"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	bundleContentType = "application/zstd"
+	bundleFileName    = "meta.tar.zst"
+	jsonSchemaVersion = "https://json-schema.org/draft/2020-12/schema"
+)
+
+var errNoDictionaries = errors.New("no dictionaries in the metadata")
+
+// companySchema is the JSON Schema of the companies, with the same types of
+// the OpenAPI document.
+func companySchema() map[string]any {
+	s := schemas{components: make(map[string]any), refs: "#/$defs/"}
+	r := s.schema(reflect.TypeFor[transform.Company]())
+	r["$schema"] = jsonSchemaVersion
+	r["$defs"] = s.components
+	return r
+}
+
+// newBundle creates a tar file compressed with zstd with the JSON Schema of
+// the companies (schema.json) and one JSON per dictionary (e.g.
+// dicionarios/cnaes.json) mapping codes to descriptions.
+func newBundle(v, d string) ([]byte, error) {
+	var ds map[string]jsontext.Value
+	if err := json.Unmarshal([]byte(d), &ds); err != nil {
+		return nil, fmt.Errorf("could not parse the dictionaries: %w", err)
+	}
+	s, err := json.Marshal(companySchema(), json.Deterministic(true))
+	if err != nil {
+		return nil, fmt.Errorf("could not serialize the json schema: %w", err)
+	}
+	fs := map[string][]byte{"schema.json": s}
+	for n, d := range ds {
+		fs[fmt.Sprintf("dicionarios/%s.json", n)] = d
+	}
+	m, _ := time.Parse(updatedAtLayout, v) // files without date if the version is not one
+	var b bytes.Buffer
+	z, err := zstd.NewWriter(&b, zstd.WithEncoderLevel(zstd.SpeedBestCompression), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, fmt.Errorf("could not create the zstd writer: %w", err)
+	}
+	t := tar.NewWriter(z)
+	for _, n := range slices.Sorted(maps.Keys(fs)) {
+		h := tar.Header{Name: n, Mode: 0644, Size: int64(len(fs[n])), ModTime: m, Format: tar.FormatPAX}
+		if err := t.WriteHeader(&h); err != nil {
+			return nil, fmt.Errorf("could not write the header of %s: %w", n, err)
+		}
+		if _, err := t.Write(fs[n]); err != nil {
+			return nil, fmt.Errorf("could not write %s: %w", n, err)
+		}
+	}
+	if err := t.Close(); err != nil {
+		return nil, fmt.Errorf("could not close the tar file: %w", err)
+	}
+	if err := z.Close(); err != nil {
+		return nil, fmt.Errorf("could not close the zstd writer: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// bundle keeps the compressed bundle of the current dataset version, so it is
+// created only once per version.
+type bundle struct {
+	lock    sync.Mutex
+	version string
+	body    []byte
+}
+
+func (b *bundle) get(db database, v string) ([]byte, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.body != nil && b.version == v {
+		return b.body, nil
+	}
+	d, err := db.MetaRead(transform.DictionariesKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errNoDictionaries, err)
+	}
+	if strings.TrimSpace(d) == "" {
+		return nil, errNoDictionaries
+	}
+	body, err := newBundle(v, d)
+	if err != nil {
+		return nil, err
+	}
+	b.version, b.body = v, body
+	return body, nil
+}
+
+// bundleHandler serves the JSON Schema and the dictionaries in a single
+// compressed file, so SDKs can sync the reference data in one request at
+// startup. The ETag is the dataset version, so clients download it again only
+// when the data is updated.
+func (app *api) bundleHandler(w http.ResponseWriter, r *http.Request) {
+	i := time.Now().UnixMilli()
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		app.messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas os métodos GET e HEAD.")
+		registerMetric("bundle", r.Method, http.StatusMethodNotAllowed, i)
+		return
+	}
+	v := app.version()
+	e := etag(v)
+	if v != "" && notModified(r, e, time.Time{}) {
+		w.Header().Set("ETag", e)
+		w.WriteHeader(http.StatusNotModified)
+		registerMetric("bundle", r.Method, http.StatusNotModified, i)
+		return
+	}
+	b, err := app.bundle.get(app.db, v)
+	if errors.Is(err, errNoDictionaries) {
+		slog.Warn("could not read the dictionaries, run the transform again to save them", "error", err)
+		app.messageResponse(w, http.StatusNotFound, "Dicionários indisponíveis, os dados foram carregados por uma versão anterior do Minha Receita.")
+		registerMetric("bundle", r.Method, http.StatusNotFound, i)
+		return
+	}
+	if err != nil {
+		slog.Error("could not create the bundle", "error", err)
+		app.messageResponse(w, http.StatusInternalServerError, "Erro gerando o pacote de dicionários.")
+		registerMetric("bundle", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	w.Header().Set("Content-type", bundleContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, bundleFileName))
+	w.Header().Set("Cache-Control", app.cacheControl())
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if v != "" {
+		w.Header().Set("ETag", e)
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		if _, err := w.Write(b); err != nil {
+			slog.Error("error responding to bundle request", "error", err)
+		}
+	}
+	registerMetric("bundle", r.Method, http.StatusOK, i)
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func readBundle(t *testing.T, b []byte) map[string]string {
+	z, err := zstd.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("expected a zstd file, got %s", err)
+	}
+	defer z.Close()
+	fs := make(map[string]string)
+	r := tar.NewReader(z)
+	for {
+		h, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("expected a tar file, got %s", err)
+		}
+		c, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("expected to read %s, got %s", h.Name, err)
+		}
+		fs[h.Name] = string(c)
+	}
+	return fs
+}
+
+func TestBundleHandler(t *testing.T) {
+	app := api{db: &mockDatabase{}}
+	req, err := http.NewRequest(http.MethodGet, "/v1/bundle/meta.tar.zst", nil)
+	if err != nil {
+		t.Fatal("Expected an HTTP request, but got an error.")
+	}
+	resp := httptest.NewRecorder()
+	app.bundleHandler(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected the bundle to return 200, got %d", resp.Code)
+	}
+	if got := resp.Header().Get("ETag"); got != etag("42") {
+		t.Errorf("expected the etag to be the dataset version, got %s", got)
+	}
+	fs := readBundle(t, resp.Body.Bytes())
+	for n, expected := range map[string]string{
+		"dicionarios/cnaes.json":  `{"6204000":"Consultoria em tecnologia da informação"}`,
+		"dicionarios/paises.json": `{"105":"Brasil"}`,
+	} {
+		if got := fs[n]; got != expected {
+			t.Errorf("expected %s to be %s, got %s", n, expected, got)
+		}
+	}
+	if !bytes.Contains([]byte(fs["schema.json"]), []byte(`"$ref":"#/$defs/Company"`)) {
+		t.Errorf("expected schema.json to reference the company definition, got %s", fs["schema.json"])
+	}
+
+	again := httptest.NewRecorder()
+	app.bundleHandler(again, req)
+	if !bytes.Equal(again.Body.Bytes(), resp.Body.Bytes()) {
+		t.Error("expected the same bundle for the same dataset version")
+	}
+
+	req.Header.Set("If-None-Match", etag("42"))
+	resp = httptest.NewRecorder()
+	app.bundleHandler(resp, req)
+	if resp.Code != http.StatusNotModified {
+		t.Errorf("expected a request with the current etag to return 304, got %d", resp.Code)
+	}
+
+	req, err = http.NewRequest(http.MethodPost, "/v1/bundle/meta.tar.zst", nil)
+	if err != nil {
+		t.Fatal("Expected an HTTP request, but got an error.")
+	}
+	resp = httptest.NewRecorder()
+	app.bundleHandler(resp, req)
+	if resp.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected POST to return 405, got %d", resp.Code)
+	}
+}
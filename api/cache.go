@@ -0,0 +1,178 @@
+package api
+
+import (
+	"compress/gzip"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// updatedAtLayout is the format of the updated-at metadata.
+const updatedAtLayout = "2006-01-02"
+
+// version returns the dataset version (the updated-at metadata), preferring
+// the one kept by the updates poller to avoid a database query per request.
+func (app *api) version() string {
+	if app.updates != nil {
+		if v := app.updates.latest(); v != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	v, err := app.db.MetaRead("updated-at")
+	if err != nil {
+		slog.Error("could not read the dataset version", "error", err)
+		return ""
+	}
+	return strings.TrimSpace(v)
+}
+
+func etag(v string) string { return fmt.Sprintf(`W/"%s"`, v) }
+
+// notModified returns whether the client already has the response for the
+// dataset version, according to the If-None-Match and If-Modified-Since
+// headers.
+func notModified(r *http.Request, e string, m time.Time) bool {
+	if h := r.Header.Get("If-None-Match"); h != "" {
+		for t := range strings.SplitSeq(h, ",") {
+			t = strings.TrimSpace(t)
+			if t == "*" || strings.TrimPrefix(t, "W/") == strings.TrimPrefix(e, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if m.IsZero() {
+		return false
+	}
+	s, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !m.After(s)
+}
+
+// acceptsGzip returns whether gzip is in the Accept-Encoding of the request
+// with a q-value greater than zero (e.g. gzip;q=0.0 refuses it). An invalid
+// q-value is taken as a refusal, since uncompressed responses are always safe.
+func acceptsGzip(r *http.Request) bool {
+	for v := range strings.SplitSeq(r.Header.Get("Accept-Encoding"), ",") {
+		e, ps, _ := strings.Cut(strings.TrimSpace(v), ";")
+		if !strings.EqualFold(strings.TrimSpace(e), "gzip") {
+			continue
+		}
+		for p := range strings.SplitSeq(ps, ";") {
+			k, q, ok := strings.Cut(strings.TrimSpace(p), "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(k), "q") {
+				continue
+			}
+			n, err := strconv.ParseFloat(strings.TrimSpace(q), 64)
+			return err == nil && n > 0
+		}
+		return true
+	}
+	return false
+}
+
+// cacheResponseWriter adds the validators to successful responses and, if
+// the client accepts it, compresses the body with gzip.
+type cacheResponseWriter struct {
+	http.ResponseWriter
+	etag         string
+	lastModified time.Time
+	compress     bool
+	gzip         *gzip.Writer
+	wroteHeader  bool
+}
+
+func (w *cacheResponseWriter) WriteHeader(s int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	h := w.Header()
+	if s == http.StatusOK && w.etag != "" {
+		h.Set("ETag", w.etag)
+		if !w.lastModified.IsZero() {
+			h.Set("Last-Modified", w.lastModified.Format(http.TimeFormat))
+		}
+	}
+	if w.compress && s != http.StatusNoContent && s != http.StatusNotModified && s >= http.StatusOK {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gzip = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(s)
+}
+
+func (w *cacheResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gzip != nil {
+		return w.gzip.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *cacheResponseWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+func (w *cacheResponseWriter) close() error {
+	if w.gzip == nil {
+		return nil
+	}
+	return w.gzip.Close()
+}
+
+// cacheWrapper answers conditional GET requests with 304 Not Modified when the
+// dataset has not changed since the client's copy, and compresses responses
+// with gzip when the client accepts it (see notModifiedWrapper and
+// gzipWrapper).
+func (app *api) cacheWrapper(e string, h func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return app.notModifiedWrapper(e, gzipWrapper(e, h))
+}
+
+// notModifiedWrapper adds the validators (ETag and Last-Modified) of the
+// dataset version to successful responses, and answers conditional GET
+// requests with 304 Not Modified when the dataset has not changed since the
+// client's copy. Responses with enrichment data or filtered by tags change
+// independently of the dataset, so they are never answered with 304.
+func (app *api) notModifiedWrapper(e string, h func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		i := time.Now().UnixMilli()
+		if app.authEnabled() {
+			w.Header().Add("Vary", "Authorization") // API keys might have different profiles
+		}
+		cw := cacheResponseWriter{ResponseWriter: w}
+		if r.Method == http.MethodGet && !app.enriches(e, r) && !r.URL.Query().Has("tag") {
+			if v := app.version(); v != "" {
+				cw.etag = etag(v)
+				if t, err := time.Parse(updatedAtLayout, v); err == nil {
+					cw.lastModified = t
+				}
+				if notModified(r, cw.etag, cw.lastModified) {
+					w.Header().Set("Cache-Control", app.cacheControlFor(e, r))
+					w.Header().Set("ETag", cw.etag)
+					w.WriteHeader(http.StatusNotModified)
+					registerMetric(e, r.Method, http.StatusNotModified, i)
+					return
+				}
+			}
+		}
+		h(&cw, r)
+	}
+}
+
+// gzipWrapper compresses responses with gzip when the client accepts it.
+func gzipWrapper(e string, h func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		cw := cacheResponseWriter{ResponseWriter: w, compress: acceptsGzip(r)}
+		h(&cw, r)
+		if err := cw.close(); err != nil {
+			slog.Error("could not finish the compressed response", "endpoint", e, "error", err)
+		}
+	}
+}
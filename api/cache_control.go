@@ -0,0 +1,106 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// AutoCacheMaxAge computes the max-age of the responses from the expected
+	// date of the next dataset update.
+	AutoCacheMaxAge = "auto"
+
+	cacheMaxAge    = 24 * time.Hour // when the dataset version is not a date
+	minCacheMaxAge = time.Hour
+	maxCacheMaxAge = 7 * 24 * time.Hour
+)
+
+// cachePolicy sets the Cache-Control header of the responses that only change
+// when the dataset is updated. The zero value computes the max-age from the
+// expected date of the next dataset update.
+type cachePolicy struct {
+	fixed  bool
+	maxAge time.Duration
+	now    func() time.Time
+}
+
+// newCachePolicy parses the max-age of the responses: auto, or a duration to
+// use the same max-age for every response (0 disables caching).
+func newCachePolicy(s string) (cachePolicy, error) {
+	if s == "" || s == AutoCacheMaxAge {
+		return cachePolicy{}, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return cachePolicy{}, fmt.Errorf("invalid cache max-age %s, expected %s or a duration such as 24h", s, AutoCacheMaxAge)
+	}
+	return cachePolicy{fixed: true, maxAge: d}, nil
+}
+
+// nextUpdate is when the dataset of version v is expected to be updated: the
+// Federal Revenue releases the data monthly.
+func nextUpdate(v time.Time) time.Time { return v.AddDate(0, 1, 0) }
+
+// maxAgeFor returns the time until the next update of the dataset version v,
+// from one hour (the update is due, it might happen at any time) to one week
+// (an early release is not cached for too long).
+func (c cachePolicy) maxAgeFor(v string) time.Duration {
+	if c.fixed {
+		return c.maxAge
+	}
+	t, err := time.Parse(updatedAtLayout, v)
+	if err != nil {
+		return cacheMaxAge
+	}
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+	return min(maxCacheMaxAge, max(minCacheMaxAge, nextUpdate(t).Sub(now())))
+}
+
+// header returns the Cache-Control for the dataset version v. Responses are
+// public, so CDNs can cache them, unless they depend on the API key.
+func (c cachePolicy) header(v string, private bool) string {
+	return maxAgeHeader(c.maxAgeFor(v), private)
+}
+
+// updatedHeader returns the Cache-Control of the date of the last update.
+// Clients check it to know when the dataset changes, so it is cached for one
+// day at most, regardless of the expected date of the next update.
+func (c cachePolicy) updatedHeader(private bool) string {
+	d := cacheMaxAge
+	if c.fixed {
+		d = min(d, c.maxAge)
+	}
+	return maxAgeHeader(d, private)
+}
+
+func maxAgeHeader(d time.Duration, private bool) string {
+	s := int(d.Seconds())
+	if s <= 0 {
+		return "no-cache"
+	}
+	if private {
+		return fmt.Sprintf("private, max-age=%d", s)
+	}
+	return fmt.Sprintf("public, max-age=%d", s)
+}
+
+func (app *api) cacheControl() string {
+	return app.cache.header(app.version(), app.authEnabled())
+}
+
+// cacheControlFor is the Cache-Control of the endpoint e that might not follow
+// the dataset updates: the enrichment data can be changed at any time, so
+// responses with it are revalidated on every request.
+func (app *api) cacheControlFor(e string, r *http.Request) string {
+	switch {
+	case e == "updated":
+		return app.cache.updatedHeader(app.authEnabled())
+	case app.enriches(e, r):
+		return "private, no-cache"
+	}
+	return app.cacheControl()
+}
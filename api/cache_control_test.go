@@ -0,0 +1,77 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewCachePolicy(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		expected cachePolicy
+		err      bool
+	}{
+		{"", cachePolicy{}, false},
+		{"auto", cachePolicy{}, false},
+		{"24h", cachePolicy{fixed: true, maxAge: 24 * time.Hour}, false},
+		{"0", cachePolicy{fixed: true}, false},
+		{"-1h", cachePolicy{}, true},
+		{"forever", cachePolicy{}, true},
+	} {
+		got, err := newCachePolicy(tc.value)
+		if tc.err && err == nil {
+			t.Errorf("expected error for %s, got nil", tc.value)
+		}
+		if !tc.err && err != nil {
+			t.Errorf("expected no error for %s, got %s", tc.value, err)
+		}
+		if got.fixed != tc.expected.fixed || got.maxAge != tc.expected.maxAge {
+			t.Errorf("expected %s to be %+v, got %+v", tc.value, tc.expected, got)
+		}
+	}
+}
+
+func TestCachePolicyHeader(t *testing.T) {
+	now := time.Date(2024, 8, 20, 12, 0, 0, 0, time.UTC)
+	auto := cachePolicy{now: func() time.Time { return now }}
+	for _, tc := range []struct {
+		desc     string
+		policy   cachePolicy
+		version  string
+		private  bool
+		expected string
+	}{
+		{"next update in less than a week", auto, "2024-07-24", false, "public, max-age=302400"},
+		{"next update in more than a week", auto, "2024-08-17", false, "public, max-age=604800"},
+		{"next update is due", auto, "2024-07-01", false, "public, max-age=3600"},
+		{"version is not a date", auto, "", false, "public, max-age=86400"},
+		{"api keys", auto, "2024-07-24", true, "private, max-age=302400"},
+		{"fixed", cachePolicy{fixed: true, maxAge: time.Hour}, "2024-08-17", false, "public, max-age=3600"},
+		{"disabled", cachePolicy{fixed: true}, "2024-08-17", false, "no-cache"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := tc.policy.header(tc.version, tc.private); got != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestCachePolicyUpdatedHeader(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		policy   cachePolicy
+		expected string
+	}{
+		{"auto", cachePolicy{}, "public, max-age=86400"},
+		{"fixed longer than a day", cachePolicy{fixed: true, maxAge: 7 * 24 * time.Hour}, "public, max-age=86400"},
+		{"fixed shorter than a day", cachePolicy{fixed: true, maxAge: time.Hour}, "public, max-age=3600"},
+		{"disabled", cachePolicy{fixed: true}, "no-cache"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := tc.policy.updatedHeader(false); got != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
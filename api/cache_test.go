@@ -0,0 +1,120 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCacheWrapper(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Fatalf("could not read response fixture: %s", err)
+	}
+	expected := strings.TrimSpace(string(b))
+	u := newUpdates()
+	u.publish("2022-10-16")
+	for _, c := range []struct {
+		desc    string
+		headers map[string]string
+		status  int
+		etag    string
+	}{
+		{"no conditional headers", nil, http.StatusOK, `W/"2022-10-16"`},
+		{"matching etag", map[string]string{"If-None-Match": `W/"2022-10-16"`}, http.StatusNotModified, `W/"2022-10-16"`},
+		{"strong matching etag", map[string]string{"If-None-Match": `"2022-10-16"`}, http.StatusNotModified, `W/"2022-10-16"`},
+		{"outdated etag", map[string]string{"If-None-Match": `W/"2022-09-18"`}, http.StatusOK, `W/"2022-10-16"`},
+		{"not modified since", map[string]string{"If-Modified-Since": "Mon, 17 Oct 2022 00:00:00 GMT"}, http.StatusNotModified, `W/"2022-10-16"`},
+		{"modified since", map[string]string{"If-Modified-Since": "Sun, 18 Sep 2022 00:00:00 GMT"}, http.StatusOK, `W/"2022-10-16"`},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/19131243000197", nil)
+			if err != nil {
+				t.Fatal("Expected an HTTP request, but got an error.")
+			}
+			for k, v := range c.headers {
+				req.Header.Set(k, v)
+			}
+			app := api{db: &mockDatabase{}, updates: u}
+			resp := httptest.NewRecorder()
+			handler := http.HandlerFunc(app.cacheWrapper("company", app.companyHandler))
+			handler.ServeHTTP(resp, req)
+			if resp.Code != c.status {
+				t.Errorf("expected status %d, got %d", c.status, resp.Code)
+			}
+			if got := resp.Header().Get("ETag"); got != c.etag {
+				t.Errorf("expected etag %s, got %s", c.etag, got)
+			}
+			if c.status == http.StatusNotModified {
+				if resp.Body.Len() != 0 {
+					t.Errorf("expected no body, got %s", resp.Body.String())
+				}
+				return
+			}
+			if got := resp.Header().Get("Last-Modified"); got != "Sun, 16 Oct 2022 00:00:00 GMT" {
+				t.Errorf("expected last modified to be Sun, 16 Oct 2022 00:00:00 GMT, got %s", got)
+			}
+			if got := strings.TrimSpace(resp.Body.String()); got != expected {
+				t.Errorf("expected %s, got %s", expected, got)
+			}
+		})
+	}
+}
+
+func TestCacheWrapperGzip(t *testing.T) {
+	for _, c := range []struct {
+		encoding string
+		gzip     bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip;q=1.0", true},
+		{"gzip;q=0", false},
+		{"gzip;q=0.0", false},
+		{"gzip; q=0.000", false},
+		{"gzip;q=0.5", true},
+		{"gzip;q=invalid", false},
+	} {
+		t.Run(c.encoding, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/updated", nil)
+			if err != nil {
+				t.Fatal("Expected an HTTP request, but got an error.")
+			}
+			req.Header.Set("Accept-Encoding", c.encoding)
+			app := api{db: &mockDatabase{}}
+			resp := httptest.NewRecorder()
+			handler := http.HandlerFunc(app.cacheWrapper("updated", app.updatedHandler))
+			handler.ServeHTTP(resp, req)
+			if resp.Code != http.StatusOK {
+				t.Errorf("expected status 200, got %d", resp.Code)
+			}
+			if got := resp.Header().Get("ETag"); got != `W/"42"` {
+				t.Errorf(`expected etag W/"42", got %s`, got)
+			}
+			var r io.Reader = resp.Body
+			if c.gzip {
+				if got := resp.Header().Get("Content-Encoding"); got != "gzip" {
+					t.Errorf("expected gzip content encoding, got %s", got)
+				}
+				r, err = gzip.NewReader(resp.Body)
+				if err != nil {
+					t.Fatalf("expected a gzip body, got %s", err)
+				}
+			} else if got := resp.Header().Get("Content-Encoding"); got != "" {
+				t.Errorf("expected no content encoding, got %s", got)
+			}
+			b, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("could not read the response body: %s", err)
+			}
+			if got := strings.TrimSpace(string(b)); got != `{"message":"42"}` {
+				t.Errorf(`expected {"message":"42"}, got %s`, got)
+			}
+		})
+	}
+}
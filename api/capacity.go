@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"encoding/json/v2"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const capacityTimeout = 5 * time.Second
+
+// capacity is a flat JSON object so autoscalers (e.g. KEDA's metrics-api
+// scaler) can pick any value by its key.
+type capacity struct {
+	InFlight       int64    `json:"in_flight_requests"`
+	PoolInUse      int32    `json:"pool_in_use"`
+	PoolIdle       int32    `json:"pool_idle"`
+	PoolMax        int32    `json:"pool_max"`
+	PoolSaturation float64  `json:"pool_saturation"`
+	CacheHitRate   *float64 `json:"cache_hit_rate"`
+}
+
+// inFlightWrapper counts the requests being handled at the moment, in total
+// and per endpoint.
+func (app *api) inFlightWrapper(e string, h func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	g := inFlightRequests.WithLabelValues(e)
+	return func(w http.ResponseWriter, r *http.Request) {
+		app.inFlight.Add(1)
+		g.Inc()
+		defer func() {
+			app.inFlight.Add(-1)
+			g.Dec()
+		}()
+		h(w, r)
+	}
+}
+
+func (app *api) capacityHandler(w http.ResponseWriter, r *http.Request) {
+	i := time.Now().UnixMilli()
+	if r.Method != http.MethodGet {
+		app.messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		registerMetric("capacity", r.Method, http.StatusMethodNotAllowed, i)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), capacityTimeout)
+	defer cancel()
+	c, err := app.db.Capacity(ctx)
+	if err != nil { // pool numbers are still useful without the cache hit rate
+		slog.Warn("could not read the database capacity", "error", err)
+	}
+	b, err := json.Marshal(capacity{
+		InFlight:       app.inFlight.Load(),
+		PoolInUse:      c.InUse,
+		PoolIdle:       c.Idle,
+		PoolMax:        c.Max,
+		PoolSaturation: c.Saturation(),
+		CacheHitRate:   c.CacheHitRate,
+	})
+	if err != nil {
+		app.messageResponse(w, http.StatusInternalServerError, "Erro serializando a capacidade da API.")
+		registerMetric("capacity", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		slog.Error("error responding to capacity request", "error", err)
+	}
+	registerMetric("capacity", r.Method, http.StatusOK, i)
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCapacityHandler(t *testing.T) {
+	for _, c := range []struct {
+		method  string
+		status  int
+		content string
+	}{
+		{
+			http.MethodGet,
+			http.StatusOK,
+			`{"in_flight_requests":1,"pool_in_use":2,"pool_idle":6,"pool_max":8,"pool_saturation":0.25,"cache_hit_rate":0.9}`,
+		},
+		{
+			http.MethodPost,
+			http.StatusMethodNotAllowed,
+			`{"message":"Essa URL aceita apenas o método GET."}`,
+		},
+	} {
+		req, err := http.NewRequest(c.method, "/v1/capacity", nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		app := api{db: &mockDatabase{}}
+		app.inFlight.Add(1)
+		resp := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.capacityHandler)
+		handler.ServeHTTP(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("expected %s /v1/capacity to return %d, got %d", c.method, c.status, resp.Code)
+		}
+		if got := strings.TrimSpace(resp.Body.String()); got != c.content {
+			t.Errorf("expected %s, got %s", c.content, got)
+		}
+	}
+}
+
+func TestInFlightWrapper(t *testing.T) {
+	app := api{db: &mockDatabase{}}
+	var during int64
+	h := app.inFlightWrapper("test", func(w http.ResponseWriter, r *http.Request) {
+		during = app.inFlight.Load()
+	})
+	req, err := http.NewRequest(http.MethodGet, "/", nil)
+	if err != nil {
+		t.Fatal("Expected an HTTP request, but got an error.")
+	}
+	h(httptest.NewRecorder(), req)
+	if during != 1 {
+		t.Errorf("expected 1 request in flight while handling, got %d", during)
+	}
+	if n := app.inFlight.Load(); n != 0 {
+		t.Errorf("expected no requests in flight after handling, got %d", n)
+	}
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json/jsontext"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	snakeCase = "snake"
+	camelCase = "camel"
+
+	numberNumbers = "number"
+	stringNumbers = "string"
+)
+
+// codeKeys are the numeric fields that are not quantities, besides the ones
+// starting with codigo or identificador (see isCode).
+var codeKeys = map[string]struct{}{
+	"cnae_fiscal":                 {},
+	"situacao_cadastral":          {},
+	"motivo_situacao_cadastral":   {},
+	"qualificacao_do_responsavel": {},
+}
+
+// isCode tells whether the number in the key k is an identifier or a code
+// (e.g. codigo_municipio_ibge, cnae_fiscal), as opposed to a quantity (e.g.
+// capital_social, ano).
+func isCode(k string) bool {
+	if strings.HasPrefix(k, "codigo") || strings.HasPrefix(k, "identificador") {
+		return true
+	}
+	_, ok := codeKeys[k]
+	return ok
+}
+
+// camelKeys caches the conversion of the JSON keys, which are the same few
+// dozens for every company.
+var camelKeys sync.Map
+
+// toCamelCase converts a snake_case key to camelCase (e.g. cnae_fiscal to
+// cnaeFiscal).
+func toCamelCase(k string) string {
+	if v, ok := camelKeys.Load(k); ok {
+		return v.(string)
+	}
+	var b strings.Builder
+	up := false
+	for i, r := range k {
+		if r == '_' {
+			up = i > 0
+			continue
+		}
+		if up && r >= 'a' && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		up = false
+		b.WriteRune(r)
+	}
+	camelKeys.Store(k, b.String())
+	return b.String()
+}
+
+// rewriteJSON rewrites the JSON in r token by token: with camel, the keys of
+// the objects are converted to camelCase; with codes, the numbers that are
+// identifiers or codes are written as strings, with the same digits, so
+// JavaScript clients do not lose precision above 2^53; with formatted, the
+// companies get presentation fields (see formattedFields) before they end.
+func rewriteJSON(w io.Writer, r io.Reader, camel, codes, formatted bool) error {
+	dec := jsontext.NewDecoder(r)
+	enc := jsontext.NewEncoder(w)
+	var name string              // the key, if the previous token was one
+	var objs []map[string]string // the scalar values of the open objects, if formatted
+	for {
+		t, err := dec.ReadToken()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading json: %w", err)
+		}
+		k, n := dec.StackIndex(dec.StackDepth())
+		switch {
+		case t.Kind() == '"' && k == '{' && n%2 == 1: // odd positions in an object are names
+			name = t.String()
+			if camel {
+				t = jsontext.String(toCamelCase(name))
+			}
+		case t.Kind() == '0' && codes && name != "" && isCode(name):
+			t = jsontext.String(t.String()) // the raw number, not parsed as a float
+			name = ""
+		default:
+			if formatted && name != "" && (t.Kind() == '"' || t.Kind() == '0') {
+				objs[len(objs)-1][name] = t.String()
+			}
+			name = ""
+		}
+		if formatted {
+			switch t.Kind() {
+			case '{':
+				objs = append(objs, make(map[string]string))
+			case '}':
+				o := objs[len(objs)-1]
+				objs = objs[:len(objs)-1]
+				for _, f := range formattedFields(o) {
+					if camel {
+						f.key = toCamelCase(f.key)
+					}
+					if err := enc.WriteToken(jsontext.String(f.key)); err != nil {
+						return fmt.Errorf("error writing json: %w", err)
+					}
+					if err := enc.WriteToken(jsontext.String(f.value)); err != nil {
+						return fmt.Errorf("error writing json: %w", err)
+					}
+				}
+			}
+		}
+		if err := enc.WriteToken(t); err != nil {
+			return fmt.Errorf("error writing json: %w", err)
+		}
+	}
+}
+
+// caseResponseWriter holds the response so its keys (and numbers) can be
+// converted once the handler is done.
+type caseResponseWriter struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	camel     bool
+	codes     bool
+	formatted bool
+}
+
+func (w *caseResponseWriter) WriteHeader(s int) {
+	if w.status == 0 {
+		w.status = s
+	}
+}
+
+func (w *caseResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+func (w *caseResponseWriter) flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	o := w.body.Bytes()
+	if len(o) > 0 && strings.Contains(w.Header().Get("Content-Type"), "json") {
+		var b bytes.Buffer
+		if err := rewriteJSON(&b, bytes.NewReader(o), w.camel, w.codes, w.formatted); err != nil {
+			slog.Error("could not convert response keys or numbers", "error", err)
+		} else {
+			o = b.Bytes()
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if _, err := w.ResponseWriter.Write(o); err != nil {
+		slog.Error("error writing converted response", "error", err)
+	}
+}
+
+// caseWrapper converts the keys of the JSON response to camelCase when the
+// request has case=camel (the default, snake, is the format in the database),
+// the identifiers and codes to strings when it has numbers=string, and adds
+// the pt-BR presentation fields when it has formatted=true.
+func (app *api) caseWrapper(e string, h func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var cw caseResponseWriter
+		switch v := q.Get("case"); v {
+		case "", snakeCase:
+		case camelCase:
+			cw.camel = true
+		default:
+			i := time.Now().UnixMilli()
+			app.messageResponse(w, http.StatusBadRequest, fmt.Sprintf("Formato %s inválido, as opções são: %s, %s.", v, snakeCase, camelCase))
+			registerMetric(e, r.Method, http.StatusBadRequest, i)
+			return
+		}
+		switch v := q.Get("numbers"); v {
+		case "", numberNumbers:
+		case stringNumbers:
+			cw.codes = true
+		default:
+			i := time.Now().UnixMilli()
+			app.messageResponse(w, http.StatusBadRequest, fmt.Sprintf("Formato de números %s inválido, as opções são: %s, %s.", v, numberNumbers, stringNumbers))
+			registerMetric(e, r.Method, http.StatusBadRequest, i)
+			return
+		}
+		switch q.Get("formatted") {
+		case "", "false":
+		case "true":
+			cw.formatted = true
+		default:
+			i := time.Now().UnixMilli()
+			app.messageResponse(w, http.StatusBadRequest, "Valor inválido para formatted, as opções são: true, false.")
+			registerMetric(e, r.Method, http.StatusBadRequest, i)
+			return
+		}
+		if !cw.camel && !cw.codes && !cw.formatted {
+			h(w, r)
+			return
+		}
+		cw.ResponseWriter = w
+		h(&cw, r)
+		cw.flush()
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestToCamelCase(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		expected string
+	}{
+		{"cnpj", "cnpj"},
+		{"cnae_fiscal", "cnaeFiscal"},
+		{"descricao_identificador_matriz_filial", "descricaoIdentificadorMatrizFilial"},
+		{"ddd_telefone_1", "dddTelefone1"},
+		{"_id", "id"},
+	} {
+		if got := toCamelCase(tc.value); got != tc.expected {
+			t.Errorf("expected %s to be %s, got %s", tc.value, tc.expected, got)
+		}
+	}
+}
+
+func TestRewriteJSON(t *testing.T) {
+	j := `{"cnae_fiscal":6204000,"razao_social":"nome_da_empresa","qsa":[{"nome_socio":"X","codigo_pais":null}],"cnaes_secundarios":[],"capital_social":1.50}`
+	for _, tc := range []struct {
+		desc     string
+		json     string
+		camel    bool
+		codes    bool
+		expected string
+	}{
+		{
+			"camel case",
+			j,
+			true,
+			false,
+			`{"cnaeFiscal":6204000,"razaoSocial":"nome_da_empresa","qsa":[{"nomeSocio":"X","codigoPais":null}],"cnaesSecundarios":[],"capitalSocial":1.50}`,
+		},
+		{
+			"codes as strings",
+			j,
+			false,
+			true,
+			`{"cnae_fiscal":"6204000","razao_social":"nome_da_empresa","qsa":[{"nome_socio":"X","codigo_pais":null}],"cnaes_secundarios":[],"capital_social":1.50}`,
+		},
+		{
+			"both",
+			j,
+			true,
+			true,
+			`{"cnaeFiscal":"6204000","razaoSocial":"nome_da_empresa","qsa":[{"nomeSocio":"X","codigoPais":null}],"cnaesSecundarios":[],"capitalSocial":1.50}`,
+		},
+		{
+			"nested codes and quantities",
+			`{"cnae_fiscal":{"codigo":6204000,"descricao":"X"},"regime_tributario":[{"ano":2024,"quantidade_de_escrituracoes":1}],"identificador_de_socio":2}`,
+			false,
+			true,
+			`{"cnae_fiscal":{"codigo":"6204000","descricao":"X"},"regime_tributario":[{"ano":2024,"quantidade_de_escrituracoes":1}],"identificador_de_socio":"2"}`,
+		},
+		{
+			"beyond 2^53",
+			`{"codigo_municipio":9007199254740993,"codigo_pais":-9223372036854775809,"capital_social":9007199254740993}`,
+			false,
+			true,
+			`{"codigo_municipio":"9007199254740993","codigo_pais":"-9223372036854775809","capital_social":9007199254740993}`,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := rewriteJSON(&b, strings.NewReader(tc.json), tc.camel, tc.codes, false); err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if got := strings.TrimSpace(b.String()); got != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestCaseWrapper(t *testing.T) {
+	for _, c := range []struct {
+		path    string
+		status  int
+		content string
+	}{
+		{"/19131243000197?perfil=minimal", http.StatusOK, `"razao_social"`},
+		{"/19131243000197?perfil=minimal&case=snake", http.StatusOK, `"razao_social"`},
+		{"/19131243000197?perfil=minimal&case=camel", http.StatusOK, `"razaoSocial"`},
+		{"/00000000000000?case=camel", http.StatusNotFound, `{"message":"CNPJ 00.000.000/0000-00 não encontrado."}`},
+		{"/19131243000197?case=kebab", http.StatusBadRequest, `{"message":"Formato kebab inválido, as opções são: snake, camel."}`},
+		{"/19131243000197?numbers=number", http.StatusOK, `"cnae_fiscal": 9430800`},
+		{"/19131243000197?numbers=string", http.StatusOK, `"cnae_fiscal":"9430800"`},
+		{"/19131243000197?numbers=string&case=camel", http.StatusOK, `"cnaeFiscal":"9430800"`},
+		{"/19131243000197?perfil=minimal&formatted=true", http.StatusOK, `"cnpj_formatado":"19.131.243/0001-97"`},
+		{"/19131243000197?formatted=true", http.StatusOK, `"endereco_formatado":"AVENIDA PAULISTA 37, 37, ANDAR 4, BELA VISTA, SAO PAULO - SP, 01311-902"`},
+		{"/19131243000197?formatted=sim", http.StatusBadRequest, `{"message":"Valor inválido para formatted, as opções são: true, false."}`},
+		{"/19131243000197?numbers=float", http.StatusBadRequest, `{"message":"Formato de números float inválido, as opções são: number, string."}`},
+	} {
+		req, err := http.NewRequest(http.MethodGet, c.path, nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		app := api{db: &mockDatabase{}}
+		resp := httptest.NewRecorder()
+		app.caseWrapper("test", app.companyHandler)(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("expected %s to return %d, got %d", c.path, c.status, resp.Code)
+		}
+		if got := resp.Body.String(); !strings.Contains(got, c.content) {
+			t.Errorf("expected %s to contain %s, got %s", c.path, c.content, got)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/cuducos/go-cnpj"
+	"github.com/cuducos/minha-receita/db"
+	"github.com/cuducos/minha-receita/transform"
+)
+
+// cnaes is the response of the CNAEs endpoint, with the primary CNAE (cnae
+// fiscal) in the same format as the secondary ones.
+type cnaes struct {
+	CNPJ            string           `json:"cnpj"`
+	CNAEFiscal      *transform.CNAE  `json:"cnae_fiscal"`
+	CNAESecundarios []transform.CNAE `json:"cnaes_secundarios"`
+}
+
+func newCNAEs(s string) (cnaes, error) {
+	var c transform.Company
+	if err := json.Unmarshal([]byte(s), &c); err != nil {
+		return cnaes{}, fmt.Errorf("error parsing company: %w", err)
+	}
+	r := cnaes{CNPJ: c.CNPJ, CNAESecundarios: c.CNAESecundarios}
+	if c.CNAEFiscal != nil {
+		r.CNAEFiscal = &transform.CNAE{Codigo: *c.CNAEFiscal}
+		if c.CNAEFiscalDescricao != nil {
+			r.CNAEFiscal.Descricao = *c.CNAEFiscalDescricao
+		}
+	}
+	if r.CNAESecundarios == nil {
+		r.CNAESecundarios = []transform.CNAE{}
+	}
+	return r, nil
+}
+
+// cnaesHandler serves only the primary and secondary CNAEs of a company, for
+// clients checking activities that do not need the whole document.
+func (app *api) cnaesHandler(w http.ResponseWriter, r *http.Request) {
+	i := time.Now().UnixMilli()
+	if r.Method != http.MethodGet {
+		app.messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		registerMetric("cnaes", r.Method, http.StatusMethodNotAllowed, i)
+		return
+	}
+	n := r.PathValue("cnpj")
+	if !cnpj.IsValid(n) {
+		app.messageResponse(w, http.StatusBadRequest, fmt.Sprintf("CNPJ %s inválido.", n))
+		registerMetric("cnaes", r.Method, http.StatusBadRequest, i)
+		return
+	}
+	s, err := app.getCompany(n, db.ProfileCNAEs)
+	if err != nil {
+		app.messageResponse(w, http.StatusNotFound, app.companyNotFound(n))
+		registerMetric("cnaes", r.Method, http.StatusNotFound, i)
+		return
+	}
+	c, err := newCNAEs(s)
+	if err != nil {
+		slog.Error("could not read cnaes", "cnpj", n, "error", err)
+		app.messageResponse(w, http.StatusInternalServerError, "Erro lendo os CNAEs da empresa.")
+		registerMetric("cnaes", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		app.messageResponse(w, http.StatusInternalServerError, "Erro serializando os CNAEs da empresa.")
+		registerMetric("cnaes", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.Header().Set("Cache-Control", app.cacheControl())
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		slog.Error("error responding to cnaes request", "cnpj", n, "error", err)
+	}
+	registerMetric("cnaes", r.Method, http.StatusOK, i)
+}
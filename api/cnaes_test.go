@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCNAEsHandler(t *testing.T) {
+	for _, c := range []struct {
+		method  string
+		path    string
+		status  int
+		content string
+	}{
+		{
+			http.MethodGet,
+			"/v1/cnpj/19131243000197/cnaes",
+			http.StatusOK,
+			`{"cnpj":"19131243000197","cnae_fiscal":{"codigo":9430800,"descricao":"Atividades de associações de defesa de direitos sociais"},"cnaes_secundarios":[{"codigo":9493600,"descricao":"Atividades de organizações associativas ligadas à cultura e à arte"},{"codigo":9499500,"descricao":"Atividades associativas não especificadas anteriormente"},{"codigo":8599699,"descricao":"Outras atividades de ensino não especificadas anteriormente"},{"codigo":8230001,"descricao":"Serviços de organização de feiras, congressos, exposições e festas"},{"codigo":6204000,"descricao":"Consultoria em tecnologia da informação"}]}`,
+		},
+		{
+			http.MethodPost,
+			"/v1/cnpj/19131243000197/cnaes",
+			http.StatusMethodNotAllowed,
+			`{"message":"Essa URL aceita apenas o método GET."}`,
+		},
+		{
+			http.MethodGet,
+			"/v1/cnpj/foobar/cnaes",
+			http.StatusBadRequest,
+			`{"message":"CNPJ foobar inválido."}`,
+		},
+		{
+			http.MethodGet,
+			"/v1/cnpj/33683111000280/cnaes",
+			http.StatusNotFound,
+			`{"message":"CNPJ 33.683.111/0002-80 não encontrado."}`,
+		},
+	} {
+		req, err := http.NewRequest(c.method, c.path, nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		app := api{db: &mockDatabase{}}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/v1/cnpj/{cnpj}/cnaes", app.cnaesHandler)
+		resp := httptest.NewRecorder()
+		mux.ServeHTTP(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("expected %s %s to return %d, got %d", c.method, c.path, c.status, resp.Code)
+		}
+		if got := strings.TrimSpace(resp.Body.String()); got != c.content {
+			t.Errorf("expected %s, got %s", c.content, got)
+		}
+	}
+}
+
+func TestNewCNAEs(t *testing.T) {
+	c, err := newCNAEs(`{"cnpj":"19131243000197","cnae_fiscal":null,"cnae_fiscal_descricao":null,"cnaes_secundarios":null}`)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if c.CNAEFiscal != nil {
+		t.Errorf("expected no primary cnae, got %v", c.CNAEFiscal)
+	}
+	if c.CNAESecundarios == nil || len(c.CNAESecundarios) != 0 {
+		t.Errorf("expected an empty list of secondary cnaes, got %v", c.CNAESecundarios)
+	}
+}
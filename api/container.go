@@ -0,0 +1,193 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupFiles are the files read by the containerCollector on every scrape.
+var cgroupFiles = []string{"cpu.stat", "cpu.max", "memory.current", "memory.max"}
+
+// cgroupDir finds the directory of the cgroup (v2) of this process, which is
+// the container when running in Docker or Kubernetes. It returns false when
+// cgroup v2 is not available (e.g. cgroup v1 or not Linux), when the process
+// is in the root cgroup (i.e. not in a container) or when the cpu and memory
+// controllers are not enabled in the cgroup.
+func cgroupDir(root, proc string) (string, bool) {
+	b, err := os.ReadFile(proc)
+	if err != nil {
+		return "", false
+	}
+	for l := range strings.Lines(string(b)) {
+		p, ok := strings.CutPrefix(strings.TrimSpace(l), "0::")
+		if !ok {
+			continue
+		}
+		if p == "/" {
+			return "", false
+		}
+		d := filepath.Join(root, p)
+		for _, f := range cgroupFiles {
+			if _, err := os.Stat(filepath.Join(d, f)); err != nil {
+				return "", false
+			}
+		}
+		return d, true
+	}
+	return "", false
+}
+
+// readCgroupValue reads a file with a single value, returning false if the
+// value is max (no limit).
+func readCgroupValue(pth string) (float64, bool, error) {
+	b, err := os.ReadFile(pth)
+	if err != nil {
+		return 0, false, fmt.Errorf("could not read %s: %w", pth, err)
+	}
+	v := strings.TrimSpace(string(b))
+	if v == "max" {
+		return 0, false, nil
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("could not parse %s in %s: %w", v, pth, err)
+	}
+	return n, true, nil
+}
+
+// containerCollector reads the CPU and memory of the cgroup of the web API on
+// every scrape, so the metrics reflect the container and its limits instead
+// of the host it runs on.
+type containerCollector struct {
+	dir          string
+	cpuUsage     *prometheus.Desc
+	cpuThrottled *prometheus.Desc
+	cpuLimit     *prometheus.Desc
+	memoryUsage  *prometheus.Desc
+	memoryLimit  *prometheus.Desc
+}
+
+func newContainerCollector(dir string) *containerCollector {
+	return &containerCollector{
+		dir: dir,
+		cpuUsage: prometheus.NewDesc(
+			"minha_receita_container_cpu_usage_seconds_total",
+			"The CPU time used by the container in seconds",
+			nil,
+			nil,
+		),
+		cpuThrottled: prometheus.NewDesc(
+			"minha_receita_container_cpu_throttled_seconds_total",
+			"The time the container was throttled for exceeding its CPU limit in seconds",
+			nil,
+			nil,
+		),
+		cpuLimit: prometheus.NewDesc(
+			"minha_receita_container_cpu_limit_cores",
+			"The CPU limit of the container in cores",
+			nil,
+			nil,
+		),
+		memoryUsage: prometheus.NewDesc(
+			"minha_receita_container_memory_usage_bytes",
+			"The memory used by the container in bytes",
+			nil,
+			nil,
+		),
+		memoryLimit: prometheus.NewDesc(
+			"minha_receita_container_memory_limit_bytes",
+			"The memory limit of the container in bytes",
+			nil,
+			nil,
+		),
+	}
+}
+
+func (c *containerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.cpuUsage
+	ch <- c.cpuThrottled
+	ch <- c.cpuLimit
+	ch <- c.memoryUsage
+	ch <- c.memoryLimit
+}
+
+func (c *containerCollector) cpuStat() (map[string]float64, error) {
+	pth := filepath.Join(c.dir, "cpu.stat")
+	b, err := os.ReadFile(pth)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", pth, err)
+	}
+	s := make(map[string]float64)
+	for l := range strings.Lines(string(b)) {
+		k, v, ok := strings.Cut(strings.TrimSpace(l), " ")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s in %s: %w", k, pth, err)
+		}
+		s[k] = n
+	}
+	return s, nil
+}
+
+func (c *containerCollector) cpuCores() (float64, bool, error) {
+	pth := filepath.Join(c.dir, "cpu.max")
+	b, err := os.ReadFile(pth)
+	if err != nil {
+		return 0, false, fmt.Errorf("could not read %s: %w", pth, err)
+	}
+	q, p, _ := strings.Cut(strings.TrimSpace(string(b)), " ")
+	if q == "max" {
+		return 0, false, nil
+	}
+	qn, err := strconv.ParseFloat(q, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("could not parse the quota in %s: %w", pth, err)
+	}
+	pn, err := strconv.ParseFloat(p, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("could not parse the period in %s: %w", pth, err)
+	}
+	if pn == 0 {
+		return 0, false, nil
+	}
+	return qn / pn, true, nil
+}
+
+func (c *containerCollector) Collect(ch chan<- prometheus.Metric) {
+	metric := func(d *prometheus.Desc, t prometheus.ValueType, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, t, v)
+	}
+	s, err := c.cpuStat()
+	if err != nil {
+		slog.Error("could not collect container cpu metrics", "error", err)
+	} else {
+		metric(c.cpuUsage, prometheus.CounterValue, s["usage_usec"]/1e6)
+		metric(c.cpuThrottled, prometheus.CounterValue, s["throttled_usec"]/1e6)
+	}
+	if n, ok, err := c.cpuCores(); err != nil {
+		slog.Error("could not collect container cpu limit", "error", err)
+	} else if ok {
+		metric(c.cpuLimit, prometheus.GaugeValue, n)
+	}
+	if n, _, err := readCgroupValue(filepath.Join(c.dir, "memory.current")); err != nil {
+		slog.Error("could not collect container memory metrics", "error", err)
+	} else {
+		metric(c.memoryUsage, prometheus.GaugeValue, n)
+	}
+	if n, ok, err := readCgroupValue(filepath.Join(c.dir, "memory.max")); err != nil {
+		slog.Error("could not collect container memory limit", "error", err)
+	} else if ok {
+		metric(c.memoryLimit, prometheus.GaugeValue, n)
+	}
+}
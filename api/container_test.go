@@ -0,0 +1,115 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func writeCgroupFiles(t *testing.T, dir string, fs map[string]string) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("expected no error creating %s, got %s", dir, err)
+	}
+	for n, c := range fs {
+		if err := os.WriteFile(filepath.Join(dir, n), []byte(c), 0644); err != nil {
+			t.Fatalf("expected no error writing %s, got %s", n, err)
+		}
+	}
+}
+
+func TestCgroupDir(t *testing.T) {
+	root := t.TempDir()
+	writeCgroupFiles(t, root, map[string]string{"cpu.stat": ""})
+	writeCgroupFiles(t, filepath.Join(root, "kubepods", "pod42"), map[string]string{"cpu.stat": "", "cpu.max": "", "memory.current": "", "memory.max": ""})
+	writeCgroupFiles(t, filepath.Join(root, "kubepods", "pod44"), map[string]string{"cpu.stat": "", "cpu.max": ""})
+	for _, tc := range []struct {
+		desc     string
+		proc     string
+		expected string
+		ok       bool
+	}{
+		{"cgroup v2", "0::/kubepods/pod42\n", filepath.Join(root, "kubepods", "pod42"), true},
+		{"cgroup v1", "4:memory:/kubepods/pod42\n1:cpu:/\n", "", false},
+		{"missing cgroup", "0::/kubepods/pod43\n", "", false},
+		{"root cgroup", "0::/\n", "", false},
+		{"without memory controller", "0::/kubepods/pod44\n", "", false},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			p := filepath.Join(t.TempDir(), "cgroup")
+			if err := os.WriteFile(p, []byte(tc.proc), 0644); err != nil {
+				t.Fatalf("expected no error writing %s, got %s", p, err)
+			}
+			got, ok := cgroupDir(root, p)
+			if ok != tc.ok || got != tc.expected {
+				t.Errorf("expected %s and %t, got %s and %t", tc.expected, tc.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestContainerCollector(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		files    map[string]string
+		expected string
+	}{
+		{
+			"with limits",
+			map[string]string{
+				"cpu.stat":       "usage_usec 1500000\nuser_usec 1000000\nsystem_usec 500000\nthrottled_usec 250000\n",
+				"cpu.max":        "150000 100000\n",
+				"memory.current": "268435456\n",
+				"memory.max":     "536870912\n",
+			},
+			`
+# HELP minha_receita_container_cpu_limit_cores The CPU limit of the container in cores
+# TYPE minha_receita_container_cpu_limit_cores gauge
+minha_receita_container_cpu_limit_cores 1.5
+# HELP minha_receita_container_cpu_throttled_seconds_total The time the container was throttled for exceeding its CPU limit in seconds
+# TYPE minha_receita_container_cpu_throttled_seconds_total counter
+minha_receita_container_cpu_throttled_seconds_total 0.25
+# HELP minha_receita_container_cpu_usage_seconds_total The CPU time used by the container in seconds
+# TYPE minha_receita_container_cpu_usage_seconds_total counter
+minha_receita_container_cpu_usage_seconds_total 1.5
+# HELP minha_receita_container_memory_limit_bytes The memory limit of the container in bytes
+# TYPE minha_receita_container_memory_limit_bytes gauge
+minha_receita_container_memory_limit_bytes 5.36870912e+08
+# HELP minha_receita_container_memory_usage_bytes The memory used by the container in bytes
+# TYPE minha_receita_container_memory_usage_bytes gauge
+minha_receita_container_memory_usage_bytes 2.68435456e+08
+`,
+		},
+		{
+			"without limits",
+			map[string]string{
+				"cpu.stat":       "usage_usec 1500000\nthrottled_usec 0\n",
+				"cpu.max":        "max 100000\n",
+				"memory.current": "268435456\n",
+				"memory.max":     "max\n",
+			},
+			`
+# HELP minha_receita_container_cpu_throttled_seconds_total The time the container was throttled for exceeding its CPU limit in seconds
+# TYPE minha_receita_container_cpu_throttled_seconds_total counter
+minha_receita_container_cpu_throttled_seconds_total 0
+# HELP minha_receita_container_cpu_usage_seconds_total The CPU time used by the container in seconds
+# TYPE minha_receita_container_cpu_usage_seconds_total counter
+minha_receita_container_cpu_usage_seconds_total 1.5
+# HELP minha_receita_container_memory_usage_bytes The memory used by the container in bytes
+# TYPE minha_receita_container_memory_usage_bytes gauge
+minha_receita_container_memory_usage_bytes 2.68435456e+08
+`,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			d := t.TempDir()
+			writeCgroupFiles(t, d, tc.files)
+			c := newContainerCollector(d)
+			if err := testutil.CollectAndCompare(c, strings.NewReader(tc.expected)); err != nil {
+				t.Errorf("expected container metrics to match, got %s", err)
+			}
+		})
+	}
+}
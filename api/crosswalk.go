@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+// crosswalkHandler serves a company by another identifier, such as NIRE or a
+// state registration, mapped to its CNPJ by the crosswalks loaded by the
+// operators (e.g. /v1/by/nire/35300012345).
+func (app *api) crosswalkHandler(w http.ResponseWriter, r *http.Request) {
+	i := time.Now().UnixMilli()
+	if r.Method != http.MethodGet {
+		app.messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		registerMetric("crosswalk", r.Method, http.StatusMethodNotAllowed, i)
+		return
+	}
+	k, id := r.PathValue("kind"), r.PathValue("id")
+	if db.ValidateCrosswalkKind(k) != nil || db.NormalizeCrosswalkID(id) == "" {
+		app.messageResponse(w, http.StatusBadRequest, fmt.Sprintf("Identificador %s %s inválido.", k, id))
+		registerMetric("crosswalk", r.Method, http.StatusBadRequest, i)
+		return
+	}
+	c, _ := clientFrom(r.Context())
+	p, err := profile(r, c)
+	if err != nil {
+		app.messageResponse(w, http.StatusBadRequest, invalidProfileMessage(r.URL.Query().Get("perfil")))
+		registerMetric("crosswalk", r.Method, http.StatusBadRequest, i)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	n, err := app.db.CrosswalkCNPJ(ctx, k, id)
+	if err != nil {
+		slog.Debug("could not find identifier in the crosswalk", "kind", k, "id", id, "error", err)
+		app.messageResponse(w, http.StatusNotFound, fmt.Sprintf("Identificador %s %s não encontrado.", k, id))
+		registerMetric("crosswalk", r.Method, http.StatusNotFound, i)
+		return
+	}
+	s, err := app.getCompany(n, p)
+	if err != nil {
+		app.messageResponse(w, http.StatusNotFound, fmt.Sprintf("Identificador %s %s não encontrado.", k, id))
+		registerMetric("crosswalk", r.Method, http.StatusNotFound, i)
+		return
+	}
+	s = app.enrich("crosswalk", r, n, s)
+	w.Header().Set("Content-type", "application/json")
+	w.Header().Set("Cache-Control", app.cacheControlFor("crosswalk", r))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.WriteString(w, s); err != nil {
+		slog.Error("error responding to crosswalk request", "kind", k, "id", id, "error", err)
+	}
+	registerMetric("crosswalk", r.Method, http.StatusOK, i)
+}
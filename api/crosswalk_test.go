@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCrosswalkHandler(t *testing.T) {
+	for _, c := range []struct {
+		method  string
+		path    string
+		status  int
+		content string
+	}{
+		{
+			http.MethodPost,
+			"/v1/by/nire/53300001234",
+			http.StatusMethodNotAllowed,
+			`{"message":"Essa URL aceita apenas o método GET."}`,
+		},
+		{
+			http.MethodGet,
+			"/v1/by/NIRE/53300001234",
+			http.StatusBadRequest,
+			`{"message":"Identificador NIRE 53300001234 inválido."}`,
+		},
+		{
+			http.MethodGet,
+			"/v1/by/nire/00000000000",
+			http.StatusNotFound,
+			`{"message":"Identificador nire 00000000000 não encontrado."}`,
+		},
+		{
+			http.MethodGet,
+			"/v1/by/nire/53.3.0000123-4?perfil=minimal",
+			http.StatusOK,
+			`"cnpj":"19131243000197"`,
+		},
+	} {
+		req, err := http.NewRequest(c.method, c.path, nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		app := api{db: &mockDatabase{}}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/v1/by/{kind}/{id}", app.crosswalkHandler)
+		resp := httptest.NewRecorder()
+		mux.ServeHTTP(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("expected %s %s to return %d, got %d", c.method, c.path, c.status, resp.Code)
+		}
+		if got := strings.TrimSpace(resp.Body.String()); !strings.Contains(got, c.content) {
+			t.Errorf("expected %s in the response, got %s", c.content, got)
+		}
+	}
+}
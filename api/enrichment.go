@@ -0,0 +1,204 @@
+package api
+
+import (
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cuducos/go-cnpj"
+	"github.com/cuducos/minha-receita/db"
+)
+
+const (
+	enrichmentKey     = "enriquecimento"
+	maxEnrichmentSize = 64 << 10
+	enrichmentTimeout = 2 * time.Second
+)
+
+var (
+	enrichmentField = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+	enrichmentTypes = []string{"string", "number", "integer", "boolean"}
+
+	// endpoints serving a single company, with the enrichment data merged
+	enrichedEndpoints = []string{"company", "crosswalk"}
+)
+
+// enrichmentSchema maps the fields operators can add to the companies (e.g.
+// an internal account manager or a risk score) to their types. The official
+// data is never changed: these fields are kept apart and merged into the
+// responses under the enriquecimento key.
+type enrichmentSchema map[string]string
+
+// newEnrichmentSchemaFromEnv reads the schema from ENRICHMENT_SCHEMA, a comma
+// separated list of field:type (e.g. gerente:string,risco:number). It returns
+// nil if ENRICHMENT_SCHEMA is not set.
+func newEnrichmentSchemaFromEnv() (enrichmentSchema, error) {
+	v := os.Getenv("ENRICHMENT_SCHEMA")
+	if v == "" {
+		return nil, nil
+	}
+	s, err := parseEnrichmentSchema(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ENRICHMENT_SCHEMA %q: %w", v, err)
+	}
+	slog.Info("Enrichment enabled", "fields", len(s))
+	return s, nil
+}
+
+func parseEnrichmentSchema(v string) (enrichmentSchema, error) {
+	s := make(enrichmentSchema)
+	for f := range strings.SplitSeq(v, ",") {
+		n, t, ok := strings.Cut(strings.TrimSpace(f), ":")
+		if !ok {
+			return nil, fmt.Errorf("expected field:type, got %s", f)
+		}
+		if !enrichmentField.MatchString(n) {
+			return nil, fmt.Errorf("invalid field name %s, use up to 64 lowercase letters, digits and underscores", n)
+		}
+		if !slices.Contains(enrichmentTypes, t) {
+			return nil, fmt.Errorf("invalid type %s for %s, valid options are: %s", t, n, strings.Join(enrichmentTypes, ", "))
+		}
+		if _, ok := s[n]; ok {
+			return nil, fmt.Errorf("duplicated field %s", n)
+		}
+		s[n] = t
+	}
+	return s, nil
+}
+
+// check returns a message for the client if the patch does not match the
+// schema. Null values are always valid, they remove the field.
+func (s enrichmentSchema) check(p map[string]any) string {
+	for k, v := range p {
+		t, ok := s[k]
+		if !ok {
+			if !enrichmentField.MatchString(k) {
+				return "Nome de campo inválido no enriquecimento."
+			}
+			return fmt.Sprintf("Campo %s não existe no enriquecimento.", k)
+		}
+		if v == nil {
+			continue
+		}
+		var valid bool
+		switch t {
+		case "string":
+			_, valid = v.(string)
+		case "number":
+			_, valid = v.(float64)
+		case "integer":
+			n, ok := v.(float64)
+			valid = ok && n == math.Trunc(n)
+		case "boolean":
+			_, valid = v.(bool)
+		}
+		if !valid {
+			return fmt.Sprintf("Campo %s deve ser do tipo %s.", k, t)
+		}
+	}
+	return ""
+}
+
+// enriches returns whether the response of an endpoint has the enrichment
+// data merged. These are private annotations, so only requests with an API
+// key get them.
+func (app *api) enriches(e string, r *http.Request) bool {
+	if app.enrichment == nil || !slices.Contains(enrichedEndpoints, e) {
+		return false
+	}
+	_, ok := clientFrom(r.Context())
+	return ok
+}
+
+// enrich merges the enrichment data of a company into its JSON. Errors are
+// only logged since the official data is still a valid response.
+func (app *api) enrich(e string, r *http.Request, n, s string) string {
+	if !app.enriches(e, r) {
+		return s
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), enrichmentTimeout)
+	defer cancel()
+	v, err := app.db.Enrichment(ctx, cnpj.Unmask(n))
+	if err != nil {
+		slog.Error("could not read the enrichment", "cnpj", n, "error", err)
+		return s
+	}
+	if v == "" {
+		return s
+	}
+	s = strings.TrimSuffix(strings.TrimSpace(s), "}")
+	if strings.TrimSpace(s) != "{" {
+		s += ","
+	}
+	return fmt.Sprintf(`%s"%s":%s}`, s, enrichmentKey, v)
+}
+
+// enrichmentHandler applies a JSON merge patch (RFC 7396) to the enrichment
+// data of a company, validated against the schema configured by the
+// operators.
+func (app *api) enrichmentHandler(w http.ResponseWriter, r *http.Request) {
+	i := time.Now().UnixMilli()
+	if r.Method != http.MethodPatch {
+		app.messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método PATCH.")
+		registerMetric("enrichment", r.Method, http.StatusMethodNotAllowed, i)
+		return
+	}
+	if app.enrichment == nil {
+		app.messageResponse(w, http.StatusNotFound, "Enriquecimento não configurado neste servidor.")
+		registerMetric("enrichment", r.Method, http.StatusNotFound, i)
+		return
+	}
+	n := r.PathValue("cnpj")
+	if !cnpj.IsValid(n) {
+		app.messageResponse(w, http.StatusBadRequest, fmt.Sprintf("CNPJ %s inválido.", n))
+		registerMetric("enrichment", r.Method, http.StatusBadRequest, i)
+		return
+	}
+	if _, err := app.getCompany(n, db.ProfileMinimal); err != nil {
+		app.messageResponse(w, http.StatusNotFound, app.companyNotFound(n))
+		registerMetric("enrichment", r.Method, http.StatusNotFound, i)
+		return
+	}
+	b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxEnrichmentSize))
+	if err != nil {
+		app.messageResponse(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("O enriquecimento deve ter no máximo %d bytes.", maxEnrichmentSize))
+		registerMetric("enrichment", r.Method, http.StatusRequestEntityTooLarge, i)
+		return
+	}
+	var p map[string]any
+	if err := json.Unmarshal(b, &p); err != nil || p == nil {
+		app.messageResponse(w, http.StatusBadRequest, "Envie um objeto JSON com os campos do enriquecimento.")
+		registerMetric("enrichment", r.Method, http.StatusBadRequest, i)
+		return
+	}
+	if m := app.enrichment.check(p); m != "" {
+		app.messageResponse(w, http.StatusBadRequest, m)
+		registerMetric("enrichment", r.Method, http.StatusBadRequest, i)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	s, err := app.db.SaveEnrichment(ctx, cnpj.Unmask(n), string(b))
+	if err != nil {
+		slog.Error("could not save the enrichment", "cnpj", n, "error", err)
+		app.messageResponse(w, http.StatusInternalServerError, "Erro salvando o enriquecimento.")
+		registerMetric("enrichment", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.WriteString(w, s); err != nil {
+		slog.Error("error responding to enrichment request", "cnpj", n, "error", err)
+	}
+	registerMetric("enrichment", r.Method, http.StatusOK, i)
+}
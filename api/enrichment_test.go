@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+func TestParseEnrichmentSchema(t *testing.T) {
+	s, err := parseEnrichmentSchema("gerente:string, risco:number,ativo:boolean")
+	if err != nil {
+		t.Fatalf("expected no error parsing the schema, got %s", err)
+	}
+	if len(s) != 3 || s["risco"] != "number" {
+		t.Errorf("expected 3 fields with risco as a number, got %v", s)
+	}
+	for _, v := range []string{"gerente", "Gerente:string", "gerente:date", "gerente:string,gerente:string"} {
+		if _, err := parseEnrichmentSchema(v); err == nil {
+			t.Errorf("expected an error parsing %s", v)
+		}
+	}
+}
+
+func TestEnrichmentHandler(t *testing.T) {
+	s, err := parseEnrichmentSchema("gerente:string,risco:number,clientes:integer")
+	if err != nil {
+		t.Fatalf("expected no error parsing the schema, got %s", err)
+	}
+	admin := &client{key: db.APIKey{Name: "admin", Admin: true}, bucket: &bucket{}}
+	for _, c := range []struct {
+		method  string
+		path    string
+		body    string
+		schema  enrichmentSchema
+		status  int
+		content string
+	}{
+		{http.MethodGet, "/v1/cnpj/19131243000197/enrichment", "", s, http.StatusMethodNotAllowed, `{"message":"Essa URL aceita apenas o método PATCH."}`},
+		{http.MethodPatch, "/v1/cnpj/19131243000197/enrichment", `{"gerente":"Ana"}`, nil, http.StatusNotFound, `{"message":"Enriquecimento não configurado neste servidor."}`},
+		{http.MethodPatch, "/v1/cnpj/19131243000198/enrichment", `{"gerente":"Ana"}`, s, http.StatusBadRequest, `{"message":"CNPJ 19131243000198 inválido."}`},
+		{http.MethodPatch, "/v1/cnpj/33683111000280/enrichment", `{"gerente":"Ana"}`, s, http.StatusNotFound, `{"message":"CNPJ 33.683.111/0002-80 não encontrado."}`},
+		{http.MethodPatch, "/v1/cnpj/19131243000197/enrichment", `["Ana"]`, s, http.StatusBadRequest, `{"message":"Envie um objeto JSON com os campos do enriquecimento."}`},
+		{http.MethodPatch, "/v1/cnpj/19131243000197/enrichment", `{"nome":"Ana"}`, s, http.StatusBadRequest, `{"message":"Campo nome não existe no enriquecimento."}`},
+		{http.MethodPatch, "/v1/cnpj/19131243000197/enrichment", `{"risco":"alto"}`, s, http.StatusBadRequest, `{"message":"Campo risco deve ser do tipo number."}`},
+		{http.MethodPatch, "/v1/cnpj/19131243000197/enrichment", `{"clientes":4.2}`, s, http.StatusBadRequest, `{"message":"Campo clientes deve ser do tipo integer."}`},
+		{http.MethodPatch, "/v1/cnpj/19131243000197/enrichment", `{"gerente":null,"risco":0.7,"clientes":42}`, s, http.StatusOK, `{"gerente":null,"risco":0.7,"clientes":42}`},
+	} {
+		req, err := http.NewRequest(c.method, c.path, strings.NewReader(c.body))
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		req = req.WithContext(context.WithValue(req.Context(), clientContextKey{}, admin))
+		app := api{db: &mockDatabase{}, enrichment: c.schema}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/v1/cnpj/{cnpj}/enrichment", app.adminWrapper("enrichment", app.enrichmentHandler))
+		resp := httptest.NewRecorder()
+		mux.ServeHTTP(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("expected %s %s with %s to return %d, got %d", c.method, c.path, c.body, c.status, resp.Code)
+		}
+		if got := strings.TrimSpace(resp.Body.String()); got != c.content {
+			t.Errorf("expected %s, got %s", c.content, got)
+		}
+	}
+}
+
+func TestEnrichedCompany(t *testing.T) {
+	s, err := parseEnrichmentSchema("gerente:string")
+	if err != nil {
+		t.Fatalf("expected no error parsing the schema, got %s", err)
+	}
+	user := &client{key: db.APIKey{Name: "user"}, bucket: &bucket{}}
+	for _, c := range []struct {
+		client   *client
+		schema   enrichmentSchema
+		enriched bool
+	}{
+		{user, s, true},
+		{nil, s, false},
+		{user, nil, false},
+	} {
+		req, err := http.NewRequest(http.MethodGet, "/19131243000197?perfil=minimal", nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		req.Header.Set("If-None-Match", etag("42"))
+		if c.client != nil {
+			req = req.WithContext(context.WithValue(req.Context(), clientContextKey{}, c.client))
+		}
+		app := api{db: &mockDatabase{}, enrichment: c.schema}
+		resp := httptest.NewRecorder()
+		app.cacheWrapper("company", app.companyHandler)(resp, req)
+		if !c.enriched {
+			if resp.Code != http.StatusNotModified {
+				t.Errorf("expected a request without enrichment to return 304, got %d", resp.Code)
+			}
+			continue
+		}
+		if resp.Code != http.StatusOK {
+			t.Errorf("expected an enriched request to return 200, got %d", resp.Code)
+		}
+		b := resp.Body.String()
+		if !strings.HasSuffix(strings.TrimSpace(b), `,"enriquecimento":{"gerente":"Ana"}}`) {
+			t.Errorf("expected the enrichment to be merged into the response, got %s", b)
+		}
+		if got := resp.Header().Get("Cache-Control"); got != "private, no-cache" {
+			t.Errorf("expected an enriched response to be revalidated, got Cache-Control %s", got)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/cuducos/go-cnpj"
+	"github.com/cuducos/minha-receita/db"
+)
+
+const eventsTimeout = 10 * time.Second
+
+type eventsPage struct {
+	Data []db.Event `json:"data"`
+}
+
+// eventsHandler serves the history of a company from the event log: when it
+// was inserted, updated or deleted by each dataset load. It also works for
+// companies that are not in the current dataset anymore.
+func (app *api) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	i := time.Now().UnixMilli()
+	if r.Method != http.MethodGet {
+		app.messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		registerMetric("events", r.Method, http.StatusMethodNotAllowed, i)
+		return
+	}
+	n := r.PathValue("cnpj")
+	if !cnpj.IsValid(n) {
+		app.messageResponse(w, http.StatusBadRequest, fmt.Sprintf("CNPJ %s inválido.", n))
+		registerMetric("events", r.Method, http.StatusBadRequest, i)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), eventsTimeout)
+	defer cancel()
+	es, err := app.db.Events(ctx, cnpj.Unmask(n))
+	if errors.Is(err, db.ErrEventLogUnavailable) {
+		app.messageResponse(w, http.StatusNotImplemented, "O histórico das empresas só está disponível em servidores com PostgreSQL.")
+		registerMetric("events", r.Method, http.StatusNotImplemented, i)
+		return
+	}
+	if err != nil {
+		slog.Error("could not read the events", "cnpj", n, "error", err)
+		app.messageResponse(w, http.StatusInternalServerError, "Erro lendo o histórico da empresa.")
+		registerMetric("events", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	if len(es) == 0 {
+		app.messageResponse(w, http.StatusNotFound, fmt.Sprintf("Nenhum histórico para o CNPJ %s.", cnpj.Mask(n)))
+		registerMetric("events", r.Method, http.StatusNotFound, i)
+		return
+	}
+	b, err := json.Marshal(eventsPage{es})
+	if err != nil {
+		app.messageResponse(w, http.StatusInternalServerError, "Erro serializando o histórico da empresa.")
+		registerMetric("events", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.Header().Set("Cache-Control", app.cacheControl())
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		slog.Error("error responding to events request", "cnpj", n, "error", err)
+	}
+	registerMetric("events", r.Method, http.StatusOK, i)
+}
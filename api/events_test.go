@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/json/v2"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEventsHandler(t *testing.T) {
+	app := api{db: mockDatabase{}}
+	for _, c := range []struct {
+		method string
+		path   string
+		status int
+		events int
+	}{
+		{http.MethodGet, "/v1/cnpj/19131243000197/events", http.StatusOK, 2},
+		{http.MethodGet, "/v1/cnpj/11222333000181/events", http.StatusNotFound, 0},
+		{http.MethodGet, "/v1/cnpj/33683111000280/events", http.StatusNotImplemented, 0},
+		{http.MethodGet, "/v1/cnpj/12345678901234/events", http.StatusBadRequest, 0},
+		{http.MethodPost, "/v1/cnpj/19131243000197/events", http.StatusMethodNotAllowed, 0},
+	} {
+		req := httptest.NewRequest(c.method, c.path, nil)
+		resp := httptest.NewRecorder()
+		mux := http.NewServeMux()
+		mux.HandleFunc("/v1/cnpj/{cnpj}/events", app.eventsHandler)
+		mux.ServeHTTP(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("expected %s %s to return %d, got %d", c.method, c.path, c.status, resp.Code)
+		}
+		if c.status != http.StatusOK {
+			continue
+		}
+		var p eventsPage
+		if err := json.Unmarshal(resp.Body.Bytes(), &p); err != nil {
+			t.Fatalf("expected a valid json, got %s", err)
+		}
+		if len(p.Data) != c.events {
+			t.Errorf("expected %d events, got %d", c.events, len(p.Data))
+		}
+		if p.Data[0].Operation != "insert" || p.Data[1].DatasetVersion != "2026-09-12" {
+			t.Errorf("expected the events oldest first, got %#v", p.Data)
+		}
+		if string(p.Data[1].Company) != `{"cnpj":"19131243000197","uf":"SP"}` {
+			t.Errorf("expected the company of the event, got %s", p.Data[1].Company)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cuducos/minha-receita/export"
+)
+
+type exportURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// exportsHandler hands out a pre-signed URL to download an exported file from
+// the object storage, so these large files never go through the API.
+func (app *api) exportsHandler(w http.ResponseWriter, r *http.Request) {
+	i := time.Now().UnixMilli()
+	if r.Method != http.MethodGet {
+		app.messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		registerMetric("exports", r.Method, http.StatusMethodNotAllowed, i)
+		return
+	}
+	if app.exports == nil {
+		app.messageResponse(w, http.StatusNotFound, "Esse servidor não disponibiliza arquivos exportados.")
+		registerMetric("exports", r.Method, http.StatusNotFound, i)
+		return
+	}
+	v := r.PathValue("format")
+	f, err := export.ParseFormat(v)
+	if err != nil {
+		fs := make([]string, len(export.Formats))
+		for n, f := range export.Formats {
+			fs[n] = string(f)
+		}
+		app.messageResponse(w, http.StatusNotFound, fmt.Sprintf("Formato %s não encontrado, as opções são: %s.", v, strings.Join(fs, ", ")))
+		registerMetric("exports", r.Method, http.StatusNotFound, i)
+		return
+	}
+	u, e, err := app.exports.PresignedURL(f, time.Now())
+	if err != nil {
+		slog.Error("could not sign export url", "format", f, "error", err)
+		app.messageResponse(w, http.StatusInternalServerError, "Erro gerando a URL do arquivo exportado.")
+		registerMetric("exports", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	b, err := json.Marshal(exportURL{u, e})
+	if err != nil {
+		app.messageResponse(w, http.StatusInternalServerError, "Erro serializando a URL do arquivo exportado.")
+		registerMetric("exports", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		slog.Error("error responding to exports request", "error", err)
+	}
+	registerMetric("exports", r.Method, http.StatusOK, i)
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cuducos/minha-receita/export"
+)
+
+func TestExportsHandler(t *testing.T) {
+	s := export.ObjectStorage{
+		Bucket:    "dados",
+		Region:    "sa-east-1",
+		AccessKey: "key",
+		SecretKey: "secret",
+		TTL:       time.Hour,
+	}
+	for _, c := range []struct {
+		method  string
+		path    string
+		exports *export.ObjectStorage
+		status  int
+		content string
+	}{
+		{http.MethodGet, "/v1/exports/parquet", &s, http.StatusOK, "https://dados.s3.sa-east-1.amazonaws.com/cnpj.parquet?"},
+		{http.MethodGet, "/v1/exports/xml", &s, http.StatusNotFound, `{"message":"Formato xml não encontrado, as opções são: ndjson, csv, parquet, xlsx."}`},
+		{http.MethodGet, "/v1/exports/parquet", nil, http.StatusNotFound, `{"message":"Esse servidor não disponibiliza arquivos exportados."}`},
+		{http.MethodPost, "/v1/exports/parquet", &s, http.StatusMethodNotAllowed, `{"message":"Essa URL aceita apenas o método GET."}`},
+	} {
+		req, err := http.NewRequest(c.method, c.path, nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		app := api{db: &mockDatabase{}, exports: c.exports}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/v1/exports/{format}", app.exportsHandler)
+		resp := httptest.NewRecorder()
+		mux.ServeHTTP(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("expected %s %s to return %d, got %d", c.method, c.path, c.status, resp.Code)
+		}
+		if resp.Code != http.StatusOK {
+			if got := strings.TrimSpace(resp.Body.String()); got != c.content {
+				t.Errorf("expected %s, got %s", c.content, got)
+			}
+			continue
+		}
+		var u exportURL
+		if err := json.Unmarshal(resp.Body.Bytes(), &u); err != nil {
+			t.Fatalf("expected no error parsing the response, got %s", err)
+		}
+		if !strings.HasPrefix(u.URL, c.content) {
+			t.Errorf("expected url to start with %s, got %s", c.content, u.URL)
+		}
+		if d := time.Until(u.ExpiresAt); d <= 0 || d > time.Hour {
+			t.Errorf("expected the url to expire within an hour, got %s", u.ExpiresAt)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/cuducos/go-cnpj"
+)
+
+type formattedField struct {
+	key, value string
+}
+
+// formatBRL formats an amount as Brazilian reais (e.g. R$ 1.234,56).
+func formatBRL(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 2, 64)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	n, d, _ := strings.Cut(s, ".")
+	var b strings.Builder
+	for i, r := range n {
+		if i > 0 && (len(n)-i)%3 == 0 {
+			b.WriteRune('.')
+		}
+		b.WriteRune(r)
+	}
+	return sign + "R$ " + b.String() + "," + d
+}
+
+// formatCEP formats a postal code as 00000-000, keeping it as is if it does
+// not have 8 digits.
+func formatCEP(v string) string {
+	if len(v) != 8 || strings.ContainsFunc(v, func(r rune) bool { return r < '0' || r > '9' }) {
+		return v
+	}
+	return v[:5] + "-" + v[5:]
+}
+
+// formatAddress joins the address of a company in a single line (e.g.
+// AVENIDA PAULISTA, 37, ANDAR 4, BELA VISTA, SAO PAULO - SP, 01311-902).
+func formatAddress(o map[string]string) string {
+	var ps []string
+	add := func(vs ...string) {
+		var ns []string
+		for _, v := range vs {
+			if v = strings.TrimSpace(v); v != "" {
+				ns = append(ns, v)
+			}
+		}
+		if len(ns) > 0 {
+			ps = append(ps, strings.Join(ns, " "))
+		}
+	}
+	add(o["descricao_tipo_de_logradouro"], o["logradouro"])
+	add(o["numero"])
+	add(o["complemento"])
+	add(o["bairro"])
+	switch m, uf := strings.TrimSpace(o["municipio"]), strings.TrimSpace(o["uf"]); {
+	case m != "" && uf != "":
+		add(m + " - " + uf)
+	default:
+		add(m, uf)
+	}
+	add(formatCEP(o["cep"]))
+	return strings.Join(ps, ", ")
+}
+
+// formattedFields returns the presentation fields of a company, given the
+// scalar values of its object, so thin clients do not need to implement the
+// Brazilian formatting rules. Objects without a valid CNPJ (e.g. partners) get
+// none.
+func formattedFields(o map[string]string) []formattedField {
+	n, ok := o["cnpj"]
+	if !ok || !cnpj.IsValid(n) {
+		return nil
+	}
+	fs := []formattedField{{"cnpj_formatado", cnpj.Mask(n)}}
+	if v, ok := o["capital_social"]; ok {
+		if c, err := strconv.ParseFloat(v, 64); err == nil {
+			fs = append(fs, formattedField{"capital_social_formatado", formatBRL(c)})
+		}
+	}
+	if a := formatAddress(o); a != "" {
+		fs = append(fs, formattedField{"endereco_formatado", a})
+	}
+	return fs
+}
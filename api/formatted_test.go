@@ -0,0 +1,79 @@
+package api
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFormatBRL(t *testing.T) {
+	for _, tc := range []struct {
+		value    float64
+		expected string
+	}{
+		{0, "R$ 0,00"},
+		{1.5, "R$ 1,50"},
+		{999, "R$ 999,00"},
+		{1234.56, "R$ 1.234,56"},
+		{1234567, "R$ 1.234.567,00"},
+		{-1000, "-R$ 1.000,00"},
+	} {
+		if got := formatBRL(tc.value); got != tc.expected {
+			t.Errorf("expected %f to be %s, got %s", tc.value, tc.expected, got)
+		}
+	}
+}
+
+func TestFormatAddress(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		value    map[string]string
+		expected string
+	}{
+		{
+			"complete",
+			map[string]string{"descricao_tipo_de_logradouro": "AVENIDA", "logradouro": "PAULISTA", "numero": "37", "complemento": "ANDAR 4", "bairro": "BELA VISTA", "municipio": "SAO PAULO", "uf": "SP", "cep": "01311902"},
+			"AVENIDA PAULISTA, 37, ANDAR 4, BELA VISTA, SAO PAULO - SP, 01311-902",
+		},
+		{
+			"missing parts",
+			map[string]string{"logradouro": "PAULISTA", "numero": "S/N", "complemento": " ", "uf": "SP"},
+			"PAULISTA, S/N, SP",
+		},
+		{"empty", map[string]string{}, ""},
+	} {
+		if got := formatAddress(tc.value); got != tc.expected {
+			t.Errorf("expected %s address to be %s, got %s", tc.desc, tc.expected, got)
+		}
+	}
+}
+
+func TestRewriteJSONFormatted(t *testing.T) {
+	j := `{"cnpj":"19131243000197","capital_social":1234.5,"logradouro":"PAULISTA","uf":"SP","qsa":[{"nome_socio":"X"}]}`
+	for _, tc := range []struct {
+		desc     string
+		camel    bool
+		expected string
+	}{
+		{
+			"snake case",
+			false,
+			`{"cnpj":"19131243000197","capital_social":1234.5,"logradouro":"PAULISTA","uf":"SP","qsa":[{"nome_socio":"X"}],"cnpj_formatado":"19.131.243/0001-97","capital_social_formatado":"R$ 1.234,50","endereco_formatado":"PAULISTA, SP"}`,
+		},
+		{
+			"camel case",
+			true,
+			`{"cnpj":"19131243000197","capitalSocial":1234.5,"logradouro":"PAULISTA","uf":"SP","qsa":[{"nomeSocio":"X"}],"cnpjFormatado":"19.131.243/0001-97","capitalSocialFormatado":"R$ 1.234,50","enderecoFormatado":"PAULISTA, SP"}`,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := rewriteJSON(&b, strings.NewReader(j), tc.camel, false, true); err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if got := strings.TrimSpace(b.String()); got != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
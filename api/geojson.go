@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+const (
+	geoJSONFormat      = "geojson"
+	geoJSONContentType = "application/geo+json"
+
+	postGISUnavailableMessage = "A busca por polígono e o formato geojson requerem o modo PostGIS, que não está habilitado nesse servidor."
+)
+
+type feature struct {
+	Type       string         `json:"type"`
+	ID         string         `json:"id,omitempty"`
+	Geometry   jsontext.Value `json:"geometry"`
+	Properties jsontext.Value `json:"properties"`
+}
+
+type featureCollection struct {
+	Type     string    `json:"type"`
+	Features []feature `json:"features"`
+	Cursor   *string   `json:"cursor"`
+}
+
+// featuresFrom converts the companies of a page of the paginated search into
+// features placed at a point inside their municipalities (or without geometry
+// when the municipality is unknown).
+func featuresFrom(cs []jsontext.Value, ps map[uint32]string) ([]feature, error) {
+	fs := make([]feature, 0, len(cs))
+	for _, c := range cs {
+		var r struct {
+			CNPJ string `json:"cnpj"`
+			Code uint32 `json:"codigo_municipio_ibge"`
+		}
+		if err := json.Unmarshal(c, &r); err != nil {
+			return nil, err
+		}
+		g := jsontext.Value("null")
+		if p, ok := ps[r.Code]; ok {
+			g = jsontext.Value(p)
+		}
+		fs = append(fs, feature{Type: "Feature", ID: r.CNPJ, Geometry: g, Properties: c})
+	}
+	return fs, nil
+}
+
+func municipalityCodes(cs []jsontext.Value) []uint32 {
+	var ns []uint32
+	for _, c := range cs {
+		var r struct {
+			Code uint32 `json:"codigo_municipio_ibge"`
+		}
+		if err := json.Unmarshal(c, &r); err != nil || r.Code == 0 {
+			continue
+		}
+		if !slices.Contains(ns, r.Code) {
+			ns = append(ns, r.Code)
+		}
+	}
+	return ns
+}
+
+// geoJSONPage responds a page of the paginated search as a GeoJSON
+// FeatureCollection, with the cursor of the next page in the cursor member and
+// in the X-Next-Cursor header (absent in the last page). It requires the
+// PostGIS mode to place the companies in their municipalities.
+func (app *api) geoJSONPage(ctx context.Context, w http.ResponseWriter, r *http.Request, s string, i int64) {
+	var p searchPage
+	if err := json.Unmarshal([]byte(s), &p); err != nil {
+		slog.Error("could not parse the search page", "error", err)
+		app.messageResponse(w, http.StatusInternalServerError, "Erro gerando o GeoJSON.")
+		registerMetric("paginatedSearch", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	ps, err := app.db.MunicipalityPoints(ctx, municipalityCodes(p.Data))
+	if errors.Is(err, db.ErrPostGISUnavailable) {
+		app.messageResponse(w, http.StatusBadRequest, postGISUnavailableMessage)
+		registerMetric("paginatedSearch", r.Method, http.StatusBadRequest, i)
+		return
+	}
+	if err != nil {
+		slog.Error("could not read the municipalities", "error", err)
+		app.messageResponse(w, http.StatusInternalServerError, "Erro gerando o GeoJSON.")
+		registerMetric("paginatedSearch", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	fs, err := featuresFrom(p.Data, ps)
+	if err != nil {
+		slog.Error("could not parse the companies of the search page", "error", err)
+		app.messageResponse(w, http.StatusInternalServerError, "Erro gerando o GeoJSON.")
+		registerMetric("paginatedSearch", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	b, err := json.Marshal(featureCollection{Type: "FeatureCollection", Features: fs, Cursor: p.Cursor})
+	if err != nil {
+		slog.Error("could not write the geojson", "error", err)
+		app.messageResponse(w, http.StatusInternalServerError, "Erro gerando o GeoJSON.")
+		registerMetric("paginatedSearch", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	w.Header().Set("Content-type", geoJSONContentType)
+	if p.Cursor != nil {
+		w.Header().Set("X-Next-Cursor", *p.Cursor)
+	}
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		slog.Error("error responding to geojson request", "error", err)
+	}
+	registerMetric("paginatedSearch", r.Method, http.StatusOK, i)
+}
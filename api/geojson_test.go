@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+type noPostGISDatabase struct{ searchDatabase }
+
+func (noPostGISDatabase) MunicipalityPoints(_ context.Context, _ []uint32) (map[uint32]string, error) {
+	return nil, db.ErrPostGISUnavailable
+}
+
+func TestGeoJSONSearch(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Fatalf("could not read company json: %s", err)
+	}
+	t.Run("postgis mode", func(t *testing.T) {
+		app := api{db: searchDatabase{company: string(b)}}
+		req, err := http.NewRequest(http.MethodGet, "/?uf=sp&format=geojson", nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		resp := httptest.NewRecorder()
+		app.companyHandler(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Errorf("expected status 200, got %d", resp.Code)
+		}
+		if got := resp.Header().Get("Content-type"); got != geoJSONContentType {
+			t.Errorf("expected content-type %s, got %s", geoJSONContentType, got)
+		}
+		if got := resp.Header().Get("X-Next-Cursor"); got != "42" {
+			t.Errorf("expected the next cursor to be 42, got %s", got)
+		}
+		var fc struct {
+			Type     string `json:"type"`
+			Features []struct {
+				ID       string `json:"id"`
+				Geometry struct {
+					Type string `json:"type"`
+				} `json:"geometry"`
+				Properties struct {
+					CNPJ string `json:"cnpj"`
+				} `json:"properties"`
+			} `json:"features"`
+			Cursor string `json:"cursor"`
+		}
+		if err := json.Unmarshal(resp.Body.Bytes(), &fc); err != nil {
+			t.Fatalf("expected a valid geojson, got %s", err)
+		}
+		if fc.Type != "FeatureCollection" || len(fc.Features) != 2 || fc.Cursor != "42" {
+			t.Errorf("expected a feature collection with 2 features and cursor 42, got %#v", fc)
+		}
+		for _, f := range fc.Features {
+			if f.ID != "19131243000197" || f.Properties.CNPJ != f.ID || f.Geometry.Type != "Point" {
+				t.Errorf("expected a point feature for 19131243000197, got %#v", f)
+			}
+		}
+	})
+	t.Run("without postgis", func(t *testing.T) {
+		app := api{db: noPostGISDatabase{searchDatabase{company: string(b)}}}
+		req, err := http.NewRequest(http.MethodGet, "/?uf=sp&format=geojson", nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		resp := httptest.NewRecorder()
+		app.companyHandler(resp, req)
+		if resp.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", resp.Code)
+		}
+	})
+}
+
+func TestFeaturesFrom(t *testing.T) {
+	ps := map[uint32]string{3550308: `{"type":"Point","coordinates":[-46.6,-23.5]}`}
+	fs, err := featuresFrom([]jsontext.Value{
+		jsontext.Value(`{"cnpj":"19131243000197","codigo_municipio_ibge":3550308}`),
+		jsontext.Value(`{"cnpj":"33683111000280","codigo_municipio_ibge":null}`),
+	}, ps)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if string(fs[0].Geometry) != ps[3550308] {
+		t.Errorf("expected the point of 3550308, got %s", fs[0].Geometry)
+	}
+	if string(fs[1].Geometry) != "null" {
+		t.Errorf("expected no geometry without a municipality, got %s", fs[1].Geometry)
+	}
+}
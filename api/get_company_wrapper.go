@@ -8,6 +8,7 @@ import (
 
 	"github.com/avast/retry-go/v4"
 	"github.com/cuducos/go-cnpj"
+	"github.com/cuducos/minha-receita/db"
 )
 
 const (
@@ -17,9 +18,30 @@ const (
 
 var errTimeout = errors.New("getCompany timed out")
 
-// this wrapper avoids having the getCompany idle for too long, wrapping it in
-// timeout and restarting it after that
-func getCompany(db database, n string) (string, error) {
+// getCompany coalesces concurrent lookups of the same CNPJ and profile (e.g.
+// many clients asking for the same company after the cache is invalidated) in
+// a single database query, sharing its result.
+func (app *api) getCompany(n string, p db.Profile) (string, error) {
+	var queried bool
+	k := cnpj.Unmask(n) + "/" + string(p)
+	c, err, _ := app.lookups.Do(k, func() (any, error) {
+		queried = true
+		return retrieveCompany(app.db, n, p)
+	})
+	if queried {
+		companyLookups.WithLabelValues("database").Inc()
+	} else {
+		companyLookups.WithLabelValues("coalesced").Inc()
+	}
+	if err != nil {
+		return "", err
+	}
+	return c.(string), nil
+}
+
+// this wrapper avoids having the retrieveCompany idle for too long, wrapping
+// it in timeout and restarting it after that
+func retrieveCompany(d database, n string, p db.Profile) (string, error) {
 	var c string
 	err := retry.Do(
 		func() error {
@@ -28,7 +50,7 @@ func getCompany(db database, n string) (string, error) {
 			ch := make(chan error, 1)
 			go func() {
 				var err error
-				c, err = db.GetCompany(cnpj.Unmask(n))
+				c, err = d.GetCompany(cnpj.Unmask(n), p)
 				ch <- err
 			}()
 			select {
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/synctest"
+
+	"github.com/cuducos/minha-receita/db"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// slowDatabase holds the company lookups until release is closed, counting
+// how many reach the database.
+type slowDatabase struct {
+	mockDatabase
+	queries atomic.Int32
+	release chan struct{}
+}
+
+func (d *slowDatabase) GetCompany(n string, p db.Profile) (string, error) {
+	d.queries.Add(1)
+	<-d.release
+	return d.mockDatabase.GetCompany(n, p)
+}
+
+func TestGetCompanyCoalescesLookups(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		d := slowDatabase{release: make(chan struct{})}
+		app := api{db: &d}
+		q := testutil.ToFloat64(companyLookups.WithLabelValues("database"))
+		c := testutil.ToFloat64(companyLookups.WithLabelValues("coalesced"))
+		var wg sync.WaitGroup
+		got := make([]string, 8)
+		for i := range got {
+			n := "19131243000197"
+			if i%2 == 0 {
+				n = "19.131.243/0001-97" // same company, masked
+			}
+			wg.Go(func() {
+				s, err := app.getCompany(n, db.ProfileFull)
+				if err != nil {
+					t.Errorf("expected no error, got %s", err)
+				}
+				got[i] = s
+			})
+		}
+		synctest.Wait() // one lookup is blocked in the database, the others waiting for it
+		if n := d.queries.Load(); n != 1 {
+			t.Fatalf("expected a single lookup to reach the database, got %d", n)
+		}
+		close(d.release)
+		wg.Wait()
+		if n := d.queries.Load(); n != 1 {
+			t.Errorf("expected a single database query, got %d", n)
+		}
+		for i, s := range got {
+			if s == "" || s != got[0] {
+				t.Errorf("expected lookup %d to share the result", i)
+			}
+		}
+		if n := testutil.ToFloat64(companyLookups.WithLabelValues("database")) - q; n != 1 {
+			t.Errorf("expected 1 database lookup in the metrics, got %f", n)
+		}
+		if n := testutil.ToFloat64(companyLookups.WithLabelValues("coalesced")) - c; n != 7 {
+			t.Errorf("expected 7 coalesced lookups in the metrics, got %f", n)
+		}
+
+		if _, err := app.getCompany("19131243000197", db.ProfileMinimal); err != nil {
+			t.Errorf("expected no error, got %s", err)
+		}
+		if n := d.queries.Load(); n != 2 {
+			t.Errorf("expected lookups after the first one to query the database again, got %d queries", n)
+		}
+	})
+}
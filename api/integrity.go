@@ -0,0 +1,43 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+const (
+	integrityInterval = 24 * time.Hour
+	integrityTimeout  = time.Minute
+)
+
+// sampleIntegrity checks n random companies right away and then once a day,
+// exporting the failures as metrics to catch silent data corruption.
+func (app *api) sampleIntegrity(n int) {
+	run := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), integrityTimeout)
+		defer cancel()
+		cs, err := app.db.Sample(ctx, n)
+		if err != nil {
+			slog.Error("could not sample companies for the integrity check", "error", err)
+			return
+		}
+		var f int
+		for _, c := range cs {
+			if k := db.CheckIntegrity(c); k != "" {
+				f++
+				integrityFailures.WithLabelValues(k).Inc()
+				slog.Warn("company failed the integrity check", "check", k, "json", c)
+			}
+		}
+		integritySampled.Add(float64(len(cs)))
+		integrityLastRun.SetToCurrentTime()
+		slog.Info("Integrity check finished", "sampled", len(cs), "failures", f)
+	}
+	run()
+	for range time.Tick(integrityInterval) {
+		run()
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+type logLevelResponse struct {
+	Level string `json:"level"`
+}
+
+// logLevel keeps the level of the logs, which can be changed while the server
+// is running, so debugging an incident does not require a restart that
+// destroys the evidence.
+type logLevel struct {
+	initial slog.Level
+	current slog.LevelVar
+	file    string
+}
+
+// newLogLevelFromEnv reads the level from LOG_LEVEL (debug, info, warn or
+// error), defaulting to debug if DEBUG is set or to info otherwise. If
+// LOG_LEVEL_FILE is set, the level in that file takes precedence and is read
+// again on every reload.
+func newLogLevelFromEnv() (*logLevel, error) {
+	l := logLevel{file: os.Getenv("LOG_LEVEL_FILE")}
+	if os.Getenv("DEBUG") != "" {
+		l.initial = slog.LevelDebug
+	}
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if err := l.initial.UnmarshalText([]byte(v)); err != nil {
+			return nil, fmt.Errorf("invalid LOG_LEVEL %s, the options are: debug, info, warn or error", v)
+		}
+	}
+	if err := l.reload(); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (l *logLevel) set(v slog.Level) {
+	l.current.Set(v)
+	slog.SetLogLoggerLevel(v)
+}
+
+// reload sets the level from LOG_LEVEL_FILE or, without it, back to the one
+// the server started with.
+func (l *logLevel) reload() error {
+	if l.file == "" {
+		l.set(l.initial)
+		return nil
+	}
+	b, err := os.ReadFile(l.file)
+	if err != nil {
+		return fmt.Errorf("could not read the log level from %s: %w", l.file, err)
+	}
+	var v slog.Level
+	if err := v.UnmarshalText([]byte(strings.TrimSpace(string(b)))); err != nil {
+		return fmt.Errorf("invalid log level in %s: %w", l.file, err)
+	}
+	l.set(v)
+	return nil
+}
+
+// logLevelHandler shows (GET) or changes (PUT with the level URL parameter)
+// the level of the logs.
+func (app *api) logLevelHandler(w http.ResponseWriter, r *http.Request) {
+	i := time.Now().UnixMilli()
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		app.messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas os métodos GET e PUT.")
+		registerMetric("log_level", r.Method, http.StatusMethodNotAllowed, i)
+		return
+	}
+	if r.Method == http.MethodPut {
+		var v slog.Level
+		if err := v.UnmarshalText([]byte(r.URL.Query().Get("level"))); err != nil {
+			app.messageResponse(w, http.StatusBadRequest, "Nível de log inválido, as opções são: debug, info, warn, error.")
+			registerMetric("log_level", r.Method, http.StatusBadRequest, i)
+			return
+		}
+		app.logLevel.set(v)
+		slog.Warn("Log level changed", "level", v)
+	}
+	b, err := json.Marshal(logLevelResponse{strings.ToLower(app.logLevel.current.Level().String())})
+	if err != nil {
+		app.messageResponse(w, http.StatusInternalServerError, "Erro serializando o nível de log.")
+		registerMetric("log_level", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		slog.Error("error responding to log level request", "error", err)
+	}
+	registerMetric("log_level", r.Method, http.StatusOK, i)
+}
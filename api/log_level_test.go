@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+func TestLogLevelReload(t *testing.T) {
+	t.Cleanup(func() { slog.SetLogLoggerLevel(slog.LevelInfo) })
+	p := filepath.Join(t.TempDir(), "level")
+	if err := os.WriteFile(p, []byte("warn\n"), 0644); err != nil {
+		t.Fatalf("could not write the log level file: %s", err)
+	}
+	t.Setenv("LOG_LEVEL", "debug")
+	t.Setenv("LOG_LEVEL_FILE", p)
+	l, err := newLogLevelFromEnv()
+	if err != nil {
+		t.Fatalf("expected no error reading the log level, got %s", err)
+	}
+	if got := l.current.Level(); got != slog.LevelWarn {
+		t.Errorf("expected the level from the file, got %s", got)
+	}
+	if !slog.Default().Enabled(context.Background(), slog.LevelWarn) || slog.Default().Enabled(context.Background(), slog.LevelInfo) {
+		t.Error("expected the default logger to use the warn level")
+	}
+	if err := os.WriteFile(p, []byte("loud"), 0644); err != nil {
+		t.Fatalf("could not write the log level file: %s", err)
+	}
+	if err := l.reload(); err == nil {
+		t.Error("expected an error reloading an invalid log level")
+	}
+	l.file = ""
+	if err := l.reload(); err != nil {
+		t.Errorf("expected no error reloading the log level, got %s", err)
+	}
+	if got := l.current.Level(); got != slog.LevelDebug {
+		t.Errorf("expected the level from LOG_LEVEL without a file, got %s", got)
+	}
+	t.Setenv("LOG_LEVEL", "loud")
+	if _, err := newLogLevelFromEnv(); err == nil {
+		t.Error("expected an error with an invalid LOG_LEVEL")
+	}
+}
+
+func TestLogLevelHandler(t *testing.T) {
+	t.Cleanup(func() { slog.SetLogLoggerLevel(slog.LevelInfo) })
+	admin := &client{key: db.APIKey{Name: "admin", Admin: true}, bucket: &bucket{}}
+	app := api{db: &mockDatabase{}, logLevel: &logLevel{}}
+	for _, c := range []struct {
+		method  string
+		path    string
+		status  int
+		content string
+	}{
+		{http.MethodGet, "/v1/admin/log-level", http.StatusOK, `{"level":"info"}`},
+		{http.MethodPut, "/v1/admin/log-level?level=DEBUG", http.StatusOK, `{"level":"debug"}`},
+		{http.MethodGet, "/v1/admin/log-level", http.StatusOK, `{"level":"debug"}`},
+		{http.MethodPut, "/v1/admin/log-level?level=loud", http.StatusBadRequest, `{"message":"Nível de log inválido, as opções são: debug, info, warn, error."}`},
+		{http.MethodPost, "/v1/admin/log-level", http.StatusMethodNotAllowed, `{"message":"Essa URL aceita apenas os métodos GET e PUT."}`},
+	} {
+		req, err := http.NewRequest(c.method, c.path, nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		req = req.WithContext(context.WithValue(req.Context(), clientContextKey{}, admin))
+		resp := httptest.NewRecorder()
+		app.adminWrapper("log_level", app.logLevelHandler)(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("expected %s %s to return %d, got %d", c.method, c.path, c.status, resp.Code)
+		}
+		if got := strings.TrimSpace(resp.Body.String()); got != c.content {
+			t.Errorf("expected %s, got %s", c.content, got)
+		}
+	}
+}
@@ -1,13 +1,18 @@
 package api
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
+const statsTimeout = 5 * time.Second
+
 var (
 	metricLabels = []string{"method", "status_code", "endpoint"}
 	requestCount = promauto.NewCounterVec(prometheus.CounterOpts{
@@ -18,10 +23,140 @@ var (
 		Name: "request_duration",
 		Help: "The duration of requests in milliseconds",
 	}, metricLabels)
+	inFlightRequests = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "in_flight_requests",
+		Help: "The number of requests being handled at the moment",
+	}, []string{"endpoint"})
+	responseSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "response_size_bytes",
+		Help:    "The size of successful response bodies in bytes, before compression",
+		Buckets: prometheus.ExponentialBuckets(256, 4, 9), // 256B to 16MB
+	}, []string{"endpoint"})
+	integritySampled = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "integrity_sampled_companies",
+		Help: "The total number of random companies checked for data corruption",
+	})
+	integrityFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integrity_failures",
+		Help: "The total number of sampled companies that failed an integrity check",
+	}, []string{"check"})
+	integrityLastRun = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "integrity_last_run_timestamp_seconds",
+		Help: "When the last integrity check finished",
+	})
+	companyLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "company_lookups_total",
+		Help: "The total number of company lookups, by source (database or coalesced with a concurrent lookup of the same company)",
+	}, []string{"source"})
 )
 
 func registerMetric(e, m string, s int, i int64) {
 	c := fmt.Sprintf("%d", s)
+	n := time.Now()
+	d := n.UnixMilli() - i
 	requestCount.WithLabelValues(m, c, e).Inc()
-	requestDuration.WithLabelValues(m, c, e).Observe(float64(time.Now().UnixMilli() - i))
+	requestDuration.WithLabelValues(m, c, e).Observe(float64(d))
+	slos.observe(e, m, s, time.Duration(d)*time.Millisecond, n)
+}
+
+type sizeResponseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *sizeResponseWriter) WriteHeader(s int) {
+	w.status = s
+	w.ResponseWriter.WriteHeader(s)
+}
+
+func (w *sizeResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+	return n, err
+}
+
+func (w *sizeResponseWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// sizeWrapper records the size of successful responses. It is meant to be
+// wrapped by the compression middleware (gzipWrapper), so it measures the JSON
+// before compression.
+func sizeWrapper(e string, h func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	o := responseSize.WithLabelValues(e)
+	return func(w http.ResponseWriter, r *http.Request) {
+		sw := sizeResponseWriter{ResponseWriter: w}
+		h(&sw, r)
+		if sw.status == http.StatusOK {
+			o.Observe(float64(sw.size))
+		}
+	}
+}
+
+// databaseCollector queries the database server on every scrape, so metrics
+// reflect the database itself even when it runs in another host or container.
+type databaseCollector struct {
+	db                database
+	activeConnections *prometheus.Desc
+	cacheHitRatio     *prometheus.Desc
+	tableSize         *prometheus.Desc
+	indexSize         *prometheus.Desc
+}
+
+func newDatabaseCollector(d database) *databaseCollector {
+	return &databaseCollector{
+		db: d,
+		activeConnections: prometheus.NewDesc(
+			"database_active_connections",
+			"The number of connections running a query in the database",
+			nil,
+			nil,
+		),
+		cacheHitRatio: prometheus.NewDesc(
+			"database_cache_hit_ratio",
+			"The share of reads served from the database cache",
+			nil,
+			nil,
+		),
+		tableSize: prometheus.NewDesc(
+			"database_table_size_bytes",
+			"The size of the companies table in bytes",
+			nil,
+			nil,
+		),
+		indexSize: prometheus.NewDesc(
+			"database_index_size_bytes",
+			"The size of the indexes of the companies table in bytes",
+			nil,
+			nil,
+		),
+	}
+}
+
+func (c *databaseCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.activeConnections
+	ch <- c.cacheHitRatio
+	ch <- c.tableSize
+	ch <- c.indexSize
+}
+
+func (c *databaseCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+	defer cancel()
+	s, err := c.db.Stats(ctx)
+	if err != nil {
+		slog.Error("could not collect database metrics", "error", err)
+		return
+	}
+	gauge := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v)
+	}
+	gauge(c.activeConnections, float64(s.ActiveConnections))
+	if s.CacheHitRate != nil {
+		gauge(c.cacheHitRatio, *s.CacheHitRate)
+	}
+	gauge(c.tableSize, float64(s.TableSize))
+	gauge(c.indexSize, float64(s.IndexSize))
 }
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDatabaseCollector(t *testing.T) {
+	expected := `
+# HELP database_active_connections The number of connections running a query in the database
+# TYPE database_active_connections gauge
+database_active_connections 3
+# HELP database_cache_hit_ratio The share of reads served from the database cache
+# TYPE database_cache_hit_ratio gauge
+database_cache_hit_ratio 0.9
+# HELP database_index_size_bytes The size of the indexes of the companies table in bytes
+# TYPE database_index_size_bytes gauge
+database_index_size_bytes 1024
+# HELP database_table_size_bytes The size of the companies table in bytes
+# TYPE database_table_size_bytes gauge
+database_table_size_bytes 4096
+`
+	c := newDatabaseCollector(&mockDatabase{})
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Errorf("expected database metrics to match, got %s", err)
+	}
+}
+
+func TestSizeWrapper(t *testing.T) {
+	responseSize.Reset()
+	h := sizeWrapper("test", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		if _, err := io.WriteString(w, "hello"); err != nil {
+			t.Errorf("expected no error writing response, got %s", err)
+		}
+	})
+	for _, p := range []string{"/found", "/missing"} {
+		h(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, p, nil))
+	}
+	expected := `
+# HELP response_size_bytes The size of successful response bodies in bytes, before compression
+# TYPE response_size_bytes histogram
+response_size_bytes_bucket{endpoint="test",le="256"} 1
+response_size_bytes_bucket{endpoint="test",le="1024"} 1
+response_size_bytes_bucket{endpoint="test",le="4096"} 1
+response_size_bytes_bucket{endpoint="test",le="16384"} 1
+response_size_bytes_bucket{endpoint="test",le="65536"} 1
+response_size_bytes_bucket{endpoint="test",le="262144"} 1
+response_size_bytes_bucket{endpoint="test",le="1048576"} 1
+response_size_bytes_bucket{endpoint="test",le="4194304"} 1
+response_size_bytes_bucket{endpoint="test",le="16777216"} 1
+response_size_bytes_bucket{endpoint="test",le="+Inf"} 1
+response_size_bytes_sum{endpoint="test"} 5
+response_size_bytes_count{endpoint="test"} 1
+`
+	if err := testutil.CollectAndCompare(responseSize, strings.NewReader(expected)); err != nil {
+		t.Errorf("expected response size metrics to match, got %s", err)
+	}
+}
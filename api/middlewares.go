@@ -0,0 +1,133 @@
+package api
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Middlewares of the chain configured with the API_MIDDLEWARES environment
+// variable.
+const (
+	authMiddleware        = "auth"
+	rateLimitMiddleware   = "rate-limit"
+	cacheMiddleware       = "cache"
+	compressionMiddleware = "compression"
+	loggingMiddleware     = "logging"
+
+	noMiddlewares = "none"
+)
+
+var (
+	middlewares        = []string{authMiddleware, rateLimitMiddleware, cacheMiddleware, compressionMiddleware, loggingMiddleware}
+	defaultMiddlewares = middlewareChain{authMiddleware, rateLimitMiddleware, cacheMiddleware, compressionMiddleware}
+)
+
+// middlewareChain lists the middlewares wrapping the endpoints, from the
+// outermost (the first one to handle the request) to the innermost.
+type middlewareChain []string
+
+// newMiddlewareChain parses a comma-separated list of middlewares (none turns
+// all of them off). The rate limit is per API key, so it has to come after the
+// auth.
+func newMiddlewareChain(s string) (middlewareChain, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return defaultMiddlewares, nil
+	}
+	if s == noMiddlewares {
+		return middlewareChain{}, nil
+	}
+	var c middlewareChain
+	for v := range strings.SplitSeq(s, ",") {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if !slices.Contains(middlewares, v) {
+			return nil, fmt.Errorf("unknown middleware %s, the options are: %s (or %s)", v, strings.Join(middlewares, ", "), noMiddlewares)
+		}
+		if slices.Contains(c, v) {
+			return nil, fmt.Errorf("middleware %s is repeated in %s", v, s)
+		}
+		c = append(c, v)
+	}
+	if i := slices.Index(c, rateLimitMiddleware); i >= 0 && !slices.Contains(c[:i], authMiddleware) {
+		return nil, fmt.Errorf("middleware %s requires %s before it", rateLimitMiddleware, authMiddleware)
+	}
+	return c, nil
+}
+
+func newMiddlewareChainFromEnv() (middlewareChain, error) {
+	c, err := newMiddlewareChain(os.Getenv("API_MIDDLEWARES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid API_MIDDLEWARES: %w", err)
+	}
+	return c, nil
+}
+
+// camelCaseEndpoints are the endpoints responding with the JSON of companies
+// (or parts of it), so caseWrapper can convert their keys.
+var camelCaseEndpoints = []string{"company", "qsa", "cnaes", "crosswalk"}
+
+// routeKind tells which middlewares of the chain apply to an endpoint: public
+// ones are never authenticated (e.g. health checks) and only the ones whose
+// responses change with the dataset are cached and compressed (and measured,
+// counted as in flight and mirrored to the shadow backend).
+type routeKind int
+
+const (
+	publicRoute routeKind = iota
+	privateRoute
+	cacheableRoute
+)
+
+// chain wraps the handler of the endpoint e with the middlewares of the chain
+// that apply to its kind of route. Cacheable routes are always wrapped by the
+// ones that cannot be turned off, innermost so sizeWrapper measures the JSON
+// before compression.
+func (app *api) chain(e string, k routeKind, h func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	if k == cacheableRoute {
+		h = sizeWrapper(e, h)
+		if slices.Contains(camelCaseEndpoints, e) {
+			h = app.caseWrapper(e, h)
+		}
+		h = app.shadowWrapper(e, app.inFlightWrapper(e, h))
+	}
+	for _, m := range slices.Backward(app.middlewares) {
+		switch {
+		case m == loggingMiddleware:
+			h = logWrapper(e, h)
+		case m == authMiddleware && k != publicRoute:
+			h = app.keyWrapper(h)
+		case m == rateLimitMiddleware && k != publicRoute:
+			h = app.rateLimitWrapper(h)
+		case m == cacheMiddleware && k == cacheableRoute:
+			h = app.notModifiedWrapper(e, h)
+		case m == compressionMiddleware && k == cacheableRoute:
+			h = gzipWrapper(e, h)
+		}
+	}
+	return h
+}
+
+// logWrapper logs every request with its status, the size of the response
+// and how long it took.
+func logWrapper(e string, h func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s := time.Now()
+		sw := sizeResponseWriter{ResponseWriter: w}
+		h(&sw, r)
+		slog.Info(
+			"Request",
+			"endpoint", e,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", cmp.Or(sw.status, http.StatusOK),
+			"size", sw.size,
+			"duration", time.Since(s),
+		)
+	}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+func TestNewMiddlewareChain(t *testing.T) {
+	for _, c := range []struct {
+		value    string
+		expected middlewareChain
+		err      bool
+	}{
+		{"", defaultMiddlewares, false},
+		{"none", middlewareChain{}, false},
+		{"logging, auth,rate-limit", middlewareChain{loggingMiddleware, authMiddleware, rateLimitMiddleware}, false},
+		{"Cache,Compression", middlewareChain{cacheMiddleware, compressionMiddleware}, false},
+		{"auth,forty-two", nil, true},
+		{"cache,cache", nil, true},
+		{"rate-limit", nil, true},
+		{"rate-limit,auth", nil, true},
+	} {
+		t.Run(c.value, func(t *testing.T) {
+			got, err := newMiddlewareChain(c.value)
+			if c.err {
+				if err == nil {
+					t.Errorf("expected an error for %s, got %v", c.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error for %s, got %s", c.value, err)
+			}
+			if !slices.Equal(got, c.expected) {
+				t.Errorf("expected %v, got %v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	a, _, err := db.NewAPIKey("test", 1, 1)
+	if err != nil {
+		t.Fatalf("expected no error creating api key, got %s", err)
+	}
+	var ks apiKeys
+	ks.set([]db.APIKey{a})
+	u := newUpdates()
+	u.publish("2022-10-16")
+	for _, c := range []struct {
+		desc        string
+		middlewares string
+		kind        routeKind
+		status      int
+		etag        string
+	}{
+		{"default chain on a cacheable route", "", cacheableRoute, http.StatusUnauthorized, ""},
+		{"default chain on a public route", "", publicRoute, http.StatusOK, ""},
+		{"no auth on a cacheable route", "cache,compression", cacheableRoute, http.StatusOK, `W/"2022-10-16"`},
+		{"no auth on a private route", "cache,compression", privateRoute, http.StatusOK, ""},
+		{"no middlewares", "none", cacheableRoute, http.StatusOK, ""},
+		{"only logging", "logging", cacheableRoute, http.StatusOK, ""},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			ms, err := newMiddlewareChain(c.middlewares)
+			if err != nil {
+				t.Fatalf("expected no error parsing %s, got %s", c.middlewares, err)
+			}
+			req, err := http.NewRequest(http.MethodGet, "/19131243000197", nil)
+			if err != nil {
+				t.Fatal("Expected an HTTP request, but got an error.")
+			}
+			app := api{db: &mockDatabase{}, keys: &ks, updates: u, middlewares: ms}
+			resp := httptest.NewRecorder()
+			handler := http.HandlerFunc(app.chain("company", c.kind, app.companyHandler))
+			handler.ServeHTTP(resp, req)
+			if resp.Code != c.status {
+				t.Errorf("expected status %d, got %d", c.status, resp.Code)
+			}
+			if got := resp.Header().Get("ETag"); got != c.etag {
+				t.Errorf("expected etag %q, got %q", c.etag, got)
+			}
+		})
+	}
+}
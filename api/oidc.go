@@ -0,0 +1,529 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cuducos/minha-receita/db"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultJWKSTTL      = time.Hour
+	minJWKSRefresh      = time.Minute // the keys are not fetched more often than this
+	maxOIDCClients      = 10_000
+	defaultClaimsPrefix = "minha_receita_"
+	jwtLeeway           = time.Minute
+	oidcTimeout         = 10 * time.Second
+)
+
+// authenticator identifies the client of a request from its bearer token.
+type authenticator interface {
+	enabled() bool
+	authenticate(string) (*client, bool)
+}
+
+func (a *apiKeys) authenticate(k string) (*client, bool) { return a.get(k) }
+
+func (app *api) authenticators() []authenticator {
+	return []authenticator{app.keys, app.oidc}
+}
+
+// authEnabled tells whether requests need to be authenticated, i.e. if there
+// are API keys in the database or an OIDC issuer is configured.
+func (app *api) authEnabled() bool {
+	for _, a := range app.authenticators() {
+		if a.enabled() {
+			return true
+		}
+	}
+	return false
+}
+
+func (app *api) authenticate(t string) (*client, bool) {
+	if t == "" {
+		return nil, false
+	}
+	for _, a := range app.authenticators() {
+		if !a.enabled() {
+			continue
+		}
+		if c, ok := a.authenticate(t); ok {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// signingKey is a public key of the issuer and the algorithm it declares (if
+// any), so tokens cannot pick another algorithm for the same key.
+type signingKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// jwks caches the public keys of the issuer, indexed by their key id.
+type jwks struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+	group  singleflight.Group
+
+	mu        sync.Mutex
+	keys      map[string]signingKey
+	fetched   time.Time // last successful fetch
+	attempted time.Time // last fetch, successful or not
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("invalid exponent %s", k.E)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var c elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			c = elliptic.P256()
+		case "P-384":
+			c = elliptic.P384()
+		case "P-521":
+			c = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		s := (c.Params().BitSize + 7) / 8
+		if len(x) > s || len(y) > s {
+			return nil, errors.New("invalid coordinates")
+		}
+		b := make([]byte, 1+2*s)
+		b[0] = 4 // uncompressed point
+		copy(b[1+s-len(x):1+s], x)
+		copy(b[1+2*s-len(y):], y)
+		return ecdsa.ParseUncompressedPublicKey(c, b)
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+func (j *jwks) fetch() (map[string]signingKey, error) {
+	resp, err := j.client.Get(j.url)
+	if err != nil {
+		return nil, fmt.Errorf("could not get the jwks %s: %w", j.url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not get the jwks %s: status %d", j.url, resp.StatusCode)
+	}
+	var s struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.UnmarshalRead(resp.Body, &s); err != nil {
+		return nil, fmt.Errorf("could not parse the jwks %s: %w", j.url, err)
+	}
+	ks := make(map[string]signingKey, len(s.Keys))
+	for _, k := range s.Keys {
+		if k.Use != "" && k.Use != "sig" { // e.g. enc
+			continue
+		}
+		p, err := k.publicKey()
+		if err != nil {
+			slog.Warn("Ignoring key of the jwks", "kid", k.Kid, "error", err)
+			continue
+		}
+		ks[k.Kid] = signingKey{k.Alg, p}
+	}
+	if len(ks) == 0 {
+		return nil, fmt.Errorf("no signing keys in the jwks %s", j.url)
+	}
+	return ks, nil
+}
+
+// refresh fetches the keys without holding the lock, so requests with known
+// keys are not blocked by a slow issuer, and concurrent refreshes share the
+// same request. Failed attempts are recorded too, so they are retried at most
+// once every minJWKSRefresh.
+func (j *jwks) refresh() error {
+	_, err, _ := j.group.Do("jwks", func() (any, error) {
+		ks, err := j.fetch()
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		j.attempted = time.Now()
+		if err != nil {
+			return nil, err
+		}
+		j.keys = ks
+		j.fetched = j.attempted
+		return nil, nil
+	})
+	return err
+}
+
+// get returns the key with the id kid, fetching the keys again when they
+// expire or when the key is unknown (e.g. the issuer rotated its keys).
+func (j *jwks) get(kid string) (signingKey, error) {
+	j.mu.Lock()
+	k, ok := j.keys[kid]
+	expired := time.Since(j.fetched) >= j.ttl
+	recent := time.Since(j.attempted) < minJWKSRefresh
+	j.mu.Unlock()
+	if (ok && !expired) || recent {
+		if !ok {
+			return signingKey{}, fmt.Errorf("unknown key id %s", kid)
+		}
+		return k, nil
+	}
+	if err := j.refresh(); err != nil {
+		if ok { // keeps using the cached key if the issuer is unavailable
+			slog.Warn("could not refresh the jwks, using the cached keys", "error", err)
+			return k, nil
+		}
+		return signingKey{}, err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	k, ok = j.keys[kid]
+	if !ok {
+		return signingKey{}, fmt.Errorf("unknown key id %s", kid)
+	}
+	return k, nil
+}
+
+// curves of the ecdsa algorithms, so a key cannot be used with the hash of
+// another curve
+var curves = map[string]elliptic.Curve{
+	"ES256": elliptic.P256(),
+	"ES384": elliptic.P384(),
+	"ES512": elliptic.P521(),
+}
+
+func verifySignature(alg string, k crypto.PublicKey, msg, sig []byte) error {
+	var h crypto.Hash
+	switch alg[2:] {
+	case "256":
+		h = crypto.SHA256
+	case "384":
+		h = crypto.SHA384
+	case "512":
+		h = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %s", alg)
+	}
+	w := h.New()
+	w.Write(msg)
+	d := w.Sum(nil)
+	switch alg[:2] {
+	case "RS", "PS":
+		p, ok := k.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s requires a rsa key", alg)
+		}
+		if alg[:2] == "PS" {
+			return rsa.VerifyPSS(p, h, d, sig, nil)
+		}
+		return rsa.VerifyPKCS1v15(p, h, d, sig)
+	case "ES":
+		p, ok := k.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s requires an ecdsa key", alg)
+		}
+		if p.Curve != curves[alg] {
+			return fmt.Errorf("algorithm %s does not match the curve %s", alg, p.Curve.Params().Name)
+		}
+		s := (p.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*s {
+			return errors.New("invalid ecdsa signature size")
+		}
+		r, v := new(big.Int).SetBytes(sig[:s]), new(big.Int).SetBytes(sig[s:])
+		if !ecdsa.Verify(p, d, r, v) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported algorithm %s", alg)
+}
+
+// audience is a string or a list of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	var ss []string
+	if err := json.Unmarshal(b, &ss); err != nil {
+		return errors.New("invalid audience")
+	}
+	*a = ss
+	return nil
+}
+
+type jwtClaims struct {
+	Issuer    string                    `json:"iss"`
+	Subject   string                    `json:"sub"`
+	Audience  audience                  `json:"aud"`
+	ExpiresAt *float64                  `json:"exp"`
+	NotBefore *float64                  `json:"nbf"`
+	all       map[string]jsontext.Value // including the custom claims
+}
+
+// oidcAuth authenticates clients with JWTs from an OIDC issuer, mapping the
+// claims starting with prefix (rate, burst, profile and admin) to the same
+// settings of the API keys.
+type oidcAuth struct {
+	issuer   string
+	audience string
+	prefix   string
+	keys     *jwks
+	now      func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]*client // by subject, so each one keeps its rate limit (see forget)
+}
+
+func (o *oidcAuth) enabled() bool { return o != nil }
+
+func (o *oidcAuth) verify(t string) (jwtClaims, error) {
+	var c jwtClaims
+	ps := strings.Split(t, ".")
+	if len(ps) != 3 {
+		return c, errors.New("not a jwt")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(ps[0])
+	if err != nil {
+		return c, fmt.Errorf("invalid jwt header: %w", err)
+	}
+	var h struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(b, &h); err != nil {
+		return c, fmt.Errorf("invalid jwt header: %w", err)
+	}
+	if len(h.Alg) != 5 { // e.g. RS256, rejecting none
+		return c, fmt.Errorf("unsupported algorithm %s", h.Alg)
+	}
+	k, err := o.keys.get(h.Kid)
+	if err != nil {
+		return c, err
+	}
+	if k.alg != "" && k.alg != h.Alg {
+		return c, fmt.Errorf("algorithm %s does not match the algorithm %s of the key %s", h.Alg, k.alg, h.Kid)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(ps[2])
+	if err != nil {
+		return c, fmt.Errorf("invalid jwt signature: %w", err)
+	}
+	if err := verifySignature(h.Alg, k.key, []byte(ps[0]+"."+ps[1]), sig); err != nil {
+		return c, fmt.Errorf("invalid jwt signature: %w", err)
+	}
+	b, err = base64.RawURLEncoding.DecodeString(ps[1])
+	if err != nil {
+		return c, fmt.Errorf("invalid jwt claims: %w", err)
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("invalid jwt claims: %w", err)
+	}
+	if err := json.Unmarshal(b, &c.all); err != nil {
+		return c, fmt.Errorf("invalid jwt claims: %w", err)
+	}
+	now := o.now()
+	switch {
+	case c.Issuer != o.issuer:
+		return c, fmt.Errorf("unexpected issuer %s", c.Issuer)
+	case !slices.Contains(c.Audience, o.audience):
+		return c, fmt.Errorf("unexpected audience %v", c.Audience)
+	case c.Subject == "":
+		return c, errors.New("missing subject")
+	case c.ExpiresAt == nil:
+		return c, errors.New("missing expiration")
+	case now.Add(-jwtLeeway).After(time.Unix(int64(*c.ExpiresAt), 0)):
+		return c, errors.New("expired jwt")
+	case c.NotBefore != nil && now.Add(jwtLeeway).Before(time.Unix(int64(*c.NotBefore), 0)):
+		return c, errors.New("jwt not valid yet")
+	}
+	return c, nil
+}
+
+// key maps the claims to the settings of an API key named after the subject.
+func (o *oidcAuth) key(c jwtClaims) (db.APIKey, error) {
+	k := db.APIKey{Name: db.OIDCKeyNamePrefix + c.Subject}
+	for n, v := range map[string]any{"rate": &k.Rate, "burst": &k.Burst, "profile": &k.Profile, "admin": &k.Admin} {
+		b, ok := c.all[o.prefix+n]
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal(b, v); err != nil {
+			return db.APIKey{}, fmt.Errorf("invalid claim %s%s: %w", o.prefix, n, err)
+		}
+	}
+	if k.Rate < 0 || k.Burst < 0 {
+		return db.APIKey{}, errors.New("rate and burst claims cannot be negative")
+	}
+	if k.Profile != "" {
+		p, err := db.ParseProfile(string(k.Profile))
+		if err != nil {
+			return db.APIKey{}, fmt.Errorf("invalid claim %sprofile: %w", o.prefix, err)
+		}
+		k.Profile = p
+	}
+	return k, nil
+}
+
+func (o *oidcAuth) authenticate(t string) (*client, bool) {
+	c, err := o.verify(t)
+	if err != nil {
+		slog.Debug("Invalid jwt", "error", err)
+		return nil, false
+	}
+	k, err := o.key(c)
+	if err != nil {
+		slog.Debug("Invalid jwt claims", "error", err)
+		return nil, false
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if cl, ok := o.clients[k.Name]; ok && cl.key == k {
+		return cl, true
+	}
+	now := time.Now()
+	if len(o.clients) >= maxOIDCClients {
+		o.forget(now)
+	}
+	cl := &client{k, newBucket(k, now)}
+	o.clients[k.Name] = cl
+	return cl, true
+}
+
+// forget bounds the clients kept in memory, dropping the ones with a full
+// bucket (which would start over with the same rate limit anyway) or, if all
+// of them are still being rate limited, every client. It expects o.mu to be
+// locked.
+func (o *oidcAuth) forget(now time.Time) {
+	for s, c := range o.clients {
+		if c.bucket.full(now) {
+			delete(o.clients, s)
+		}
+	}
+	if len(o.clients) >= maxOIDCClients {
+		clear(o.clients)
+	}
+}
+
+// discoverJWKS reads the URL of the keys from the OIDC discovery document of
+// the issuer.
+func discoverJWKS(c *http.Client, iss string) (string, error) {
+	u := strings.TrimSuffix(iss, "/") + "/.well-known/openid-configuration"
+	resp, err := c.Get(u)
+	if err != nil {
+		return "", fmt.Errorf("could not get %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not get %s: status %d", u, resp.StatusCode)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("could not read %s: %w", u, err)
+	}
+	var d struct {
+		JWKS string `json:"jwks_uri"`
+	}
+	if err := json.Unmarshal(b, &d); err != nil || d.JWKS == "" {
+		return "", fmt.Errorf("no jwks_uri in %s", u)
+	}
+	return d.JWKS, nil
+}
+
+// newOIDCFromEnv configures the authentication with JWTs from the OIDC issuer
+// in OIDC_ISSUER for the audience in OIDC_AUDIENCE. The keys are read from
+// OIDC_JWKS_URL (or from the discovery document of the issuer) and cached for
+// OIDC_JWKS_TTL. It returns nil if OIDC_ISSUER is not set.
+func newOIDCFromEnv() (*oidcAuth, error) {
+	iss := os.Getenv("OIDC_ISSUER")
+	if iss == "" {
+		return nil, nil
+	}
+	aud := os.Getenv("OIDC_AUDIENCE")
+	if aud == "" {
+		return nil, errors.New("OIDC_ISSUER requires OIDC_AUDIENCE")
+	}
+	ttl := defaultJWKSTTL
+	if v := os.Getenv("OIDC_JWKS_TTL"); v != "" {
+		var err error
+		ttl, err = time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid OIDC_JWKS_TTL %s", v)
+		}
+	}
+	p := defaultClaimsPrefix
+	if v, ok := os.LookupEnv("OIDC_CLAIMS_PREFIX"); ok {
+		p = v
+	}
+	c := &http.Client{Timeout: oidcTimeout}
+	u := os.Getenv("OIDC_JWKS_URL")
+	if u == "" {
+		var err error
+		u, err = discoverJWKS(c, iss)
+		if err != nil {
+			return nil, fmt.Errorf("could not discover the jwks of %s: %w", iss, err)
+		}
+	}
+	k := &jwks{url: u, ttl: ttl, client: c}
+	if err := k.refresh(); err != nil {
+		return nil, err
+	}
+	return &oidcAuth{issuer: iss, audience: aud, prefix: p, keys: k, now: time.Now, clients: make(map[string]*client)}, nil
+}
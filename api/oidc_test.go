@@ -0,0 +1,366 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json/v2"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+const (
+	testIssuer   = "https://auth.minhareceita.org"
+	testAudience = "minha-receita"
+)
+
+type testIssuerKeys struct {
+	rsa     *rsa.PrivateKey
+	ec      *ecdsa.PrivateKey
+	fetches atomic.Int32
+	down    atomic.Bool
+}
+
+func newTestIssuerKeys(t *testing.T) *testIssuerKeys {
+	r, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate rsa key: %s", err)
+	}
+	e, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate ecdsa key: %s", err)
+	}
+	return &testIssuerKeys{rsa: r, ec: e}
+}
+
+// server serves the discovery document and the public keys of the issuer.
+func (k *testIssuerKeys) server(t *testing.T) *httptest.Server {
+	enc := base64.RawURLEncoding.EncodeToString
+	var s *httptest.Server
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			fmt.Fprintf(w, `{"issuer":"%s","jwks_uri":"%s/jwks"}`, testIssuer, s.URL)
+		case "/jwks":
+			k.fetches.Add(1)
+			if k.down.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			x, y := make([]byte, 32), make([]byte, 32)
+			k.ec.X.FillBytes(x)
+			k.ec.Y.FillBytes(y)
+			fmt.Fprintf(
+				w,
+				`{"keys":[{"kty":"RSA","kid":"rsa","use":"sig","n":"%s","e":"%s"},{"kty":"EC","kid":"ec","crv":"P-256","x":"%s","y":"%s"},{"kty":"RSA","kid":"enc","use":"enc","n":"%s","e":"AQAB"},{"kty":"RSA","kid":"rs512","alg":"RS512","n":"%s","e":"AQAB"}]}`,
+				enc(k.rsa.N.Bytes()),
+				enc(big.NewInt(int64(k.rsa.E)).Bytes()),
+				enc(x),
+				enc(y),
+				enc(k.rsa.N.Bytes()),
+				enc(k.rsa.N.Bytes()),
+			)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (k *testIssuerKeys) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	enc := base64.RawURLEncoding.EncodeToString
+	h, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	if err != nil {
+		t.Fatalf("could not serialize jwt header: %s", err)
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("could not serialize jwt claims: %s", err)
+	}
+	m := enc(h) + "." + enc(c)
+	hs := crypto.SHA256
+	if strings.HasSuffix(alg, "384") {
+		hs = crypto.SHA384
+	}
+	w := hs.New()
+	w.Write([]byte(m))
+	d := w.Sum(nil)
+	var sig []byte
+	switch alg[:2] {
+	case "RS":
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, hs, d)
+	case "ES": // always with the P-256 key
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k.ec, d)
+		if err == nil {
+			sig = make([]byte, 64)
+			r.FillBytes(sig[:32])
+			s.FillBytes(sig[32:])
+		}
+	}
+	if err != nil {
+		t.Fatalf("could not sign jwt: %s", err)
+	}
+	return m + "." + enc(sig)
+}
+
+func testClaims(now time.Time) map[string]any {
+	return map[string]any{
+		"iss": testIssuer,
+		"aud": []string{"other", testAudience},
+		"sub": "42",
+		"exp": now.Add(time.Hour).Unix(),
+	}
+}
+
+func newTestOIDC(t *testing.T, k *testIssuerKeys) *oidcAuth {
+	s := k.server(t)
+	t.Setenv("OIDC_ISSUER", testIssuer)
+	t.Setenv("OIDC_AUDIENCE", testAudience)
+	t.Setenv("OIDC_JWKS_URL", s.URL+"/jwks")
+	o, err := newOIDCFromEnv()
+	if err != nil {
+		t.Fatalf("expected no error configuring oidc, got %s", err)
+	}
+	return o
+}
+
+func TestNewOIDCFromEnv(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		t.Setenv("OIDC_ISSUER", "")
+		o, err := newOIDCFromEnv()
+		if err != nil || o != nil {
+			t.Errorf("expected no oidc and no error, got %v and %v", o, err)
+		}
+		if o.enabled() {
+			t.Error("expected nil oidc to be disabled")
+		}
+	})
+	t.Run("missing audience", func(t *testing.T) {
+		t.Setenv("OIDC_ISSUER", testIssuer)
+		t.Setenv("OIDC_AUDIENCE", "")
+		if _, err := newOIDCFromEnv(); err == nil {
+			t.Error("expected an error without audience, got nil")
+		}
+	})
+	t.Run("discovery", func(t *testing.T) {
+		k := newTestIssuerKeys(t)
+		s := k.server(t)
+		t.Setenv("OIDC_ISSUER", s.URL)
+		t.Setenv("OIDC_AUDIENCE", testAudience)
+		t.Setenv("OIDC_JWKS_URL", "")
+		o, err := newOIDCFromEnv()
+		if err != nil {
+			t.Fatalf("expected no error discovering the jwks, got %s", err)
+		}
+		if o.keys.url != s.URL+"/jwks" {
+			t.Errorf("expected jwks url %s/jwks, got %s", s.URL, o.keys.url)
+		}
+		if len(o.keys.keys) != 3 {
+			t.Errorf("expected 3 signing keys, got %d", len(o.keys.keys))
+		}
+	})
+}
+
+func TestOIDCVerify(t *testing.T) {
+	k := newTestIssuerKeys(t)
+	o := newTestOIDC(t, k)
+	now := time.Now()
+	with := func(n string, v any) map[string]any {
+		c := testClaims(now)
+		if v == nil {
+			delete(c, n)
+		} else {
+			c[n] = v
+		}
+		return c
+	}
+	valid := k.sign(t, "RS256", "rsa", testClaims(now))
+	for _, c := range []struct {
+		desc  string
+		token string
+		ok    bool
+	}{
+		{"rsa", valid, true},
+		{"ecdsa", k.sign(t, "ES256", "ec", testClaims(now)), true},
+		{"audience as string", k.sign(t, "RS256", "rsa", with("aud", testAudience)), true},
+		{"expired within leeway", k.sign(t, "RS256", "rsa", with("exp", now.Add(-30*time.Second).Unix())), true},
+		{"expired", k.sign(t, "RS256", "rsa", with("exp", now.Add(-time.Hour).Unix())), false},
+		{"missing expiration", k.sign(t, "RS256", "rsa", with("exp", nil)), false},
+		{"not valid yet", k.sign(t, "RS256", "rsa", with("nbf", now.Add(time.Hour).Unix())), false},
+		{"wrong issuer", k.sign(t, "RS256", "rsa", with("iss", "https://example.com")), false},
+		{"wrong audience", k.sign(t, "RS256", "rsa", with("aud", "other")), false},
+		{"missing subject", k.sign(t, "RS256", "rsa", with("sub", nil)), false},
+		{"unknown key", k.sign(t, "RS256", "unknown", testClaims(now)), false},
+		{"encryption key", k.sign(t, "RS256", "enc", testClaims(now)), false},
+		{"algorithm not matching the key", k.sign(t, "RS256", "ec", testClaims(now)), false},
+		{"algorithm not matching the one declared by the key", k.sign(t, "RS256", "rs512", testClaims(now)), false},
+		{"algorithm not matching the curve", k.sign(t, "ES384", "ec", testClaims(now)), false},
+		{"tampered", valid[:len(valid)-4] + "AAAA", false},
+		{"unsigned", base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + valid[strings.Index(valid, "."):strings.LastIndex(valid, ".")+1], false},
+		{"not a jwt", "forty-two", false},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			_, err := o.verify(c.token)
+			if c.ok && err != nil {
+				t.Errorf("expected valid jwt, got %s", err)
+			}
+			if !c.ok && err == nil {
+				t.Error("expected invalid jwt, got nil")
+			}
+		})
+	}
+}
+
+func TestOIDCRefreshesKeys(t *testing.T) {
+	k := newTestIssuerKeys(t)
+	o := newTestOIDC(t, k)
+	tk := k.sign(t, "RS256", "unknown", testClaims(time.Now()))
+	for range 3 {
+		if _, ok := o.authenticate(tk); ok {
+			t.Error("expected unknown key to be rejected")
+		}
+	}
+	if n := k.fetches.Load(); n != 1 {
+		t.Errorf("expected unknown keys not to refetch the jwks right away, got %d fetches", n)
+	}
+	o.keys.attempted = time.Now().Add(-2 * minJWKSRefresh)
+	o.authenticate(tk)
+	if n := k.fetches.Load(); n != 2 {
+		t.Errorf("expected unknown key to refetch the jwks, got %d fetches", n)
+	}
+}
+
+func TestOIDCIssuerDown(t *testing.T) {
+	k := newTestIssuerKeys(t)
+	o := newTestOIDC(t, k)
+	tk := k.sign(t, "RS256", "rsa", testClaims(time.Now()))
+	k.down.Store(true)
+	expired := time.Now().Add(-2 * defaultJWKSTTL)
+	o.keys.fetched, o.keys.attempted = expired, expired
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			if _, ok := o.authenticate(tk); !ok {
+				t.Error("expected the cached keys to be used while the issuer is down")
+			}
+		})
+	}
+	wg.Wait()
+	if n := k.fetches.Load(); n != 2 {
+		t.Errorf("expected a single attempt to refresh the jwks, got %d fetches", n-1)
+	}
+	if o.keys.fetched != expired || !o.keys.attempted.After(expired) {
+		t.Error("expected the failed attempt to be recorded without refreshing the keys")
+	}
+	if _, ok := o.authenticate(tk); !ok {
+		t.Error("expected the cached keys to be used while the issuer is down")
+	}
+	if n := k.fetches.Load(); n != 2 {
+		t.Errorf("expected failed attempts to back off, got %d fetches", n-1)
+	}
+}
+
+func TestOIDCForgetsClients(t *testing.T) {
+	k := newTestIssuerKeys(t)
+	o := newTestOIDC(t, k)
+	now := time.Now()
+	for i := range maxOIDCClients {
+		n := db.APIKey{Name: fmt.Sprintf("oidc:%d", i), Rate: 1, Burst: 2}
+		o.clients[n.Name] = &client{n, newBucket(n, now)}
+	}
+	limited := o.clients["oidc:0"]
+	limited.bucket.take(now)
+	if _, ok := o.authenticate(k.sign(t, "RS256", "rsa", testClaims(now))); !ok {
+		t.Fatal("expected jwt to be accepted")
+	}
+	if len(o.clients) != 2 {
+		t.Errorf("expected the idle clients to be forgotten, got %d clients", len(o.clients))
+	}
+	if o.clients["oidc:0"] != limited {
+		t.Error("expected the rate limited client to be kept")
+	}
+}
+
+func TestOIDCClaims(t *testing.T) {
+	k := newTestIssuerKeys(t)
+	o := newTestOIDC(t, k)
+	c := testClaims(time.Now())
+	c["minha_receita_rate"] = 2
+	c["minha_receita_burst"] = 3
+	c["minha_receita_profile"] = "Registration"
+	c["minha_receita_admin"] = true
+	got, ok := o.authenticate(k.sign(t, "RS256", "rsa", c))
+	if !ok {
+		t.Fatal("expected jwt to be accepted")
+	}
+	if got.key.Name != "oidc:42" || got.key.Rate != 2 || got.key.Burst != 3 || got.key.Profile != db.ProfileRegistration || !got.key.Admin {
+		t.Errorf("unexpected client %#v", got.key)
+	}
+	again, _ := o.authenticate(k.sign(t, "RS256", "rsa", c))
+	if again != got {
+		t.Error("expected the same subject to keep its client (and rate limit)")
+	}
+	c["minha_receita_rate"] = 5
+	changed, _ := o.authenticate(k.sign(t, "RS256", "rsa", c))
+	if changed == got || changed.key.Rate != 5 {
+		t.Errorf("expected a new client when the claims change, got %#v", changed.key)
+	}
+	for n, v := range map[string]any{"minha_receita_profile": "forty-two", "minha_receita_rate": "fast", "minha_receita_burst": -1} {
+		i := testClaims(time.Now())
+		i[n] = v
+		if _, ok := o.authenticate(k.sign(t, "RS256", "rsa", i)); ok {
+			t.Errorf("expected jwt with %s=%v to be rejected", n, v)
+		}
+	}
+}
+
+func TestAuthWrapperWithOIDC(t *testing.T) {
+	k := newTestIssuerKeys(t)
+	app := api{oidc: newTestOIDC(t, k)}
+	h := app.authWrapper(func(w http.ResponseWriter, r *http.Request) {
+		c, ok := clientFrom(r.Context())
+		if !ok {
+			t.Error("expected a client in the context")
+			return
+		}
+		fmt.Fprint(w, c.key.Name)
+	})
+	for _, c := range []struct {
+		desc   string
+		header string
+		status int
+	}{
+		{"missing token", "", http.StatusUnauthorized},
+		{"invalid token", "Bearer forty-two", http.StatusUnauthorized},
+		{"valid token", "Bearer " + k.sign(t, "ES256", "ec", testClaims(time.Now())), http.StatusOK},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if c.header != "" {
+				r.Header.Set("Authorization", c.header)
+			}
+			w := httptest.NewRecorder()
+			h(w, r)
+			if w.Code != c.status {
+				t.Errorf("expected status %d, got %d", c.status, w.Code)
+			}
+			if c.status == http.StatusOK && w.Body.String() != "oidc:42" {
+				t.Errorf("expected client oidc:42, got %s", w.Body.String())
+			}
+		})
+	}
+}
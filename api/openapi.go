@@ -0,0 +1,496 @@
+package api
+
+import (
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cuducos/minha-receita/db"
+	"github.com/cuducos/minha-receita/export"
+	"github.com/cuducos/minha-receita/transform"
+)
+
+const openAPIVersion = "3.1.0"
+
+// message is the shape of errors and other plain messages (see
+// messageResponse).
+type message struct {
+	Message string `json:"message"`
+}
+
+// page is the shape of the paginated search (see db.newPage).
+type page struct {
+	Data   []transform.Company `json:"data"`
+	Cursor *string             `json:"cursor"`
+}
+
+type partnersPage struct {
+	Data  []transform.PartnerData `json:"data"`
+	Total int                     `json:"total"`
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// raw JSON in the responses is the JSON of a company (e.g. in the event log)
+var jsonValueType = reflect.TypeFor[jsontext.Value]()
+
+// schemas builds JSON schemas from Go types, keeping named structs as
+// components so they are referenced (with the refs prefix) instead of
+// repeated.
+type schemas struct {
+	components map[string]any
+	refs       string
+}
+
+func (s *schemas) ref(t reflect.Type) map[string]any {
+	n := t.Name()
+	n = strings.ToUpper(n[:1]) + n[1:]
+	if _, ok := s.components[n]; !ok {
+		s.components[n] = nil // avoids infinite recursion in recursive types
+		s.components[n] = s.object(t)
+	}
+	return map[string]any{"$ref": s.refs + n}
+}
+
+func (s *schemas) object(t reflect.Type) map[string]any {
+	ps := make(map[string]any)
+	var req []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		n, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if n == "-" {
+			continue
+		}
+		if n == "" {
+			n = f.Name
+		}
+		ps[n] = s.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") {
+			req = append(req, n)
+		}
+	}
+	return map[string]any{"type": "object", "properties": ps, "required": req}
+}
+
+func (s *schemas) schema(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		r := s.schema(t.Elem())
+		if v, ok := r["type"].(string); ok {
+			r["type"] = []string{v, "null"}
+			return r
+		}
+		return map[string]any{"anyOf": []any{r, map[string]any{"type": "null"}}}
+	}
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.ConvertibleTo(timeType): // dates from the transform package
+		return map[string]any{"type": "string", "format": "date"}
+	case t == jsonValueType:
+		return s.ref(reflect.TypeFor[transform.Company]())
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		return s.ref(t)
+	}
+	return map[string]any{}
+}
+
+func content(s map[string]any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": s}}
+}
+
+func response(d string, s map[string]any) map[string]any {
+	r := map[string]any{"description": d}
+	if s != nil {
+		r["content"] = content(s)
+	}
+	return r
+}
+
+func queryParam(n, d string, s map[string]any) map[string]any {
+	return map[string]any{"name": n, "in": "query", "description": d, "schema": s}
+}
+
+func profileParam() map[string]any {
+	return queryParam("perfil", "Perfil de resposta, com um subconjunto dos campos da empresa", map[string]any{"type": "string", "enum": db.Profiles()})
+}
+
+func caseParam() map[string]any {
+	return queryParam("case", "Formato das chaves do JSON (padrão snake)", map[string]any{"type": "string", "enum": []string{snakeCase, camelCase}})
+}
+
+func numbersParam() map[string]any {
+	return queryParam("numbers", "Formato dos identificadores e códigos numéricos (padrão number)", map[string]any{"type": "string", "enum": []string{numberNumbers, stringNumbers}})
+}
+
+func formattedParam() map[string]any {
+	return queryParam("formatted", "Inclui campos formatados para apresentação: cnpj_formatado, capital_social_formatado e endereco_formatado (padrão false)", map[string]any{"type": "boolean"})
+}
+
+func searchParams() []any {
+	ps := []any{
+		profileParam(),
+		caseParam(),
+		numbersParam(),
+		formattedParam(),
+		queryParam("format", "Formato da resposta (padrão json); em xlsx e geojson, o cursor da próxima página vem no cabeçalho X-Next-Cursor; geojson requer o modo PostGIS", map[string]any{"type": "string", "enum": []string{"json", string(export.XLSX), geoJSONFormat}}),
+	}
+	return append(ps, dbSearchParams()...)
+}
+
+// dbSearchParams describes the parameters of db.SearchParams, except the ones
+// named in skip.
+func dbSearchParams(skip ...string) []any {
+	var ps []any
+	for _, p := range db.SearchParams {
+		if slices.Contains(skip, p.Name) {
+			continue
+		}
+		s := map[string]any{"type": "string"}
+		var e any = p.Example
+		if p.Integer {
+			s = map[string]any{"type": "integer"}
+			if n, err := strconv.Atoi(p.Example); err == nil {
+				e = n
+			}
+		}
+		multiple := p.Filter && !p.Single
+		if multiple {
+			s = map[string]any{"type": "array", "items": s}
+			e = []any{e}
+		}
+		q := queryParam(p.Name, p.Description, s)
+		q["example"] = e
+		if multiple {
+			q["style"] = "form"
+			q["explode"] = true
+		}
+		ps = append(ps, q)
+	}
+	return ps
+}
+
+// openAPI generates the OpenAPI document from the types used by the handlers.
+func openAPI() map[string]any {
+	s := schemas{components: make(map[string]any), refs: "#/components/schemas/"}
+	msg := s.schema(reflect.TypeFor[message]())
+	get := func(summary string, params []any, rs map[string]any) map[string]any {
+		o := map[string]any{"summary": summary, "responses": rs}
+		if len(params) > 0 {
+			o["parameters"] = params
+		}
+		return map[string]any{"get": o}
+	}
+	search := response("Página de resultados; cursor é nulo na última página", s.schema(reflect.TypeFor[page]()))
+	search["content"].(map[string]any)[export.XLSXContentType] = map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}
+	search["content"].(map[string]any)[geoJSONContentType] = map[string]any{"schema": map[string]any{"type": "object", "description": "FeatureCollection com as empresas em um ponto dentro dos seus municípios"}}
+	bundle := response("Arquivo tar comprimido com zstd com o JSON Schema das empresas (schema.json) e os dicionários de códigos (dicionarios/*.json)", nil)
+	bundle["content"] = map[string]any{bundleContentType: map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}}
+	tagParams := []any{
+		map[string]any{"name": "cnpj", "in": "path", "required": true, "description": "CNPJ, com ou sem pontuação", "schema": map[string]any{"type": "string"}, "example": "33683111000280"},
+		map[string]any{"name": "tag", "in": "path", "required": true, "description": "Etiqueta (até 32 letras minúsculas, números, hífens e sublinhados)", "schema": map[string]any{"type": "string"}, "example": "cliente"},
+	}
+	tagResponses := func() map[string]any {
+		return map[string]any{
+			"204": response("Etiqueta atualizada", nil),
+			"400": response("CNPJ ou etiqueta inválida", msg),
+			"403": response("A requisição não tem chave de API", msg),
+			"404": response("CNPJ não encontrado", msg),
+		}
+	}
+	paths := map[string]any{
+		"/": get(
+			"Busca paginada de empresas (ao menos um filtro é obrigatório)",
+			searchParams(),
+			map[string]any{
+				"200": search,
+				"302": response("Redireciona para a documentação quando não há filtros", nil),
+				"400": response("Coordenadas, polígono, perfil, formato das chaves ou formato da resposta inválido", msg),
+				"408": response("Tempo de requisição esgotado", msg),
+			},
+		),
+		"/{cnpj}": get(
+			"Consulta uma empresa pelo CNPJ",
+			[]any{
+				map[string]any{"name": "cnpj", "in": "path", "required": true, "description": "CNPJ, com ou sem pontuação", "schema": map[string]any{"type": "string"}, "example": "33683111000280"},
+				profileParam(),
+				caseParam(),
+				numbersParam(),
+				formattedParam(),
+			},
+			map[string]any{
+				"200": response("Dados da empresa (apenas os campos do perfil, se houver)", s.schema(reflect.TypeFor[transform.Company]())),
+				"304": response("Os dados não mudaram desde a versão informada em If-None-Match ou If-Modified-Since", nil),
+				"400": response("CNPJ, perfil ou formato das chaves inválido", msg),
+				"404": response("CNPJ não encontrado", msg),
+			},
+		),
+		"/v1/cnpj/{cnpj}/qsa": get(
+			"Página do quadro societário (QSA) de uma empresa",
+			[]any{
+				map[string]any{"name": "cnpj", "in": "path", "required": true, "description": "CNPJ, com ou sem pontuação", "schema": map[string]any{"type": "string"}, "example": "33683111000280"},
+				queryParam("offset", "Posição do primeiro sócio da página (padrão 0)", map[string]any{"type": "integer"}),
+				queryParam("limit", fmt.Sprintf("Número de sócios (padrão %d, máximo %d)", db.DefaultPartnersLimit, db.MaxPartnersLimit), map[string]any{"type": "integer"}),
+				caseParam(),
+				numbersParam(),
+			},
+			map[string]any{
+				"200": response("Sócios da página e total de sócios da empresa", s.schema(reflect.TypeFor[partnersPage]())),
+				"304": response("Os dados não mudaram desde a versão informada em If-None-Match ou If-Modified-Since", nil),
+				"400": response("CNPJ, limite, offset ou formato das chaves inválido", msg),
+				"404": response("CNPJ não encontrado", msg),
+			},
+		),
+		"/v1/cnpj/{cnpj}/cnaes": get(
+			"CNAEs principal e secundários de uma empresa",
+			[]any{
+				map[string]any{"name": "cnpj", "in": "path", "required": true, "description": "CNPJ, com ou sem pontuação", "schema": map[string]any{"type": "string"}, "example": "33683111000280"},
+				caseParam(),
+				numbersParam(),
+			},
+			map[string]any{
+				"200": response("CNAEs da empresa com suas descrições", s.schema(reflect.TypeFor[cnaes]())),
+				"304": response("Os dados não mudaram desde a versão informada em If-None-Match ou If-Modified-Since", nil),
+				"400": response("CNPJ ou formato das chaves inválido", msg),
+				"404": response("CNPJ não encontrado", msg),
+			},
+		),
+		"/v1/cnpj/{cnpj}/events": get(
+			"Histórico de uma empresa nas cargas dos dados (inclusão, alteração e exclusão)",
+			[]any{
+				map[string]any{"name": "cnpj", "in": "path", "required": true, "description": "CNPJ, com ou sem pontuação", "schema": map[string]any{"type": "string"}, "example": "33683111000280"},
+			},
+			map[string]any{
+				"200": response("Eventos da empresa, do mais antigo ao mais recente", s.schema(reflect.TypeFor[eventsPage]())),
+				"304": response("Os dados não mudaram desde a versão informada em If-None-Match ou If-Modified-Since", nil),
+				"400": response("CNPJ inválido", msg),
+				"404": response("Nenhum evento para o CNPJ", msg),
+				"501": response("Servidor sem registro de eventos (disponível apenas com PostgreSQL)", msg),
+			},
+		),
+		"/v1/cnpj/{cnpj}/tags": get(
+			"Etiquetas de uma empresa atribuídas pela chave de API da requisição",
+			[]any{
+				map[string]any{"name": "cnpj", "in": "path", "required": true, "description": "CNPJ, com ou sem pontuação", "schema": map[string]any{"type": "string"}, "example": "33683111000280"},
+			},
+			map[string]any{
+				"200": response("Etiquetas da empresa, em ordem alfabética", s.schema(reflect.TypeFor[tagsPage]())),
+				"400": response("CNPJ inválido", msg),
+				"403": response("A requisição não tem chave de API", msg),
+				"404": response("CNPJ não encontrado", msg),
+			},
+		),
+		"/v1/cnpj/{cnpj}/tags/{tag}": map[string]any{
+			"put":    map[string]any{"summary": "Atribui uma etiqueta a uma empresa, para a chave de API da requisição", "parameters": tagParams, "responses": tagResponses()},
+			"delete": map[string]any{"summary": "Remove uma etiqueta de uma empresa, para a chave de API da requisição", "parameters": tagParams, "responses": tagResponses()},
+		},
+		"/v1/cnpj/{cnpj}/enrichment": map[string]any{
+			"patch": map[string]any{
+				"summary": "Altera o enriquecimento de uma empresa com um JSON merge patch, em que campos nulos são removidos (requer chave de API de administração)",
+				"parameters": []any{
+					map[string]any{"name": "cnpj", "in": "path", "required": true, "description": "CNPJ, com ou sem pontuação", "schema": map[string]any{"type": "string"}, "example": "33683111000280"},
+				},
+				"requestBody": map[string]any{
+					"required": true,
+					"content":  map[string]any{"application/merge-patch+json": map[string]any{"schema": map[string]any{"type": "object"}}},
+				},
+				"responses": map[string]any{
+					"200": response("Enriquecimento da empresa após a alteração", map[string]any{"type": "object"}),
+					"400": response("CNPJ inválido ou campos fora do esquema de enriquecimento", msg),
+					"403": response("A chave de API não é de administração", msg),
+					"404": response("CNPJ não encontrado ou enriquecimento não configurado", msg),
+				},
+			},
+		},
+		"/v1/by/{kind}/{id}": get(
+			"Consulta uma empresa por outro identificador (NIRE, inscrição estadual etc.) carregado pelos operadores",
+			[]any{
+				map[string]any{"name": "kind", "in": "path", "required": true, "description": "Tipo do identificador", "schema": map[string]any{"type": "string"}, "example": "nire"},
+				map[string]any{"name": "id", "in": "path", "required": true, "description": "Identificador, com ou sem pontuação", "schema": map[string]any{"type": "string"}, "example": "35300012345"},
+				profileParam(),
+				caseParam(),
+				numbersParam(),
+				formattedParam(),
+			},
+			map[string]any{
+				"200": response("Dados da empresa (apenas os campos do perfil, se houver)", s.schema(reflect.TypeFor[transform.Company]())),
+				"304": response("Os dados não mudaram desde a versão informada em If-None-Match ou If-Modified-Since", nil),
+				"400": response("Identificador, perfil ou formato das chaves inválido", msg),
+				"404": response("Identificador não encontrado", msg),
+			},
+		),
+		"/v1/bundle/meta.tar.zst": get(
+			"Dicionários de códigos e JSON Schema das empresas em um único arquivo, com ETag estável por versão dos dados",
+			nil,
+			map[string]any{
+				"200": bundle,
+				"304": response("Os dados não mudaram desde a versão informada em If-None-Match", nil),
+				"404": response("Dicionários indisponíveis nos dados carregados", msg),
+			},
+		),
+		"/updated": get(
+			"Data de extração dos dados pela Receita Federal",
+			nil,
+			map[string]any{
+				"200": response("Data no campo message", msg),
+				"304": response("Os dados não mudaram desde a versão informada em If-None-Match ou If-Modified-Since", nil),
+			},
+		),
+		"/v1/updated/stream": get(
+			"Server-sent events com a data de extração dos dados sempre que o banco de dados é atualizado",
+			nil,
+			map[string]any{"200": map[string]any{
+				"description": "Eventos updated com a data de extração dos dados",
+				"content":     map[string]any{"text/event-stream": map[string]any{"schema": map[string]any{"type": "string"}}},
+			}},
+		),
+		"/v1/ws": get(
+			"Consultas por CNPJ via WebSocket, várias na mesma conexão",
+			nil,
+			map[string]any{"101": response("Conexão WebSocket estabelecida", nil)},
+		),
+		"/v1/aggregation/{field}": get(
+			"Número de empresas por código de um campo entre as empresas que atendem aos filtros da busca paginada (ao menos um filtro é obrigatório)",
+			append(
+				[]any{map[string]any{"name": "field", "in": "path", "required": true, "description": "Campo da agregação", "schema": map[string]any{"type": "string", "enum": slices.Sorted(maps.Keys(db.AggregationFields))}, "example": "codigo_faixa_capital_social"}},
+				dbSearchParams("limit", "cursor")...,
+			),
+			map[string]any{
+				"200": response("Número de empresas por código, em ordem crescente do código (nulo para as empresas sem o campo)", s.schema(reflect.TypeFor[aggregationPage]())),
+				"304": response("Os dados não mudaram desde a versão informada em If-None-Match ou If-Modified-Since", nil),
+				"400": response("Campo, coordenadas ou polígono inválido, ou nenhum filtro informado", msg),
+				"408": response("Tempo de requisição esgotado", msg),
+			},
+		),
+		"/v1/exports/{format}": get(
+			"URL temporária para baixar os dados exportados direto do armazenamento de objetos",
+			[]any{
+				map[string]any{"name": "format", "in": "path", "required": true, "description": "Formato do arquivo", "schema": map[string]any{"type": "string", "enum": export.Formats}},
+			},
+			map[string]any{
+				"200": response("URL pré-assinada e quando ela expira", s.schema(reflect.TypeFor[exportURL]())),
+				"404": response("Formato não encontrado ou servidor sem arquivos exportados", msg),
+			},
+		),
+		"/v1/status": get(
+			"Data dos dados e cobertura do servidor (todas as empresas ou apenas parte delas)",
+			nil,
+			map[string]any{"200": response("Data de atualização e empresas servidas por esse servidor", s.schema(reflect.TypeFor[status]()))},
+		),
+		"/v1/capacity": get(
+			"Sinais de ocupação para autoscaling",
+			nil,
+			map[string]any{"200": response("Ocupação da API e do banco de dados", s.schema(reflect.TypeFor[capacity]()))},
+		),
+		"/v1/slo": get(
+			"Cumprimento dos objetivos de nível de serviço (SLO)",
+			nil,
+			map[string]any{"200": response("Disponibilidade e latência das requisições GET na janela do SLO", s.schema(reflect.TypeFor[sloReport]()))},
+		),
+		"/v1/admin/audit": get(
+			"Registros de auditoria mais recentes (requer chave de API de administração)",
+			[]any{queryParam("limit", fmt.Sprintf("Número de registros (padrão %d, máximo %d)", defaultAuditLimit, maxAuditLimit), map[string]any{"type": "integer"})},
+			map[string]any{
+				"200": response("Registros de auditoria, do mais recente ao mais antigo", s.schema(reflect.TypeFor[auditPage]())),
+				"400": response("Limite inválido", msg),
+				"403": response("A chave de API não é de administração", msg),
+			},
+		),
+		"/v1/admin/log-level": map[string]any{
+			"get": map[string]any{
+				"summary":   "Nível dos logs do servidor (requer chave de API de administração)",
+				"responses": map[string]any{"200": response("Nível atual dos logs", s.schema(reflect.TypeFor[logLevelResponse]())), "403": response("A chave de API não é de administração", msg)},
+			},
+			"put": map[string]any{
+				"summary":    "Altera o nível dos logs sem reiniciar o servidor (requer chave de API de administração)",
+				"parameters": []any{queryParam("level", "Novo nível dos logs", map[string]any{"type": "string", "enum": []string{"debug", "info", "warn", "error"}})},
+				"responses": map[string]any{
+					"200": response("Nível dos logs após a alteração", s.schema(reflect.TypeFor[logLevelResponse]())),
+					"400": response("Nível inválido", msg),
+					"403": response("A chave de API não é de administração", msg),
+				},
+			},
+		},
+		"/healthz": get("Verificação de saúde da API", nil, map[string]any{"200": response("API funcionando", nil)}),
+	}
+	for k, p := range paths {
+		if k == "/healthz" { // not wrapped by authWrapper
+			continue
+		}
+		for _, o := range p.(map[string]any) {
+			rs := o.(map[string]any)["responses"].(map[string]any)
+			rs["401"] = response("Chave de API ausente ou inválida (apenas quando existem chaves de API)", msg)
+			rs["429"] = response("Limite de requisições da chave de API excedido", msg)
+		}
+	}
+	return map[string]any{
+		"openapi": openAPIVersion,
+		"info": map[string]any{
+			"title":       "Minha Receita",
+			"description": "API web para consulta de informações do CNPJ da Receita Federal",
+			"version":     "1",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": s.components,
+			"securitySchemes": map[string]any{
+				"apiKey": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []any{map[string]any{}, map[string]any{"apiKey": []string{}}},
+	}
+}
+
+var openAPIDocument = sync.OnceValues(func() ([]byte, error) {
+	return json.Marshal(openAPI(), json.Deterministic(true))
+})
+
+func (app *api) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	i := time.Now().UnixMilli()
+	if r.Method != http.MethodGet {
+		app.messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		registerMetric("openapi", r.Method, http.StatusMethodNotAllowed, i)
+		return
+	}
+	b, err := openAPIDocument()
+	if err != nil {
+		slog.Error("could not generate the openapi document", "error", err)
+		app.messageResponse(w, http.StatusInternalServerError, "Erro gerando a especificação OpenAPI.")
+		registerMetric("openapi", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.Header().Set("Cache-Control", app.cacheControl())
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		slog.Error("error responding to openapi request", "error", err)
+	}
+	registerMetric("openapi", r.Method, http.StatusOK, i)
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+type openAPISpec struct {
+	OpenAPI string `json:"openapi"`
+	Paths   map[string]struct {
+		Get struct {
+			Parameters []struct {
+				Name string `json:"name"`
+			} `json:"parameters"`
+			Responses map[string]jsontext.Value `json:"responses"`
+		} `json:"get"`
+	} `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]jsontext.Value `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/openapi.json", nil)
+	if err != nil {
+		t.Fatal("Expected an HTTP request, but got an error.")
+	}
+	app := api{db: &mockDatabase{}}
+	resp := httptest.NewRecorder()
+	handler := http.HandlerFunc(app.openAPIHandler)
+	handler.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	if got := resp.Header().Get("Content-type"); got != "application/json" {
+		t.Errorf("expected content-type to be application/json, got %s", got)
+	}
+	var s openAPISpec
+	if err := json.Unmarshal(resp.Body.Bytes(), &s); err != nil {
+		t.Fatalf("expected a valid json document, got %s", err)
+	}
+	if s.OpenAPI != openAPIVersion {
+		t.Errorf("expected openapi version %s, got %s", openAPIVersion, s.OpenAPI)
+	}
+	for _, p := range []string{"/", "/{cnpj}", "/updated", "/v1/updated/stream", "/v1/ws", "/v1/aggregation/{field}", "/v1/capacity", "/v1/admin/audit", "/healthz"} {
+		if _, ok := s.Paths[p]; !ok {
+			t.Errorf("expected path %s in the openapi document", p)
+		}
+	}
+	ps := make(map[string]struct{})
+	for _, p := range s.Paths["/"].Get.Parameters {
+		ps[p.Name] = struct{}{}
+	}
+	for _, p := range db.SearchParams {
+		if _, ok := ps[p.Name]; !ok {
+			t.Errorf("expected search parameter %s in the openapi document", p.Name)
+		}
+	}
+	for _, f := range db.ProfileMinimal.Fields() {
+		if _, ok := s.Components.Schemas["Company"].Properties[f]; !ok {
+			t.Errorf("expected field %s in the company schema", f)
+		}
+	}
+	for _, n := range []string{"Company", "PartnerData", "CNAE", "TaxRegime", "Message", "Page", "Capacity", "AuditPage", "AuditEntry"} {
+		if _, ok := s.Components.Schemas[n]; !ok {
+			t.Errorf("expected schema %s in the openapi document", n)
+		}
+	}
+}
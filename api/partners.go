@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cuducos/go-cnpj"
+	"github.com/cuducos/minha-receita/db"
+)
+
+// partnersHandler serves a page of the partners (QSA) of a company, so
+// companies with thousands of partners can be read without downloading the
+// whole array at once.
+func (app *api) partnersHandler(w http.ResponseWriter, r *http.Request) {
+	i := time.Now().UnixMilli()
+	if r.Method != http.MethodGet {
+		app.messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		registerMetric("qsa", r.Method, http.StatusMethodNotAllowed, i)
+		return
+	}
+	n := r.PathValue("cnpj")
+	if !cnpj.IsValid(n) {
+		app.messageResponse(w, http.StatusBadRequest, fmt.Sprintf("CNPJ %s inválido.", n))
+		registerMetric("qsa", r.Method, http.StatusBadRequest, i)
+		return
+	}
+	l := db.DefaultPartnersLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		l, err = strconv.Atoi(v)
+		if err != nil || l < 1 || l > db.MaxPartnersLimit {
+			app.messageResponse(w, http.StatusBadRequest, fmt.Sprintf("Limite %s inválido, use um número entre 1 e %d.", v, db.MaxPartnersLimit))
+			registerMetric("qsa", r.Method, http.StatusBadRequest, i)
+			return
+		}
+	}
+	var o int
+	if v := r.URL.Query().Get("offset"); v != "" {
+		var err error
+		o, err = strconv.Atoi(v)
+		if err != nil || o < 0 {
+			app.messageResponse(w, http.StatusBadRequest, fmt.Sprintf("Offset %s inválido, use um número maior ou igual a 0.", v))
+			registerMetric("qsa", r.Method, http.StatusBadRequest, i)
+			return
+		}
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	s, err := app.db.Partners(ctx, cnpj.Unmask(n), o, l)
+	if err != nil {
+		slog.Debug("could not read partners", "cnpj", n, "error", err)
+		app.messageResponse(w, http.StatusNotFound, app.companyNotFound(n))
+		registerMetric("qsa", r.Method, http.StatusNotFound, i)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.Header().Set("Cache-Control", app.cacheControl())
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.WriteString(w, s); err != nil {
+		slog.Error("error responding to partners request", "cnpj", n, "error", err)
+	}
+	registerMetric("qsa", r.Method, http.StatusOK, i)
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPartnersHandler(t *testing.T) {
+	for _, c := range []struct {
+		method  string
+		path    string
+		status  int
+		content string
+	}{
+		{
+			http.MethodGet,
+			"/v1/cnpj/19131243000197/qsa",
+			http.StatusOK,
+			`{"data":[],"total":100}`,
+		},
+		{
+			http.MethodGet,
+			"/v1/cnpj/19131243000197/qsa?offset=5&limit=10",
+			http.StatusOK,
+			`{"data":[],"total":15}`,
+		},
+		{
+			http.MethodPost,
+			"/v1/cnpj/19131243000197/qsa",
+			http.StatusMethodNotAllowed,
+			`{"message":"Essa URL aceita apenas o método GET."}`,
+		},
+		{
+			http.MethodGet,
+			"/v1/cnpj/foobar/qsa",
+			http.StatusBadRequest,
+			`{"message":"CNPJ foobar inválido."}`,
+		},
+		{
+			http.MethodGet,
+			"/v1/cnpj/19131243000197/qsa?limit=1001",
+			http.StatusBadRequest,
+			`{"message":"Limite 1001 inválido, use um número entre 1 e 1000."}`,
+		},
+		{
+			http.MethodGet,
+			"/v1/cnpj/19131243000197/qsa?offset=-1",
+			http.StatusBadRequest,
+			`{"message":"Offset -1 inválido, use um número maior ou igual a 0."}`,
+		},
+		{
+			http.MethodGet,
+			"/v1/cnpj/33683111000280/qsa",
+			http.StatusNotFound,
+			`{"message":"CNPJ 33.683.111/0002-80 não encontrado."}`,
+		},
+	} {
+		req, err := http.NewRequest(c.method, c.path, nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		app := api{db: &mockDatabase{}}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/v1/cnpj/{cnpj}/qsa", app.partnersHandler)
+		resp := httptest.NewRecorder()
+		mux.ServeHTTP(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("expected %s %s to return %d, got %d", c.method, c.path, c.status, resp.Code)
+		}
+		if got := strings.TrimSpace(resp.Body.String()); got != c.content {
+			t.Errorf("expected %s, got %s", c.content, got)
+		}
+	}
+}
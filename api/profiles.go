@@ -0,0 +1,25 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+// profile returns the response profile requested with the perfil URL
+// parameter or, if there is none, the default profile of the API key in use.
+func profile(r *http.Request, c *client) (db.Profile, error) {
+	if v := r.URL.Query().Get("perfil"); v != "" {
+		return db.ParseProfile(v)
+	}
+	if c != nil {
+		return db.ParseProfile(string(c.key.Profile))
+	}
+	return db.ProfileFull, nil
+}
+
+func invalidProfileMessage(v string) string {
+	return fmt.Sprintf("Perfil %s inválido, as opções são: %s.", v, strings.Join(db.Profiles(), ", "))
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+func TestCompanyHandlerProfiles(t *testing.T) {
+	a, k, err := db.NewAPIKey("test", 0, 0)
+	if err != nil {
+		t.Fatalf("expected no error creating api key, got %s", err)
+	}
+	a.Profile = db.ProfileRegistration
+	var ks apiKeys
+	ks.set([]db.APIKey{a})
+	for _, c := range []struct {
+		desc   string
+		keys   *apiKeys
+		path   string
+		status int
+		fields int
+	}{
+		{"default", nil, "/19131243000197", http.StatusOK, 0},
+		{"minimal", nil, "/19131243000197?perfil=minimal", http.StatusOK, len(db.ProfileMinimal.Fields())},
+		{"full", nil, "/19131243000197?perfil=full", http.StatusOK, 0},
+		{"api key default", &ks, "/19131243000197", http.StatusOK, len(db.ProfileRegistration.Fields())},
+		{"api key overridden", &ks, "/19131243000197?perfil=minimal", http.StatusOK, len(db.ProfileMinimal.Fields())},
+		{"invalid", nil, "/19131243000197?perfil=everything", http.StatusBadRequest, 0},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			app := api{db: &mockDatabase{}, keys: c.keys}
+			req := httptest.NewRequest(http.MethodGet, c.path, nil)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", k))
+			resp := httptest.NewRecorder()
+			app.authWrapper(app.companyHandler)(resp, req)
+			if resp.Code != c.status {
+				t.Errorf("expected %s to return %d, got %d", c.path, c.status, resp.Code)
+			}
+			if c.status != http.StatusOK || c.fields == 0 {
+				return
+			}
+			var got map[string]jsontext.Value
+			if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+				t.Fatalf("expected no error unmarshalling response, got %s", err)
+			}
+			if len(got) != c.fields {
+				t.Errorf("expected %d fields, got %d: %s", c.fields, len(got), resp.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	shadowTimeout     = 10 * time.Second
+	maxShadowInFlight = 64
+	shadowHeader      = "X-Minha-Receita-Shadow"
+)
+
+var shadowRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "shadow_requests_total",
+	Help: "The total number of requests mirrored to the shadow backend, by result (the status code, error or dropped)",
+}, []string{"endpoint", "result"})
+
+// shadow mirrors a share of the read requests to another deployment (e.g. a
+// staging one, with a new database backend or index layout), so it can be
+// validated under real load. Mirrored requests never affect the response to
+// the client: they are sent in the background and their responses discarded.
+type shadow struct {
+	target  *url.URL
+	rate    float64
+	client  *http.Client
+	slots   chan struct{} // limits the mirrored requests in flight
+	sampler func() float64
+}
+
+// newShadowFromEnv configures the mirroring from SHADOW_URL and
+// SHADOW_PERCENT (default 100). It returns nil if SHADOW_URL is not set.
+func newShadowFromEnv() (*shadow, error) {
+	v := os.Getenv("SHADOW_URL")
+	if v == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid SHADOW_URL %q: expected an http or https url", v)
+	}
+	p := 100.0
+	if v := os.Getenv("SHADOW_PERCENT"); v != "" {
+		p, err = strconv.ParseFloat(v, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return nil, fmt.Errorf("invalid SHADOW_PERCENT %q: expected a number greater than 0 and up to 100", v)
+		}
+	}
+	slog.Info("Mirroring requests", "url", u.Redacted(), "percent", p)
+	return newShadow(u, p/100), nil
+}
+
+func newShadow(u *url.URL, rate float64) *shadow {
+	return &shadow{
+		target:  u,
+		rate:    rate,
+		client:  &http.Client{Timeout: shadowTimeout},
+		slots:   make(chan struct{}, maxShadowInFlight),
+		sampler: rand.Float64,
+	}
+}
+
+// request builds the mirrored request: same path, query and headers, but
+// without the credentials of the client.
+func (s *shadow) request(r *http.Request) (*http.Request, error) {
+	u := *s.target
+	u.Path = s.target.JoinPath(r.URL.Path).Path
+	u.RawQuery = r.URL.RawQuery
+	req, err := http.NewRequest(r.Method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = r.Header.Clone()
+	req.Header.Del("Authorization")
+	req.Header.Del("Cookie")
+	req.Header.Set(shadowHeader, "1")
+	return req, nil
+}
+
+func (s *shadow) send(e string, req *http.Request) {
+	defer func() { <-s.slots }()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		slog.Warn("could not mirror request", "url", req.URL.Redacted(), "error", err)
+		shadowRequests.WithLabelValues(e, "error").Inc()
+		return
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.Warn("could not close mirrored response body", "error", err)
+		}
+	}()
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil { // so the connection can be reused
+		slog.Warn("could not read mirrored response body", "error", err)
+	}
+	shadowRequests.WithLabelValues(e, strconv.Itoa(resp.StatusCode)).Inc()
+}
+
+// shadowWrapper mirrors the GET requests sampled to the shadow backend. When
+// too many mirrored requests are in flight, new ones are dropped instead of
+// piling up.
+func (app *api) shadowWrapper(e string, h func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	s := app.shadow
+	if s == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.Header.Get(shadowHeader) == "" && s.sampler() < s.rate {
+			select {
+			case s.slots <- struct{}{}:
+				req, err := s.request(r)
+				if err != nil {
+					<-s.slots
+					slog.Warn("could not create mirrored request", "error", err)
+					shadowRequests.WithLabelValues(e, "error").Inc()
+					break
+				}
+				go s.send(e, req)
+			default:
+				shadowRequests.WithLabelValues(e, "dropped").Inc()
+			}
+		}
+		h(w, r)
+	}
+}
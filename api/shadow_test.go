@@ -0,0 +1,109 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNewShadowFromEnv(t *testing.T) {
+	s, err := newShadowFromEnv()
+	if err != nil || s != nil {
+		t.Errorf("expected no shadow without SHADOW_URL, got %v (%v)", s, err)
+	}
+	t.Setenv("SHADOW_URL", "https://staging.example.com")
+	t.Setenv("SHADOW_PERCENT", "5")
+	s, err = newShadowFromEnv()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if s.rate != 0.05 || s.target.Host != "staging.example.com" {
+		t.Errorf("expected 5%% of requests mirrored to staging.example.com, got %f to %s", s.rate, s.target.Host)
+	}
+	for k, v := range map[string]string{
+		"SHADOW_URL":     "staging.example.com",
+		"SHADOW_PERCENT": "101",
+	} {
+		t.Run(k, func(t *testing.T) {
+			t.Setenv(k, v)
+			if _, err := newShadowFromEnv(); err == nil {
+				t.Errorf("expected error for %s=%s, got nil", k, v)
+			}
+		})
+	}
+}
+
+func TestShadowWrapper(t *testing.T) {
+	shadowRequests.Reset()
+	got := make(chan *http.Request, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL + "/staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newShadow(u, 0.5)
+	app := api{db: &mockDatabase{}, shadow: s}
+	var served int
+	h := app.shadowWrapper("test", func(w http.ResponseWriter, r *http.Request) {
+		served++
+		w.WriteHeader(http.StatusOK)
+	})
+	req := func(m string) *http.Request {
+		r, err := http.NewRequest(m, "/33683111000280?perfil=minimal", nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		r.Header.Set("Authorization", "Bearer secret")
+		return r
+	}
+
+	s.sampler = func() float64 { return 0.9 }
+	h(httptest.NewRecorder(), req(http.MethodGet))
+	s.sampler = func() float64 { return 0.1 }
+	h(httptest.NewRecorder(), req(http.MethodHead))
+	select {
+	case r := <-got:
+		t.Errorf("expected no mirrored request, got %s %s", r.Method, r.URL)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	h(httptest.NewRecorder(), req(http.MethodGet))
+	select {
+	case r := <-got:
+		if r.URL.Path != "/staging/33683111000280" || r.URL.RawQuery != "perfil=minimal" {
+			t.Errorf("expected the request to be mirrored to the same path and query, got %s", r.URL)
+		}
+		if r.Header.Get("Authorization") != "" {
+			t.Error("expected the mirrored request without credentials")
+		}
+		if r.Header.Get(shadowHeader) == "" {
+			t.Errorf("expected the mirrored request with the %s header", shadowHeader)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected a mirrored request, got none")
+	}
+	if served != 3 {
+		t.Errorf("expected all the requests to be served, got %d", served)
+	}
+	for range maxShadowInFlight {
+		s.slots <- struct{}{}
+	}
+	h(httptest.NewRecorder(), req(http.MethodGet))
+	if n := testutil.ToFloat64(shadowRequests.WithLabelValues("test", "dropped")); n != 1 {
+		t.Errorf("expected 1 dropped request, got %f", n)
+	}
+	for range maxShadowInFlight {
+		<-s.slots
+	}
+	if n := testutil.ToFloat64(shadowRequests.WithLabelValues("test", "404")); n != 1 {
+		t.Errorf("expected 1 mirrored request with status 404, got %f", n)
+	}
+}
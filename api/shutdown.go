@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// DefaultShutdownDeadline is how long a graceful shutdown waits for the
+// requests in flight before closing the connections.
+const DefaultShutdownDeadline = 30 * time.Second
+
+// The metrics are updated while draining, so they can be scraped from the
+// internal server (see --internal-port) until the process exits. The aborted
+// requests are only known at the very end, so they are only logged.
+var (
+	shutdownDrained = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "shutdown_drained_requests_total",
+		Help: "The number of requests that finished during the graceful shutdown",
+	})
+	shutdownLongestWait = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "shutdown_longest_wait_seconds",
+		Help: "How long the graceful shutdown waited for the slowest drained request",
+	})
+)
+
+// drainer tracks every request so a graceful shutdown can tell how many of
+// them finished (drained) and how many were still running at the deadline
+// (aborted).
+type drainer struct {
+	sync.Mutex
+	active  int64
+	since   time.Time // when the shutdown started, zero while serving
+	drained int64
+	longest time.Duration
+}
+
+func (d *drainer) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.Lock()
+		d.active++
+		d.Unlock()
+		defer func() {
+			d.Lock()
+			defer d.Unlock()
+			d.active--
+			if d.since.IsZero() {
+				return
+			}
+			d.drained++
+			shutdownDrained.Inc()
+			if t := time.Since(d.since); t > d.longest {
+				d.longest = t
+				shutdownLongestWait.Set(t.Seconds())
+			}
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// start marks the beginning of the shutdown and returns the number of requests
+// in flight.
+func (d *drainer) start() int64 {
+	d.Lock()
+	defer d.Unlock()
+	d.since = time.Now()
+	return d.active
+}
+
+type shutdownReport struct {
+	drained int64
+	aborted int64
+	longest time.Duration
+}
+
+// stop returns the report of the shutdown, counting the requests still in
+// flight as aborted.
+func (d *drainer) stop() shutdownReport {
+	d.Lock()
+	defer d.Unlock()
+	return shutdownReport{d.drained, d.active, d.longest}
+}
+
+// shutdown stops accepting new connections and waits for the requests in
+// flight for up to k before closing the remaining connections. Streams of
+// server-sent events are closed as soon as the shutdown starts (see
+// updates.close, registered with RegisterOnShutdown). Hijacked connections
+// (WebSockets) are not waited for, so they are counted as aborted if their
+// handlers are still running.
+func (app *api) shutdown(s *http.Server, k time.Duration) error {
+	n := app.drain.start()
+	slog.Info("Shutting down, draining requests in flight", "requests", n, "deadline", k)
+	ctx, cancel := context.WithTimeout(context.Background(), k)
+	defer cancel()
+	err := s.Shutdown(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		slog.Warn("Shutdown deadline reached, closing remaining connections")
+		err = s.Close()
+	}
+	r := app.drain.stop()
+	slog.Info("Shutdown report", "drained", r.drained, "aborted", r.aborted, "longest_wait", r.longest)
+	if err != nil {
+		return fmt.Errorf("error shutting down the server: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		slow     time.Duration
+		deadline time.Duration
+		drained  int64
+		aborted  int64
+	}{
+		{"drained", 50 * time.Millisecond, time.Second, 2, 0},
+		{"aborted", time.Second, 50 * time.Millisecond, 1, 1},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("could not listen: %s", err)
+			}
+			var app api
+			started := make(chan struct{}, 2)
+			mux := http.NewServeMux()
+			mux.HandleFunc("/fast", func(w http.ResponseWriter, _ *http.Request) {
+				started <- struct{}{}
+				time.Sleep(10 * time.Millisecond)
+				w.WriteHeader(http.StatusOK)
+			})
+			mux.HandleFunc("/slow", func(w http.ResponseWriter, _ *http.Request) {
+				started <- struct{}{}
+				time.Sleep(c.slow)
+				w.WriteHeader(http.StatusOK)
+			})
+			s := &http.Server{Handler: app.drain.wrap(mux)}
+			go s.Serve(ln)
+			for _, p := range []string{"/fast", "/slow"} {
+				go http.Get("http://" + ln.Addr().String() + p)
+			}
+			<-started
+			<-started
+			if err := app.shutdown(s, c.deadline); err != nil {
+				t.Errorf("expected no error shutting down, got %s", err)
+			}
+			r := shutdownReport{app.drain.drained, app.drain.active, app.drain.longest}
+			if r.drained != c.drained {
+				t.Errorf("expected %d drained requests, got %d", c.drained, r.drained)
+			}
+			if r.aborted != c.aborted {
+				t.Errorf("expected %d aborted requests, got %d", c.aborted, r.aborted)
+			}
+			if r.longest <= 0 || r.longest > c.deadline {
+				t.Errorf("expected the longest wait to be up to %s, got %s", c.deadline, r.longest)
+			}
+		})
+	}
+}
+
+func TestShutdownClosesStreams(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %s", err)
+	}
+	app := api{updates: newUpdates()}
+	app.updates.publish("2024-08-17")
+	s := &http.Server{Handler: app.drain.wrap(http.HandlerFunc(app.updatedStreamHandler))}
+	s.RegisterOnShutdown(app.updates.close)
+	go s.Serve(ln)
+	resp, err := http.Get("http://" + ln.Addr().String())
+	if err != nil {
+		t.Fatalf("could not connect to the stream: %s", err)
+	}
+	defer resp.Body.Close()
+	start := time.Now()
+	if err := app.shutdown(s, 5*time.Second); err != nil {
+		t.Errorf("expected no error shutting down, got %s", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("expected the stream not to hold the shutdown, took %s", d)
+	}
+	if app.drain.drained != 1 || app.drain.active != 0 {
+		t.Errorf("expected the stream to be drained, got %d drained and %d aborted", app.drain.drained, app.drain.active)
+	}
+}
@@ -0,0 +1,276 @@
+package api
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	defaultAvailabilityTarget = 0.995
+	defaultLatencyTarget      = 0.995
+	defaultLatencyThreshold   = 100 * time.Millisecond
+	defaultSLOWindow          = 30 * 24 * time.Hour
+	sloBucketSize             = time.Hour
+)
+
+// sloExcluded are the endpoints whose duration is not a response time (long
+// lived connections) or that are not meaningful to users (health checks).
+var sloExcluded = map[string]struct{}{
+	"health":        {},
+	"updatedStream": {},
+	"websocket":     {},
+}
+
+var sloRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "slo_requests_total",
+	Help: "The total number of GET requests, good or bad, for each service level objective",
+}, []string{"slo", "result"})
+
+// slos is the tracker fed by registerMetric, configured by Serve.
+var slos = newSLOTracker(defaultAvailabilityTarget, defaultLatencyTarget, defaultLatencyThreshold, defaultSLOWindow)
+
+type sloBucket struct {
+	hour  int64 // hours since the epoch, to tell whether the bucket is stale
+	total int64
+	fails int64 // server errors
+	fast  int64 // within the latency threshold
+}
+
+// sloTracker keeps one bucket per hour in a ring covering the window, so the
+// compliance over the last window is computed from memory. It resets when the
+// API restarts, and each replica has its own: aggregated numbers come from the
+// slo_requests_total series.
+type sloTracker struct {
+	mu           sync.Mutex
+	availability float64
+	latency      float64
+	threshold    time.Duration
+	window       time.Duration
+	buckets      []sloBucket
+}
+
+func newSLOTracker(availability, latency float64, threshold, window time.Duration) *sloTracker {
+	n := max(int(window/sloBucketSize), 1)
+	return &sloTracker{
+		availability: availability,
+		latency:      latency,
+		threshold:    threshold,
+		window:       time.Duration(n) * sloBucketSize,
+		buckets:      make([]sloBucket, n),
+	}
+}
+
+// newSLOTrackerFromEnv reads the objectives from SLO_AVAILABILITY_TARGET,
+// SLO_LATENCY_TARGET, SLO_LATENCY_THRESHOLD and SLO_WINDOW, falling back to
+// the defaults.
+func newSLOTrackerFromEnv() (*sloTracker, error) {
+	ratio := func(k string, d float64) (float64, error) {
+		v := os.Getenv(k)
+		if v == "" {
+			return d, nil
+		}
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil || r <= 0 || r >= 1 {
+			return 0, fmt.Errorf("invalid %s %q: expected a number between 0 and 1", k, v)
+		}
+		return r, nil
+	}
+	duration := func(k string, d time.Duration) (time.Duration, error) {
+		v := os.Getenv(k)
+		if v == "" {
+			return d, nil
+		}
+		r, err := time.ParseDuration(v)
+		if err != nil || r <= 0 {
+			return 0, fmt.Errorf("invalid %s %q: expected a positive duration", k, v)
+		}
+		return r, nil
+	}
+	a, err := ratio("SLO_AVAILABILITY_TARGET", defaultAvailabilityTarget)
+	if err != nil {
+		return nil, err
+	}
+	l, err := ratio("SLO_LATENCY_TARGET", defaultLatencyTarget)
+	if err != nil {
+		return nil, err
+	}
+	t, err := duration("SLO_LATENCY_THRESHOLD", defaultLatencyThreshold)
+	if err != nil {
+		return nil, err
+	}
+	w, err := duration("SLO_WINDOW", defaultSLOWindow)
+	if err != nil {
+		return nil, err
+	}
+	return newSLOTracker(a, l, t, w), nil
+}
+
+func result(good bool) string {
+	if good {
+		return "good"
+	}
+	return "bad"
+}
+
+// observe records a GET request to the endpoint e, with status s, finished at
+// now and taking d.
+func (t *sloTracker) observe(e, m string, s int, d time.Duration, now time.Time) {
+	if m != http.MethodGet {
+		return
+	}
+	if _, ok := sloExcluded[e]; ok {
+		return
+	}
+	ok := s < http.StatusInternalServerError
+	fast := d <= t.threshold
+	sloRequests.WithLabelValues("availability", result(ok)).Inc()
+	sloRequests.WithLabelValues("latency", result(fast)).Inc()
+
+	h := now.Unix() / int64(sloBucketSize/time.Second)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := &t.buckets[h%int64(len(t.buckets))]
+	if b.hour != h {
+		*b = sloBucket{hour: h}
+	}
+	b.total++
+	if !ok {
+		b.fails++
+	}
+	if fast {
+		b.fast++
+	}
+}
+
+type objective struct {
+	Target               float64  `json:"target"`
+	Compliance           *float64 `json:"compliance"`
+	ErrorBudgetRemaining *float64 `json:"error_budget_remaining"`
+	Good                 int64    `json:"good"`
+	Bad                  int64    `json:"bad"`
+}
+
+func newObjective(target float64, good, total int64) objective {
+	o := objective{Target: target, Good: good, Bad: total - good}
+	if total == 0 { // no requests, no compliance to report
+		return o
+	}
+	c := float64(good) / float64(total)
+	b := 1 - (1-c)/(1-target) // share of the allowed bad requests not spent yet
+	o.Compliance = &c
+	o.ErrorBudgetRemaining = &b
+	return o
+}
+
+type sloReport struct {
+	Window           string    `json:"window"`
+	Since            time.Time `json:"since"`
+	LatencyThreshold string    `json:"latency_threshold"`
+	Availability     objective `json:"availability"`
+	Latency          objective `json:"latency"`
+}
+
+// report sums the buckets within the window ending at now.
+func (t *sloTracker) report(now time.Time) sloReport {
+	h := now.Unix() / int64(sloBucketSize/time.Second)
+	var total, fails, fast int64
+	t.mu.Lock()
+	for _, b := range t.buckets {
+		if b.total == 0 || h-b.hour >= int64(len(t.buckets)) {
+			continue
+		}
+		total += b.total
+		fails += b.fails
+		fast += b.fast
+	}
+	t.mu.Unlock()
+	return sloReport{
+		Window:           t.window.String(),
+		Since:            now.Add(-t.window).UTC().Truncate(time.Second),
+		LatencyThreshold: t.threshold.String(),
+		Availability:     newObjective(t.availability, total-fails, total),
+		Latency:          newObjective(t.latency, fast, total),
+	}
+}
+
+// sloCollector exposes the compliance and the remaining error budget of the
+// tracker, computed on every scrape.
+type sloCollector struct {
+	tracker     *sloTracker
+	target      *prometheus.Desc
+	compliance  *prometheus.Desc
+	errorBudget *prometheus.Desc
+}
+
+func newSLOCollector(t *sloTracker) *sloCollector {
+	l := []string{"slo"}
+	return &sloCollector{
+		tracker: t,
+		target: prometheus.NewDesc(
+			"slo_target_ratio",
+			"The share of GET requests expected to be good",
+			l,
+			nil,
+		),
+		compliance: prometheus.NewDesc(
+			"slo_compliance_ratio",
+			"The share of good GET requests within the SLO window",
+			l,
+			nil,
+		),
+		errorBudget: prometheus.NewDesc(
+			"slo_error_budget_remaining_ratio",
+			"The share of the error budget not spent within the SLO window",
+			l,
+			nil,
+		),
+	}
+}
+
+func (c *sloCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.target
+	ch <- c.compliance
+	ch <- c.errorBudget
+}
+
+func (c *sloCollector) Collect(ch chan<- prometheus.Metric) {
+	r := c.tracker.report(time.Now())
+	for n, o := range map[string]objective{"availability": r.Availability, "latency": r.Latency} {
+		ch <- prometheus.MustNewConstMetric(c.target, prometheus.GaugeValue, o.Target, n)
+		if o.Compliance != nil {
+			ch <- prometheus.MustNewConstMetric(c.compliance, prometheus.GaugeValue, *o.Compliance, n)
+			ch <- prometheus.MustNewConstMetric(c.errorBudget, prometheus.GaugeValue, *o.ErrorBudgetRemaining, n)
+		}
+	}
+}
+
+func (app *api) sloHandler(w http.ResponseWriter, r *http.Request) {
+	i := time.Now().UnixMilli()
+	if r.Method != http.MethodGet {
+		app.messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		registerMetric("slo", r.Method, http.StatusMethodNotAllowed, i)
+		return
+	}
+	b, err := json.Marshal(slos.report(time.Now()))
+	if err != nil {
+		app.messageResponse(w, http.StatusInternalServerError, "Erro serializando os objetivos de nível de serviço.")
+		registerMetric("slo", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		slog.Error("error responding to slo request", "error", err)
+	}
+	registerMetric("slo", r.Method, http.StatusOK, i)
+}
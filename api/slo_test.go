@@ -0,0 +1,144 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSLOTracker(t *testing.T) {
+	now := time.Date(2024, 8, 17, 12, 30, 0, 0, time.UTC)
+	s := newSLOTracker(0.9, 0.5, 100*time.Millisecond, 24*time.Hour)
+	s.observe("singleCompany", http.MethodGet, http.StatusOK, 50*time.Millisecond, now.Add(-30*time.Hour)) // out of the window
+	for range 7 {
+		s.observe("singleCompany", http.MethodGet, http.StatusOK, 50*time.Millisecond, now.Add(-2*time.Hour))
+	}
+	s.observe("singleCompany", http.MethodGet, http.StatusNotFound, 150*time.Millisecond, now)
+	s.observe("singleCompany", http.MethodGet, http.StatusInternalServerError, 150*time.Millisecond, now)
+	s.observe("singleCompany", http.MethodGet, http.StatusServiceUnavailable, 50*time.Millisecond, now)
+	s.observe("singleCompany", http.MethodPost, http.StatusInternalServerError, time.Second, now)
+	s.observe("health", http.MethodGet, http.StatusInternalServerError, time.Second, now)
+	s.observe("websocket", http.MethodGet, http.StatusOK, time.Hour, now)
+
+	r := s.report(now)
+	if r.Window != "24h0m0s" || r.LatencyThreshold != "100ms" {
+		t.Errorf("expected a 24h window with a 100ms threshold, got %s and %s", r.Window, r.LatencyThreshold)
+	}
+	for _, c := range []struct {
+		name       string
+		got        objective
+		good, bad  int64
+		compliance float64
+		budget     float64
+	}{
+		{"availability", r.Availability, 8, 2, 0.8, -1},
+		{"latency", r.Latency, 8, 2, 0.8, 0.6},
+	} {
+		if c.got.Good != c.good || c.got.Bad != c.bad {
+			t.Errorf("expected %d good and %d bad for %s, got %d and %d", c.good, c.bad, c.name, c.got.Good, c.got.Bad)
+		}
+		if c.got.Compliance == nil || *c.got.Compliance != c.compliance {
+			t.Errorf("expected %s compliance of %f, got %v", c.name, c.compliance, c.got.Compliance)
+		}
+		if c.got.ErrorBudgetRemaining == nil || !almostEqual(*c.got.ErrorBudgetRemaining, c.budget) {
+			t.Errorf("expected %s error budget remaining of %f, got %v", c.name, c.budget, c.got.ErrorBudgetRemaining)
+		}
+	}
+
+	r = s.report(now.Add(48 * time.Hour))
+	if r.Availability.Compliance != nil || r.Availability.Good != 0 {
+		t.Errorf("expected no compliance without requests in the window, got %+v", r.Availability)
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	d := a - b
+	return d < 1e-9 && d > -1e-9
+}
+
+func TestNewSLOTrackerFromEnv(t *testing.T) {
+	s, err := newSLOTrackerFromEnv()
+	if err != nil {
+		t.Fatalf("expected no error with the defaults, got %s", err)
+	}
+	if s.availability != defaultAvailabilityTarget || s.threshold != defaultLatencyThreshold || len(s.buckets) != 720 {
+		t.Errorf("expected the default objectives, got %+v", s)
+	}
+	t.Setenv("SLO_LATENCY_THRESHOLD", "250ms")
+	t.Setenv("SLO_WINDOW", "168h")
+	s, err = newSLOTrackerFromEnv()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if s.threshold != 250*time.Millisecond || len(s.buckets) != 168 {
+		t.Errorf("expected a 250ms threshold over 168 buckets, got %s and %d", s.threshold, len(s.buckets))
+	}
+	for k, v := range map[string]string{
+		"SLO_AVAILABILITY_TARGET": "99.5",
+		"SLO_LATENCY_TARGET":      "zero",
+		"SLO_LATENCY_THRESHOLD":   "-1s",
+		"SLO_WINDOW":              "30d",
+	} {
+		t.Run(k, func(t *testing.T) {
+			t.Setenv(k, v)
+			if _, err := newSLOTrackerFromEnv(); err == nil {
+				t.Errorf("expected error for %s=%s, got nil", k, v)
+			}
+		})
+	}
+}
+
+func TestSLOCollector(t *testing.T) {
+	now := time.Now()
+	s := newSLOTracker(0.5, 0.5, 100*time.Millisecond, time.Hour)
+	s.observe("singleCompany", http.MethodGet, http.StatusOK, 50*time.Millisecond, now)
+	s.observe("singleCompany", http.MethodGet, http.StatusOK, 150*time.Millisecond, now)
+	s.observe("singleCompany", http.MethodGet, http.StatusOK, 150*time.Millisecond, now)
+	s.observe("singleCompany", http.MethodGet, http.StatusOK, 150*time.Millisecond, now)
+	expected := `
+# HELP slo_compliance_ratio The share of good GET requests within the SLO window
+# TYPE slo_compliance_ratio gauge
+slo_compliance_ratio{slo="availability"} 1
+slo_compliance_ratio{slo="latency"} 0.25
+# HELP slo_error_budget_remaining_ratio The share of the error budget not spent within the SLO window
+# TYPE slo_error_budget_remaining_ratio gauge
+slo_error_budget_remaining_ratio{slo="availability"} 1
+slo_error_budget_remaining_ratio{slo="latency"} -0.5
+# HELP slo_target_ratio The share of GET requests expected to be good
+# TYPE slo_target_ratio gauge
+slo_target_ratio{slo="availability"} 0.5
+slo_target_ratio{slo="latency"} 0.5
+`
+	if err := testutil.CollectAndCompare(newSLOCollector(s), strings.NewReader(expected)); err != nil {
+		t.Errorf("expected slo metrics to match, got %s", err)
+	}
+}
+
+func TestSLOHandler(t *testing.T) {
+	for _, c := range []struct {
+		method string
+		status int
+	}{
+		{http.MethodGet, http.StatusOK},
+		{http.MethodPost, http.StatusMethodNotAllowed},
+	} {
+		req, err := http.NewRequest(c.method, "/v1/slo", nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		app := api{db: &mockDatabase{}}
+		resp := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.sloHandler)
+		handler.ServeHTTP(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("expected %s /v1/slo to return %d, got %d", c.method, c.status, resp.Code)
+		}
+		if c.status == http.StatusOK && !strings.Contains(resp.Body.String(), `"latency_threshold":"100ms"`) {
+			t.Errorf("expected the slo report, got %s", resp.Body.String())
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"log/slog"
+	"net/http"
+
+	"github.com/cuducos/minha-receita/export"
+)
+
+const spreadsheetFileName = "minha-receita.xlsx"
+
+type searchPage struct {
+	Data   []jsontext.Value `json:"data"`
+	Cursor *string          `json:"cursor"`
+}
+
+// spreadsheetPage responds a page of the paginated search as an Excel file,
+// with the cursor of the next page in the X-Next-Cursor header (absent in the
+// last page).
+func (app *api) spreadsheetPage(w http.ResponseWriter, r *http.Request, s string, i int64) {
+	var p searchPage
+	if err := json.Unmarshal([]byte(s), &p); err != nil {
+		slog.Error("could not parse the search page", "error", err)
+		app.messageResponse(w, http.StatusInternalServerError, "Erro gerando a planilha.")
+		registerMetric("paginatedSearch", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	var b bytes.Buffer
+	if err := export.WritePage(&b, export.XLSX, p.Data); err != nil {
+		slog.Error("could not write the spreadsheet", "error", err)
+		app.messageResponse(w, http.StatusInternalServerError, "Erro gerando a planilha.")
+		registerMetric("paginatedSearch", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	w.Header().Set("Content-type", export.XLSXContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+spreadsheetFileName+`"`)
+	if p.Cursor != nil {
+		w.Header().Set("X-Next-Cursor", *p.Cursor)
+	}
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b.Bytes()); err != nil {
+		slog.Error("error responding to spreadsheet request", "error", err)
+	}
+	registerMetric("paginatedSearch", r.Method, http.StatusOK, i)
+}
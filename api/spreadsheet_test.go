@@ -0,0 +1,74 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cuducos/minha-receita/db"
+	"github.com/cuducos/minha-receita/export"
+)
+
+type searchDatabase struct {
+	mockDatabase
+	company string
+}
+
+func (s searchDatabase) Search(_ context.Context, _ *db.Query) (string, error) {
+	return fmt.Sprintf(`{"data":[%s,%s],"cursor":"42"}`, s.company, s.company), nil
+}
+
+func TestSpreadsheetSearch(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Fatalf("could not read company json: %s", err)
+	}
+	app := api{db: searchDatabase{company: string(b)}}
+	for _, c := range []struct {
+		path   string
+		status int
+	}{
+		{"/?uf=sp&format=xlsx", http.StatusOK},
+		{"/?uf=sp&format=json", http.StatusOK},
+		{"/?uf=sp&format=pdf", http.StatusBadRequest},
+	} {
+		req, err := http.NewRequest(http.MethodGet, c.path, nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		resp := httptest.NewRecorder()
+		app.companyHandler(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("expected %s to return %d, got %d", c.path, c.status, resp.Code)
+		}
+		if !strings.Contains(c.path, "xlsx") {
+			continue
+		}
+		if got := resp.Header().Get("Content-type"); got != export.XLSXContentType {
+			t.Errorf("expected content-type %s, got %s", export.XLSXContentType, got)
+		}
+		if got := resp.Header().Get("X-Next-Cursor"); got != "42" {
+			t.Errorf("expected the next cursor to be 42, got %s", got)
+		}
+		if _, err := zip.NewReader(bytes.NewReader(resp.Body.Bytes()), int64(resp.Body.Len())); err != nil {
+			t.Errorf("expected a valid xlsx file, got %s", err)
+		}
+	}
+	req, err := http.NewRequest(http.MethodGet, "/?uf=sp&format=pdf", nil)
+	if err != nil {
+		t.Fatal("Expected an HTTP request, but got an error.")
+	}
+	resp := httptest.NewRecorder()
+	app.companyHandler(resp, req)
+	exp := `{"message":"Formato pdf inválido, as opções são: json, xlsx, geojson."}`
+	if got := strings.TrimSpace(resp.Body.String()); got != exp {
+		t.Errorf("expected %s, got %s", exp, got)
+	}
+}
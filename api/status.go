@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cuducos/go-cnpj"
+	"github.com/cuducos/minha-receita/export"
+)
+
+// coverage is the subset of the companies served by this instance, declared
+// with the API_COVERAGE environment variable (e.g. uf:SP,RJ or cnae:62,63)
+// when its database holds only some of the shards of a split export. The
+// companies are not filtered, the coverage is only reported to the clients.
+type coverage struct {
+	split  export.Split
+	shards []string
+}
+
+func newCoverage(v string) (coverage, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return coverage{}, nil
+	}
+	k, ss, ok := strings.Cut(v, ":")
+	if !ok || strings.TrimSpace(ss) == "" {
+		return coverage{}, fmt.Errorf("expected the split and the shards, such as uf:SP,RJ, got %s", v)
+	}
+	s, err := export.ParseSplit(strings.TrimSpace(k))
+	if err != nil {
+		return coverage{}, err
+	}
+	c := coverage{split: s}
+	for v := range strings.SplitSeq(ss, ",") {
+		n, err := s.ParseShard(v)
+		if err != nil {
+			return coverage{}, err
+		}
+		c.shards = append(c.shards, n)
+	}
+	return c, nil
+}
+
+func newCoverageFromEnv() (coverage, error) {
+	c, err := newCoverage(os.Getenv("API_COVERAGE"))
+	if err != nil {
+		return coverage{}, fmt.Errorf("invalid API_COVERAGE: %w", err)
+	}
+	return c, nil
+}
+
+func (c coverage) complete() bool { return len(c.shards) == 0 }
+
+// companyNotFound is the message for CNPJs missing in the database, telling
+// the clients when the instance has only part of the companies.
+func (app *api) companyNotFound(n string) string {
+	m := fmt.Sprintf("CNPJ %s não encontrado.", cnpj.Mask(n))
+	if app.coverage.complete() {
+		return m
+	}
+	k := "UF"
+	if app.coverage.split == export.SplitByCNAE {
+		k = "divisão da CNAE fiscal"
+	}
+	return fmt.Sprintf("%s Esse servidor tem apenas parte das empresas (%s: %s), veja /v1/status.", m, k, strings.Join(app.coverage.shards, ", "))
+}
+
+type coverageStatus struct {
+	Complete bool         `json:"complete"`
+	SplitBy  export.Split `json:"split_by,omitempty"`
+	Shards   []string     `json:"shards,omitempty"`
+}
+
+type status struct {
+	UpdatedAt string         `json:"updated_at"`
+	Coverage  coverageStatus `json:"coverage"`
+}
+
+func (app *api) statusHandler(w http.ResponseWriter, r *http.Request) {
+	i := time.Now().UnixMilli()
+	if r.Method != http.MethodGet {
+		app.messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		registerMetric("status", r.Method, http.StatusMethodNotAllowed, i)
+		return
+	}
+	u, err := app.db.MetaRead("updated-at")
+	if err != nil {
+		app.messageResponse(w, http.StatusInternalServerError, "Erro buscando data de atualização.")
+		registerMetric("status", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	b, err := json.Marshal(status{
+		UpdatedAt: u,
+		Coverage:  coverageStatus{app.coverage.complete(), app.coverage.split, app.coverage.shards},
+	})
+	if err != nil {
+		app.messageResponse(w, http.StatusInternalServerError, "Erro serializando o status da API.")
+		registerMetric("status", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.Header().Set("Cache-Control", app.cacheControl())
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		slog.Error("error responding to status request", "error", err)
+	}
+	registerMetric("status", r.Method, http.StatusOK, i)
+}
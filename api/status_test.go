@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cuducos/minha-receita/export"
+)
+
+func TestNewCoverage(t *testing.T) {
+	for _, c := range []struct {
+		value  string
+		split  export.Split
+		shards []string
+		err    bool
+	}{
+		{"", "", nil, false},
+		{"uf:sp, RJ", export.SplitByUF, []string{"SP", "RJ"}, false},
+		{"cnae:62,63,outros", export.SplitByCNAE, []string{"62", "63", "outros"}, false},
+		{"SP,RJ", "", nil, true},
+		{"uf:", "", nil, true},
+		{"municipio:7107", "", nil, true},
+		{"cnae:6204000", "", nil, true},
+	} {
+		t.Run(c.value, func(t *testing.T) {
+			got, err := newCoverage(c.value)
+			if c.err {
+				if err == nil {
+					t.Errorf("expected an error for %s, got %v", c.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error for %s, got %s", c.value, err)
+			}
+			if got.split != c.split || !slices.Equal(got.shards, c.shards) {
+				t.Errorf("expected %s %v, got %s %v", c.split, c.shards, got.split, got.shards)
+			}
+		})
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	for _, c := range []struct {
+		desc     string
+		coverage string
+		content  string
+		notFound string
+	}{
+		{
+			"complete",
+			"",
+			`{"updated_at":"42","coverage":{"complete":true}}`,
+			"CNPJ 19.131.243/0001-97 não encontrado.",
+		},
+		{
+			"partial",
+			"uf:SP,RJ",
+			`{"updated_at":"42","coverage":{"complete":false,"split_by":"uf","shards":["SP","RJ"]}}`,
+			"CNPJ 19.131.243/0001-97 não encontrado. Esse servidor tem apenas parte das empresas (UF: SP, RJ), veja /v1/status.",
+		},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			cv, err := newCoverage(c.coverage)
+			if err != nil {
+				t.Fatalf("expected no error parsing coverage, got %s", err)
+			}
+			req, err := http.NewRequest(http.MethodGet, "/v1/status", nil)
+			if err != nil {
+				t.Fatal("Expected an HTTP request, but got an error.")
+			}
+			app := api{db: &mockDatabase{}, coverage: cv}
+			resp := httptest.NewRecorder()
+			handler := http.HandlerFunc(app.statusHandler)
+			handler.ServeHTTP(resp, req)
+			if resp.Code != http.StatusOK {
+				t.Errorf("expected status %d, got %d", http.StatusOK, resp.Code)
+			}
+			if got := strings.TrimSpace(resp.Body.String()); got != c.content {
+				t.Errorf("expected %s, got %s", c.content, got)
+			}
+			if got := app.companyNotFound("19131243000197"); got != c.notFound {
+				t.Errorf("expected %s, got %s", c.notFound, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	updatedPollInterval = time.Minute
+	streamKeepAlive     = 30 * time.Second
+)
+
+// updates keeps the dataset version (the updated-at metadata) and notifies
+// the subscribers when it changes.
+type updates struct {
+	mu          sync.Mutex
+	current     string
+	subscribers map[chan string]struct{}
+	done        chan struct{} // closed when the server shuts down
+	closeOnce   sync.Once
+}
+
+func newUpdates() *updates {
+	return &updates{subscribers: make(map[chan string]struct{}), done: make(chan struct{})}
+}
+
+// close ends the streams, as a graceful shutdown does not cancel the context
+// of the requests and would wait for them until its deadline.
+func (u *updates) close() {
+	u.closeOnce.Do(func() { close(u.done) })
+}
+
+func (u *updates) subscribe() (chan string, string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	ch := make(chan string, 1)
+	u.subscribers[ch] = struct{}{}
+	return ch, u.current
+}
+
+func (u *updates) latest() string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.current
+}
+
+func (u *updates) unsubscribe(ch chan string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.subscribers, ch)
+}
+
+func (u *updates) publish(v string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if v == "" || v == u.current {
+		return
+	}
+	u.current = v
+	for ch := range u.subscribers {
+		select {
+		case ch <- v:
+		default: // subscriber has not consumed the previous version yet
+			<-ch
+			ch <- v
+		}
+	}
+}
+
+func (u *updates) poll(db database) {
+	read := func() {
+		v, err := db.MetaRead("updated-at")
+		if err != nil {
+			slog.Error("could not read the dataset version", "error", err)
+			return
+		}
+		u.publish(v)
+	}
+	read()
+	for range time.Tick(updatedPollInterval) {
+		read()
+	}
+}
+
+// disableDeadlines removes the server read and write timeouts for long-lived
+// connections (streams and websockets)
+func disableDeadlines(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	for _, f := range []func(time.Time) error{rc.SetReadDeadline, rc.SetWriteDeadline} {
+		if err := f(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			slog.Warn("could not disable the deadline for a long-lived connection", "error", err)
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, v string) error {
+	if _, err := fmt.Fprintf(w, "id: %s\nevent: updated\ndata: %s\n\n", v, v); err != nil {
+		return err
+	}
+	return http.NewResponseController(w).Flush()
+}
+
+// updatedStreamHandler uses server-sent events to notify clients when the
+// dataset version changes. Clients reconnecting with the Last-Event-ID header
+// only get an event if the version is different from the one they had.
+func (app *api) updatedStreamHandler(w http.ResponseWriter, r *http.Request) {
+	i := time.Now().UnixMilli()
+	if r.Method != http.MethodGet {
+		app.messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		registerMetric("updatedStream", r.Method, http.StatusMethodNotAllowed, i)
+		return
+	}
+	disableDeadlines(w)
+	rc := http.NewResponseController(w)
+	ch, v := app.updates.subscribe()
+	defer app.updates.unsubscribe(ch)
+	w.Header().Set("Content-type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+	if v != "" && v != r.Header.Get("Last-Event-ID") {
+		if err := writeEvent(w, v); err != nil {
+			slog.Error("error writing to the updated stream", "error", err)
+			return
+		}
+	} else if err := rc.Flush(); err != nil {
+		slog.Error("error flushing the updated stream", "error", err)
+		return
+	}
+	registerMetric("updatedStream", r.Method, http.StatusOK, i)
+	t := time.NewTicker(streamKeepAlive)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-app.updates.done:
+			return
+		case v := <-ch:
+			if err := writeEvent(w, v); err != nil {
+				slog.Error("error writing to the updated stream", "error", err)
+				return
+			}
+		case <-t.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUpdatesPublish(t *testing.T) {
+	u := newUpdates()
+	u.publish("2026-09-01")
+	ch, v := u.subscribe()
+	defer u.unsubscribe(ch)
+	if v != "2026-09-01" {
+		t.Errorf("expected current version to be 2026-09-01, got %s", v)
+	}
+	u.publish("2026-09-01")
+	select {
+	case v := <-ch:
+		t.Errorf("expected no event for the same version, got %s", v)
+	default:
+	}
+	u.publish("2026-10-01")
+	u.publish("2026-11-01")
+	if v := <-ch; v != "2026-11-01" {
+		t.Errorf("expected the latest version 2026-11-01, got %s", v)
+	}
+}
+
+// flushRecorder signals every time the handler flushes the stream
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushed chan struct{}
+}
+
+func (r *flushRecorder) Flush() {
+	r.ResponseRecorder.Flush()
+	r.flushed <- struct{}{}
+}
+
+func TestUpdatedStreamHandler(t *testing.T) {
+	for _, c := range []struct {
+		desc        string
+		lastEventID string
+		expected    string
+	}{
+		{"new client", "", "id: 42\nevent: updated\ndata: 42\n\nid: 43\nevent: updated\ndata: 43\n\n"},
+		{"reconnecting client", "42", "id: 43\nevent: updated\ndata: 43\n\n"},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			app := api{db: &mockDatabase{}, updates: newUpdates()}
+			app.updates.publish("42")
+			ctx, cancel := context.WithCancel(context.Background())
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/v1/updated/stream", nil)
+			if err != nil {
+				t.Fatal("Expected an HTTP request, but got an error.")
+			}
+			if c.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", c.lastEventID)
+			}
+			resp := &flushRecorder{httptest.NewRecorder(), make(chan struct{})}
+			done := make(chan struct{})
+			go func() {
+				app.updatedStreamHandler(resp, req)
+				close(done)
+			}()
+			<-resp.flushed // handler subscribed and sent the headers
+			app.updates.publish("43")
+			<-resp.flushed
+			cancel()
+			<-done
+			if resp.Code != http.StatusOK {
+				t.Errorf("expected status 200, got %d", resp.Code)
+			}
+			if ct := resp.Header().Get("Content-type"); ct != "text/event-stream" {
+				t.Errorf("expected content-type text/event-stream, got %s", ct)
+			}
+			if got := resp.Body.String(); !strings.HasPrefix(got, c.expected) {
+				t.Errorf("expected stream to be %q, got %q", c.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/cuducos/go-cnpj"
+	"github.com/cuducos/minha-receita/db"
+)
+
+const tagsTimeout = 10 * time.Second
+
+type tagsPage struct {
+	Data []string `json:"data"`
+}
+
+// tagsHandler lists (GET /v1/cnpj/{cnpj}/tags), adds (PUT
+// /v1/cnpj/{cnpj}/tags/{tag}) and removes (DELETE /v1/cnpj/{cnpj}/tags/{tag})
+// the tags of a company. Tags belong to the API key of the request, so each
+// client has its own tags.
+func (app *api) tagsHandler(w http.ResponseWriter, r *http.Request) {
+	i := time.Now().UnixMilli()
+	t := r.PathValue("tag")
+	ms, m := []string{http.MethodGet}, "Essa URL aceita apenas o método GET."
+	if t != "" {
+		ms, m = []string{http.MethodPut, http.MethodDelete}, "Essa URL aceita apenas os métodos PUT e DELETE."
+	}
+	if !slices.Contains(ms, r.Method) {
+		app.messageResponse(w, http.StatusMethodNotAllowed, m)
+		registerMetric("tags", r.Method, http.StatusMethodNotAllowed, i)
+		return
+	}
+	c, ok := clientFrom(r.Context())
+	if !ok {
+		app.messageResponse(w, http.StatusForbidden, "Essa URL requer uma chave de API.")
+		registerMetric("tags", r.Method, http.StatusForbidden, i)
+		return
+	}
+	n := r.PathValue("cnpj")
+	if !cnpj.IsValid(n) {
+		app.messageResponse(w, http.StatusBadRequest, fmt.Sprintf("CNPJ %s inválido.", n))
+		registerMetric("tags", r.Method, http.StatusBadRequest, i)
+		return
+	}
+	if t != "" && db.ValidateTag(t) != nil {
+		app.messageResponse(w, http.StatusBadRequest, "Etiqueta inválida, use até 32 letras minúsculas, números, hífens e sublinhados.")
+		registerMetric("tags", r.Method, http.StatusBadRequest, i)
+		return
+	}
+	if _, err := app.getCompany(n, db.ProfileMinimal); err != nil {
+		app.messageResponse(w, http.StatusNotFound, app.companyNotFound(n))
+		registerMetric("tags", r.Method, http.StatusNotFound, i)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), tagsTimeout)
+	defer cancel()
+	n = cnpj.Unmask(n)
+	var err error
+	switch r.Method {
+	case http.MethodPut:
+		err = app.db.AddTag(ctx, c.key.Name, n, t)
+	case http.MethodDelete:
+		err = app.db.RemoveTag(ctx, c.key.Name, n, t)
+	case http.MethodGet:
+		var ts []string
+		ts, err = app.db.Tags(ctx, c.key.Name, n)
+		if err == nil {
+			app.tagsResponse(w, r, ts, i)
+			return
+		}
+	}
+	if err != nil {
+		slog.Error("could not handle the tags", "cnpj", n, "tag", t, "error", err)
+		app.messageResponse(w, http.StatusInternalServerError, "Erro atualizando as etiquetas.")
+		registerMetric("tags", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+	registerMetric("tags", r.Method, http.StatusNoContent, i)
+}
+
+func (app *api) tagsResponse(w http.ResponseWriter, r *http.Request, ts []string, i int64) {
+	if ts == nil {
+		ts = []string{}
+	}
+	b, err := json.Marshal(tagsPage{ts})
+	if err != nil {
+		app.messageResponse(w, http.StatusInternalServerError, "Erro serializando as etiquetas.")
+		registerMetric("tags", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		slog.Error("error responding to tags request", "error", err)
+	}
+	registerMetric("tags", r.Method, http.StatusOK, i)
+}
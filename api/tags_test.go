@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+func TestTagsHandler(t *testing.T) {
+	crm := &client{key: db.APIKey{Name: "crm"}, bucket: &bucket{}}
+	for _, c := range []struct {
+		method  string
+		path    string
+		client  *client
+		status  int
+		content string
+	}{
+		{http.MethodPost, "/v1/cnpj/19131243000197/tags", crm, http.StatusMethodNotAllowed, `{"message":"Essa URL aceita apenas o método GET."}`},
+		{http.MethodGet, "/v1/cnpj/19131243000197/tags/cliente", crm, http.StatusMethodNotAllowed, `{"message":"Essa URL aceita apenas os métodos PUT e DELETE."}`},
+		{http.MethodGet, "/v1/cnpj/19131243000197/tags", nil, http.StatusForbidden, `{"message":"Essa URL requer uma chave de API."}`},
+		{http.MethodGet, "/v1/cnpj/19131243000198/tags", crm, http.StatusBadRequest, `{"message":"CNPJ 19131243000198 inválido."}`},
+		{http.MethodPut, "/v1/cnpj/19131243000197/tags/Cliente", crm, http.StatusBadRequest, `{"message":"Etiqueta inválida, use até 32 letras minúsculas, números, hífens e sublinhados."}`},
+		{http.MethodPut, "/v1/cnpj/33683111000280/tags/cliente", crm, http.StatusNotFound, `{"message":"CNPJ 33.683.111/0002-80 não encontrado."}`},
+		{http.MethodPut, "/v1/cnpj/19131243000197/tags/cliente", crm, http.StatusNoContent, ""},
+		{http.MethodDelete, "/v1/cnpj/19131243000197/tags/cliente", crm, http.StatusNoContent, ""},
+		{http.MethodGet, "/v1/cnpj/19131243000197/tags", crm, http.StatusOK, `{"data":["cliente"]}`},
+		{http.MethodGet, "/v1/cnpj/19131243000197/tags", &client{key: db.APIKey{Name: "other"}}, http.StatusOK, `{"data":[]}`},
+	} {
+		req, err := http.NewRequest(c.method, c.path, nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		if c.client != nil {
+			req = req.WithContext(context.WithValue(req.Context(), clientContextKey{}, c.client))
+		}
+		app := api{db: &mockDatabase{}}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/v1/cnpj/{cnpj}/tags", app.tagsHandler)
+		mux.HandleFunc("/v1/cnpj/{cnpj}/tags/{tag}", app.tagsHandler)
+		resp := httptest.NewRecorder()
+		mux.ServeHTTP(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("expected %s %s to return %d, got %d", c.method, c.path, c.status, resp.Code)
+		}
+		if got := strings.TrimSpace(resp.Body.String()); got != c.content {
+			t.Errorf("expected %s, got %s", c.content, got)
+		}
+	}
+}
+
+func TestSearchByTagRequiresAPIKey(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/?tag=cliente", nil)
+	if err != nil {
+		t.Fatal("Expected an HTTP request, but got an error.")
+	}
+	app := api{db: &mockDatabase{}}
+	resp := httptest.NewRecorder()
+	app.companyHandler(resp, req)
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("expected a search by tag without an API key to return 400, got %d", resp.Code)
+	}
+	exp := `{"message":"O filtro tag requer uma chave de API."}`
+	if got := strings.TrimSpace(resp.Body.String()); got != exp {
+		t.Errorf("expected %s, got %s", exp, got)
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/cuducos/go-cnpj"
+	"github.com/cuducos/minha-receita/db"
+)
+
+// maximum number of lookups being handled at the same time for each connection
+const websocketConcurrency = 32
+
+// wsRequest asks for a company. The ID is chosen by the client and returned in
+// the response, since responses are sent as soon as they are ready (not in the
+// same order of the requests).
+type wsRequest struct {
+	ID      jsontext.Value `json:"id"`
+	CNPJ    string         `json:"cnpj"`
+	Profile string         `json:"perfil,omitempty"`
+}
+
+type wsResponse struct {
+	ID      jsontext.Value `json:"id,omitzero"`
+	Status  int            `json:"status"`
+	Data    jsontext.Value `json:"data,omitzero"`
+	Message string         `json:"message,omitempty"`
+}
+
+func (app *api) lookup(b []byte, c *client) wsResponse {
+	var req wsRequest
+	if err := json.Unmarshal(b, &req); err != nil {
+		return wsResponse{Status: http.StatusBadRequest, Message: "Mensagem inválida, envie um JSON com os campos id e cnpj."}
+	}
+	if c != nil {
+		if ok, _, _ := c.bucket.take(time.Now()); !ok {
+			return wsResponse{ID: req.ID, Status: http.StatusTooManyRequests, Message: "Limite de requisições excedido."}
+		}
+	}
+	if !cnpj.IsValid(req.CNPJ) {
+		return wsResponse{ID: req.ID, Status: http.StatusBadRequest, Message: fmt.Sprintf("CNPJ %s inválido.", req.CNPJ)}
+	}
+	p := db.ProfileFull
+	if c != nil {
+		p = c.key.Profile
+	}
+	if req.Profile != "" {
+		p = db.Profile(req.Profile)
+	}
+	p, err := db.ParseProfile(string(p))
+	if err != nil {
+		return wsResponse{ID: req.ID, Status: http.StatusBadRequest, Message: invalidProfileMessage(req.Profile)}
+	}
+	s, err := app.getCompany(req.CNPJ, p)
+	if err != nil {
+		return wsResponse{ID: req.ID, Status: http.StatusNotFound, Message: app.companyNotFound(req.CNPJ)}
+	}
+	return wsResponse{ID: req.ID, Status: http.StatusOK, Data: jsontext.Value(s)}
+}
+
+// websocketHandler allows clients to pipeline many lookups by CNPJ in a single
+// connection. Each message is handled concurrently and, when API keys are in
+// use, each one counts towards the rate limit of the key.
+func (app *api) websocketHandler(w http.ResponseWriter, r *http.Request) {
+	i := time.Now().UnixMilli()
+	if r.Method != http.MethodGet {
+		app.messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		registerMetric("websocket", r.Method, http.StatusMethodNotAllowed, i)
+		return
+	}
+	disableDeadlines(w)
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{OriginPatterns: []string{"*"}})
+	if err != nil {
+		slog.Warn("could not accept websocket connection", "error", err)
+		registerMetric("websocket", r.Method, http.StatusBadRequest, i)
+		return
+	}
+	registerMetric("websocket", r.Method, http.StatusSwitchingProtocols, i)
+	c, _ := clientFrom(r.Context())
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	var wg sync.WaitGroup
+	defer func() { // runs before cancel, so pending lookups can still respond
+		wg.Wait()
+		if err := conn.Close(websocket.StatusNormalClosure, ""); err != nil && !errors.Is(err, net.ErrClosed) {
+			slog.Debug("could not close websocket connection", "error", err)
+		}
+	}()
+	sem := make(chan struct{}, websocketConcurrency)
+	for {
+		_, b, err := conn.Read(ctx)
+		if err != nil {
+			if s := websocket.CloseStatus(err); s != websocket.StatusNormalClosure && s != websocket.StatusGoingAway {
+				slog.Debug("websocket connection closed", "error", err)
+			}
+			return
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			i := time.Now().UnixMilli()
+			resp := app.lookup(b, c)
+			registerMetric("websocketLookup", http.MethodGet, resp.Status, i)
+			out, err := json.Marshal(resp)
+			if err != nil {
+				slog.Error("could not serialize websocket response", "error", err)
+				return
+			}
+			if err := conn.Write(ctx, websocket.MessageText, out); err != nil {
+				slog.Debug("could not write websocket response", "error", err)
+				cancel()
+			}
+		}()
+	}
+}
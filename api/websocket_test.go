@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"encoding/json/v2"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/cuducos/minha-receita/db"
+)
+
+func TestWebsocketHandler(t *testing.T) {
+	app := api{db: &mockDatabase{}}
+	ts := httptest.NewServer(http.HandlerFunc(app.websocketHandler))
+	defer ts.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, ts.URL, nil)
+	if err != nil {
+		t.Fatalf("expected no error connecting, got %s", err)
+	}
+	defer conn.CloseNow()
+	reqs := map[string]int{
+		`{"id":1,"cnpj":"19.131.243/0001-97"}`: http.StatusOK,
+		`{"id":2,"cnpj":"00000000000191"}`:     http.StatusNotFound,
+		`{"id":3,"cnpj":"42"}`:                 http.StatusBadRequest,
+		`{"id":4,"cnpj":"19131243000197"}`:     http.StatusOK,
+	}
+	for r := range reqs {
+		if err := conn.Write(ctx, websocket.MessageText, []byte(r)); err != nil {
+			t.Fatalf("expected no error writing %s, got %s", r, err)
+		}
+	}
+	expected := map[int]int{1: http.StatusOK, 2: http.StatusNotFound, 3: http.StatusBadRequest, 4: http.StatusOK}
+	for range reqs {
+		_, b, err := conn.Read(ctx)
+		if err != nil {
+			t.Fatalf("expected no error reading, got %s", err)
+		}
+		var resp struct {
+			ID     int            `json:"id"`
+			Status int            `json:"status"`
+			Data   map[string]any `json:"data"`
+		}
+		if err := json.Unmarshal(b, &resp); err != nil {
+			t.Fatalf("expected no error parsing %s, got %s", string(b), err)
+		}
+		if resp.Status != expected[resp.ID] {
+			t.Errorf("expected status %d for request %d, got %d", expected[resp.ID], resp.ID, resp.Status)
+		}
+		if resp.Status == http.StatusOK && resp.Data["cnpj"] != "19131243000197" {
+			t.Errorf("expected company 19131243000197 for request %d, got %v", resp.ID, resp.Data["cnpj"])
+		}
+		delete(expected, resp.ID)
+	}
+	if len(expected) != 0 {
+		t.Errorf("expected responses for all requests, missing %v", expected)
+	}
+}
+
+func TestWebsocketLookupRateLimit(t *testing.T) {
+	app := api{db: &mockDatabase{}}
+	c := &client{bucket: newBucket(db.APIKey{Rate: 1, Burst: 1}, time.Now())}
+	req := []byte(`{"id":"a","cnpj":"19131243000197"}`)
+	if r := app.lookup(req, c); r.Status != http.StatusOK {
+		t.Errorf("expected first lookup to return 200, got %d", r.Status)
+	}
+	if r := app.lookup(req, c); r.Status != http.StatusTooManyRequests {
+		t.Errorf("expected second lookup to return 429, got %d", r.Status)
+	}
+	if r := app.lookup([]byte("forty-two"), nil); r.Status != http.StatusBadRequest {
+		t.Errorf("expected invalid message to return 400, got %d", r.Status)
+	}
+}
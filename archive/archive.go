@@ -0,0 +1,155 @@
+// Package archive keeps the raw files from the Federal Revenue in a cold
+// storage, so the database of a given month can be rebuilt later on.
+package archive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json/v2"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cuducos/minha-receita/download"
+)
+
+// DefaultStorageClass is the S3 storage class for the archived files, cheap
+// to keep and slow to retrieve.
+const DefaultStorageClass = "GLACIER"
+
+type database interface {
+	MetaSave(string, string) error
+}
+
+type storage interface {
+	ObjectKey(string) string
+	URI(string) string
+	Size(string) (int64, bool, error)
+	Upload(string, io.Reader, int64, string) error
+}
+
+type archivedFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// record is saved to the metadata table, under the key returned by KeyOf.
+type record struct {
+	Location     string         `json:"location"`
+	StorageClass string         `json:"storage_class"`
+	ArchivedAt   time.Time      `json:"archived_at"`
+	Files        []archivedFile `json:"files"`
+}
+
+// KeyOf is the metadata key for the archive of the data extracted in a month
+// (YYYY-MM).
+func KeyOf(month string) string { return "archive-" + month }
+
+// monthOf reads the month the data was extracted from the updated at file.
+func monthOf(dir string) (string, error) {
+	pth := filepath.Join(dir, download.FederalRevenueUpdatedAt)
+	b, err := os.ReadFile(pth)
+	if err != nil {
+		return "", fmt.Errorf("could not read %s (was the download completed?): %w", pth, err)
+	}
+	d, err := time.Parse("2006-01-02", strings.TrimSpace(string(b)))
+	if err != nil {
+		return "", fmt.Errorf("invalid date in %s: %w", pth, err)
+	}
+	return d.Format("2006-01"), nil
+}
+
+// filesIn lists the files to be archived: the ZIP files and the files
+// describing them.
+func filesIn(dir string) ([]string, error) {
+	ls, err := filepath.Glob(filepath.Join(dir, "*.zip"))
+	if err != nil {
+		return nil, fmt.Errorf("error listing zip files: %w", err)
+	}
+	if len(ls) == 0 {
+		return nil, fmt.Errorf("no zip files found in %s", dir)
+	}
+	for _, n := range []string{download.ChecksumsFile, download.FederalRevenueUpdatedAt} {
+		pth := filepath.Join(dir, n)
+		if _, err := os.Stat(pth); err == nil {
+			ls = append(ls, pth)
+		}
+	}
+	return ls, nil
+}
+
+// archiveFile uploads a file unless an object with the same size exists, and
+// returns its SHA-256, calculated while uploading.
+func archiveFile(s storage, key, pth, class string) (f archivedFile, err error) { // using named return so we can set it in the defer call
+	h, err := os.Open(pth)
+	if err != nil {
+		return f, fmt.Errorf("could not open %s: %w", pth, err)
+	}
+	defer func() {
+		if e := h.Close(); e != nil && err == nil {
+			err = fmt.Errorf("could not close %s: %w", pth, e)
+		}
+	}()
+	i, err := h.Stat()
+	if err != nil {
+		return f, fmt.Errorf("could not get info of %s: %w", pth, err)
+	}
+	f = archivedFile{Name: filepath.Base(pth), Size: i.Size()}
+	sum := sha256.New()
+	n, ok, err := s.Size(key)
+	if err != nil {
+		return f, err
+	}
+	if ok && n == f.Size {
+		slog.Info("Already archived, skipping", "file", f.Name, "location", s.URI(key))
+		if _, err := io.Copy(sum, h); err != nil {
+			return f, fmt.Errorf("could not read %s: %w", pth, err)
+		}
+	} else {
+		slog.Info("Archiving", "file", f.Name, "location", s.URI(key))
+		if err := s.Upload(key, io.TeeReader(h, sum), f.Size, class); err != nil {
+			return f, err
+		}
+	}
+	f.SHA256 = hex.EncodeToString(sum.Sum(nil))
+	return f, nil
+}
+
+// Archive uploads the ZIP files in dir, with their checksums, to the storage
+// s in the storage class (e.g. GLACIER, DEEP_ARCHIVE) under a directory named
+// after the month the data was extracted, and records where they are in the
+// metadata table of the database. Files already archived are skipped.
+func Archive(dir string, db database, s storage, class string) error {
+	m, err := monthOf(dir)
+	if err != nil {
+		return err
+	}
+	ls, err := filesIn(dir)
+	if err != nil {
+		return err
+	}
+	r := record{Location: s.URI(s.ObjectKey(m) + "/"), StorageClass: class}
+	for _, pth := range ls {
+		f, err := archiveFile(s, path.Join(s.ObjectKey(m), filepath.Base(pth)), pth, class)
+		if err != nil {
+			return fmt.Errorf("error archiving %s: %w", pth, err)
+		}
+		r.Files = append(r.Files, f)
+	}
+	r.ArchivedAt = time.Now().UTC()
+	b, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("could not serialize the archive record: %w", err)
+	}
+	if err := db.MetaSave(KeyOf(m), string(b)); err != nil {
+		return fmt.Errorf("could not save the archive record: %w", err)
+	}
+	slog.Info("Files archived!", "files", len(r.Files), "location", r.Location, "meta", KeyOf(m))
+	return nil
+}
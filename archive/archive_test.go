@@ -0,0 +1,103 @@
+package archive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json/v2"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/cuducos/minha-receita/download"
+)
+
+type fakeStorage struct {
+	objects map[string][]byte
+	classes map[string]string
+	uploads int
+}
+
+func (s *fakeStorage) ObjectKey(n string) string { return path.Join("raw", n) }
+func (s *fakeStorage) URI(k string) string       { return "s3://bucket/" + k }
+
+func (s *fakeStorage) Size(k string) (int64, bool, error) {
+	b, ok := s.objects[k]
+	return int64(len(b)), ok, nil
+}
+
+func (s *fakeStorage) Upload(k string, r io.Reader, _ int64, c string) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.objects[k] = b
+	s.classes[k] = c
+	s.uploads++
+	return nil
+}
+
+type fakeDB map[string]string
+
+func (db fakeDB) MetaSave(k, v string) error {
+	db[k] = v
+	return nil
+}
+
+func TestArchive(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Empresas0.zip":                  "empresas",
+		"Cnaes.zip":                      "cnaes",
+		download.FederalRevenueUpdatedAt: "2024-08-14",
+	}
+	for n, c := range files {
+		if err := os.WriteFile(filepath.Join(dir, n), []byte(c), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := fakeStorage{objects: make(map[string][]byte), classes: make(map[string]string)}
+	db := make(fakeDB)
+	for range 2 { // the second run skips the files already archived
+		if err := Archive(dir, db, &s, "DEEP_ARCHIVE"); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+	}
+	if s.uploads != 3 {
+		t.Errorf("expected 3 uploads, got %d", s.uploads)
+	}
+	if got := string(s.objects["raw/2024-08/Empresas0.zip"]); got != "empresas" {
+		t.Errorf("expected empresas to be archived, got %q", got)
+	}
+	if got := s.classes["raw/2024-08/Cnaes.zip"]; got != "DEEP_ARCHIVE" {
+		t.Errorf("expected DEEP_ARCHIVE storage class, got %s", got)
+	}
+	var r record
+	if err := json.Unmarshal([]byte(db[KeyOf("2024-08")]), &r); err != nil {
+		t.Fatalf("expected the archive record in the metadata, got %s", err)
+	}
+	if r.Location != "s3://bucket/raw/2024-08/" {
+		t.Errorf("expected location s3://bucket/raw/2024-08/, got %s", r.Location)
+	}
+	if len(r.Files) != 3 {
+		t.Errorf("expected 3 files in the record, got %d", len(r.Files))
+	}
+	h := sha256.Sum256([]byte("cnaes"))
+	for _, f := range r.Files {
+		if f.Name == "Cnaes.zip" && f.SHA256 != hex.EncodeToString(h[:]) {
+			t.Errorf("expected the sha256 of Cnaes.zip to be %x, got %s", h, f.SHA256)
+		}
+	}
+}
+
+func TestArchiveRequiresUpdatedAt(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Cnaes.zip"), []byte("cnaes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := fakeStorage{objects: make(map[string][]byte), classes: make(map[string]string)}
+	if err := Archive(dir, make(fakeDB), &s, DefaultStorageClass); err == nil {
+		t.Error("expected an error without the updated at file, got nil")
+	}
+}
@@ -0,0 +1,294 @@
+// Package bootstrap populates a fresh database from another instance of the
+// web API, using its exported NDJSON file, its dictionaries and the date of
+// its data, so new mirrors skip the download of the files of the Federal
+// Revenue and the transform.
+package bootstrap
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/cuducos/go-cnpj"
+	"github.com/cuducos/minha-receita/export"
+	"github.com/cuducos/minha-receita/transform"
+	"github.com/klauspost/compress/zstd"
+	"github.com/schollz/progressbar/v3"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultTimeout is the timeout of each request to the web API (the download
+// of the exported file has no timeout).
+const DefaultTimeout = 30 * time.Second
+
+const (
+	updatedAtLayout = "2006-01-02"
+	dictionariesDir = "dicionarios"
+)
+
+type database interface {
+	PreLoad() error
+	CreateCompanies([][]string) error
+	PostLoad() error
+	CreateExtraIndexes([]string) error
+	SaveEvents() error
+	MetaSave(string, string) error
+	MetaRead(string) (string, error)
+}
+
+type remote struct {
+	client *http.Client
+	url    string
+	key    string
+}
+
+func (r *remote) get(pth string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, r.url+pth, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request for %s: %w", pth, err)
+	}
+	if r.key != "" {
+		req.Header.Set("Authorization", "Bearer "+r.key)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not request %s%s: %w", r.url, pth, err)
+	}
+	return resp, nil
+}
+
+// getJSON decodes the response to the path in v, returning the status code
+// without decoding when it is not 200.
+func (r *remote) getJSON(pth string, v any) (int, error) {
+	resp, err := r.get(pth)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, nil
+	}
+	if err := json.UnmarshalRead(resp.Body, v); err != nil {
+		return resp.StatusCode, fmt.Errorf("could not parse the response of %s%s: %w", r.url, pth, err)
+	}
+	return resp.StatusCode, nil
+}
+
+func (r *remote) updatedAt() (string, error) {
+	var m struct {
+		Message string `json:"message"`
+	}
+	s, err := r.getJSON("/updated", &m)
+	if err != nil {
+		return "", err
+	}
+	if s != http.StatusOK {
+		return "", fmt.Errorf("could not get the date of the data from %s: status %d", r.url, s)
+	}
+	if _, err := time.Parse(updatedAtLayout, m.Message); err != nil {
+		return "", fmt.Errorf("invalid date of the data from %s: %s", r.url, m.Message)
+	}
+	return m.Message, nil
+}
+
+// dictionaries reads the dictionaries from the bundle of the web API, in the
+// format saved by the transform. It returns an empty string if the instance
+// does not have them.
+func (r *remote) dictionaries() (string, error) {
+	resp, err := r.get("/v1/bundle/meta.tar.zst")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not get the dictionaries from %s: status %d", r.url, resp.StatusCode)
+	}
+	z, err := zstd.NewReader(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("could not decompress the dictionaries from %s: %w", r.url, err)
+	}
+	defer z.Close()
+	ds := make(map[string]jsontext.Value)
+	t := tar.NewReader(z)
+	for {
+		h, err := t.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("could not read the dictionaries from %s: %w", r.url, err)
+		}
+		d, n := path.Split(h.Name)
+		if path.Clean(d) != dictionariesDir || path.Ext(n) != ".json" {
+			continue
+		}
+		b, err := io.ReadAll(t)
+		if err != nil {
+			return "", fmt.Errorf("could not read %s from %s: %w", h.Name, r.url, err)
+		}
+		ds[strings.TrimSuffix(n, ".json")] = jsontext.Value(b)
+	}
+	if len(ds) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(ds, json.Deterministic(true))
+	if err != nil {
+		return "", fmt.Errorf("could not serialize the dictionaries: %w", err)
+	}
+	return string(b), nil
+}
+
+func (r *remote) exportURL() (string, error) {
+	var e struct {
+		URL string `json:"url"`
+	}
+	s, err := r.getJSON(fmt.Sprintf("/v1/exports/%s", export.NDJSON), &e)
+	if err != nil {
+		return "", err
+	}
+	if s == http.StatusNotFound {
+		return "", fmt.Errorf("%s does not serve exported files", r.url)
+	}
+	if s != http.StatusOK || e.URL == "" {
+		return "", fmt.Errorf("could not get the url of the exported file from %s: status %d", r.url, s)
+	}
+	return e.URL, nil
+}
+
+// load saves the companies of a NDJSON in the database, in batches of size
+// companies with up to workers parallel queries. It returns the number of
+// companies saved.
+func load(d database, r io.Reader, size, workers int) (int, error) {
+	g, ctx := errgroup.WithContext(context.Background())
+	g.SetLimit(workers)
+	var n, l int
+	var b [][]string
+	flush := func() {
+		s := b
+		g.Go(func() error { return d.CreateCompanies(s) })
+		b = nil
+	}
+	br := bufio.NewReader(r)
+	for ctx.Err() == nil {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			l++
+			line = bytes.TrimSpace(line)
+		}
+		if len(line) > 0 {
+			var c struct {
+				CNPJ string `json:"cnpj"`
+			}
+			if err := json.Unmarshal(line, &c); err != nil {
+				g.Wait()
+				return n, fmt.Errorf("could not parse the company in line %d: %w", l, err)
+			}
+			if !cnpj.IsValid(c.CNPJ) {
+				g.Wait()
+				return n, fmt.Errorf("invalid cnpj %s in line %d", c.CNPJ, l)
+			}
+			b = append(b, []string{cnpj.Unmask(c.CNPJ), string(line)})
+			n++
+			if len(b) == size {
+				flush()
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			g.Wait()
+			return n, fmt.Errorf("could not read the exported file: %w", err)
+		}
+	}
+	if len(b) > 0 {
+		flush()
+	}
+	if err := g.Wait(); err != nil {
+		return n, fmt.Errorf("error saving companies: %w", err)
+	}
+	return n, nil
+}
+
+// Bootstrap loads the companies, the dictionaries and the date of the data of
+// the web API at u (authenticated with the API key k, if not empty) into an
+// empty database, saving size companies per batch with up to workers parallel
+// queries. The instance must serve its exported files (see /v1/exports).
+func Bootstrap(d database, u, k string, size, workers int, t time.Duration) error {
+	p, err := url.Parse(u)
+	if err != nil || (p.Scheme != "http" && p.Scheme != "https") || p.Host == "" {
+		return fmt.Errorf("invalid url %s, expected something like https://minhareceita.org", u)
+	}
+	if v, err := d.MetaRead("updated-at"); err == nil && v != "" {
+		return fmt.Errorf("the database already has the data from %s, bootstrap requires an empty database", v)
+	}
+	r := remote{client: &http.Client{Timeout: t}, url: strings.TrimSuffix(u, "/"), key: k}
+	v, err := r.updatedAt()
+	if err != nil {
+		return err
+	}
+	ds, err := r.dictionaries()
+	if err != nil {
+		return err
+	}
+	if ds == "" {
+		slog.Warn("The web API does not serve the dictionaries, the bundle of this instance will not be available", "url", r.url)
+	}
+	e, err := r.exportURL()
+	if err != nil {
+		return err
+	}
+	resp, err := http.Get(e) // pre-signed, so no API key
+	if err != nil {
+		return fmt.Errorf("could not download the exported file: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not download the exported file: status %d", resp.StatusCode)
+	}
+	slog.Info("Loading the companies", "from", r.url, "updated-at", v)
+	if err := d.PreLoad(); err != nil {
+		return err
+	}
+	bar := progressbar.DefaultBytes(resp.ContentLength, "Downloading companies")
+	n, err := load(d, io.TeeReader(resp.Body, bar), size, workers)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("no companies in the exported file of %s", r.url)
+	}
+	slog.Info("Companies loaded, consolidating the database…", "companies", n)
+	if err := d.PostLoad(); err != nil {
+		return err
+	}
+	slog.Info("Creating indexes…")
+	if err := d.CreateExtraIndexes(transform.ExtraIndexes()); err != nil {
+		return err
+	}
+	if err := d.MetaSave("updated-at", v); err != nil {
+		return err
+	}
+	if ds != "" {
+		if err := d.MetaSave(transform.DictionariesKey, ds); err != nil {
+			return err
+		}
+	}
+	slog.Info("Recording the changes of this load in the event log…")
+	return d.SaveEvents()
+}
@@ -0,0 +1,196 @@
+package bootstrap
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cuducos/minha-receita/transform"
+	"github.com/klauspost/compress/zstd"
+)
+
+const key = "forty-two"
+
+type memoryDatabase struct {
+	mu        sync.Mutex
+	batches   [][][]string
+	meta      map[string]string
+	indexes   []string
+	postLoad  bool
+	events    bool
+	failBatch bool
+}
+
+func newMemoryDatabase() *memoryDatabase {
+	return &memoryDatabase{meta: make(map[string]string)}
+}
+
+func (m *memoryDatabase) PreLoad() error { return nil }
+func (m *memoryDatabase) CreateCompanies(b [][]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failBatch {
+		return fmt.Errorf("forty-two")
+	}
+	m.batches = append(m.batches, b)
+	return nil
+}
+func (m *memoryDatabase) PostLoad() error { m.postLoad = true; return nil }
+func (m *memoryDatabase) CreateExtraIndexes(i []string) error {
+	m.indexes = i
+	return nil
+}
+func (m *memoryDatabase) SaveEvents() error { m.events = true; return nil }
+func (m *memoryDatabase) MetaSave(k, v string) error {
+	m.meta[k] = v
+	return nil
+}
+func (m *memoryDatabase) MetaRead(k string) (string, error) { return m.meta[k], nil }
+
+func bundle(t *testing.T) []byte {
+	var b bytes.Buffer
+	z, err := zstd.NewWriter(&b)
+	if err != nil {
+		t.Fatalf("could not create zstd writer: %s", err)
+	}
+	w := tar.NewWriter(z)
+	for n, c := range map[string]string{
+		"schema.json":             `{}`,
+		"dicionarios/cnaes.json":  `{"6204000":"Consultoria em tecnologia da informação"}`,
+		"dicionarios/paises.json": `{"105":"Brasil"}`,
+	} {
+		if err := w.WriteHeader(&tar.Header{Name: n, Mode: 0644, Size: int64(len(c))}); err != nil {
+			t.Fatalf("could not write tar header: %s", err)
+		}
+		if _, err := w.Write([]byte(c)); err != nil {
+			t.Fatalf("could not write tar file: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("could not close tar: %s", err)
+	}
+	if err := z.Close(); err != nil {
+		t.Fatalf("could not close zstd: %s", err)
+	}
+	return b.Bytes()
+}
+
+// fakeAPI serves the endpoints used by the bootstrap, requiring the API key,
+// and the exported file at a "pre-signed" URL that rejects the API key.
+func fakeAPI(t *testing.T, ndjson string, exports bool) *httptest.Server {
+	b := bundle(t)
+	var s *httptest.Server
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/storage/cnpj.ndjson" {
+			if r.Header.Get("Authorization") != "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, ndjson)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+key {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/updated":
+			fmt.Fprint(w, `{"message":"2024-08-17"}`)
+		case "/v1/bundle/meta.tar.zst":
+			w.Write(b)
+		case "/v1/exports/ndjson":
+			if !exports {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"message":"Esse servidor não disponibiliza arquivos exportados."}`)
+				return
+			}
+			fmt.Fprintf(w, `{"url":"%s/storage/cnpj.ndjson","expires_at":"2024-08-17T00:00:00Z"}`, s.URL)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func companies(n int) string {
+	var b strings.Builder
+	for i := range n {
+		fmt.Fprintf(&b, `{"cnpj":"%s","n":%d}`+"\n", []string{"19131243000197", "33.683.111/0002-80", "00000000000191"}[i%3], i)
+	}
+	return b.String()
+}
+
+func TestBootstrap(t *testing.T) {
+	s := fakeAPI(t, companies(5)+"\n", true)
+	d := newMemoryDatabase()
+	if err := Bootstrap(d, s.URL+"/", key, 2, 2, time.Second); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	var n int
+	for _, b := range d.batches {
+		if len(b) > 2 {
+			t.Errorf("expected batches up to 2 companies, got %d", len(b))
+		}
+		for _, c := range b {
+			n++
+			if len(c[0]) != 14 || !strings.Contains(c[1], `"n":`) {
+				t.Errorf("unexpected row %v", c)
+			}
+		}
+	}
+	if n != 5 {
+		t.Errorf("expected 5 companies, got %d", n)
+	}
+	if d.meta["updated-at"] != "2024-08-17" {
+		t.Errorf("expected updated-at 2024-08-17, got %s", d.meta["updated-at"])
+	}
+	expected := `{"cnaes":{"6204000":"Consultoria em tecnologia da informação"},"paises":{"105":"Brasil"}}`
+	if got := d.meta[transform.DictionariesKey]; got != expected {
+		t.Errorf("expected dictionaries %s, got %s", expected, got)
+	}
+	if !d.postLoad || !d.events || len(d.indexes) != len(transform.ExtraIndexes()) {
+		t.Errorf("expected post load, extra indexes and events, got %t, %v and %t", d.postLoad, d.indexes, d.events)
+	}
+}
+
+func TestBootstrapErrors(t *testing.T) {
+	for _, c := range []struct {
+		desc    string
+		ndjson  string
+		exports bool
+		key     string
+		setup   func(*memoryDatabase)
+	}{
+		{"no exports", companies(3), false, key, nil},
+		{"missing api key", companies(3), true, "", nil},
+		{"invalid cnpj", `{"cnpj":"42"}`, true, key, nil},
+		{"invalid json", "forty-two\n", true, key, nil},
+		{"empty export", "", true, key, nil},
+		{"database with data", companies(3), true, key, func(d *memoryDatabase) { d.meta["updated-at"] = "2024-07-13" }},
+		{"database error", companies(3), true, key, func(d *memoryDatabase) { d.failBatch = true }},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			s := fakeAPI(t, c.ndjson, c.exports)
+			d := newMemoryDatabase()
+			if c.setup != nil {
+				c.setup(d)
+			}
+			if err := Bootstrap(d, s.URL, c.key, 2, 2, time.Second); err == nil {
+				t.Error("expected an error, got nil")
+			}
+			if d.events {
+				t.Error("expected no events after an error")
+			}
+		})
+	}
+	if err := Bootstrap(newMemoryDatabase(), "minhareceita.org", key, 2, 2, time.Second); err == nil {
+		t.Error("expected an error for an url without scheme, got nil")
+	}
+}
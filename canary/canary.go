@@ -0,0 +1,122 @@
+// Package canary checks a freshly loaded database before it starts serving
+// requests: a few well known companies have to be there, with the expected
+// structure, and the number of companies has to be close to the one of the
+// previous load.
+package canary
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/cuducos/go-cnpj"
+	"github.com/cuducos/minha-receita/db"
+)
+
+// DefaultTolerance is the maximum difference in the number of companies
+// between two loads, as a share of the previous load.
+const DefaultTolerance = 0.05
+
+// key is the metadata key for the result of the last canary that passed.
+const key = "canary"
+
+// DefaultCNPJs are long lived public companies, expected in every load.
+var DefaultCNPJs = []string{
+	"00000000000191", // Banco do Brasil
+	"00360305000104", // Caixa Econômica Federal
+	"33000167000101", // Petrobras
+	"33683111000280", // Serpro
+}
+
+type database interface {
+	GetCompany(string, db.Profile) (string, error)
+	RowCounts() (map[string]int64, error)
+	MetaRead(string) (string, error)
+	MetaSave(string, string) error
+}
+
+type record struct {
+	Companies int64     `json:"companies"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// companies returns the CNPJs that are missing or fail the integrity checks.
+func companies(d database, ids []string) []string {
+	var fs []string
+	for _, id := range ids {
+		n := cnpj.Unmask(id)
+		c, err := d.GetCompany(n, db.ProfileFull)
+		if err != nil {
+			slog.Error("Canary company not found", "cnpj", cnpj.Mask(n), "error", err)
+			fs = append(fs, n)
+			continue
+		}
+		if k := db.CheckIntegrity(c); k != "" {
+			slog.Error("Canary company failed the integrity check", "cnpj", cnpj.Mask(n), "check", k)
+			fs = append(fs, n)
+		}
+	}
+	return fs
+}
+
+// count returns the number of companies in the database, and an error if it
+// differs from the last canary that passed by more than tolerance.
+func count(d database, tolerance float64) (int64, error) {
+	cs, err := d.RowCounts()
+	if err != nil {
+		return 0, fmt.Errorf("error counting companies in the database: %w", err)
+	}
+	var n int64
+	for _, c := range cs {
+		n += c
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("the database has no companies")
+	}
+	s, err := d.MetaRead(key)
+	if err != nil { // first canary in this database
+		slog.Warn("No previous canary to compare the number of companies to", "companies", n)
+		return n, nil
+	}
+	var r record
+	if err := json.Unmarshal([]byte(s), &r); err != nil {
+		return 0, fmt.Errorf("error parsing the previous canary: %w", err)
+	}
+	if r.Companies == 0 {
+		return n, nil
+	}
+	diff := float64(n-r.Companies) / float64(r.Companies)
+	if diff > tolerance || diff < -tolerance {
+		return 0, fmt.Errorf("the database has %d companies, %.2f%% away from the %d of the previous load (tolerance is %.2f%%)", n, diff*100, r.Companies, tolerance*100)
+	}
+	slog.Info("Number of companies within the tolerance", "companies", n, "previous", r.Companies, "difference", fmt.Sprintf("%.2f%%", diff*100))
+	return n, nil
+}
+
+// Canary checks that the companies with the CNPJs in ids exist and pass the
+// integrity checks, and that the number of companies differs from the last
+// canary that passed by up to tolerance (e.g. 0.05 for 5%). It returns an
+// error if any of these fail, and records the number of companies for the
+// next canary otherwise.
+func Canary(d database, ids []string, tolerance float64) error {
+	if tolerance < 0 {
+		return fmt.Errorf("invalid tolerance %f, it cannot be negative", tolerance)
+	}
+	n, err := count(d, tolerance)
+	if err != nil {
+		return fmt.Errorf("canary failed: %w", err)
+	}
+	if fs := companies(d, ids); len(fs) > 0 {
+		return fmt.Errorf("canary failed: %d of %d companies are missing or invalid", len(fs), len(ids))
+	}
+	b, err := json.Marshal(record{n, time.Now().UTC()})
+	if err != nil {
+		return fmt.Errorf("could not serialize the canary record: %w", err)
+	}
+	if err := d.MetaSave(key, string(b)); err != nil {
+		return fmt.Errorf("could not save the canary record: %w", err)
+	}
+	slog.Info("Canary passed!", "companies", n, "checked", len(ids))
+	return nil
+}
@@ -0,0 +1,84 @@
+package canary
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+type fakeDB struct {
+	companies map[string]string
+	counts    map[string]int64
+	meta      map[string]string
+}
+
+func (f *fakeDB) GetCompany(n string, _ db.Profile) (string, error) {
+	c, ok := f.companies[n]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return c, nil
+}
+
+func (f *fakeDB) RowCounts() (map[string]int64, error) { return f.counts, nil }
+
+func (f *fakeDB) MetaRead(k string) (string, error) {
+	v, ok := f.meta[k]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return v, nil
+}
+
+func (f *fakeDB) MetaSave(k, v string) error {
+	f.meta[k] = v
+	return nil
+}
+
+func TestCanary(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := string(b)
+	for _, tc := range []struct {
+		name      string
+		companies map[string]string
+		counts    map[string]int64
+		meta      map[string]string
+		ok        bool
+	}{
+		{"first load", map[string]string{"19131243000197": c}, map[string]int64{"19": 100}, map[string]string{}, true},
+		{"within tolerance", map[string]string{"19131243000197": c}, map[string]int64{"19": 96}, map[string]string{key: `{"companies":100}`}, true},
+		{"too few companies", map[string]string{"19131243000197": c}, map[string]int64{"19": 90}, map[string]string{key: `{"companies":100}`}, false},
+		{"too many companies", map[string]string{"19131243000197": c}, map[string]int64{"19": 110}, map[string]string{key: `{"companies":100}`}, false},
+		{"empty database", map[string]string{"19131243000197": c}, map[string]int64{}, map[string]string{}, false},
+		{"missing company", map[string]string{}, map[string]int64{"19": 100}, map[string]string{}, false},
+		{"invalid company", map[string]string{"19131243000197": strings.Replace(c, `"uf": "SP", `, "", 1)}, map[string]int64{"19": 100}, map[string]string{}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := &fakeDB{tc.companies, tc.counts, tc.meta}
+			prev := d.meta[key]
+			err := Canary(d, []string{"19.131.243/0001-97"}, DefaultTolerance)
+			if tc.ok && err != nil {
+				t.Errorf("expected no error, got %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Error("expected an error, got nil")
+			}
+			if tc.ok && d.meta[key] == prev {
+				t.Error("expected the canary record to be updated")
+			}
+			if !tc.ok && d.meta[key] != prev {
+				t.Errorf("expected the canary record to be kept, got %s", d.meta[key])
+			}
+		})
+	}
+	if err := Canary(&fakeDB{}, nil, -1); err == nil {
+		t.Error("expected an error for a negative tolerance, got nil")
+	}
+}
@@ -0,0 +1,182 @@
+// Package cleanup removes the intermediate files left behind by the other
+// commands, according to retention rules.
+package cleanup
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cuducos/minha-receita/download"
+	"github.com/cuducos/minha-receita/export"
+	"github.com/cuducos/minha-receita/transform"
+)
+
+// Kinds of files that can be cleaned up.
+const (
+	CSV      = "csv"     // files extracted by the unzip command
+	KeyValue = "kv"      // key-value storage of the transform
+	Exports  = "exports" // files created by the export command
+	ZIP      = "zip"     // files downloaded from the Federal Revenue
+)
+
+// Kinds lists the kinds of files that can be cleaned up.
+var Kinds = []string{CSV, KeyValue, Exports, ZIP}
+
+// Never is the retention of the kinds of files that are never removed.
+const Never = time.Duration(-1)
+
+// DefaultRetention keeps the key-value storage for a day (so a failed
+// transform can be resumed), the exports for 30 days and the downloaded files
+// forever.
+var DefaultRetention = map[string]string{
+	CSV:      "0s",
+	KeyValue: "24h",
+	Exports:  "720h",
+	ZIP:      "never",
+}
+
+// ParseRetention reads the retention of each kind of file (a duration, or
+// never), using the default retention for the kinds not in r.
+func ParseRetention(r map[string]string) (map[string]time.Duration, error) {
+	out := make(map[string]time.Duration)
+	for _, k := range Kinds {
+		v, ok := r[k]
+		if !ok {
+			v = DefaultRetention[k]
+		}
+		if v == "never" {
+			out[k] = Never
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid retention %s for %s, use a duration such as 48h or never", v, k)
+		}
+		out[k] = d
+	}
+	for k := range r {
+		if !slices.Contains(Kinds, k) {
+			return nil, fmt.Errorf("unknown kind of file %s, options are: %s", k, strings.Join(Kinds, ", "))
+		}
+	}
+	return out, nil
+}
+
+// artifact is a file or directory that can be removed.
+type artifact struct {
+	kind     string
+	path     string
+	size     int64
+	modified time.Time
+}
+
+// newArtifact sums the size of all files in the path, and uses the most recent
+// modification of them.
+func newArtifact(k, pth string) (artifact, error) {
+	a := artifact{kind: k, path: pth}
+	err := filepath.WalkDir(pth, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		i, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			a.size += i.Size()
+		}
+		if i.ModTime().After(a.modified) {
+			a.modified = i.ModTime()
+		}
+		return nil
+	})
+	if err != nil {
+		return a, fmt.Errorf("could not read %s: %w", pth, err)
+	}
+	return a, nil
+}
+
+// artifacts lists the intermediate files of the data directory dir.
+func artifacts(dir string) ([]artifact, error) {
+	ps := make(map[string][]string)
+	var err error
+	if ps[CSV], err = filepath.Glob(filepath.Join(dir, download.UnzipDir, "*")); err != nil {
+		return nil, fmt.Errorf("error listing extracted files: %w", err)
+	}
+	kv, err := transform.KeyValuePath(dir)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(kv); err == nil {
+		ps[KeyValue] = []string{kv}
+	}
+	for _, f := range export.Formats {
+		ls, err := filepath.Glob(filepath.Join(dir, fmt.Sprintf("cnpj*.%s", f)))
+		if err != nil {
+			return nil, fmt.Errorf("error listing exported files: %w", err)
+		}
+		ps[Exports] = append(ps[Exports], ls...)
+	}
+	for _, s := range export.Splits { // directories of the shards, with their manifest
+		p := filepath.Join(dir, fmt.Sprintf("cnpj-%s", s))
+		if i, err := os.Stat(p); err == nil && i.IsDir() {
+			ps[Exports] = append(ps[Exports], p)
+		}
+	}
+	if ps[ZIP], err = filepath.Glob(filepath.Join(dir, "*.zip")); err != nil {
+		return nil, fmt.Errorf("error listing zip files: %w", err)
+	}
+	var as []artifact
+	for _, k := range Kinds {
+		for _, p := range ps[k] {
+			a, err := newArtifact(k, p)
+			if err != nil {
+				return nil, err
+			}
+			as = append(as, a)
+		}
+	}
+	return as, nil
+}
+
+// Cleanup removes the intermediate files of the data directory dir older than
+// their retention r (see ParseRetention), and returns the space reclaimed. With
+// dry, it only reports what would be removed.
+func Cleanup(dir string, r map[string]time.Duration, dry bool, now time.Time) (int64, error) {
+	as, err := artifacts(dir)
+	if err != nil {
+		return 0, err
+	}
+	var t int64
+	var errs []error
+	for _, a := range as {
+		if d := r[a.kind]; d == Never || (d > 0 && now.Sub(a.modified) < d) {
+			continue
+		}
+		if dry {
+			slog.Info("Would remove", "kind", a.kind, "path", a.path, "bytes", a.size)
+			t += a.size
+			continue
+		}
+		if err := os.RemoveAll(a.path); err != nil {
+			errs = append(errs, fmt.Errorf("could not remove %s: %w", a.path, err))
+			continue
+		}
+		slog.Info("Removed", "kind", a.kind, "path", a.path, "bytes", a.size)
+		t += a.size
+	}
+	u := filepath.Join(dir, download.UnzipDir) // not needed once empty
+	if ls, err := os.ReadDir(u); !dry && err == nil && len(ls) == 0 {
+		if err := os.Remove(u); err != nil {
+			errs = append(errs, fmt.Errorf("could not remove %s: %w", u, err))
+		}
+	}
+	return t, errors.Join(errs...)
+}
@@ -0,0 +1,106 @@
+package cleanup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cuducos/minha-receita/download"
+	"github.com/cuducos/minha-receita/export"
+	"github.com/cuducos/minha-receita/transform"
+)
+
+func createFile(t *testing.T, pth string, size int, modified time.Time) {
+	if err := os.MkdirAll(filepath.Dir(pth), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pth, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(pth, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(pth string) bool {
+	_, err := os.Stat(pth)
+	return err == nil
+}
+
+func TestParseRetention(t *testing.T) {
+	r, err := ParseRetention(map[string]string{KeyValue: "1h", ZIP: "never"})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if r[KeyValue] != time.Hour || r[ZIP] != Never || r[Exports] != 720*time.Hour || r[CSV] != 0 {
+		t.Errorf("unexpected retention %v", r)
+	}
+	for _, v := range []map[string]string{{"tmp": "1h"}, {CSV: "one day"}, {CSV: "-1h"}} {
+		if _, err := ParseRetention(v); err == nil {
+			t.Errorf("expected error for %v, got nil", v)
+		}
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	old := now.Add(-60 * 24 * time.Hour)
+	csv := filepath.Join(dir, download.UnzipDir, "Empresas0", "a.csv")
+	createFile(t, csv, 10, now)
+	newExport := filepath.Join(dir, "cnpj.ndjson")
+	createFile(t, newExport, 20, now)
+	oldExport := filepath.Join(dir, "cnpj.parquet")
+	createFile(t, oldExport, 30, old)
+	oldShards := filepath.Join(dir, "cnpj-uf")
+	createFile(t, filepath.Join(oldShards, "cnpj-uf-SP.csv"), 5, old)
+	createFile(t, filepath.Join(oldShards, export.ManifestName), 1, old)
+	if err := os.Chtimes(oldShards, old, old); err != nil {
+		t.Fatal(err)
+	}
+	newShards := filepath.Join(dir, "cnpj-cnae")
+	createFile(t, filepath.Join(newShards, "cnpj-cnae-62.csv"), 5, now)
+	createFile(t, filepath.Join(newShards, export.ManifestName), 1, now)
+	zip := filepath.Join(dir, "Empresas0.zip")
+	createFile(t, zip, 40, old)
+	kv, err := transform.KeyValuePath(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(kv) })
+	createFile(t, filepath.Join(kv, "badger", "000001.sst"), 50, now)
+
+	r, err := ParseRetention(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := Cleanup(dir, r, true, now)
+	if err != nil {
+		t.Fatalf("expected no error in dry run, got %s", err)
+	}
+	if n != 46 {
+		t.Errorf("expected 46 bytes to be reclaimed in dry run, got %d", n)
+	}
+	if !exists(csv) || !exists(oldExport) || !exists(oldShards) {
+		t.Error("expected dry run not to remove files")
+	}
+
+	n, err = Cleanup(dir, r, false, now)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if n != 46 {
+		t.Errorf("expected 46 bytes to be reclaimed, got %d", n)
+	}
+	for _, p := range []string{csv, oldExport, oldShards, filepath.Join(dir, download.UnzipDir)} {
+		if exists(p) {
+			t.Errorf("expected %s to be removed", p)
+		}
+	}
+	for _, p := range []string{newExport, newShards, zip, kv} {
+		if !exists(p) {
+			t.Errorf("expected %s to be kept", p)
+		}
+	}
+}
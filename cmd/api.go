@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/cuducos/minha-receita/api"
 	"github.com/spf13/cobra"
@@ -23,15 +24,77 @@ reports to New Relic. Otherwise, the New Relic wrappers are just ignored.
 
 The HTTP server is prepared to do a host header validation against the value of
 ALLOWED_HOST environment variable. If this variable is not set, this validation
-is skipped.`
+is skipped.
+
+Every day, a random sample of companies is checked for data corruption (valid
+CNPJ check digits and the expected JSON structure). The number of failures is
+exported in the Prometheus metrics.
+
+If the EXPORTS_S3_BUCKET environment variable is set, /v1/exports/<format>
+responds with pre-signed URLs to download the exported files from the object
+storage (see the documentation for the other environment variables).
+
+The availability and the latency of GET requests are compared to service level
+objectives over a rolling window, reported at /v1/slo and in the Prometheus
+metrics. The objectives are set with SLO_AVAILABILITY_TARGET (default 0.995),
+SLO_LATENCY_TARGET (default 0.995), SLO_LATENCY_THRESHOLD (default 100ms) and
+SLO_WINDOW (default 720h) environment variables.
+
+If the SHADOW_URL environment variable is set, a share of the GET requests
+(SHADOW_PERCENT, default 100) is mirrored to that URL in the background, for
+example to validate a staging deployment under real load. The responses of the
+mirrored requests are discarded.
+
+On SIGINT or SIGTERM, the server stops accepting new connections and waits for
+the requests in flight up to --shutdown-deadline before closing the remaining
+connections. How many requests were drained or aborted, and the longest wait,
+are logged and exported in the Prometheus metrics.
+
+Responses that only change when the dataset is updated are public (so CDNs
+can cache them, unless API keys are required) with a max-age up to the
+expected date of the next monthly release of the Federal Revenue, from one
+hour (the release is due) to one week. Use --cache-max-age to set a fixed
+max-age instead (0 disables caching).
+
+Use --internal-port (or the INTERNAL_PORT environment variable) to serve
+/healthz, /updated and /metrics in a separate port, for example one reachable
+only from the internal network, so infrastructure probes and scrapers never go
+through the auth and rate limit of the public endpoints. These endpoints are
+then no longer available in the public port.
+
+Besides API keys, clients can authenticate with JWTs from an OIDC issuer: set
+OIDC_ISSUER and OIDC_AUDIENCE (and optionally OIDC_JWKS_URL, OIDC_JWKS_TTL and
+OIDC_CLAIMS_PREFIX). Claims such as minha_receita_rate, minha_receita_burst,
+minha_receita_profile and minha_receita_admin work as the options of api-keys.
+
+The middleware chain is set with the API_MIDDLEWARES environment variable, a
+comma-separated list from the outermost to the innermost middleware among
+auth, rate-limit, cache, compression and logging (default
+auth,rate-limit,cache,compression; none disables all of them).
+
+When the database holds only some shards of a split export (see export
+--split-by), declare them in the API_COVERAGE environment variable, such as
+uf:SP,RJ or cnae:62,63, so /v1/status and the not found messages tell the
+clients this instance has only part of the companies.`
+
+	defaultIntegritySample = 100
 )
 
-var port string
+var (
+	port             string
+	internalPort     string
+	integritySample  int
+	shutdownDeadline time.Duration
+	cacheMaxAge      string
+)
 
 var apiCmd = &cobra.Command{
 	Use:   "api",
 	Short: "Spins up the web API",
 	Long:  apiHelper,
+	Example: `  minha-receita api
+  minha-receita api --port 8000 --internal-port 9000
+  minha-receita api --cache-max-age 24h`,
 	RunE: func(_ *cobra.Command, _ []string) error {
 		var err error
 		if port == "" {
@@ -40,12 +103,15 @@ var apiCmd = &cobra.Command{
 		if port == "" {
 			port = defaultPort
 		}
+		if internalPort == "" {
+			internalPort = os.Getenv("INTERNAL_PORT")
+		}
 		db, err := loadDatabase()
 		if err != nil {
 			return fmt.Errorf("could not find database: %w", err)
 		}
 		defer db.Close()
-		return api.Serve(db, port)
+		return api.Serve(db, port, internalPort, integritySample, shutdownDeadline, cacheMaxAge)
 	},
 }
 
@@ -57,5 +123,30 @@ func apiCLI() *cobra.Command {
 		"",
 		fmt.Sprintf("web server port (default PORT environment variable or %s)", defaultPort),
 	)
+	apiCmd.Flags().StringVar(
+		&internalPort,
+		"internal-port",
+		"",
+		"port serving only /healthz, /updated and /metrics, which are then removed from the web server port (default INTERNAL_PORT environment variable)",
+	)
+	apiCmd.Flags().IntVarP(
+		&integritySample,
+		"integrity-sample",
+		"i",
+		defaultIntegritySample,
+		"number of random companies checked daily for data corruption (0 disables it)",
+	)
+	apiCmd.Flags().DurationVar(
+		&shutdownDeadline,
+		"shutdown-deadline",
+		api.DefaultShutdownDeadline,
+		"maximum time waiting for requests in flight on shutdown before closing the connections",
+	)
+	apiCmd.Flags().StringVar(
+		&cacheMaxAge,
+		"cache-max-age",
+		api.AutoCacheMaxAge,
+		"max-age of the cacheable responses, auto (until the next dataset update) or a duration such as 24h",
+	)
 	return apiCmd
 }
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cuducos/minha-receita/db"
+	"github.com/spf13/cobra"
+)
+
+const apiKeysHelper = `
+Manages the keys allowed to use the web API.
+
+When there are no keys in the database, the web API is open to anyone. Once
+there is at least one key, requests must send one of them in the Authorization
+header (e.g. Authorization: Bearer <key>). The web API reloads the keys every
+minute, so there is no need to restart it.
+
+Each key has its own rate limit: the number of requests per second (--rate,
+zero means no limit) and the number of requests allowed at once (--burst).
+
+Each key can also have a default response profile (--profile): minimal,
+registration or full. Requests can still choose another one using the perfil
+URL parameter.
+
+Admin keys (--admin) can also use the admin endpoints, such as the audit log.`
+
+var (
+	apiKeyRate    float64
+	apiKeyBurst   int
+	apiKeyProfile string
+	apiKeyAdmin   bool
+)
+
+var apiKeysCmd = &cobra.Command{
+	Use:   "api-keys",
+	Short: "Manages the keys allowed to use the web API",
+	Long:  apiKeysHelper,
+}
+
+var apiKeysAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Creates (or replaces) an API key and prints it",
+	Example: `  minha-receita api-keys add my-app --rate 10 --burst 20
+  minha-receita api-keys add partner --profile minimal
+  minha-receita api-keys add admin --admin`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		k, s, err := db.NewAPIKey(args[0], apiKeyRate, apiKeyBurst)
+		if err != nil {
+			return err
+		}
+		k.Profile, err = db.ParseProfile(apiKeyProfile)
+		if err != nil {
+			return err
+		}
+		k.Admin = apiKeyAdmin
+		db, err := loadDatabase()
+		if err != nil {
+			return fmt.Errorf("could not find database: %w", err)
+		}
+		defer db.Close()
+		save := func() error { return db.SaveAPIKey(k) }
+		if err := audited(db, "api-keys add", save, "name", k.Name, "rate", k.Rate, "burst", k.Burst, "profile", k.Profile, "admin", k.Admin); err != nil {
+			return err
+		}
+		fmt.Println(s)
+		return nil
+	},
+}
+
+var apiKeysListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the API keys (names, rate limits and profiles only)",
+	RunE: func(_ *cobra.Command, _ []string) error {
+		db, err := loadDatabase()
+		if err != nil {
+			return fmt.Errorf("could not find database: %w", err)
+		}
+		defer db.Close()
+		ks, err := db.APIKeys()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tRATE\tBURST\tPROFILE\tADMIN")
+		for _, k := range ks {
+			fmt.Fprintf(w, "%s\t%g\t%d\t%s\t%t\n", k.Name, k.Rate, k.Burst, k.Profile, k.Admin)
+		}
+		return w.Flush()
+	},
+}
+
+var apiKeysRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Deletes an API key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		db, err := loadDatabase()
+		if err != nil {
+			return fmt.Errorf("could not find database: %w", err)
+		}
+		defer db.Close()
+		return audited(db, "api-keys remove", func() error { return db.DeleteAPIKey(args[0]) }, "name", args[0])
+	},
+}
+
+func apiKeysCLI() *cobra.Command {
+	apiKeysAddCmd.Flags().Float64VarP(&apiKeyRate, "rate", "r", 0, "requests per second allowed for this key (0 means no limit)")
+	apiKeysAddCmd.Flags().IntVarP(&apiKeyBurst, "burst", "b", 0, "requests allowed at once for this key (default is the rate)")
+	apiKeysAddCmd.Flags().StringVarP(&apiKeyProfile, "profile", "p", string(db.ProfileFull), "default response profile for this key: "+strings.Join(db.Profiles(), ", "))
+	apiKeysAddCmd.Flags().BoolVarP(&apiKeyAdmin, "admin", "a", false, "allows this key to use the admin endpoints")
+	for _, c := range []*cobra.Command{apiKeysAddCmd, apiKeysListCmd, apiKeysRemoveCmd} {
+		apiKeysCmd.AddCommand(addDatabase(c))
+	}
+	return apiKeysCmd
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cuducos/minha-receita/archive"
+	"github.com/cuducos/minha-receita/export"
+	"github.com/spf13/cobra"
+)
+
+const archiveHelper = `
+Uploads the downloaded ZIP files to a cold storage for historical rebuilds.
+
+The files, together with checksums.json and updated_at.txt, are uploaded to a
+S3 compatible bucket, under a directory named after the month the data was
+extracted (e.g. 2024-08/), in the --storage-class (GLACIER by default). The
+location, the storage class and the SHA-256 of each file are saved to the
+metadata table of the database, under the key archive-<YYYY-MM>. Files already
+archived with the same size are skipped, so the command can be repeated after
+a failure.
+
+The bucket is configured with the environment variables ARCHIVE_S3_BUCKET,
+ARCHIVE_S3_PREFIX (optional) and ARCHIVE_S3_ENDPOINT (optional, for S3
+compatible services other than AWS), and the credentials with AWS_REGION,
+AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN (optional).`
+
+var storageClass string
+
+var archiveCmd = &cobra.Command{
+	Use:   "archive",
+	Short: "Uploads the downloaded ZIP files to a cold storage",
+	Long:  archiveHelper,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if err := assertDirExists(); err != nil {
+			return err
+		}
+		s, err := export.ObjectStorageFromEnv("ARCHIVE")
+		if err != nil {
+			return err
+		}
+		if s == nil {
+			return errors.New("the ARCHIVE_S3_BUCKET environment variable is not set")
+		}
+		db, err := loadDatabase()
+		if err != nil {
+			return fmt.Errorf("could not find database: %w", err)
+		}
+		defer db.Close()
+		return audited(db, "archive", func() error { return archive.Archive(dir, db, s, storageClass) }, "bucket", s.Bucket, "storage-class", storageClass)
+	},
+}
+
+func archiveCLI() *cobra.Command {
+	archiveCmd = addDataDir(addDatabase(archiveCmd))
+	archiveCmd.Flags().StringVarP(&storageClass, "storage-class", "c", archive.DefaultStorageClass, "S3 storage class of the archived files (e.g. GLACIER, DEEP_ARCHIVE, STANDARD_IA)")
+	return archiveCmd
+}
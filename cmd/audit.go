@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"os"
+	"os/user"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+// auditActor is who runs the command: the AUDIT_ACTOR environment variable or,
+// if it is not set, the operating system user.
+func auditActor() string {
+	if a := os.Getenv("AUDIT_ACTOR"); a != "" {
+		return a
+	}
+	u, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return u.Username
+}
+
+// audited runs a destructive command and records it in the audit table,
+// including whether it failed.
+func audited(d database, action string, f func() error, args ...any) error {
+	l, err := db.NewAuditLogger(d)
+	if err != nil {
+		return err
+	}
+	err = f()
+	r := "ok"
+	if err != nil {
+		r = err.Error()
+	}
+	l.Info(action, append(args, "actor", auditActor(), "result", r)...)
+	return err
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cuducos/minha-receita/bootstrap"
+	"github.com/cuducos/minha-receita/transform"
+	"github.com/spf13/cobra"
+)
+
+const bootstrapHelper = `
+Loads the data of another instance of the web API into an empty database.
+
+Instead of downloading the files of the Federal Revenue and running the
+transform, the companies come from the NDJSON exported by the instance given in
+--from (see /v1/exports), together with its dictionaries and the date of its
+data. The instance must serve its exported files, and the database must be
+created (see db create) and empty, or use --clean-up.
+
+Use --api-key (or the BOOTSTRAP_API_KEY environment variable) when the instance
+requires an API key.`
+
+var (
+	bootstrapFrom    string
+	bootstrapKey     string
+	bootstrapTimeout time.Duration
+)
+
+var bootstrapCmd = &cobra.Command{
+	Use:   "bootstrap",
+	Short: "Loads the data of another instance of the web API into an empty database",
+	Long:  bootstrapHelper,
+	Example: `  minha-receita bootstrap --from https://minhareceita.org
+  minha-receita bootstrap --from https://minhareceita.example.com --api-key <key> --clean-up`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if bootstrapFrom == "" {
+			return fmt.Errorf("the url of the web api is required, use --from")
+		}
+		if bootstrapKey == "" {
+			bootstrapKey = os.Getenv("BOOTSTRAP_API_KEY")
+		}
+		db, err := loadDatabase()
+		if err != nil {
+			return fmt.Errorf("could not find database: %w", err)
+		}
+		defer db.Close()
+		if cleanUp {
+			if err := audited(db, "drop", db.Drop, "schema", postgresSchema); err != nil {
+				return err
+			}
+			if err := audited(db, "create", db.Create, "schema", postgresSchema); err != nil {
+				return err
+			}
+		}
+		run := func() error {
+			return bootstrap.Bootstrap(db, bootstrapFrom, bootstrapKey, batchSize, maxParallelDBQueries, bootstrapTimeout)
+		}
+		return audited(db, "bootstrap", run, "from", bootstrapFrom)
+	},
+}
+
+func bootstrapCLI() *cobra.Command {
+	bootstrapCmd = addDatabase(bootstrapCmd)
+	bootstrapCmd.Flags().StringVarP(&bootstrapFrom, "from", "f", "", "url of the web api to load the data from (e.g. https://minhareceita.org)")
+	bootstrapCmd.Flags().StringVarP(&bootstrapKey, "api-key", "k", "", "api key for the requests (default BOOTSTRAP_API_KEY environment variable)")
+	bootstrapCmd.Flags().DurationVarP(&bootstrapTimeout, "timeout", "t", bootstrap.DefaultTimeout, "timeout for each request to the web api (not for the download of the companies)")
+	bootstrapCmd.Flags().IntVarP(&batchSize, "batch-size", "b", transform.BatchSize, "size of the batch to save to the database")
+	bootstrapCmd.Flags().IntVarP(&maxParallelDBQueries, "max-parallel-db-queries", "m", transform.MaxParallelDBQueries, "maximum parallel database queries")
+	bootstrapCmd.Flags().BoolVarP(&cleanUp, "clean-up", "c", cleanUp, "drop & recreate the database table before starting")
+	return bootstrapCmd
+}
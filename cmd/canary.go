@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/cuducos/minha-receita/canary"
+	"github.com/spf13/cobra"
+)
+
+const canaryHelper = `
+Checks a freshly loaded database before it starts serving requests.
+
+The companies with the CNPJs given as arguments (or a few long lived public
+companies, by default) have to exist and pass the integrity checks (valid CNPJ
+and the expected JSON structure), and the number of companies has to be within
+--tolerance of the number recorded by the last canary that passed in this
+database.
+
+The command exits with an error if any check fails, so deploy scripts can refuse
+to point the web API to the new database.`
+
+var canaryTolerance float64
+
+var canaryCmd = &cobra.Command{
+	Use:   "canary [cnpj …]",
+	Short: "Checks a freshly loaded database before it starts serving requests",
+	Long:  canaryHelper,
+	RunE: func(_ *cobra.Command, ids []string) error {
+		if len(ids) == 0 {
+			ids = canary.DefaultCNPJs
+		}
+		db, err := loadDatabase()
+		if err != nil {
+			return fmt.Errorf("could not find database: %w", err)
+		}
+		defer db.Close()
+		return canary.Canary(db, ids, canaryTolerance)
+	},
+}
+
+func canaryCLI() *cobra.Command {
+	canaryCmd = addDatabase(canaryCmd)
+	canaryCmd.Flags().Float64VarP(&canaryTolerance, "tolerance", "t", canary.DefaultTolerance, "maximum difference in the number of companies from the last canary, as a share of it (e.g. 0.05 for 5%)")
+	return canaryCmd
+}
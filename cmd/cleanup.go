@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cuducos/minha-receita/cleanup"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+const cleanupHelper = `
+Removes intermediate files according to retention rules.
+
+The kinds of files are:
+
+  csv      files extracted by the unzip command (default retention 0s)
+  kv       key-value storage of the transform, needed by transform --resume
+           (default retention 24h)
+  exports  cnpj.* files created by the export command in the data directory
+           (default retention 720h)
+  zip      files downloaded from the Federal Revenue (default retention never)
+
+Files modified more recently than their retention are kept, and a retention of
+never keeps them forever. For example, --retain kv=0s,zip=168h removes the
+key-value storage and the downloaded files older than a week. Use --dry-run to
+see what would be removed.`
+
+var (
+	retain map[string]string
+	dryRun bool
+)
+
+var cleanupCmd = &cobra.Command{
+	Use:   "cleanup",
+	Short: "Removes intermediate files according to retention rules",
+	Long:  cleanupHelper,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if err := assertDirExists(); err != nil {
+			return err
+		}
+		r, err := cleanup.ParseRetention(retain)
+		if err != nil {
+			return err
+		}
+		n, err := cleanup.Cleanup(dir, r, dryRun, time.Now())
+		if dryRun {
+			fmt.Printf("Would reclaim %s\n", humanize.IBytes(uint64(n)))
+		} else {
+			fmt.Printf("Reclaimed %s\n", humanize.IBytes(uint64(n)))
+		}
+		return err
+	},
+}
+
+func cleanupCLI() *cobra.Command {
+	cleanupCmd = addDataDir(cleanupCmd)
+	cleanupCmd.Flags().StringToStringVarP(&retain, "retain", "r", nil, "retention per kind of file, e.g. kv=48h,exports=never (see the defaults above)")
+	cleanupCmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "only show what would be removed")
+	return cleanupCmd
+}
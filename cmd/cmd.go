@@ -15,7 +15,9 @@ const (
 Toolbox to manage Minha Receita, including tools to handle extract, transform
 and load data, manage the PostgreSQL instance, and to spin up the web server.
 
-See --help for more details.
+Use minha-receita <command> --help for the details and examples of each
+command, and minha-receita commands for a machine-readable description of
+all of them.
 `
 )
 
@@ -44,13 +46,15 @@ var rootCmd = &cobra.Command{
 var createCmd = &cobra.Command{
 	Use:   "create",
 	Short: "Creates the required tables in the database",
+	Example: `  minha-receita db create
+  minha-receita db create --postgres-schema minhareceita`,
 	RunE: func(_ *cobra.Command, _ []string) error {
 		db, err := loadDatabase()
 		if err != nil {
 			return fmt.Errorf("could not find database: %w", err)
 		}
 		defer db.Close()
-		return db.Create()
+		return audited(db, "create", db.Create, "schema", postgresSchema)
 	},
 }
 
@@ -63,7 +67,7 @@ var dropCmd = &cobra.Command{
 			return fmt.Errorf("could not find database: %w", err)
 		}
 		defer db.Close()
-		return db.Drop()
+		return audited(db, "drop", db.Drop, "schema", postgresSchema)
 	},
 }
 
@@ -79,38 +83,67 @@ func addDatabase(c *cobra.Command) *cobra.Command {
 }
 
 var createExtraIndexesCmd = &cobra.Command{
-	Use:   "extra-indexes <index1> [index2 …]",
-	Short: "Creates extra indexes in the company fields",
-	Args:  cobra.MinimumNArgs(1),
+	Use:     "extra-indexes <index1> [index2 …]",
+	Short:   "Creates extra indexes in the company fields",
+	Example: `  minha-receita db extra-indexes natureza_juridica codigo_pais`,
+	Args:    cobra.MinimumNArgs(1),
 	RunE: func(_ *cobra.Command, idxs []string) error {
 		db, err := loadDatabase()
 		if err != nil {
 			return fmt.Errorf("could not find database: %w", err)
 		}
 		defer db.Close()
-		return db.CreateExtraIndexes(idxs)
+		return audited(db, "extra-indexes", func() error { return db.CreateExtraIndexes(idxs) }, "indexes", idxs)
 	},
 }
 
 // CLI returns the root command from Cobra CLI tool.
 func CLI() *cobra.Command {
-	for _, c := range []*cobra.Command{createCmd, dropCmd} {
-		addDatabase(c)
-	}
-	rootCmd.AddCommand(
-		apiCLI(),
+	rootCmd.AddGroup(commandGroups...)
+	rootCmd.AddCommand(grouped(
+		"pipeline",
 		downloadCLI(),
 		urlsCLI(),
+		doctorCLI(),
 		checkCLI(),
-		createCmd,
-		dropCmd,
-		createExtraIndexesCmd,
+		unzipCLI(),
+		archiveCLI(),
 		transformCLI(),
+		bootstrapCLI(),
+		cleanupCLI(),
 		sampleCLI(),
-	)
-	if os.Getenv("DEBUG") != "" {
-		rootCmd.AddCommand(addDataDir(transformNextCLI()))
-		rootCmd.AddCommand(addDataDir(cleanupTempCmd))
+		fixturesCLI(),
+	)...)
+	rootCmd.AddCommand(grouped(
+		"database",
+		dbCLI(),
+		exportCLI(),
+		crosswalkCLI(),
+		municipalitiesCLI(),
+		publishCLI(),
+	)...)
+	rootCmd.AddCommand(grouped(
+		"api",
+		apiCLI(),
+		apiKeysCLI(),
+		canaryCLI(),
+		conformanceCLI(),
+	)...)
+	for _, c := range []*cobra.Command{
+		featureFlagged(addDataDir(transformNextCLI()), "DEBUG"),
+		featureFlagged(addDataDir(cleanupTempCmd), "DEBUG"),
+	} {
+		if c.GroupID != "" && !rootCmd.ContainsGroup(c.GroupID) {
+			rootCmd.AddGroup(experimentalGroup)
+		}
+		rootCmd.AddCommand(c)
 	}
+	rootCmd.AddCommand(
+		deprecated(createCmd, "db create"),
+		deprecated(dropCmd, "db drop"),
+		deprecated(createExtraIndexesCmd, "db extra-indexes"),
+		deprecated(statsCmd, "db stats"),
+		commandsCmd,
+	)
 	return rootCmd
 }
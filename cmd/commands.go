@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const commandsHelper = `
+Prints a machine-readable description of the commands in JSON.
+
+The description lists every command (including the deprecated and the
+experimental ones) with its path, help, examples and flags, so external
+wrappers can build their interfaces without parsing the output of --help:
+
+  minha-receita commands > commands.json
+
+Deprecated commands have the command replacing them in replaced_by, and
+experimental commands have the environment variable enabling them in
+feature_flag. The format of the description is versioned in schema_version.`
+
+// commandsSchemaVersion is the version of the format of the description of
+// the commands, increased on breaking changes.
+const commandsSchemaVersion = 1
+
+const (
+	replacedByAnnotation  = "replaced_by"
+	featureFlagAnnotation = "feature_flag"
+)
+
+var commandGroups = []*cobra.Group{
+	{ID: "pipeline", Title: "Data pipeline:"},
+	{ID: "database", Title: "Database:"},
+	{ID: "api", Title: "Web API:"},
+}
+
+// experimentalGroup is only listed in the help when one of its commands is
+// enabled (see featureFlagged).
+var experimentalGroup = &cobra.Group{ID: "experimental", Title: "Experimental:"}
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manages the tables, indexes and statistics of the database",
+}
+
+// deprecated returns a hidden copy of c, under its old name, that still works
+// but warns to use the command in path (e.g. db create) instead. It expects
+// the flags of c to be already set.
+func deprecated(c *cobra.Command, path string) *cobra.Command {
+	d := &cobra.Command{
+		Use:         c.Use,
+		Short:       c.Short,
+		Long:        c.Long,
+		Args:        c.Args,
+		RunE:        c.RunE,
+		Deprecated:  fmt.Sprintf("use minha-receita %s instead", path),
+		Annotations: map[string]string{replacedByAnnotation: path},
+	}
+	d.Flags().AddFlagSet(c.Flags())
+	return d
+}
+
+// featureFlagged hides the command c unless the environment variable v is
+// set, refusing to run it in that case.
+func featureFlagged(c *cobra.Command, v string) *cobra.Command {
+	c.Annotations = map[string]string{featureFlagAnnotation: v}
+	if os.Getenv(v) != "" {
+		c.GroupID = experimentalGroup.ID
+		return c
+	}
+	c.Hidden = true
+	c.RunE = func(_ *cobra.Command, _ []string) error {
+		return fmt.Errorf("%s is experimental, set the %s environment variable to use it", c.Name(), v)
+	}
+	return c
+}
+
+func grouped(id string, cs ...*cobra.Command) []*cobra.Command {
+	for _, c := range cs {
+		c.GroupID = id
+	}
+	return cs
+}
+
+type flagDescription struct {
+	Name      string `json:"name"`
+	Shorthand string `json:"shorthand,omitempty"`
+	Type      string `json:"type"`
+	Default   string `json:"default"`
+	Usage     string `json:"usage"`
+}
+
+type commandDescription struct {
+	Path        string            `json:"path"`
+	Short       string            `json:"short"`
+	Long        string            `json:"long,omitempty"`
+	Example     string            `json:"example,omitempty"`
+	Group       string            `json:"group,omitempty"`
+	Runnable    bool              `json:"runnable"`
+	Deprecated  string            `json:"deprecated,omitempty"`
+	ReplacedBy  string            `json:"replaced_by,omitempty"`
+	FeatureFlag string            `json:"feature_flag,omitempty"`
+	Enabled     bool              `json:"enabled"`
+	Flags       []flagDescription `json:"flags"`
+}
+
+type commandsDescription struct {
+	SchemaVersion int                  `json:"schema_version"`
+	Commands      []commandDescription `json:"commands"`
+}
+
+func describeCommands(c *cobra.Command, ds []commandDescription) []commandDescription {
+	for _, s := range c.Commands() {
+		if s.Name() == "help" {
+			continue
+		}
+		d := commandDescription{
+			Path:        strings.TrimPrefix(s.CommandPath(), c.Root().Name()+" "),
+			Short:       s.Short,
+			Long:        strings.TrimSpace(s.Long),
+			Example:     s.Example,
+			Group:       s.GroupID,
+			Runnable:    s.Runnable(),
+			Deprecated:  s.Deprecated,
+			ReplacedBy:  s.Annotations[replacedByAnnotation],
+			FeatureFlag: s.Annotations[featureFlagAnnotation],
+			Flags:       []flagDescription{},
+		}
+		d.Enabled = d.FeatureFlag == "" || os.Getenv(d.FeatureFlag) != ""
+		s.Flags().VisitAll(func(f *pflag.Flag) {
+			if f.Name == "help" {
+				return
+			}
+			d.Flags = append(d.Flags, flagDescription{f.Name, f.Shorthand, f.Value.Type(), f.DefValue, f.Usage})
+		})
+		ds = append(ds, d)
+		ds = describeCommands(s, ds)
+	}
+	return ds
+}
+
+var commandsCmd = &cobra.Command{
+	Use:   "commands",
+	Short: "Prints a machine-readable description of the commands in JSON",
+	Long:  commandsHelper,
+	RunE: func(c *cobra.Command, _ []string) error {
+		d := commandsDescription{commandsSchemaVersion, describeCommands(c.Root(), nil)}
+		b, err := json.Marshal(d, json.Deterministic(true))
+		if err != nil {
+			return fmt.Errorf("could not serialize the commands: %w", err)
+		}
+		fmt.Println(string(b))
+		return nil
+	},
+}
+
+func dbCLI() *cobra.Command {
+	for _, c := range []*cobra.Command{createCmd, dropCmd} {
+		addDatabase(c)
+	}
+	dbCmd.AddCommand(createCmd, dropCmd, createExtraIndexesCmd, statsCLI())
+	return dbCmd
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cuducos/minha-receita/conformance"
+	"github.com/spf13/cobra"
+)
+
+const conformanceHelper = `
+Checks if a running instance of the web API behaves like the reference one.
+
+A battery of black-box checks runs against the URL given in --url: the status
+codes of the endpoints, the structure of the company JSON (the same integrity
+checks of the canary command), the conditional requests, the pagination and,
+with --api-key, the authentication and the rate limit headers. Checks that
+depend on the configuration of the deployment (e.g. an internal port for the
+health check) are skipped instead of failing.
+
+Use --cnpj when the deployment does not have the default company, e.g. when it
+has only the companies of a state.
+
+The command exits with an error if any check fails.`
+
+var (
+	conformanceURL     string
+	conformanceCNPJ    string
+	conformanceKey     string
+	conformanceTimeout time.Duration
+)
+
+var conformanceCmd = &cobra.Command{
+	Use:   "conformance",
+	Short: "Checks if a running instance of the web API behaves like the reference one",
+	Long:  conformanceHelper,
+	Example: `  minha-receita conformance --url https://minhareceita.org
+  minha-receita conformance --url https://minhareceita.example.com --cnpj 19131243000197 --api-key <key>`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if conformanceURL == "" {
+			return fmt.Errorf("the url of the web api is required, use --url")
+		}
+		if conformanceKey == "" {
+			conformanceKey = os.Getenv("CONFORMANCE_API_KEY")
+		}
+		rs, err := conformance.Run(conformanceURL, conformanceCNPJ, conformanceKey, conformanceTimeout)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CHECK\tRESULT\tDETAIL")
+		for _, r := range rs {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", r.Check, r.Status, r.Detail)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		return err
+	},
+}
+
+func conformanceCLI() *cobra.Command {
+	conformanceCmd.Flags().StringVarP(&conformanceURL, "url", "u", "", "url of the web api (e.g. https://minhareceita.org)")
+	conformanceCmd.Flags().StringVarP(&conformanceCNPJ, "cnpj", "c", conformance.DefaultCNPJ, "cnpj of a company expected in the deployment")
+	conformanceCmd.Flags().StringVarP(&conformanceKey, "api-key", "k", "", "api key for the requests (default CONFORMANCE_API_KEY environment variable)")
+	conformanceCmd.Flags().DurationVarP(&conformanceTimeout, "timeout", "t", conformance.DefaultTimeout, "timeout for each request")
+	return conformanceCmd
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cuducos/minha-receita/db"
+	"github.com/spf13/cobra"
+)
+
+const crosswalkHelper = `
+Manages crosswalks from other identifiers of a company (e.g. NIRE or a state
+registration) to its CNPJ, so legacy systems that only store these can use the
+web API at /v1/by/<kind>/<identifier>.
+
+The mappings are loaded from a CSV with the identifier in the first column and
+the CNPJ in the second one (punctuation is ignored in both). A first line
+without a valid CNPJ is taken as the header. The kind of identifier is a name
+chosen by the operator, such as nire or ie-sp.`
+
+var crosswalkCmd = &cobra.Command{
+	Use:   "crosswalk",
+	Short: "Manages crosswalks from other identifiers to CNPJ",
+	Long:  crosswalkHelper,
+}
+
+var crosswalkLoadCmd = &cobra.Command{
+	Use:   "load <kind> <csv>",
+	Short: "Loads (or updates) the mappings of a kind of identifier from a CSV",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(_ *cobra.Command, args []string) error {
+		k := args[0]
+		if err := db.ValidateCrosswalkKind(k); err != nil {
+			return err
+		}
+		f, err := os.Open(args[1])
+		if err != nil {
+			return fmt.Errorf("could not open %s: %w", args[1], err)
+		}
+		defer f.Close()
+		ps, err := db.ReadCrosswalk(f)
+		if err != nil {
+			return err
+		}
+		db, err := loadDatabase()
+		if err != nil {
+			return fmt.Errorf("could not find database: %w", err)
+		}
+		defer db.Close()
+		save := func() error { return db.SaveCrosswalk(k, ps) }
+		return audited(db, "crosswalk load", save, "kind", k, "identifiers", len(ps))
+	},
+}
+
+func crosswalkCLI() *cobra.Command {
+	crosswalkCmd.AddCommand(addDatabase(crosswalkLoadCmd))
+	return crosswalkCmd
+}
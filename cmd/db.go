@@ -22,13 +22,49 @@ type database interface {
 	PreLoad() error
 	CreateCompanies([][]string) error
 	PostLoad() error
+	SaveEvents() error
 	MetaSave(string, string) error
+	RowCounts() (map[string]int64, error)
 	// extra indexes
 	CreateExtraIndexes(idxs []string) error
 	// api
-	GetCompany(string) (string, error)
+	GetCompany(string, db.Profile) (string, error)
 	Search(context.Context, *db.Query) (string, error)
+	Aggregate(context.Context, *db.Query, string) ([]db.Bucket, error)
 	MetaRead(string) (string, error)
+	APIKeys() ([]db.APIKey, error)
+	Capacity(context.Context) (db.Capacity, error)
+	Stats(context.Context) (db.Stats, error)
+	Sample(context.Context, int) ([]string, error)
+	Partners(context.Context, string, int, int) (string, error)
+	CrosswalkCNPJ(context.Context, string, string) (string, error)
+	Enrichment(context.Context, string) (string, error)
+	SaveEnrichment(context.Context, string, string) (string, error)
+	AddTag(context.Context, string, string, string) error
+	RemoveTag(context.Context, string, string, string) error
+	Tags(context.Context, string, string) ([]string, error)
+	// stats
+	Largest(context.Context, int) ([]db.DocumentSize, error)
+	Bloat(context.Context) ([]db.Bloat, error)
+	Maintain(context.Context, db.Bloat) error
+	// api keys
+	SaveAPIKey(db.APIKey) error
+	DeleteAPIKey(string) error
+	// crosswalk
+	SaveCrosswalk(string, [][]string) error
+	// postgis
+	SaveMunicipalities([]db.Municipality) error
+	MunicipalityPoints(context.Context, []uint32) (map[uint32]string, error)
+	// logical replication
+	CreatePublication(context.Context) error
+	DropPublication(context.Context) error
+	Publication(context.Context) (db.Publication, error)
+	SubscriptionSQL(string) (string, error)
+	// audit
+	SaveAuditEntry(db.AuditEntry) error
+	AuditEntries(context.Context, int) ([]db.AuditEntry, error)
+	// event log
+	Events(context.Context, string) ([]db.Event, error)
 }
 
 func loadDatabase() (database, error) {
@@ -41,6 +77,30 @@ func loadDatabase() (database, error) {
 	if u == "" {
 		return nil, fmt.Errorf("could not find a database URI, set the DATABASE_URL environment variable with the credentials for a database")
 	}
+	return loadDatabaseFrom(u)
+}
+
+// loadOtherDatabases connects to the databases of --also-load-to.
+func loadOtherDatabases() ([]database, error) {
+	var ds []database
+	for _, u := range alsoLoadTo {
+		d, err := loadDatabaseFrom(u)
+		if err != nil {
+			closeDatabases(ds)
+			return nil, fmt.Errorf("could not connect to the database from --also-load-to: %w", err)
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
+
+func closeDatabases(ds []database) {
+	for _, d := range ds {
+		d.Close()
+	}
+}
+
+func loadDatabaseFrom(u string) (database, error) {
 	if strings.HasPrefix(u, "postgres://") || strings.HasPrefix(u, "postgresql://") {
 		db, err := db.NewPostgreSQL(u, postgresSchema)
 		return &db, err
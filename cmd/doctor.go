@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cuducos/minha-receita/download"
+	"github.com/spf13/cobra"
+)
+
+const doctorHelper = `
+Checks how to connect to the servers used by the download command.
+
+Each server is requested with every combination of IP version (IPv4 and IPv6)
+and TLS version (1.2 and 1.3), besides the default one (auto), so you can tell
+which combinations work from your network. When the default one fails, the
+command suggests a --host-network for the download command.`
+
+var doctorTimeout string
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Checks how to connect to the servers used by the download command",
+	Long:  doctorHelper,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		t, err := time.ParseDuration(doctorTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid --timeout %s: %w", doctorTimeout, err)
+		}
+		ds := download.Diagnose(download.DiagnosticURLs, t)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "URL\tNETWORK\tRESULT\tTIME")
+		for _, d := range ds {
+			r := d.Status
+			if d.Error != nil {
+				r = d.Error.Error()
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", d.URL, d.Network, r, d.Duration.Round(time.Millisecond))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Println()
+		for _, u := range download.DiagnosticURLs {
+			fmt.Println(diagnosis(u, ds))
+		}
+		return nil
+	},
+}
+
+// diagnosis summarizes the results for a URL, suggesting the fastest network
+// that worked when the default one did not.
+func diagnosis(u string, ds []download.Diagnosis) string {
+	h := u
+	if p, err := url.Parse(u); err == nil {
+		h = p.Hostname()
+	}
+	var ok []download.Diagnosis
+	for _, d := range ds {
+		if d.URL != u || d.Error != nil {
+			continue
+		}
+		if d.Network == download.AutoNetwork {
+			return fmt.Sprintf("%s: the default network works", h)
+		}
+		ok = append(ok, d)
+	}
+	if len(ok) == 0 {
+		return fmt.Sprintf("%s: could not connect with any network", h)
+	}
+	f := slices.MinFunc(ok, func(a, b download.Diagnosis) int { return cmp.Compare(a.Duration, b.Duration) })
+	return fmt.Sprintf("%s: the default network fails, use --host-network %s=%s", h, h, f.Network)
+}
+
+func doctorCLI() *cobra.Command {
+	doctorCmd.Flags().StringVarP(&doctorTimeout, "timeout", "t", "15s", "timeout for each request")
+	return doctorCmd
+}
@@ -1,9 +1,15 @@
 package cmd
 
 import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/cuducos/minha-receita/download"
+	"github.com/cuducos/minha-receita/warnings"
 	"github.com/spf13/cobra"
 )
 
@@ -14,13 +20,74 @@ Downloads the required ZIP and Excel files.
 The main files are downloaded from the official website of the Brazilian
 Federal Revenue. An extra CSV file is downloaded from IBGE. Since the server
 might be slow, all files are downloaded using multiple HTTP requests with
-small content ranges.`
+small content ranges.
+
+Interrupted downloads are resumed from where they stopped (unless --restart is
+used). The size and SHA-256 of each completed file is recorded in
+checksums.json, so --skip can tell complete files from partial ones (files
+without a recorded checksum are downloaded again), and the check command can
+detect corrupted files. The download does not use the database, so these
+checksums are copied to its meta table by the transform.
+
+The index pages listing the files are cached for --index-cache-ttl (use 0 to
+disable the cache) in the user cache directory. After that, they are requested
+again with a conditional GET, and if the server fails the cached ones are
+used.
+
+Use --rate to limit the requests to the Federal Revenue server (requests per
+second, with bursts of up to --burst requests). The limit is shared by all
+files and parallel downloads of the command, and avoids the server banning the
+IP mid-run. Mirrors are not limited.
+
+The official servers have flaky IPv6 routes and TLS handshakes. Requests that
+fail to connect are tried again with IPv4, IPv6 and TLS 1.2, and the
+combination that worked is used for the next requests to the same server. Use
+--network to choose one (e.g. ipv4/tls1.2), or --host-network to choose one
+for a single server (e.g. arquivos.receitafederal.gov.br=ipv4). The doctor
+command shows which combinations work from your network.
+
+The Federal Revenue files are listed by the --source provider:
+
+  index     scrapes the index pages of the Federal Revenue server (default),
+            or of the server at --source-location
+  manifest  reads a JSON file (path or URL at --source-location) such as
+            {"updated_at": "2024-08-17", "urls": ["https://…/Empresas0.zip"]}
+  s3        lists the ZIP files of a public bucket at --source-location
+            (s3://bucket/prefix), using AWS_REGION and AWS_ENDPOINT_URL_S3
+
+Use --only to download just some types of files (e.g. --only
+empresas,estabelecimentos to skip the partners). The lookup tables are always
+downloaded, and the selection is recorded in only.txt so the transform skips
+the sources that were not downloaded. The transform requires estabelecimentos.
+
+Non-fatal problems (e.g. failed downloads or index pages served from a stale
+cache) are summarized at the end and saved to warnings.json, so the transform
+includes them in its own report.`
 
 	urlsHelper = `
 Shows the URLs of the required ZIP and CSV files.
 
 The main files are downloaded from the official website of the Brazilian
-Federal Revenue. An extra CSV file is downloaded from the National Treasure.`
+Federal Revenue. An extra CSV file is downloaded from the National Treasure.
+
+The index pages listing the files are cached as in the download command, and
+the age of the cached pages is logged. The --source, --source-location,
+--only, --rate, --burst, --network and --host-network flags work as in the
+download command.`
+
+	unzipHelper = `
+Extracts the downloaded ZIP files.
+
+Each ZIP file is extracted to its own directory in csv/ within the data
+directory, with --parallel files extracted at the same time. Files bigger than
+--max-size, with suspicious compression ratios (zip bombs) or with paths
+outside the output directory are refused, and the CRC of each file is
+validated. Failed extractions leave no partial files behind, and files already
+extracted are skipped.
+
+The transform reads the ZIP files directly, so this is only needed to use the
+CSV files with other tools. Use download --unzip to extract the files right
+after the download.`
 
 	checkHelper = `
 Checks the integrity of the downloaded ZIP files.
@@ -38,12 +105,58 @@ var (
 	skipExistingFiles bool
 	restart           bool
 	deleteZipFiles    bool
+	mirrors           []string
+	indexCacheTTL     string
+	source            string
+	sourceLocation    string
+	only              []string
+	unzipAfter        bool
+	parallelUnzip     int
+	maxUnzippedSize   int64
+	requestRate       float64
+	requestBurst      int
+	networkName       string
+	hostNetworks      []string
 )
 
+// useIndexCache enables the cache of the index pages of the Federal Revenue
+// server in the user cache directory.
+func useIndexCache() error {
+	ttl, err := time.ParseDuration(indexCacheTTL)
+	if err != nil {
+		return fmt.Errorf("invalid --index-cache-ttl %s: %w", indexCacheTTL, err)
+	}
+	d, err := os.UserCacheDir()
+	if err != nil {
+		slog.Warn("could not find the user cache directory, index pages will not be cached", "error", err)
+		return nil
+	}
+	download.UseIndexCache(filepath.Join(d, "minha-receita", "index"), ttl)
+	return nil
+}
+
+// useNetwork sets how to connect to the servers from --network and
+// --host-network.
+func useNetwork() error {
+	n, err := download.ParseNetwork(networkName)
+	if err != nil {
+		return fmt.Errorf("invalid --network: %w", err)
+	}
+	hs, err := download.ParseHostNetworks(hostNetworks)
+	if err != nil {
+		return fmt.Errorf("invalid --host-network: %w", err)
+	}
+	download.UseNetwork(n, hs)
+	return nil
+}
+
 var downloadCmd = &cobra.Command{
 	Use:   "download",
 	Short: "Downloads the required ZIP and Excel files",
 	Long:  downloadHelper,
+	Example: `  minha-receita download
+  minha-receita download --skip --parallel 4
+  minha-receita download --mirror https://mirror.example.com/dados`,
 	RunE: func(_ *cobra.Command, _ []string) error {
 		if err := assertDirExists(); err != nil {
 			return err
@@ -52,7 +165,32 @@ var downloadCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		return download.Download(dir, dur, skipExistingFiles, restart, parallelDownloads, downloadRetries, chunkSize)
+		if err := useIndexCache(); err != nil {
+			return err
+		}
+		download.UseRequestBudget(requestRate, requestBurst)
+		if err := useNetwork(); err != nil {
+			return err
+		}
+		if err := download.ValidateFileTypes(only); err != nil {
+			return err
+		}
+		p, err := download.NewProvider(source, sourceLocation, mirrors)
+		if err != nil {
+			return err
+		}
+		defer warnings.Log()
+		err = download.Download(dir, p, only, dur, skipExistingFiles, restart, parallelDownloads, downloadRetries, chunkSize, mirrors)
+		if e := warnings.Save(dir); e != nil {
+			slog.Warn("could not save the warnings of the download", "error", e)
+		}
+		if err != nil {
+			return err
+		}
+		if unzipAfter {
+			return download.Unzip(dir, parallelUnzip, maxUnzippedSize)
+		}
+		return nil
 	},
 }
 
@@ -66,7 +204,33 @@ var urlsCmd = &cobra.Command{
 				return err
 			}
 		}
-		return download.URLs(dir, skipExistingFiles)
+		if err := useIndexCache(); err != nil {
+			return err
+		}
+		download.UseRequestBudget(requestRate, requestBurst)
+		if err := useNetwork(); err != nil {
+			return err
+		}
+		if err := download.ValidateFileTypes(only); err != nil {
+			return err
+		}
+		p, err := download.NewProvider(source, sourceLocation, nil)
+		if err != nil {
+			return err
+		}
+		return download.URLs(dir, p, only, skipExistingFiles)
+	},
+}
+
+var unzipCmd = &cobra.Command{
+	Use:   "unzip",
+	Short: "Extracts the downloaded ZIP files",
+	Long:  unzipHelper,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if err := assertDirExists(); err != nil {
+			return err
+		}
+		return download.Unzip(dir, parallelUnzip, maxUnzippedSize)
 	},
 }
 
@@ -90,12 +254,39 @@ func downloadCLI() *cobra.Command {
 	downloadCmd.Flags().IntVarP(&parallelDownloads, "parallel", "p", download.DefaultMaxParallel, "maximum parallel downloads")
 	downloadCmd.Flags().Int64VarP(&chunkSize, "chunk-size", "c", download.DefaultChunkSize, "max length of the bytes range for each HTTP request")
 	downloadCmd.Flags().BoolVarP(&restart, "restart", "e", false, "restart all downloads from the beginning")
+	downloadCmd.Flags().StringSliceVarP(&mirrors, "mirror", "m", nil, "base URL of a mirror of the Federal Revenue server, tried in order for the files that fail (can be used multiple times)")
+	downloadCmd.Flags().StringVarP(&indexCacheTTL, "index-cache-ttl", "i", download.DefaultIndexCacheTTL.String(), "how long the index pages listing the files are cached (0 disables the cache)")
+	downloadCmd.Flags().StringVarP(&source, "source", "s", download.IndexProvider, fmt.Sprintf("provider listing the Federal Revenue files (%s)", strings.Join(download.Providers(), ", ")))
+	downloadCmd.Flags().StringVarP(&sourceLocation, "source-location", "l", "", "base URL, manifest path or URL, or s3://bucket/prefix, depending on --source")
+	downloadCmd.Flags().StringSliceVarP(&only, "only", "o", nil, fmt.Sprintf("download only these types of files (%s), plus the lookup tables", strings.Join(download.FileTypes, ", ")))
+	downloadCmd.Flags().Float64Var(&requestRate, "rate", 0, "maximum requests per second to the Federal Revenue server, shared by all downloads (0 means no limit)")
+	downloadCmd.Flags().IntVar(&requestBurst, "burst", download.DefaultRequestBurst, "maximum requests at once to the Federal Revenue server when using --rate")
+	downloadCmd.Flags().StringVar(&networkName, "network", download.AutoNetwork.String(), "IP and TLS versions to connect to the servers, such as ipv4/tls1.2 (auto falls back to the others when the connection fails)")
+	downloadCmd.Flags().StringSliceVar(&hostNetworks, "host-network", nil, "IP and TLS versions for a single server, such as arquivos.receitafederal.gov.br=ipv4 (can be used multiple times)")
+	downloadCmd.Flags().BoolVarP(&unzipAfter, "unzip", "z", false, "extract the ZIP files after the download (see the unzip command)")
+	downloadCmd.Flags().IntVar(&parallelUnzip, "parallel-unzip", download.DefaultMaxParallelUnzip, "maximum files extracted at the same time with --unzip")
+	downloadCmd.Flags().Int64Var(&maxUnzippedSize, "max-size", download.DefaultMaxUnzippedSize, "maximum size in bytes of each extracted file with --unzip")
 	return downloadCmd
 }
 
+func unzipCLI() *cobra.Command {
+	unzipCmd = addDataDir(unzipCmd)
+	unzipCmd.Flags().IntVarP(&parallelUnzip, "parallel", "p", download.DefaultMaxParallelUnzip, "maximum files extracted at the same time")
+	unzipCmd.Flags().Int64Var(&maxUnzippedSize, "max-size", download.DefaultMaxUnzippedSize, "maximum size in bytes of each extracted file")
+	return unzipCmd
+}
+
 func urlsCLI() *cobra.Command {
 	urlsCmd.Flags().StringVarP(&dir, "directory", "d", defaultDataDir, "directory of the downloaded files, used only with --skip")
 	urlsCmd.Flags().BoolVarP(&skipExistingFiles, "skip", "x", false, "skip the download of existing files")
+	urlsCmd.Flags().StringVarP(&indexCacheTTL, "index-cache-ttl", "i", download.DefaultIndexCacheTTL.String(), "how long the index pages listing the files are cached (0 disables the cache)")
+	urlsCmd.Flags().StringVarP(&source, "source", "s", download.IndexProvider, fmt.Sprintf("provider listing the Federal Revenue files (%s)", strings.Join(download.Providers(), ", ")))
+	urlsCmd.Flags().StringVarP(&sourceLocation, "source-location", "l", "", "base URL, manifest path or URL, or s3://bucket/prefix, depending on --source")
+	urlsCmd.Flags().StringSliceVarP(&only, "only", "o", nil, fmt.Sprintf("download only these types of files (%s), plus the lookup tables", strings.Join(download.FileTypes, ", ")))
+	urlsCmd.Flags().Float64Var(&requestRate, "rate", 0, "maximum requests per second to the Federal Revenue server, shared by all downloads (0 means no limit)")
+	urlsCmd.Flags().IntVar(&requestBurst, "burst", download.DefaultRequestBurst, "maximum requests at once to the Federal Revenue server when using --rate")
+	urlsCmd.Flags().StringVar(&networkName, "network", download.AutoNetwork.String(), "IP and TLS versions to connect to the servers, such as ipv4/tls1.2 (auto falls back to the others when the connection fails)")
+	urlsCmd.Flags().StringSliceVar(&hostNetworks, "host-network", nil, "IP and TLS versions for a single server, such as arquivos.receitafederal.gov.br=ipv4 (can be used multiple times)")
 	return urlsCmd
 }
 
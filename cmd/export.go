@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/cuducos/minha-receita/db"
+	"github.com/cuducos/minha-receita/export"
+	"github.com/spf13/cobra"
+)
+
+const exportHelper = `
+Exports the companies from the database to a file.
+
+The whole dataset is exported by default, but a subset can be exported using
+the --query option with the same parameters accepted by the paginated search
+of the web API, for example: --query "uf=SP&cnae_fiscal=6204000".
+
+Supported formats are NDJSON (one company JSON per line), CSV, Parquet and
+XLSX (Excel). In CSV, Parquet and XLSX the nested fields (qsa,
+cnaes_secundarios and regime_tributario) are kept as JSON. XLSX files are
+limited to 1,048,575 companies (the limit of rows of Excel), so use it with a
+--query.
+
+Use --split-by to write one file per shard instead of a single file, so each
+consumer (e.g. state-level agencies) can load only its slice: uf writes one
+file per state (e.g. cnpj-uf-SP.csv) and cnae one file per division of the
+CNAE fiscal, its first two digits (e.g. cnpj-cnae-62.csv). Companies without
+the field go to the outros shard. In this case --output is a directory, and a
+manifest.json lists the files with the number of companies, the size and the
+SHA-256 checksum of each one, as well as the date of the dataset.`
+
+var (
+	exportFormat   string
+	exportOutput   string
+	exportQuery    string
+	exportPageSize int
+	exportWorkers  int
+	exportSplitBy  string
+)
+
+// queryFromFlag parses a search query in the same format as the paginated
+// search of the web API, returning nil for an empty query.
+func queryFromFlag(s string) (*db.Query, error) {
+	if s == "" {
+		return nil, nil
+	}
+	v, err := url.ParseQuery(strings.TrimPrefix(s, "?"))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse query %s: %w", s, err)
+	}
+	q, err := db.NewQuery(v)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse query %s: %w", s, err)
+	}
+	if q == nil {
+		return nil, fmt.Errorf("query %s has no valid search parameter", s)
+	}
+	return q, nil
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Exports the companies from the database to a NDJSON, CSV or Parquet file",
+	Long:  exportHelper,
+	Example: `  minha-receita export --format parquet
+  minha-receita export --query 'uf=SP&cnae_fiscal=6204000' --output sp.ndjson
+  minha-receita export --split-by uf`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		f, err := export.ParseFormat(exportFormat)
+		if err != nil {
+			return err
+		}
+		q, err := queryFromFlag(exportQuery)
+		if err != nil {
+			return err
+		}
+		var split export.Split
+		if exportSplitBy != "" {
+			split, err = export.ParseSplit(exportSplitBy)
+			if err != nil {
+				return err
+			}
+		}
+		if exportOutput == "" {
+			exportOutput = filepath.Join(defaultDataDir, fmt.Sprintf("cnpj.%s", f))
+			if split != "" {
+				exportOutput = filepath.Join(defaultDataDir, fmt.Sprintf("cnpj-%s", split))
+			}
+		}
+		db, err := loadDatabase()
+		if err != nil {
+			return fmt.Errorf("could not find database: %w", err)
+		}
+		defer db.Close()
+		if split != "" {
+			return export.ExportShards(db, q, exportOutput, f, split, exportPageSize, exportWorkers)
+		}
+		return export.Export(db, q, exportOutput, f, exportPageSize, exportWorkers)
+	},
+}
+
+func exportCLI() *cobra.Command {
+	exportCmd = addDatabase(exportCmd)
+	exportCmd.Flags().StringVarP(&exportFormat, "format", "f", string(export.NDJSON), "output format (ndjson, csv, parquet or xlsx)")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", fmt.Sprintf("output file, or directory with --split-by (default %s or %s)", filepath.Join(defaultDataDir, "cnpj.<format>"), filepath.Join(defaultDataDir, "cnpj-<split>")))
+	exportCmd.Flags().StringVarP(&exportQuery, "query", "q", "", "export only companies matching this search query (e.g. uf=SP&cnae=6204000)")
+	exportCmd.Flags().StringVar(&exportSplitBy, "split-by", "", "write one file per shard, by uf or cnae (division of the cnae fiscal)")
+	exportCmd.Flags().IntVarP(&exportPageSize, "page-size", "b", export.DefaultPageSize, "number of companies read from the database per query")
+	exportCmd.Flags().IntVarP(&exportWorkers, "workers", "w", export.DefaultWorkers, "number of parallel workers encoding the output")
+	return exportCmd
+}
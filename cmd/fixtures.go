@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/cuducos/minha-receita/fixtures"
+	"github.com/spf13/cobra"
+)
+
+const fixturesHelper = `
+Creates test fixtures from companies in the database.
+
+Developer tool to keep the tests representative of the quirks of the real data.
+Each company is written to a JSON file named after its CNPJ, in the same format
+as testdata/response.json. Companies are picked by their CNPJ (arguments), or
+by a --query with the same parameters accepted by the paginated search of the
+web API, or at random.
+
+With --anonymize, names, contacts and addresses of the company and of its
+partners are replaced by fictional ones, keeping codes, dates and the shape of
+the data.`
+
+var (
+	fixturesOutput    string
+	fixturesQuery     string
+	fixturesLimit     int
+	fixturesAnonymize bool
+)
+
+var fixturesCmd = &cobra.Command{
+	Use:   "fixtures [cnpj …]",
+	Short: "Creates test fixtures from companies in the database",
+	Long:  fixturesHelper,
+	RunE: func(_ *cobra.Command, ids []string) error {
+		if len(ids) > 0 && fixturesQuery != "" {
+			return fmt.Errorf("use either cnpj arguments or --query")
+		}
+		q, err := queryFromFlag(fixturesQuery)
+		if err != nil {
+			return err
+		}
+		db, err := loadDatabase()
+		if err != nil {
+			return fmt.Errorf("could not find database: %w", err)
+		}
+		defer db.Close()
+		return fixtures.Fixtures(db, ids, q, fixturesLimit, fixturesOutput, fixturesAnonymize)
+	},
+}
+
+func fixturesCLI() *cobra.Command {
+	fixturesCmd = addDatabase(fixturesCmd)
+	fixturesCmd.Flags().StringVarP(&fixturesOutput, "output", "o", filepath.Join("testdata", "fixtures"), "directory for the fixtures")
+	fixturesCmd.Flags().StringVarP(&fixturesQuery, "query", "q", "", "pick companies matching this search query (e.g. uf=SP&cnae=6204000)")
+	fixturesCmd.Flags().IntVarP(&fixturesLimit, "limit", "l", fixtures.DefaultLimit, "number of companies picked by --query or at random")
+	fixturesCmd.Flags().BoolVarP(&fixturesAnonymize, "anonymize", "a", false, "replace names, contacts and addresses by fictional ones")
+	return fixturesCmd
+}
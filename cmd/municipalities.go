@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/cuducos/minha-receita/db"
+	"github.com/cuducos/minha-receita/download"
+	"github.com/spf13/cobra"
+)
+
+const municipalitiesHelper = `
+Manages the geometries of the municipalities, enabling the PostGIS mode of the
+web API: the search filter polygon (companies in the municipalities
+intersecting a GeoJSON polygon) and the format geojson (companies placed at a
+point inside their municipalities). It requires PostgreSQL with the PostGIS
+extension installed (CREATE EXTENSION postgis).
+
+The geometries are loaded from a GeoJSON FeatureCollection with the IBGE code of
+each municipality in the codarea (IBGE API) or CD_MUN (Malha Municipal
+shapefiles converted to GeoJSON) property. Without a file or URL, they are
+downloaded from the IBGE API. The web API checks for PostGIS when it starts.`
+
+var municipalitiesCmd = &cobra.Command{
+	Use:   "municipalities",
+	Short: "Manages the geometries of the municipalities (PostGIS mode)",
+	Long:  municipalitiesHelper,
+}
+
+var municipalitiesLoadCmd = &cobra.Command{
+	Use:   "load [geojson]",
+	Short: "Loads (or updates) the geometries of the municipalities from a GeoJSON file or URL",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		src := download.MunicipalitiesURL
+		if len(args) > 0 {
+			src = args[0]
+		}
+		b, err := download.Municipalities(src)
+		if err != nil {
+			return err
+		}
+		ms, err := db.ReadMunicipalities(b)
+		if err != nil {
+			return err
+		}
+		db, err := loadDatabase()
+		if err != nil {
+			return fmt.Errorf("could not find database: %w", err)
+		}
+		defer db.Close()
+		save := func() error { return db.SaveMunicipalities(ms) }
+		return audited(db, "municipalities load", save, "source", src, "municipalities", len(ms))
+	},
+}
+
+func municipalitiesCLI() *cobra.Command {
+	municipalitiesCmd.AddCommand(addDatabase(municipalitiesLoadCmd))
+	return municipalitiesCmd
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+const publishHelper = `
+Manages the PostgreSQL logical replication of the data, so downstream
+PostgreSQL databases can subscribe natively instead of consuming the web API.
+
+The publication includes the companies and the metadata tables, and requires
+wal_level = logical in the PostgreSQL configuration. Once the tables are
+published, the transform writes the companies to the WAL (instead of using an
+unlogged table while loading), which makes it slower but sends every change to
+the subscribers.
+
+Dropping the tables (db drop) also removes them from the publication, and
+creating them again (db create) adds them back. In this case subscribers must
+truncate their tables and refresh the subscription (ALTER SUBSCRIPTION …
+REFRESH PUBLICATION) to copy the new data.
+
+This is only available for PostgreSQL.`
+
+const publishSubscriberHelper = `
+Prints the SQL to run in the downstream PostgreSQL database to subscribe to
+the publication: it creates the same schema and tables, and a subscription
+connecting to this database.
+
+By default the subscription connects using the same URI as this command
+(--database-uri or DATABASE_URL). Use --publisher-uri when the subscriber
+reaches this database through another host or credentials.`
+
+var publisherURI string
+
+var publishCmd = &cobra.Command{
+	Use:   "publish",
+	Short: "Manages the PostgreSQL logical replication of the data",
+	Long:  publishHelper,
+}
+
+var publishCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Publishes the tables for logical replication",
+	RunE: func(_ *cobra.Command, _ []string) error {
+		db, err := loadDatabase()
+		if err != nil {
+			return fmt.Errorf("could not find database: %w", err)
+		}
+		defer db.Close()
+		create := func() error { return db.CreatePublication(context.Background()) }
+		return audited(db, "publish create", create, "schema", postgresSchema)
+	},
+}
+
+var publishDropCmd = &cobra.Command{
+	Use:   "drop",
+	Short: "Removes the publication, subscribers stop receiving changes",
+	RunE: func(_ *cobra.Command, _ []string) error {
+		db, err := loadDatabase()
+		if err != nil {
+			return fmt.Errorf("could not find database: %w", err)
+		}
+		defer db.Close()
+		drop := func() error { return db.DropPublication(context.Background()) }
+		return audited(db, "publish drop", drop, "schema", postgresSchema)
+	},
+}
+
+var publishStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Shows the published tables and the replication slots of the subscribers",
+	RunE: func(_ *cobra.Command, _ []string) error {
+		db, err := loadDatabase()
+		if err != nil {
+			return fmt.Errorf("could not find database: %w", err)
+		}
+		defer db.Close()
+		p, err := db.Publication(context.Background())
+		if err != nil {
+			return err
+		}
+		if !p.Exists {
+			fmt.Printf("Publication %s does not exist, create it with: publish create\n", p.Name)
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "Publication\t%s\n", p.Name)
+		for _, t := range p.Tables {
+			fmt.Fprintf(w, "Table\t%s\n", t)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if len(p.Slots) == 0 {
+			return nil
+		}
+		fmt.Println()
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SLOT\tACTIVE\tLAG")
+		for _, s := range p.Slots {
+			fmt.Fprintf(w, "%s\t%t\t%s\n", s.Name, s.Active, humanize.IBytes(uint64(s.Lag)))
+		}
+		return w.Flush()
+	},
+}
+
+var publishSubscriberCmd = &cobra.Command{
+	Use:   "subscriber",
+	Short: "Prints the SQL to subscribe to the publication from another database",
+	Long:  publishSubscriberHelper,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		u := publisherURI
+		if u == "" {
+			u = databaseURI
+		}
+		if u == "" {
+			u = os.Getenv("DATABASE_URL")
+		}
+		db, err := loadDatabase()
+		if err != nil {
+			return fmt.Errorf("could not find database: %w", err)
+		}
+		defer db.Close()
+		s, err := db.SubscriptionSQL(u)
+		if err != nil {
+			return err
+		}
+		fmt.Print(s)
+		return nil
+	},
+}
+
+func publishCLI() *cobra.Command {
+	publishSubscriberCmd.Flags().StringVarP(&publisherURI, "publisher-uri", "p", "", "URI the subscriber uses to connect to this database (default is the database URI)")
+	for _, c := range []*cobra.Command{publishCreateCmd, publishDropCmd, publishStatusCmd, publishSubscriberCmd} {
+		publishCmd.AddCommand(addDatabase(c))
+	}
+	return publishCmd
+}
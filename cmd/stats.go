@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/cuducos/minha-receita/db"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+const statsHelper = `
+Shows statistics about the database: active connections, cache hit rate, and
+the size of the companies table and its indexes.
+
+With --largest, it also lists the biggest company documents (usually the ones
+with thousands of partners). This reads the whole table, so it might take a
+while.
+
+With --bloat, it also estimates the space wasted by the companies table and its
+btree indexes (e.g. after loading the data again over an existing database),
+recommending maintenance for the ones wasting at least 30% and 64 MiB. With
+--maintain, it also runs this maintenance: REINDEX INDEX CONCURRENTLY for the
+indexes, and VACUUM (ANALYZE) for the table. Neither locks the table for
+writes, but returning the space of the table to the operating system requires
+VACUUM FULL or pg_repack, better done in a maintenance window. Only available
+for PostgreSQL.`
+
+var (
+	largest  int
+	bloat    bool
+	maintain bool
+)
+
+func printLargest(ctx context.Context, db database) error {
+	ds, err := db.Largest(ctx, largest)
+	if err != nil {
+		return err
+	}
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CNPJ\tSIZE\tPARTNERS")
+	for _, d := range ds {
+		fmt.Fprintf(w, "%s\t%s\t%d\n", d.CNPJ, humanize.IBytes(uint64(d.Size)), d.Partners)
+	}
+	return w.Flush()
+}
+
+func recommendation(b db.Bloat) string {
+	if !b.NeedsMaintenance() {
+		return "-"
+	}
+	if b.Kind == db.BloatIndex {
+		return "REINDEX INDEX CONCURRENTLY"
+	}
+	return "VACUUM (ANALYZE), then VACUUM FULL or pg_repack in a maintenance window"
+}
+
+func printBloat(ctx context.Context, d database) error {
+	bs, err := d.Bloat(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RELATION\tKIND\tSIZE\tWASTED\tRECOMMENDATION")
+	for _, b := range bs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s (%.0f%%)\t%s\n", b.Name, b.Kind, humanize.IBytes(uint64(b.Size)), humanize.IBytes(uint64(b.Wasted)), b.Ratio()*100, recommendation(b))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if !maintain {
+		return nil
+	}
+	for _, b := range bs {
+		if !b.NeedsMaintenance() {
+			continue
+		}
+		slog.Info("Running maintenance", "relation", b.Name, "kind", b.Kind)
+		run := func() error { return d.Maintain(ctx, b) }
+		if err := audited(d, "stats maintain", run, "relation", b.Name, "kind", b.Kind, "wasted", b.Wasted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Shows statistics about the database",
+	Long:  statsHelper,
+	Example: `  minha-receita db stats
+  minha-receita db stats --largest 10
+  minha-receita db stats --maintain`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		db, err := loadDatabase()
+		if err != nil {
+			return fmt.Errorf("could not find database: %w", err)
+		}
+		defer db.Close()
+		ctx := context.Background()
+		s, err := db.Stats(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "Active connections\t%d\n", s.ActiveConnections)
+		if s.CacheHitRate != nil {
+			fmt.Fprintf(w, "Cache hit rate\t%.2f%%\n", *s.CacheHitRate*100)
+		}
+		fmt.Fprintf(w, "Table size\t%s\n", humanize.IBytes(uint64(s.TableSize)))
+		fmt.Fprintf(w, "Index size\t%s\n", humanize.IBytes(uint64(s.IndexSize)))
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if largest > 0 {
+			if err := printLargest(ctx, db); err != nil {
+				return err
+			}
+		}
+		if bloat || maintain {
+			return printBloat(ctx, db)
+		}
+		return nil
+	},
+}
+
+func statsCLI() *cobra.Command {
+	statsCmd.Flags().IntVarP(&largest, "largest", "l", 0, "lists the n largest company documents")
+	statsCmd.Flags().BoolVarP(&bloat, "bloat", "b", false, "estimates the space wasted by the table and its indexes")
+	statsCmd.Flags().BoolVarP(&maintain, "maintain", "m", false, "runs the recommended maintenance (implies --bloat)")
+	return addDatabase(statsCmd)
+}
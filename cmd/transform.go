@@ -2,8 +2,14 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/cuducos/minha-receita/db"
+	"github.com/cuducos/minha-receita/download"
 	"github.com/cuducos/minha-receita/transform"
+	"github.com/cuducos/minha-receita/warnings"
 	"github.com/spf13/cobra"
 )
 
@@ -15,6 +21,45 @@ information from all other source CSV files.
 The transformation process is divided into two steps:
 1. Load relational data to a key-value store
 2. Load the full database using the key-value store
+
+Both steps record checkpoints in the key-value store (source files completely
+loaded, and companies saved to the database). If the transform fails, the
+key-value store is kept and --resume continues from where it stopped.
+
+With --source-dir, the source files are read from another directory (e.g. a
+local mirror or a network mount shared by many machines) instead of the data
+directory. That directory must have the checksums.json written by the download
+command, and every file listed there is verified before the transform starts.
+
+If a batch fails to be saved to the database, it is written to the quarantine
+directory within the data directory and the transform continues, exiting with
+an error at the end. After fixing the cause, --replay-quarantine saves these
+batches (and only them). If too many batches fail in a row, the transform
+stops, and can be continued with --resume.
+
+On PostgreSQL, the companies inserted, updated or deleted since the previous
+load are recorded in the append-only event table at the end of the transform
+(or of the --replay-quarantine, if there are batches in the quarantine).
+
+With --also-load-to, the same data is loaded into other databases (e.g. a
+PostgreSQL for the API and a MongoDB for distribution) reading the source files
+and the key-value store only once. The --clean-up option applies to all of
+them, and the row counts are checked in each one. Quarantined batches record
+which of these databases failed, and --replay-quarantine (given the same
+--also-load-to, in the same order) saves them only there.
+
+The key-value store uses Badger by default. On machines with little memory, use
+--kv-engine pebble and/or set --kv-memory to a budget in MB for the memtables
+and caches of the key-value store.
+
+The first step does not need a database: --kv-only loads the key-value store
+(e.g. on a machine without access to the database) and saves its metadata in
+the .meta directory within the data directory. A transform with --resume and a
+database continues from there, moving that metadata to the database.
+
+Non-fatal problems (e.g. characters removed from the source files or cities
+without an IBGE code) are summarized at the end, together with the ones saved
+by the download, and saved to the metadata table under the warnings key.
 `
 
 var (
@@ -23,32 +68,118 @@ var (
 	batchSize            int
 	cleanUp              bool
 	noPrivacy            bool
+	capitalBands         string
+	resume               bool
+	kvEngine             string
+	kvMemory             int
+	sourceDir            string
+	replayQuarantine     bool
+	alsoLoadTo           []string
+	kvOnly               bool
 )
 
+// reconcileLocalMeta moves the metadata saved by a transform with --kv-only,
+// if any, to the database.
+func reconcileLocalMeta(d database, ds []database) error {
+	p := filepath.Join(dir, db.LocalMetaDir)
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		return nil
+	}
+	m, err := db.NewLocalMeta(p)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	return transform.ReconcileMeta(m, transform.FanOut(d, ds...))
+}
+
 var transformCmd = &cobra.Command{
 	Use:   "transform",
 	Short: "Transforms the CSV files into database records",
 	Long:  transformHelper,
+	Example: `  minha-receita transform --clean-up
+  minha-receita transform --resume
+  minha-receita transform --also-load-to postgres://replica/minhareceita`,
 	RunE: func(_ *cobra.Command, _ []string) error {
-		if err := assertDirExists(); err != nil {
+		q := filepath.Join(dir, transform.QuarantineDir)
+		if replayQuarantine {
+			if cleanUp || resume {
+				return fmt.Errorf("--replay-quarantine cannot be used with --clean-up or --resume")
+			}
+			db, err := loadDatabase()
+			if err != nil {
+				return fmt.Errorf("could not find database: %w", err)
+			}
+			defer db.Close()
+			ds, err := loadOtherDatabases()
+			if err != nil {
+				return err
+			}
+			defer closeDatabases(ds)
+			run := func() error { return transform.ReplayQuarantine(q, transform.FanOut(db, ds...)) }
+			return audited(db, "replay-quarantine", run, "directory", q)
+		}
+		src := dir
+		if sourceDir != "" {
+			if err := download.VerifyManifest(sourceDir); err != nil {
+				return fmt.Errorf("could not use %s as source directory: %w", sourceDir, err)
+			}
+			src = sourceDir
+		} else if err := assertDirExists(); err != nil {
 			return err
 		}
+		if kvOnly {
+			if cleanUp || len(alsoLoadTo) > 0 {
+				return fmt.Errorf("--kv-only cannot be used with --clean-up or --also-load-to")
+			}
+			if err := assertDirExists(); err != nil { // the metadata is saved in the data directory
+				return err
+			}
+			m, err := db.NewLocalMeta(filepath.Join(dir, db.LocalMetaDir))
+			if err != nil {
+				return err
+			}
+			defer m.Close()
+			defer warnings.Log()
+			return transform.LoadKeyValue(src, m, maxParallelKVWrites, kvEngine, kvMemory, resume)
+		}
 		db, err := loadDatabase()
 		if err != nil {
 			return fmt.Errorf("could not find database: %w", err)
 		}
 		defer db.Close()
+		ds, err := loadOtherDatabases()
+		if err != nil {
+			return err
+		}
+		defer closeDatabases(ds)
+		if cleanUp && resume {
+			return fmt.Errorf("--clean-up and --resume cannot be used together")
+		}
 		if cleanUp {
-			err = db.Drop()
-			if err != nil {
-				return err
-			}
-			err = db.Create()
-			if err != nil {
-				return err
+			for _, d := range append([]database{db}, ds...) {
+				err = audited(d, "drop", d.Drop, "schema", postgresSchema)
+				if err != nil {
+					return err
+				}
+				err = audited(d, "create", d.Create, "schema", postgresSchema)
+				if err != nil {
+					return err
+				}
 			}
 		}
-		return transform.Transform(dir, db, maxParallelDBQueries, maxParallelKVWrites, batchSize, !noPrivacy)
+		bs, err := transform.ParseCapitalBands(capitalBands)
+		if err != nil {
+			return err
+		}
+		if err := reconcileLocalMeta(db, ds); err != nil {
+			return err
+		}
+		defer warnings.Log()
+		run := func() error {
+			return transform.Transform(src, transform.FanOut(db, ds...), maxParallelDBQueries, maxParallelKVWrites, batchSize, !noPrivacy, bs, resume, kvEngine, kvMemory, q)
+		}
+		return audited(db, "transform", run, "directory", src, "privacy", !noPrivacy, "resume", resume, "kv-engine", kvEngine, "also-load-to", len(ds))
 	},
 }
 
@@ -72,5 +203,23 @@ func transformCLI() *cobra.Command {
 	transformCmd.Flags().IntVarP(&batchSize, "batch-size", "b", transform.BatchSize, "size of the batch to save to the database")
 	transformCmd.Flags().BoolVarP(&cleanUp, "clean-up", "c", cleanUp, "drop & recreate the database table before starting")
 	transformCmd.Flags().BoolVarP(&noPrivacy, "no-privacy", "p", noPrivacy, "include email addresses, CPF and other PII in the JSON data")
+	transformCmd.Flags().BoolVarP(&resume, "resume", "r", resume, "continue a transform that failed, skipping files and companies already processed")
+	transformCmd.Flags().StringArrayVar(&alsoLoadTo, "also-load-to", nil, "URI of another database to load the same data into, in the same pass (can be repeated)")
+	transformCmd.Flags().BoolVar(&kvOnly, "kv-only", false, "only load the key-value storage, without a database (continue later with --resume)")
+	transformCmd.Flags().BoolVar(&replayQuarantine, "replay-quarantine", false, "only save the batches quarantined by a previous transform")
+	transformCmd.Flags().StringVar(&sourceDir, "source-dir", "", "read the source files from this directory (validated against its checksums.json) instead of the data directory")
+	transformCmd.Flags().StringVar(
+		&kvEngine,
+		"kv-engine",
+		transform.BadgerKVEngine,
+		fmt.Sprintf("key-value storage engine, the options are: %s", strings.Join(transform.KVEngines, ", ")),
+	)
+	transformCmd.Flags().IntVar(&kvMemory, "kv-memory", 0, "memory budget in MB for the key-value storage (0 uses the engine defaults)")
+	transformCmd.Flags().StringVar(
+		&capitalBands,
+		"capital-bands",
+		transform.DefaultCapitalBands.String(),
+		"comma-separated lower edges of the bands used for faixa_capital_social",
+	)
 	return transformCmd
 }
@@ -29,8 +29,8 @@ var transformNextCmd = &cobra.Command{
 }
 
 var cleanupTempCmd = &cobra.Command{
-	Use:   "cleanup",
-	Short: "Clean-up temporary ETL files",
+	Use:   "cleanup-next",
+	Short: "Clean-up temporary ETL files of transform-next",
 	RunE: func(_ *cobra.Command, _ []string) error {
 		return transformnext.Cleanup()
 	},
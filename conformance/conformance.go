@@ -0,0 +1,451 @@
+// Package conformance runs black-box checks against a running instance of the
+// web API (status codes, the structure of the companies, the pagination and
+// the rate limit headers), so operators of mirrors can verify their
+// deployments behave like the reference one.
+package conformance
+
+import (
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cuducos/go-cnpj"
+	"github.com/cuducos/minha-receita/db"
+)
+
+// DefaultTimeout is the timeout of each request.
+const DefaultTimeout = 30 * time.Second
+
+// DefaultCNPJ is a long lived public company (Banco do Brasil), expected in
+// every deployment with all the companies.
+const DefaultCNPJ = "00000000000191"
+
+// invalidCNPJ has the wrong check digits.
+const invalidCNPJ = "00000000000100"
+
+var datePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+// Status of a check.
+type Status string
+
+const (
+	Pass Status = "pass"
+	Fail Status = "fail"
+	Skip Status = "skip"
+)
+
+// Result of a check, with the reason it failed or was skipped.
+type Result struct {
+	Check  string
+	Status Status
+	Detail string
+}
+
+type runner struct {
+	client *http.Client
+	url    string
+	key    string
+	cnpj   string
+}
+
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+func (r *runner) request(m, pth string, key bool, h map[string]string) (response, error) {
+	req, err := http.NewRequest(m, r.url+pth, nil)
+	if err != nil {
+		return response{}, fmt.Errorf("could not create request %s %s: %w", m, pth, err)
+	}
+	if key && r.key != "" {
+		req.Header.Set("Authorization", "Bearer "+r.key)
+	}
+	for k, v := range h {
+		req.Header.Set(k, v)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return response{}, fmt.Errorf("could not request %s %s: %w", m, pth, err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return response{}, fmt.Errorf("could not read the response of %s %s: %w", m, pth, err)
+	}
+	return response{resp.StatusCode, resp.Header, b}, nil
+}
+
+func (r *runner) get(pth string) (response, error) {
+	return r.request(http.MethodGet, pth, true, nil)
+}
+
+// expect returns an error unless the response has the status s and, for
+// JSON, a JSON body.
+func expect(resp response, s int) error {
+	if resp.status != s {
+		return fmt.Errorf("expected status %d, got %d", s, resp.status)
+	}
+	if strings.HasPrefix(resp.header.Get("Content-Type"), "application/json") && !jsontext.Value(resp.body).IsValid() {
+		return errors.New("expected a valid json body")
+	}
+	return nil
+}
+
+// check returns Skip with the reason when it cannot be checked in this
+// deployment, or an error when it fails.
+type check struct {
+	name string
+	run  func(*runner) (Status, error)
+}
+
+var checks = []check{
+	{"health", (*runner).health},
+	{"updated", (*runner).updated},
+	{"status", (*runner).status},
+	{"openapi", (*runner).openAPI},
+	{"company", (*runner).company},
+	{"invalid cnpj", (*runner).invalidCNPJ},
+	{"method not allowed", (*runner).methodNotAllowed},
+	{"conditional request", (*runner).conditionalRequest},
+	{"pagination", (*runner).pagination},
+	{"authentication", (*runner).authentication},
+	{"rate limit headers", (*runner).rateLimitHeaders},
+}
+
+// the health check might be served only in an internal port
+func (r *runner) health() (Status, error) {
+	resp, err := r.get("/healthz")
+	if err != nil {
+		return Fail, err
+	}
+	if resp.status == http.StatusNotFound {
+		return Skip, errors.New("not served in this port (see --internal-port of the api command)")
+	}
+	return Pass, expect(resp, http.StatusOK)
+}
+
+func (r *runner) updated() (Status, error) {
+	resp, err := r.get("/updated")
+	if err != nil {
+		return Fail, err
+	}
+	if resp.status == http.StatusNotFound {
+		return Skip, errors.New("not served in this port (see --internal-port of the api command)")
+	}
+	if err := expect(resp, http.StatusOK); err != nil {
+		return Fail, err
+	}
+	var m struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(resp.body, &m); err != nil {
+		return Fail, fmt.Errorf("could not parse the response: %w", err)
+	}
+	if !datePattern.MatchString(m.Message) {
+		return Fail, fmt.Errorf("expected a YYYY-MM-DD date, got %q", m.Message)
+	}
+	return Pass, nil
+}
+
+func (r *runner) status() (Status, error) {
+	resp, err := r.get("/v1/status")
+	if err != nil {
+		return Fail, err
+	}
+	if err := expect(resp, http.StatusOK); err != nil {
+		return Fail, err
+	}
+	var s struct {
+		UpdatedAt string `json:"updated_at"`
+		Coverage  *struct {
+			Complete *bool `json:"complete"`
+		} `json:"coverage"`
+	}
+	if err := json.Unmarshal(resp.body, &s); err != nil {
+		return Fail, fmt.Errorf("could not parse the response: %w", err)
+	}
+	if !datePattern.MatchString(s.UpdatedAt) {
+		return Fail, fmt.Errorf("expected updated_at to be a YYYY-MM-DD date, got %q", s.UpdatedAt)
+	}
+	if s.Coverage == nil || s.Coverage.Complete == nil {
+		return Fail, errors.New("expected the coverage of the deployment")
+	}
+	return Pass, nil
+}
+
+func (r *runner) openAPI() (Status, error) {
+	resp, err := r.request(http.MethodGet, "/openapi.json", false, nil)
+	if err != nil {
+		return Fail, err
+	}
+	if err := expect(resp, http.StatusOK); err != nil {
+		return Fail, err
+	}
+	var s struct {
+		OpenAPI string                    `json:"openapi"`
+		Paths   map[string]jsontext.Value `json:"paths"`
+	}
+	if err := json.Unmarshal(resp.body, &s); err != nil {
+		return Fail, fmt.Errorf("could not parse the specification: %w", err)
+	}
+	if !strings.HasPrefix(s.OpenAPI, "3.") {
+		return Fail, fmt.Errorf("expected an openapi 3 specification, got %q", s.OpenAPI)
+	}
+	if _, ok := s.Paths["/{cnpj}"]; !ok {
+		return Fail, errors.New("expected the specification to document /{cnpj}")
+	}
+	return Pass, nil
+}
+
+// company checks the structure of the company JSON with the same integrity
+// checks used in the database.
+func (r *runner) company() (Status, error) {
+	resp, err := r.get("/" + r.cnpj)
+	if err != nil {
+		return Fail, err
+	}
+	if err := expect(resp, http.StatusOK); err != nil {
+		return Fail, err
+	}
+	if k := db.CheckIntegrity(string(resp.body)); k != "" {
+		return Fail, fmt.Errorf("company %s failed the %s check", cnpj.Mask(r.cnpj), k)
+	}
+	var c struct {
+		CNPJ string `json:"cnpj"`
+	}
+	if err := json.Unmarshal(resp.body, &c); err != nil {
+		return Fail, fmt.Errorf("could not parse the company: %w", err)
+	}
+	if c.CNPJ != r.cnpj {
+		return Fail, fmt.Errorf("expected company %s, got %s", r.cnpj, c.CNPJ)
+	}
+	return Pass, nil
+}
+
+func (r *runner) invalidCNPJ() (Status, error) {
+	resp, err := r.get("/" + invalidCNPJ)
+	if err != nil {
+		return Fail, err
+	}
+	return Pass, expect(resp, http.StatusBadRequest)
+}
+
+func (r *runner) methodNotAllowed() (Status, error) {
+	resp, err := r.request(http.MethodPost, "/"+r.cnpj, true, nil)
+	if err != nil {
+		return Fail, err
+	}
+	return Pass, expect(resp, http.StatusMethodNotAllowed)
+}
+
+func (r *runner) conditionalRequest() (Status, error) {
+	resp, err := r.get("/" + r.cnpj)
+	if err != nil {
+		return Fail, err
+	}
+	e := resp.header.Get("ETag")
+	if e == "" {
+		return Skip, errors.New("no etag (see the cache middleware of the api command)")
+	}
+	resp, err = r.request(http.MethodGet, "/"+r.cnpj, true, map[string]string{"If-None-Match": e})
+	if err != nil {
+		return Fail, err
+	}
+	if resp.status != http.StatusNotModified {
+		return Fail, fmt.Errorf("expected status %d for etag %s, got %d", http.StatusNotModified, e, resp.status)
+	}
+	return Pass, nil
+}
+
+type page struct {
+	Data   []jsontext.Value `json:"data"`
+	Cursor *string          `json:"cursor"`
+}
+
+func (r *runner) page(q url.Values) (page, error) {
+	resp, err := r.get("/?" + q.Encode())
+	if err != nil {
+		return page{}, err
+	}
+	if err := expect(resp, http.StatusOK); err != nil {
+		return page{}, err
+	}
+	var p page
+	if err := json.Unmarshal(resp.body, &p); err != nil {
+		return page{}, fmt.Errorf("could not parse the page: %w", err)
+	}
+	return p, nil
+}
+
+func cnpjs(p page) ([]string, error) {
+	ns := make([]string, 0, len(p.Data))
+	for _, d := range p.Data {
+		if k := db.CheckIntegrity(string(d)); k != "" {
+			return nil, fmt.Errorf("company in the page failed the %s check", k)
+		}
+		var c struct {
+			CNPJ string `json:"cnpj"`
+		}
+		if err := json.Unmarshal(d, &c); err != nil {
+			return nil, fmt.Errorf("could not parse the company: %w", err)
+		}
+		ns = append(ns, c.CNPJ)
+	}
+	return ns, nil
+}
+
+// pagination searches the companies with the same UF and CNAE fiscal as the
+// company checked, two per page, expecting the next page not to repeat any of
+// them.
+func (r *runner) pagination() (Status, error) {
+	resp, err := r.get("/" + r.cnpj)
+	if err != nil {
+		return Fail, err
+	}
+	if err := expect(resp, http.StatusOK); err != nil {
+		return Fail, fmt.Errorf("could not get company %s: %w", cnpj.Mask(r.cnpj), err)
+	}
+	var c struct {
+		UF   string `json:"uf"`
+		CNAE uint32 `json:"cnae_fiscal"`
+	}
+	if err := json.Unmarshal(resp.body, &c); err != nil {
+		return Fail, fmt.Errorf("could not parse the company: %w", err)
+	}
+	q := url.Values{"uf": {c.UF}, "cnae_fiscal": {strconv.Itoa(int(c.CNAE))}, "limit": {"2"}}
+	p, err := r.page(q)
+	if err != nil {
+		return Fail, err
+	}
+	first, err := cnpjs(p)
+	if err != nil {
+		return Fail, err
+	}
+	if len(first) == 0 || len(first) > 2 {
+		return Fail, fmt.Errorf("expected 1 or 2 companies in the first page, got %d", len(first))
+	}
+	if p.Cursor == nil {
+		if len(first) == 2 {
+			return Fail, errors.New("expected a cursor after a full page")
+		}
+		return Skip, errors.New("only one company in the search, could not check the next page")
+	}
+	q.Set("cursor", *p.Cursor)
+	p, err = r.page(q)
+	if err != nil {
+		return Fail, err
+	}
+	second, err := cnpjs(p)
+	if err != nil {
+		return Fail, err
+	}
+	for _, n := range second {
+		if slices.Contains(first, n) {
+			return Fail, fmt.Errorf("company %s is in both the first and the next page", cnpj.Mask(n))
+		}
+	}
+	return Pass, nil
+}
+
+func (r *runner) authentication() (Status, error) {
+	if r.key == "" {
+		resp, err := r.get("/" + r.cnpj)
+		if err != nil {
+			return Fail, err
+		}
+		if resp.status == http.StatusUnauthorized {
+			return Fail, errors.New("the deployment requires an api key, use --api-key")
+		}
+		return Skip, errors.New("no api key to check")
+	}
+	resp, err := r.request(http.MethodGet, "/"+r.cnpj, false, nil)
+	if err != nil {
+		return Fail, err
+	}
+	if err := expect(resp, http.StatusUnauthorized); err != nil {
+		return Fail, fmt.Errorf("request without the api key: %w", err)
+	}
+	if v := resp.header.Get("WWW-Authenticate"); v != "Bearer" {
+		return Fail, fmt.Errorf("expected www-authenticate to be Bearer, got %q", v)
+	}
+	return Pass, nil
+}
+
+func (r *runner) rateLimitHeaders() (Status, error) {
+	if r.key == "" {
+		return Skip, errors.New("no api key to check")
+	}
+	resp, err := r.get("/" + r.cnpj)
+	if err != nil {
+		return Fail, err
+	}
+	l, m := resp.header.Get("X-RateLimit-Limit"), resp.header.Get("X-RateLimit-Remaining")
+	if l == "" && m == "" {
+		return Skip, errors.New("no rate limit headers (the api key might have no limit)")
+	}
+	ln, err := strconv.Atoi(l)
+	if err != nil {
+		return Fail, fmt.Errorf("invalid x-ratelimit-limit %q", l)
+	}
+	mn, err := strconv.Atoi(m)
+	if err != nil {
+		return Fail, fmt.Errorf("invalid x-ratelimit-remaining %q", m)
+	}
+	if mn < 0 || mn > ln {
+		return Fail, fmt.Errorf("expected x-ratelimit-remaining between 0 and %d, got %d", ln, mn)
+	}
+	if resp.status == http.StatusTooManyRequests && resp.header.Get("Retry-After") == "" {
+		return Fail, errors.New("expected retry-after when the limit is exceeded")
+	}
+	return Pass, nil
+}
+
+// Run checks the deployment at u, looking up the company with CNPJ n and using
+// the API key k (if any). It returns the result of every check, and an error if
+// any of them failed.
+func Run(u, n, k string, t time.Duration) ([]Result, error) {
+	p, err := url.Parse(u)
+	if err != nil || (p.Scheme != "http" && p.Scheme != "https") || p.Host == "" {
+		return nil, fmt.Errorf("invalid url %s, expected something like https://minhareceita.org", u)
+	}
+	n = cnpj.Unmask(n)
+	if !cnpj.IsValid(n) {
+		return nil, fmt.Errorf("invalid cnpj %s", n)
+	}
+	r := runner{client: &http.Client{Timeout: t}, url: strings.TrimSuffix(u, "/"), key: k, cnpj: n}
+	var rs []Result
+	var fs int
+	for _, c := range checks {
+		s, err := c.run(&r)
+		if err == nil {
+			s = Pass
+		} else if s == Pass {
+			s = Fail
+		}
+		res := Result{Check: c.name, Status: s}
+		if err != nil {
+			res.Detail = err.Error()
+		}
+		if s == Fail {
+			fs++
+			slog.Debug("Conformance check failed", "check", c.name, "error", err)
+		}
+		rs = append(rs, res)
+	}
+	if fs > 0 {
+		return rs, fmt.Errorf("%d of %d conformance checks failed", fs, len(rs))
+	}
+	return rs, nil
+}
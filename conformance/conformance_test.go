@@ -0,0 +1,169 @@
+package conformance
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const key = "forty-two"
+
+// fakeAPI behaves like the web API with an API key with rate limit, serving
+// the same company in the pages of the search.
+func fakeAPI(t *testing.T, broken bool) *httptest.Server {
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Fatalf("could not read company json: %s", err)
+	}
+	c := strings.TrimSpace(string(b))
+	other := strings.Replace(c, "19131243000197", "33683111000280", 1)
+	msg := func(w http.ResponseWriter, s int, m string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(s)
+		fmt.Fprintf(w, `{"message":"%s"}`, m)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			w.WriteHeader(http.StatusOK)
+			return
+		case "/openapi.json":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"openapi":"3.1.0","paths":{"/":{},"/{cnpj}":{}}}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+key {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			msg(w, http.StatusUnauthorized, "Chave de API inválida.")
+			return
+		}
+		w.Header().Set("X-RateLimit-Limit", "10")
+		w.Header().Set("X-RateLimit-Remaining", "9")
+		if r.Method != http.MethodGet {
+			msg(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+			return
+		}
+		switch r.URL.Path {
+		case "/updated":
+			msg(w, http.StatusOK, "2024-08-17")
+		case "/v1/status":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"updated_at":"2024-08-17","coverage":{"complete":true}}`)
+		case "/":
+			w.Header().Set("Content-Type", "application/json")
+			if r.URL.Query().Get("cursor") == "" {
+				fmt.Fprintf(w, `{"data":[%s,%s],"cursor":"2"}`, c, other)
+				return
+			}
+			if broken {
+				fmt.Fprintf(w, `{"data":[%s],"cursor":null}`, c)
+				return
+			}
+			fmt.Fprint(w, `{"data":[],"cursor":null}`)
+		case "/19131243000197":
+			if r.Header.Get("If-None-Match") == `W/"2024-08-17"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("ETag", `W/"2024-08-17"`)
+			fmt.Fprint(w, c)
+		default:
+			if broken {
+				msg(w, http.StatusNotFound, "CNPJ não encontrado.")
+				return
+			}
+			msg(w, http.StatusBadRequest, "CNPJ inválido.")
+		}
+	}))
+}
+
+func TestRun(t *testing.T) {
+	for _, c := range []struct {
+		desc     string
+		broken   bool
+		key      string
+		expected map[string]Status
+	}{
+		{
+			"conforming deployment",
+			false,
+			key,
+			map[string]Status{
+				"health":              Pass,
+				"updated":             Pass,
+				"status":              Pass,
+				"openapi":             Pass,
+				"company":             Pass,
+				"invalid cnpj":        Pass,
+				"method not allowed":  Pass,
+				"conditional request": Pass,
+				"pagination":          Pass,
+				"authentication":      Pass,
+				"rate limit headers":  Pass,
+			},
+		},
+		{
+			"broken deployment",
+			true,
+			key,
+			map[string]Status{
+				"invalid cnpj": Fail,
+				"pagination":   Fail,
+			},
+		},
+		{
+			"missing api key",
+			false,
+			"",
+			map[string]Status{
+				"health":             Pass,
+				"openapi":            Pass,
+				"company":            Fail,
+				"authentication":     Fail,
+				"rate limit headers": Skip,
+			},
+		},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			s := fakeAPI(t, c.broken)
+			defer s.Close()
+			rs, err := Run(s.URL, "19.131.243/0001-97", c.key, time.Second)
+			for _, r := range rs {
+				e, ok := c.expected[r.Check]
+				if !ok {
+					continue
+				}
+				if r.Status != e {
+					t.Errorf("expected %s to %s, got %s (%s)", r.Check, e, r.Status, r.Detail)
+				}
+			}
+			var fails bool
+			for _, s := range c.expected {
+				if s == Fail {
+					fails = true
+				}
+			}
+			if fails && err == nil {
+				t.Error("expected an error with failed checks, got nil")
+			}
+			if !fails && err != nil {
+				t.Errorf("expected no error, got %s", err)
+			}
+		})
+	}
+}
+
+func TestRunInvalidArguments(t *testing.T) {
+	if _, err := Run("minhareceita.org", DefaultCNPJ, "", time.Second); err == nil {
+		t.Error("expected an error for an url without scheme, got nil")
+	}
+	if _, err := Run("https://minhareceita.org", "42", "", time.Second); err == nil {
+		t.Error("expected an error for an invalid cnpj, got nil")
+	}
+}
@@ -0,0 +1,23 @@
+package db
+
+import "errors"
+
+// ErrInvalidAggregation is returned when aggregating by a field that is not in
+// AggregationFields.
+var ErrInvalidAggregation = errors.New("invalid aggregation field")
+
+// AggregationFields maps the fields the search can be aggregated by (as named
+// in the API, the same as the search filters) to the key of their code in the
+// JSON of the companies.
+var AggregationFields = map[string]string{
+	"codigo_faixa_capital_social": "codigo_faixa_capital_social",
+	"codigo_porte":                "codigo_porte",
+}
+
+// Bucket is the number of companies matching a search with a code of the
+// aggregated field. The code is nil for companies without it (e.g. the ones
+// without a capital social when aggregating by codigo_faixa_capital_social).
+type Bucket struct {
+	Code  *int  `json:"codigo" bson:"_id"`
+	Total int64 `json:"total" bson:"total"`
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// maximum number of characters in the name of an API key (the size of the
+// column in the api_key table in PostgreSQL)
+const maxAPIKeyNameLength = 64
+
+// OIDCKeyNamePrefix is the prefix of the names of the clients authenticated
+// with JWTs from an OIDC issuer, so API keys cannot be named like them.
+const OIDCKeyNamePrefix = "oidc:"
+
+// APIKey is a client allowed to use the web API. The key itself is never
+// stored, only its SHA-256 hash.
+type APIKey struct {
+	Name    string  `json:"name" bson:"name"`
+	Hash    string  `json:"hash" bson:"hash"`
+	Rate    float64 `json:"rate" bson:"rate"`       // requests per second, zero means no limit
+	Burst   int     `json:"burst" bson:"burst"`     // maximum requests at once
+	Profile Profile `json:"profile" bson:"profile"` // default response profile, empty means full
+	Admin   bool    `json:"admin" bson:"admin"`     // allowed to use the admin endpoints
+}
+
+// HashAPIKey returns the hash used to store and look up an API key.
+func HashAPIKey(k string) string {
+	h := sha256.Sum256([]byte(k))
+	return hex.EncodeToString(h[:])
+}
+
+// NewAPIKey creates a random API key, returning its representation to be saved
+// in the database and the key itself (which is not saved anywhere and should be
+// handed to the client).
+func NewAPIKey(name string, rate float64, burst int) (APIKey, string, error) {
+	if name == "" {
+		return APIKey{}, "", fmt.Errorf("api key name cannot be empty")
+	}
+	if n := utf8.RuneCountInString(name); n > maxAPIKeyNameLength {
+		return APIKey{}, "", fmt.Errorf("api key name has %d characters, the maximum is %d", n, maxAPIKeyNameLength)
+	}
+	if strings.HasPrefix(name, OIDCKeyNamePrefix) {
+		return APIKey{}, "", fmt.Errorf("api key name cannot start with %s", OIDCKeyNamePrefix)
+	}
+	if rate < 0 || burst < 0 {
+		return APIKey{}, "", fmt.Errorf("api key rate and burst cannot be negative")
+	}
+	if rate > 0 && burst == 0 {
+		burst = max(1, int(rate))
+	}
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return APIKey{}, "", fmt.Errorf("could not generate api key: %w", err)
+	}
+	k := hex.EncodeToString(b)
+	return APIKey{Name: name, Hash: HashAPIKey(k), Rate: rate, Burst: burst}, k, nil
+}
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	a, k, err := NewAPIKey("test", 10, 0)
+	if err != nil {
+		t.Fatalf("expected no error creating an api key, got %s", err)
+	}
+	if a.Hash != HashAPIKey(k) {
+		t.Errorf("expected hash to be %s, got %s", HashAPIKey(k), a.Hash)
+	}
+	if a.Burst != 10 {
+		t.Errorf("expected burst to default to the rate, got %d", a.Burst)
+	}
+	_, o, err := NewAPIKey("test", 10, 0)
+	if err != nil {
+		t.Fatalf("expected no error creating an api key, got %s", err)
+	}
+	if k == o {
+		t.Errorf("expected different keys, got %s twice", k)
+	}
+	for _, tc := range []struct {
+		name  string
+		rate  float64
+		burst int
+	}{
+		{"", 1, 1},
+		{"oidc:42", 1, 1},
+		{strings.Repeat("x", 65), 1, 1},
+		{"test", -1, 1},
+		{"test", 1, -1},
+	} {
+		if _, _, err := NewAPIKey(tc.name, tc.rate, tc.burst); err == nil {
+			t.Errorf("expected error creating api key %#v, got nil", tc)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// auditActorKey is the log attribute with who performed the audited action.
+const auditActorKey = "actor"
+
+// AuditEntry records an admin action: who did what, when and with which
+// parameters.
+type AuditEntry struct {
+	At         time.Time         `json:"at" bson:"at"`
+	Actor      string            `json:"actor" bson:"actor"`
+	Action     string            `json:"action" bson:"action"`
+	Parameters map[string]string `json:"parameters" bson:"parameters"`
+}
+
+type auditor interface {
+	SaveAuditEntry(AuditEntry) error
+}
+
+// AuditHandler is a slog.Handler that appends every record to the audit
+// table: the message is the action, the actor attribute is who performed it,
+// and the other attributes are its parameters. Records are also passed on to
+// the next handler, if any, so they show up in the regular logs too.
+type AuditHandler struct {
+	db    auditor
+	next  slog.Handler
+	attrs []slog.Attr
+	group string
+}
+
+// NewAuditHandler creates an AuditHandler saving entries to db and passing
+// records on to next (which can be nil).
+func NewAuditHandler(db auditor, next slog.Handler) *AuditHandler {
+	return &AuditHandler{db: db, next: next}
+}
+
+// Enabled is always true since admin actions are audited regardless of the
+// log level.
+func (h *AuditHandler) Enabled(_ context.Context, _ slog.Level) bool { return true }
+
+func (h *AuditHandler) params(m map[string]string, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	k := a.Key
+	if prefix != "" {
+		k = prefix + "." + k
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, g := range a.Value.Group() {
+			h.params(m, k, g)
+		}
+		return
+	}
+	m[k] = a.Value.String()
+}
+
+// Handle saves the record as an audit entry and then passes it on to the next
+// handler.
+func (h *AuditHandler) Handle(ctx context.Context, r slog.Record) error {
+	m := make(map[string]string)
+	for _, a := range h.attrs {
+		h.params(m, "", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		h.params(m, h.group, a)
+		return true
+	})
+	e := AuditEntry{At: r.Time.UTC(), Actor: m[auditActorKey], Action: r.Message, Parameters: m}
+	delete(m, auditActorKey)
+	if e.Actor == "" {
+		e.Actor = "unknown"
+	}
+	if e.At.IsZero() {
+		e.At = time.Now().UTC()
+	}
+	if err := h.db.SaveAuditEntry(e); err != nil {
+		// slog ignores errors from handlers, so this is the only way to know
+		slog.Error("could not save audit entry", "action", e.Action, "error", err)
+		return err
+	}
+	if h.next != nil && h.next.Enabled(ctx, r.Level) {
+		return h.next.Handle(ctx, r)
+	}
+	return nil
+}
+
+// WithAttrs returns a handler including the attributes in every entry.
+func (h *AuditHandler) WithAttrs(as []slog.Attr) slog.Handler {
+	n := *h
+	n.attrs = make([]slog.Attr, 0, len(h.attrs)+len(as))
+	n.attrs = append(n.attrs, h.attrs...)
+	for _, a := range as {
+		if h.group != "" {
+			a = slog.Group(h.group, a)
+		}
+		n.attrs = append(n.attrs, a)
+	}
+	if h.next != nil {
+		n.next = h.next.WithAttrs(as)
+	}
+	return &n
+}
+
+// WithGroup returns a handler prefixing the parameters with the group name.
+func (h *AuditHandler) WithGroup(g string) slog.Handler {
+	if g == "" {
+		return h
+	}
+	n := *h
+	n.group = g
+	if h.group != "" {
+		n.group = h.group + "." + g
+	}
+	if h.next != nil {
+		n.next = h.next.WithGroup(g)
+	}
+	return &n
+}
+
+// NewAuditLogger returns a logger that saves every record to the audit table.
+// The AUDIT_LOG environment variable sets where else the records go: text
+// (default) for the regular logs, json for JSON lines in the standard error, or
+// none to only save them to the database.
+func NewAuditLogger(db auditor) (*slog.Logger, error) {
+	var n slog.Handler
+	switch v := os.Getenv("AUDIT_LOG"); v {
+	case "", "text":
+		n = slog.Default().Handler()
+	case "json":
+		n = slog.NewJSONHandler(os.Stderr, nil)
+	case "none":
+	default:
+		return nil, fmt.Errorf("invalid AUDIT_LOG %s, the options are: text, json or none", v)
+	}
+	return slog.New(NewAuditHandler(db, n)), nil
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"bytes"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type mockAuditor struct{ entries []AuditEntry }
+
+func (m *mockAuditor) SaveAuditEntry(e AuditEntry) error {
+	m.entries = append(m.entries, e)
+	return nil
+}
+
+func TestAuditHandler(t *testing.T) {
+	var a mockAuditor
+	var b bytes.Buffer
+	l := slog.New(NewAuditHandler(&a, slog.NewTextHandler(&b, nil)))
+	l.With("actor", "alice").Info("drop", "schema", "public")
+	l.WithGroup("key").Debug("api-keys add", "name", "test", slog.Group("limit", "rate", 1.5))
+	if len(a.entries) != 2 {
+		t.Fatalf("expected 2 audit entries, got %d", len(a.entries))
+	}
+	for i, tc := range []struct {
+		actor  string
+		action string
+		params map[string]string
+	}{
+		{"alice", "drop", map[string]string{"schema": "public"}},
+		{"unknown", "api-keys add", map[string]string{"key.name": "test", "key.limit.rate": "1.5"}},
+	} {
+		e := a.entries[i]
+		if e.Actor != tc.actor {
+			t.Errorf("expected actor %s, got %s", tc.actor, e.Actor)
+		}
+		if e.Action != tc.action {
+			t.Errorf("expected action %s, got %s", tc.action, e.Action)
+		}
+		if !reflect.DeepEqual(e.Parameters, tc.params) {
+			t.Errorf("expected parameters %v, got %v", tc.params, e.Parameters)
+		}
+		if e.At.IsZero() {
+			t.Error("expected audit entry to have a time")
+		}
+	}
+	if s := b.String(); !strings.Contains(s, "msg=drop") || strings.Contains(s, "api-keys") {
+		t.Errorf("expected only the info record in the next handler, got %s", s)
+	}
+}
+
+func TestNewAuditLogger(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		err   bool
+	}{
+		{"", false},
+		{"text", false},
+		{"json", false},
+		{"none", false},
+		{"syslog", true},
+	} {
+		t.Setenv("AUDIT_LOG", tc.value)
+		_, err := NewAuditLogger(&mockAuditor{})
+		if tc.err && err == nil {
+			t.Errorf("expected error for AUDIT_LOG=%s, got nil", tc.value)
+		}
+		if !tc.err && err != nil {
+			t.Errorf("expected no error for AUDIT_LOG=%s, got %s", tc.value, err)
+		}
+	}
+}
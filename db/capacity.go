@@ -0,0 +1,70 @@
+package db
+
+// Capacity is a snapshot of how busy the database connections are.
+type Capacity struct {
+	InUse        int32    // connections currently in use
+	Idle         int32    // open connections waiting to be used
+	Max          int32    // maximum number of connections in the pool
+	CacheHitRate *float64 // share of reads served from the database cache
+}
+
+// Saturation is the share of the connection pool in use, from 0 to 1.
+func (c Capacity) Saturation() float64 {
+	if c.Max <= 0 {
+		return 0
+	}
+	return float64(c.InUse) / float64(c.Max)
+}
+
+// Stats are read from the database server itself, so they are accurate even
+// when the database runs in another host or container.
+type Stats struct {
+	ActiveConnections int64    // connections running a query
+	CacheHitRate      *float64 // share of reads served from the database cache
+	TableSize         int64    // size of the companies table in bytes
+	IndexSize         int64    // size of the indexes of the companies table in bytes
+}
+
+// DocumentSize is the size of the JSON of a company, used to find the largest
+// documents (usually the ones with thousands of partners).
+type DocumentSize struct {
+	CNPJ     string
+	Size     int64 // bytes of the JSON
+	Partners int64 // number of items in the qsa array
+}
+
+// Kinds of relations in the bloat report.
+const (
+	BloatTable = "table"
+	BloatIndex = "index"
+)
+
+// a relation needs maintenance when it wastes at least this share of its size
+// and at least this many bytes (so small relations are left alone)
+const (
+	bloatRatio   = 0.3
+	bloatMinimum = 64 << 20
+)
+
+// Bloat is the estimated space wasted by a table or an index, usually left by
+// updates and deletes (dead tuples and half-empty index pages).
+type Bloat struct {
+	Kind   string // BloatTable or BloatIndex
+	Name   string
+	Size   int64 // bytes
+	Wasted int64 // estimated bytes that could be reclaimed
+}
+
+// Ratio is the share of the size that is wasted, from 0 to 1.
+func (b Bloat) Ratio() float64 {
+	if b.Size <= 0 {
+		return 0
+	}
+	return float64(b.Wasted) / float64(b.Size)
+}
+
+// NeedsMaintenance tells whether the relation wastes enough space to be worth
+// rebuilding.
+func (b Bloat) NeedsMaintenance() bool {
+	return b.Wasted >= bloatMinimum && b.Ratio() >= bloatRatio
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/cuducos/go-cnpj"
+)
+
+// Crosswalks map other identifiers of a company (e.g. NIRE or a state
+// registration) to its CNPJ, for legacy systems that only store these. Each
+// kind of identifier is a name chosen by the operator loading the mappings,
+// such as nire or ie-sp.
+var crosswalkKind = regexp.MustCompile(`^[a-z][a-z0-9-]{0,15}$`)
+
+// ValidateCrosswalkKind checks if the kind of identifier is a valid name:
+// lowercase letters, digits and hyphens, starting with a letter and with up to
+// 16 characters.
+func ValidateCrosswalkKind(k string) error {
+	if !crosswalkKind.MatchString(k) {
+		return fmt.Errorf("invalid kind of identifier %s, use up to 16 lowercase letters, digits and hyphens (e.g. nire or ie-sp)", k)
+	}
+	return nil
+}
+
+// NormalizeCrosswalkID keeps only the letters (in uppercase) and digits of an
+// identifier, so the same identifier formatted in different ways (e.g.
+// 35.3.0001234-5 and 35300012345) matches.
+func NormalizeCrosswalkID(id string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) || unicode.IsLetter(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, id)
+}
+
+// ReadCrosswalk reads a CSV with the identifier in the first column and the
+// CNPJ in the second one (with or without punctuation), returning normalized
+// pairs of identifier and unmasked CNPJ. A first line without a valid CNPJ is
+// taken as the header.
+func ReadCrosswalk(r io.Reader) ([][]string, error) {
+	c := csv.NewReader(r)
+	c.FieldsPerRecord = 2
+	c.TrimLeadingSpace = true
+	var ps [][]string
+	for n := 1; ; n++ {
+		l, err := c.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading crosswalk csv: %w", err)
+		}
+		if !cnpj.IsValid(l[1]) {
+			if n == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("invalid cnpj %s in line %d of the crosswalk csv", l[1], n)
+		}
+		id := NormalizeCrosswalkID(l[0])
+		if id == "" {
+			return nil, fmt.Errorf("empty identifier in line %d of the crosswalk csv", n)
+		}
+		ps = append(ps, []string{id, cnpj.Unmask(l[1])})
+	}
+	return ps, nil
+}
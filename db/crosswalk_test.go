@@ -0,0 +1,46 @@
+package db
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateCrosswalkKind(t *testing.T) {
+	for _, k := range []string{"nire", "ie-sp", "rg2"} {
+		if err := ValidateCrosswalkKind(k); err != nil {
+			t.Errorf("expected %s to be valid, got %s", k, err)
+		}
+	}
+	for _, k := range []string{"", "NIRE", "2ie", "ie sp", "a-very-long-kind-name"} {
+		if err := ValidateCrosswalkKind(k); err == nil {
+			t.Errorf("expected %s to be invalid", k)
+		}
+	}
+}
+
+func TestNormalizeCrosswalkID(t *testing.T) {
+	if got := NormalizeCrosswalkID(" 35.3.0001234-5x "); got != "35300012345X" {
+		t.Errorf("expected 35300012345X, got %s", got)
+	}
+}
+
+func TestReadCrosswalk(t *testing.T) {
+	got, err := ReadCrosswalk(strings.NewReader("nire,cnpj\n35.3.0001234-5,33.683.111/0002-80\n53300001234,19131243000197\n"))
+	if err != nil {
+		t.Fatalf("expected no error reading the crosswalk, got %s", err)
+	}
+	exp := [][]string{{"35300012345", "33683111000280"}, {"53300001234", "19131243000197"}}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	for _, c := range []string{
+		"35300012345,33683111000280\n53300001234,42\n",
+		"35300012345,33683111000280\n-,19131243000197\n",
+		"35300012345\n",
+	} {
+		if _, err := ReadCrosswalk(strings.NewReader(c)); err == nil {
+			t.Errorf("expected an error reading %q", c)
+		}
+	}
+}
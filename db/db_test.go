@@ -3,12 +3,15 @@ package db
 import (
 	"context"
 	"encoding/json/v2"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/cuducos/minha-receita/transform"
 )
@@ -21,13 +24,36 @@ type database interface {
 	Close()
 
 	CreateCompanies([][]string) error
-	GetCompany(string) (string, error)
+	GetCompany(string, Profile) (string, error)
 
 	CreateExtraIndexes([]string) error
 	Search(context.Context, *Query) (string, error)
+	Aggregate(context.Context, *Query, string) ([]Bucket, error)
 
 	MetaSave(string, string) error
 	MetaRead(string) (string, error)
+
+	Sample(context.Context, int) ([]string, error)
+	Largest(context.Context, int) ([]DocumentSize, error)
+	RowCounts() (map[string]int64, error)
+	Partners(context.Context, string, int, int) (string, error)
+
+	APIKeys() ([]APIKey, error)
+	SaveAPIKey(APIKey) error
+	DeleteAPIKey(string) error
+
+	SaveAuditEntry(AuditEntry) error
+	AuditEntries(context.Context, int) ([]AuditEntry, error)
+
+	SaveCrosswalk(string, [][]string) error
+	CrosswalkCNPJ(context.Context, string, string) (string, error)
+
+	SaveEnrichment(context.Context, string, string) (string, error)
+	Enrichment(context.Context, string) (string, error)
+
+	AddTag(context.Context, string, string, string) error
+	RemoveTag(context.Context, string, string, string) error
+	Tags(context.Context, string, string) ([]string, error)
 }
 
 type testCase struct {
@@ -44,6 +70,15 @@ type page struct {
 	Cursor *string             `json:"cursor"`
 }
 
+func newQuery(t *testing.T, v url.Values) *Query {
+	t.Helper()
+	q, err := NewQuery(v)
+	if err != nil {
+		t.Fatalf("expected no error parsing %s, got %s", v.Encode(), err)
+	}
+	return q
+}
+
 func assertSearchCount(t *testing.T, s string, tc testCase) {
 	var p page
 	if err := json.Unmarshal([]byte(s), &p); err != nil {
@@ -101,11 +136,85 @@ func TestRetrieve(t *testing.T) {
 	}()
 	for _, db := range []database{pg, m} {
 		t.Run(fmt.Sprintf("%T", db), func(t *testing.T) {
-			got, err := db.GetCompany("33683111000280")
+			got, err := db.GetCompany("33683111000280", ProfileFull)
 			if err != nil {
 				t.Errorf("expected no error getting a company, got %s", err)
 			}
 			assertCompaniesAreEqual(t, got, c)
+			got, err = db.GetCompany("33683111000280", ProfileMinimal)
+			if err != nil {
+				t.Errorf("expected no error getting a company with the minimal profile, got %s", err)
+			}
+			var fs map[string]any
+			if err := json.Unmarshal([]byte(got), &fs); err != nil {
+				t.Errorf("expected no error unmarshalling company, got %s", err)
+			}
+			if len(fs) != len(ProfileMinimal.Fields()) {
+				t.Errorf("expected %d fields in the minimal profile, got %d: %s", len(ProfileMinimal.Fields()), len(fs), got)
+			}
+			ss, err := db.Sample(context.Background(), 1)
+			if err != nil {
+				t.Errorf("expected no error sampling companies, got %s", err)
+			}
+			if len(ss) != 1 {
+				t.Errorf("expected 1 sampled company, got %d", len(ss))
+			}
+			for _, s := range ss {
+				assertCompaniesAreEqual(t, s, c)
+			}
+			ds, err := db.Largest(context.Background(), 10)
+			if err != nil {
+				t.Errorf("expected no error getting the largest companies, got %s", err)
+			}
+			if len(ds) != 1 {
+				t.Errorf("expected 1 company in the largest report, got %d", len(ds))
+			}
+			for _, d := range ds {
+				if d.CNPJ != id {
+					t.Errorf("expected the largest company to be %s, got %s", id, d.CNPJ)
+				}
+				if d.Size <= 0 {
+					t.Errorf("expected the size of the largest company to be positive, got %d", d.Size)
+				}
+				if d.Partners != 1 {
+					t.Errorf("expected the largest company to have 1 partner, got %d", d.Partners)
+				}
+			}
+			for _, pc := range []struct {
+				offset int
+				data   int
+			}{
+				{0, 1},
+				{10, 0},
+			} {
+				got, err := db.Partners(context.Background(), id, pc.offset, 10)
+				if err != nil {
+					t.Errorf("expected no error getting partners from offset %d, got %s", pc.offset, err)
+				}
+				var p struct {
+					Data  []map[string]any `json:"data"`
+					Total int              `json:"total"`
+				}
+				if err := json.Unmarshal([]byte(got), &p); err != nil {
+					t.Errorf("expected no error unmarshalling partners, got %s", err)
+				}
+				if p.Total != 1 {
+					t.Errorf("expected 1 partner in total, got %d", p.Total)
+				}
+				if len(p.Data) != pc.data {
+					t.Errorf("expected %d partners from offset %d, got %d", pc.data, pc.offset, len(p.Data))
+				}
+			}
+			if _, err := db.Partners(context.Background(), "00000000000000", 0, 10); err == nil {
+				t.Error("expected an error getting partners of an unknown company")
+			}
+			rc, err := db.RowCounts()
+			if err != nil {
+				t.Errorf("expected no error counting companies, got %s", err)
+			}
+			if len(rc) != 1 || rc[id[:2]] != 1 {
+				t.Errorf("expected 1 company with the prefix %s, got %v", id[:2], rc)
+			}
 			if err := db.MetaSave("answer", "42"); err != nil {
 				t.Errorf("expected no error writing to the metadata table, got %s", err)
 			}
@@ -133,6 +242,121 @@ func TestRetrieve(t *testing.T) {
 	}
 }
 
+func TestAPIKeys(t *testing.T) {
+	id := "33683111000280"
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Error("error reading company JSON file")
+	}
+	c := string(b)
+	pg, err := setUpPostgres(id, c)
+	if err != nil {
+		t.Errorf("expected no error setting up postgres, got %s", err)
+		return
+	}
+	defer func() {
+		if err := pg.Drop(); err != nil {
+			t.Errorf("expected no error dropping the tables, got %s", err)
+		}
+		pg.Close()
+	}()
+	m, err := setUpMongo(id, c)
+	if err != nil {
+		t.Errorf("expected no error setting up mongo, got %s", err)
+		return
+	}
+	defer func() {
+		if err := m.Drop(); err != nil {
+			t.Errorf("expected no error dropping the collections, got %s", err)
+		}
+		m.Close()
+	}()
+	for _, db := range []database{pg, m} {
+		t.Run(fmt.Sprintf("%T", db), func(t *testing.T) {
+			k, _, err := NewAPIKey("test", 2, 4)
+			if err != nil {
+				t.Fatalf("expected no error creating an api key, got %s", err)
+			}
+			k.Profile = ProfileMinimal
+			k.Admin = true
+			if err := db.SaveAPIKey(k); err != nil {
+				t.Errorf("expected no error saving an api key, got %s", err)
+			}
+			k.Rate = 4
+			if err := db.SaveAPIKey(k); err != nil {
+				t.Errorf("expected no error re-saving an api key, got %s", err)
+			}
+			ks, err := db.APIKeys()
+			if err != nil {
+				t.Errorf("expected no error listing api keys, got %s", err)
+			}
+			if len(ks) != 1 || ks[0] != k {
+				t.Errorf("expected only %#v as api key, got %#v", k, ks)
+			}
+			if err := db.DeleteAPIKey(k.Name); err != nil {
+				t.Errorf("expected no error deleting an api key, got %s", err)
+			}
+			if err := db.DeleteAPIKey(k.Name); err == nil {
+				t.Error("expected error deleting a missing api key, got nil")
+			}
+		})
+	}
+}
+
+func TestAudit(t *testing.T) {
+	id := "33683111000280"
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Error("error reading company JSON file")
+	}
+	c := string(b)
+	pg, err := setUpPostgres(id, c)
+	if err != nil {
+		t.Errorf("expected no error setting up postgres, got %s", err)
+		return
+	}
+	defer func() {
+		if err := pg.Drop(); err != nil {
+			t.Errorf("expected no error dropping the tables, got %s", err)
+		}
+		pg.Close()
+	}()
+	m, err := setUpMongo(id, c)
+	if err != nil {
+		t.Errorf("expected no error setting up mongo, got %s", err)
+		return
+	}
+	defer func() {
+		if err := m.Drop(); err != nil {
+			t.Errorf("expected no error dropping the collections, got %s", err)
+		}
+		m.Close()
+	}()
+	for _, db := range []database{pg, m} {
+		t.Run(fmt.Sprintf("%T", db), func(t *testing.T) {
+			e := AuditEntry{
+				At:         time.Now().UTC().Truncate(time.Millisecond),
+				Actor:      "test",
+				Action:     fmt.Sprintf("test %d", time.Now().UnixNano()),
+				Parameters: map[string]string{"answer": "42"},
+			}
+			if err := db.SaveAuditEntry(e); err != nil {
+				t.Errorf("expected no error saving an audit entry, got %s", err)
+			}
+			es, err := db.AuditEntries(context.Background(), 1)
+			if err != nil {
+				t.Errorf("expected no error listing audit entries, got %s", err)
+			}
+			if len(es) != 1 {
+				t.Fatalf("expected 1 audit entry, got %d", len(es))
+			}
+			if !es[0].At.Equal(e.At) || es[0].Actor != e.Actor || es[0].Action != e.Action || !reflect.DeepEqual(es[0].Parameters, e.Parameters) {
+				t.Errorf("expected %#v as the latest audit entry, got %#v", e, es[0])
+			}
+		})
+	}
+}
+
 func TestSearch(t *testing.T) {
 	id := "33683111000280"
 	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
@@ -184,10 +408,18 @@ func TestSearch(t *testing.T) {
 		{map[string][]string{"cnpf": {"21449073000135"}}, 0},
 		{map[string][]string{"cnpf": {"***112108**"}}, 1},
 		{map[string][]string{"cnpf": {"21449073000135", "***112108**"}}, 1},
+		{map[string][]string{"codigo_porte": {"1"}}, 0},
+		{map[string][]string{"codigo_porte": {"5"}}, 1},
+		{map[string][]string{"codigo_porte": {"0", "5"}}, 1},
+		{map[string][]string{"socio": {"fulano de tal"}}, 0},
+		{map[string][]string{"socio": {"haydee svab"}}, 1},
+		{map[string][]string{"socio": {"haydee sv"}}, 1},
+		{map[string][]string{"socio": {"SVAB"}}, 0},
+		{map[string][]string{"socio": {"fulano de tal", "haydee"}}, 1},
 	} {
 		for _, db := range []database{pg, m} {
 			t.Run(tc.name(db), func(t *testing.T) {
-				q := NewQuery(tc.params)
+				q := newQuery(t, tc.params)
 				s, err := db.Search(context.Background(), q)
 				if err != nil {
 					t.Errorf("expected no error searching, got %s", err)
@@ -198,3 +430,375 @@ func TestSearch(t *testing.T) {
 		}
 	}
 }
+
+func TestAggregate(t *testing.T) {
+	id := "33683111000280"
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Error("error reading company JSON file")
+	}
+	c := string(b)
+	pg, err := setUpPostgres(id, c)
+	if err != nil {
+		t.Errorf("expected no error setting up postgres, got %s", err)
+		return
+	}
+	defer func() {
+		if err := pg.Drop(); err != nil {
+			t.Errorf("expected no error dropping the tables, got %s", err)
+		}
+		pg.Close()
+	}()
+	m, err := setUpMongo(id, c)
+	if err != nil {
+		t.Errorf("expected no error setting up mongo, got %s", err)
+		return
+	}
+	defer func() {
+		if err := m.Drop(); err != nil {
+			t.Errorf("expected no error dropping the collections, got %s", err)
+		}
+		m.Close()
+	}()
+	porte := 5
+	for _, tc := range []struct {
+		field    string
+		params   url.Values
+		expected []Bucket
+	}{
+		{"codigo_porte", url.Values{"uf": {"sp"}}, []Bucket{{&porte, 1}}},
+		{"codigo_porte", url.Values{"uf": {"sc"}}, []Bucket{}},
+		{"codigo_faixa_capital_social", url.Values{"uf": {"sp"}}, []Bucket{{nil, 1}}},
+	} {
+		for _, db := range []database{pg, m} {
+			t.Run(fmt.Sprintf("%T %s by %s", db, tc.params.Encode(), tc.field), func(t *testing.T) {
+				got, err := db.Aggregate(context.Background(), newQuery(t, tc.params), tc.field)
+				if err != nil {
+					t.Fatalf("expected no error aggregating, got %s", err)
+				}
+				if len(got) != len(tc.expected) {
+					t.Fatalf("expected %d buckets, got %d", len(tc.expected), len(got))
+				}
+				for i, b := range got {
+					e := tc.expected[i]
+					if (b.Code == nil) != (e.Code == nil) || (b.Code != nil && *b.Code != *e.Code) || b.Total != e.Total {
+						t.Errorf("expected bucket %d to be %v with %d companies, got %v with %d", i, e.Code, e.Total, b.Code, b.Total)
+					}
+				}
+			})
+		}
+	}
+	for _, db := range []database{pg, m} {
+		if _, err := db.Aggregate(context.Background(), newQuery(t, url.Values{"uf": {"sp"}}), "uf"); !errors.Is(err, ErrInvalidAggregation) {
+			t.Errorf("expected %T to return ErrInvalidAggregation for uf, got %v", db, err)
+		}
+	}
+}
+
+func TestCrosswalk(t *testing.T) {
+	id := "33683111000280"
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Error("error reading company JSON file")
+	}
+	c := string(b)
+	pg, err := setUpPostgres(id, c)
+	if err != nil {
+		t.Errorf("expected no error setting up postgres, got %s", err)
+		return
+	}
+	defer func() {
+		if err := pg.Drop(); err != nil {
+			t.Errorf("expected no error dropping the tables, got %s", err)
+		}
+		pg.Close()
+	}()
+	m, err := setUpMongo(id, c)
+	if err != nil {
+		t.Errorf("expected no error setting up mongo, got %s", err)
+		return
+	}
+	defer func() {
+		if err := m.Drop(); err != nil {
+			t.Errorf("expected no error dropping the collections, got %s", err)
+		}
+		m.Close()
+	}()
+	for _, db := range []database{pg, m} {
+		t.Run(fmt.Sprintf("%T", db), func(t *testing.T) {
+			if err := db.SaveCrosswalk("nire", [][]string{{"53300001234", "19131243000197"}}); err != nil {
+				t.Errorf("expected no error saving the crosswalk, got %s", err)
+			}
+			if err := db.SaveCrosswalk("nire", [][]string{{"53300001234", id}}); err != nil {
+				t.Errorf("expected no error re-saving the crosswalk, got %s", err)
+			}
+			got, err := db.CrosswalkCNPJ(context.Background(), "nire", "53.3.0000123-4")
+			if err != nil {
+				t.Errorf("expected no error looking up the crosswalk, got %s", err)
+			}
+			if got != id {
+				t.Errorf("expected %s, got %s", id, got)
+			}
+			if _, err := db.CrosswalkCNPJ(context.Background(), "ie-sp", "53300001234"); err == nil {
+				t.Error("expected an error looking up an identifier of another kind")
+			}
+		})
+	}
+}
+
+func TestEnrichment(t *testing.T) {
+	id := "33683111000280"
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Error("error reading company JSON file")
+	}
+	c := string(b)
+	pg, err := setUpPostgres(id, c)
+	if err != nil {
+		t.Errorf("expected no error setting up postgres, got %s", err)
+		return
+	}
+	defer func() {
+		if err := pg.Drop(); err != nil {
+			t.Errorf("expected no error dropping the tables, got %s", err)
+		}
+		pg.Close()
+	}()
+	m, err := setUpMongo(id, c)
+	if err != nil {
+		t.Errorf("expected no error setting up mongo, got %s", err)
+		return
+	}
+	defer func() {
+		if err := m.Drop(); err != nil {
+			t.Errorf("expected no error dropping the collections, got %s", err)
+		}
+		m.Close()
+	}()
+	for _, db := range []database{pg, m} {
+		t.Run(fmt.Sprintf("%T", db), func(t *testing.T) {
+			ctx := context.Background()
+			s, err := db.Enrichment(ctx, "19131243000197")
+			if err != nil {
+				t.Errorf("expected no error reading the enrichment, got %s", err)
+			}
+			if s != "" {
+				t.Errorf("expected no enrichment, got %s", s)
+			}
+			if _, err := db.SaveEnrichment(ctx, id, `{"gerente":"Ana","risco":0.7,"ativo":null}`); err != nil {
+				t.Errorf("expected no error saving the enrichment, got %s", err)
+			}
+			if _, err := db.SaveEnrichment(ctx, id, `{"risco":null,"ativo":true}`); err != nil {
+				t.Errorf("expected no error patching the enrichment, got %s", err)
+			}
+			s, err = db.Enrichment(ctx, id)
+			if err != nil {
+				t.Errorf("expected no error reading the enrichment, got %s", err)
+			}
+			var got map[string]any
+			if err := json.Unmarshal([]byte(s), &got); err != nil {
+				t.Errorf("expected a JSON object, got %s", s)
+			}
+			exp := map[string]any{"gerente": "Ana", "ativo": true}
+			if !reflect.DeepEqual(got, exp) {
+				t.Errorf("expected %v, got %v", exp, got)
+			}
+		})
+	}
+}
+
+func TestTags(t *testing.T) {
+	id := "33683111000280"
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Error("error reading company JSON file")
+	}
+	c := string(b)
+	pg, err := setUpPostgres(id, c)
+	if err != nil {
+		t.Errorf("expected no error setting up postgres, got %s", err)
+		return
+	}
+	defer func() {
+		if err := pg.Drop(); err != nil {
+			t.Errorf("expected no error dropping the tables, got %s", err)
+		}
+		pg.Close()
+	}()
+	m, err := setUpMongo(id, c)
+	if err != nil {
+		t.Errorf("expected no error setting up mongo, got %s", err)
+		return
+	}
+	defer func() {
+		if err := m.Drop(); err != nil {
+			t.Errorf("expected no error dropping the collections, got %s", err)
+		}
+		m.Close()
+	}()
+	for _, db := range []database{pg, m} {
+		t.Run(fmt.Sprintf("%T", db), func(t *testing.T) {
+			ctx := context.Background()
+			for _, tag := range []string{"cliente", "fornecedor", "cliente"} {
+				if err := db.AddTag(ctx, "crm", id, tag); err != nil {
+					t.Errorf("expected no error tagging, got %s", err)
+				}
+			}
+			if err := db.RemoveTag(ctx, "crm", id, "fornecedor"); err != nil {
+				t.Errorf("expected no error removing a tag, got %s", err)
+			}
+			ts, err := db.Tags(ctx, "crm", id)
+			if err != nil {
+				t.Errorf("expected no error listing tags, got %s", err)
+			}
+			if !reflect.DeepEqual(ts, []string{"cliente"}) {
+				t.Errorf("expected [cliente], got %v", ts)
+			}
+			for _, tc := range []testCase{
+				{url.Values{"tag": {"cliente"}}, 1},
+				{url.Values{"tag": {"fornecedor"}}, 0},
+			} {
+				q := newQuery(t, tc.params)
+				q.TagNamespace = "crm"
+				s, err := db.Search(ctx, q)
+				if err != nil {
+					t.Errorf("expected no error searching by tag, got %s", err)
+					continue
+				}
+				assertSearchCount(t, s, tc)
+			}
+			q := newQuery(t, url.Values{"tag": {"cliente"}})
+			q.TagNamespace = "other"
+			s, err := db.Search(ctx, q)
+			if err != nil {
+				t.Errorf("expected no error searching by tag, got %s", err)
+			}
+			assertSearchCount(t, s, testCase{url.Values{"tag": {"cliente"}}, 0})
+		})
+	}
+}
+
+func TestCoordinates(t *testing.T) {
+	id := "33683111000280"
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Error("error reading company JSON file")
+	}
+	c := string(b)
+	pg, err := setUpPostgres(id, c)
+	if err != nil {
+		t.Errorf("expected no error setting up postgres, got %s", err)
+		return
+	}
+	defer func() {
+		if err := pg.Drop(); err != nil {
+			t.Errorf("expected no error dropping the tables, got %s", err)
+		}
+		pg.Close()
+	}()
+	m, err := setUpMongo(id, c)
+	if err != nil {
+		t.Errorf("expected no error setting up mongo, got %s", err)
+		return
+	}
+	defer func() {
+		if err := m.Drop(); err != nil {
+			t.Errorf("expected no error dropping the collections, got %s", err)
+		}
+		m.Close()
+	}()
+	for _, db := range []database{pg, m} {
+		t.Run(fmt.Sprintf("%T", db), func(t *testing.T) {
+			ctx := context.Background()
+			if _, err := db.SaveEnrichment(ctx, id, `{"latitude":-22.9068,"longitude":-43.1729}`); err != nil {
+				t.Errorf("expected no error saving the coordinates, got %s", err)
+			}
+			for _, tc := range []testCase{
+				{url.Values{"bbox": {"-43.2,-22.95,-43.1,-22.85"}}, 1},
+				{url.Values{"bbox": {"-46.66,-23.57,-46.62,-23.54"}}, 0},
+				{url.Values{"near": {"-22.9068,-43.1729"}}, 1},
+				{url.Values{"near": {"-22.9168,-43.1729"}}, 0},
+				{url.Values{"near": {"-22.9168,-43.1729"}, "radius": {"2000"}}, 1},
+				{url.Values{"near": {"-22.9068,-43.1729"}, "uf": {"RJ"}}, 0},
+			} {
+				t.Run(tc.name(db), func(t *testing.T) {
+					s, err := db.Search(ctx, newQuery(t, tc.params))
+					if err != nil {
+						t.Errorf("expected no error searching by coordinates, got %s", err)
+						return
+					}
+					assertSearchCount(t, s, tc)
+				})
+			}
+		})
+	}
+}
+
+func TestMunicipalities(t *testing.T) {
+	id := "33683111000280"
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Error("error reading company JSON file")
+	}
+	c := string(b)
+	inside := `{"type":"Polygon","coordinates":[[[-46.7,-23.6],[-46.6,-23.6],[-46.6,-23.5],[-46.7,-23.6]]]}`
+	outside := `{"type":"Polygon","coordinates":[[[-43.3,-23.0],[-43.1,-23.0],[-43.1,-22.8],[-43.3,-23.0]]]}`
+	t.Run("postgres", func(t *testing.T) {
+		pg, err := setUpPostgres(id, c)
+		if err != nil {
+			t.Errorf("expected no error setting up postgres, got %s", err)
+			return
+		}
+		defer func() {
+			if err := pg.Drop(); err != nil {
+				t.Errorf("expected no error dropping the tables, got %s", err)
+			}
+			pg.Close()
+		}()
+		if !pg.postGIS {
+			t.Skip("postgis is not installed in the test database")
+		}
+		ms := []Municipality{{3550308, `{"type":"Polygon","coordinates":[[[-46.83,-24.01],[-46.36,-24.01],[-46.36,-23.36],[-46.83,-23.36],[-46.83,-24.01]]]}`}}
+		if err := pg.SaveMunicipalities(ms); err != nil {
+			t.Fatalf("expected no error saving the municipalities, got %s", err)
+		}
+		ctx := context.Background()
+		for _, tc := range []testCase{
+			{url.Values{"polygon": {inside}}, 1},
+			{url.Values{"polygon": {outside}}, 0},
+			{url.Values{"polygon": {inside}, "uf": {"RJ"}}, 0},
+		} {
+			t.Run(tc.name(pg), func(t *testing.T) {
+				s, err := pg.Search(ctx, newQuery(t, tc.params))
+				if err != nil {
+					t.Errorf("expected no error searching by polygon, got %s", err)
+					return
+				}
+				assertSearchCount(t, s, tc)
+			})
+		}
+		ps, err := pg.MunicipalityPoints(ctx, []uint32{3550308, 3304557})
+		if err != nil {
+			t.Errorf("expected no error reading the municipality points, got %s", err)
+		}
+		if len(ps) != 1 || !strings.Contains(ps[3550308], `"Point"`) {
+			t.Errorf("expected a point for 3550308, got %v", ps)
+		}
+	})
+	t.Run("mongodb", func(t *testing.T) {
+		m, err := setUpMongo(id, c)
+		if err != nil {
+			t.Errorf("expected no error setting up mongo, got %s", err)
+			return
+		}
+		defer func() {
+			if err := m.Drop(); err != nil {
+				t.Errorf("expected no error dropping the collections, got %s", err)
+			}
+			m.Close()
+		}()
+		if _, err := m.Search(context.Background(), newQuery(t, url.Values{"polygon": {inside}})); !errors.Is(err, ErrPostGISUnavailable) {
+			t.Errorf("expected %s, got %s", ErrPostGISUnavailable, err)
+		}
+	})
+}
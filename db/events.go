@@ -0,0 +1,32 @@
+package db
+
+import (
+	"encoding/json/jsontext"
+	"errors"
+	"time"
+)
+
+// Operations recorded in the event log when a dataset is loaded: a company
+// that was not in the previous load (or was deleted), a company whose JSON
+// changed, and a company that is not in this load anymore.
+const (
+	EventInsert = "insert"
+	EventUpdate = "update"
+	EventDelete = "delete"
+)
+
+// ErrEventLogUnavailable is returned when reading the event log from a
+// database without it (it is only recorded in PostgreSQL).
+var ErrEventLogUnavailable = errors.New("the event log is only available for PostgreSQL")
+
+// Event is an append-only record of a change to a company in a dataset load.
+// Inserts and updates carry the JSON of the company in that dataset version
+// (and its SHA-256), so the company at any point in time is the one of its
+// latest event up to that version. Deletions have neither.
+type Event struct {
+	At             time.Time      `json:"at" bson:"at"`
+	Operation      string         `json:"operation" bson:"operation"`
+	DatasetVersion string         `json:"dataset_version" bson:"dataset_version"`
+	Hash           string         `json:"hash" bson:"hash"`
+	Company        jsontext.Value `json:"company,omitzero" bson:"company"`
+}
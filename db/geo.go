@@ -0,0 +1,122 @@
+package db
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// LatitudeField and LongitudeField are the enrichment fields with the
+	// coordinates of the companies, used by the bbox and near filters.
+	LatitudeField  = "latitude"
+	LongitudeField = "longitude"
+
+	// MaxRadius is the maximum radius in meters of the near filter.
+	MaxRadius = 50_000
+
+	defaultRadius = 1_000 // meters
+	earthRadius   = 6_371_008.8
+	metersPerLat  = math.Pi * earthRadius / 180
+)
+
+// Errors returned by NewQuery for coordinates that cannot be parsed, or for a
+// radius above MaxRadius.
+var (
+	ErrInvalidBBox   = errors.New("invalid bbox")
+	ErrInvalidNear   = errors.New("invalid near")
+	ErrInvalidRadius = errors.New("invalid radius")
+)
+
+// BBox is a bounding box, from the south-west to the north-east corner.
+type BBox struct {
+	MinLon, MinLat, MaxLon, MaxLat float64
+}
+
+// Near is a circle around a point, with the radius in meters.
+type Near struct {
+	Lat, Lon, Radius float64
+}
+
+// bbox is the smallest bounding box containing the circle, used to take
+// advantage of the indexes before calculating the distances.
+func (n Near) bbox() BBox {
+	dLat := n.Radius / metersPerLat
+	dLon := 180.0
+	if c := math.Cos(n.Lat * math.Pi / 180); c > 1e-9 {
+		dLon = math.Min(180, dLat/c)
+	}
+	return BBox{
+		MinLon: n.Lon - dLon,
+		MinLat: math.Max(-90, n.Lat-dLat),
+		MaxLon: n.Lon + dLon,
+		MaxLat: math.Min(90, n.Lat+dLat),
+	}
+}
+
+// contains uses the haversine formula to tell whether the point is within the
+// radius.
+func (n Near) contains(lat, lon float64) bool {
+	rad := func(d float64) float64 { return d * math.Pi / 180 }
+	a := math.Pow(math.Sin(rad(lat-n.Lat)/2), 2) +
+		math.Cos(rad(n.Lat))*math.Cos(rad(lat))*math.Pow(math.Sin(rad(lon-n.Lon)/2), 2)
+	return 2*earthRadius*math.Asin(math.Sqrt(a)) <= n.Radius
+}
+
+func parseFloats(v string, n int) ([]float64, bool) {
+	ps := strings.Split(v, ",")
+	if len(ps) != n {
+		return nil, false
+	}
+	fs := make([]float64, n)
+	for i, p := range ps {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, false
+		}
+		fs[i] = f
+	}
+	return fs, true
+}
+
+func validCoordinates(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+// parseBBox parses minLon,minLat,maxLon,maxLat, returning nil if empty.
+func parseBBox(v string) (*BBox, error) {
+	if v == "" {
+		return nil, nil
+	}
+	fs, ok := parseFloats(v, 4)
+	if !ok {
+		return nil, ErrInvalidBBox
+	}
+	b := BBox{fs[0], fs[1], fs[2], fs[3]}
+	if !validCoordinates(b.MinLat, b.MinLon) || !validCoordinates(b.MaxLat, b.MaxLon) || b.MinLat > b.MaxLat || b.MinLon > b.MaxLon {
+		return nil, ErrInvalidBBox
+	}
+	return &b, nil
+}
+
+// parseNear parses lat,lon and the radius in meters (default 1 km, up to
+// MaxRadius), returning nil if empty.
+func parseNear(v, r string) (*Near, error) {
+	if v == "" {
+		return nil, nil
+	}
+	fs, ok := parseFloats(v, 2)
+	if !ok || !validCoordinates(fs[0], fs[1]) {
+		return nil, ErrInvalidNear
+	}
+	n := Near{Lat: fs[0], Lon: fs[1], Radius: defaultRadius}
+	if r != "" {
+		m, err := strconv.ParseFloat(r, 64)
+		if err != nil || m <= 0 || m > MaxRadius {
+			return nil, ErrInvalidRadius
+		}
+		n.Radius = m
+	}
+	return &n, nil
+}
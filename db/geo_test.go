@@ -0,0 +1,96 @@
+package db
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestParseBBox(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		expected *BBox
+		err      error
+	}{
+		{"-46.66,-23.57,-46.62,-23.54", &BBox{-46.66, -23.57, -46.62, -23.54}, nil},
+		{" -46.66, -23.57, -46.62, -23.54 ", &BBox{-46.66, -23.57, -46.62, -23.54}, nil},
+		{"", nil, nil},
+		{"-46.66,-23.57,-46.62", nil, ErrInvalidBBox},
+		{"-46.62,-23.57,-46.66,-23.54", nil, ErrInvalidBBox},
+		{"-46.66,-23.54,-46.62,-23.57", nil, ErrInvalidBBox},
+		{"-46.66,-91,-46.62,-23.54", nil, ErrInvalidBBox},
+		{"a,b,c,d", nil, ErrInvalidBBox},
+		{"NaN,-23.57,-46.62,-23.54", nil, ErrInvalidBBox},
+	} {
+		got, err := parseBBox(tc.value)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("expected %s to return error %v, got %v", tc.value, tc.err, err)
+		}
+		if (got == nil) != (tc.expected == nil) || (got != nil && *got != *tc.expected) {
+			t.Errorf("expected %s to be %v, got %v", tc.value, tc.expected, got)
+		}
+	}
+}
+
+func TestParseNear(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		radius   string
+		expected *Near
+		err      error
+	}{
+		{"-23.5505,-46.6333", "", &Near{-23.5505, -46.6333, defaultRadius}, nil},
+		{"-23.5505,-46.6333", "500", &Near{-23.5505, -46.6333, 500}, nil},
+		{"-23.5505,-46.6333", "50001", nil, ErrInvalidRadius},
+		{"-23.5505,-46.6333", "0", nil, ErrInvalidRadius},
+		{"-23.5505,-46.6333", "far", nil, ErrInvalidRadius},
+		{"-23.5505", "", nil, ErrInvalidNear},
+		{"-123.5505,-46.6333", "", nil, ErrInvalidNear},
+		{"", "500", nil, nil},
+	} {
+		got, err := parseNear(tc.value, tc.radius)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("expected %s with radius %s to return error %v, got %v", tc.value, tc.radius, tc.err, err)
+		}
+		if (got == nil) != (tc.expected == nil) || (got != nil && *got != *tc.expected) {
+			t.Errorf("expected %s with radius %s to be %v, got %v", tc.value, tc.radius, tc.expected, got)
+		}
+	}
+}
+
+func TestNear(t *testing.T) {
+	n := Near{-23.5505, -46.6333, 1_000} // Praça da Sé, São Paulo
+	for _, tc := range []struct {
+		desc     string
+		lat, lon float64
+		expected bool
+	}{
+		{"center", -23.5505, -46.6333, true},
+		{"about 560 meters away", -23.5455, -46.6333, true},
+		{"about 1.1 km away", -23.5505, -46.6225, false},
+		{"another city", -22.9068, -43.1729, false},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := n.contains(tc.lat, tc.lon); got != tc.expected {
+				t.Errorf("expected %t, got %t", tc.expected, got)
+			}
+			b := n.bbox()
+			if tc.expected && (tc.lat < b.MinLat || tc.lat > b.MaxLat || tc.lon < b.MinLon || tc.lon > b.MaxLon) {
+				t.Error("expected the bounding box to contain the point within the radius")
+			}
+		})
+	}
+}
+
+func TestNewQueryWithCoordinates(t *testing.T) {
+	q, err := NewQuery(url.Values{"near": {"-23.5505,-46.6333"}, "radius": {"500"}})
+	if err != nil || q == nil || q.Near == nil || q.Near.Radius != 500 {
+		t.Errorf("expected a query with a 500 meters radius, got %#v and %v", q, err)
+	}
+	if q, err := NewQuery(url.Values{"radius": {"500"}}); q != nil || err != nil {
+		t.Errorf("expected nil for a radius without near, got %#v and %v", q, err)
+	}
+	if _, err := NewQuery(url.Values{"uf": {"sp"}, "near": {"-23.5505,-46.6333"}, "radius": {"50001"}}); !errors.Is(err, ErrInvalidRadius) {
+		t.Errorf("expected an error for a radius above the maximum, got %v", err)
+	}
+}
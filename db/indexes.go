@@ -0,0 +1,74 @@
+package db
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexType is the kind of an extra index, which each database translates to
+// its equivalent index, so both of them answer the same searches efficiently.
+type IndexType string
+
+const (
+	// FieldIndex is for a field at the root of the JSON (e.g. uf): a B-tree
+	// in PostgreSQL and a single field index in MongoDB.
+	FieldIndex IndexType = "field"
+
+	// ArrayIndex is for a field of the objects in an array (e.g.
+	// qsa.cnpj_cpf_do_socio): a GIN index in PostgreSQL and a multikey index
+	// in MongoDB.
+	ArrayIndex IndexType = "array"
+)
+
+// ExtraIndex is the declarative spec of an extra index, from the path of the
+// field in the JSON in dot-notation.
+type ExtraIndex struct {
+	IsRoot bool
+	Name   string
+	Value  string
+}
+
+func newExtraIndex(v string) ExtraIndex {
+	return ExtraIndex{
+		IsRoot: !strings.Contains(v, "."),
+		Name:   fmt.Sprintf("json.%s", v),
+		Value:  v,
+	}
+}
+
+// Type is the kind of index for the path.
+func (e *ExtraIndex) Type() IndexType {
+	if e.IsRoot {
+		return FieldIndex
+	}
+	return ArrayIndex
+}
+
+// NestedPath is the JSON path of the field in the array, used in PostgreSQL.
+func (e *ExtraIndex) NestedPath() string {
+	if e.IsRoot {
+		slog.Error("cannot not parse nested path for index at the root of the json", "index", e.Value)
+		return ""
+	}
+	p := strings.SplitN(e.Value, ".", 2)
+	if len(p) != 2 {
+		slog.Error("could not parse nested path", "index", e.Value)
+		return ""
+	}
+	return fmt.Sprintf("$.%s[*].%s", p[0], p[1])
+}
+
+// mongoModel is the index in MongoDB, with the same name as in PostgreSQL.
+// MongoDB makes it a multikey index by itself when the path goes through an
+// array, so both index types have the same model.
+func (e *ExtraIndex) mongoModel() mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys:    bson.D{{Key: "json." + e.Value, Value: 1}},
+		Options: options.Index().SetName("idx_" + e.Name),
+	}
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestExtraIndex(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		typ      IndexType
+		nested   string
+		mongoKey string
+	}{
+		{"uf", FieldIndex, "", "json.uf"},
+		{"qsa.cnpj_cpf_do_socio", ArrayIndex, "$.qsa[*].cnpj_cpf_do_socio", "json.qsa.cnpj_cpf_do_socio"},
+	} {
+		e := newExtraIndex(tc.value)
+		if got := e.Type(); got != tc.typ {
+			t.Errorf("expected %s to be a %s index, got %s", tc.value, tc.typ, got)
+		}
+		if tc.nested != "" {
+			if got := e.NestedPath(); got != tc.nested {
+				t.Errorf("expected nested path of %s to be %s, got %s", tc.value, tc.nested, got)
+			}
+		}
+		m := e.mongoModel()
+		k := m.Keys.(bson.D)
+		if len(k) != 1 || k[0].Key != tc.mongoKey {
+			t.Errorf("expected mongo index on %s, got %v", tc.mongoKey, k)
+		}
+		if n := *m.Options.Name; n != "idx_"+e.Name {
+			t.Errorf("expected mongo index name to be idx_%s, got %s", e.Name, n)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+
+	"github.com/cuducos/go-cnpj"
+	"github.com/cuducos/minha-receita/transform"
+)
+
+// CheckIntegrity returns the name of the check the company JSON fails, or an
+// empty string if it passes all of them: the JSON has to have the fields of
+// the minimal profile, the types of the company structure, and a valid CNPJ.
+func CheckIntegrity(s string) string {
+	var m map[string]jsontext.Value
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		return "schema"
+	}
+	for _, f := range ProfileMinimal.Fields() {
+		if _, ok := m[f]; !ok {
+			return "schema"
+		}
+	}
+	var c transform.Company
+	if err := json.Unmarshal([]byte(s), &c); err != nil {
+		return "schema"
+	}
+	if !cnpj.IsValid(c.CNPJ) {
+		return "cnpj"
+	}
+	return ""
+}
@@ -0,0 +1,33 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Fatalf("could not read response fixture: %s", err)
+	}
+	c := string(b)
+	for _, tc := range []struct {
+		desc     string
+		json     string
+		expected string
+	}{
+		{"valid company", c, ""},
+		{"invalid check digits", strings.Replace(c, `"cnpj": "19131243000197"`, `"cnpj": "19131243000198"`, 1), "cnpj"},
+		{"truncated json", c[:len(c)/2], "schema"},
+		{"missing field", strings.Replace(c, `"uf": "SP", `, "", 1), "schema"},
+		{"wrong type", strings.Replace(c, `"uf": "SP"`, `"uf": 42`, 1), "schema"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := CheckIntegrity(tc.json); got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// LocalMetaDir is the directory, within the data directory, of the metadata
+// saved by the steps that run without a database.
+const LocalMetaDir = ".meta"
+
+// LocalMeta is a small Badger store with the same metadata methods as the
+// databases, so the steps that do not really need a database can run without
+// one and have their metadata moved to the database later.
+type LocalMeta struct{ db *badger.DB }
+
+// NewLocalMeta opens (or creates) the local metadata store in dir.
+func NewLocalMeta(dir string) (*LocalMeta, error) {
+	opt := badger.DefaultOptions(dir).
+		WithLogger(nil).
+		WithMemTableSize(8 << 20).
+		WithValueLogFileSize(1 << 20).
+		WithNumVersionsToKeep(1)
+	db, err := badger.Open(opt)
+	if err != nil {
+		return nil, fmt.Errorf("could not open local metadata in %s: %w", dir, err)
+	}
+	return &LocalMeta{db}, nil
+}
+
+// Close closes the local metadata store.
+func (l *LocalMeta) Close() {
+	if err := l.db.Close(); err != nil {
+		slog.Error("Error closing the local metadata", "error", err)
+	}
+}
+
+// MetaSave saves a key/value pair in the local metadata store.
+func (l *LocalMeta) MetaSave(k, v string) error {
+	err := l.db.Update(func(tx *badger.Txn) error { return tx.Set([]byte(k), []byte(v)) })
+	if err != nil {
+		return fmt.Errorf("error saving %s to local metadata: %w", k, err)
+	}
+	return nil
+}
+
+// MetaRead reads a key/value pair from the local metadata store.
+func (l *LocalMeta) MetaRead(k string) (string, error) {
+	var v []byte
+	err := l.db.View(func(tx *badger.Txn) error {
+		i, err := tx.Get([]byte(k))
+		if err != nil {
+			return err
+		}
+		v, err = i.ValueCopy(nil)
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return "", fmt.Errorf("metadata key %s not found", k)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error looking for metadata key %s: %w", k, err)
+	}
+	return string(v), nil
+}
+
+// MetaAll reads all key/value pairs from the local metadata store.
+func (l *LocalMeta) MetaAll() (map[string]string, error) {
+	m := make(map[string]string)
+	err := l.db.View(func(tx *badger.Txn) error {
+		it := tx.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			v, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			m[string(it.Item().KeyCopy(nil))] = string(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading local metadata: %w", err)
+	}
+	return m, nil
+}
+
+// MetaDelete removes a key from the local metadata store.
+func (l *LocalMeta) MetaDelete(k string) error {
+	if err := l.db.Update(func(tx *badger.Txn) error { return tx.Delete([]byte(k)) }); err != nil {
+		return fmt.Errorf("error deleting %s from local metadata: %w", k, err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package db
+
+import "testing"
+
+func TestLocalMeta(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLocalMeta(dir)
+	if err != nil {
+		t.Fatalf("expected no error opening local metadata, got %s", err)
+	}
+	if _, err := l.MetaRead("answer"); err == nil {
+		t.Error("expected an error reading a missing key")
+	}
+	for _, v := range []string{"41", "42"} {
+		if err := l.MetaSave("answer", v); err != nil {
+			t.Fatalf("expected no error saving metadata, got %s", err)
+		}
+	}
+	if err := l.MetaSave("question", "?"); err != nil {
+		t.Fatalf("expected no error saving metadata, got %s", err)
+	}
+	l.Close()
+
+	l, err = NewLocalMeta(dir)
+	if err != nil {
+		t.Fatalf("expected no error reopening local metadata, got %s", err)
+	}
+	defer l.Close()
+	v, err := l.MetaRead("answer")
+	if err != nil {
+		t.Errorf("expected no error reading metadata, got %s", err)
+	}
+	if v != "42" {
+		t.Errorf("expected 42, got %s", v)
+	}
+	if err := l.MetaDelete("question"); err != nil {
+		t.Errorf("expected no error deleting metadata, got %s", err)
+	}
+	m, err := l.MetaAll()
+	if err != nil {
+		t.Fatalf("expected no error reading all metadata, got %s", err)
+	}
+	if len(m) != 1 || m["answer"] != "42" {
+		t.Errorf("expected only answer=42, got %v", m)
+	}
+}
@@ -3,17 +3,23 @@ package db
 import (
 	"context"
 	"encoding/json/v2"
+	"errors"
 	"fmt"
 	"log/slog"
+	"regexp"
 	"strings"
+	"sync/atomic"
 
 	"github.com/cuducos/minha-receita/transform"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+var errOnlyPostgreSQL = errors.New("this is only available for PostgreSQL")
+
 type mongoRecord struct {
 	Id   string            `json:"id" bson:"id"`
 	Json transform.Company `json:"json" bson:"json"`
@@ -22,11 +28,38 @@ type mongoRecord struct {
 type MongoDB struct {
 	client *mongo.Client
 	db     *mongo.Database
+	pool   *mongoPool
+}
+
+// mongoPool keeps track of the connections of the driver's pool, since the
+// driver does not expose these numbers
+type mongoPool struct {
+	open  atomic.Int32
+	inUse atomic.Int32
+	max   int32
+}
+
+func (p *mongoPool) monitor(e *event.PoolEvent) {
+	switch e.Type {
+	case event.ConnectionCreated:
+		p.open.Add(1)
+	case event.ConnectionClosed:
+		p.open.Add(-1)
+	case event.GetSucceeded:
+		p.inUse.Add(1)
+	case event.ConnectionReturned:
+		p.inUse.Add(-1)
+	}
 }
 
 // NewMongoDB initializes a new MongoDB connection wrapped in a structure.
 func NewMongoDB(uri string) (MongoDB, error) {
 	opts := options.Client().ApplyURI(uri)
+	p := mongoPool{max: 100} // default max pool size of the driver
+	if opts.MaxPoolSize != nil && *opts.MaxPoolSize > 0 {
+		p.max = int32(*opts.MaxPoolSize)
+	}
+	opts.SetPoolMonitor(&event.PoolMonitor{Event: p.monitor})
 	ctx := context.Background()
 	c, err := mongo.Connect(ctx, opts)
 	if err != nil {
@@ -41,10 +74,11 @@ func NewMongoDB(uri string) (MongoDB, error) {
 	if n == "" || strings.Contains(n, "@") { // ensure the database name is valid
 		return MongoDB{}, fmt.Errorf("no database name found in the uri")
 	}
-	return MongoDB{client: c, db: c.Database(n)}, nil
+	return MongoDB{client: c, db: c.Database(n), pool: &p}, nil
 }
 
-// Create creates the required collections.
+// Create creates the required collections and the unique indexes of the API
+// keys.
 func (m *MongoDB) Create() error {
 	for _, c := range []string{companyTableName, metaTableName} {
 		slog.Info("Creating", "collection", c)
@@ -52,6 +86,13 @@ func (m *MongoDB) Create() error {
 			return fmt.Errorf("error creating collection %s: %w", c, err)
 		}
 	}
+	is := []mongo.IndexModel{ // same as the constraints of the api_key table in PostgreSQL
+		{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+	}
+	if _, err := m.db.Collection(apiKeyTableName).Indexes().CreateMany(context.Background(), is); err != nil {
+		return fmt.Errorf("error creating indexes for the api keys: %w", err)
+	}
 	return nil
 }
 
@@ -65,6 +106,12 @@ func (m *MongoDB) createIndexes() error {
 			k = idFieldName
 		}
 		i := []mongo.IndexModel{{Keys: bson.D{{Key: k, Value: 1}}}}
+		if n == companyTableName { // same as the trigram index created by post_load.sql in PostgreSQL
+			i = append(i, mongo.IndexModel{
+				Keys:    bson.D{{Key: "json.qsa.nome_socio", Value: 1}},
+				Options: options.Index().SetName(companyTableName + "_qsa_nome_socio"),
+			})
+		}
 		_, err := c.Indexes().CreateMany(context.Background(), i)
 		if err != nil {
 			return fmt.Errorf("error creating index for %s in %s: %w", k, n, err)
@@ -146,6 +193,440 @@ func (m *MongoDB) MetaRead(k string) (string, error) {
 	return result.Value, nil
 }
 
+// APIKeys lists all API keys.
+func (m *MongoDB) APIKeys() ([]APIKey, error) {
+	c := m.db.Collection(apiKeyTableName)
+	o := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cur, err := c.Find(context.Background(), bson.M{}, o)
+	if err != nil {
+		return nil, fmt.Errorf("error looking for api keys: %w", err)
+	}
+	var ks []APIKey
+	if err := cur.All(context.Background(), &ks); err != nil {
+		return nil, fmt.Errorf("error reading api keys: %w", err)
+	}
+	return ks, nil
+}
+
+// SaveAPIKey creates or replaces (based on its name) an API key.
+func (m *MongoDB) SaveAPIKey(k APIKey) error {
+	c := m.db.Collection(apiKeyTableName)
+	o := options.Replace().SetUpsert(true) // if it does not exist, creates it
+	if _, err := c.ReplaceOne(context.Background(), bson.M{"name": k.Name}, k, o); err != nil {
+		return fmt.Errorf("error saving api key %s: %w", k.Name, err)
+	}
+	return nil
+}
+
+// DeleteAPIKey deletes an API key by its name.
+func (m *MongoDB) DeleteAPIKey(n string) error {
+	c := m.db.Collection(apiKeyTableName)
+	r, err := c.DeleteOne(context.Background(), bson.M{"name": n})
+	if err != nil {
+		return fmt.Errorf("error deleting api key %s: %w", n, err)
+	}
+	if r.DeletedCount == 0 {
+		return fmt.Errorf("api key %s not found", n)
+	}
+	return nil
+}
+
+// SaveAuditEntry appends an entry to the audit collection.
+func (m *MongoDB) SaveAuditEntry(e AuditEntry) error {
+	c := m.db.Collection(auditTableName)
+	if _, err := c.InsertOne(context.Background(), e); err != nil {
+		return fmt.Errorf("error saving audit entry %s: %w", e.Action, err)
+	}
+	return nil
+}
+
+// AuditEntries lists the latest n entries of the audit collection, newest
+// first.
+func (m *MongoDB) AuditEntries(ctx context.Context, n int) ([]AuditEntry, error) {
+	c := m.db.Collection(auditTableName)
+	o := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(int64(n))
+	cur, err := c.Find(ctx, bson.M{}, o)
+	if err != nil {
+		return nil, fmt.Errorf("error looking for audit entries: %w", err)
+	}
+	var es []AuditEntry
+	if err := cur.All(ctx, &es); err != nil {
+		return nil, fmt.Errorf("error reading audit entries: %w", err)
+	}
+	return es, nil
+}
+
+// SaveCrosswalk creates or replaces the mappings from identifiers of a kind
+// (e.g. NIRE) to CNPJ. It expects pairs of identifier and CNPJ (see
+// ReadCrosswalk).
+func (m *MongoDB) SaveCrosswalk(kind string, ps [][]string) error {
+	if len(ps) == 0 {
+		return nil
+	}
+	c := m.db.Collection(crosswalkTableName)
+	i := mongo.IndexModel{Keys: bson.D{{Key: "kind", Value: 1}, {Key: "identifier", Value: 1}}, Options: options.Index().SetUnique(true)}
+	if _, err := c.Indexes().CreateOne(context.Background(), i); err != nil {
+		return fmt.Errorf("error creating index for the crosswalk: %w", err)
+	}
+	ws := make([]mongo.WriteModel, len(ps))
+	for n, r := range ps {
+		ws[n] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"kind": kind, "identifier": r[0]}).
+			SetUpdate(bson.M{"$set": bson.M{"kind": kind, "identifier": r[0], idFieldName: r[1]}}).
+			SetUpsert(true) // if it does not exist, creates it
+	}
+	if _, err := c.BulkWrite(context.Background(), ws, options.BulkWrite().SetOrdered(false)); err != nil {
+		return fmt.Errorf("error saving %s crosswalk: %w", kind, err)
+	}
+	return nil
+}
+
+// CrosswalkCNPJ returns the CNPJ mapped to an identifier of a kind (e.g. NIRE).
+func (m *MongoDB) CrosswalkCNPJ(ctx context.Context, kind, id string) (string, error) {
+	var r struct {
+		ID string `bson:"id"`
+	}
+	c := m.db.Collection(crosswalkTableName)
+	err := c.FindOne(ctx, bson.M{"kind": kind, "identifier": NormalizeCrosswalkID(id)}).Decode(&r)
+	if err == mongo.ErrNoDocuments {
+		return "", fmt.Errorf("%s %s not found", kind, id)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error looking for %s %s: %w", kind, id, err)
+	}
+	return r.ID, nil
+}
+
+// SaveEnrichment merges a patch (a JSON object) into the enrichment data of a
+// company, removing the fields set to null, and returns the resulting JSON.
+func (m *MongoDB) SaveEnrichment(ctx context.Context, id, patch string) (string, error) {
+	var p map[string]any
+	if err := json.Unmarshal([]byte(patch), &p); err != nil {
+		return "", fmt.Errorf("error deserializing enrichment patch %s: %w", patch, err)
+	}
+	set, unset := bson.M{}, bson.M{}
+	for k, v := range p {
+		if v == nil {
+			unset[jsonFieldName+"."+k] = ""
+		} else {
+			set[jsonFieldName+"."+k] = v
+		}
+	}
+	upd := bson.M{"$setOnInsert": bson.M{idFieldName: id}}
+	if len(set) > 0 {
+		upd["$set"] = set
+	}
+	if len(unset) > 0 {
+		upd["$unset"] = unset
+	}
+	var r struct {
+		JSON bson.M `bson:"json"`
+	}
+	c := m.db.Collection(enrichmentTableName)
+	o := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	if err := c.FindOneAndUpdate(ctx, bson.M{idFieldName: id}, upd, o).Decode(&r); err != nil {
+		return "", fmt.Errorf("error saving enrichment for %s: %w", id, err)
+	}
+	return enrichmentJSON(r.JSON)
+}
+
+// Enrichment returns the enrichment data of a company as a JSON object, or an
+// empty string if there is none.
+func (m *MongoDB) Enrichment(ctx context.Context, id string) (string, error) {
+	var r struct {
+		JSON bson.M `bson:"json"`
+	}
+	c := m.db.Collection(enrichmentTableName)
+	err := c.FindOne(ctx, bson.M{idFieldName: id}).Decode(&r)
+	if err == mongo.ErrNoDocuments {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading enrichment for %s: %w", id, err)
+	}
+	return enrichmentJSON(r.JSON)
+}
+
+func enrichmentJSON(d bson.M) (string, error) {
+	if d == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(map[string]any(d))
+	if err != nil {
+		return "", fmt.Errorf("error serializing enrichment: %w", err)
+	}
+	return string(b), nil
+}
+
+// AddTag tags a company in the namespace of an API key.
+func (m *MongoDB) AddTag(ctx context.Context, ns, id, t string) error {
+	c := m.db.Collection(tagTableName)
+	i := mongo.IndexModel{Keys: bson.D{{Key: "namespace", Value: 1}, {Key: "tag", Value: 1}, {Key: idFieldName, Value: 1}}, Options: options.Index().SetUnique(true)}
+	if _, err := c.Indexes().CreateOne(ctx, i); err != nil {
+		return fmt.Errorf("error creating index for the tags: %w", err)
+	}
+	d := bson.M{"namespace": ns, "tag": t, idFieldName: id}
+	o := options.Update().SetUpsert(true) // if it does not exist, creates it
+	if _, err := c.UpdateOne(ctx, d, bson.M{"$set": d}, o); err != nil {
+		return fmt.Errorf("error tagging %s with %s: %w", id, t, err)
+	}
+	return nil
+}
+
+// RemoveTag removes a tag of a company in the namespace of an API key.
+func (m *MongoDB) RemoveTag(ctx context.Context, ns, id, t string) error {
+	c := m.db.Collection(tagTableName)
+	if _, err := c.DeleteOne(ctx, bson.M{"namespace": ns, "tag": t, idFieldName: id}); err != nil {
+		return fmt.Errorf("error removing tag %s from %s: %w", t, id, err)
+	}
+	return nil
+}
+
+// Tags lists the tags of a company in the namespace of an API key.
+func (m *MongoDB) Tags(ctx context.Context, ns, id string) ([]string, error) {
+	c := m.db.Collection(tagTableName)
+	o := options.Find().SetSort(bson.D{{Key: "tag", Value: 1}})
+	cur, err := c.Find(ctx, bson.M{"namespace": ns, idFieldName: id}, o)
+	if err != nil {
+		return nil, fmt.Errorf("error looking for tags of %s: %w", id, err)
+	}
+	var rs []struct {
+		Tag string `bson:"tag"`
+	}
+	if err := cur.All(ctx, &rs); err != nil {
+		return nil, fmt.Errorf("error reading tags of %s: %w", id, err)
+	}
+	ts := make([]string, len(rs))
+	for i, r := range rs {
+		ts[i] = r.Tag
+	}
+	return ts, nil
+}
+
+// CreatePublication is only available for PostgreSQL.
+func (m *MongoDB) CreatePublication(_ context.Context) error { return errOnlyPostgreSQL }
+
+// DropPublication is only available for PostgreSQL.
+func (m *MongoDB) DropPublication(_ context.Context) error { return errOnlyPostgreSQL }
+
+// Publication is only available for PostgreSQL.
+func (m *MongoDB) Publication(_ context.Context) (Publication, error) {
+	return Publication{}, errOnlyPostgreSQL
+}
+
+// SubscriptionSQL is only available for PostgreSQL.
+func (m *MongoDB) SubscriptionSQL(_ string) (string, error) { return "", errOnlyPostgreSQL }
+
+// Bloat is only available for PostgreSQL.
+func (m *MongoDB) Bloat(_ context.Context) ([]Bloat, error) { return nil, errOnlyPostgreSQL }
+
+// Maintain is only available for PostgreSQL.
+func (m *MongoDB) Maintain(_ context.Context, _ Bloat) error { return errOnlyPostgreSQL }
+
+// SaveEvents is only available for PostgreSQL, so loads into MongoDB are not
+// recorded in the event log.
+func (m *MongoDB) SaveEvents() error {
+	slog.Warn("The event log is only available for PostgreSQL, skipping it")
+	return nil
+}
+
+// Events is only available for PostgreSQL.
+func (m *MongoDB) Events(_ context.Context, _ string) ([]Event, error) {
+	return nil, ErrEventLogUnavailable
+}
+
+// SaveMunicipalities is only available for PostgreSQL (with PostGIS).
+func (m *MongoDB) SaveMunicipalities(_ []Municipality) error { return errOnlyPostgreSQL }
+
+// MunicipalityPoints is only available for PostgreSQL (with PostGIS).
+func (m *MongoDB) MunicipalityPoints(_ context.Context, _ []uint32) (map[uint32]string, error) {
+	return nil, ErrPostGISUnavailable
+}
+
+// Capacity reports the usage of the connection pool and the WiredTiger cache
+// hit rate.
+func (m *MongoDB) Capacity(ctx context.Context) (Capacity, error) {
+	u := m.pool.inUse.Load()
+	c := Capacity{InUse: u, Idle: max(0, m.pool.open.Load()-u), Max: m.pool.max}
+	s, err := m.Stats(ctx)
+	if err != nil {
+		return c, err
+	}
+	c.CacheHitRate = s.CacheHitRate
+	return c, nil
+}
+
+// Stats reads the active connections and the WiredTiger cache hit rate from
+// serverStatus, and the size of the companies collection and its indexes from
+// collStats.
+func (m *MongoDB) Stats(ctx context.Context) (Stats, error) {
+	var s Stats
+	var st struct {
+		Connections struct {
+			Active int64 `bson:"active"`
+		} `bson:"connections"`
+		WiredTiger struct {
+			Cache map[string]any `bson:"cache"`
+		} `bson:"wiredTiger"`
+	}
+	if err := m.db.RunCommand(ctx, bson.D{{Key: "serverStatus", Value: 1}}).Decode(&st); err != nil {
+		return s, fmt.Errorf("error reading server status: %w", err)
+	}
+	s.ActiveConnections = st.Connections.Active
+	asFloat := func(k string) float64 {
+		switch v := st.WiredTiger.Cache[k].(type) {
+		case int32:
+			return float64(v)
+		case int64:
+			return float64(v)
+		case float64:
+			return v
+		}
+		return 0
+	}
+	if req := asFloat("pages requested from the cache"); req > 0 {
+		h := 1 - asFloat("pages read into cache")/req
+		s.CacheHitRate = &h
+	}
+	var cs struct {
+		Size           int64 `bson:"size"`
+		TotalIndexSize int64 `bson:"totalIndexSize"`
+	}
+	if err := m.db.RunCommand(ctx, bson.D{{Key: "collStats", Value: companyTableName}}).Decode(&cs); err != nil {
+		return s, fmt.Errorf("error reading collection stats: %w", err)
+	}
+	s.TableSize = cs.Size
+	s.IndexSize = cs.TotalIndexSize
+	return s, nil
+}
+
+// Sample returns the JSON of n random companies.
+func (m *MongoDB) Sample(ctx context.Context, n int) ([]string, error) {
+	coll := m.db.Collection(companyTableName)
+	c, err := coll.Aggregate(ctx, mongo.Pipeline{{{Key: "$sample", Value: bson.D{{Key: "size", Value: n}}}}})
+	if err != nil {
+		return nil, fmt.Errorf("error sampling %d companies: %w", n, err)
+	}
+	defer func() {
+		if err := c.Close(ctx); err != nil {
+			slog.Warn("could not close database connection", "error", err)
+		}
+	}()
+	var cs []string
+	for c.Next(ctx) {
+		v, err := c.Current.LookupErr("json")
+		if err != nil {
+			return nil, fmt.Errorf("error getting json for sampled company: %w", err)
+		}
+		b, err := bson.MarshalExtJSON(v, false, false)
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling json for sampled company: %w", err)
+		}
+		cs = append(cs, string(b))
+	}
+	if err := c.Err(); err != nil {
+		return nil, fmt.Errorf("error reading sample of companies: %w", err)
+	}
+	return cs, nil
+}
+
+// Partners returns a page of the partners (QSA) of a company, slicing the
+// array in the database so huge arrays are not sent over the wire.
+func (m *MongoDB) Partners(ctx context.Context, id string, offset, limit int) (string, error) {
+	coll := m.db.Collection(companyTableName)
+	qsa := bson.D{{Key: "$ifNull", Value: bson.A{"$json.qsa", bson.A{}}}}
+	c, err := coll.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: idFieldName, Value: id}}}},
+		{{Key: "$limit", Value: 1}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "data", Value: bson.D{{Key: "$slice", Value: bson.A{qsa, offset, limit}}}},
+			{Key: "total", Value: bson.D{{Key: "$size", Value: qsa}}},
+		}}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error looking for partners of cnpj %s: %w", id, err)
+	}
+	defer func() {
+		if err := c.Close(ctx); err != nil {
+			slog.Warn("could not close database connection", "error", err)
+		}
+	}()
+	if !c.Next(ctx) {
+		if err := c.Err(); err != nil {
+			return "", fmt.Errorf("error reading partners of cnpj %s: %w", id, err)
+		}
+		return "", fmt.Errorf("cnpj %s not found", id)
+	}
+	b, err := bson.MarshalExtJSON(c.Current, false, false) // same shape as newPartnersPage
+	if err != nil {
+		return "", fmt.Errorf("error marshalling partners of cnpj %s: %w", id, err)
+	}
+	return string(b), nil
+}
+
+// Largest returns the n largest company documents, from the largest to the
+// smallest. It reads the whole collection, so it is meant for reports, not for
+// the API.
+func (m *MongoDB) Largest(ctx context.Context, n int) ([]DocumentSize, error) {
+	coll := m.db.Collection(companyTableName)
+	c, err := coll.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "cnpj", Value: "$" + idFieldName},
+			{Key: "size", Value: bson.D{{Key: "$bsonSize", Value: "$json"}}},
+			{Key: "partners", Value: bson.D{{Key: "$size", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$json.qsa", bson.A{}}}}}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "size", Value: -1}}}},
+		{{Key: "$limit", Value: n}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error looking for the %d largest companies: %w", n, err)
+	}
+	var rs []struct {
+		CNPJ     string `bson:"cnpj"`
+		Size     int64  `bson:"size"`
+		Partners int64  `bson:"partners"`
+	}
+	if err := c.All(ctx, &rs); err != nil {
+		return nil, fmt.Errorf("error reading the largest companies: %w", err)
+	}
+	ds := make([]DocumentSize, len(rs))
+	for i, r := range rs {
+		ds[i] = DocumentSize{r.CNPJ, r.Size, r.Partners}
+	}
+	return ds, nil
+}
+
+// RowCounts returns the number of companies per bucket of CNPJ prefix (the
+// first two digits), to be compared with the counts recorded by the
+// transform.
+func (m *MongoDB) RowCounts() (map[string]int64, error) {
+	ctx := context.Background()
+	coll := m.db.Collection(companyTableName)
+	c, err := coll.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "$substrCP", Value: bson.A{"$" + idFieldName, 0, 2}}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error counting companies: %w", err)
+	}
+	var rs []struct {
+		Prefix string `bson:"_id"`
+		Count  int64  `bson:"count"`
+	}
+	if err := c.All(ctx, &rs); err != nil {
+		return nil, fmt.Errorf("error reading company counts: %w", err)
+	}
+	r := make(map[string]int64, len(rs))
+	for _, v := range rs {
+		r[v.Prefix] = v.Count
+	}
+	return r, nil
+}
+
 // Close terminates the connection to MongoDB.
 func (m *MongoDB) Close() {
 	if err := m.client.Disconnect(context.Background()); err != nil {
@@ -206,10 +687,14 @@ func (m *MongoDB) PostLoad() error {
 	return nil
 }
 
-func (m *MongoDB) GetCompany(id string) (string, error) {
+func (m *MongoDB) GetCompany(id string, p Profile) (string, error) {
 	coll := m.db.Collection(companyTableName)
 	var r bson.Raw
-	err := coll.FindOne(context.Background(), bson.M{idFieldName: id}).Decode(&r)
+	opts := options.FindOne()
+	if pr := projection(p); pr != nil {
+		opts.SetProjection(pr)
+	}
+	err := coll.FindOne(context.Background(), bson.M{idFieldName: id}, opts).Decode(&r)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return "", fmt.Errorf("no document found for CNPJ %s", id)
@@ -227,10 +712,77 @@ func (m *MongoDB) GetCompany(id string) (string, error) {
 	return string(b), nil
 }
 
+// projection selects only the fields of the profile from the company JSON.
+func projection(p Profile) bson.M {
+	fs := p.Fields()
+	if len(fs) == 0 {
+		return nil
+	}
+	pr := bson.M{}
+	for _, f := range fs {
+		pr["json."+f] = 1
+	}
+	return pr
+}
+
+// coordinates returns the IDs of the companies with coordinates in the
+// enrichment data within the bounding box and the circle of the query.
+func (m *MongoDB) coordinates(ctx context.Context, q *Query) ([]string, error) {
+	lat, lon := jsonFieldName+"."+LatitudeField, jsonFieldName+"."+LongitudeField
+	var bs []BBox
+	if q.BBox != nil {
+		bs = append(bs, *q.BBox)
+	}
+	if q.Near != nil {
+		bs = append(bs, q.Near.bbox())
+	}
+	var f []bson.M
+	for _, b := range bs {
+		f = append(f,
+			bson.M{lat: bson.M{"$gte": b.MinLat, "$lte": b.MaxLat}},
+			bson.M{lon: bson.M{"$gte": b.MinLon, "$lte": b.MaxLon}},
+		)
+	}
+	o := options.Find().SetProjection(bson.M{idFieldName: 1, lat: 1, lon: 1})
+	c, err := m.db.Collection(enrichmentTableName).Find(ctx, bson.M{"$and": f}, o)
+	if err != nil {
+		return nil, fmt.Errorf("error looking for coordinates %#v %#v: %w", q.BBox, q.Near, err)
+	}
+	var rs []struct {
+		ID   string `bson:"id"`
+		JSON struct {
+			Lat float64 `bson:"latitude"`
+			Lon float64 `bson:"longitude"`
+		} `bson:"json"`
+	}
+	if err := c.All(ctx, &rs); err != nil {
+		return nil, fmt.Errorf("error reading coordinates %#v %#v: %w", q.BBox, q.Near, err)
+	}
+	ids := []string{}
+	for _, r := range rs {
+		if q.Near == nil || q.Near.contains(r.JSON.Lat, r.JSON.Lon) {
+			ids = append(ids, r.ID)
+		}
+	}
+	return ids, nil
+}
+
 // Search returns paginated results with JSON for companies bases on a search
 // query
 func (m *MongoDB) Search(ctx context.Context, q *Query) (string, error) {
-	coll := m.db.Collection(companyTableName)
+	if q.Polygon != "" {
+		return "", fmt.Errorf("error searching for %#v: %w", q, ErrPostGISUnavailable)
+	}
+	f, err := m.searchFilter(ctx, q)
+	if err != nil {
+		return "", err
+	}
+	return m.searchPage(ctx, q, f)
+}
+
+// searchFilter builds the filter of the search query q (but not its cursor),
+// so searches and aggregations match the same companies.
+func (m *MongoDB) searchFilter(ctx context.Context, q *Query) (bson.M, error) {
 	f := bson.M{}
 	if len(q.UF) > 0 {
 		if len(q.UF) == 1 {
@@ -259,6 +811,20 @@ func (m *MongoDB) Search(ctx context.Context, q *Query) (string, error) {
 			f["json.codigo_natureza_juridica"] = bson.M{"$in": q.NaturezaJuridica}
 		}
 	}
+	if len(q.FaixaCapital) > 0 {
+		if len(q.FaixaCapital) == 1 {
+			f["json.codigo_faixa_capital_social"] = q.FaixaCapital[0]
+		} else {
+			f["json.codigo_faixa_capital_social"] = bson.M{"$in": q.FaixaCapital}
+		}
+	}
+	if len(q.Porte) > 0 {
+		if len(q.Porte) == 1 {
+			f["json.codigo_porte"] = q.Porte[0]
+		} else {
+			f["json.codigo_porte"] = bson.M{"$in": q.Porte}
+		}
+	}
 	if len(q.CNAEFiscal) > 0 {
 		if len(q.CNAEFiscal) == 1 {
 			f["json.cnae_fiscal"] = q.CNAEFiscal[0]
@@ -282,6 +848,40 @@ func (m *MongoDB) Search(ctx context.Context, q *Query) (string, error) {
 	if len(q.CNPF) > 0 {
 		f["json.qsa.cnpj_cpf_do_socio"] = bson.M{"$in": q.CNPF}
 	}
+	if len(q.Socio) > 0 { // anchored and case-sensitive so the index is used, as in postgres
+		rs := make([]primitive.Regex, len(q.Socio))
+		for i, v := range q.Socio {
+			rs[i] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(v)}
+		}
+		f["json.qsa.nome_socio"] = bson.M{"$in": rs}
+	}
+	if len(q.Tag) > 0 {
+		ids, err := m.db.Collection(tagTableName).Distinct(ctx, idFieldName, bson.M{"namespace": q.TagNamespace, "tag": bson.M{"$in": q.Tag}})
+		if err != nil {
+			return nil, fmt.Errorf("error looking for tags %v: %w", q.Tag, err)
+		}
+		f[idFieldName] = bson.M{"$in": ids}
+	}
+	if q.BBox != nil || q.Near != nil {
+		ids, err := m.coordinates(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		c := bson.M{idFieldName: bson.M{"$in": ids}}
+		if t, ok := f[idFieldName]; ok {
+			delete(f, idFieldName)
+			f["$and"] = []bson.M{{idFieldName: t}, c}
+		} else {
+			f[idFieldName] = c[idFieldName]
+		}
+	}
+	return f, nil
+}
+
+// searchPage finds the page of companies matching the filter f, starting at
+// the cursor of the search query q.
+func (m *MongoDB) searchPage(ctx context.Context, q *Query, f bson.M) (string, error) {
+	coll := m.db.Collection(companyTableName)
 	if q.Cursor != nil {
 		id, err := primitive.ObjectIDFromHex(*q.Cursor)
 		if err != nil {
@@ -290,6 +890,9 @@ func (m *MongoDB) Search(ctx context.Context, q *Query) (string, error) {
 		f["_id"] = bson.M{"$gt": id}
 	}
 	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(q.Limit))
+	if pr := projection(q.Profile); pr != nil {
+		opts.SetProjection(pr)
+	}
 	c, err := coll.Find(ctx, f, opts)
 	if err != nil {
 		return "", fmt.Errorf("error running query %#v: %w", q, err)
@@ -323,6 +926,38 @@ func (m *MongoDB) Search(ctx context.Context, q *Query) (string, error) {
 	return newPage(cs, cur), nil
 }
 
+// Aggregate returns the number of companies matching the search query q per
+// code of the field f (see AggregationFields), ordered by the code.
+func (m *MongoDB) Aggregate(ctx context.Context, q *Query, f string) ([]Bucket, error) {
+	k, ok := AggregationFields[f]
+	if !ok {
+		return nil, fmt.Errorf("error aggregating by %s: %w", f, ErrInvalidAggregation)
+	}
+	if q.Polygon != "" {
+		return nil, fmt.Errorf("error aggregating %#v: %w", q, ErrPostGISUnavailable)
+	}
+	fs, err := m.searchFilter(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	c, err := m.db.Collection(companyTableName).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: fs}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$json." + k},
+			{Key: "total", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error aggregating %#v by %s: %w", q, f, err)
+	}
+	var bs []Bucket
+	if err := c.All(ctx, &bs); err != nil {
+		return nil, fmt.Errorf("error reading aggregation of %#v by %s: %w", q, f, err)
+	}
+	return bs, nil
+}
+
 func (m *MongoDB) CreateExtraIndexes(idxs []string) error {
 	if err := transform.ValidateIndexes(idxs); err != nil {
 		return fmt.Errorf("index name error: %w", err)
@@ -331,10 +966,8 @@ func (m *MongoDB) CreateExtraIndexes(idxs []string) error {
 	c := m.db.Collection(companyTableName)
 	var i []mongo.IndexModel
 	for _, v := range idxs {
-		i = append(i, mongo.IndexModel{
-			Keys:    bson.D{{Key: fmt.Sprintf("json.%s", v), Value: 1}},
-			Options: options.Index().SetName(fmt.Sprintf("idx_json.%s", v)),
-		})
+		e := newExtraIndex(v)
+		i = append(i, e.mongoModel())
 	}
 	r, err := c.Indexes().CreateMany(context.Background(), i)
 	if err != nil {
@@ -13,7 +13,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 )
 
-var mongoDefaultIndexes = []string{"_id_", "id_1"}
+var mongoDefaultIndexes = []string{"_id_", "id_1", "cnpj_qsa_nome_socio"}
 
 func setUpMongo(id, c string) (*MongoDB, error) {
 	u := os.Getenv("TEST_MONGODB_URL")
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// MaxPolygonSize limits the size in bytes of the GeoJSON of the polygon
+// filter, as it is sent in the URL.
+const MaxPolygonSize = 16 * 1024
+
+// ErrInvalidPolygon is returned by NewQuery for a polygon filter that is not a
+// GeoJSON Polygon or MultiPolygon, or that is larger than MaxPolygonSize.
+var ErrInvalidPolygon = errors.New("invalid polygon")
+
+// ErrPostGISUnavailable is returned by the features of the PostGIS mode when
+// the PostGIS extension is not installed or the geometries of the
+// municipalities are not loaded (see SaveMunicipalities).
+var ErrPostGISUnavailable = errors.New("postgis mode is not available, install postgis and load the municipalities")
+
+// Municipality is the geometry (GeoJSON) of a municipality identified by its
+// IBGE code.
+type Municipality struct {
+	Code     uint32
+	Geometry string
+}
+
+type municipalityFeature struct {
+	Properties map[string]jsontext.Value `json:"properties"`
+	Geometry   jsontext.Value            `json:"geometry"`
+}
+
+// code reads the IBGE code from the properties, as named in the IBGE API
+// (codarea) or in the shapefiles of the Malha Municipal (CD_MUN).
+func (f municipalityFeature) code() (uint32, error) {
+	for _, k := range []string{"codarea", "CD_MUN"} {
+		v, ok := f.Properties[k]
+		if !ok {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(v, &s); err != nil {
+			s = string(v) // numbers instead of strings
+		}
+		n, err := strconv.ParseUint(s, 10, 32)
+		if err != nil || len(s) != 7 {
+			return 0, fmt.Errorf("invalid ibge code %s", s)
+		}
+		return uint32(n), nil
+	}
+	return 0, errors.New("missing ibge code (codarea or CD_MUN)")
+}
+
+// ReadMunicipalities reads a GeoJSON FeatureCollection with the geometries of
+// the municipalities, such as the one from the IBGE API.
+func ReadMunicipalities(b []byte) ([]Municipality, error) {
+	var c struct {
+		Features []municipalityFeature `json:"features"`
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("error parsing municipalities geojson: %w", err)
+	}
+	if len(c.Features) == 0 {
+		return nil, errors.New("no features in municipalities geojson")
+	}
+	ms := make([]Municipality, 0, len(c.Features))
+	for i, f := range c.Features {
+		n, err := f.code()
+		if err != nil {
+			return nil, fmt.Errorf("error reading feature %d of municipalities geojson: %w", i+1, err)
+		}
+		if _, ok := geometryType(f.Geometry, "Polygon", "MultiPolygon"); !ok {
+			return nil, fmt.Errorf("invalid geometry in feature %d of municipalities geojson (ibge code %d)", i+1, n)
+		}
+		ms = append(ms, Municipality{n, string(f.Geometry)})
+	}
+	return ms, nil
+}
+
+// geometryType returns the type of a GeoJSON geometry, if it is one of ts and
+// has coordinates.
+func geometryType(b []byte, ts ...string) (string, bool) {
+	var g struct {
+		Type        string         `json:"type"`
+		Coordinates jsontext.Value `json:"coordinates"`
+	}
+	if err := json.Unmarshal(b, &g); err != nil {
+		return "", false
+	}
+	if !slices.Contains(ts, g.Type) || len(g.Coordinates) == 0 || g.Coordinates[0] != '[' {
+		return "", false
+	}
+	return g.Type, true
+}
+
+// parsePolygon validates a GeoJSON geometry (Polygon or MultiPolygon) with
+// coordinates in longitude and latitude.
+func parsePolygon(v string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+	if len(v) > MaxPolygonSize {
+		return "", ErrInvalidPolygon
+	}
+	if _, ok := geometryType([]byte(v), "Polygon", "MultiPolygon"); !ok {
+		return "", ErrInvalidPolygon
+	}
+	return v, nil
+}
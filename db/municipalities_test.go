@@ -0,0 +1,66 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReadMunicipalities(t *testing.T) {
+	g := `{"type":"MultiPolygon","coordinates":[[[[-46.8,-24.0],[-46.3,-24.0],[-46.3,-23.3],[-46.8,-24.0]]]]}`
+	for _, tc := range []struct {
+		name     string
+		geojson  string
+		expected []Municipality
+	}{
+		{"ibge api", `{"type":"FeatureCollection","features":[{"type":"Feature","properties":{"codarea":"3550308"},"geometry":` + g + `}]}`, []Municipality{{3550308, g}}},
+		{"shapefile", `{"type":"FeatureCollection","features":[{"type":"Feature","properties":{"CD_MUN":3550308},"geometry":` + g + `}]}`, []Municipality{{3550308, g}}},
+		{"missing code", `{"type":"FeatureCollection","features":[{"type":"Feature","properties":{},"geometry":` + g + `}]}`, nil},
+		{"invalid code", `{"type":"FeatureCollection","features":[{"type":"Feature","properties":{"codarea":"35"},"geometry":` + g + `}]}`, nil},
+		{"point", `{"type":"FeatureCollection","features":[{"type":"Feature","properties":{"codarea":"3550308"},"geometry":{"type":"Point","coordinates":[-46.6,-23.5]}}]}`, nil},
+		{"no features", `{"type":"FeatureCollection","features":[]}`, nil},
+		{"not json", `municipios`, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ReadMunicipalities([]byte(tc.geojson))
+			if tc.expected == nil {
+				if err == nil {
+					t.Errorf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if len(got) != len(tc.expected) || got[0] != tc.expected[0] {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestParsePolygon(t *testing.T) {
+	p := `{"type":"Polygon","coordinates":[[[-46.7,-23.6],[-46.6,-23.6],[-46.6,-23.5],[-46.7,-23.6]]]}`
+	for _, tc := range []struct {
+		value    string
+		expected string
+		err      error
+	}{
+		{p, p, nil},
+		{`{"type":"MultiPolygon","coordinates":[]}`, `{"type":"MultiPolygon","coordinates":[]}`, nil},
+		{`{"type":"Point","coordinates":[-46.6,-23.5]}`, "", ErrInvalidPolygon},
+		{`{"type":"Polygon"}`, "", ErrInvalidPolygon},
+		{`{"type":"Polygon","coordinates":"-46.6,-23.5"}`, "", ErrInvalidPolygon},
+		{"-46.66,-23.57,-46.62,-23.54", "", ErrInvalidPolygon},
+		{`{"type":"Polygon","coordinates":[[` + strings.Repeat("[-46.7,-23.6],", MaxPolygonSize/14) + `[-46.7,-23.6]]]}`, "", ErrInvalidPolygon},
+		{"", "", nil},
+	} {
+		got, err := parsePolygon(tc.value)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("expected %.32s to return error %v, got %v", tc.value, tc.err, err)
+		}
+		if got != tc.expected {
+			t.Errorf("expected %s to be %q, got %q", tc.value, tc.expected, got)
+		}
+	}
+}
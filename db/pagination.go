@@ -6,11 +6,16 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
 const (
 	defaultLimit = 256
 	maxLimit     = 1024
+
+	// minNameLength is the minimum length of a partner name search term, shorter
+	// terms are too generic to take advantage of the trigram index
+	minNameLength = 3
 )
 
 func isValid(p string) bool {
@@ -51,24 +56,113 @@ func parseURLParamsToUInt(q []string) []uint32 {
 	return r
 }
 
+// parses codes in which zero is a valid value (e.g. porte)
+func parseURLParamsToCodes(q []string) []uint32 {
+	var r []uint32
+	for _, v := range parseURLParams(q) {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			slog.Info("Ignoring invalid code", "code", v)
+			continue
+		}
+		r = append(r, uint32(n))
+	}
+	return r
+}
+
+func isValidName(n string) bool {
+	if len([]rune(n)) < minNameLength {
+		return false
+	}
+	for _, c := range n {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && !strings.ContainsRune(" .'-&", c) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseURLParamsToNames(q []string) []string {
+	var r []string
+	for _, v := range q {
+		for s := range strings.SplitSeq(v, ",") {
+			s = strings.Join(strings.Fields(strings.ToUpper(s)), " ")
+			if !isValidName(s) {
+				slog.Info("Ignoring invalid partner name", "nome", s)
+				continue
+			}
+			r = append(r, s)
+		}
+	}
+	return r
+}
+
+// SearchParam is a URL parameter of the paginated search.
+type SearchParam struct {
+	Name        string
+	Description string
+	Example     string
+	Integer     bool // values are numeric codes
+	Filter      bool // false for the parameters that configure the pagination
+	Single      bool // filters that do not accept more than one value
+}
+
+// SearchParams are the URL parameters parsed by NewQuery. Filters accept more
+// than one value (except the coordinates), either repeating the parameter or
+// separating values with commas.
+var SearchParams = []SearchParam{
+	{"cnae_fiscal", "Código do CNAE fiscal", "6204000", true, true, false},
+	{"cnae", "Código do CNAE fiscal ou secundário", "6204000", true, true, false},
+	{"codigo_faixa_capital_social", "Código da faixa de capital social", "2", true, true, false},
+	{"cnpf", "CNPJ ou CPF (no formato ***456789**) da pessoa no quadro societário", "***456789**", false, true, false},
+	{"municipio", "Código do município pelo IBGE ou SIAFI", "3550308", true, true, false},
+	{"natureza_juridica", "Código da natureza jurídica", "2062", true, true, false},
+	{"codigo_porte", "Código do porte da empresa", "5", true, true, false},
+	{"socio", fmt.Sprintf("Início do nome da pessoa no quadro societário (mínimo de %d caracteres)", minNameLength), "haydee svab", false, true, false},
+	{"uf", "Sigla da UF", "SP", false, true, false},
+	{"tag", "Etiqueta atribuída à empresa pela chave de API da requisição (requer chave de API)", "cliente", false, true, false},
+	{"bbox", "Retângulo com longitude e latitude mínimas e máximas (coordenadas do enriquecimento)", "-46.66,-23.57,-46.62,-23.54", false, true, true},
+	{"near", "Latitude e longitude do centro de um círculo (coordenadas do enriquecimento)", "-23.5505,-46.6333", false, true, true},
+	{"polygon", "Polígono desenhado em GeoJSON (Polygon ou MultiPolygon, em longitude e latitude), filtra as empresas dos municípios que o intersectam (requer o modo PostGIS)", `{"type":"Polygon","coordinates":[[[-46.7,-23.6],[-46.6,-23.6],[-46.6,-23.5],[-46.7,-23.6]]]}`, false, true, true},
+	{"radius", fmt.Sprintf("Raio em metros do círculo do near (padrão %d, máximo %d)", defaultRadius, MaxRadius), "500", true, false, false},
+	{"limit", fmt.Sprintf("Número máximo de CNPJs por página (máximo de %d, padrão %d)", maxLimit, defaultLimit), "42", true, false, false},
+	{"cursor", "Cursor retornado pela página anterior, para requisitar a próxima página", "42", false, false, false},
+}
+
 type Query struct {
 	CNAE             []uint32
 	CNAEFiscal       []uint32
 	CNPF             []string // CNPJ or CPF in the QSA
+	FaixaCapital     []uint32 // codigo_faixa_capital_social
 	Municipio        []uint32 // IBGE or SIAFI
 	NaturezaJuridica []uint32
+	Porte            []uint32
+	Socio            []string // name of the person in the QSA
 	UF               []string
+	Tag              []string
+	TagNamespace     string // name of the API key the tags belong to
+	BBox             *BBox  // coordinates in the enrichment data
+	Near             *Near  // coordinates in the enrichment data
+	Polygon          string // GeoJSON geometry intersecting the municipalities
 	Cursor           *string
 	Limit            uint32
+	Profile          Profile // not a filter, it selects the fields in the response
 }
 
 func (q *Query) empty() bool {
 	return len(q.CNAE) == 0 &&
 		len(q.CNAEFiscal) == 0 &&
 		len(q.CNPF) == 0 &&
+		len(q.FaixaCapital) == 0 &&
 		len(q.Municipio) == 0 &&
 		len(q.NaturezaJuridica) == 0 &&
-		len(q.UF) == 0
+		len(q.Porte) == 0 &&
+		len(q.Socio) == 0 &&
+		len(q.UF) == 0 &&
+		len(q.Tag) == 0 &&
+		q.BBox == nil &&
+		q.Near == nil &&
+		q.Polygon == ""
 }
 
 func (q *Query) CursorAsInt() (int, error) {
@@ -82,7 +176,22 @@ func (q *Query) CursorAsInt() (int, error) {
 	return strconv.Atoi(c)
 }
 
-func NewQuery(v url.Values) *Query {
+// NewQuery parses the filters of the paginated search, returning nil if there
+// are none. Invalid coordinates and polygons return an error instead of being
+// ignored, as ignoring them would widen the search.
+func NewQuery(v url.Values) (*Query, error) {
+	b, err := parseBBox(v.Get("bbox"))
+	if err != nil {
+		return nil, err
+	}
+	n, err := parseNear(v.Get("near"), v.Get("radius"))
+	if err != nil {
+		return nil, err
+	}
+	p, err := parsePolygon(v.Get("polygon"))
+	if err != nil {
+		return nil, err
+	}
 	q := Query{
 		UF:               parseURLParams(v["uf"]),
 		Municipio:        parseURLParamsToUInt(v["municipio"]),
@@ -90,11 +199,18 @@ func NewQuery(v url.Values) *Query {
 		CNAE:             parseURLParamsToUInt(v["cnae"]),
 		CNAEFiscal:       parseURLParamsToUInt(v["cnae_fiscal"]),
 		NaturezaJuridica: parseURLParamsToUInt(v["natureza_juridica"]),
+		FaixaCapital:     parseURLParamsToUInt(v["codigo_faixa_capital_social"]),
+		Porte:            parseURLParamsToCodes(v["codigo_porte"]),
+		Socio:            parseURLParamsToNames(v["socio"]),
+		Tag:              parseURLParamsToTags(v["tag"]),
+		BBox:             b,
+		Near:             n,
+		Polygon:          p,
 		Limit:            defaultLimit,
 		Cursor:           nil,
 	}
 	if q.empty() {
-		return nil
+		return nil, nil
 	}
 	for _, v := range parseURLParamsToUInt(v["limit"]) {
 		if v > maxLimit {
@@ -107,7 +223,7 @@ func NewQuery(v url.Values) *Query {
 		q.Cursor = &c
 
 	}
-	return &q
+	return &q, nil
 }
 
 // builds a paginated search JSON response without depending on marshalling and
@@ -122,3 +238,16 @@ func newPage(d []string, c string) string {
 	}
 	return fmt.Sprintf(`{%s}`, strings.Join(ps, ","))
 }
+
+// DefaultPartnersLimit and MaxPartnersLimit are the default and maximum number
+// of partners (QSA) in each page of the partners of a company.
+const (
+	DefaultPartnersLimit = 100
+	MaxPartnersLimit     = 1000
+)
+
+// builds a page of the partners of a company the same way newPage does, with
+// the total number of partners instead of a cursor.
+func newPartnersPage(d string, t int64) string {
+	return fmt.Sprintf(`{"data":%s,"total":%d}`, d, t)
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestNewQueryWithSocio(t *testing.T) {
+	for _, tc := range []struct {
+		params   url.Values
+		expected []string
+	}{
+		{url.Values{"socio": {"haydee svab"}}, []string{"HAYDEE SVAB"}},
+		{url.Values{"socio": {"  haydee   svab "}}, []string{"HAYDEE SVAB"}},
+		{url.Values{"socio": {"haydee,svab"}}, []string{"HAYDEE", "SVAB"}},
+		{url.Values{"socio": {"joão d'ávila"}}, []string{"JOÃO D'ÁVILA"}},
+		{url.Values{"socio": {"ab", "haydee"}}, []string{"HAYDEE"}},
+		{url.Values{"socio": {"haydee%"}, "uf": {"sp"}}, nil},
+	} {
+		t.Run(tc.params.Encode(), func(t *testing.T) {
+			q := newQuery(t, tc.params)
+			if q == nil {
+				t.Fatal("expected a query, got nil")
+			}
+			if !slices.Equal(q.Socio, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, q.Socio)
+			}
+		})
+	}
+	if q := newQuery(t, url.Values{"socio": {"ab"}}); q != nil {
+		t.Errorf("expected nil for a query with a name too short, got %#v", q)
+	}
+}
+
+func TestSearchParams(t *testing.T) {
+	for _, p := range SearchParams {
+		t.Run(p.Name, func(t *testing.T) {
+			q := newQuery(t, url.Values{p.Name: {p.Example}})
+			if p.Filter && q == nil {
+				t.Errorf("expected %s=%s to be parsed as a filter, got nil", p.Name, p.Example)
+			}
+			if !p.Filter && q != nil {
+				t.Errorf("expected %s=%s not to be parsed as a filter, got %#v", p.Name, p.Example, q)
+			}
+		})
+	}
+}
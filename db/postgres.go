@@ -3,7 +3,10 @@ package db
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
@@ -15,17 +18,27 @@ import (
 	"github.com/cuducos/minha-receita/transform"
 	"github.com/huandu/go-sqlbuilder"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 const (
-	companyTableName = "cnpj"
-	metaTableName    = "meta"
-	cursorFieldName  = "cursor"
-	idFieldName      = "id"
-	jsonFieldName    = "json"
-	keyFieldName     = "key"
-	valueFieldName   = "value"
+	companyTableName      = "cnpj"
+	metaTableName         = "meta"
+	apiKeyTableName       = "api_key"
+	auditTableName        = "audit"
+	crosswalkTableName    = "crosswalk"
+	enrichmentTableName   = "enrichment"
+	tagTableName          = "tag"
+	municipalityTableName = "municipality"
+	eventTableName        = "event"
+	eventStateTableName   = "event_state"
+	cursorFieldName       = "cursor"
+	idFieldName           = "id"
+	jsonFieldName         = "json"
+	hashFieldName         = "hash"
+	keyFieldName          = "key"
+	valueFieldName        = "value"
 )
 
 //go:embed postgres
@@ -58,40 +71,32 @@ func newSQLTemplate(f fs.DirEntry) sqlTemplate {
 	}
 }
 
-type ExtraIndex struct {
-	IsRoot bool
-	Name   string
-	Value  string
-}
-
-func (e *ExtraIndex) NestedPath() string {
-	if e.IsRoot {
-		slog.Error("cannot not parse nested path for index at the root of the json", "index", e.Value)
-		return ""
-	}
-	p := strings.SplitN(e.Value, ".", 2)
-	if len(p) != 2 {
-		slog.Error("could not parse nested path", "index", e.Value)
-		return ""
-	}
-	return fmt.Sprintf("$.%s[*].%s", p[0], p[1])
-}
-
 // PostgreSQL database interface.
 type PostgreSQL struct {
-	pool             *pgxpool.Pool
-	uri              string
-	schema           string
-	getCompanyQuery  string
-	metaReadQuery    string
-	CompanyTableName string
-	MetaTableName    string
-	CursorFieldName  string
-	IDFieldName      string
-	JSONFieldName    string
-	KeyFieldName     string
-	ValueFieldName   string
-	ExtraIndexes     []ExtraIndex
+	pool                  *pgxpool.Pool
+	uri                   string
+	schema                string
+	getCompanyQuery       string
+	metaReadQuery         string
+	CompanyTableName      string
+	MetaTableName         string
+	APIKeyTableName       string
+	AuditTableName        string
+	CrosswalkTableName    string
+	EnrichmentTableName   string
+	TagTableName          string
+	MunicipalityTableName string
+	EventTableName        string
+	EventStateTableName   string
+	CursorFieldName       string
+	IDFieldName           string
+	JSONFieldName         string
+	HashFieldName         string
+	KeyFieldName          string
+	ValueFieldName        string
+	ExtraIndexes          []ExtraIndex
+	earthDistance         bool // earthdistance extension is installed
+	postGIS               bool // postgis extension is installed
 }
 
 func (p *PostgreSQL) renderTemplate(key string) (string, error) {
@@ -122,6 +127,70 @@ func (p *PostgreSQL) MetaTableFullName() string {
 	return fmt.Sprintf("%s.%s", p.schema, p.MetaTableName)
 }
 
+// APIKeyTableFullName is the name of the schame and table in dot-notation.
+func (p *PostgreSQL) APIKeyTableFullName() string {
+	return fmt.Sprintf("%s.%s", p.schema, p.APIKeyTableName)
+}
+
+// AuditTableFullName is the name of the schame and table in dot-notation.
+func (p *PostgreSQL) AuditTableFullName() string {
+	return fmt.Sprintf("%s.%s", p.schema, p.AuditTableName)
+}
+
+// MunicipalityTableFullName is the name of the schame and table in dot-notation.
+func (p *PostgreSQL) MunicipalityTableFullName() string {
+	return fmt.Sprintf("%s.%s", p.schema, p.MunicipalityTableName)
+}
+
+// EventTableFullName is the name of the schame and table in dot-notation.
+func (p *PostgreSQL) EventTableFullName() string {
+	return fmt.Sprintf("%s.%s", p.schema, p.EventTableName)
+}
+
+// EventStateTableFullName is the name of the schame and table in dot-notation.
+func (p *PostgreSQL) EventStateTableFullName() string {
+	return fmt.Sprintf("%s.%s", p.schema, p.EventStateTableName)
+}
+
+// CrosswalkTableFullName is the name of the schame and table in dot-notation.
+func (p *PostgreSQL) CrosswalkTableFullName() string {
+	return fmt.Sprintf("%s.%s", p.schema, p.CrosswalkTableName)
+}
+
+// EnrichmentTableFullName is the name of the schame and table in dot-notation.
+func (p *PostgreSQL) EnrichmentTableFullName() string {
+	return fmt.Sprintf("%s.%s", p.schema, p.EnrichmentTableName)
+}
+
+// coordinate is the expression with a numeric field of the enrichment data,
+// null if the field is missing or is not a number.
+func (p *PostgreSQL) coordinate(f string) string {
+	return fmt.Sprintf(
+		"(CASE WHEN jsonb_typeof(%s -> '%s') = 'number' THEN (%s ->> '%s')::float8 END)",
+		p.JSONFieldName,
+		f,
+		p.JSONFieldName,
+		f,
+	)
+}
+
+// Latitude is the expression with the latitude in the enrichment data.
+func (p *PostgreSQL) Latitude() string { return p.coordinate(LatitudeField) }
+
+// Longitude is the expression with the longitude in the enrichment data.
+func (p *PostgreSQL) Longitude() string { return p.coordinate(LongitudeField) }
+
+// PublicationName is the name of the logical replication publication, one per
+// schema so different schemas in the same database can be published.
+func (p *PostgreSQL) PublicationName() string {
+	return fmt.Sprintf("minha_receita_%s", p.schema)
+}
+
+// TagTableFullName is the name of the schame and table in dot-notation.
+func (p *PostgreSQL) TagTableFullName() string {
+	return fmt.Sprintf("%s.%s", p.schema, p.TagTableName)
+}
+
 // Create creates the required database table.
 func (p *PostgreSQL) Create() error {
 	slog.Info("Creating", "table", p.CompanyTableFullName())
@@ -129,10 +198,22 @@ func (p *PostgreSQL) Create() error {
 	if err != nil {
 		return fmt.Errorf("error rendering create template: %w", err)
 	}
-	if _, err := p.pool.Exec(context.Background(), s); err != nil {
+	if _, err := p.pool.Exec(withQueryName(context.Background(), "create"), s); err != nil {
 		return fmt.Errorf("error creating table with: %s\n%w", s, err)
 	}
-	return nil
+	if err := p.createAPIKeyTable(); err != nil {
+		return err
+	}
+	if err := p.createEnrichmentTable(); err != nil {
+		return err
+	}
+	if err := p.createTagTable(); err != nil {
+		return err
+	}
+	if err := p.refreshPublication(); err != nil {
+		return err
+	}
+	return p.createAuditTable()
 }
 
 // Drop drops the database table created by `Create`.
@@ -142,7 +223,7 @@ func (p *PostgreSQL) Drop() error {
 	if err != nil {
 		return fmt.Errorf("error rendering drop template: %w", err)
 	}
-	if _, err := p.pool.Exec(context.Background(), s); err != nil {
+	if _, err := p.pool.Exec(withQueryName(context.Background(), "drop"), s); err != nil {
 		return fmt.Errorf("error dropping table with: %s\n%w", s, err)
 	}
 	return nil
@@ -154,12 +235,13 @@ func (p *PostgreSQL) Drop() error {
 func (p *PostgreSQL) CreateCompanies(batch [][]string) error {
 	b := make([][]any, len(batch))
 	for i, r := range batch {
-		b[i] = []any{r[0], r[1]}
+		h := sha256.Sum256([]byte(r[1]))
+		b[i] = []any{r[0], r[1], hex.EncodeToString(h[:])}
 	}
 	_, err := p.pool.CopyFrom(
 		context.Background(),
 		pgx.Identifier{p.CompanyTableName},
-		[]string{idFieldName, jsonFieldName},
+		[]string{idFieldName, jsonFieldName, hashFieldName},
 		pgx.CopyFromRows(b),
 	)
 	if err != nil {
@@ -169,9 +251,17 @@ func (p *PostgreSQL) CreateCompanies(batch [][]string) error {
 }
 
 // GetCompany returns the JSON of a company based on a CNPJ number.
-func (p *PostgreSQL) GetCompany(id string) (string, error) {
+func (p *PostgreSQL) GetCompany(id string, pr Profile) (string, error) {
 	ctx := context.Background()
-	rows, err := p.pool.Query(ctx, p.getCompanyQuery, id)
+	s, a := p.getCompanyQuery, []any{id}
+	if len(pr.Fields()) > 0 {
+		b := sqlbuilder.PostgreSQL.NewSelectBuilder()
+		b.Select(p.projection(pr))
+		b.From(p.CompanyTableFullName())
+		b.Where(b.Equal(p.IDFieldName, id))
+		s, a = b.Build()
+	}
+	rows, err := p.pool.Query(withQueryName(ctx, "get"), s, a...)
 	if err != nil {
 		return "", fmt.Errorf("error looking for cnpj %s: %w", id, err)
 	}
@@ -182,9 +272,22 @@ func (p *PostgreSQL) GetCompany(id string) (string, error) {
 	return j, nil
 }
 
+// projection selects only the fields of the profile from the company JSON.
+func (p *PostgreSQL) projection(pr Profile) string {
+	fs := pr.Fields()
+	if len(fs) == 0 {
+		return p.JSONFieldName
+	}
+	ps := make([]string, len(fs))
+	for i, f := range fs {
+		ps[i] = fmt.Sprintf("'%s', %s -> '%s'", f, p.JSONFieldName, f)
+	}
+	return fmt.Sprintf("jsonb_build_object(%s)", strings.Join(ps, ", "))
+}
+
 func (p *PostgreSQL) searchQuery(q *Query) *sqlbuilder.SelectBuilder {
 	b := sqlbuilder.PostgreSQL.NewSelectBuilder()
-	b.Select(p.CursorFieldName, p.JSONFieldName)
+	b.Select(p.CursorFieldName, p.projection(q.Profile))
 	b.From(p.CompanyTableFullName())
 	b.OrderByAsc(p.CursorFieldName)
 	b.Limit(int(q.Limit))
@@ -194,6 +297,13 @@ func (p *PostgreSQL) searchQuery(q *Query) *sqlbuilder.SelectBuilder {
 			b.Where(b.GreaterThan(p.CursorFieldName, c))
 		}
 	}
+	p.searchFilters(b, q)
+	return b
+}
+
+// searchFilters adds the conditions of the search query q (but not its cursor)
+// to b, so searches and aggregations match the same companies.
+func (p *PostgreSQL) searchFilters(b *sqlbuilder.SelectBuilder, q *Query) {
 	if len(q.UF) > 0 {
 		c := make([]string, len(q.UF))
 		for i, v := range q.UF {
@@ -216,6 +326,20 @@ func (p *PostgreSQL) searchQuery(q *Query) *sqlbuilder.SelectBuilder {
 		}
 		b.Where(b.Or(c...))
 	}
+	if len(q.FaixaCapital) > 0 {
+		c := make([]string, len(q.FaixaCapital))
+		for i, v := range q.FaixaCapital {
+			c[i] = fmt.Sprintf("json -> 'codigo_faixa_capital_social' = '%d'::jsonb", v)
+		}
+		b.Where(b.Or(c...))
+	}
+	if len(q.Porte) > 0 {
+		c := make([]string, len(q.Porte))
+		for i, v := range q.Porte {
+			c[i] = fmt.Sprintf("json -> 'codigo_porte' = '%d'::jsonb", v)
+		}
+		b.Where(b.Or(c...))
+	}
 	if len(q.CNAEFiscal) > 0 {
 		c := make([]string, len(q.CNAEFiscal))
 		for i, v := range q.CNAEFiscal {
@@ -243,7 +367,37 @@ func (p *PostgreSQL) searchQuery(q *Query) *sqlbuilder.SelectBuilder {
 		}
 		b.Where(b.Or(c...))
 	}
-	return b
+	if len(q.Tag) > 0 {
+		ts := make([]any, len(q.Tag))
+		for i, v := range q.Tag {
+			ts[i] = v
+		}
+		s := sqlbuilder.PostgreSQL.NewSelectBuilder()
+		s.Select(p.IDFieldName)
+		s.From(p.TagTableFullName())
+		s.Where(s.Equal("namespace", q.TagNamespace), s.In("tag", ts...))
+		b.Where(b.In(p.IDFieldName, s))
+	}
+	if q.BBox != nil || q.Near != nil {
+		b.Where(b.In(p.IDFieldName, p.coordinatesQuery(q)))
+	}
+	if q.Polygon != "" {
+		s := sqlbuilder.PostgreSQL.NewSelectBuilder()
+		s.Select("to_jsonb(code)")
+		s.From(p.MunicipalityTableFullName())
+		s.Where(fmt.Sprintf("ST_Intersects(geometry, ST_SetSRID(ST_GeomFromGeoJSON(%s), 4326))", s.Var(q.Polygon)))
+		b.Where(b.In("json -> 'codigo_municipio_ibge'", s))
+	}
+	if len(q.Socio) > 0 {
+		c := make([]string, len(q.Socio))
+		for i, v := range q.Socio {
+			c[i] = fmt.Sprintf( // names start right after a quote in the text of the json array
+				"(jsonb_path_query_array(json, '$.qsa[*].nome_socio'))::text LIKE %s",
+				b.Var(`%"`+v+"%"),
+			)
+		}
+		b.Where(b.Or(c...))
+	}
 }
 
 type postgresRecord struct {
@@ -254,9 +408,15 @@ type postgresRecord struct {
 // Search returns paginated results with JSON for companies bases on a search
 // query
 func (p *PostgreSQL) Search(ctx context.Context, q *Query) (string, error) {
+	if q.Polygon != "" && !p.postGIS {
+		return "", fmt.Errorf("error searching for %#v: %w", q, ErrPostGISUnavailable)
+	}
 	s, a := p.searchQuery(q).Build()
 	slog.Debug("paginated search", "query", s, "args", a)
-	rows, err := p.pool.Query(ctx, s, a...)
+	rows, err := p.pool.Query(withQueryName(ctx, "search"), s, a...)
+	if q.Polygon != "" && isUndefinedTable(err) {
+		return "", fmt.Errorf("error searching for %#v: %w", q, ErrPostGISUnavailable)
+	}
 	if err != nil {
 		return "", fmt.Errorf("error searching for %#v: %w", q, err)
 	}
@@ -276,6 +436,96 @@ func (p *PostgreSQL) Search(ctx context.Context, q *Query) (string, error) {
 
 }
 
+// Aggregate returns the number of companies matching the search query q per
+// code of the field f (see AggregationFields), ordered by the code.
+func (p *PostgreSQL) Aggregate(ctx context.Context, q *Query, f string) ([]Bucket, error) {
+	k, ok := AggregationFields[f]
+	if !ok {
+		return nil, fmt.Errorf("error aggregating by %s: %w", f, ErrInvalidAggregation)
+	}
+	if q.Polygon != "" && !p.postGIS {
+		return nil, fmt.Errorf("error aggregating %#v: %w", q, ErrPostGISUnavailable)
+	}
+	b := sqlbuilder.PostgreSQL.NewSelectBuilder()
+	b.Select(fmt.Sprintf("(json ->> '%s')::int", k), "count(*)")
+	b.From(p.CompanyTableFullName())
+	p.searchFilters(b, q)
+	b.GroupBy("1")
+	b.OrderBy("1 NULLS FIRST") // as in mongodb
+	s, a := b.Build()
+	slog.Debug("aggregation", "query", s, "args", a)
+	rows, err := p.pool.Query(withQueryName(ctx, "aggregate"), s, a...)
+	if q.Polygon != "" && isUndefinedTable(err) {
+		return nil, fmt.Errorf("error aggregating %#v: %w", q, ErrPostGISUnavailable)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error aggregating %#v by %s: %w", q, f, err)
+	}
+	bs, err := pgx.CollectRows(rows, pgx.RowToStructByPos[Bucket])
+	if err != nil {
+		return nil, fmt.Errorf("error reading aggregation of %#v by %s: %w", q, f, err)
+	}
+	return bs, nil
+}
+
+// coordinatesQuery selects the companies with coordinates in the enrichment
+// data within the bounding box and the circle of the query. With the
+// earthdistance extension, the distance is calculated (and indexed) by it.
+func (p *PostgreSQL) coordinatesQuery(q *Query) *sqlbuilder.SelectBuilder {
+	s := sqlbuilder.PostgreSQL.NewSelectBuilder()
+	s.Select(p.IDFieldName)
+	s.From(p.EnrichmentTableFullName())
+	lat, lon := p.Latitude(), p.Longitude()
+	if q.BBox != nil {
+		s.Where(s.Between(lat, q.BBox.MinLat, q.BBox.MaxLat), s.Between(lon, q.BBox.MinLon, q.BBox.MaxLon))
+	}
+	if n := q.Near; n != nil {
+		if p.earthDistance {
+			c := fmt.Sprintf("ll_to_earth(%s, %s)", s.Var(n.Lat), s.Var(n.Lon))
+			e := fmt.Sprintf("ll_to_earth(%s, %s)", lat, lon)
+			s.Where(
+				fmt.Sprintf("earth_box(%s, %s) @> %s", c, s.Var(n.Radius), e),
+				fmt.Sprintf("earth_distance(%s, %s) <= %s", c, e, s.Var(n.Radius)),
+			)
+		} else {
+			bb := n.bbox()
+			s.Where(
+				s.Between(lat, bb.MinLat, bb.MaxLat),
+				s.Between(lon, bb.MinLon, bb.MaxLon),
+				fmt.Sprintf(
+					"2 * %f * asin(sqrt(power(sin(radians(%s - %s) / 2), 2) + cos(radians(%s)) * cos(radians(%s)) * power(sin(radians(%s - %s) / 2), 2))) <= %s",
+					earthRadius,
+					lat,
+					s.Var(n.Lat),
+					s.Var(n.Lat),
+					lat,
+					lon,
+					s.Var(n.Lon),
+					s.Var(n.Radius),
+				),
+			)
+		}
+	}
+	return s
+}
+
+// hasExtension tells whether a PostgreSQL extension is installed.
+func (p *PostgreSQL) hasExtension(ctx context.Context, n string) (bool, error) {
+	s, err := p.renderTemplate("extension")
+	if err != nil {
+		return false, fmt.Errorf("error rendering extension template: %w", err)
+	}
+	rows, err := p.pool.Query(withQueryName(ctx, "extension"), s, n)
+	if err != nil {
+		return false, fmt.Errorf("error looking for the %s extension: %w", n, err)
+	}
+	ok, err := pgx.CollectOneRow(rows, pgx.RowTo[bool])
+	if err != nil {
+		return false, fmt.Errorf("error reading the %s extension: %w", n, err)
+	}
+	return ok, nil
+}
+
 // PreLoad runs before starting to load data into the database. Currently it
 // disables autovacuum on PostgreSQL.
 func (p *PostgreSQL) PreLoad() error {
@@ -283,7 +533,7 @@ func (p *PostgreSQL) PreLoad() error {
 	if err != nil {
 		return fmt.Errorf("error rendering pre-load template: %w", err)
 	}
-	if _, err := p.pool.Exec(context.Background(), s); err != nil {
+	if _, err := p.pool.Exec(withQueryName(context.Background(), "pre_load"), s); err != nil {
 		return fmt.Errorf("error during pre load: %s\n%w", s, err)
 	}
 	return nil
@@ -296,7 +546,7 @@ func (p *PostgreSQL) PostLoad() error {
 	if err != nil {
 		return fmt.Errorf("error rendering post-load template: %w", err)
 	}
-	if _, err := p.pool.Exec(context.Background(), s); err != nil {
+	if _, err := p.pool.Exec(withQueryName(context.Background(), "post_load"), s); err != nil {
 		return fmt.Errorf("error during post load: %s\n%w", s, err)
 	}
 	return nil
@@ -311,7 +561,7 @@ func (p *PostgreSQL) MetaSave(k, v string) error {
 	if err != nil {
 		return fmt.Errorf("error rendering meta-save template: %w", err)
 	}
-	if _, err := p.pool.Exec(context.Background(), s, k, v); err != nil {
+	if _, err := p.pool.Exec(withQueryName(context.Background(), "meta"), s, k, v); err != nil {
 		return fmt.Errorf("error saving %s to metadata: %w", k, err)
 	}
 	return nil
@@ -319,7 +569,7 @@ func (p *PostgreSQL) MetaSave(k, v string) error {
 
 // MetaRead reads a key/value pair from the metadata table.
 func (p *PostgreSQL) MetaRead(k string) (string, error) {
-	rows, err := p.pool.Query(context.Background(), p.metaReadQuery, k)
+	rows, err := p.pool.Query(withQueryName(context.Background(), "meta"), p.metaReadQuery, k)
 	if err != nil {
 		return "", fmt.Errorf("error looking for metadata key %s: %w", k, err)
 	}
@@ -330,24 +580,694 @@ func (p *PostgreSQL) MetaRead(k string) (string, error) {
 	return v, nil
 }
 
+// the api key table is not part of the dataset, so it is not dropped with the
+// other tables and it is created on demand for databases created before it
+// existed
+func (p *PostgreSQL) createAPIKeyTable() error {
+	s, err := p.renderTemplate("api_key_table")
+	if err != nil {
+		return fmt.Errorf("error rendering api-key-table template: %w", err)
+	}
+	if _, err := p.pool.Exec(withQueryName(context.Background(), "api_key"), s); err != nil {
+		return fmt.Errorf("error creating table with: %s\n%w", s, err)
+	}
+	return nil
+}
+
+func (p *PostgreSQL) readAPIKeys() ([]APIKey, error) {
+	s, err := p.renderTemplate("api_key_read")
+	if err != nil {
+		return nil, fmt.Errorf("error rendering api-key-read template: %w", err)
+	}
+	rows, err := p.pool.Query(withQueryName(context.Background(), "api_key"), s)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[APIKey])
+}
+
+// APIKeys lists all API keys. It returns no keys if the table was never
+// created.
+func (p *PostgreSQL) APIKeys() ([]APIKey, error) {
+	ks, err := p.readAPIKeys()
+	if isUndefinedColumn(err) { // table created before the profile column existed
+		if err := p.createAPIKeyTable(); err != nil {
+			return nil, err
+		}
+		ks, err = p.readAPIKeys()
+	}
+	if isUndefinedTable(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading api keys: %w", err)
+	}
+	return ks, nil
+}
+
+func isUndefinedTable(err error) bool {
+	var e *pgconn.PgError
+	return errors.As(err, &e) && e.Code == "42P01"
+}
+
+func isUndefinedColumn(err error) bool {
+	var e *pgconn.PgError
+	return errors.As(err, &e) && e.Code == "42703"
+}
+
+// SaveAPIKey creates or replaces (based on its name) an API key.
+func (p *PostgreSQL) SaveAPIKey(k APIKey) error {
+	if err := p.createAPIKeyTable(); err != nil {
+		return err
+	}
+	s, err := p.renderTemplate("api_key_save")
+	if err != nil {
+		return fmt.Errorf("error rendering api-key-save template: %w", err)
+	}
+	if _, err := p.pool.Exec(withQueryName(context.Background(), "api_key"), s, k.Name, k.Hash, k.Rate, k.Burst, k.Profile, k.Admin); err != nil {
+		return fmt.Errorf("error saving api key %s: %w", k.Name, err)
+	}
+	return nil
+}
+
+// DeleteAPIKey deletes an API key by its name.
+func (p *PostgreSQL) DeleteAPIKey(n string) error {
+	s, err := p.renderTemplate("api_key_delete")
+	if err != nil {
+		return fmt.Errorf("error rendering api-key-delete template: %w", err)
+	}
+	r, err := p.pool.Exec(withQueryName(context.Background(), "api_key"), s, n)
+	if err != nil {
+		return fmt.Errorf("error deleting api key %s: %w", n, err)
+	}
+	if r.RowsAffected() == 0 {
+		return fmt.Errorf("api key %s not found", n)
+	}
+	return nil
+}
+
+// the audit table is not part of the dataset either, and it is append-only
+// (updates and deletes are ignored)
+func (p *PostgreSQL) createAuditTable() error {
+	s, err := p.renderTemplate("audit_table")
+	if err != nil {
+		return fmt.Errorf("error rendering audit-table template: %w", err)
+	}
+	if _, err := p.pool.Exec(withQueryName(context.Background(), "audit"), s); err != nil {
+		return fmt.Errorf("error creating table with: %s\n%w", s, err)
+	}
+	return nil
+}
+
+// SaveAuditEntry appends an entry to the audit table.
+func (p *PostgreSQL) SaveAuditEntry(e AuditEntry) error {
+	s, err := p.renderTemplate("audit_save")
+	if err != nil {
+		return fmt.Errorf("error rendering audit-save template: %w", err)
+	}
+	_, err = p.pool.Exec(withQueryName(context.Background(), "audit"), s, e.At, e.Actor, e.Action, e.Parameters)
+	if isUndefinedTable(err) {
+		if err := p.createAuditTable(); err != nil {
+			return err
+		}
+		_, err = p.pool.Exec(withQueryName(context.Background(), "audit"), s, e.At, e.Actor, e.Action, e.Parameters)
+	}
+	if err != nil {
+		return fmt.Errorf("error saving audit entry %s: %w", e.Action, err)
+	}
+	return nil
+}
+
+// AuditEntries lists the latest n entries of the audit table, newest first. It
+// returns no entries if the table was never created.
+func (p *PostgreSQL) AuditEntries(ctx context.Context, n int) ([]AuditEntry, error) {
+	s, err := p.renderTemplate("audit_read")
+	if err != nil {
+		return nil, fmt.Errorf("error rendering audit-read template: %w", err)
+	}
+	var es []AuditEntry
+	rows, err := p.pool.Query(withQueryName(ctx, "audit"), s, n)
+	if err == nil {
+		es, err = pgx.CollectRows(rows, pgx.RowToStructByPos[AuditEntry])
+	}
+	if isUndefinedTable(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading audit entries: %w", err)
+	}
+	return es, nil
+}
+
+// SaveEvents appends to the event log the companies inserted, updated or
+// deleted by the dataset loaded, comparing the hash of each company (saved
+// with it in CreateCompanies) to the one in the event state table, which keeps
+// the latest hash of each CNPJ in the event log. The event table is
+// append-only and neither of them is dropped with the dataset.
+func (p *PostgreSQL) SaveEvents() error {
+	ctx := context.Background()
+	v, err := p.MetaRead("updated-at")
+	if err != nil {
+		return fmt.Errorf("error reading the dataset version: %w", err)
+	}
+	if v == "" {
+		return errors.New("missing dataset version, cannot record the events without it")
+	}
+	t, err := p.renderTemplate("event_table")
+	if err != nil {
+		return fmt.Errorf("error rendering event-table template: %w", err)
+	}
+	if _, err := p.pool.Exec(withQueryName(ctx, "event"), t); err != nil {
+		return fmt.Errorf("error creating table with: %s\n%w", t, err)
+	}
+	s, err := p.renderTemplate("event_save")
+	if err != nil {
+		return fmt.Errorf("error rendering event-save template: %w", err)
+	}
+	rows, err := p.pool.Query(withQueryName(ctx, "event"), s, v)
+	if err != nil {
+		return fmt.Errorf("error saving events of dataset version %s: %w", v, err)
+	}
+	n, err := pgx.CollectOneRow(rows, pgx.RowTo[int64])
+	if err != nil {
+		return fmt.Errorf("error saving events of dataset version %s: %w", v, err)
+	}
+	slog.Info("Events recorded", "dataset version", v, "events", n)
+	return nil
+}
+
+// Events lists the events of a CNPJ, oldest first. It returns no events if the
+// table was never created.
+func (p *PostgreSQL) Events(ctx context.Context, n string) ([]Event, error) {
+	s, err := p.renderTemplate("event_read")
+	if err != nil {
+		return nil, fmt.Errorf("error rendering event-read template: %w", err)
+	}
+	var es []Event
+	rows, err := p.pool.Query(withQueryName(ctx, "event"), s, n)
+	if err == nil {
+		es, err = pgx.CollectRows(rows, pgx.RowToStructByPos[Event])
+	}
+	if isUndefinedTable(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading events of %s: %w", n, err)
+	}
+	return es, nil
+}
+
+// the crosswalk table is loaded by the operators, not by the transform, so it
+// is not dropped with the dataset either
+func (p *PostgreSQL) createCrosswalkTable() error {
+	s, err := p.renderTemplate("crosswalk_table")
+	if err != nil {
+		return fmt.Errorf("error rendering crosswalk-table template: %w", err)
+	}
+	if _, err := p.pool.Exec(withQueryName(context.Background(), "crosswalk"), s); err != nil {
+		return fmt.Errorf("error creating table with: %s\n%w", s, err)
+	}
+	return nil
+}
+
+// SaveCrosswalk creates or replaces the mappings from identifiers of a kind
+// (e.g. NIRE) to CNPJ. It expects pairs of identifier and CNPJ (see
+// ReadCrosswalk).
+func (p *PostgreSQL) SaveCrosswalk(kind string, ps [][]string) error {
+	if err := p.createCrosswalkTable(); err != nil {
+		return err
+	}
+	s, err := p.renderTemplate("crosswalk_save")
+	if err != nil {
+		return fmt.Errorf("error rendering crosswalk-save template: %w", err)
+	}
+	var b pgx.Batch
+	for _, r := range ps {
+		b.Queue(s, kind, r[0], r[1])
+	}
+	if err := p.pool.SendBatch(withQueryName(context.Background(), "crosswalk"), &b).Close(); err != nil {
+		return fmt.Errorf("error saving %s crosswalk: %w", kind, err)
+	}
+	return nil
+}
+
+// the municipality table is loaded by the operators, not by the transform, so
+// it is not dropped with the dataset either
+func (p *PostgreSQL) createMunicipalityTable() error {
+	s, err := p.renderTemplate("municipality_table")
+	if err != nil {
+		return fmt.Errorf("error rendering municipality-table template: %w", err)
+	}
+	if _, err := p.pool.Exec(withQueryName(context.Background(), "municipality"), s); err != nil {
+		return fmt.Errorf("error creating table with: %s\n%w", s, err)
+	}
+	return nil
+}
+
+// SaveMunicipalities creates or replaces the geometries of the municipalities
+// (see ReadMunicipalities), enabling the PostGIS mode. It requires the PostGIS
+// extension.
+func (p *PostgreSQL) SaveMunicipalities(ms []Municipality) error {
+	ok, err := p.hasExtension(context.Background(), "postgis")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrPostGISUnavailable
+	}
+	if err := p.createMunicipalityTable(); err != nil {
+		return err
+	}
+	s, err := p.renderTemplate("municipality_save")
+	if err != nil {
+		return fmt.Errorf("error rendering municipality-save template: %w", err)
+	}
+	var b pgx.Batch
+	for _, m := range ms {
+		b.Queue(s, m.Code, m.Geometry)
+	}
+	if err := p.pool.SendBatch(withQueryName(context.Background(), "municipality"), &b).Close(); err != nil {
+		return fmt.Errorf("error saving municipalities: %w", err)
+	}
+	return nil
+}
+
+// MunicipalityPoints returns a point (GeoJSON) inside each municipality of
+// the IBGE codes, to place the companies in a map.
+func (p *PostgreSQL) MunicipalityPoints(ctx context.Context, codes []uint32) (map[uint32]string, error) {
+	if !p.postGIS {
+		return nil, ErrPostGISUnavailable
+	}
+	s, err := p.renderTemplate("municipality_points")
+	if err != nil {
+		return nil, fmt.Errorf("error rendering municipality-points template: %w", err)
+	}
+	rows, err := p.pool.Query(withQueryName(ctx, "municipality"), s, codes)
+	if isUndefinedTable(err) {
+		return nil, ErrPostGISUnavailable
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error looking for municipalities %v: %w", codes, err)
+	}
+	type point struct {
+		Code     uint32
+		Geometry string
+	}
+	ps, err := pgx.CollectRows(rows, pgx.RowToStructByPos[point])
+	if err != nil {
+		return nil, fmt.Errorf("error reading municipalities %v: %w", codes, err)
+	}
+	m := make(map[uint32]string, len(ps))
+	for _, r := range ps {
+		m[r.Code] = r.Geometry
+	}
+	return m, nil
+}
+
+// CrosswalkCNPJ returns the CNPJ mapped to an identifier of a kind (e.g. NIRE).
+func (p *PostgreSQL) CrosswalkCNPJ(ctx context.Context, kind, id string) (string, error) {
+	s, err := p.renderTemplate("crosswalk_read")
+	if err != nil {
+		return "", fmt.Errorf("error rendering crosswalk-read template: %w", err)
+	}
+	var n string
+	err = p.pool.QueryRow(withQueryName(ctx, "crosswalk"), s, kind, NormalizeCrosswalkID(id)).Scan(&n)
+	if isUndefinedTable(err) || errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("%s %s not found", kind, id)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error looking for %s %s: %w", kind, id, err)
+	}
+	return n, nil
+}
+
+// the enrichment table keeps the data supplied by the operators, so it is not
+// dropped with the dataset
+func (p *PostgreSQL) createEnrichmentTable() error {
+	s, err := p.renderTemplate("enrichment_table")
+	if err != nil {
+		return fmt.Errorf("error rendering enrichment-table template: %w", err)
+	}
+	if _, err := p.pool.Exec(withQueryName(context.Background(), "enrichment"), s); err != nil {
+		return fmt.Errorf("error creating table with: %s\n%w", s, err)
+	}
+	return nil
+}
+
+// SaveEnrichment merges a patch (a JSON object) into the enrichment data of a
+// company, removing the fields set to null, and returns the resulting JSON.
+func (p *PostgreSQL) SaveEnrichment(ctx context.Context, id, patch string) (string, error) {
+	s, err := p.renderTemplate("enrichment_save")
+	if err != nil {
+		return "", fmt.Errorf("error rendering enrichment-save template: %w", err)
+	}
+	var j string
+	err = p.pool.QueryRow(withQueryName(ctx, "enrichment"), s, id, patch).Scan(&j)
+	if isUndefinedTable(err) { // database created before the enrichment table existed
+		if err := p.createEnrichmentTable(); err != nil {
+			return "", err
+		}
+		err = p.pool.QueryRow(withQueryName(ctx, "enrichment"), s, id, patch).Scan(&j)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error saving enrichment for %s: %w", id, err)
+	}
+	return j, nil
+}
+
+// Enrichment returns the enrichment data of a company as a JSON object, or an
+// empty string if there is none.
+func (p *PostgreSQL) Enrichment(ctx context.Context, id string) (string, error) {
+	s, err := p.renderTemplate("enrichment_read")
+	if err != nil {
+		return "", fmt.Errorf("error rendering enrichment-read template: %w", err)
+	}
+	var j string
+	err = p.pool.QueryRow(withQueryName(ctx, "enrichment"), s, id).Scan(&j)
+	if isUndefinedTable(err) || errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading enrichment for %s: %w", id, err)
+	}
+	return j, nil
+}
+
+// the tag table keeps the data supplied by the API clients, so it is not
+// dropped with the dataset
+func (p *PostgreSQL) createTagTable() error {
+	s, err := p.renderTemplate("tag_table")
+	if err != nil {
+		return fmt.Errorf("error rendering tag-table template: %w", err)
+	}
+	if _, err := p.pool.Exec(withQueryName(context.Background(), "tag"), s); err != nil {
+		return fmt.Errorf("error creating table with: %s\n%w", s, err)
+	}
+	return nil
+}
+
+// AddTag tags a company in the namespace of an API key.
+func (p *PostgreSQL) AddTag(ctx context.Context, ns, id, t string) error {
+	s, err := p.renderTemplate("tag_add")
+	if err != nil {
+		return fmt.Errorf("error rendering tag-add template: %w", err)
+	}
+	_, err = p.pool.Exec(withQueryName(ctx, "tag"), s, ns, t, id)
+	if isUndefinedTable(err) { // database created before the tag table existed
+		if err := p.createTagTable(); err != nil {
+			return err
+		}
+		_, err = p.pool.Exec(withQueryName(ctx, "tag"), s, ns, t, id)
+	}
+	if err != nil {
+		return fmt.Errorf("error tagging %s with %s: %w", id, t, err)
+	}
+	return nil
+}
+
+// RemoveTag removes a tag of a company in the namespace of an API key.
+func (p *PostgreSQL) RemoveTag(ctx context.Context, ns, id, t string) error {
+	s, err := p.renderTemplate("tag_remove")
+	if err != nil {
+		return fmt.Errorf("error rendering tag-remove template: %w", err)
+	}
+	_, err = p.pool.Exec(withQueryName(ctx, "tag"), s, ns, t, id)
+	if err != nil && !isUndefinedTable(err) {
+		return fmt.Errorf("error removing tag %s from %s: %w", t, id, err)
+	}
+	return nil
+}
+
+// Tags lists the tags of a company in the namespace of an API key.
+func (p *PostgreSQL) Tags(ctx context.Context, ns, id string) ([]string, error) {
+	s, err := p.renderTemplate("tag_read")
+	if err != nil {
+		return nil, fmt.Errorf("error rendering tag-read template: %w", err)
+	}
+	rows, err := p.pool.Query(withQueryName(ctx, "tag"), s, ns, id)
+	if err != nil {
+		return nil, fmt.Errorf("error looking for tags of %s: %w", id, err)
+	}
+	ts, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if isUndefinedTable(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading tags of %s: %w", id, err)
+	}
+	return ts, nil
+}
+
+// Capacity reports the usage of the connection pool and the buffer cache hit
+// rate of the database.
+func (p *PostgreSQL) Capacity(ctx context.Context) (Capacity, error) {
+	st := p.pool.Stat()
+	c := Capacity{InUse: st.AcquiredConns(), Idle: st.IdleConns(), Max: st.MaxConns()}
+	s, err := p.Stats(ctx)
+	if err != nil {
+		return c, err
+	}
+	c.CacheHitRate = s.CacheHitRate
+	return c, nil
+}
+
+// Stats reads the active connections and the cache hit rate from
+// pg_stat_activity and pg_stat_database, and the size of the companies table
+// and its indexes.
+func (p *PostgreSQL) Stats(ctx context.Context) (Stats, error) {
+	var s Stats
+	q, err := p.renderTemplate("stats")
+	if err != nil {
+		return s, fmt.Errorf("error rendering stats template: %w", err)
+	}
+	if err := p.pool.QueryRow(withQueryName(ctx, "stats"), q).Scan(&s.ActiveConnections, &s.CacheHitRate, &s.TableSize, &s.IndexSize); err != nil {
+		return s, fmt.Errorf("error reading database stats: %w", err)
+	}
+	return s, nil
+}
+
+// CreatePublication publishes the companies and metadata tables for logical
+// replication (it requires wal_level = logical). The companies table is kept
+// logged from now on, so the loads write to the WAL and reach the subscribers.
+func (p *PostgreSQL) CreatePublication(ctx context.Context) error {
+	s, err := p.renderTemplate("publication_create")
+	if err != nil {
+		return fmt.Errorf("error rendering publication create template: %w", err)
+	}
+	if _, err := p.pool.Exec(withQueryName(ctx, "publication_create"), s); err != nil {
+		return fmt.Errorf("error creating publication %s: %w", p.PublicationName(), err)
+	}
+	return nil
+}
+
+// refreshPublication adds the tables back to the publication (if there is
+// one) after they are dropped and created again.
+func (p *PostgreSQL) refreshPublication() error {
+	s, err := p.renderTemplate("publication_refresh")
+	if err != nil {
+		return fmt.Errorf("error rendering publication refresh template: %w", err)
+	}
+	if _, err := p.pool.Exec(withQueryName(context.Background(), "publication_refresh"), s); err != nil {
+		return fmt.Errorf("error refreshing publication %s: %w", p.PublicationName(), err)
+	}
+	return nil
+}
+
+// DropPublication removes the publication, subscribers stop receiving changes.
+func (p *PostgreSQL) DropPublication(ctx context.Context) error {
+	s, err := p.renderTemplate("publication_drop")
+	if err != nil {
+		return fmt.Errorf("error rendering publication drop template: %w", err)
+	}
+	if _, err := p.pool.Exec(withQueryName(ctx, "publication_drop"), s); err != nil {
+		return fmt.Errorf("error dropping publication %s: %w", p.PublicationName(), err)
+	}
+	return nil
+}
+
+// Publication reads the tables in the publication and the logical
+// replication slots of the database.
+func (p *PostgreSQL) Publication(ctx context.Context) (Publication, error) {
+	r := Publication{Name: p.PublicationName()}
+	q, err := p.renderTemplate("publication_tables")
+	if err != nil {
+		return r, fmt.Errorf("error rendering publication tables template: %w", err)
+	}
+	if err := p.pool.QueryRow(withQueryName(ctx, "publication_tables"), q).Scan(&r.Tables); err != nil {
+		return r, fmt.Errorf("error reading publication %s: %w", r.Name, err)
+	}
+	r.Exists = r.Tables != nil
+	q, err = p.renderTemplate("replication_slots")
+	if err != nil {
+		return r, fmt.Errorf("error rendering replication slots template: %w", err)
+	}
+	rows, err := p.pool.Query(withQueryName(ctx, "replication_slots"), q)
+	if err != nil {
+		return r, fmt.Errorf("error reading replication slots: %w", err)
+	}
+	r.Slots, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (ReplicationSlot, error) {
+		var s ReplicationSlot
+		err := row.Scan(&s.Name, &s.Active, &s.Lag)
+		return s, err
+	})
+	if err != nil {
+		return r, fmt.Errorf("error reading replication slots: %w", err)
+	}
+	return r, nil
+}
+
+// SubscriptionSQL is the SQL to run in a downstream PostgreSQL database to
+// subscribe to the publication: it creates the tables (subscribers need the
+// same schema and tables) and the subscription connecting to conninfo.
+func (p *PostgreSQL) SubscriptionSQL(conninfo string) (string, error) {
+	s, err := p.renderTemplate("create")
+	if err != nil {
+		return "", fmt.Errorf("error rendering create template: %w", err)
+	}
+	return fmt.Sprintf(
+		"CREATE SCHEMA IF NOT EXISTS %s;\n%s\nCREATE SUBSCRIPTION %s CONNECTION '%s' PUBLICATION %s;\n",
+		p.schema,
+		strings.TrimSpace(s),
+		p.PublicationName(),
+		strings.ReplaceAll(conninfo, "'", "''"),
+		p.PublicationName(),
+	), nil
+}
+
+// Bloat estimates the space wasted by the companies table and its btree
+// indexes, without requiring the pgstattuple extension.
+func (p *PostgreSQL) Bloat(ctx context.Context) ([]Bloat, error) {
+	q, err := p.renderTemplate("bloat")
+	if err != nil {
+		return nil, fmt.Errorf("error rendering bloat template: %w", err)
+	}
+	rows, err := p.pool.Query(withQueryName(ctx, "bloat"), q)
+	if err != nil {
+		return nil, fmt.Errorf("error estimating bloat: %w", err)
+	}
+	bs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Bloat, error) {
+		var b Bloat
+		err := row.Scan(&b.Kind, &b.Name, &b.Size, &b.Wasted)
+		return b, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading bloat estimates: %w", err)
+	}
+	return bs, nil
+}
+
+// Maintain reclaims the space wasted by a table or an index without locking
+// it for writes: indexes are rebuilt concurrently, and tables are vacuumed so
+// the space of dead tuples can be reused (returning it to the operating system
+// requires VACUUM FULL or pg_repack in a maintenance window).
+func (p *PostgreSQL) Maintain(ctx context.Context, b Bloat) error {
+	n := pgx.Identifier{p.schema, b.Name}.Sanitize()
+	var q string
+	switch b.Kind {
+	case BloatIndex:
+		q = "REINDEX INDEX CONCURRENTLY " + n
+	case BloatTable:
+		q = "VACUUM (ANALYZE) " + n
+	default:
+		return fmt.Errorf("unknown kind of relation %s", b.Kind)
+	}
+	if _, err := p.pool.Exec(withQueryName(ctx, "maintain"), q); err != nil {
+		return fmt.Errorf("error running %s: %w", q, err)
+	}
+	return nil
+}
+
+// Sample returns the JSON of n random companies. Rows are picked by a random
+// cursor drawn once per company (between the lowest and highest cursors),
+// avoiding sorting the whole table, so the same company might come up more
+// than once.
+func (p *PostgreSQL) Sample(ctx context.Context, n int) ([]string, error) {
+	q, err := p.renderTemplate("sample")
+	if err != nil {
+		return nil, fmt.Errorf("error rendering sample template: %w", err)
+	}
+	rows, err := p.pool.Query(withQueryName(ctx, "sample"), q, n)
+	if err != nil {
+		return nil, fmt.Errorf("error sampling %d companies: %w", n, err)
+	}
+	cs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("error reading sample of companies: %w", err)
+	}
+	return cs, nil
+}
+
+// Partners returns a page of the partners (QSA) of a company, slicing the
+// array in the database so huge arrays are not sent over the wire.
+func (p *PostgreSQL) Partners(ctx context.Context, id string, offset, limit int) (string, error) {
+	q, err := p.renderTemplate("partners")
+	if err != nil {
+		return "", fmt.Errorf("error rendering partners template: %w", err)
+	}
+	var t int64
+	var d string
+	if err := p.pool.QueryRow(withQueryName(ctx, "partners"), q, id, offset, limit).Scan(&t, &d); err != nil {
+		return "", fmt.Errorf("error looking for partners of cnpj %s: %w", id, err)
+	}
+	return newPartnersPage(d, t), nil
+}
+
+// Largest returns the n largest company documents, from the largest to the
+// smallest. It reads the whole table, so it is meant for reports, not for the
+// API.
+func (p *PostgreSQL) Largest(ctx context.Context, n int) ([]DocumentSize, error) {
+	q, err := p.renderTemplate("largest")
+	if err != nil {
+		return nil, fmt.Errorf("error rendering largest template: %w", err)
+	}
+	rows, err := p.pool.Query(withQueryName(ctx, "largest"), q, n)
+	if err != nil {
+		return nil, fmt.Errorf("error looking for the %d largest companies: %w", n, err)
+	}
+	ds, err := pgx.CollectRows(rows, pgx.RowToStructByPos[DocumentSize])
+	if err != nil {
+		return nil, fmt.Errorf("error reading the largest companies: %w", err)
+	}
+	return ds, nil
+}
+
+// RowCounts returns the number of companies per bucket of CNPJ prefix (the
+// first two digits), to be compared with the counts recorded by the
+// transform.
+func (p *PostgreSQL) RowCounts() (map[string]int64, error) {
+	q, err := p.renderTemplate("row_counts")
+	if err != nil {
+		return nil, fmt.Errorf("error rendering row counts template: %w", err)
+	}
+	rows, err := p.pool.Query(withQueryName(context.Background(), "row_counts"), q)
+	if err != nil {
+		return nil, fmt.Errorf("error counting companies: %w", err)
+	}
+	m := make(map[string]int64)
+	var k string
+	var n int64
+	if _, err := pgx.ForEachRow(rows, []any{&k, &n}, func() error {
+		m[k] = n
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("error reading company counts: %w", err)
+	}
+	return m, nil
+}
+
 // CreateExtraIndexes responsible for creating additional indexes in the database
 func (p *PostgreSQL) CreateExtraIndexes(idxs []string) error {
 	if err := transform.ValidateIndexes(idxs); err != nil {
 		return fmt.Errorf("index name error: %w", err)
 	}
 	for _, idx := range idxs {
-		i := ExtraIndex{
-			IsRoot: !strings.Contains(idx, "."),
-			Name:   fmt.Sprintf("json.%s", idx),
-			Value:  idx,
-		}
-		p.ExtraIndexes = append(p.ExtraIndexes, i)
+		p.ExtraIndexes = append(p.ExtraIndexes, newExtraIndex(idx))
 	}
 	s, err := p.renderTemplate("extra_indexes")
 	if err != nil {
 		return fmt.Errorf("error rendering extra-indexes template: %w", err)
 	}
-	if _, err := p.pool.Exec(context.Background(), s); err != nil {
+	if _, err := p.pool.Exec(withQueryName(context.Background(), "extra_indexes"), s); err != nil {
 		return fmt.Errorf("expected the error to create indexe: %w", err)
 	}
 	slog.Info(fmt.Sprintf("%d Indexes successfully created in the table %s", len(idxs), p.CompanyTableName))
@@ -364,21 +1284,31 @@ func NewPostgreSQL(uri, schema string) (PostgreSQL, error) {
 	cfg.MinConns = 1
 	cfg.MaxConnIdleTime = 5 * time.Minute
 	cfg.MaxConnLifetime = 30 * time.Minute
+	cfg.ConnConfig.Tracer = queryTracer{}
 	conn, err := pgxpool.NewWithConfig(context.Background(), cfg)
 	if err != nil {
 		return PostgreSQL{}, fmt.Errorf("could not connect to the database: %w", err)
 	}
 	p := PostgreSQL{
-		pool:             conn,
-		uri:              uri,
-		schema:           schema,
-		CompanyTableName: companyTableName,
-		MetaTableName:    metaTableName,
-		CursorFieldName:  cursorFieldName,
-		IDFieldName:      idFieldName,
-		JSONFieldName:    jsonFieldName,
-		KeyFieldName:     keyFieldName,
-		ValueFieldName:   valueFieldName,
+		pool:                  conn,
+		uri:                   uri,
+		schema:                schema,
+		CompanyTableName:      companyTableName,
+		MetaTableName:         metaTableName,
+		APIKeyTableName:       apiKeyTableName,
+		AuditTableName:        auditTableName,
+		CrosswalkTableName:    crosswalkTableName,
+		EnrichmentTableName:   enrichmentTableName,
+		TagTableName:          tagTableName,
+		MunicipalityTableName: municipalityTableName,
+		EventTableName:        eventTableName,
+		EventStateTableName:   eventStateTableName,
+		CursorFieldName:       cursorFieldName,
+		IDFieldName:           idFieldName,
+		JSONFieldName:         jsonFieldName,
+		HashFieldName:         hashFieldName,
+		KeyFieldName:          keyFieldName,
+		ValueFieldName:        valueFieldName,
 	}
 	p.getCompanyQuery, err = p.renderTemplate("get")
 	if err != nil {
@@ -391,5 +1321,13 @@ func NewPostgreSQL(uri, schema string) (PostgreSQL, error) {
 	if err := p.pool.Ping(context.Background()); err != nil {
 		return PostgreSQL{}, fmt.Errorf("could not connect to postgres: %w", err)
 	}
+	p.earthDistance, err = p.hasExtension(context.Background(), "earthdistance")
+	if err != nil {
+		return PostgreSQL{}, err
+	}
+	p.postGIS, err = p.hasExtension(context.Background(), "postgis")
+	if err != nil {
+		return PostgreSQL{}, err
+	}
 	return p, nil
 }
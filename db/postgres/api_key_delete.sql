@@ -0,0 +1,2 @@
+DELETE FROM {{ .APIKeyTableFullName }}
+WHERE name = $1;
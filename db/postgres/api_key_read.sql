@@ -0,0 +1,3 @@
+SELECT name, hash, rate, burst, profile, admin
+FROM {{ .APIKeyTableFullName }}
+ORDER BY name;
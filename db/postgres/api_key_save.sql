@@ -0,0 +1,5 @@
+INSERT INTO {{ .APIKeyTableFullName }} (name, hash, rate, burst, profile, admin)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (name)
+DO UPDATE
+SET hash = $2, rate = $3, burst = $4, profile = $5, admin = $6
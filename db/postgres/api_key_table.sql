@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS {{ .APIKeyTableFullName }} (
+    name varchar(64) NOT NULL PRIMARY KEY,
+    hash char(64) NOT NULL UNIQUE,
+    rate double precision NOT NULL DEFAULT 0,
+    burst integer NOT NULL DEFAULT 0
+);
+ALTER TABLE {{ .APIKeyTableFullName }}
+ADD COLUMN IF NOT EXISTS profile varchar(16) NOT NULL DEFAULT '';
+ALTER TABLE {{ .APIKeyTableFullName }}
+ADD COLUMN IF NOT EXISTS admin boolean NOT NULL DEFAULT false;
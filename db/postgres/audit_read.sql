@@ -0,0 +1,4 @@
+SELECT at, actor, action, parameters
+FROM {{ .AuditTableFullName }}
+ORDER BY id DESC
+LIMIT $1;
@@ -0,0 +1,2 @@
+INSERT INTO {{ .AuditTableFullName }} (at, actor, action, parameters)
+VALUES ($1, $2, $3, $4);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS {{ .AuditTableFullName }} (
+    id bigserial PRIMARY KEY,
+    at timestamptz NOT NULL DEFAULT now(),
+    actor varchar(128) NOT NULL,
+    action varchar(128) NOT NULL,
+    parameters jsonb NOT NULL DEFAULT '{}'
+);
+CREATE OR REPLACE RULE {{ .AuditTableName }}_no_update AS
+ON UPDATE TO {{ .AuditTableFullName }} DO INSTEAD NOTHING;
+CREATE OR REPLACE RULE {{ .AuditTableName }}_no_delete AS
+ON DELETE TO {{ .AuditTableFullName }} DO INSTEAD NOTHING;
@@ -0,0 +1,43 @@
+-- estimates without the pgstattuple extension: the dead tuples of the table,
+-- and the size of each btree index compared to the size expected for its
+-- number of entries (12 bytes of header and pointer, plus the key aligned to 8
+-- bytes, in pages filled up to 90%)
+SELECT
+    'table',
+    c.relname,
+    pg_table_size(c.oid),
+    (pg_table_size(c.oid) * s.n_dead_tup::double precision / NULLIF(s.n_live_tup + s.n_dead_tup, 0))::bigint
+FROM pg_class c
+JOIN pg_stat_user_tables s ON s.relid = c.oid
+WHERE c.oid = '{{ .CompanyTableFullName }}'::regclass
+UNION ALL
+SELECT
+    'index',
+    i.relname,
+    pg_relation_size(i.oid),
+    GREATEST(
+        pg_relation_size(i.oid) - (
+            current_setting('block_size')::bigint
+            + GREATEST(i.reltuples, 0) * (12 + ceil(COALESCE(w.width, 0) / 8.0) * 8) / 0.9
+        )::bigint,
+        0
+    )
+FROM pg_index x
+JOIN pg_class i ON i.oid = x.indexrelid
+JOIN pg_class t ON t.oid = x.indrelid
+JOIN pg_namespace n ON n.oid = t.relnamespace
+JOIN pg_am am ON am.oid = i.relam
+LEFT JOIN LATERAL (
+    SELECT sum(st.avg_width) AS width
+    FROM pg_stats st
+    WHERE st.schemaname = n.nspname
+    AND (
+        st.tablename = i.relname -- expression indexes have their own stats
+        OR (
+            st.tablename = t.relname
+            AND st.attname IN (SELECT a.attname FROM pg_attribute a WHERE a.attrelid = t.oid AND a.attnum = ANY(x.indkey))
+        )
+    )
+) w ON true
+WHERE t.oid = '{{ .CompanyTableFullName }}'::regclass AND am.amname = 'btree'
+ORDER BY 1 DESC, 2;
@@ -1,7 +1,8 @@
 CREATE TABLE IF NOT EXISTS {{ .CompanyTableFullName }} (
     {{ .CursorFieldName }} SERIAL PRIMARY KEY,
     {{ .IDFieldName }} char(14) NOT NULL,
-    {{ .JSONFieldName }} jsonb NOT NULL
+    {{ .JSONFieldName }} jsonb NOT NULL,
+    {{ .HashFieldName }} char(64) NOT NULL
 );
 CREATE TABLE IF NOT EXISTS {{ .MetaTableFullName }} (
     {{ .KeyFieldName }} char(16) NOT NULL PRIMARY KEY,
@@ -0,0 +1,3 @@
+SELECT {{ .IDFieldName }}
+FROM {{ .CrosswalkTableFullName }}
+WHERE kind = $1 AND identifier = $2;
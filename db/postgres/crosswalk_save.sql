@@ -0,0 +1,5 @@
+INSERT INTO {{ .CrosswalkTableFullName }} (kind, identifier, {{ .IDFieldName }})
+VALUES ($1, $2, $3)
+ON CONFLICT (kind, identifier)
+DO UPDATE
+SET {{ .IDFieldName }} = $3
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS {{ .CrosswalkTableFullName }} (
+    kind varchar(16) NOT NULL,
+    identifier varchar(64) NOT NULL,
+    {{ .IDFieldName }} char(14) NOT NULL,
+    PRIMARY KEY (kind, identifier)
+);
@@ -0,0 +1,3 @@
+SELECT {{ .JSONFieldName }}::text
+FROM {{ .EnrichmentTableFullName }}
+WHERE {{ .IDFieldName }} = $1;
@@ -0,0 +1,6 @@
+INSERT INTO {{ .EnrichmentTableFullName }} ({{ .IDFieldName }}, {{ .JSONFieldName }})
+VALUES ($1, jsonb_strip_nulls($2::jsonb))
+ON CONFLICT ({{ .IDFieldName }})
+DO UPDATE
+SET {{ .JSONFieldName }} = jsonb_strip_nulls({{ .EnrichmentTableFullName }}.{{ .JSONFieldName }} || $2::jsonb), updated_at = now()
+RETURNING {{ .JSONFieldName }}::text
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS {{ .EnrichmentTableFullName }} (
+    {{ .IDFieldName }} char(14) NOT NULL PRIMARY KEY,
+    {{ .JSONFieldName }} jsonb NOT NULL DEFAULT '{}',
+    updated_at timestamp with time zone NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS {{ .EnrichmentTableName }}_coordinates ON {{ .EnrichmentTableFullName }} ({{ .Latitude }}, {{ .Longitude }});
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'earthdistance') THEN
+        CREATE INDEX IF NOT EXISTS {{ .EnrichmentTableName }}_earth ON {{ .EnrichmentTableFullName }} USING gist (ll_to_earth({{ .Latitude }}, {{ .Longitude }}));
+    END IF;
+END $$;
@@ -0,0 +1,4 @@
+SELECT at, operation, dataset_version, coalesce({{ .HashFieldName }}, ''), {{ .JSONFieldName }}
+FROM {{ .EventTableFullName }}
+WHERE {{ .IDFieldName }} = $1
+ORDER BY seq;
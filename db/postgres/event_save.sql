@@ -0,0 +1,32 @@
+WITH diff AS (
+    SELECT
+        coalesce(c.{{ .IDFieldName }}, s.{{ .IDFieldName }}) AS {{ .IDFieldName }},
+        CASE
+            WHEN c.{{ .IDFieldName }} IS NULL THEN 'delete'
+            WHEN s.{{ .IDFieldName }} IS NULL THEN 'insert'
+            ELSE 'update'
+        END AS operation,
+        c.{{ .HashFieldName }},
+        c.{{ .JSONFieldName }}
+    FROM {{ .CompanyTableFullName }} c
+    FULL OUTER JOIN {{ .EventStateTableFullName }} s ON c.{{ .IDFieldName }} = s.{{ .IDFieldName }}
+    WHERE c.{{ .IDFieldName }} IS NULL
+        OR s.{{ .IDFieldName }} IS NULL
+        OR c.{{ .HashFieldName }} <> s.{{ .HashFieldName }}
+), saved AS (
+    INSERT INTO {{ .EventTableFullName }} ({{ .IDFieldName }}, operation, dataset_version, {{ .HashFieldName }}, {{ .JSONFieldName }})
+    SELECT {{ .IDFieldName }}, operation, $1, {{ .HashFieldName }}, {{ .JSONFieldName }}
+    FROM diff
+    ORDER BY {{ .IDFieldName }}
+), deleted AS (
+    DELETE FROM {{ .EventStateTableFullName }} s
+    USING diff
+    WHERE diff.operation = 'delete' AND s.{{ .IDFieldName }} = diff.{{ .IDFieldName }}
+), upserted AS (
+    INSERT INTO {{ .EventStateTableFullName }} ({{ .IDFieldName }}, {{ .HashFieldName }})
+    SELECT {{ .IDFieldName }}, {{ .HashFieldName }}
+    FROM diff
+    WHERE operation <> 'delete'
+    ON CONFLICT ({{ .IDFieldName }}) DO UPDATE SET {{ .HashFieldName }} = excluded.{{ .HashFieldName }}
+)
+SELECT count(*) FROM diff;
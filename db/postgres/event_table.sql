@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS {{ .EventTableFullName }} (
+    seq bigserial PRIMARY KEY,
+    at timestamptz NOT NULL DEFAULT now(),
+    {{ .IDFieldName }} char(14) NOT NULL,
+    operation varchar(8) NOT NULL,
+    dataset_version varchar(32) NOT NULL,
+    {{ .HashFieldName }} char(64),
+    {{ .JSONFieldName }} jsonb
+);
+CREATE INDEX IF NOT EXISTS {{ .EventTableName }}_{{ .IDFieldName }} ON {{ .EventTableFullName }} ({{ .IDFieldName }}, seq);
+CREATE OR REPLACE RULE {{ .EventTableName }}_no_update AS
+ON UPDATE TO {{ .EventTableFullName }} DO INSTEAD NOTHING;
+CREATE OR REPLACE RULE {{ .EventTableName }}_no_delete AS
+ON DELETE TO {{ .EventTableFullName }} DO INSTEAD NOTHING;
+CREATE TABLE IF NOT EXISTS {{ .EventStateTableFullName }} (
+    {{ .IDFieldName }} char(14) PRIMARY KEY,
+    {{ .HashFieldName }} char(64) NOT NULL
+);
@@ -0,0 +1 @@
+SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = $1);
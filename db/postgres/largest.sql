@@ -0,0 +1,10 @@
+SELECT
+    {{ .IDFieldName }},
+    octet_length({{ .JSONFieldName }}::text) AS size,
+    CASE jsonb_typeof({{ .JSONFieldName }}->'qsa')
+        WHEN 'array' THEN jsonb_array_length({{ .JSONFieldName }}->'qsa')
+        ELSE 0
+    END
+FROM {{ .CompanyTableFullName }}
+ORDER BY size DESC
+LIMIT $1;
@@ -0,0 +1,3 @@
+SELECT code, ST_AsGeoJSON(ST_PointOnSurface(geometry))
+FROM {{ .MunicipalityTableFullName }}
+WHERE code = ANY($1);
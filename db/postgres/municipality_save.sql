@@ -0,0 +1,5 @@
+INSERT INTO {{ .MunicipalityTableFullName }} (code, geometry)
+VALUES ($1, ST_Multi(ST_SetSRID(ST_GeomFromGeoJSON($2), 4326)))
+ON CONFLICT (code)
+DO UPDATE
+SET geometry = EXCLUDED.geometry
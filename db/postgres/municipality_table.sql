@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS {{ .MunicipalityTableFullName }} (
+    code integer NOT NULL PRIMARY KEY,
+    geometry geometry(MultiPolygon, 4326) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS {{ .MunicipalityTableName }}_geometry ON {{ .MunicipalityTableFullName }} USING gist (geometry);
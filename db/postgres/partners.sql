@@ -0,0 +1,15 @@
+SELECT
+    CASE jsonb_typeof({{ .JSONFieldName }}->'qsa')
+        WHEN 'array' THEN jsonb_array_length({{ .JSONFieldName }}->'qsa')
+        ELSE 0
+    END,
+    CASE jsonb_typeof({{ .JSONFieldName }}->'qsa')
+        WHEN 'array' THEN jsonb_path_query_array(
+            {{ .JSONFieldName }}->'qsa',
+            '$[$from to $to]',
+            jsonb_build_object('from', $2::int, 'to', $2::int + $3::int - 1)
+        )
+        ELSE '[]'::jsonb
+    END::text
+FROM {{ .CompanyTableFullName }}
+WHERE {{ .IDFieldName }} = $1;
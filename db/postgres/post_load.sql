@@ -1 +1,5 @@
 ALTER TABLE {{ .CompanyTableFullName }} SET LOGGED;
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS {{ .CompanyTableName }}_qsa_nome_socio ON {{ .CompanyTableFullName }} USING GIN (
+    ((jsonb_path_query_array({{ .JSONFieldName }}, '$.qsa[*].nome_socio'))::text) gin_trgm_ops
+);
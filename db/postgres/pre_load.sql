@@ -1 +1,7 @@
-ALTER TABLE {{ .CompanyTableFullName }} SET UNLOGGED;
+DO $$
+BEGIN
+    -- published tables must be logged, so they are loaded with the WAL
+    IF NOT EXISTS (SELECT 1 FROM pg_publication_rel WHERE prrelid = '{{ .CompanyTableFullName }}'::regclass) THEN
+        ALTER TABLE {{ .CompanyTableFullName }} SET UNLOGGED;
+    END IF;
+END $$;
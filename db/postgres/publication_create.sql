@@ -0,0 +1,10 @@
+DO $$
+BEGIN
+    IF current_setting('wal_level') <> 'logical' THEN
+        RAISE EXCEPTION 'wal_level must be logical to publish the tables, got %', current_setting('wal_level');
+    END IF;
+    ALTER TABLE {{ .CompanyTableFullName }} SET LOGGED;
+    IF NOT EXISTS (SELECT 1 FROM pg_publication WHERE pubname = '{{ .PublicationName }}') THEN
+        CREATE PUBLICATION {{ .PublicationName }} FOR TABLE {{ .CompanyTableFullName }}, {{ .MetaTableFullName }};
+    END IF;
+END $$;
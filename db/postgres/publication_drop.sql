@@ -0,0 +1 @@
+DROP PUBLICATION IF EXISTS {{ .PublicationName }};
@@ -0,0 +1,6 @@
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_publication WHERE pubname = '{{ .PublicationName }}') THEN
+        ALTER PUBLICATION {{ .PublicationName }} SET TABLE {{ .CompanyTableFullName }}, {{ .MetaTableFullName }};
+    END IF;
+END $$;
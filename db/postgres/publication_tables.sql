@@ -0,0 +1,4 @@
+SELECT array_remove(array_agg(t.schemaname || '.' || t.tablename ORDER BY t.schemaname, t.tablename), NULL)
+FROM pg_publication p
+LEFT JOIN pg_publication_tables t ON t.pubname = p.pubname
+WHERE p.pubname = '{{ .PublicationName }}';
@@ -0,0 +1,7 @@
+SELECT
+    slot_name,
+    active,
+    COALESCE(pg_wal_lsn_diff(pg_current_wal_lsn(), confirmed_flush_lsn), 0)::bigint
+FROM pg_replication_slots
+WHERE database = current_database() AND slot_type = 'logical'
+ORDER BY slot_name;
@@ -0,0 +1,3 @@
+SELECT left({{ .IDFieldName }}, 2), count(*)
+FROM {{ .CompanyTableFullName }}
+GROUP BY 1;
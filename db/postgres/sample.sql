@@ -0,0 +1,16 @@
+SELECT c.{{ .JSONFieldName }}
+FROM generate_series(1, $1) AS s
+CROSS JOIN (
+    SELECT min({{ .CursorFieldName }}) AS lo, max({{ .CursorFieldName }}) AS hi
+    FROM {{ .CompanyTableFullName }}
+) AS b
+CROSS JOIN LATERAL (
+    SELECT b.lo + floor(random() * (b.hi - b.lo + 1)) + s * 0 AS r
+) AS o
+CROSS JOIN LATERAL (
+    SELECT {{ .JSONFieldName }}
+    FROM {{ .CompanyTableFullName }}
+    WHERE {{ .CursorFieldName }} >= o.r
+    ORDER BY {{ .CursorFieldName }}
+    LIMIT 1
+) AS c;
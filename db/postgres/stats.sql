@@ -0,0 +1,13 @@
+SELECT
+    (
+        SELECT count(*)
+        FROM pg_stat_activity
+        WHERE datname = current_database() AND state = 'active'
+    ),
+    (
+        SELECT sum(blks_hit)::double precision / NULLIF(sum(blks_hit) + sum(blks_read), 0)
+        FROM pg_stat_database
+        WHERE datname = current_database()
+    ),
+    pg_table_size('{{ .CompanyTableFullName }}'),
+    pg_indexes_size('{{ .CompanyTableFullName }}');
@@ -0,0 +1,3 @@
+INSERT INTO {{ .TagTableFullName }} (namespace, tag, {{ .IDFieldName }})
+VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING
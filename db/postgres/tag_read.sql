@@ -0,0 +1,4 @@
+SELECT tag
+FROM {{ .TagTableFullName }}
+WHERE namespace = $1 AND {{ .IDFieldName }} = $2
+ORDER BY tag
@@ -0,0 +1,2 @@
+DELETE FROM {{ .TagTableFullName }}
+WHERE namespace = $1 AND tag = $2 AND {{ .IDFieldName }} = $3
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS {{ .TagTableFullName }} (
+    namespace varchar(64) NOT NULL,
+    tag varchar(32) NOT NULL,
+    {{ .IDFieldName }} char(14) NOT NULL,
+    PRIMARY KEY (namespace, tag, {{ .IDFieldName }})
+);
+CREATE INDEX IF NOT EXISTS {{ .TagTableName }}_namespace_id ON {{ .TagTableFullName }} (namespace, {{ .IDFieldName }});
@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"encoding/json/v2"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -12,7 +13,7 @@ import (
 	"github.com/cuducos/minha-receita/testutils"
 )
 
-var postgresDefaultIndexes = []string{"cnpj_pkey", "cnpj_id"}
+var postgresDefaultIndexes = []string{"cnpj_pkey", "cnpj_id", "cnpj_qsa_nome_socio"}
 
 func setUpPostgres(id, c string) (*PostgreSQL, error) {
 	u := os.Getenv("TEST_POSTGRES_URL")
@@ -92,3 +93,193 @@ func TestPostgresCreateIndexes(t *testing.T) {
 	}
 	testutils.AssertArraysHaveSameItems(t, i, listIndexesPostgres(t, pg))
 }
+
+func TestPostgresPublication(t *testing.T) {
+	pg, err := setUpPostgres("33683111000280", `{"cnpj":"33683111000280"}`)
+	if err != nil {
+		t.Errorf("expected no error setting up postgres, got %s", err)
+		return
+	}
+	defer func() {
+		if err := pg.Drop(); err != nil {
+			t.Errorf("expected no error dropping the tables, got %s", err)
+		}
+		pg.Close()
+	}()
+	p, err := pg.Publication(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error reading the publication, got %s", err)
+	}
+	if p.Exists || p.Name != "minha_receita_public" {
+		t.Errorf("expected minha_receita_public not to exist, got %+v", p)
+	}
+	s, err := pg.SubscriptionSQL("host=db user=o'neil")
+	if err != nil {
+		t.Fatalf("expected no error creating the subscription sql, got %s", err)
+	}
+	for _, expected := range []string{
+		"CREATE SCHEMA IF NOT EXISTS public;",
+		"CREATE TABLE IF NOT EXISTS public.cnpj",
+		"CREATE SUBSCRIPTION minha_receita_public CONNECTION 'host=db user=o''neil' PUBLICATION minha_receita_public;",
+	} {
+		if !strings.Contains(s, expected) {
+			t.Errorf("expected the subscription sql to contain %s, got %s", expected, s)
+		}
+	}
+}
+
+func TestPostgresBloat(t *testing.T) {
+	pg, err := setUpPostgres("33683111000280", `{"cnpj":"33683111000280"}`)
+	if err != nil {
+		t.Errorf("expected no error setting up postgres, got %s", err)
+		return
+	}
+	defer func() {
+		if err := pg.Drop(); err != nil {
+			t.Errorf("expected no error dropping the tables, got %s", err)
+		}
+		pg.Close()
+	}()
+	ctx := context.Background()
+	bs, err := pg.Bloat(ctx)
+	if err != nil {
+		t.Fatalf("expected no error estimating bloat, got %s", err)
+	}
+	var got []string
+	for _, b := range bs {
+		got = append(got, b.Kind+" "+b.Name)
+		if b.Wasted < 0 || b.Wasted > b.Size {
+			t.Errorf("expected wasted bytes of %s between 0 and %d, got %d", b.Name, b.Size, b.Wasted)
+		}
+		if b.NeedsMaintenance() {
+			t.Errorf("expected %s not to need maintenance with a single company", b.Name)
+		}
+	}
+	testutils.AssertArraysHaveSameItems(t, []string{"table cnpj", "index cnpj_pkey", "index cnpj_id"}, got)
+	for _, b := range bs {
+		if err := pg.Maintain(ctx, b); err != nil {
+			t.Errorf("expected no error maintaining %s, got %s", b.Name, err)
+		}
+	}
+}
+
+func TestPostgresEvents(t *testing.T) {
+	id := "33683111000280"
+	pg, err := setUpPostgres(id, `{"cnpj":"33683111000280"}`)
+	if err != nil {
+		t.Errorf("expected no error setting up postgres, got %s", err)
+		return
+	}
+	defer func() {
+		if err := pg.Drop(); err != nil {
+			t.Errorf("expected no error dropping the tables, got %s", err)
+		}
+		pg.Close()
+	}()
+	ctx := context.Background()
+	if _, err := pg.pool.Exec(ctx, "DROP TABLE IF EXISTS "+pg.EventTableFullName()+", "+pg.EventStateTableFullName()); err != nil {
+		t.Fatalf("expected no error dropping the event tables, got %s", err)
+	}
+	load := func(v string) {
+		if err := pg.MetaSave("updated-at", v); err != nil {
+			t.Fatalf("expected no error saving the dataset version, got %s", err)
+		}
+		if err := pg.SaveEvents(); err != nil {
+			t.Fatalf("expected no error saving the events, got %s", err)
+		}
+	}
+	load("2026-08-10")
+	load("2026-08-10") // nothing changed
+	other := "19131243000197"
+	if _, err := pg.pool.Exec(ctx, "TRUNCATE "+pg.CompanyTableFullName()); err != nil {
+		t.Fatalf("expected no error truncating the companies, got %s", err)
+	}
+	if err := pg.CreateCompanies([][]string{{other, `{"cnpj":"19131243000197"}`}}); err != nil {
+		t.Fatalf("expected no error saving a company, got %s", err)
+	}
+	load("2026-09-12")
+	if _, err := pg.pool.Exec(ctx, "TRUNCATE "+pg.CompanyTableFullName()); err != nil {
+		t.Fatalf("expected no error truncating the companies, got %s", err)
+	}
+	if err := pg.CreateCompanies([][]string{{other, `{"cnpj":"19131243000197","uf":"SP"}`}}); err != nil {
+		t.Fatalf("expected no error saving a company, got %s", err)
+	}
+	load("2026-10-10")
+	for _, tc := range []struct {
+		cnpj       string
+		operations []string
+		versions   []string
+		companies  []string
+	}{
+		{id, []string{EventInsert, EventDelete}, []string{"2026-08-10", "2026-09-12"}, []string{`{"cnpj": "33683111000280"}`, ""}},
+		{other, []string{EventInsert, EventUpdate}, []string{"2026-09-12", "2026-10-10"}, []string{`{"cnpj": "19131243000197"}`, `{"uf": "SP", "cnpj": "19131243000197"}`}},
+	} {
+		es, err := pg.Events(ctx, tc.cnpj)
+		if err != nil {
+			t.Errorf("expected no error reading the events of %s, got %s", tc.cnpj, err)
+		}
+		var ops, vs, cs []string
+		for _, e := range es {
+			ops = append(ops, e.Operation)
+			vs = append(vs, e.DatasetVersion)
+			cs = append(cs, string(e.Company))
+		}
+		if !slices.Equal(ops, tc.operations) || !slices.Equal(vs, tc.versions) {
+			t.Errorf("expected events %v %v for %s, got %v %v", tc.operations, tc.versions, tc.cnpj, ops, vs)
+		}
+		if !slices.Equal(cs, tc.companies) {
+			t.Errorf("expected companies %v in the events of %s, got %v", tc.companies, tc.cnpj, cs)
+		}
+		if len(es) > 0 && len(es[0].Hash) != 64 {
+			t.Errorf("expected a sha-256 hash for %s, got %s", tc.cnpj, es[0].Hash)
+		}
+	}
+}
+
+func TestPostgresSample(t *testing.T) {
+	pg, err := setUpPostgres("33683111000280", `{"cnpj":"33683111000280","n":0}`)
+	if err != nil {
+		t.Errorf("expected no error setting up postgres, got %s", err)
+		return
+	}
+	defer func() {
+		if err := pg.Drop(); err != nil {
+			t.Errorf("expected no error dropping the tables, got %s", err)
+		}
+		pg.Close()
+	}()
+	var cs [][]string
+	for n := 1; n < 100; n++ {
+		cs = append(cs, []string{fmt.Sprintf("%014d", n), fmt.Sprintf(`{"cnpj":"%014d","n":%d}`, n, n)})
+	}
+	if err := pg.CreateCompanies(cs); err != nil {
+		t.Fatalf("expected no error saving companies, got %s", err)
+	}
+	ss, err := pg.Sample(context.Background(), 400)
+	if err != nil {
+		t.Fatalf("expected no error sampling companies, got %s", err)
+	}
+	if len(ss) != 400 {
+		t.Errorf("expected 400 sampled companies, got %d", len(ss))
+	}
+	seen := make(map[int]struct{})
+	var quarters [4]int
+	for _, s := range ss {
+		var c struct {
+			N int `json:"n"`
+		}
+		if err := json.Unmarshal([]byte(s), &c); err != nil {
+			t.Fatalf("expected no error unmarshalling sampled company, got %s", err)
+		}
+		seen[c.N] = struct{}{}
+		quarters[c.N/25]++
+	}
+	for i, q := range quarters {
+		if q < 50 {
+			t.Errorf("expected the sample to spread across the table, got %d companies in quarter %d: %v", q, i+1, quarters)
+		}
+	}
+	if len(seen) < 50 {
+		t.Errorf("expected at least 50 different companies in the sample, got %d", len(seen))
+	}
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Profile is a named set of fields of the company JSON, so clients can ask
+// for smaller responses.
+type Profile string
+
+const (
+	ProfileMinimal      Profile = "minimal"
+	ProfileRegistration Profile = "registration"
+	ProfileCNAEs        Profile = "cnaes"
+	ProfileFull         Profile = "full"
+)
+
+var minimalFields = []string{
+	"cnpj",
+	"razao_social",
+	"nome_fantasia",
+	"situacao_cadastral",
+	"descricao_situacao_cadastral",
+	"uf",
+	"municipio",
+}
+
+var profileFields = map[Profile][]string{
+	ProfileMinimal: minimalFields,
+	ProfileRegistration: append(slices.Clone(minimalFields),
+		"identificador_matriz_filial",
+		"descricao_identificador_matriz_filial",
+		"data_situacao_cadastral",
+		"motivo_situacao_cadastral",
+		"descricao_motivo_situacao_cadastral",
+		"data_inicio_atividade",
+		"cnae_fiscal",
+		"cnae_fiscal_descricao",
+		"cnaes_secundarios",
+		"codigo_natureza_juridica",
+		"natureza_juridica",
+		"capital_social",
+		"codigo_porte",
+		"porte",
+		"descricao_tipo_de_logradouro",
+		"logradouro",
+		"numero",
+		"complemento",
+		"bairro",
+		"cep",
+		"codigo_municipio",
+		"codigo_municipio_ibge",
+		"opcao_pelo_simples",
+		"opcao_pelo_mei",
+	),
+	ProfileCNAEs: {"cnpj", "cnae_fiscal", "cnae_fiscal_descricao", "cnaes_secundarios"},
+	ProfileFull:  nil,
+}
+
+// Profiles lists the valid profile names.
+func Profiles() []string {
+	return []string{string(ProfileMinimal), string(ProfileRegistration), string(ProfileCNAEs), string(ProfileFull)}
+}
+
+// ParseProfile validates a profile name. An empty name is the full profile.
+func ParseProfile(s string) (Profile, error) {
+	p := Profile(strings.ToLower(strings.TrimSpace(s)))
+	if p == "" {
+		return ProfileFull, nil
+	}
+	if _, ok := profileFields[p]; !ok {
+		return "", fmt.Errorf("invalid profile %s, valid options are: %s", s, strings.Join(Profiles(), ", "))
+	}
+	return p, nil
+}
+
+func (p Profile) String() string {
+	if p == "" {
+		return string(ProfileFull)
+	}
+	return string(p)
+}
+
+// Fields returns the fields included in the profile, nil means all fields.
+func (p Profile) Fields() []string { return profileFields[p] }
@@ -0,0 +1,43 @@
+package db
+
+import "testing"
+
+func TestParseProfile(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		expected Profile
+	}{
+		{"", ProfileFull},
+		{"full", ProfileFull},
+		{"minimal", ProfileMinimal},
+		{" Registration ", ProfileRegistration},
+		{"CNAES", ProfileCNAEs},
+	} {
+		got, err := ParseProfile(tc.value)
+		if err != nil {
+			t.Errorf("expected no error parsing %q, got %s", tc.value, err)
+		}
+		if got != tc.expected {
+			t.Errorf("expected %q to be %s, got %s", tc.value, tc.expected, got)
+		}
+	}
+	if _, err := ParseProfile("everything"); err == nil {
+		t.Error("expected error parsing an invalid profile, got nil")
+	}
+}
+
+func TestProfileFields(t *testing.T) {
+	if fs := ProfileFull.Fields(); fs != nil {
+		t.Errorf("expected full profile to have no field selection, got %v", fs)
+	}
+	m := ProfileMinimal.Fields()
+	r := ProfileRegistration.Fields()
+	if len(r) <= len(m) {
+		t.Errorf("expected registration profile to have more fields than minimal, got %d and %d", len(r), len(m))
+	}
+	for i, f := range m {
+		if r[i] != f {
+			t.Errorf("expected registration profile to include %s, got %s", f, r[i])
+		}
+	}
+}
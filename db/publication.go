@@ -0,0 +1,18 @@
+package db
+
+// Publication is the logical replication publication of the companies and
+// metadata tables, which downstream PostgreSQL databases can subscribe to.
+type Publication struct {
+	Name   string
+	Exists bool
+	Tables []string          // tables in the publication, in dot-notation
+	Slots  []ReplicationSlot // logical replication slots in the database
+}
+
+// ReplicationSlot is where the database keeps the changes not yet confirmed
+// by a subscriber (PostgreSQL creates one per subscription).
+type ReplicationSlot struct {
+	Name   string
+	Active bool  // whether a subscriber is connected
+	Lag    int64 // bytes of WAL not yet confirmed by the subscriber
+}
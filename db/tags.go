@@ -0,0 +1,37 @@
+package db
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Tags are labels API clients attach to companies (e.g. cliente or
+// fornecedor) to filter the paginated search. Each API key has its own tags,
+// so the name of the key is the namespace of its tags.
+var tagName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// ValidateTag checks if a tag is valid: up to 32 lowercase letters, digits,
+// hyphens and underscores, starting with a letter or digit.
+func ValidateTag(t string) error {
+	if !tagName.MatchString(t) {
+		return fmt.Errorf("invalid tag %s, use up to 32 lowercase letters, digits, hyphens and underscores", t)
+	}
+	return nil
+}
+
+func parseURLParamsToTags(q []string) []string {
+	var r []string
+	for _, v := range q {
+		for s := range strings.SplitSeq(v, ",") {
+			s = strings.ToLower(strings.TrimSpace(s))
+			if err := ValidateTag(s); err != nil {
+				slog.Info("Ignoring invalid tag", "tag", s)
+				continue
+			}
+			r = append(r, s)
+		}
+	}
+	return r
+}
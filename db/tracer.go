@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "database_query_duration_seconds",
+	Help:    "The duration of database queries in seconds, measured by the database driver",
+	Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+}, []string{"query", "result"})
+
+type queryNameKey struct{}
+
+type queryStartKey struct{}
+
+// withQueryName names the queries sent with the context, so their metrics
+// are grouped by what they are for instead of by their SQL.
+func withQueryName(ctx context.Context, n string) context.Context {
+	return context.WithValue(ctx, queryNameKey{}, n)
+}
+
+func queryNameFrom(ctx context.Context) string {
+	if n, ok := ctx.Value(queryNameKey{}).(string); ok {
+		return n
+	}
+	return "other"
+}
+
+// queryTracer feeds the query duration histogram from pgx, so the time spent
+// in the database is distinguishable from the time spent in the application.
+type queryTracer struct{}
+
+func (queryTracer) start(ctx context.Context) context.Context {
+	return context.WithValue(ctx, queryStartKey{}, time.Now())
+}
+
+func (queryTracer) end(ctx context.Context, err error) {
+	t, ok := ctx.Value(queryStartKey{}).(time.Time)
+	if !ok {
+		return
+	}
+	r := "ok"
+	if err != nil {
+		r = "error"
+	}
+	queryDuration.WithLabelValues(queryNameFrom(ctx), r).Observe(time.Since(t).Seconds())
+}
+
+func (q queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	return q.start(ctx)
+}
+
+func (q queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, d pgx.TraceQueryEndData) {
+	q.end(ctx, d.Err)
+}
+
+func (q queryTracer) TraceCopyFromStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceCopyFromStartData) context.Context {
+	return q.start(withQueryName(ctx, "copy"))
+}
+
+func (q queryTracer) TraceCopyFromEnd(ctx context.Context, _ *pgx.Conn, d pgx.TraceCopyFromEndData) {
+	q.end(ctx, d.Err)
+}
@@ -0,0 +1,34 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestQueryName(t *testing.T) {
+	if got := queryNameFrom(context.Background()); got != "other" {
+		t.Errorf("expected unnamed query to be other, got %s", got)
+	}
+	if got := queryNameFrom(withQueryName(context.Background(), "get")); got != "get" {
+		t.Errorf("expected query to be get, got %s", got)
+	}
+}
+
+func TestQueryTracer(t *testing.T) {
+	queryDuration.Reset()
+	var q queryTracer
+	ctx := q.TraceQueryStart(withQueryName(context.Background(), "search"), nil, pgx.TraceQueryStartData{})
+	q.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+	ctx = q.TraceQueryStart(withQueryName(context.Background(), "search"), nil, pgx.TraceQueryStartData{})
+	q.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("timeout")})
+	ctx = q.TraceCopyFromStart(context.Background(), nil, pgx.TraceCopyFromStartData{})
+	q.TraceCopyFromEnd(ctx, nil, pgx.TraceCopyFromEndData{})
+	q.TraceQueryEnd(context.Background(), nil, pgx.TraceQueryEndData{}) // no start, ignored
+	if got := testutil.CollectAndCount(queryDuration); got != 3 {
+		t.Errorf("expected 3 series (search ok, search error, copy ok), got %d", got)
+	}
+}
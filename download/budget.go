@@ -0,0 +1,103 @@
+package download
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultRequestBurst is how many requests can be sent at once to the Federal
+// Revenue servers when there is a request budget.
+const DefaultRequestBurst = 1
+
+// budget limits the requests to the Federal Revenue servers, nil when there
+// is no limit.
+var budget *requestBudget
+
+// UseRequestBudget limits the requests to the Federal Revenue servers to rate
+// requests per second, allowing bursts of up to burst requests. The limit is
+// shared by all files and parallel downloads of the process: the server bans
+// IPs sending too many requests, which breaks the downloads mid-run. A rate of
+// zero disables the limit.
+func UseRequestBudget(rate float64, burst int) {
+	if rate <= 0 {
+		budget = nil
+		return
+	}
+	budget = newRequestBudget(rate, burst, time.Now)
+}
+
+// requestBudget is a token bucket in which requests reserve a token, waiting
+// for it if the bucket is empty, so waiting requests are sent in order and at
+// the configured rate.
+type requestBudget struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newRequestBudget(rate float64, burst int, now func() time.Time) *requestBudget {
+	b := math.Max(1, float64(burst))
+	return &requestBudget{rate: rate, burst: b, tokens: b, last: now(), now: now}
+}
+
+// reserve takes a token and returns how long to wait until it is available.
+func (b *requestBudget) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(-b.tokens / b.rate * float64(time.Second)))
+}
+
+func (b *requestBudget) wait(ctx context.Context) error {
+	d := b.reserve()
+	if d == 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// wrap returns a copy of the client that waits for the budget before each
+// request, or the client itself if there is no budget.
+func (b *requestBudget) wrap(c *http.Client) *http.Client {
+	if b == nil {
+		return c
+	}
+	n := c.Transport
+	if n == nil {
+		n = http.DefaultTransport
+	}
+	w := *c
+	w.Transport = budgetTransport{budget: b, next: n}
+	return &w
+}
+
+type budgetTransport struct {
+	budget *requestBudget
+	next   http.RoundTripper
+}
+
+func (t budgetTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if err := t.budget.wait(r.Context()); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(r)
+}
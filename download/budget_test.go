@@ -0,0 +1,62 @@
+package download
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequestBudgetReserve(t *testing.T) {
+	now := time.Now()
+	b := newRequestBudget(2, 3, func() time.Time { return now })
+	for _, tc := range []struct {
+		name     string
+		after    time.Duration
+		expected time.Duration
+	}{
+		{"first request of the burst", 0, 0},
+		{"second request of the burst", 0, 0},
+		{"third request of the burst", 0, 0},
+		{"waits for the next token", 0, 500 * time.Millisecond},
+		{"waits after the requests already waiting", 0, time.Second},
+		{"refills while waiting", time.Second, 500 * time.Millisecond},
+		{"never refills more than the burst", time.Hour, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			now = now.Add(tc.after)
+			if got := b.reserve(); got != tc.expected {
+				t.Errorf("expected to wait %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestRequestBudgetWrap(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	c := &http.Client{}
+	var b *requestBudget
+	if got := b.wrap(c); got != c {
+		t.Error("expected the same client without a budget")
+	}
+	b = newRequestBudget(20, 1, time.Now)
+	w := b.wrap(c)
+	if c.Transport != nil {
+		t.Error("expected the original client not to be changed")
+	}
+	s := time.Now()
+	for range 3 {
+		r, err := w.Get(ts.URL)
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		r.Body.Close()
+	}
+	if d := time.Since(s); d < 90*time.Millisecond {
+		t.Errorf("expected 3 requests at 20 per second to take at least 100ms, took %s", d)
+	}
+}
@@ -10,7 +10,10 @@ import (
 	"path/filepath"
 )
 
-func checkZipFile(pth string) error {
+func checkZipFile(pth string, cs checksums) error {
+	if err := cs.verify(pth); err != nil {
+		return err
+	}
 	r, err := zip.OpenReader(pth)
 	if err != nil {
 		return fmt.Errorf("error opening %s: %w", pth, err)
@@ -53,11 +56,15 @@ func checkZipFiles(dir string) (map[string]error, error) {
 	if len(ls) == 0 {
 		return r, fmt.Errorf("no zip files found")
 	}
+	cs, err := loadChecksums(dir)
+	if err != nil {
+		return r, err
+	}
 	slog.Info(fmt.Sprintf("Checking %d files…\n", len(ls)))
 	checks := make(chan check)
 	for _, pth := range ls {
 		go func(pth string) {
-			err := checkZipFile(pth)
+			err := checkZipFile(pth, cs)
 			if err != nil {
 				slog.Error("Failed checking", "path", pth, "error", err)
 			}
@@ -77,7 +77,7 @@ func TestCheckZipFile(t *testing.T) {
 		{badZipPath, fmt.Errorf("error opening %s: zip: not a valid zip file", badZipPath)},
 	}
 	for _, tc := range tt {
-		err := checkZipFile(tc.pth)
+		err := checkZipFile(tc.pth, nil)
 		if tc.expected == nil {
 			if err != tc.expected {
 				t.Errorf("expected nil, got %s", err)
@@ -0,0 +1,156 @@
+package download
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// ChecksumsFile is a file that contains the size and the SHA-256 of each file
+// completely downloaded, so interrupted downloads can tell complete files from
+// partial ones, and corrupted files can be detected later on
+const ChecksumsFile = "checksums.json"
+
+type checksum struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+func newChecksum(pth string) (c checksum, err error) { // using named return so we can set it in the defer call
+	f, err := os.Open(pth)
+	if err != nil {
+		return c, fmt.Errorf("could not open %s: %w", pth, err)
+	}
+	defer func() {
+		if e := f.Close(); e != nil && err == nil {
+			err = fmt.Errorf("could not close %s: %w", pth, e)
+		}
+	}()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return c, fmt.Errorf("could not read %s: %w", pth, err)
+	}
+	return checksum{n, hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// checksums are indexed by file name
+type checksums map[string]checksum
+
+// loadChecksums returns nil if there is no checksums file in the directory.
+func loadChecksums(dir string) (checksums, error) {
+	pth := filepath.Join(dir, ChecksumsFile)
+	b, err := os.ReadFile(pth)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", pth, err)
+	}
+	var cs checksums
+	if err := json.Unmarshal(b, &cs); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", pth, err)
+	}
+	return cs, nil
+}
+
+func (cs checksums) save(dir string) error {
+	pth := filepath.Join(dir, ChecksumsFile)
+	b, err := json.Marshal(cs, json.Deterministic(true))
+	if err != nil {
+		return fmt.Errorf("could not serialize checksums: %w", err)
+	}
+	if err := os.WriteFile(pth, b, 0644); err != nil {
+		return fmt.Errorf("could not write %s: %w", pth, err)
+	}
+	return nil
+}
+
+// record calculates and saves the checksum of a file that has just been
+// completely downloaded.
+func (cs checksums) record(dir, pth string) error {
+	c, err := newChecksum(pth)
+	if err != nil {
+		return err
+	}
+	cs[filepath.Base(pth)] = c
+	return cs.save(dir)
+}
+
+// isComplete tells whether a file matches the size recorded when its download
+// was completed (it does not calculate the hash, to keep it fast).
+func (cs checksums) isComplete(pth string) bool {
+	c, ok := cs[filepath.Base(pth)]
+	if !ok {
+		return false
+	}
+	i, err := os.Stat(pth)
+	if err != nil {
+		return false
+	}
+	return i.Size() == c.Size
+}
+
+// verify returns an error if the file does not match the recorded checksum.
+// Files without a recorded checksum are not verified.
+func (cs checksums) verify(pth string) error {
+	exp, ok := cs[filepath.Base(pth)]
+	if !ok {
+		slog.Debug("no checksum recorded", "path", pth)
+		return nil
+	}
+	got, err := newChecksum(pth)
+	if err != nil {
+		return err
+	}
+	if got.Size != exp.Size {
+		return fmt.Errorf("expected %s to have %d bytes, got %d", pth, exp.Size, got.Size)
+	}
+	if got.SHA256 != exp.SHA256 {
+		return fmt.Errorf("expected %s to have sha256 %s, got %s", pth, exp.SHA256, got.SHA256)
+	}
+	return nil
+}
+
+// VerifyManifest checks a directory of files downloaded elsewhere (e.g. a
+// local mirror or a network mount) against its checksums file: every file
+// listed there must exist with the recorded size and SHA-256.
+func VerifyManifest(dir string) error {
+	cs, err := loadChecksums(dir)
+	if err != nil {
+		return err
+	}
+	if cs == nil {
+		return fmt.Errorf("could not find %s in %s", ChecksumsFile, dir)
+	}
+	ns := make([]string, 0, len(cs))
+	for n := range cs {
+		ns = append(ns, n)
+	}
+	sort.Strings(ns)
+	slog.Info(fmt.Sprintf("Verifying %d files in %s…", len(ns), dir))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, runtime.NumCPU())
+	errs := make([]error, len(ns))
+	for i, n := range ns {
+		wg.Go(func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			errs[i] = cs.verify(filepath.Join(dir, n))
+		})
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("files in %s do not match %s: %w", dir, ChecksumsFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package download
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChecksums(t *testing.T) {
+	tmp := t.TempDir()
+	pth := filepath.Join(tmp, "answer.txt")
+	if err := os.WriteFile(pth, []byte("42"), 0644); err != nil {
+		t.Fatalf("could not create test file: %s", err)
+	}
+	cs := make(checksums)
+	if cs.isComplete(pth) {
+		t.Error("expected file without checksum to be incomplete")
+	}
+	if err := cs.record(tmp, pth); err != nil {
+		t.Fatalf("expected no error recording checksum, got %s", err)
+	}
+	got, err := loadChecksums(tmp)
+	if err != nil {
+		t.Fatalf("expected no error loading checksums, got %s", err)
+	}
+	c := got["answer.txt"]
+	if c.Size != 2 {
+		t.Errorf("expected size 2, got %d", c.Size)
+	}
+	if c.SHA256 != "73475cb40a568e8da8a045ced110137e159f890ac4da883b6b17dc651b3a8049" {
+		t.Errorf("expected the sha256 of 42, got %s", c.SHA256)
+	}
+	if !got.isComplete(pth) {
+		t.Error("expected file with matching size to be complete")
+	}
+	if err := got.verify(pth); err != nil {
+		t.Errorf("expected no error verifying file, got %s", err)
+	}
+	if err := os.WriteFile(pth, []byte("24"), 0644); err != nil {
+		t.Fatalf("could not change test file: %s", err)
+	}
+	if err := got.verify(pth); err == nil {
+		t.Error("expected error verifying changed file, got nil")
+	}
+	if err := os.WriteFile(pth, []byte("4"), 0644); err != nil {
+		t.Fatalf("could not change test file: %s", err)
+	}
+	if got.isComplete(pth) {
+		t.Error("expected truncated file to be incomplete")
+	}
+}
+
+func TestLoadChecksumsWithoutFile(t *testing.T) {
+	cs, err := loadChecksums(t.TempDir())
+	if err != nil {
+		t.Errorf("expected no error without checksums file, got %s", err)
+	}
+	if cs != nil {
+		t.Errorf("expected no checksums, got %v", cs)
+	}
+}
+
+func TestVerifyManifest(t *testing.T) {
+	t.Run("without manifest", func(t *testing.T) {
+		if err := VerifyManifest(t.TempDir()); err == nil {
+			t.Error("expected error without checksums file, got nil")
+		}
+	})
+	t.Run("matching files", func(t *testing.T) {
+		tmp := t.TempDir()
+		cs := make(checksums)
+		for _, n := range []string{"Empresas0.zip", "Socios0.zip"} {
+			pth := filepath.Join(tmp, n)
+			if err := os.WriteFile(pth, []byte(n), 0644); err != nil {
+				t.Fatalf("could not create test file: %s", err)
+			}
+			if err := cs.record(tmp, pth); err != nil {
+				t.Fatalf("expected no error recording checksum, got %s", err)
+			}
+		}
+		if err := VerifyManifest(tmp); err != nil {
+			t.Errorf("expected no error verifying manifest, got %s", err)
+		}
+		if err := os.WriteFile(filepath.Join(tmp, "Socios0.zip"), []byte("42"), 0644); err != nil {
+			t.Fatalf("could not change test file: %s", err)
+		}
+		if err := VerifyManifest(tmp); err == nil {
+			t.Error("expected error verifying changed file, got nil")
+		}
+		if err := os.Remove(filepath.Join(tmp, "Socios0.zip")); err != nil {
+			t.Fatalf("could not remove test file: %s", err)
+		}
+		if err := VerifyManifest(tmp); err == nil {
+			t.Error("expected error verifying missing file, got nil")
+		}
+	})
+}
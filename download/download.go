@@ -1,10 +1,8 @@
 package download
 
 import (
-	"errors"
 	"fmt"
 	"log/slog"
-	"os"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -18,21 +16,25 @@ func getURLs(url string, handler getURLsHandler, dir string, skip bool) ([]strin
 	if err != nil {
 		return nil, fmt.Errorf("error getting urls: %w", err)
 	}
+	return pending(urls, dir, skip)
+}
+
+// pending removes the URLs of files already downloaded when skip is true. A
+// file is only considered downloaded if it matches the size recorded in the
+// checksums file, so files without a checksum (e.g. from an interrupted first
+// run) are downloaded again.
+func pending(urls []string, dir string, skip bool) ([]string, error) {
 	if !skip {
 		return urls, nil
 	}
+	cs, err := loadChecksums(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error loading checksums: %w", err)
+	}
 	var out []string
 	for _, u := range urls {
-		p := filepath.Join(dir, filepath.Base(u))
-		f, err := os.Open(p)
-		if !skip || errors.Is(err, os.ErrNotExist) {
+		if !cs.isComplete(filepath.Join(dir, filepath.Base(u))) { // missing or partial download
 			out = append(out, u)
-			continue
-		}
-		if err == nil {
-			if err := f.Close(); err != nil {
-				return nil, fmt.Errorf("error closing %s: %w", p, err)
-			}
 		}
 	}
 	return out, nil
@@ -48,49 +50,74 @@ func downloadNationalTreasure(dir string, skip bool) error {
 	if len(urls) == 0 {
 		return nil
 	}
+	cs, err := loadChecksums(dir)
+	if err != nil {
+		return fmt.Errorf("error loading checksums: %w", err)
+	}
+	if cs == nil {
+		cs = make(checksums)
+	}
 	for _, u := range urls {
 		if err := simpleDownload(u, dir); err != nil {
 			return err
 		}
+		if err := cs.record(dir, filepath.Join(dir, filepath.Base(u))); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-// Download all the files (might take hours).
-func Download(dir string, timeout time.Duration, skip, restart bool, parallel int, retries uint, chunkSize int64) error {
+// Download all the files (might take hours) listed by the provider p, limited
+// to the types of files in only (see FileTypes) unless it is empty. Mirrors
+// are base URLs (scheme and host, optionally with a path prefix) serving the
+// same paths as the Federal Revenue server, and they are tried in order for
+// the files that fail.
+func Download(dir string, p Provider, only []string, timeout time.Duration, skip, restart bool, parallel int, retries uint, chunkSize int64, mirrors []string) error {
 	slog.Info("Downloading file(s) from the National Treasure…")
 	if err := downloadNationalTreasure(dir, skip); err != nil {
 		return fmt.Errorf("error downloading files from the national treasure: %w", err)
 	}
 	slog.Info("Downloading files from the Federal Revenue…")
-	urls, err := getURLs(federalRevenueURL, federalRevenueGetURLs, dir, skip)
+	urls, err := p.URLs()
+	if err != nil {
+		return fmt.Errorf("error gathering resources for download: %w", err)
+	}
+	urls, err = pending(filterFileTypes(urls, only), dir, skip)
 	if err != nil {
 		return fmt.Errorf("error gathering resources for download: %w", err)
 	}
+	if err := saveOnly(dir, only); err != nil {
+		return err
+	}
 	if len(urls) == 0 {
 		return nil
 	}
-	if err := download(dir, urls, parallel, retries, chunkSize, timeout, restart); err != nil {
+	if err := download(dir, urls, mirrors, parallel, retries, chunkSize, timeout, restart); err != nil {
 		return fmt.Errorf("error downloading files from the federal revenue: %w", err)
 	}
-	if err := saveUpdatedAt(dir); err != nil {
+	if err := saveUpdatedAt(dir, p); err != nil {
 		return fmt.Errorf("error getting updated at date: %w", err)
 	}
 	return nil
 }
 
-// URLs shows the URLs to be downloaded.
-func URLs(dir string, skip bool) error {
-	urls := []string{federalRevenueURL, nationalTreasureBaseURL}
-	handlers := []getURLsHandler{federalRevenueGetURLs, nationalTreasureGetURLs}
-	var out []string
-	for idx := range urls {
-		u, err := getURLs(urls[idx], handlers[idx], dir, skip)
-		if err != nil {
-			return fmt.Errorf("error gathering resources for download: %w", err)
-		}
-		out = append(out, u...)
+// URLs shows the URLs to be downloaded, the Federal Revenue ones listed by the
+// provider p and limited to the types of files in only.
+func URLs(dir string, p Provider, only []string, skip bool) error {
+	out, err := getURLs(nationalTreasureBaseURL, nationalTreasureGetURLs, dir, skip)
+	if err != nil {
+		return fmt.Errorf("error gathering resources for download: %w", err)
+	}
+	urls, err := p.URLs()
+	if err != nil {
+		return fmt.Errorf("error gathering resources for download: %w", err)
+	}
+	urls, err = pending(filterFileTypes(urls, only), dir, skip)
+	if err != nil {
+		return fmt.Errorf("error gathering resources for download: %w", err)
 	}
+	out = append(out, urls...)
 	sort.Strings(out)
 	fmt.Println(strings.Join(out, "\n"))
 	return nil
@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path"
+	"path/filepath"
 	"sync/atomic"
 	"testing"
 )
@@ -69,3 +70,33 @@ func httpTestServer(t *testing.T, cs []string) *httptest.Server {
 			http.ServeFile(w, r, path.Join("..", "testdata", cs[idx]))
 		}))
 }
+
+func TestGetURLsSkipsOnlyCompleteFiles(t *testing.T) {
+	ts := httpTestServer(t, []string{"national-treasure.json"})
+	defer ts.Close()
+	tmp := t.TempDir()
+	got, err := getURLs(ts.URL, nationalTreasureGetURLs, tmp, true)
+	if err != nil || len(got) != 1 {
+		t.Fatalf("expected one url and no error, got %d and %v", len(got), err)
+	}
+	pth := filepath.Join(tmp, filepath.Base(got[0]))
+	if err := os.WriteFile(pth, []byte("42"), 0644); err != nil {
+		t.Fatalf("could not create test file: %s", err)
+	}
+	if got, err := getURLs(ts.URL, nationalTreasureGetURLs, tmp, true); err != nil || len(got) != 1 {
+		t.Errorf("expected file without checksums not to be skipped, got %d url(s) and %v", len(got), err)
+	}
+	cs := checksums{filepath.Base(pth): {Size: 4242}}
+	if err := cs.save(tmp); err != nil {
+		t.Fatalf("could not save checksums: %s", err)
+	}
+	if got, err := getURLs(ts.URL, nationalTreasureGetURLs, tmp, true); err != nil || len(got) != 1 {
+		t.Errorf("expected partial file not to be skipped, got %d url(s) and %v", len(got), err)
+	}
+	if err := cs.record(tmp, pth); err != nil {
+		t.Fatalf("could not record checksum: %s", err)
+	}
+	if got, err := getURLs(ts.URL, nationalTreasureGetURLs, tmp, true); err != nil || len(got) != 0 {
+		t.Errorf("expected complete file to be skipped, got %d url(s) and %v", len(got), err)
+	}
+}
@@ -1,15 +1,21 @@
 package download
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/cuducos/chunk"
+	"github.com/cuducos/minha-receita/warnings"
 	"github.com/schollz/progressbar/v3"
 )
 
@@ -70,24 +76,123 @@ func (b *bar) update(s chunk.DownloadStatus) error {
 	return b.main.Set64(b.downloadedBytes())
 }
 
-func download(dir string, urls []string, parallel int, retries uint, chunkSize int64, timeout time.Duration, restart bool) error {
+// mirrorURL replaces the scheme and host of a URL by the mirror's base URL,
+// keeping the path (e.g. https://mirror.example.com/receita and
+// https://arquivos.receitafederal.gov.br/dados/cnpj/Empresas0.zip become
+// https://mirror.example.com/receita/dados/cnpj/Empresas0.zip)
+func mirrorURL(u, mirror string) (string, error) {
+	p, err := url.Parse(u)
+	if err != nil {
+		return "", fmt.Errorf("could not parse url %s: %w", u, err)
+	}
+	return strings.TrimSuffix(mirror, "/") + p.EscapedPath(), nil
+}
+
+// each mirror keeps its own progress files since chunk refuses to resume a
+// file whose progress was recorded for another URL
+func progressDir(mirror string) (string, error) {
+	if mirror == "" {
+		return "", nil // use chunk's default
+	}
+	u, err := url.Parse(mirror)
+	if err != nil {
+		return "", fmt.Errorf("could not parse mirror url %s: %w", mirror, err)
+	}
+	d := os.Getenv("CHUNK_DIR")
+	if d == "" {
+		h, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("could not get the home directory: %w", err)
+		}
+		d = filepath.Join(h, chunk.DefaultChunkDir)
+	}
+	return filepath.Join(d, "mirrors", u.Host), nil
+}
+
+// downloadFrom downloads the URLs using chunk and returns the ones that failed
+// (mapping the original URL to the error).
+func downloadFrom(dir string, urls []string, mirror string, cs checksums, parallel int, retries uint, chunkSize int64, timeout time.Duration, restart bool) (map[string]error, error) {
+	src := make(map[string]string, len(urls))
+	for _, u := range urls {
+		if mirror == "" {
+			src[u] = u
+			continue
+		}
+		m, err := mirrorURL(u, mirror)
+		if err != nil {
+			return nil, err
+		}
+		src[m] = u
+	}
+	pd, err := progressDir(mirror)
+	if err != nil {
+		return nil, err
+	}
 	d := chunk.DefaultDownloader()
 	d.OutputDir = dir
+	d.ProgressDir = pd
 	d.ConcurrencyPerServer = parallel
 	d.Timeout = timeout
 	d.MaxRetries = retries
 	d.ChunkSize = chunkSize
 	d.RestartDownloads = restart
+	d.Client = resilient(d.Client)
+	if mirror == "" {
+		d.Client = budget.wrap(d.Client)
+	}
 	b := bar{urls: make(map[string]int64), totalFiles: len(urls)}
-	for s := range d.Download(urls...) {
+	fails := make(map[string]error)
+	for s := range d.Download(slices.Collect(maps.Keys(src))...) {
 		if s.Error != nil {
-			return s.Error
+			if _, ok := fails[src[s.URL]]; !ok {
+				slog.Warn("download failed", "url", s.URL, "error", s.Error)
+				warnings.Add(warnings.Download, "download failed", s.URL)
+				fails[src[s.URL]] = s.Error
+			}
+			continue
 		}
 		if err := b.update(s); err != nil {
-			return fmt.Errorf("could not increase progress bar: %w", err)
+			return nil, fmt.Errorf("could not increase progress bar: %w", err)
+		}
+		if s.IsFinished() {
+			if err := cs.record(dir, s.DownloadedFilePath); err != nil {
+				return nil, fmt.Errorf("could not record checksum: %w", err)
+			}
 		}
 	}
-	return nil
+	return fails, nil
+}
+
+// download tries the original URLs first and, then, each mirror in order, only
+// for the files that failed in the previous attempt.
+func download(dir string, urls, mirrors []string, parallel int, retries uint, chunkSize int64, timeout time.Duration, restart bool) error {
+	cs, err := loadChecksums(dir)
+	if err != nil {
+		return fmt.Errorf("error loading checksums: %w", err)
+	}
+	if cs == nil {
+		cs = make(checksums)
+	}
+	pending := urls
+	var fails map[string]error
+	for _, m := range append([]string{""}, mirrors...) {
+		if m != "" {
+			slog.Info("Trying mirror", "mirror", m, "files", len(pending))
+		}
+		fails, err = downloadFrom(dir, pending, m, cs, parallel, retries, chunkSize, timeout, restart)
+		if err != nil {
+			return err
+		}
+		if len(fails) == 0 {
+			return nil
+		}
+		pending = slices.Sorted(maps.Keys(fails))
+	}
+	var errs []error
+	for _, u := range pending {
+		errs = append(errs, fmt.Errorf("error downloading %s: %w", u, fails[u]))
+	}
+	return errors.Join(errs...)
 }
 
 func simpleDownload(url, dir string) (err error) {
@@ -101,7 +206,7 @@ func simpleDownload(url, dir string) (err error) {
 			err = fmt.Errorf("could not close %s: %w", pth, e)
 		}
 	}()
-	c := http.Client{}
+	c := resilient(&http.Client{})
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return fmt.Errorf("error creating request %s: %w", url, err)
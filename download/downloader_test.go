@@ -1,6 +1,8 @@
 package download
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
@@ -20,7 +22,7 @@ func TestDownloader(t *testing.T) {
 
 	tmp := t.TempDir()
 	urls := []string{ts.URL + "/file1.html", ts.URL + "/file2.html"}
-	if err := download(tmp, urls, DefaultMaxParallel, DefaultMaxRetries, DefaultChunkSize, 10*time.Second, true); err != nil {
+	if err := download(tmp, urls, nil, DefaultMaxParallel, DefaultMaxRetries, DefaultChunkSize, 10*time.Second, true); err != nil {
 		t.Errorf("Expected downloadAll to run without errors, got: %v", err)
 	}
 	for _, u := range urls {
@@ -39,3 +41,42 @@ func TestDownloader(t *testing.T) {
 		}
 	}
 }
+
+func TestDownloaderWithMirror(t *testing.T) {
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+	mirror := httpTestServer(t, []string{"Empresas1.zip"})
+	defer mirror.Close()
+	t.Setenv("CHUNK_DIR", t.TempDir())
+
+	tmp := t.TempDir()
+	urls := []string{broken.URL + "/dados/Empresas1.zip"}
+	if err := download(tmp, urls, nil, DefaultMaxParallel, 1, DefaultChunkSize, time.Second, true); err == nil {
+		t.Error("expected error downloading from a broken server without mirrors, got nil")
+	}
+	if err := download(tmp, urls, []string{mirror.URL}, DefaultMaxParallel, 1, DefaultChunkSize, time.Second, true); err != nil {
+		t.Errorf("expected no error downloading from the mirror, got %s", err)
+	}
+	cs, err := loadChecksums(tmp)
+	if err != nil {
+		t.Fatalf("expected no error loading checksums, got %s", err)
+	}
+	if err := cs.verify(filepath.Join(tmp, "Empresas1.zip")); err != nil {
+		t.Errorf("expected downloaded file to match its checksum, got %s", err)
+	}
+	if _, ok := cs["Empresas1.zip"]; !ok {
+		t.Error("expected checksum of Empresas1.zip to be recorded")
+	}
+}
+
+func TestMirrorURL(t *testing.T) {
+	got, err := mirrorURL("https://arquivos.receitafederal.gov.br/dados/cnpj/Empresas0.zip", "https://mirror.example.com/receita/")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if exp := "https://mirror.example.com/receita/dados/cnpj/Empresas0.zip"; got != exp {
+		t.Errorf("expected %s, got %s", exp, got)
+	}
+}
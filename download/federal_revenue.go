@@ -3,14 +3,10 @@ package download
 import (
 	"bufio"
 	"fmt"
-	"io"
-	"log/slog"
-	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
 	"slices"
-	"sort"
 	"strings"
 )
 
@@ -32,30 +28,17 @@ var yearMonthPattern = regexp.MustCompile(`href="(\d{4}-\d{2}/)"`)
 var filePattern = regexp.MustCompile(`href="(\w+\d?\.zip)"`)
 var taxFilePattern = regexp.MustCompile(`href="((Imune|Lucro).+\.zip)"`)
 
+// get returns the contents of an index page of the Federal Revenue server,
+// using the index cache when it is enabled (see UseIndexCache).
 func get(url string) (string, error) {
-	c := http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", fmt.Errorf("error creating request %s: %w", url, err)
+	if indexes != nil {
+		return indexes.get(url)
 	}
-	req.Header.Set("User-Agent", userAgent)
-	r, err := c.Do(req)
+	p, err := fetch(url, nil)
 	if err != nil {
-		return "", fmt.Errorf("error getting %s: %w", url, err)
-	}
-	defer func() {
-		if err := r.Body.Close(); err != nil {
-			slog.Warn("could not close http response", "url", url, "error", err)
-		}
-	}()
-	if r.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("%s responded with %s", url, r.Status)
+		return "", err
 	}
-	b, err := io.ReadAll(r.Body)
-	if err != nil {
-		return "", fmt.Errorf("could not read %s response body: %w", url, err)
-	}
-	return string(b), nil
+	return p.Body, nil
 }
 
 func federalRevenueGetMostRecentURL(url string) (string, error) {
@@ -116,22 +99,11 @@ func federalRevenueGetURLs(url string) ([]string, error) {
 	return urls, nil
 }
 
-func saveUpdatedAt(dir string) (err error) { // using named return so we can set it in the defer call
-	u := federalRevenueURL + federalRevenueSourcePath
-	m, err := federalRevenueGetMostRecentURL(u)
+func saveUpdatedAt(dir string, p Provider) (err error) { // using named return so we can set it in the defer call
+	d, err := p.UpdatedAt()
 	if err != nil {
-		return fmt.Errorf("error getting most recent source url: %w", err)
-	}
-	b, err := get(m)
-	if err != nil {
-		return fmt.Errorf("error getting contents of the most recent source: %w", err)
-	}
-	ds := fileTimestampPattern.FindAllString(b, -1)
-	if len(ds) < 1 {
-		return fmt.Errorf("could not find updated at date in %s", u)
+		return err
 	}
-	sort.Strings(ds)
-	d := ds[len(ds)-1]
 	pth := filepath.Join(dir, FederalRevenueUpdatedAt)
 	f, err := os.Create(pth)
 	if err != nil {
@@ -0,0 +1,117 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Types of the Federal Revenue files that can be selected with --only. The
+// lookup tables (CNAEs, cities, countries, etc.) are small and required by
+// the transform, so they are always downloaded.
+const (
+	Companies   = "empresas"
+	Venues      = "estabelecimentos"
+	Partners    = "socios"
+	SimpleTaxes = "simples"
+	TaxRegimes  = "regimes"
+)
+
+// FileTypes lists the types of files that can be selected with --only.
+var FileTypes = []string{Companies, Venues, Partners, SimpleTaxes, TaxRegimes}
+
+// OnlyFile records the types of files selected in the last download, so the
+// transform knows which sources to expect. It does not exist when all the
+// files were downloaded.
+const OnlyFile = "only.txt"
+
+// fileTypePrefixes are the beginnings of the file names of each type.
+var fileTypePrefixes = map[string][]string{
+	Companies:   {"empresas"},
+	Venues:      {"estabelecimentos"},
+	Partners:    {"socios"},
+	SimpleTaxes: {"simples"},
+	TaxRegimes:  {"lucro", "imunes"},
+}
+
+// fileTypeOf returns the type of the file in the URL, or an empty string for
+// the lookup tables.
+func fileTypeOf(u string) string {
+	n := path.Base(u)
+	if v, err := url.PathUnescape(n); err == nil {
+		n = v
+	}
+	n = strings.ToLower(n)
+	for _, t := range FileTypes {
+		for _, p := range fileTypePrefixes[t] {
+			if strings.HasPrefix(n, p) {
+				return t
+			}
+		}
+	}
+	return ""
+}
+
+// ValidateFileTypes checks the types of files given to --only.
+func ValidateFileTypes(only []string) error {
+	for _, t := range only {
+		if !slices.Contains(FileTypes, t) {
+			return fmt.Errorf("unknown file type %s, options are: %s", t, strings.Join(FileTypes, ", "))
+		}
+	}
+	return nil
+}
+
+// filterFileTypes keeps the lookup tables and the URLs of the types in only.
+// An empty only keeps all the URLs.
+func filterFileTypes(urls []string, only []string) []string {
+	if len(only) == 0 {
+		return urls
+	}
+	var out []string
+	for _, u := range urls {
+		if t := fileTypeOf(u); t == "" || slices.Contains(only, t) {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+// saveOnly records the types of files selected, or removes the record if all
+// the files were downloaded.
+func saveOnly(dir string, only []string) error {
+	pth := filepath.Join(dir, OnlyFile)
+	if len(only) == 0 {
+		if err := os.Remove(pth); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("could not remove %s: %w", pth, err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(pth, []byte(strings.Join(only, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("could not write %s: %w", pth, err)
+	}
+	return nil
+}
+
+// LoadOnly reads the types of files selected in the last download in dir. It
+// returns nil if all the files were downloaded.
+func LoadOnly(dir string) ([]string, error) {
+	pth := filepath.Join(dir, OnlyFile)
+	b, err := os.ReadFile(pth)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", pth, err)
+	}
+	only := strings.Fields(string(b))
+	if err := ValidateFileTypes(only); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", pth, err)
+	}
+	return only, nil
+}
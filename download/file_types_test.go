@@ -0,0 +1,53 @@
+package download
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFilterFileTypes(t *testing.T) {
+	urls := []string{
+		"https://example.com/Cnaes.zip",
+		"https://example.com/Empresas0.zip",
+		"https://example.com/Estabelecimentos0.zip",
+		"https://example.com/Socios0.zip",
+		"https://example.com/Simples.zip",
+		"https://example.com/Imunes%20e%20Isentas.zip",
+		"https://example.com/Lucro Real.zip",
+	}
+	for _, tc := range []struct {
+		only     []string
+		expected []string
+	}{
+		{nil, urls},
+		{[]string{Companies, Venues}, []string{urls[0], urls[1], urls[2]}},
+		{[]string{TaxRegimes}, []string{urls[0], urls[5], urls[6]}},
+	} {
+		if got := filterFileTypes(urls, tc.only); !slices.Equal(got, tc.expected) {
+			t.Errorf("expected %v for %v, got %v", tc.expected, tc.only, got)
+		}
+	}
+}
+
+func TestOnlyFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := saveOnly(dir, []string{Venues, Partners}); err != nil {
+		t.Fatalf("expected no error saving, got %s", err)
+	}
+	got, err := LoadOnly(dir)
+	if err != nil {
+		t.Errorf("expected no error loading, got %s", err)
+	}
+	if !slices.Equal(got, []string{Venues, Partners}) {
+		t.Errorf("expected %v, got %v", []string{Venues, Partners}, got)
+	}
+	if err := saveOnly(dir, nil); err != nil {
+		t.Fatalf("expected no error removing, got %s", err)
+	}
+	if got, err := LoadOnly(dir); err != nil || got != nil {
+		t.Errorf("expected nil after a full download, got %v (%v)", got, err)
+	}
+	if err := ValidateFileTypes([]string{"filiais"}); err == nil {
+		t.Error("expected an error for an unknown file type, got nil")
+	}
+}
@@ -0,0 +1,183 @@
+package download
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/avast/retry-go/v4"
+	"github.com/cuducos/minha-receita/warnings"
+)
+
+const (
+	// DefaultIndexCacheTTL is how long an index page of the Federal Revenue
+	// server is used without asking the server if it has changed.
+	DefaultIndexCacheTTL = 1 * time.Hour
+
+	indexRetries    = 4
+	indexRetryDelay = 500 * time.Millisecond
+)
+
+// indexes is the cache used by get, nil when the cache is disabled.
+var indexes *indexCache
+
+// UseIndexCache keeps the index pages listing the Federal Revenue files in
+// dir for ttl, so listing the files again (the urls command, checks for new
+// releases, trying mirrors) does not hit the fragile upstream server every
+// time. After the ttl, the page is requested again with a conditional GET. A
+// ttl of zero disables the cache.
+func UseIndexCache(dir string, ttl time.Duration) {
+	if ttl <= 0 {
+		indexes = nil
+		return
+	}
+	indexes = &indexCache{dir: dir, ttl: ttl, now: time.Now}
+}
+
+// page is the body of an index page and its validators.
+type page struct {
+	Body         string    `json:"body"`
+	ETag         string    `json:"etag"`
+	LastModified string    `json:"last_modified"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+// fetch requests an index page, retrying on network errors and server errors.
+// If cached is not nil, the request is conditional and a not modified response
+// returns the cached page.
+func fetch(url string, cached *page) (page, error) {
+	var p page
+	err := retry.Do(
+		func() error {
+			c := budget.wrap(resilient(&http.Client{}))
+			req, err := http.NewRequest("GET", url, nil)
+			if err != nil {
+				return retry.Unrecoverable(fmt.Errorf("error creating request %s: %w", url, err))
+			}
+			req.Header.Set("User-Agent", userAgent)
+			if cached != nil {
+				if cached.ETag != "" {
+					req.Header.Set("If-None-Match", cached.ETag)
+				}
+				if cached.LastModified != "" {
+					req.Header.Set("If-Modified-Since", cached.LastModified)
+				}
+			}
+			r, err := c.Do(req)
+			if err != nil {
+				return fmt.Errorf("error getting %s: %w", url, err)
+			}
+			defer func() {
+				if err := r.Body.Close(); err != nil {
+					slog.Warn("could not close http response", "url", url, "error", err)
+				}
+			}()
+			if r.StatusCode == http.StatusNotModified && cached != nil {
+				p = *cached
+				return nil
+			}
+			if r.StatusCode != http.StatusOK {
+				err := fmt.Errorf("%s responded with %s", url, r.Status)
+				if r.StatusCode < http.StatusInternalServerError && r.StatusCode != http.StatusTooManyRequests {
+					return retry.Unrecoverable(err)
+				}
+				return err
+			}
+			b, err := io.ReadAll(r.Body)
+			if err != nil {
+				return fmt.Errorf("could not read %s response body: %w", url, err)
+			}
+			p = page{Body: string(b), ETag: r.Header.Get("ETag"), LastModified: r.Header.Get("Last-Modified")}
+			return nil
+		},
+		retry.Attempts(indexRetries),
+		retry.Delay(indexRetryDelay),
+		retry.LastErrorOnly(true),
+		retry.OnRetry(func(_ uint, _ error) {
+			warnings.Add(warnings.Download, "index page request retried", url)
+		}),
+	)
+	return p, err
+}
+
+// indexCache keeps one JSON file per index page URL.
+type indexCache struct {
+	dir string
+	ttl time.Duration
+	now func() time.Time
+}
+
+func (c *indexCache) path(url string) string {
+	h := sha256.Sum256([]byte(url))
+	return filepath.Join(c.dir, hex.EncodeToString(h[:])+".json")
+}
+
+func (c *indexCache) load(url string) (*page, error) {
+	b, err := os.ReadFile(c.path(url))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read cached index page of %s: %w", url, err)
+	}
+	var p page
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("could not parse cached index page of %s: %w", url, err)
+	}
+	return &p, nil
+}
+
+func (c *indexCache) save(url string, p page) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return fmt.Errorf("could not create index cache directory %s: %w", c.dir, err)
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("could not serialize index page of %s: %w", url, err)
+	}
+	tmp := c.path(url) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("could not write cached index page of %s: %w", url, err)
+	}
+	return os.Rename(tmp, c.path(url))
+}
+
+// get returns the cached page while it is younger than the ttl, otherwise it
+// revalidates it with the server. If the server fails, a stale page is better
+// than no page at all.
+func (c *indexCache) get(url string) (string, error) {
+	cached, err := c.load(url)
+	if err != nil {
+		slog.Warn("ignoring the index cache", "url", url, "error", err)
+	}
+	if cached != nil {
+		age := c.now().Sub(cached.FetchedAt)
+		if age < c.ttl {
+			slog.Info("Using cached index page", "url", url, "age", age.Round(time.Second))
+			return cached.Body, nil
+		}
+	}
+	p, err := fetch(url, cached)
+	if err != nil {
+		if cached == nil {
+			return "", err
+		}
+		age := c.now().Sub(cached.FetchedAt)
+		slog.Warn("could not refresh index page, using the cached one", "url", url, "age", age.Round(time.Second), "error", err)
+		warnings.Add(warnings.Download, "stale cached index page used", url)
+		return cached.Body, nil
+	}
+	p.FetchedAt = c.now()
+	if err := c.save(url, p); err != nil {
+		slog.Warn("could not cache index page", "url", url, "error", err)
+	}
+	return p.Body, nil
+}
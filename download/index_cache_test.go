@@ -0,0 +1,108 @@
+package download
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIndexCache(t *testing.T) {
+	var reqs, conditional atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqs.Add(1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("index"))
+	}))
+	defer ts.Close()
+
+	now := time.Now()
+	c := indexCache{dir: t.TempDir(), ttl: time.Hour, now: func() time.Time { return now }}
+	for _, tc := range []struct {
+		name        string
+		after       time.Duration
+		reqs        int32
+		conditional int32
+	}{
+		{"first request hits the server", 0, 1, 0},
+		{"fresh cache does not hit the server", 30 * time.Minute, 1, 0},
+		{"stale cache sends a conditional request", 2 * time.Hour, 2, 1},
+		{"revalidated cache is fresh again", 30 * time.Minute, 2, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			now = now.Add(tc.after)
+			got, err := c.get(ts.URL)
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if got != "index" {
+				t.Errorf("expected index, got %s", got)
+			}
+			if n := reqs.Load(); n != tc.reqs {
+				t.Errorf("expected %d requests, got %d", tc.reqs, n)
+			}
+			if n := conditional.Load(); n != tc.conditional {
+				t.Errorf("expected %d conditional requests, got %d", tc.conditional, n)
+			}
+		})
+	}
+}
+
+func TestIndexCacheServerFailure(t *testing.T) {
+	var failing atomic.Bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("index"))
+	}))
+	defer ts.Close()
+
+	now := time.Now()
+	c := indexCache{dir: t.TempDir(), ttl: time.Hour, now: func() time.Time { return now }}
+	if _, err := c.get(ts.URL); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	failing.Store(true)
+	now = now.Add(2 * time.Hour)
+	got, err := c.get(ts.URL)
+	if err != nil {
+		t.Errorf("expected the stale page to be used, got %s", err)
+	}
+	if got != "index" {
+		t.Errorf("expected index, got %s", got)
+	}
+	if _, err := c.get(ts.URL + "/other"); err == nil {
+		t.Error("expected an error for a page that is not cached, got nil")
+	}
+}
+
+func TestFetchRetries(t *testing.T) {
+	var reqs atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if reqs.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("index"))
+	}))
+	defer ts.Close()
+
+	p, err := fetch(ts.URL, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if p.Body != "index" {
+		t.Errorf("expected index, got %s", p.Body)
+	}
+	if n := reqs.Load(); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+}
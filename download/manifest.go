@@ -0,0 +1,51 @@
+package download
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// manifest is a static list of the files, kept in a JSON file (local or
+// remote) such as:
+//
+//	{"updated_at": "2024-08-17", "urls": ["https://…/Empresas0.zip", …]}
+type manifest struct {
+	Date  string   `json:"updated_at"`
+	Files []string `json:"urls"`
+}
+
+func newManifest(location string, _ []string) (Provider, error) {
+	if location == "" {
+		return nil, fmt.Errorf("the %s url provider requires the path or url of the manifest file", ManifestProvider)
+	}
+	var b []byte
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		p, err := fetch(location, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error getting manifest %s: %w", location, err)
+		}
+		b = []byte(p.Body)
+	} else {
+		var err error
+		b, err = os.ReadFile(location)
+		if err != nil {
+			return nil, fmt.Errorf("error reading manifest %s: %w", location, err)
+		}
+	}
+	var m manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("error parsing manifest %s: %w", location, err)
+	}
+	if !fileTimestampPattern.MatchString(m.Date) || len(m.Date) != 10 {
+		return nil, fmt.Errorf("invalid updated_at in manifest %s, expected YYYY-MM-DD, got %q", location, m.Date)
+	}
+	if len(m.Files) == 0 {
+		return nil, fmt.Errorf("no urls in manifest %s", location)
+	}
+	return &m, nil
+}
+
+func (m *manifest) URLs() ([]string, error)    { return m.Files, nil }
+func (m *manifest) UpdatedAt() (string, error) { return m.Date, nil }
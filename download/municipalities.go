@@ -0,0 +1,28 @@
+package download
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// MunicipalitiesURL is the IBGE API with the geometries of all the
+// municipalities as a GeoJSON FeatureCollection.
+const MunicipalitiesURL = "https://servicodados.ibge.gov.br/api/v3/malhas/paises/BR?formato=application/vnd.geo+json&qualidade=intermediaria&intrarregiao=municipio"
+
+// Municipalities reads the GeoJSON with the geometries of the municipalities
+// from a local file or a URL (such as MunicipalitiesURL).
+func Municipalities(location string) ([]byte, error) {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		p, err := fetch(location, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error getting municipalities %s: %w", location, err)
+		}
+		return []byte(p.Body), nil
+	}
+	b, err := os.ReadFile(location)
+	if err != nil {
+		return nil, fmt.Errorf("error reading municipalities %s: %w", location, err)
+	}
+	return b, nil
+}
@@ -30,7 +30,7 @@ type ckanPkg struct {
 
 func ckanGetURLS(baseURL, pkgID string) ([]string, error) {
 	url := strings.Join([]string{baseURL, ckanPkgPath, pkgID}, "")
-	r, err := http.Get(url)
+	r, err := resilient(&http.Client{}).Get(url)
 	if err != nil {
 		return nil, fmt.Errorf("error getting %s: %w", url, err)
 	}
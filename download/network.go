@@ -0,0 +1,282 @@
+package download
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const autoNetwork = "auto"
+
+var (
+	ipVersions  = []string{autoNetwork, "ipv4", "ipv6"}
+	tlsVersions = []string{autoNetwork, "tls1.2", "tls1.3"}
+)
+
+// Network is a way of connecting to a server: the IP version (auto, ipv4 or
+// ipv6) and the TLS version (auto, tls1.2 or tls1.3). With auto, Go decides:
+// it tries IPv6 and IPv4 in parallel (Happy Eyeballs) and negotiates the most
+// recent TLS version the server supports.
+type Network struct {
+	IP  string
+	TLS string
+}
+
+// AutoNetwork lets Go decide both the IP and the TLS versions.
+var AutoNetwork = Network{autoNetwork, autoNetwork}
+
+func (n Network) String() string {
+	if n == AutoNetwork {
+		return autoNetwork
+	}
+	return n.IP + "/" + n.TLS
+}
+
+// ParseNetwork parses a network such as ipv4/tls1.2. Any part can be auto, and
+// the TLS version can be omitted (e.g. ipv4 is the same as ipv4/auto).
+func ParseNetwork(s string) (Network, error) {
+	ip, t, _ := strings.Cut(strings.ToLower(strings.TrimSpace(s)), "/")
+	if t == "" {
+		t = autoNetwork
+	}
+	if !slices.Contains(ipVersions, ip) || !slices.Contains(tlsVersions, t) {
+		return Network{}, fmt.Errorf("invalid network %s, expected ip/tls with ip as %s and tls as %s", s, strings.Join(ipVersions, ", "), strings.Join(tlsVersions, ", "))
+	}
+	return Network{ip, t}, nil
+}
+
+// ParseHostNetworks parses networks for specific hosts, such as
+// arquivos.receitafederal.gov.br=ipv4/tls1.2.
+func ParseHostNetworks(vs []string) (map[string]Network, error) {
+	hs := make(map[string]Network, len(vs))
+	for _, v := range vs {
+		h, s, ok := strings.Cut(v, "=")
+		if !ok || h == "" {
+			return nil, fmt.Errorf("invalid host network %s, expected host=network", v)
+		}
+		n, err := ParseNetwork(s)
+		if err != nil {
+			return nil, err
+		}
+		hs[strings.ToLower(h)] = n
+	}
+	return hs, nil
+}
+
+// fallbacks lists the networks to try, in order: the network itself and, then,
+// each explicit IP version in place of auto, all of them again with TLS 1.2 in
+// place of auto (servers with broken TLS 1.3 handshakes).
+func (n Network) fallbacks() []Network {
+	ips := []string{n.IP}
+	if n.IP == autoNetwork {
+		ips = append(ips, "ipv4", "ipv6")
+	}
+	ts := []string{n.TLS}
+	if n.TLS == autoNetwork {
+		ts = append(ts, "tls1.2")
+	}
+	var ns []Network
+	for _, t := range ts {
+		for _, ip := range ips {
+			ns = append(ns, Network{ip, t})
+		}
+	}
+	return ns
+}
+
+// transport clones base to connect using this network.
+func (n Network) transport(base *http.Transport) *http.Transport {
+	t := base.Clone()
+	if n.IP != autoNetwork {
+		d := net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		p := "tcp4"
+		if n.IP == "ipv6" {
+			p = "tcp6"
+		}
+		t.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return d.DialContext(ctx, p, addr)
+		}
+	}
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	switch n.TLS {
+	case "tls1.2":
+		t.TLSClientConfig.MinVersion = tls.VersionTLS12
+		t.TLSClientConfig.MaxVersion = tls.VersionTLS12
+	case "tls1.3":
+		t.TLSClientConfig.MinVersion = tls.VersionTLS13
+	}
+	return t
+}
+
+// networks is how the HTTP clients connect to each host (see UseNetwork).
+type networks struct {
+	mu       sync.Mutex
+	fallback Network
+	hosts    map[string]Network
+	working  map[string]Network
+}
+
+func (ns *networks) candidates(host string) []Network {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	n, ok := ns.hosts[host]
+	if !ok {
+		n = ns.fallback
+	}
+	c := n.fallbacks()
+	if w, ok := ns.working[host]; ok {
+		c = slices.DeleteFunc(c, func(n Network) bool { return n == w })
+		c = append([]Network{w}, c...)
+	}
+	return c
+}
+
+func (ns *networks) worked(host string, n Network) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if ns.working[host] == n {
+		return
+	}
+	slog.Debug("Connected to server", "host", host, "network", n)
+	ns.working[host] = n
+}
+
+var network = &networks{fallback: AutoNetwork, working: make(map[string]Network)}
+
+// UseNetwork sets how the HTTP clients connect to the servers: using n, except
+// for the hosts with their own network in hosts. Requests failing before
+// getting a response (e.g. broken IPv6 routes or TLS handshakes) are tried
+// again with the other IP and TLS versions in place of the auto parts, and the
+// one that worked is tried first in the next requests to the same host.
+func UseNetwork(n Network, hosts map[string]Network) {
+	network.mu.Lock()
+	defer network.mu.Unlock()
+	network.fallback = n
+	network.hosts = hosts
+	network.working = make(map[string]Network)
+}
+
+// fallbackTransport sends each request using the networks of its host, in
+// order, until one of them gets a response.
+type fallbackTransport struct {
+	mu         sync.Mutex
+	base       *http.Transport
+	transports map[Network]*http.Transport
+}
+
+func (t *fallbackTransport) transport(n Network) *http.Transport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if r, ok := t.transports[n]; ok {
+		return r
+	}
+	r := n.transport(t.base)
+	t.transports[n] = r
+	return r
+}
+
+func (t *fallbackTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	h := strings.ToLower(r.URL.Hostname())
+	var err error
+	for _, n := range network.candidates(h) {
+		var resp *http.Response
+		resp, err = t.transport(n).RoundTrip(r)
+		if err == nil {
+			network.worked(h, n)
+			return resp, nil
+		}
+		if r.Context().Err() != nil || (r.Body != nil && r.Body != http.NoBody) {
+			return nil, err
+		}
+		slog.Debug("Could not connect to server, trying another network", "host", h, "network", n, "error", err)
+	}
+	return nil, err
+}
+
+var defaultTransport = sync.OnceValue(func() http.RoundTripper {
+	return newFallbackTransport(http.DefaultTransport.(*http.Transport))
+})
+
+func newFallbackTransport(base *http.Transport) *fallbackTransport {
+	return &fallbackTransport{base: base, transports: make(map[Network]*http.Transport)}
+}
+
+// resilient returns a copy of the client that falls back to other networks
+// (see UseNetwork) when it cannot connect to a server.
+func resilient(c *http.Client) *http.Client {
+	w := *c
+	switch t := c.Transport.(type) {
+	case nil:
+		w.Transport = defaultTransport()
+	case *http.Transport:
+		w.Transport = newFallbackTransport(t)
+	default:
+		return c
+	}
+	return &w
+}
+
+// DiagnosticURLs are the servers the download command connects to.
+var DiagnosticURLs = []string{federalRevenueURL, nationalTreasureBaseURL}
+
+// Diagnosis is the result of requesting a URL using a network.
+type Diagnosis struct {
+	URL      string
+	Network  Network
+	Status   string
+	Duration time.Duration
+	Error    error
+}
+
+// Diagnose requests each URL with each combination of IP and TLS versions,
+// without fallbacks, so users can tell which ones work from their network.
+func Diagnose(urls []string, timeout time.Duration) []Diagnosis {
+	ns := []Network{AutoNetwork}
+	for _, ip := range ipVersions[1:] {
+		for _, t := range tlsVersions[1:] {
+			ns = append(ns, Network{ip, t})
+		}
+	}
+	ds := make([]Diagnosis, 0, len(urls)*len(ns))
+	for _, u := range urls {
+		for _, n := range ns {
+			ds = append(ds, Diagnosis{URL: u, Network: n})
+		}
+	}
+	base := http.DefaultTransport.(*http.Transport)
+	var wg sync.WaitGroup
+	for i := range ds {
+		wg.Go(func() {
+			d := &ds[i]
+			c := http.Client{Timeout: timeout, Transport: d.Network.transport(base)}
+			req, err := http.NewRequest(http.MethodGet, d.URL, nil)
+			if err != nil {
+				d.Error = fmt.Errorf("error creating request %s: %w", d.URL, err)
+				return
+			}
+			req.Header.Set("User-Agent", userAgent)
+			s := time.Now()
+			r, err := c.Do(req)
+			d.Duration = time.Since(s)
+			if err != nil {
+				d.Error = err
+				return
+			}
+			d.Status = r.Status
+			if err := r.Body.Close(); err != nil {
+				slog.Warn("could not close http response", "url", d.URL, "error", err)
+			}
+		})
+	}
+	wg.Wait()
+	return ds
+}
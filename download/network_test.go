@@ -0,0 +1,97 @@
+package download
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestParseNetwork(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		expected Network
+		err      bool
+	}{
+		{"auto", AutoNetwork, false},
+		{"ipv4", Network{"ipv4", "auto"}, false},
+		{"IPv6/tls1.2", Network{"ipv6", "tls1.2"}, false},
+		{"auto/tls1.3", Network{"auto", "tls1.3"}, false},
+		{"ipv5", Network{}, true},
+		{"ipv4/ssl3", Network{}, true},
+	} {
+		got, err := ParseNetwork(tc.value)
+		if tc.err && err == nil {
+			t.Errorf("expected error parsing %s, got nil", tc.value)
+		}
+		if !tc.err && err != nil {
+			t.Errorf("expected no error parsing %s, got %s", tc.value, err)
+		}
+		if got != tc.expected {
+			t.Errorf("expected %s to be %v, got %v", tc.value, tc.expected, got)
+		}
+	}
+}
+
+func TestParseHostNetworks(t *testing.T) {
+	got, err := ParseHostNetworks([]string{"Example.com=ipv4", "example.org=ipv6/tls1.2"})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if got["example.com"] != (Network{"ipv4", "auto"}) || got["example.org"] != (Network{"ipv6", "tls1.2"}) {
+		t.Errorf("unexpected host networks %v", got)
+	}
+	for _, v := range []string{"example.com", "=ipv4", "example.com=ipv5"} {
+		if _, err := ParseHostNetworks([]string{v}); err == nil {
+			t.Errorf("expected error parsing %s, got nil", v)
+		}
+	}
+}
+
+func TestNetworkFallbacks(t *testing.T) {
+	for _, tc := range []struct {
+		network  Network
+		expected []Network
+	}{
+		{
+			AutoNetwork,
+			[]Network{AutoNetwork, {"ipv4", "auto"}, {"ipv6", "auto"}, {"auto", "tls1.2"}, {"ipv4", "tls1.2"}, {"ipv6", "tls1.2"}},
+		},
+		{Network{"ipv4", "auto"}, []Network{{"ipv4", "auto"}, {"ipv4", "tls1.2"}}},
+		{Network{"ipv6", "tls1.3"}, []Network{{"ipv6", "tls1.3"}}},
+	} {
+		if got := tc.network.fallbacks(); !slices.Equal(got, tc.expected) {
+			t.Errorf("expected fallbacks of %s to be %v, got %v", tc.network, tc.expected, got)
+		}
+	}
+}
+
+func TestFallbackTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("expected no error parsing the test server url, got %s", err)
+	}
+	h := u.Hostname()
+	defer UseNetwork(AutoNetwork, nil)
+
+	UseNetwork(AutoNetwork, map[string]Network{h: {"ipv6", "auto"}})
+	if _, err := resilient(&http.Client{}).Get(ts.URL); err == nil {
+		t.Error("expected error connecting to an ipv4 server with ipv6, got nil")
+	}
+
+	UseNetwork(AutoNetwork, nil)
+	network.working[h] = Network{"ipv6", "auto"}
+	r, err := resilient(&http.Client{}).Get(ts.URL)
+	if err != nil {
+		t.Fatalf("expected no error falling back to another network, got %s", err)
+	}
+	r.Body.Close()
+	if got := network.working[h]; got != AutoNetwork {
+		t.Errorf("expected %s to be the working network, got %s", AutoNetwork, got)
+	}
+}
@@ -0,0 +1,129 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Names of the URL providers.
+const (
+	IndexProvider    = "index"
+	ManifestProvider = "manifest"
+	S3Provider       = "s3"
+)
+
+// Provider discovers the URLs of the Federal Revenue files, keeping where the
+// files are listed apart from how they are downloaded.
+type Provider interface {
+	// URLs lists the ZIP files to be downloaded.
+	URLs() ([]string, error)
+
+	// UpdatedAt is the date the data was extracted by the Federal Revenue, in
+	// the YYYY-MM-DD format.
+	UpdatedAt() (string, error)
+}
+
+// providers creates a provider from the location given by the user, which
+// meaning depends on the provider (e.g. a base URL, a file path, a bucket).
+var providers = map[string]func(location string, mirrors []string) (Provider, error){
+	IndexProvider:    newFederalRevenueIndex,
+	ManifestProvider: newManifest,
+	S3Provider:       newS3Listing,
+}
+
+// Providers lists the names of the available URL providers.
+func Providers() []string {
+	var ps []string
+	for p := range providers {
+		ps = append(ps, p)
+	}
+	slices.Sort(ps)
+	return ps
+}
+
+// NewProvider creates the URL provider by its name. Mirrors are used only by
+// the providers that read from the Federal Revenue server.
+func NewProvider(name, location string, mirrors []string) (Provider, error) {
+	fn, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown url provider %s, options are: %s", name, strings.Join(Providers(), ", "))
+	}
+	return fn(location, mirrors)
+}
+
+// federalRevenueIndex scrapes the index pages of the Federal Revenue server,
+// using the mirrors (in order) if the official server fails.
+type federalRevenueIndex struct {
+	url     string
+	mirrors []string
+}
+
+func newFederalRevenueIndex(location string, mirrors []string) (Provider, error) {
+	if location == "" {
+		location = federalRevenueURL
+	}
+	if !strings.HasSuffix(location, "/") {
+		location += "/"
+	}
+	return &federalRevenueIndex{location, mirrors}, nil
+}
+
+// try calls fn with the base URL of the official server and, if it fails,
+// with the equivalent URL of each mirror.
+func (f *federalRevenueIndex) try(fn func(string) error) error {
+	err := fn(f.url)
+	if err == nil {
+		return nil
+	}
+	errs := []error{err}
+	for _, m := range f.mirrors {
+		slog.Warn("could not list files, trying mirror", "mirror", m, "error", err)
+		var u string
+		u, err = mirrorURL(f.url, m)
+		if err != nil {
+			return err
+		}
+		err = fn(u)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (f *federalRevenueIndex) URLs() ([]string, error) {
+	var urls []string
+	err := f.try(func(u string) error {
+		var err error
+		urls, err = federalRevenueGetURLs(u)
+		return err
+	})
+	return urls, err
+}
+
+func (f *federalRevenueIndex) UpdatedAt() (string, error) {
+	var d string
+	err := f.try(func(u string) error {
+		m, err := federalRevenueGetMostRecentURL(u + federalRevenueSourcePath)
+		if err != nil {
+			return fmt.Errorf("error getting most recent source url: %w", err)
+		}
+		b, err := get(m)
+		if err != nil {
+			return fmt.Errorf("error getting contents of the most recent source: %w", err)
+		}
+		ds := fileTimestampPattern.FindAllString(b, -1)
+		if len(ds) < 1 {
+			return fmt.Errorf("could not find updated at date in %s", m)
+		}
+		sort.Strings(ds)
+		d = ds[len(ds)-1]
+		return nil
+	})
+	return d, err
+}
@@ -0,0 +1,118 @@
+package download
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestNewProvider(t *testing.T) {
+	if _, err := NewProvider("ftp", "", nil); err == nil {
+		t.Error("expected error for an unknown provider, got nil")
+	}
+	for _, tc := range []struct {
+		name     string
+		location string
+	}{
+		{ManifestProvider, ""},
+		{ManifestProvider, filepath.Join(t.TempDir(), "missing.json")},
+		{S3Provider, ""},
+		{S3Provider, "https://example.com/bucket"},
+	} {
+		if _, err := NewProvider(tc.name, tc.location, nil); err == nil {
+			t.Errorf("expected error for %s provider with location %q, got nil", tc.name, tc.location)
+		}
+	}
+}
+
+func TestFederalRevenueIndexProvider(t *testing.T) {
+	ts := httpTestServer(t, []string{"dados_abertos_cnpj.html", "2024-08.html", "regime_tributario.html"})
+	defer ts.Close()
+	p, err := NewProvider(IndexProvider, ts.URL, nil)
+	if err != nil {
+		t.Fatalf("expected no error creating the provider, got %s", err)
+	}
+	urls, err := p.URLs()
+	if err != nil {
+		t.Errorf("expected no error listing urls, got %s", err)
+	}
+	if len(urls) != 41 {
+		t.Errorf("expected 41 urls, got %d", len(urls))
+	}
+	d, err := p.UpdatedAt()
+	if err != nil {
+		t.Errorf("expected no error getting the updated at date, got %s", err)
+	}
+	if d != "2024-08-14" {
+		t.Errorf("expected 2024-08-14, got %s", d)
+	}
+}
+
+func TestManifestProvider(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "manifest.json")
+	if err := os.WriteFile(pth, []byte(`{"updated_at": "2024-08-17", "urls": ["https://example.com/Empresas0.zip"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewProvider(ManifestProvider, pth, nil)
+	if err != nil {
+		t.Fatalf("expected no error creating the provider, got %s", err)
+	}
+	urls, err := p.URLs()
+	if err != nil || !slices.Equal(urls, []string{"https://example.com/Empresas0.zip"}) {
+		t.Errorf("expected the manifest urls, got %v (%v)", urls, err)
+	}
+	if d, err := p.UpdatedAt(); err != nil || d != "2024-08-17" {
+		t.Errorf("expected 2024-08-17, got %s (%v)", d, err)
+	}
+
+	if err := os.WriteFile(pth, []byte(`{"updated_at": "17/08/2024", "urls": ["https://example.com/Empresas0.zip"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewProvider(ManifestProvider, pth, nil); err == nil {
+		t.Error("expected error for an invalid date, got nil")
+	}
+}
+
+func TestS3ListingProvider(t *testing.T) {
+	pages := map[string]string{
+		"": `<ListBucketResult>
+			<Contents><Key>receita/2024-07/Empresas0.zip</Key><LastModified>2024-07-20T10:00:00.000Z</LastModified></Contents>
+			<Contents><Key>receita/2024-08/Empresas0.zip</Key><LastModified>2024-08-17T10:00:00.000Z</LastModified></Contents>
+			<IsTruncated>true</IsTruncated>
+			<NextContinuationToken>next</NextContinuationToken>
+		</ListBucketResult>`,
+		"next": `<ListBucketResult>
+			<Contents><Key>receita/2024-08/Empresas1.zip</Key><LastModified>2024-08-18T03:00:00.000Z</LastModified></Contents>
+			<Contents><Key>receita/2024-08/README.txt</Key><LastModified>2024-08-19T03:00:00.000Z</LastModified></Contents>
+			<IsTruncated>false</IsTruncated>
+		</ListBucketResult>`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bucket/" || r.URL.Query().Get("prefix") != "receita" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(pages[r.URL.Query().Get("continuation-token")]))
+	}))
+	defer ts.Close()
+	t.Setenv("AWS_ENDPOINT_URL_S3", ts.URL)
+
+	p, err := NewProvider(S3Provider, "s3://bucket/receita", nil)
+	if err != nil {
+		t.Fatalf("expected no error creating the provider, got %s", err)
+	}
+	urls, err := p.URLs()
+	if err != nil {
+		t.Fatalf("expected no error listing urls, got %s", err)
+	}
+	expected := []string{ts.URL + "/bucket/receita/2024-08/Empresas0.zip", ts.URL + "/bucket/receita/2024-08/Empresas1.zip"}
+	if !slices.Equal(urls, expected) {
+		t.Errorf("expected %v, got %v", expected, urls)
+	}
+	if d, err := p.UpdatedAt(); err != nil || d != "2024-08-18" {
+		t.Errorf("expected 2024-08-18, got %s (%v)", d, err)
+	}
+}
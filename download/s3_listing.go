@@ -0,0 +1,136 @@
+package download
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+var yearMonthDirPattern = regexp.MustCompile(`(^|/)(\d{4}-\d{2})/`)
+
+type s3Object struct {
+	Key          string    `xml:"Key"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+type s3ListBucketResult struct {
+	Contents              []s3Object `xml:"Contents"`
+	IsTruncated           bool       `xml:"IsTruncated"`
+	NextContinuationToken string     `xml:"NextContinuationToken"`
+}
+
+// s3Listing lists the ZIP files in a public S3 compatible bucket, such as a
+// copy of the Federal Revenue files kept by the user. The location is
+// s3://bucket/prefix, the region comes from AWS_REGION and other providers
+// are set with AWS_ENDPOINT_URL_S3 (or AWS_ENDPOINT_URL). If the keys have
+// YYYY-MM directories, only the most recent one is used.
+type s3Listing struct {
+	base    string // URL of the bucket, objects are base + "/" + key
+	prefix  string
+	objects []s3Object
+}
+
+func newS3Listing(location string, _ []string) (Provider, error) {
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("the %s url provider requires a location such as s3://bucket/prefix, got %q", S3Provider, location)
+	}
+	r := os.Getenv("AWS_REGION")
+	if r == "" {
+		r = "us-east-1"
+	}
+	e := os.Getenv("AWS_ENDPOINT_URL_S3")
+	if e == "" {
+		e = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	b := fmt.Sprintf("https://%s.s3.%s.amazonaws.com", u.Host, r)
+	if e != "" { // other providers usually require path-style URLs
+		b = strings.TrimSuffix(e, "/") + "/" + u.Host
+	}
+	return &s3Listing{base: b, prefix: strings.TrimPrefix(u.Path, "/")}, nil
+}
+
+// list reads all the pages of the bucket listing, once.
+func (s *s3Listing) list() ([]s3Object, error) {
+	if s.objects != nil {
+		return s.objects, nil
+	}
+	var objs []s3Object
+	var token string
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {s.prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		u := s.base + "/?" + q.Encode()
+		p, err := fetch(u, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s: %w", u, err)
+		}
+		var r s3ListBucketResult
+		if err := xml.Unmarshal([]byte(p.Body), &r); err != nil {
+			return nil, fmt.Errorf("error parsing bucket listing %s: %w", u, err)
+		}
+		for _, o := range r.Contents {
+			if strings.HasSuffix(strings.ToLower(o.Key), ".zip") {
+				objs = append(objs, o)
+			}
+		}
+		if !r.IsTruncated || r.NextContinuationToken == "" {
+			break
+		}
+		token = r.NextContinuationToken
+	}
+	var ms []string
+	for _, o := range objs {
+		if m := yearMonthDirPattern.FindStringSubmatch(o.Key); m != nil {
+			ms = append(ms, m[2])
+		}
+	}
+	if len(ms) > 0 {
+		last := slices.Max(ms)
+		objs = slices.DeleteFunc(objs, func(o s3Object) bool {
+			m := yearMonthDirPattern.FindStringSubmatch(o.Key)
+			return m == nil || m[2] != last
+		})
+	}
+	if len(objs) == 0 {
+		return nil, fmt.Errorf("no zip files found in %s/%s", s.base, s.prefix)
+	}
+	s.objects = objs
+	return objs, nil
+}
+
+func (s *s3Listing) URLs() ([]string, error) {
+	objs, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]string, len(objs))
+	for i, o := range objs {
+		urls[i] = s.base + (&url.URL{Path: path.Join("/", o.Key)}).EscapedPath()
+	}
+	return urls, nil
+}
+
+// UpdatedAt uses the date of the most recent file in the bucket, since the
+// listing has no other record of when the data was extracted.
+func (s *s3Listing) UpdatedAt() (string, error) {
+	objs, err := s.list()
+	if err != nil {
+		return "", err
+	}
+	var t time.Time
+	for _, o := range objs {
+		if o.LastModified.After(t) {
+			t = o.LastModified
+		}
+	}
+	return t.UTC().Format("2006-01-02"), nil
+}
@@ -0,0 +1,197 @@
+package download
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/schollz/progressbar/v3"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// UnzipDir is the directory, within the data directory, where the
+	// archived files are extracted to, one subdirectory per ZIP file.
+	UnzipDir = "csv"
+
+	// DefaultMaxUnzippedSize is the largest file accepted from within a ZIP
+	// file (the largest CSV from the Federal Revenue has a few GB).
+	DefaultMaxUnzippedSize = int64(16 << 30)
+
+	// DefaultMaxParallelUnzip sets the maximum number of files extracted at
+	// the same time.
+	DefaultMaxParallelUnzip = 4
+
+	// maxCompressionRatio is way above what a CSV compresses to, higher ratios
+	// are likely a zip bomb.
+	maxCompressionRatio = 200
+)
+
+// archivedFile is a file within a ZIP file to be extracted to pth.
+type archivedFile struct {
+	archive string
+	file    *zip.File
+	pth     string
+}
+
+// sanityCheck refuses files that would be written outside the output
+// directory, and files too big or too compressed, based on the ZIP headers.
+func (a archivedFile) sanityCheck(limit int64) error {
+	n := a.file.Name
+	if filepath.IsAbs(n) || strings.Contains(filepath.ToSlash(n), "../") || strings.HasPrefix(n, "..") {
+		return fmt.Errorf("refusing to extract %s from %s: invalid path", n, a.archive)
+	}
+	if a.file.UncompressedSize64 > uint64(limit) {
+		return fmt.Errorf("refusing to extract %s from %s: %d bytes is above the limit of %d bytes", n, a.archive, a.file.UncompressedSize64, limit)
+	}
+	if a.file.CompressedSize64 > 0 && a.file.UncompressedSize64/a.file.CompressedSize64 > maxCompressionRatio {
+		return fmt.Errorf("refusing to extract %s from %s: compression ratio above %d", n, a.archive, maxCompressionRatio)
+	}
+	return nil
+}
+
+// extracted tells whether a previous run already extracted the file, checking
+// its size and its CRC.
+func (a archivedFile) extracted() (ok bool, err error) {
+	s, err := os.Stat(a.pth)
+	if err != nil || uint64(s.Size()) != a.file.UncompressedSize64 {
+		return false, nil
+	}
+	f, err := os.Open(a.pth)
+	if err != nil {
+		return false, fmt.Errorf("could not open %s: %w", a.pth, err)
+	}
+	defer func() {
+		if e := f.Close(); e != nil && err == nil {
+			err = fmt.Errorf("could not close %s: %w", a.pth, e)
+		}
+	}()
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, f); err != nil {
+		return false, fmt.Errorf("could not read %s: %w", a.pth, err)
+	}
+	return h.Sum32() == a.file.CRC32, nil
+}
+
+// extract writes the file to a temporary path, checking its size and its CRC
+// as it goes, and moves it to the final path only if everything is ok.
+func (a archivedFile) extract(limit int64, bar *progressbar.ProgressBar) (err error) { // using named return so we can set it in the defer call
+	ok, err := a.extracted()
+	if err != nil {
+		return err
+	}
+	if ok {
+		_ = bar.Add64(int64(a.file.UncompressedSize64))
+		return nil
+	}
+	r, err := a.file.Open()
+	if err != nil {
+		return fmt.Errorf("error opening %s in %s: %w", a.file.Name, a.archive, err)
+	}
+	defer func() {
+		if e := r.Close(); e != nil && err == nil {
+			err = fmt.Errorf("could not close %s in %s: %w", a.file.Name, a.archive, e)
+		}
+	}()
+	tmp := a.pth + ".tmp"
+	w, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("could not create %s: %w", tmp, err)
+	}
+	defer func() {
+		if e := w.Close(); e != nil && err == nil {
+			err = fmt.Errorf("could not close %s: %w", tmp, e)
+		}
+		if err != nil {
+			if e := os.Remove(tmp); e != nil && !errors.Is(e, os.ErrNotExist) {
+				slog.Warn("could not remove partial extraction", "path", tmp, "error", e)
+			}
+		}
+	}()
+	h := crc32.NewIEEE()
+	n, err := io.Copy(io.MultiWriter(w, h, bar), io.LimitReader(r, limit+1))
+	if err != nil && !errors.Is(err, zip.ErrChecksum) {
+		return fmt.Errorf("error extracting %s from %s: %w", a.file.Name, a.archive, err)
+	}
+	if n > limit {
+		return fmt.Errorf("refusing to extract %s from %s: it is bigger than the limit of %d bytes", a.file.Name, a.archive, limit)
+	}
+	if uint64(n) != a.file.UncompressedSize64 {
+		return fmt.Errorf("error extracting %s from %s: expected %d bytes, got %d", a.file.Name, a.archive, a.file.UncompressedSize64, n)
+	}
+	if h.Sum32() != a.file.CRC32 {
+		return fmt.Errorf("error extracting %s from %s: expected crc32 %08x, got %08x", a.file.Name, a.archive, a.file.CRC32, h.Sum32())
+	}
+	if err := w.Sync(); err != nil {
+		return fmt.Errorf("could not sync %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, a.pth)
+}
+
+// Unzip extracts the ZIP files in dir to the UnzipDir within dir, with up to
+// parallel files extracted at the same time. Each extracted file is limited to
+// limit bytes and has its CRC validated. Failed extractions leave no partial
+// files behind, and files already extracted (with the same size and CRC) are
+// skipped. As files are extracted without their directories, ZIP files with
+// more than one file with the same name are refused.
+func Unzip(dir string, parallel int, limit int64) error {
+	ls, err := filepath.Glob(filepath.Join(dir, "*.zip"))
+	if err != nil {
+		return fmt.Errorf("error listing zip files: %w", err)
+	}
+	if len(ls) == 0 {
+		return fmt.Errorf("no zip files found in %s", dir)
+	}
+	var fs []archivedFile
+	var t int64
+	names := make(map[string]string) // extracted path to the name within the zip
+	for _, pth := range ls {
+		r, err := zip.OpenReader(pth)
+		if err != nil {
+			return fmt.Errorf("error opening %s: %w", pth, err)
+		}
+		defer func() {
+			if err := r.Close(); err != nil {
+				slog.Warn("could not close", "path", pth, "error", err)
+			}
+		}()
+		out := filepath.Join(dir, UnzipDir, strings.TrimSuffix(filepath.Base(pth), filepath.Ext(pth)))
+		if err := os.MkdirAll(out, 0755); err != nil {
+			return fmt.Errorf("could not create %s: %w", out, err)
+		}
+		for _, f := range r.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			a := archivedFile{pth, f, filepath.Join(out, filepath.Base(f.Name))}
+			if err := a.sanityCheck(limit); err != nil {
+				return err
+			}
+			if n, ok := names[a.pth]; ok {
+				return fmt.Errorf("refusing to extract %s from %s: %s has the same name", f.Name, pth, n)
+			}
+			names[a.pth] = f.Name
+			fs = append(fs, a)
+			t += int64(f.UncompressedSize64)
+		}
+	}
+	slog.Info("Extracting files…", "archives", len(ls), "files", len(fs), "directory", filepath.Join(dir, UnzipDir))
+	bar := progressbar.DefaultBytes(t, "Extracting")
+	defer func() {
+		if err := bar.Close(); err != nil {
+			slog.Warn("could not close the progress bar", "error", err)
+		}
+	}()
+	var g errgroup.Group
+	g.SetLimit(parallel)
+	for _, f := range fs {
+		g.Go(func() error { return f.extract(limit, bar) })
+	}
+	return g.Wait()
+}
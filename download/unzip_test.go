@@ -0,0 +1,127 @@
+package download
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+func createZip(t *testing.T, pth string, fs map[string][]byte) {
+	f, err := os.Create(pth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for n, b := range fs {
+		z, err := w.Create(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := z.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnzip(t *testing.T) {
+	dir := t.TempDir()
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "Cnaes.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Cnaes.zip"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 { // second run skips the extracted files
+		if err := Unzip(dir, 2, DefaultMaxUnzippedSize); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+	}
+	ls, err := os.ReadDir(filepath.Join(dir, UnzipDir, "Cnaes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 1 || strings.HasSuffix(ls[0].Name(), ".tmp") {
+		t.Fatalf("expected one extracted file, got %v", ls)
+	}
+
+	pth := filepath.Join(dir, UnzipDir, "Cnaes", ls[0].Name())
+	expected, err := os.ReadFile(pth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pth, bytes.Repeat([]byte{0}, len(expected)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Unzip(dir, 2, DefaultMaxUnzippedSize); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	got, err := os.ReadFile(pth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, expected) {
+		t.Error("expected a corrupted file with the same size to be extracted again")
+	}
+}
+
+func TestUnzipRefuses(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		files map[string][]byte
+		limit int64
+	}{
+		{"file above the size limit", map[string][]byte{"a.csv": []byte("0123456789")}, 5},
+		{"zip bomb", map[string][]byte{"a.csv": bytes.Repeat([]byte{0}, 1<<20)}, DefaultMaxUnzippedSize},
+		{"path outside the output directory", map[string][]byte{"../a.csv": []byte("42")}, DefaultMaxUnzippedSize},
+		{"files with the same name", map[string][]byte{"a/a.csv": []byte("4"), "b/a.csv": []byte("2")}, DefaultMaxUnzippedSize},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			createZip(t, filepath.Join(dir, "Test.zip"), tc.files)
+			if err := Unzip(dir, 1, tc.limit); err == nil {
+				t.Error("expected an error, got nil")
+			}
+			ls, err := os.ReadDir(filepath.Join(dir, UnzipDir, "Test"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ls) != 0 {
+				t.Errorf("expected no files extracted, got %v", ls)
+			}
+		})
+	}
+}
+
+func TestArchivedFileExtractChecksCRC(t *testing.T) {
+	dir := t.TempDir()
+	pth := filepath.Join(dir, "Test.zip")
+	createZip(t, pth, map[string][]byte{"a.csv": []byte("42")})
+	r, err := zip.OpenReader(pth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	f := r.File[0]
+	f.CRC32++
+	a := archivedFile{pth, f, filepath.Join(dir, "a.csv")}
+	if err := a.extract(DefaultMaxUnzippedSize, progressbar.DefaultSilent(-1)); err == nil {
+		t.Error("expected a crc error, got nil")
+	}
+	ls, err := filepath.Glob(filepath.Join(dir, "a.csv*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 0 {
+		t.Errorf("expected no partial files, got %v", ls)
+	}
+}
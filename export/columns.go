@@ -0,0 +1,103 @@
+package export
+
+import (
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/cuducos/minha-receita/transform"
+)
+
+type columnKind int
+
+const (
+	text columnKind = iota
+	integer
+	decimal
+	boolean
+	day
+	nested // arrays and objects are kept as JSON in flat formats
+)
+
+type column struct {
+	name string
+	kind columnKind
+}
+
+func kindOf(t reflect.Type) columnKind {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return text
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return integer
+	case reflect.Float32, reflect.Float64:
+		return decimal
+	case reflect.Bool:
+		return boolean
+	case reflect.Struct:
+		if t.ConvertibleTo(reflect.TypeFor[time.Time]()) {
+			return day
+		}
+	}
+	return nested
+}
+
+// columns lists the top-level fields of the company JSON in the same order as
+// the JSON
+func columns() []column {
+	t := reflect.TypeFor[transform.Company]()
+	cs := make([]column, t.NumField())
+	for i := range t.NumField() {
+		f := t.Field(i)
+		n, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		cs[i] = column{n, kindOf(f.Type)}
+	}
+	return cs
+}
+
+// flatten reads a company JSON into a sequence of raw values, one per column
+// (values not present in the JSON are set as null)
+func flatten(cs []column, doc jsontext.Value) ([]jsontext.Value, error) {
+	var m map[string]jsontext.Value
+	if err := json.Unmarshal(doc, &m); err != nil {
+		return nil, fmt.Errorf("could not parse company json: %w", err)
+	}
+	r := make([]jsontext.Value, len(cs))
+	for i, c := range cs {
+		v, ok := m[c.name]
+		if !ok {
+			v = jsontext.Value("null")
+		}
+		r[i] = v
+	}
+	return r, nil
+}
+
+func isNull(v jsontext.Value) bool { return v.Kind() == 'n' }
+
+// asText converts a raw JSON value into its text representation for flat
+// formats: strings are unquoted, null is empty and everything else is kept as
+// compact JSON
+func asText(v jsontext.Value) (string, error) {
+	switch v.Kind() {
+	case 'n':
+		return "", nil
+	case '"':
+		var s string
+		if err := json.Unmarshal(v, &s); err != nil {
+			return "", fmt.Errorf("could not parse %s as string: %w", string(v), err)
+		}
+		return s, nil
+	}
+	c := v.Clone()
+	if err := c.Compact(); err != nil {
+		return "", fmt.Errorf("could not compact %s: %w", string(v), err)
+	}
+	return string(c), nil
+}
@@ -0,0 +1,207 @@
+// Package export dumps the companies from the database to files, allowing
+// users to work with the transformed dataset without the web API.
+package export
+
+import (
+	"context"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/cuducos/minha-receita/db"
+	"github.com/schollz/progressbar/v3"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// DefaultPageSize is the number of companies read from the database in each
+	// query
+	DefaultPageSize = 4096
+
+	// DefaultWorkers is the number of workers encoding pages in parallel
+	DefaultWorkers = 8
+)
+
+type database interface {
+	Search(context.Context, *db.Query) (string, error)
+}
+
+type page struct {
+	Data   []jsontext.Value `json:"data"`
+	Cursor *string          `json:"cursor"`
+}
+
+type chunk[T any] struct {
+	seq  int
+	size int
+	data T
+}
+
+// reads the pages sequentially using the cursor (keyset pagination), since
+// each page depends on the last cursor of the previous one
+func readPages(ctx context.Context, d database, q *db.Query, ch chan<- chunk[[]jsontext.Value]) error {
+	defer close(ch)
+	for seq := 0; ; seq++ {
+		s, err := d.Search(ctx, q)
+		if err != nil {
+			return fmt.Errorf("error reading page %d from the database: %w", seq+1, err)
+		}
+		var p page
+		if err := json.Unmarshal([]byte(s), &p); err != nil {
+			return fmt.Errorf("error parsing page %d from the database: %w", seq+1, err)
+		}
+		if len(p.Data) > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case ch <- chunk[[]jsontext.Value]{seq, len(p.Data), p.Data}:
+			}
+		}
+		if p.Cursor == nil {
+			return nil
+		}
+		q.Cursor = p.Cursor
+	}
+}
+
+func run[T any](d database, q *db.Query, e encoder[T], workers int, bar *progressbar.ProgressBar) error {
+	g, ctx := errgroup.WithContext(context.Background())
+	pages := make(chan chunk[[]jsontext.Value], workers)
+	encoded := make(chan chunk[T], workers)
+	g.Go(func() error { return readPages(ctx, d, q, pages) })
+	var encoders errgroup.Group
+	for range workers {
+		encoders.Go(func() error {
+			for p := range pages {
+				b, err := e.encode(p.data)
+				if err != nil {
+					return fmt.Errorf("error encoding page %d: %w", p.seq+1, err)
+				}
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case encoded <- chunk[T]{p.seq, p.size, b}:
+				}
+			}
+			return nil
+		})
+	}
+	g.Go(func() error {
+		defer close(encoded)
+		return encoders.Wait()
+	})
+	g.Go(func() error { // writes the chunks in the same order they were read
+		next := 0
+		buf := make(map[int]chunk[T])
+		for c := range encoded {
+			buf[c.seq] = c
+			for {
+				c, ok := buf[next]
+				if !ok {
+					break
+				}
+				if err := e.write(c.data); err != nil {
+					return fmt.Errorf("error writing page %d: %w", c.seq+1, err)
+				}
+				if err := bar.Add(c.size); err != nil {
+					slog.Warn("could not update the progress bar", "error", err)
+				}
+				delete(buf, next)
+				next++
+			}
+		}
+		return nil
+	})
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	return e.close()
+}
+
+func export(d database, q *db.Query, w io.Writer, f Format, workers int, bar *progressbar.ProgressBar) error {
+	switch f {
+	case NDJSON:
+		return run(d, q, &ndjsonEncoder{w}, workers, bar)
+	case CSV:
+		e, err := newCSVEncoder(w)
+		if err != nil {
+			return err
+		}
+		return run(d, q, e, workers, bar)
+	case Parquet:
+		return run(d, q, newParquetEncoder(w), workers, bar)
+	case XLSX:
+		e, err := newXLSXEncoder(w)
+		if err != nil {
+			return err
+		}
+		return run(d, q, e, workers, bar)
+	}
+	return fmt.Errorf("unknown export format %s", f)
+}
+
+func writeAll[T any](e encoder[T], docs []jsontext.Value) error {
+	b, err := e.encode(docs)
+	if err != nil {
+		return err
+	}
+	if err := e.write(b); err != nil {
+		return err
+	}
+	return e.close()
+}
+
+// WritePage writes a single page of company JSONs (e.g. a page of the
+// paginated search) as a file in the format f.
+func WritePage(w io.Writer, f Format, docs []jsontext.Value) error {
+	switch f {
+	case NDJSON:
+		return writeAll(&ndjsonEncoder{w}, docs)
+	case CSV:
+		e, err := newCSVEncoder(w)
+		if err != nil {
+			return err
+		}
+		return writeAll(e, docs)
+	case Parquet:
+		return writeAll(newParquetEncoder(w), docs)
+	case XLSX:
+		e, err := newXLSXEncoder(w)
+		if err != nil {
+			return err
+		}
+		return writeAll(e, docs)
+	}
+	return fmt.Errorf("unknown export format %s", f)
+}
+
+// Export writes the companies matching the query (or all companies, if the
+// query is nil) to the file at pth.
+func Export(d database, q *db.Query, pth string, f Format, pageSize, workers int) (err error) { // using named return so we can set it in the defer call
+	if q == nil {
+		q = &db.Query{}
+	}
+	q.Limit = uint32(pageSize)
+	h, err := os.Create(pth)
+	if err != nil {
+		return fmt.Errorf("could not create %s: %w", pth, err)
+	}
+	defer func() {
+		if e := h.Close(); e != nil && err == nil {
+			err = fmt.Errorf("could not close %s: %w", pth, e)
+		}
+	}()
+	bar := progressbar.Default(-1, fmt.Sprintf("Exporting companies to %s", pth))
+	defer func() {
+		if err := bar.Close(); err != nil {
+			slog.Warn("could not close the progress bar", "error", err)
+		}
+	}()
+	if err := export(d, q, h, f, workers, bar); err != nil {
+		return fmt.Errorf("error exporting to %s: %w", pth, err)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cuducos/minha-receita/db"
+	"github.com/parquet-go/parquet-go"
+	"github.com/schollz/progressbar/v3"
+)
+
+const total = 42
+
+// mockDatabase serves the same company many times, in pages, using the
+// position of the company as cursor
+type mockDatabase struct {
+	company string
+}
+
+func (m *mockDatabase) Search(_ context.Context, q *db.Query) (string, error) {
+	c, err := q.CursorAsInt()
+	if err != nil {
+		return "", err
+	}
+	var cs []string
+	for i := c; i < total && len(cs) < int(q.Limit); i++ {
+		cs = append(cs, m.company)
+	}
+	cur := "null"
+	if c+len(cs) < total {
+		cur = fmt.Sprintf(`"%d"`, c+len(cs))
+	}
+	return fmt.Sprintf(`{"data":[%s],"cursor":%s}`, strings.Join(cs, ","), cur), nil
+}
+
+func newMockDatabase(t *testing.T) *mockDatabase {
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Fatalf("could not read company json: %s", err)
+	}
+	return &mockDatabase{strings.TrimSpace(string(b))}
+}
+
+func TestExport(t *testing.T) {
+	for _, f := range Formats {
+		t.Run(string(f), func(t *testing.T) {
+			var b bytes.Buffer
+			q := db.Query{Limit: 5}
+			bar := progressbar.DefaultSilent(-1)
+			if err := export(newMockDatabase(t), &q, &b, f, 3, bar); err != nil {
+				t.Fatalf("expected no error exporting, got %s", err)
+			}
+			switch f {
+			case NDJSON:
+				var n int
+				s := bufio.NewScanner(&b)
+				s.Buffer(make([]byte, 0, 1<<16), 1<<20)
+				for s.Scan() {
+					var m map[string]any
+					if err := json.Unmarshal(s.Bytes(), &m); err != nil {
+						t.Errorf("expected line %d to be valid json, got %s", n+1, err)
+					}
+					n++
+				}
+				if n != total {
+					t.Errorf("expected %d lines, got %d", total, n)
+				}
+			case CSV:
+				rs, err := csv.NewReader(&b).ReadAll()
+				if err != nil {
+					t.Fatalf("expected no error reading csv, got %s", err)
+				}
+				if len(rs) != total+1 {
+					t.Errorf("expected %d rows (with header), got %d", total+1, len(rs))
+				}
+				if rs[0][0] != "cnpj" || rs[1][0] != "19131243000197" {
+					t.Errorf("expected first column to be the cnpj, got %s and %s", rs[0][0], rs[1][0])
+				}
+				for i, c := range rs[0] {
+					if c == "capital_social" && rs[1][i] != "0" {
+						t.Errorf("expected capital social to be 0, got %s", rs[1][i])
+					}
+					if c == "email" && rs[1][i] != "" {
+						t.Errorf("expected email to be empty, got %s", rs[1][i])
+					}
+				}
+			case Parquet:
+				r := parquet.NewReader(bytes.NewReader(b.Bytes()))
+				if n := r.NumRows(); n != total {
+					t.Errorf("expected %d rows, got %d", total, n)
+				}
+				rs := make([]parquet.Row, 1)
+				if _, err := r.ReadRows(rs); err != nil {
+					t.Fatalf("expected no error reading parquet row, got %s", err)
+				}
+				for i, f := range r.Schema().Fields() {
+					v := rs[0][i]
+					switch f.Name() {
+					case "cnpj":
+						if v.String() != "19131243000197" {
+							t.Errorf("expected cnpj 19131243000197, got %s", v)
+						}
+					case "codigo_municipio":
+						if v.Int64() != 7107 {
+							t.Errorf("expected codigo_municipio 7107, got %s", v)
+						}
+					case "email":
+						if !v.IsNull() {
+							t.Errorf("expected email to be null, got %s", v)
+						}
+					}
+				}
+			case XLSX:
+				rs := readXLSX(t, b.Bytes())
+				if len(rs) != total+1 {
+					t.Errorf("expected %d rows (with header), got %d", total+1, len(rs))
+				}
+				for i, c := range rs[0] {
+					switch c.Text {
+					case "cnpj":
+						if rs[1][i].Type != "inlineStr" || rs[1][i].Text != "19131243000197" {
+							t.Errorf("expected cnpj to be the text 19131243000197, got %#v", rs[1][i])
+						}
+					case "codigo_municipio":
+						if rs[1][i].Type != "" || rs[1][i].Value != "7107" {
+							t.Errorf("expected codigo_municipio to be the number 7107, got %#v", rs[1][i])
+						}
+					case "data_inicio_atividade":
+						if rs[1][i].Style != "1" || rs[1][i].Value != "41550" {
+							t.Errorf("expected data_inicio_atividade to be the date 41550, got %#v", rs[1][i])
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+type xlsxCell struct {
+	Type  string `xml:"t,attr"`
+	Style string `xml:"s,attr"`
+	Value string `xml:"v"`
+	Text  string `xml:"is>t"`
+}
+
+func readXLSX(t *testing.T, b []byte) [][]xlsxCell {
+	z, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("expected a valid zip file, got %s", err)
+	}
+	f, err := z.Open("xl/worksheets/sheet1.xml")
+	if err != nil {
+		t.Fatalf("expected a worksheet in the xlsx file, got %s", err)
+	}
+	defer f.Close()
+	var s struct {
+		Rows []struct {
+			Cells []xlsxCell `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.NewDecoder(f).Decode(&s); err != nil {
+		t.Fatalf("expected a valid worksheet, got %s", err)
+	}
+	rs := make([][]xlsxCell, len(s.Rows))
+	for i, r := range s.Rows {
+		rs[i] = r.Cells
+	}
+	return rs
+}
+
+func TestWritePage(t *testing.T) {
+	c := newMockDatabase(t).company
+	var b bytes.Buffer
+	if err := WritePage(&b, XLSX, []jsontext.Value{jsontext.Value(c), jsontext.Value(c)}); err != nil {
+		t.Fatalf("expected no error writing a page, got %s", err)
+	}
+	if rs := readXLSX(t, b.Bytes()); len(rs) != 3 {
+		t.Errorf("expected 3 rows (with header), got %d", len(rs))
+	}
+}
+
+func TestExportKeepsOrder(t *testing.T) {
+	d := &orderedDatabase{}
+	var b bytes.Buffer
+	q := db.Query{Limit: 3}
+	if err := export(d, &q, &b, NDJSON, 4, progressbar.DefaultSilent(-1)); err != nil {
+		t.Fatalf("expected no error exporting, got %s", err)
+	}
+	for i, l := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		if l != fmt.Sprintf(`{"n":%d}`, i) {
+			t.Errorf("expected line %d to be {\"n\":%d}, got %s", i, i, l)
+		}
+	}
+}
+
+type orderedDatabase struct{}
+
+func (orderedDatabase) Search(_ context.Context, q *db.Query) (string, error) {
+	c, err := q.CursorAsInt()
+	if err != nil {
+		return "", err
+	}
+	var cs []string
+	for i := c; i < total && len(cs) < int(q.Limit); i++ {
+		cs = append(cs, fmt.Sprintf(`{"n": %d}`, i))
+	}
+	cur := "null"
+	if c+len(cs) < total {
+		cur = fmt.Sprintf(`"%d"`, c+len(cs))
+	}
+	return fmt.Sprintf(`{"data":[%s],"cursor":%s}`, strings.Join(cs, ","), cur), nil
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, s := range []string{"ndjson", "CSV", "Parquet", "xlsx"} {
+		if _, err := ParseFormat(s); err != nil {
+			t.Errorf("expected %s to be a valid format, got %s", s, err)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("expected xml to be an invalid format, got nil")
+	}
+}
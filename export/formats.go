@@ -0,0 +1,220 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Format of the exported file.
+type Format string
+
+const (
+	NDJSON  Format = "ndjson"
+	CSV     Format = "csv"
+	Parquet Format = "parquet"
+	XLSX    Format = "xlsx"
+)
+
+// Formats lists the supported export formats.
+var Formats = []Format{NDJSON, CSV, Parquet, XLSX}
+
+// ParseFormat validates the name of an export format.
+func ParseFormat(s string) (Format, error) {
+	f := Format(strings.ToLower(s))
+	if !slices.Contains(Formats, f) {
+		return "", fmt.Errorf("unknown export format %s", s)
+	}
+	return f, nil
+}
+
+// encoder converts pages of company JSONs into a chunk of the output file: the
+// encode method is called concurrently by the workers, while write is called
+// sequentially, in the order of the pages.
+type encoder[T any] interface {
+	encode([]jsontext.Value) (T, error)
+	write(T) error
+	close() error
+}
+
+type ndjsonEncoder struct {
+	w io.Writer
+}
+
+func (e *ndjsonEncoder) encode(docs []jsontext.Value) ([]byte, error) {
+	var b bytes.Buffer
+	for _, d := range docs {
+		c := d.Clone()
+		if err := c.Compact(); err != nil {
+			return nil, fmt.Errorf("could not compact company json: %w", err)
+		}
+		b.Write(c)
+		b.WriteByte('\n')
+	}
+	return b.Bytes(), nil
+}
+
+func (e *ndjsonEncoder) write(b []byte) error {
+	_, err := e.w.Write(b)
+	return err
+}
+
+func (e *ndjsonEncoder) close() error { return nil }
+
+type csvEncoder struct {
+	w       io.Writer
+	columns []column
+}
+
+func (e *csvEncoder) encode(docs []jsontext.Value) ([]byte, error) {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	r := make([]string, len(e.columns))
+	for _, d := range docs {
+		vs, err := flatten(e.columns, d)
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range vs {
+			r[i], err = asText(v)
+			if err != nil {
+				return nil, fmt.Errorf("could not read %s: %w", e.columns[i].name, err)
+			}
+		}
+		if err := w.Write(r); err != nil {
+			return nil, fmt.Errorf("could not write csv row: %w", err)
+		}
+	}
+	w.Flush()
+	return b.Bytes(), w.Error()
+}
+
+func (e *csvEncoder) write(b []byte) error {
+	_, err := e.w.Write(b)
+	return err
+}
+
+func (e *csvEncoder) close() error { return nil }
+
+func newCSVEncoder(w io.Writer) (*csvEncoder, error) {
+	e := csvEncoder{w: w, columns: columns()}
+	h := make([]string, len(e.columns))
+	for i, c := range e.columns {
+		h[i] = c.name
+	}
+	c := csv.NewWriter(w)
+	if err := c.Write(h); err != nil {
+		return nil, fmt.Errorf("could not write csv header: %w", err)
+	}
+	c.Flush()
+	return &e, c.Error()
+}
+
+type parquetEncoder struct {
+	w       *parquet.GenericWriter[any]
+	columns []column // in the same order as the parquet schema (alphabetical)
+}
+
+func (e *parquetEncoder) value(c column, v jsontext.Value) (parquet.Value, error) {
+	if isNull(v) {
+		return parquet.NullValue(), nil
+	}
+	switch c.kind {
+	case integer:
+		var n int64
+		if err := json.Unmarshal(v, &n); err != nil {
+			return parquet.Value{}, err
+		}
+		return parquet.ValueOf(n), nil
+	case decimal:
+		var n float64
+		if err := json.Unmarshal(v, &n); err != nil {
+			return parquet.Value{}, err
+		}
+		return parquet.ValueOf(n), nil
+	case boolean:
+		var b bool
+		if err := json.Unmarshal(v, &b); err != nil {
+			return parquet.Value{}, err
+		}
+		return parquet.ValueOf(b), nil
+	case day:
+		var s string
+		if err := json.Unmarshal(v, &s); err != nil {
+			return parquet.Value{}, err
+		}
+		t, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			return parquet.Value{}, err
+		}
+		return parquet.ValueOf(int32(t.Unix() / 86400)), nil
+	}
+	s, err := asText(v)
+	if err != nil {
+		return parquet.Value{}, err
+	}
+	return parquet.ValueOf(s), nil
+}
+
+func (e *parquetEncoder) encode(docs []jsontext.Value) ([]parquet.Row, error) {
+	rs := make([]parquet.Row, len(docs))
+	for i, d := range docs {
+		vs, err := flatten(e.columns, d)
+		if err != nil {
+			return nil, err
+		}
+		r := make(parquet.Row, len(vs))
+		for j, v := range vs {
+			p, err := e.value(e.columns[j], v)
+			if err != nil {
+				return nil, fmt.Errorf("could not read %s: %w", e.columns[j].name, err)
+			}
+			var def int
+			if !p.IsNull() {
+				def = 1
+			}
+			r[j] = p.Level(0, def, j)
+		}
+		rs[i] = r
+	}
+	return rs, nil
+}
+
+func (e *parquetEncoder) write(rs []parquet.Row) error {
+	_, err := e.w.WriteRows(rs)
+	return err
+}
+
+func (e *parquetEncoder) close() error { return e.w.Close() }
+
+func newParquetEncoder(w io.Writer) *parquetEncoder {
+	cs := columns()
+	slices.SortFunc(cs, func(a, b column) int { return strings.Compare(a.name, b.name) })
+	g := parquet.Group{}
+	for _, c := range cs {
+		var n parquet.Node
+		switch c.kind {
+		case integer:
+			n = parquet.Int(64)
+		case decimal:
+			n = parquet.Leaf(parquet.DoubleType)
+		case boolean:
+			n = parquet.Leaf(parquet.BooleanType)
+		case day:
+			n = parquet.Date()
+		default:
+			n = parquet.String()
+		}
+		g[c.name] = parquet.Optional(n)
+	}
+	s := parquet.NewSchema("company", g)
+	return &parquetEncoder{w: parquet.NewGenericWriter[any](w, s), columns: cs}
+}
@@ -0,0 +1,279 @@
+package export
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultURLTTL is how long a pre-signed download URL is valid for.
+	DefaultURLTTL = 15 * time.Minute
+
+	// maxURLTTL is the longest expiration accepted by S3 (seven days).
+	maxURLTTL = 7 * 24 * time.Hour
+
+	s3Algorithm  = "AWS4-HMAC-SHA256"
+	s3DateLayout = "20060102T150405Z"
+)
+
+// ObjectStorage signs download URLs for the exported files kept in a S3
+// compatible bucket, so clients download them straight from the object
+// storage instead of through the web API.
+type ObjectStorage struct {
+	Bucket       string
+	Prefix       string
+	Endpoint     string // empty for AWS, e.g. https://minio.local:9000 for others
+	Region       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	TTL          time.Duration
+}
+
+// NewObjectStorageFromEnv reads the object storage settings for the exported
+// files from the environment variables. It returns nil if EXPORTS_S3_BUCKET is
+// not set.
+func NewObjectStorageFromEnv() (*ObjectStorage, error) {
+	return ObjectStorageFromEnv("EXPORTS")
+}
+
+// ObjectStorageFromEnv reads the object storage settings from the environment
+// variables starting with p (e.g. EXPORTS_S3_BUCKET, EXPORTS_S3_PREFIX,
+// EXPORTS_S3_ENDPOINT and EXPORTS_URL_TTL for EXPORTS) plus the AWS ones. It
+// returns nil if the bucket is not set.
+func ObjectStorageFromEnv(p string) (*ObjectStorage, error) {
+	b := os.Getenv(p + "_S3_BUCKET")
+	if b == "" {
+		return nil, nil
+	}
+	s := ObjectStorage{
+		Bucket:       b,
+		Prefix:       strings.Trim(os.Getenv(p+"_S3_PREFIX"), "/"),
+		Endpoint:     strings.TrimSuffix(os.Getenv(p+"_S3_ENDPOINT"), "/"),
+		Region:       os.Getenv("AWS_REGION"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		TTL:          DefaultURLTTL,
+	}
+	if s.Region == "" {
+		s.Region = "us-east-1"
+	}
+	if s.AccessKey == "" || s.SecretKey == "" {
+		return nil, fmt.Errorf("%s_S3_BUCKET requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY", p)
+	}
+	if v := os.Getenv(p + "_URL_TTL"); v != "" {
+		t, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s_URL_TTL %s: %w", p, v, err)
+		}
+		s.TTL = t
+	}
+	if s.TTL <= 0 || s.TTL > maxURLTTL {
+		return nil, fmt.Errorf("%s_URL_TTL must be between 1s and %s, got %s", p, maxURLTTL, s.TTL)
+	}
+	return &s, nil
+}
+
+// Key is the object key of the exported file in a given format.
+func (s *ObjectStorage) Key(f Format) string {
+	return s.ObjectKey(fmt.Sprintf("cnpj.%s", f))
+}
+
+// ObjectKey is the object key of a name within the prefix.
+func (s *ObjectStorage) ObjectKey(n string) string {
+	return path.Join(s.Prefix, n)
+}
+
+// URI identifies an object key in the bucket, e.g. s3://bucket/prefix/key.
+func (s *ObjectStorage) URI(key string) string {
+	return fmt.Sprintf("s3://%s/%s", s.Bucket, key)
+}
+
+// location returns the scheme, host and path of an object key.
+func (s *ObjectStorage) location(key string) (string, string, string, error) {
+	if s.Endpoint == "" {
+		return "https", fmt.Sprintf("%s.s3.%s.amazonaws.com", s.Bucket, s.Region), "/" + key, nil
+	}
+	u, err := url.Parse(s.Endpoint) // other providers usually require path-style URLs
+	if err != nil {
+		return "", "", "", fmt.Errorf("invalid object storage endpoint %s: %w", s.Endpoint, err)
+	}
+	return u.Scheme, u.Host, path.Join("/", u.Path, s.Bucket, key), nil
+}
+
+// PresignedURL returns a download URL for the exported file in the format f,
+// valid for the TTL from now.
+func (s *ObjectStorage) PresignedURL(f Format, now time.Time) (string, time.Time, error) {
+	if !slices.Contains(Formats, f) {
+		return "", time.Time{}, fmt.Errorf("unknown export format %s", f)
+	}
+	scheme, host, pth, err := s.location(s.Key(f))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	u := presign(scheme, host, pth, s.Region, s.AccessKey, s.SecretKey, s.SessionToken, now, s.TTL)
+	return u, now.Add(s.TTL), nil
+}
+
+// uriEncode escapes everything but the unreserved characters, as required by
+// the AWS Signature Version 4. Slashes are kept in paths.
+func uriEncode(s string, path bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' || (path && c == '/') {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func hmacSHA256(k []byte, s string) []byte {
+	h := hmac.New(sha256.New, k)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// presign builds a GET URL with the AWS Signature Version 4 in the query
+// string, see https://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-query-string-auth.html
+func presign(scheme, host, pth, region, key, secret, token string, now time.Time, ttl time.Duration) string {
+	now = now.UTC()
+	d := now.Format("20060102")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", d, region)
+	q := map[string]string{
+		"X-Amz-Algorithm":     s3Algorithm,
+		"X-Amz-Credential":    key + "/" + scope,
+		"X-Amz-Date":          now.Format(s3DateLayout),
+		"X-Amz-Expires":       fmt.Sprintf("%d", int(ttl.Seconds())),
+		"X-Amz-SignedHeaders": "host",
+	}
+	if token != "" {
+		q["X-Amz-Security-Token"] = token
+	}
+	var ps []string
+	for _, k := range slices.Sorted(maps.Keys(q)) {
+		ps = append(ps, uriEncode(k, false)+"="+uriEncode(q[k], false))
+	}
+	qs := strings.Join(ps, "&")
+	p := uriEncode(pth, true)
+	r := strings.Join([]string{"GET", p, qs, "host:" + host, "", "host", "UNSIGNED-PAYLOAD"}, "\n")
+	sig := signature(r, secret, region, now)
+	return fmt.Sprintf("%s://%s%s?%s&X-Amz-Signature=%s", scheme, host, p, qs, sig)
+}
+
+// signature signs a canonical request with the AWS Signature Version 4.
+func signature(canonical, secret, region string, now time.Time) string {
+	now = now.UTC()
+	d := now.Format("20060102")
+	h := sha256.Sum256([]byte(canonical))
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", d, region)
+	sts := strings.Join([]string{s3Algorithm, now.Format(s3DateLayout), scope, hex.EncodeToString(h[:])}, "\n")
+	k := hmacSHA256([]byte("AWS4"+secret), d)
+	k = hmacSHA256(k, region)
+	k = hmacSHA256(k, "s3")
+	k = hmacSHA256(k, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(k, sts))
+}
+
+// sign adds the AWS Signature Version 4 to the headers of a request, see
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+// The payload is not signed, so files are streamed without reading them twice.
+func sign(r *http.Request, key, secret, token, region string, now time.Time) {
+	now = now.UTC()
+	r.Header.Set("X-Amz-Date", now.Format(s3DateLayout))
+	if r.Header.Get("X-Amz-Content-Sha256") == "" {
+		r.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	}
+	if token != "" {
+		r.Header.Set("X-Amz-Security-Token", token)
+	}
+	hs := map[string]string{"host": r.URL.Host}
+	for k, v := range r.Header {
+		if k := strings.ToLower(k); strings.HasPrefix(k, "x-amz-") || k == "range" || k == "content-type" || k == "content-md5" {
+			hs[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	ks := slices.Sorted(maps.Keys(hs))
+	var c strings.Builder
+	for _, k := range ks {
+		fmt.Fprintf(&c, "%s:%s\n", k, hs[k])
+	}
+	signed := strings.Join(ks, ";")
+	canonical := strings.Join([]string{r.Method, uriEncode(r.URL.Path, true), r.URL.RawQuery, c.String(), signed, r.Header.Get("X-Amz-Content-Sha256")}, "\n")
+	sig := signature(canonical, secret, region, now)
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", now.Format("20060102"), region)
+	r.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s", s3Algorithm, key, scope, signed, sig))
+}
+
+// request creates a signed request for an object key.
+func (s *ObjectStorage) request(method, key string, body io.Reader) (*http.Request, error) {
+	scheme, host, pth, err := s.location(key)
+	if err != nil {
+		return nil, err
+	}
+	u := url.URL{Scheme: scheme, Host: host, Path: pth}
+	r, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request for %s: %w", s.URI(key), err)
+	}
+	return r, nil
+}
+
+// Size returns the size of an object, and false if it does not exist.
+func (s *ObjectStorage) Size(key string) (int64, bool, error) {
+	r, err := s.request(http.MethodHead, key, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	sign(r, s.AccessKey, s.SecretKey, s.SessionToken, s.Region, time.Now())
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		return 0, false, fmt.Errorf("error checking %s: %w", s.URI(key), err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.ContentLength, true, nil
+	case http.StatusNotFound:
+		return 0, false, nil
+	default:
+		return 0, false, fmt.Errorf("error checking %s: object storage responded with %s", s.URI(key), resp.Status)
+	}
+}
+
+// Upload sends size bytes from r to the object key, in the storage class
+// (e.g. GLACIER or DEEP_ARCHIVE, empty for the bucket default).
+func (s *ObjectStorage) Upload(key string, r io.Reader, size int64, class string) error {
+	req, err := s.request(http.MethodPut, key, r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if class != "" {
+		req.Header.Set("X-Amz-Storage-Class", class)
+	}
+	sign(req, s.AccessKey, s.SecretKey, s.SessionToken, s.Region, time.Now())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error uploading to %s: %w", s.URI(key), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("error uploading to %s: object storage responded with %s: %s", s.URI(key), resp.Status, string(b))
+	}
+	return nil
+}
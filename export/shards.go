@@ -0,0 +1,339 @@
+package export
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/cuducos/minha-receita/db"
+	"github.com/parquet-go/parquet-go"
+	"github.com/schollz/progressbar/v3"
+)
+
+// ManifestName is the name of the file listing the shards of a split export.
+const ManifestName = "manifest.json"
+
+// OtherShard groups the companies without the field used to split the export.
+const OtherShard = "outros"
+
+// Split is the field used to divide an export into shards.
+type Split string
+
+const (
+	SplitByUF   Split = "uf"
+	SplitByCNAE Split = "cnae" // division of the CNAE fiscal (its first two digits)
+)
+
+// Splits lists the supported ways to split an export.
+var Splits = []Split{SplitByUF, SplitByCNAE}
+
+// ParseSplit validates the name of the field used to split an export.
+func ParseSplit(s string) (Split, error) {
+	v := Split(strings.ToLower(s))
+	if !slices.Contains(Splits, v) {
+		return "", fmt.Errorf("unknown split %s, the options are: uf, cnae", s)
+	}
+	return v, nil
+}
+
+func isShard(s Split, v string) bool {
+	if v == OtherShard {
+		return true
+	}
+	if len(v) != 2 {
+		return false
+	}
+	for _, r := range v {
+		switch s {
+		case SplitByUF:
+			if r < 'A' || r > 'Z' {
+				return false
+			}
+		case SplitByCNAE:
+			if r < '0' || r > '9' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ParseShard validates the name of a shard, such as SP for the UF or 62 for the
+// CNAE division.
+func (s Split) ParseShard(v string) (string, error) {
+	v = strings.TrimSpace(v)
+	if s == SplitByUF && v != OtherShard {
+		v = strings.ToUpper(v)
+	}
+	if !isShard(s, v) {
+		return "", fmt.Errorf("invalid %s shard %s", s, v)
+	}
+	return v, nil
+}
+
+// Shard returns the shard of a company JSON.
+func (s Split) Shard(doc jsontext.Value) (string, error) {
+	var c struct {
+		UF   string  `json:"uf"`
+		CNAE *uint32 `json:"cnae_fiscal"`
+	}
+	if err := json.Unmarshal(doc, &c); err != nil {
+		return "", fmt.Errorf("could not read the %s of the company: %w", s, err)
+	}
+	var v string
+	switch s {
+	case SplitByUF:
+		v = strings.ToUpper(c.UF)
+	case SplitByCNAE:
+		if c.CNAE != nil && *c.CNAE > 0 {
+			v = fmt.Sprintf("%07d", *c.CNAE)[:2]
+		}
+	}
+	if !isShard(s, v) {
+		return OtherShard, nil
+	}
+	return v, nil
+}
+
+// ShardFile describes one of the files of a split export.
+type ShardFile struct {
+	Shard     string `json:"shard"`
+	File      string `json:"file"`
+	Companies int    `json:"companies"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+}
+
+// Manifest lists the files of a split export, so consumers can download and
+// verify only the shards they need.
+type Manifest struct {
+	SplitBy   Split       `json:"split_by"`
+	Format    Format      `json:"format"`
+	UpdatedAt string      `json:"updated_at"`
+	Shards    []ShardFile `json:"shards"`
+}
+
+type shardChunk[T any] struct {
+	shard string
+	size  int
+	data  T
+}
+
+type shardWriter[T any] struct {
+	file    *os.File
+	hash    hash.Hash
+	encoder encoder[T]
+	info    ShardFile
+}
+
+// shardedEncoder sends each company to the encoder of its shard, creating the
+// file of the shard the first time one of its companies shows up. Since the
+// encode methods only depend on the columns, a single encoder not writing
+// anywhere encodes the chunks of all shards.
+type shardedEncoder[T any] struct {
+	dir      string
+	manifest Manifest
+	base     encoder[T]
+	create   func(io.Writer) (encoder[T], error)
+	shards   map[string]*shardWriter[T]
+}
+
+func newShardedEncoder[T any](dir string, m Manifest, create func(io.Writer) (encoder[T], error)) (*shardedEncoder[T], error) {
+	b, err := create(io.Discard)
+	if err != nil {
+		return nil, err
+	}
+	return &shardedEncoder[T]{dir: dir, manifest: m, base: b, create: create, shards: make(map[string]*shardWriter[T])}, nil
+}
+
+func (e *shardedEncoder[T]) encode(docs []jsontext.Value) ([]shardChunk[T], error) {
+	g := make(map[string][]jsontext.Value)
+	for _, d := range docs {
+		s, err := e.manifest.SplitBy.Shard(d)
+		if err != nil {
+			return nil, err
+		}
+		g[s] = append(g[s], d)
+	}
+	cs := make([]shardChunk[T], 0, len(g))
+	for s, ds := range g {
+		b, err := e.base.encode(ds)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding shard %s: %w", s, err)
+		}
+		cs = append(cs, shardChunk[T]{s, len(ds), b})
+	}
+	slices.SortFunc(cs, func(a, b shardChunk[T]) int { return cmp.Compare(a.shard, b.shard) })
+	return cs, nil
+}
+
+func (e *shardedEncoder[T]) open(s string) (*shardWriter[T], error) {
+	n := fmt.Sprintf("cnpj-%s-%s.%s", e.manifest.SplitBy, s, e.manifest.Format)
+	pth := filepath.Join(e.dir, n)
+	f, err := os.Create(pth)
+	if err != nil {
+		return nil, fmt.Errorf("could not create %s: %w", pth, err)
+	}
+	h := sha256.New()
+	c, err := e.create(io.MultiWriter(f, h))
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("could not start %s: %w", pth, err)
+	}
+	w := shardWriter[T]{file: f, hash: h, encoder: c, info: ShardFile{Shard: s, File: n}}
+	e.shards[s] = &w
+	return &w, nil
+}
+
+func (e *shardedEncoder[T]) write(cs []shardChunk[T]) error {
+	for _, c := range cs {
+		w, ok := e.shards[c.shard]
+		if !ok {
+			var err error
+			w, err = e.open(c.shard)
+			if err != nil {
+				return err
+			}
+		}
+		if err := w.encoder.write(c.data); err != nil {
+			return fmt.Errorf("error writing shard %s: %w", c.shard, err)
+		}
+		w.info.Companies += c.size
+	}
+	return nil
+}
+
+// close finishes the file of every shard and then writes the manifest, so the
+// manifest only exists if all the shards were written.
+func (e *shardedEncoder[T]) close() error {
+	for _, s := range slices.Sorted(maps.Keys(e.shards)) {
+		w := e.shards[s]
+		if err := w.encoder.close(); err != nil {
+			return fmt.Errorf("could not finish shard %s: %w", s, err)
+		}
+		n, err := w.file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return fmt.Errorf("could not get the size of shard %s: %w", s, err)
+		}
+		err = w.file.Close()
+		w.file = nil
+		if err != nil {
+			return fmt.Errorf("could not close shard %s: %w", s, err)
+		}
+		w.info.Size = n
+		w.info.SHA256 = hex.EncodeToString(w.hash.Sum(nil))
+		e.manifest.Shards = append(e.manifest.Shards, w.info)
+	}
+	if e.manifest.Shards == nil {
+		e.manifest.Shards = []ShardFile{}
+	}
+	b, err := json.Marshal(e.manifest, jsontext.WithIndent("  "))
+	if err != nil {
+		return fmt.Errorf("could not encode the manifest: %w", err)
+	}
+	pth := filepath.Join(e.dir, ManifestName)
+	if err := os.WriteFile(pth, b, 0644); err != nil {
+		return fmt.Errorf("could not write %s: %w", pth, err)
+	}
+	return nil
+}
+
+// abort closes the files of the shards after an error, leaving them incomplete
+// and without a manifest.
+func (e *shardedEncoder[T]) abort() {
+	for _, w := range e.shards {
+		if w.file == nil { // already closed
+			continue
+		}
+		if err := w.file.Close(); err != nil {
+			slog.Warn("could not close shard", "shard", w.info.Shard, "error", err)
+		}
+	}
+}
+
+func runShards[T any](d database, q *db.Query, dir string, m Manifest, create func(io.Writer) (encoder[T], error), workers int, bar *progressbar.ProgressBar) error {
+	e, err := newShardedEncoder(dir, m, create)
+	if err != nil {
+		return err
+	}
+	if err := run(d, q, e, workers, bar); err != nil {
+		e.abort()
+		return err
+	}
+	return nil
+}
+
+func exportShards(d database, q *db.Query, dir string, m Manifest, workers int, bar *progressbar.ProgressBar) error {
+	switch m.Format {
+	case NDJSON:
+		return runShards(d, q, dir, m, func(w io.Writer) (encoder[[]byte], error) {
+			return &ndjsonEncoder{w}, nil
+		}, workers, bar)
+	case CSV:
+		return runShards(d, q, dir, m, func(w io.Writer) (encoder[[]byte], error) {
+			e, err := newCSVEncoder(w)
+			if err != nil {
+				return nil, err
+			}
+			return e, nil
+		}, workers, bar)
+	case Parquet:
+		return runShards(d, q, dir, m, func(w io.Writer) (encoder[[]parquet.Row], error) {
+			return newParquetEncoder(w), nil
+		}, workers, bar)
+	case XLSX:
+		return runShards(d, q, dir, m, func(w io.Writer) (encoder[[]byte], error) {
+			e, err := newXLSXEncoder(w)
+			if err != nil {
+				return nil, err
+			}
+			return e, nil
+		}, workers, bar)
+	}
+	return fmt.Errorf("unknown export format %s", m.Format)
+}
+
+type metaDatabase interface {
+	database
+	MetaRead(string) (string, error)
+}
+
+// ExportShards writes the companies matching the query (or all companies, if
+// the query is nil) to one file per shard in the directory dir (e.g.
+// cnpj-uf-SP.csv), plus a manifest with the size and the checksum of each
+// file.
+func ExportShards(d metaDatabase, q *db.Query, dir string, f Format, s Split, pageSize, workers int) error {
+	if q == nil {
+		q = &db.Query{}
+	}
+	q.Limit = uint32(pageSize)
+	u, err := d.MetaRead("updated-at")
+	if err != nil {
+		return fmt.Errorf("could not read the date of the dataset: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("could not create %s: %w", dir, err)
+	}
+	bar := progressbar.Default(-1, fmt.Sprintf("Exporting companies by %s to %s", s, dir))
+	defer func() {
+		if err := bar.Close(); err != nil {
+			slog.Warn("could not close the progress bar", "error", err)
+		}
+	}()
+	m := Manifest{SplitBy: s, Format: f, UpdatedAt: u}
+	if err := exportShards(d, q, dir, m, workers, bar); err != nil {
+		return fmt.Errorf("error exporting to %s: %w", dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package export
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cuducos/minha-receita/db"
+	"github.com/schollz/progressbar/v3"
+)
+
+// shardedDatabase serves companies from SP, RJ and without UF, in turns
+type shardedDatabase struct{}
+
+func (shardedDatabase) Search(_ context.Context, q *db.Query) (string, error) {
+	c, err := q.CursorAsInt()
+	if err != nil {
+		return "", err
+	}
+	var cs []string
+	for i := c; i < total && len(cs) < int(q.Limit); i++ {
+		cs = append(cs, fmt.Sprintf(`{"n": %d, "uf": "%s"}`, i, []string{"SP", "RJ", ""}[i%3]))
+	}
+	cur := "null"
+	if c+len(cs) < total {
+		cur = fmt.Sprintf(`"%d"`, c+len(cs))
+	}
+	return fmt.Sprintf(`{"data":[%s],"cursor":%s}`, strings.Join(cs, ","), cur), nil
+}
+
+func TestSplitShard(t *testing.T) {
+	for _, c := range []struct {
+		split    Split
+		doc      string
+		expected string
+	}{
+		{SplitByUF, `{"uf": "SP"}`, "SP"},
+		{SplitByUF, `{"uf": "ex"}`, "EX"},
+		{SplitByUF, `{"uf": ""}`, OtherShard},
+		{SplitByUF, `{"uf": null}`, OtherShard},
+		{SplitByCNAE, `{"cnae_fiscal": 6204000}`, "62"},
+		{SplitByCNAE, `{"cnae_fiscal": 111301}`, "01"},
+		{SplitByCNAE, `{"cnae_fiscal": null}`, OtherShard},
+		{SplitByCNAE, `{}`, OtherShard},
+	} {
+		got, err := c.split.Shard(jsontext.Value(c.doc))
+		if err != nil {
+			t.Errorf("expected no error reading the shard of %s, got %s", c.doc, err)
+		}
+		if got != c.expected {
+			t.Errorf("expected the %s shard of %s to be %s, got %s", c.split, c.doc, c.expected, got)
+		}
+	}
+}
+
+func TestParseShard(t *testing.T) {
+	for _, c := range []struct {
+		split    Split
+		value    string
+		expected string
+		err      bool
+	}{
+		{SplitByUF, "sp", "SP", false},
+		{SplitByUF, "outros", OtherShard, false},
+		{SplitByUF, "São Paulo", "", true},
+		{SplitByCNAE, "62", "62", false},
+		{SplitByCNAE, "6204000", "", true},
+		{SplitByCNAE, "SP", "", true},
+	} {
+		got, err := c.split.ParseShard(c.value)
+		if c.err {
+			if err == nil {
+				t.Errorf("expected an error parsing %s shard %s, got %s", c.split, c.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("expected no error parsing %s shard %s, got %s", c.split, c.value, err)
+		}
+		if got != c.expected {
+			t.Errorf("expected %s shard %s to be %s, got %s", c.split, c.value, c.expected, got)
+		}
+	}
+}
+
+func TestExportShards(t *testing.T) {
+	dir := t.TempDir()
+	q := db.Query{Limit: 5}
+	m := Manifest{SplitBy: SplitByUF, Format: NDJSON, UpdatedAt: "2024-08-17"}
+	if err := exportShards(shardedDatabase{}, &q, dir, m, 3, progressbar.DefaultSilent(-1)); err != nil {
+		t.Fatalf("expected no error exporting, got %s", err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	if err != nil {
+		t.Fatalf("expected a manifest, got %s", err)
+	}
+	var got Manifest
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("expected a valid manifest, got %s", err)
+	}
+	if got.SplitBy != SplitByUF || got.Format != NDJSON || got.UpdatedAt != "2024-08-17" {
+		t.Errorf("unexpected manifest %#v", got)
+	}
+	expected := []ShardFile{
+		{Shard: "RJ", File: "cnpj-uf-RJ.ndjson", Companies: 14},
+		{Shard: "SP", File: "cnpj-uf-SP.ndjson", Companies: 14},
+		{Shard: OtherShard, File: "cnpj-uf-outros.ndjson", Companies: 14},
+	}
+	if len(got.Shards) != len(expected) {
+		t.Fatalf("expected %d shards, got %d", len(expected), len(got.Shards))
+	}
+	for i, s := range got.Shards {
+		if s.Shard != expected[i].Shard || s.File != expected[i].File || s.Companies != expected[i].Companies {
+			t.Errorf("expected shard %d to be %#v, got %#v", i, expected[i], s)
+		}
+		b, err := os.ReadFile(filepath.Join(dir, s.File))
+		if err != nil {
+			t.Fatalf("expected file %s, got %s", s.File, err)
+		}
+		if int64(len(b)) != s.Size {
+			t.Errorf("expected %s to have %d bytes, got %d", s.File, s.Size, len(b))
+		}
+		if h := sha256.Sum256(b); hex.EncodeToString(h[:]) != s.SHA256 {
+			t.Errorf("expected %s to have checksum %s, got %s", s.File, s.SHA256, hex.EncodeToString(h[:]))
+		}
+		ls := strings.Split(strings.TrimSpace(string(b)), "\n")
+		if len(ls) != s.Companies {
+			t.Errorf("expected %d lines in %s, got %d", s.Companies, s.File, len(ls))
+		}
+		uf := s.Shard
+		if uf == OtherShard {
+			uf = ""
+		}
+		for _, l := range ls {
+			if !strings.Contains(l, fmt.Sprintf(`"uf":"%s"`, uf)) {
+				t.Errorf("expected only companies from %s in %s, got %s", s.Shard, s.File, l)
+			}
+		}
+	}
+}
+
+func TestParseSplit(t *testing.T) {
+	for _, s := range []string{"uf", "CNAE"} {
+		if _, err := ParseSplit(s); err != nil {
+			t.Errorf("expected %s to be a valid split, got %s", s, err)
+		}
+	}
+	if _, err := ParseSplit("municipio"); err == nil {
+		t.Error("expected municipio to be an invalid split, got nil")
+	}
+}
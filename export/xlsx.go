@@ -0,0 +1,177 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// XLSXContentType is the media type of the Excel files.
+const XLSXContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// maxXLSXRows is the limit of rows in an Excel worksheet (including the
+// header).
+const maxXLSXRows = 1_048_576
+
+// the minimal set of parts of an Excel file with a single worksheet, the
+// worksheet itself is streamed by the encoder
+var xlsxParts = []struct{ name, content string }{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="CNPJ" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`</Relationships>`},
+	{"xl/styles.xml", xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<fonts count="1"><font/></fonts>` +
+		`<fills count="1"><fill/></fills>` +
+		`<borders count="1"><border/></borders>` +
+		`<cellStyleXfs count="1"><xf/></cellStyleXfs>` +
+		`<cellXfs count="2"><xf/><xf numFmtId="14" applyNumberFormat="1"/></cellXfs>` + // the second one is for dates
+		`</styleSheet>`},
+}
+
+// excelEpoch is the day zero of the dates in Excel (serial numbers count the
+// days since then).
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// xlsxEncoder writes an Excel file with one row per company and one typed
+// column per top-level field of the company JSON.
+type xlsxEncoder struct {
+	zip     *zip.Writer
+	sheet   io.Writer
+	columns []column
+	rows    int
+}
+
+func xlsxText(b *bytes.Buffer, s string) {
+	b.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+	xml.EscapeText(b, []byte(s)) // never fails writing to a buffer
+	b.WriteString(`</t></is></c>`)
+}
+
+func (e *xlsxEncoder) cell(b *bytes.Buffer, c column, v jsontext.Value) error {
+	if isNull(v) {
+		b.WriteString(`<c/>`)
+		return nil
+	}
+	switch c.kind {
+	case integer, decimal:
+		var n float64
+		if err := json.Unmarshal(v, &n); err != nil {
+			return err
+		}
+		fmt.Fprintf(b, `<c><v>%s</v></c>`, strconv.FormatFloat(n, 'f', -1, 64))
+		return nil
+	case boolean:
+		var t bool
+		if err := json.Unmarshal(v, &t); err != nil {
+			return err
+		}
+		n := 0
+		if t {
+			n = 1
+		}
+		fmt.Fprintf(b, `<c t="b"><v>%d</v></c>`, n)
+		return nil
+	case day:
+		var s string
+		if err := json.Unmarshal(v, &s); err != nil {
+			return err
+		}
+		t, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(b, `<c s="1"><v>%d</v></c>`, int(t.Sub(excelEpoch).Hours()/24))
+		return nil
+	}
+	s, err := asText(v)
+	if err != nil {
+		return err
+	}
+	xlsxText(b, s)
+	return nil
+}
+
+func (e *xlsxEncoder) encode(docs []jsontext.Value) ([]byte, error) {
+	var b bytes.Buffer
+	for _, d := range docs {
+		vs, err := flatten(e.columns, d)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(`<row>`)
+		for i, v := range vs {
+			if err := e.cell(&b, e.columns[i], v); err != nil {
+				return nil, fmt.Errorf("could not read %s: %w", e.columns[i].name, err)
+			}
+		}
+		b.WriteString(`</row>`)
+	}
+	return b.Bytes(), nil
+}
+
+// write expects the rows of a single page, so it counts them by the closing
+// tags to enforce the limit of rows of a worksheet.
+func (e *xlsxEncoder) write(b []byte) error {
+	e.rows += bytes.Count(b, []byte(`</row>`))
+	if e.rows > maxXLSXRows {
+		return fmt.Errorf("xlsx files are limited to %d companies, use a narrower query or another format", maxXLSXRows-1)
+	}
+	_, err := e.sheet.Write(b)
+	return err
+}
+
+func (e *xlsxEncoder) close() error {
+	if _, err := io.WriteString(e.sheet, `</sheetData></worksheet>`); err != nil {
+		return fmt.Errorf("could not write the end of the worksheet: %w", err)
+	}
+	for _, p := range xlsxParts {
+		w, err := e.zip.Create(p.name)
+		if err != nil {
+			return fmt.Errorf("could not create %s in the xlsx file: %w", p.name, err)
+		}
+		if _, err := io.WriteString(w, p.content); err != nil {
+			return fmt.Errorf("could not write %s in the xlsx file: %w", p.name, err)
+		}
+	}
+	return e.zip.Close()
+}
+
+func newXLSXEncoder(w io.Writer) (*xlsxEncoder, error) {
+	z := zip.NewWriter(w)
+	s, err := z.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, fmt.Errorf("could not create the worksheet: %w", err)
+	}
+	e := xlsxEncoder{zip: z, sheet: s, columns: columns(), rows: 1}
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData><row>`)
+	for _, c := range e.columns {
+		xlsxText(&b, c.name)
+	}
+	b.WriteString(`</row>`)
+	if _, err := s.Write(b.Bytes()); err != nil {
+		return nil, fmt.Errorf("could not write the xlsx header: %w", err)
+	}
+	return &e, nil
+}
@@ -0,0 +1,150 @@
+// Package fixtures extracts real companies from a loaded database to test
+// fixtures in the same format as testdata/response.json, so the tests can
+// cover the quirks of the real data.
+package fixtures
+
+import (
+	"context"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cuducos/go-cnpj"
+	"github.com/cuducos/minha-receita/db"
+)
+
+// DefaultLimit is the number of companies extracted when no CNPJ is given.
+const DefaultLimit = 5
+
+type database interface {
+	GetCompany(string, db.Profile) (string, error)
+	Search(context.Context, *db.Query) (string, error)
+	Sample(context.Context, int) ([]string, error)
+}
+
+// maskedCPF is how the transform masks CPF when privacy is on.
+const maskedCPF = "***000000**"
+
+// anonymize replaces the names, contacts and address of the company, and of
+// its partners, by fictional ones. The remaining fields (codes, dates, CNAEs,
+// etc.) are kept as they are since they are what the tests care about.
+func anonymize(c map[string]any, n int) {
+	set := func(m map[string]any, k string, v any) {
+		if s, ok := m[k].(string); ok && s != "" {
+			m[k] = v
+		}
+	}
+	set(c, "razao_social", fmt.Sprintf("EMPRESA FICTICIA %d LTDA", n))
+	set(c, "nome_fantasia", fmt.Sprintf("FICTICIA %d", n))
+	set(c, "email", fmt.Sprintf("empresa%d@example.com", n))
+	for _, k := range []string{"ddd_telefone_1", "ddd_telefone_2", "ddd_fax"} {
+		set(c, k, "1100000000")
+	}
+	set(c, "logradouro", "EXEMPLO")
+	set(c, "numero", "1")
+	set(c, "complemento", "")
+	qsa, _ := c["qsa"].([]any)
+	for i, v := range qsa {
+		p, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		set(p, "nome_socio", fmt.Sprintf("SOCIO FICTICIO %d", i+1))
+		set(p, "nome_representante_legal", fmt.Sprintf("REPRESENTANTE FICTICIO %d", i+1))
+		set(p, "cpf_representante_legal", maskedCPF)
+		if s, ok := p["cnpj_cpf_do_socio"].(string); ok && !cnpj.IsValid(s) { // companies as partners are public
+			set(p, "cnpj_cpf_do_socio", maskedCPF)
+		}
+	}
+}
+
+// write saves a company JSON to dir, named after its CNPJ.
+func write(dir, s string, n int, anon bool) error {
+	var c map[string]any
+	if err := json.Unmarshal([]byte(s), &c); err != nil {
+		return fmt.Errorf("error parsing company: %w", err)
+	}
+	id, _ := c["cnpj"].(string)
+	if id == "" {
+		return fmt.Errorf("company without cnpj: %s", s)
+	}
+	if anon {
+		anonymize(c, n)
+	}
+	b, err := json.Marshal(c, json.Deterministic(true), jsontext.WithIndent("  "))
+	if err != nil {
+		return fmt.Errorf("error serializing company %s: %w", id, err)
+	}
+	pth := filepath.Join(dir, id+".json")
+	if err := os.WriteFile(pth, append(b, '\n'), 0644); err != nil {
+		return fmt.Errorf("could not write %s: %w", pth, err)
+	}
+	slog.Info("Fixture created", "path", pth)
+	return nil
+}
+
+// companies reads the companies by their CNPJ, or up to limit companies
+// matching the query, or a random sample of limit companies.
+func companies(d database, ids []string, q *db.Query, limit int) ([]string, error) {
+	if len(ids) > 0 {
+		var cs []string
+		for _, id := range ids {
+			c, err := d.GetCompany(cnpj.Unmask(id), db.ProfileFull)
+			if err != nil {
+				return nil, fmt.Errorf("error getting company %s: %w", id, err)
+			}
+			cs = append(cs, c)
+		}
+		return cs, nil
+	}
+	if q == nil {
+		cs, err := d.Sample(context.Background(), limit)
+		if err != nil {
+			return nil, fmt.Errorf("error sampling companies: %w", err)
+		}
+		return cs, nil
+	}
+	q.Limit = uint32(limit)
+	s, err := d.Search(context.Background(), q)
+	if err != nil {
+		return nil, fmt.Errorf("error searching companies: %w", err)
+	}
+	var p struct {
+		Data []jsontext.Value `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(s), &p); err != nil {
+		return nil, fmt.Errorf("error parsing search results: %w", err)
+	}
+	var cs []string
+	for _, c := range p.Data {
+		cs = append(cs, string(c))
+	}
+	return cs, nil
+}
+
+// Fixtures writes one JSON file per company to dir: the companies with the
+// CNPJs in ids, or up to limit companies matching the query q (a random sample
+// if q is nil). With anon, names, contacts and addresses are replaced by
+// fictional ones (see anonymize).
+func Fixtures(d database, ids []string, q *db.Query, limit int, dir string, anon bool) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("could not create %s: %w", dir, err)
+	}
+	cs, err := companies(d, ids, q, limit)
+	if err != nil {
+		return err
+	}
+	if len(cs) == 0 {
+		return fmt.Errorf("no companies found")
+	}
+	for i, c := range cs {
+		if err := write(dir, strings.TrimSpace(c), i+1, anon); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package fixtures
+
+import (
+	"context"
+	"encoding/json/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+type fakeDB struct {
+	company string
+}
+
+func (f fakeDB) GetCompany(string, db.Profile) (string, error) { return f.company, nil }
+
+func (f fakeDB) Search(context.Context, *db.Query) (string, error) {
+	return `{"data":[` + f.company + `],"cursor":null}`, nil
+}
+
+func (f fakeDB) Sample(context.Context, int) ([]string, error) { return []string{f.company}, nil }
+
+func loadResponse(t *testing.T) string {
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestFixtures(t *testing.T) {
+	d := fakeDB{loadResponse(t)}
+	for _, tc := range []struct {
+		name string
+		ids  []string
+		q    *db.Query
+	}{
+		{"by cnpj", []string{"19.131.243/0001-97"}, nil},
+		{"by query", nil, &db.Query{UF: []string{"SP"}}},
+		{"at random", nil, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := Fixtures(d, tc.ids, tc.q, 1, dir, false); err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			b, err := os.ReadFile(filepath.Join(dir, "19131243000197.json"))
+			if err != nil {
+				t.Fatalf("expected fixture to be created, got %s", err)
+			}
+			if !strings.Contains(string(b), "HAYDEE SVAB") {
+				t.Errorf("expected partner name to be kept, got %s", string(b))
+			}
+		})
+	}
+}
+
+func TestFixturesAnonymized(t *testing.T) {
+	dir := t.TempDir()
+	if err := Fixtures(fakeDB{loadResponse(t)}, nil, nil, 1, dir, true); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "19131243000197.json"))
+	if err != nil {
+		t.Fatalf("expected fixture to be created, got %s", err)
+	}
+	var c map[string]any
+	if err := json.Unmarshal(b, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c["razao_social"] != "EMPRESA FICTICIA 1 LTDA" {
+		t.Errorf("expected razao_social to be anonymized, got %v", c["razao_social"])
+	}
+	p := c["qsa"].([]any)[0].(map[string]any)
+	if p["nome_socio"] != "SOCIO FICTICIO 1" {
+		t.Errorf("expected nome_socio to be anonymized, got %v", p["nome_socio"])
+	}
+	if p["cnpj_cpf_do_socio"] != maskedCPF {
+		t.Errorf("expected cnpj_cpf_do_socio to be masked, got %v", p["cnpj_cpf_do_socio"])
+	}
+	if c["cnae_fiscal"] == nil || c["uf"] != "SP" {
+		t.Errorf("expected codes and state to be kept, got %v and %v", c["cnae_fiscal"], c["uf"])
+	}
+}
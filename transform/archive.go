@@ -10,6 +10,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/cuducos/minha-receita/warnings"
 	"golang.org/x/text/encoding/charmap"
 )
 
@@ -73,6 +74,9 @@ func (a *archivedCSVs) read() ([]string, error) {
 		return []string{}, fmt.Errorf("error reading archived csv line from %s: %w", a.path, err)
 	}
 	for i := range ls {
+		if strings.ContainsRune(ls[i], '\x00') {
+			warnings.Add(warnings.Transform, "NUL characters removed", a.path)
+		}
 		ls[i] = multipleSpaces.ReplaceAllString(strings.Map(removeNulChar, ls[i]), " ")
 	}
 	return ls, nil
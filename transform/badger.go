@@ -4,6 +4,8 @@ import (
 	"encoding/json/v2"
 	"errors"
 	"fmt"
+	"log/slog"
+	"os"
 	"sort"
 
 	"github.com/cuducos/go-cnpj"
@@ -15,76 +17,138 @@ func keyForBase(n string) string        { return fmt.Sprintf("b-%s", n) }
 func keyForSimpleTaxes(n string) string { return fmt.Sprintf("st-%s", n) }
 func keyForTaxRegime(n string) string   { return fmt.Sprintf("tr-%s", cnpj.Unmask(n)) }
 
-func baseOf(db *badger.DB, n string) (baseData, error) {
-	var d baseData
-	err := db.View(func(txn *badger.Txn) error {
-		i, err := txn.Get([]byte(keyForBase(n)))
-		if errors.Is(err, badger.ErrKeyNotFound) {
-			return nil
-		}
-		if err != nil {
-			return fmt.Errorf("could not get key %s: %w", keyForBase(n), err)
-		}
-		v, err := i.ValueCopy(nil)
+type badgerEngine struct{ db *badger.DB }
+
+func (e *badgerEngine) get(k []byte) ([]byte, bool, error) {
+	var v []byte
+	err := e.db.View(func(txn *badger.Txn) error {
+		i, err := txn.Get(k)
 		if err != nil {
-			return fmt.Errorf("could not read value for key %s: %w", keyForBase(n), err)
+			return err
 		}
-		if err := json.Unmarshal(v, &d); err != nil {
-			return fmt.Errorf("could not parse base: %w", err)
+		v, err = i.ValueCopy(nil)
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return v, true, nil
+}
+
+func (e *badgerEngine) iterate(pre []byte, f func([]byte) error) error {
+	return e.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek(pre); it.ValidForPrefix(pre); it.Next() {
+			if err := it.Item().Value(f); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
-	if err != nil {
-		return baseData{}, fmt.Errorf("error getting base for %s: %w", n, err)
+}
+
+func (e *badgerEngine) set(k, v []byte) error {
+	return e.db.Update(func(tx *badger.Txn) error { return tx.Set(k, v) })
+}
+
+func (e *badgerEngine) setBatch(ks, vs [][]byte) error {
+	b := e.db.NewWriteBatch()
+	defer b.Cancel()
+	for n, k := range ks {
+		if err := b.Set(k, vs[n]); err != nil {
+			return err
+		}
 	}
-	return d, nil
+	return b.Flush()
 }
 
-func simpleTaxesOf(db *badger.DB, n string) (simpleTaxesData, error) {
-	var d simpleTaxesData
-	err := db.View(func(txn *badger.Txn) error {
-		i, err := txn.Get([]byte(keyForSimpleTaxes(n)))
-		if errors.Is(err, badger.ErrKeyNotFound) {
-			return nil
+func (e *badgerEngine) garbageCollect() {
+	for {
+		err := e.db.RunValueLogGC(0.5)
+		if err == badger.ErrRejected { // db already closed or more than one gc running
+			return
 		}
-		if err != nil {
-			return fmt.Errorf("could not get key %s: %w", keyForSimpleTaxes(n), err)
+		if err == badger.ErrNoRewrite { // no garbage to collect
+			return
 		}
-		v, err := i.ValueCopy(nil)
 		if err != nil {
-			return fmt.Errorf("could not read value for key %s: %w", keyForSimpleTaxes(n), err)
+			slog.Error("Error running garbage collection", "error", err)
+			return
 		}
-		if err := json.Unmarshal(v, &d); err != nil {
-			return fmt.Errorf("could not parse taxes: %w", err)
-		}
-		return nil
-	})
+	}
+}
+
+func (e *badgerEngine) close() error { return e.db.Close() }
+
+// newBadgerEngine opens a Badger storage. With a memory budget (in MB), the
+// memtables and caches are sized to fit in it instead of using Badger's
+// defaults (which easily use a few GB during the load).
+func newBadgerEngine(dir string, mem int) (*badgerEngine, error) {
+	opt := badger.DefaultOptions(dir)
+	if os.Getenv("DEBUG") == "" {
+		opt = opt.WithLogger(&noLogger{})
+	}
+	if mem > 0 {
+		b := int64(mem) << 20
+		opt = opt.
+			WithNumMemtables(2).
+			WithMemTableSize(b / 8).
+			WithNumLevelZeroTables(2).
+			WithNumLevelZeroTablesStall(4).
+			WithBlockCacheSize(b / 4).
+			WithIndexCacheSize(b / 8).
+			WithValueLogFileSize(min(b/4, 1<<30)).
+			WithNumCompactors(2)
+	}
+	db, err := badger.Open(opt)
 	if err != nil {
-		return simpleTaxesData{}, fmt.Errorf("error getting taxes for %s: %w", n, err)
+		return nil, fmt.Errorf("error creating badger key-value object: %w", err)
+	}
+	return &badgerEngine{db}, nil
+}
+
+func baseOf(db kvEngine, n string) (baseData, error) {
+	var d baseData
+	v, ok, err := db.get([]byte(keyForBase(n)))
+	if err != nil {
+		return baseData{}, fmt.Errorf("error getting base for %s: could not get key %s: %w", n, keyForBase(n), err)
+	}
+	if !ok {
+		return d, nil
+	}
+	if err := json.Unmarshal(v, &d); err != nil {
+		return baseData{}, fmt.Errorf("error getting base for %s: could not parse base: %w", n, err)
 	}
 	return d, nil
 }
 
-func taxRegimeOf(db *badger.DB, n string) (TaxRegimes, error) {
+func simpleTaxesOf(db kvEngine, n string) (simpleTaxesData, error) {
+	var d simpleTaxesData
+	v, ok, err := db.get([]byte(keyForSimpleTaxes(n)))
+	if err != nil {
+		return simpleTaxesData{}, fmt.Errorf("error getting taxes for %s: could not get key %s: %w", n, keyForSimpleTaxes(n), err)
+	}
+	if !ok {
+		return d, nil
+	}
+	if err := json.Unmarshal(v, &d); err != nil {
+		return simpleTaxesData{}, fmt.Errorf("error getting taxes for %s: could not parse taxes: %w", n, err)
+	}
+	return d, nil
+}
+
+func taxRegimeOf(db kvEngine, n string) (TaxRegimes, error) {
 	var ts TaxRegimes
-	pre := []byte(keyForTaxRegime(n))
-	err := db.View(func(txn *badger.Txn) error {
-		it := txn.NewIterator(badger.DefaultIteratorOptions)
-		defer it.Close()
-		for it.Seek(pre); it.ValidForPrefix(pre); it.Next() {
-			var t TaxRegime
-			i := it.Item()
-			err := i.Value(func(v []byte) error {
-				if err := json.Unmarshal(v, &t); err != nil {
-					return fmt.Errorf("could not parse tax regime: %w", err)
-				}
-				ts = append(ts, t)
-				return nil
-			})
-			if err != nil {
-				return err
-			}
+	err := db.iterate([]byte(keyForTaxRegime(n)), func(v []byte) error {
+		var t TaxRegime
+		if err := json.Unmarshal(v, &t); err != nil {
+			return fmt.Errorf("could not parse tax regime: %w", err)
 		}
+		ts = append(ts, t)
 		return nil
 	})
 	if err != nil {
@@ -94,26 +158,14 @@ func taxRegimeOf(db *badger.DB, n string) (TaxRegimes, error) {
 	return ts, nil
 }
 
-func partnersOf(db *badger.DB, n string) ([]PartnerData, error) {
+func partnersOf(db kvEngine, n string) ([]PartnerData, error) {
 	var ps []PartnerData
-	pre := []byte(keyForPartners(n))
-	err := db.View(func(txn *badger.Txn) error {
-		it := txn.NewIterator(badger.DefaultIteratorOptions)
-		defer it.Close()
-		for it.Seek(pre); it.ValidForPrefix(pre); it.Next() {
-			var p PartnerData
-			i := it.Item()
-			err := i.Value(func(v []byte) error {
-				if err := json.Unmarshal(v, &p); err != nil {
-					return fmt.Errorf("could not parse parter: %w", err)
-				}
-				ps = append(ps, p)
-				return nil
-			})
-			if err != nil {
-				return err
-			}
+	err := db.iterate([]byte(keyForPartners(n)), func(v []byte) error {
+		var p PartnerData
+		if err := json.Unmarshal(v, &p); err != nil {
+			return fmt.Errorf("could not parse parter: %w", err)
 		}
+		ps = append(ps, p)
 		return nil
 	})
 	if err != nil {
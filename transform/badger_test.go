@@ -4,19 +4,16 @@ import (
 	"encoding/json/v2"
 	"reflect"
 	"testing"
-
-	"github.com/dgraph-io/badger/v4"
 )
 
 const testBaseCNPJ = "12345678"
 
-func newTestBadgerDB(t *testing.T) *badger.DB {
-	opt := badger.DefaultOptions(t.TempDir())
-	db, err := badger.Open(opt)
+func newTestKVEngine(t *testing.T, e string) kvEngine {
+	kv, err := newKeyValueStorage(e, t.TempDir(), 0)
 	if err != nil {
-		t.Fatal("could not create a badger database")
+		t.Fatalf("could not create a %s database: %s", e, err)
 	}
-	return db
+	return kv.db
 }
 
 func toBytes(t *testing.T, i any) []byte {
@@ -27,18 +24,24 @@ func toBytes(t *testing.T, i any) []byte {
 	return b
 }
 
-func saveItem(t *testing.T, db *badger.DB, k string, v any) error {
-	return db.Update(func(tx *badger.Txn) error {
-		return tx.Set([]byte(k), toBytes(t, v))
-	})
+func saveItem(t *testing.T, db kvEngine, k string, v any) error {
+	return db.set([]byte(k), toBytes(t, v))
 }
 
 func TestReadItems(t *testing.T) {
+	for _, e := range KVEngines {
+		t.Run(e, func(t *testing.T) {
+			testReadItems(t, e)
+		})
+	}
+}
+
+func testReadItems(t *testing.T, e string) {
 	t.Run("partners", func(t *testing.T) {
 		p := newTestPartner()
-		db := newTestBadgerDB(t)
+		db := newTestKVEngine(t, e)
 		defer func() {
-			if err := db.Close(); err != nil {
+			if err := db.close(); err != nil {
 				t.Errorf("expected no error closing the database connection, got %s", err)
 			}
 		}()
@@ -59,9 +62,9 @@ func TestReadItems(t *testing.T) {
 	})
 
 	t.Run("base", func(t *testing.T) {
-		db := newTestBadgerDB(t)
+		db := newTestKVEngine(t, e)
 		defer func() {
-			if err := db.Close(); err != nil {
+			if err := db.close(); err != nil {
 				t.Errorf("expected no error closing the database connection, got %s", err)
 			}
 		}()
@@ -79,9 +82,9 @@ func TestReadItems(t *testing.T) {
 	})
 
 	t.Run("taxes", func(t *testing.T) {
-		db := newTestBadgerDB(t)
+		db := newTestKVEngine(t, e)
 		defer func() {
-			if err := db.Close(); err != nil {
+			if err := db.close(); err != nil {
 				t.Errorf("expected no error closing the database connection, got %s", err)
 			}
 		}()
@@ -97,5 +100,4 @@ func TestReadItems(t *testing.T) {
 			t.Errorf("expected %v, got %v", d, got)
 		}
 	})
-
 }
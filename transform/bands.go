@@ -0,0 +1,107 @@
+package transform
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// CapitalBands are the lower edges (inclusive) of the bands used to classify
+// the capital social of a company. Each band goes from its edge up to the next
+// one, and the last band has no upper limit.
+type CapitalBands []float64
+
+// DefaultCapitalBands is the default configuration of bands of capital social.
+var DefaultCapitalBands = CapitalBands{0, 10_000, 100_000, 1_000_000, 10_000_000}
+
+// ParseCapitalBands reads a comma-separated list of band edges.
+func ParseCapitalBands(s string) (CapitalBands, error) {
+	var bs CapitalBands
+	for v := range strings.SplitSeq(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid capital social band edge %s: %w", v, err)
+		}
+		bs = append(bs, f)
+	}
+	if err := bs.validate(); err != nil {
+		return nil, err
+	}
+	return bs, nil
+}
+
+func (bs CapitalBands) validate() error {
+	if len(bs) == 0 {
+		return fmt.Errorf("at least one capital social band edge is required")
+	}
+	if bs[0] < 0 {
+		return fmt.Errorf("capital social band edges cannot be negative, got %.2f", bs[0])
+	}
+	for i := 1; i < len(bs); i++ {
+		if bs[i] <= bs[i-1] {
+			return fmt.Errorf("capital social band edges must be in ascending order, got %.2f after %.2f", bs[i], bs[i-1])
+		}
+	}
+	return nil
+}
+
+// String is used as the flag representation of the bands.
+func (bs CapitalBands) String() string {
+	s := make([]string, len(bs))
+	for i, b := range bs {
+		s[i] = strconv.FormatFloat(b, 'f', -1, 64)
+	}
+	return strings.Join(s, ",")
+}
+
+// description uses the pt-BR currency format, e.g. "DE R$ 10.000,00 A R$
+// 99.999,99"
+func (bs CapitalBands) description(i int) string {
+	if i == len(bs)-1 {
+		return fmt.Sprintf("A PARTIR DE %s", formatBRL(bs[i]))
+	}
+	return fmt.Sprintf("DE %s A %s", formatBRL(bs[i]), formatBRL(bs[i+1]-0.01))
+}
+
+// band returns the code (starting at 1) and the description of the band of a
+// capital social value, or nil if the value is missing or below the first edge.
+func (bs CapitalBands) band(v *float32) (*int, *string) {
+	if v == nil || len(bs) == 0 || float64(*v) < bs[0] {
+		return nil, nil
+	}
+	i := len(bs) - 1
+	for i > 0 && float64(*v) < bs[i] {
+		i--
+	}
+	c := i + 1
+	d := bs.description(i)
+	return &c, &d
+}
+
+// formatBRL formats a value as Brazilian Real, e.g. "R$ 1.234,56".
+func formatBRL(v float64) string {
+	var sign string
+	if v < 0 {
+		sign = "-"
+		v = math.Abs(v)
+	}
+	s := strconv.FormatFloat(v, 'f', 2, 64)
+	n, d, _ := strings.Cut(s, ".")
+	var b strings.Builder
+	for i, c := range n {
+		if i > 0 && (len(n)-i)%3 == 0 {
+			b.WriteRune('.')
+		}
+		b.WriteRune(c)
+	}
+	return fmt.Sprintf("%sR$ %s,%s", sign, b.String(), d)
+}
+
+func (c *Company) faixaCapitalSocial(bs CapitalBands) {
+	c.CodigoFaixaCapitalSocial, c.FaixaCapitalSocial = bs.band(c.CapitalSocial)
+}
@@ -0,0 +1,76 @@
+package transform
+
+import "testing"
+
+func TestParseCapitalBands(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		valid bool
+	}{
+		{"0,10000,100000", true},
+		{" 0, 1000.5 ", true},
+		{"1000,10", false},
+		{"-1,10", false},
+		{"", false},
+		{"zero,10", false},
+	} {
+		t.Run(tc.value, func(t *testing.T) {
+			_, err := ParseCapitalBands(tc.value)
+			if tc.valid && err != nil {
+				t.Errorf("expected no error parsing %s, got %s", tc.value, err)
+			}
+			if !tc.valid && err == nil {
+				t.Errorf("expected error parsing %s, got nil", tc.value)
+			}
+		})
+	}
+}
+
+func TestCapitalBands(t *testing.T) {
+	bs := CapitalBands{1, 10_000, 1_000_000}
+	if c, d := bs.band(nil); c != nil || d != nil {
+		t.Errorf("expected no band for missing capital social, got %v %v", c, d)
+	}
+	for _, tc := range []struct {
+		value       float32
+		code        int
+		description string
+	}{
+		{0, 0, ""},
+		{1, 1, "DE R$ 1,00 A R$ 9.999,99"},
+		{9_999.99, 1, "DE R$ 1,00 A R$ 9.999,99"},
+		{10_000, 2, "DE R$ 10.000,00 A R$ 999.999,99"},
+		{1_061_004_800, 3, "A PARTIR DE R$ 1.000.000,00"},
+	} {
+		c, d := bs.band(&tc.value)
+		if tc.code == 0 {
+			if c != nil || d != nil {
+				t.Errorf("expected no band for %f, got %v %v", tc.value, c, d)
+			}
+			continue
+		}
+		if c == nil || *c != tc.code {
+			t.Errorf("expected band %d for %f, got %v", tc.code, tc.value, c)
+		}
+		if d == nil || *d != tc.description {
+			t.Errorf("expected description %s for %f, got %v", tc.description, tc.value, d)
+		}
+	}
+}
+
+func TestFormatBRL(t *testing.T) {
+	for _, tc := range []struct {
+		value    float64
+		expected string
+	}{
+		{0, "R$ 0,00"},
+		{999.9, "R$ 999,90"},
+		{1000, "R$ 1.000,00"},
+		{1_061_004_800, "R$ 1.061.004.800,00"},
+		{-1234.5, "-R$ 1.234,50"},
+	} {
+		if got := formatBRL(tc.value); got != tc.expected {
+			t.Errorf("expected %s for %f, got %s", tc.expected, tc.value, got)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package transform
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json/v2"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const cnpjLength = 14
+
+// checkpoints are saved in the key-value storage so a failed transform can be
+// resumed: source files completely loaded into the key-value storage are not
+// read again, and companies already saved to the database are skipped. Saved
+// companies are recorded once per batch (with all the CNPJs of the batch as the
+// value), and only expanded to a key per CNPJ when resuming, so a transform
+// that is not resumed does not pay for a lookup and a write per company.
+func keyForCheckpoint(p string) string { return fmt.Sprintf("cp-%s", filepath.Base(p)) }
+func keyForSaved(n string) string      { return fmt.Sprintf("s-%s", n) }
+func keyForSavedBatch(n string) string { return fmt.Sprintf("sb-%s", n) }
+
+type checkpoint struct {
+	Size int64 `json:"size"` // size of the source file, to detect a different file with the same name
+	Rows int64 `json:"rows"`
+}
+
+// kvPath is the key-value storage directory for a given data directory. It is
+// the same across runs so a failed transform can be resumed.
+func kvPath(dir string) (string, error) {
+	a, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("could not get absolute path of %s: %w", dir, err)
+	}
+	h := sha256.Sum256([]byte(a))
+	return filepath.Join(os.TempDir(), fmt.Sprintf("minha-receita-%s", hex.EncodeToString(h[:4]))), nil
+}
+
+func fileSize(p string) (int64, error) {
+	i, err := os.Stat(p)
+	if err != nil {
+		return 0, fmt.Errorf("could not get info about %s: %w", p, err)
+	}
+	return i.Size(), nil
+}
+
+// checkpointOf returns nil if the file was not completely loaded yet.
+func (kv *keyValueStorage) checkpointOf(p string) (*checkpoint, error) {
+	var c checkpoint
+	k := keyForCheckpoint(p)
+	v, ok, err := kv.db.get([]byte(k))
+	if err != nil {
+		return nil, fmt.Errorf("could not read checkpoint %s: %w", k, err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	if err := json.Unmarshal(v, &c); err != nil {
+		return nil, fmt.Errorf("could not parse checkpoint %s: %w", k, err)
+	}
+	s, err := fileSize(p)
+	if err != nil {
+		return nil, err
+	}
+	if s != c.Size {
+		return nil, nil
+	}
+	return &c, nil
+}
+
+func (kv *keyValueStorage) saveCheckpoint(p string, rows int64) error {
+	s, err := fileSize(p)
+	if err != nil {
+		return err
+	}
+	v, err := json.Marshal(checkpoint{s, rows})
+	if err != nil {
+		return fmt.Errorf("could not serialize checkpoint for %s: %w", p, err)
+	}
+	k := keyForCheckpoint(p)
+	if err := kv.db.set([]byte(k), v); err != nil {
+		return fmt.Errorf("could not save checkpoint %s: %w", k, err)
+	}
+	return nil
+}
+
+func (kv *keyValueStorage) isSaved(n string) (bool, error) {
+	_, ok, err := kv.db.get([]byte(keyForSaved(n)))
+	if err != nil {
+		return false, fmt.Errorf("could not check if %s was saved: %w", n, err)
+	}
+	return ok, nil
+}
+
+// markSaved records a batch as saved, under the first CNPJ of the batch (each
+// CNPJ belongs to a single batch).
+func (kv *keyValueStorage) markSaved(ns []string) error {
+	if len(ns) == 0 {
+		return nil
+	}
+	if err := kv.db.set([]byte(keyForSavedBatch(ns[0])), []byte(strings.Join(ns, ""))); err != nil {
+		return fmt.Errorf("could not mark batch as saved: %w", err)
+	}
+	return nil
+}
+
+// expandSaved records a key per CNPJ of the batches saved by previous runs, so
+// isSaved can find them. It returns the number of companies saved.
+func (kv *keyValueStorage) expandSaved() (int, error) {
+	var n int
+	err := kv.db.iterate([]byte("sb-"), func(v []byte) error {
+		if len(v)%cnpjLength != 0 {
+			return fmt.Errorf("invalid checkpoint of saved batch %q", v)
+		}
+		ks := make([][]byte, 0, len(v)/cnpjLength)
+		for i := 0; i < len(v); i += cnpjLength {
+			ks = append(ks, []byte(keyForSaved(string(v[i:i+cnpjLength]))))
+		}
+		n += len(ks)
+		return kv.db.setBatch(ks, make([][]byte, len(ks)))
+	})
+	if err != nil {
+		return 0, fmt.Errorf("could not read the checkpoints of saved companies: %w", err)
+	}
+	return n, nil
+}
+
+// KeyValuePath is the directory of the key-value storage used by the
+// transform of the files in dir, kept between runs so a failed transform can
+// be resumed.
+func KeyValuePath(dir string) (string, error) { return kvPath(dir) }
@@ -0,0 +1,140 @@
+package transform
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpoints(t *testing.T) {
+	kv, err := newKeyValueStorage(BadgerKVEngine, t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("expected no error creating badger, got %s", err)
+	}
+	defer func() {
+		if err := kv.close(); err != nil {
+			t.Errorf("expected no error closing key-value storage, got %s", err)
+		}
+	}()
+	pth := filepath.Join(testdata, "Simples.zip")
+	c, err := kv.checkpointOf(pth)
+	if err != nil {
+		t.Errorf("expected no error reading checkpoint, got %s", err)
+	}
+	if c != nil {
+		t.Errorf("expected no checkpoint before loading, got %v", c)
+	}
+	l, err := newLookups(testdata)
+	if err != nil {
+		t.Fatalf("expected no errors creating look up tables, got %v", err)
+	}
+	if err := kv.load(testdata, &l, 1024); err != nil {
+		t.Fatalf("expected no error loading values to badger, got %s", err)
+	}
+	c, err = kv.checkpointOf(pth)
+	if err != nil {
+		t.Errorf("expected no error reading checkpoint, got %s", err)
+	}
+	if c == nil {
+		t.Fatal("expected a checkpoint after loading, got nil")
+	}
+	if c.Rows == 0 {
+		t.Errorf("expected checkpoint to have rows, got %d", c.Rows)
+	}
+	if err := kv.load(testdata, &l, 1024); err != nil {
+		t.Errorf("expected no error loading values to badger again, got %s", err)
+	}
+}
+
+func TestMarkSaved(t *testing.T) {
+	kv, err := newKeyValueStorage(BadgerKVEngine, t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("expected no error creating badger, got %s", err)
+	}
+	defer func() {
+		if err := kv.close(); err != nil {
+			t.Errorf("expected no error closing key-value storage, got %s", err)
+		}
+	}()
+	if err := kv.markSaved([]string{"33683111000280", "00000000000191"}); err != nil {
+		t.Errorf("expected no error marking as saved, got %s", err)
+	}
+	if ok, err := kv.isSaved("33683111000280"); err != nil || ok {
+		t.Errorf("expected saved batches not to be expanded before resuming, got %t (%v)", ok, err)
+	}
+	n, err := kv.expandSaved()
+	if err != nil {
+		t.Errorf("expected no error expanding saved batches, got %s", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 saved companies, got %d", n)
+	}
+	for _, tc := range []struct {
+		cnpj     string
+		expected bool
+	}{
+		{"33683111000280", true},
+		{"00000000000191", true},
+		{"19131243000197", false},
+	} {
+		got, err := kv.isSaved(tc.cnpj)
+		if err != nil {
+			t.Errorf("expected no error checking %s, got %s", tc.cnpj, err)
+		}
+		if got != tc.expected {
+			t.Errorf("expected %s saved to be %t, got %t", tc.cnpj, tc.expected, got)
+		}
+	}
+}
+
+func TestTaskRunResume(t *testing.T) {
+	kv, err := newKeyValueStorage(BadgerKVEngine, t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("expected no error creating badger, got %s", err)
+	}
+	defer func() {
+		if err := kv.close(); err != nil {
+			t.Errorf("expected no error closing key-value storage, got %s", err)
+		}
+	}()
+	l, err := newLookups(testdata)
+	if err != nil {
+		t.Fatalf("expected no errors creating look up tables, got %v", err)
+	}
+	if err := kv.load(testdata, &l, 1024); err != nil {
+		t.Fatalf("expected no error loading values to badger, got %s", err)
+	}
+	first := newTestDB()
+	r, err := createJSONRecordsTask(testdata, first, &l, kv, 2, false, DefaultCapitalBands)
+	if err != nil {
+		t.Fatalf("expected no error creating task, got %s", err)
+	}
+	if err = r.run(2); err != nil {
+		t.Fatalf("expected no error running task, got %s", err)
+	}
+	if len(first.cnpj.data) == 0 {
+		t.Fatal("expected companies to be saved in the first run, got none")
+	}
+	again := newTestDB()
+	r, err = createJSONRecordsTask(testdata, again, &l, kv, 2, false, DefaultCapitalBands)
+	if err != nil {
+		t.Fatalf("expected no error creating task, got %s", err)
+	}
+	if err = r.run(2); err != nil {
+		t.Errorf("expected no error running task again, got %s", err)
+	}
+	if len(again.cnpj.data) != len(first.cnpj.data) {
+		t.Errorf("expected companies to be saved again without resume, got %d", len(again.cnpj.data))
+	}
+	second := newTestDB()
+	r, err = createJSONRecordsTask(testdata, second, &l, kv, 2, false, DefaultCapitalBands)
+	if err != nil {
+		t.Fatalf("expected no error creating task, got %s", err)
+	}
+	r.resume = true
+	if err = r.run(2); err != nil {
+		t.Errorf("expected no error resuming task, got %s", err)
+	}
+	if len(second.cnpj.data) != 0 {
+		t.Errorf("expected no companies to be saved again, got %d", len(second.cnpj.data))
+	}
+}
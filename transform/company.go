@@ -59,6 +59,8 @@ type Company struct {
 	NaturezaJuridica                 *string       `json:"natureza_juridica" bson:"natureza_juridica"`
 	QualificacaoDoResponsavel        *int          `json:"qualificacao_do_responsavel" bson:"qualificacao_do_responsavel"`
 	CapitalSocial                    *float32      `json:"capital_social" bson:"capital_social"`
+	CodigoFaixaCapitalSocial         *int          `json:"codigo_faixa_capital_social" bson:"codigo_faixa_capital_social"`
+	FaixaCapitalSocial               *string       `json:"faixa_capital_social" bson:"faixa_capital_social"`
 	CodigoPorte                      *int          `json:"codigo_porte" bson:"codigo_porte"`
 	Porte                            *string       `json:"porte" bson:"porte"`
 	EnteFederativoResponsavel        string        `json:"ente_federativo_responsavel" bson:"ente_federativo_responsavel"`
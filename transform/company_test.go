@@ -108,7 +108,7 @@ func TestNewCompany(t *testing.T) {
 	}
 
 	t.Run("with privacy", func(t *testing.T) {
-		kv, err := newBadgerStorage(t.TempDir(), false)
+		kv, err := newKeyValueStorage(BadgerKVEngine, t.TempDir(), 0)
 		if err != nil {
 			t.Errorf("expected no error creating badger, got %s", err)
 		}
@@ -263,7 +263,7 @@ func TestNewCompany(t *testing.T) {
 		}
 	})
 	t.Run("without privacy", func(t *testing.T) {
-		kv, err := newBadgerStorage(t.TempDir(), false)
+		kv, err := newKeyValueStorage(BadgerKVEngine, t.TempDir(), 0)
 		if err != nil {
 			t.Errorf("expected no error creating badger, got %s", err)
 		}
@@ -330,6 +330,7 @@ func TestCompanyJSONFields(t *testing.T) {
 		"cnaes_secundarios.codigo",
 		"cnaes_secundarios.descricao",
 		"cnpj",
+		"codigo_faixa_capital_social",
 		"codigo_municipio",
 		"codigo_municipio_ibge",
 		"codigo_natureza_juridica",
@@ -352,6 +353,7 @@ func TestCompanyJSONFields(t *testing.T) {
 		"descricao_tipo_de_logradouro",
 		"email",
 		"ente_federativo_responsavel",
+		"faixa_capital_social",
 		"identificador_matriz_filial",
 		"logradouro",
 		"motivo_situacao_cadastral",
@@ -0,0 +1,35 @@
+package transform
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"log/slog"
+)
+
+// DictionariesKey is the metadata key with the dictionaries used to describe
+// the codes in the companies (CNAEs, cities, countries etc.), so clients can
+// sync this reference data without the source files.
+const DictionariesKey = "dictionaries"
+
+// dictionaries maps the name of each dictionary to its codes and
+// descriptions. The names are the ones in the bundle served by the API.
+func (l *lookups) dictionaries() map[string]lookup {
+	return map[string]lookup{
+		"cnaes":               l.cnaes,
+		"motivos":             l.motives,
+		"municipios":          l.cities,
+		"municipios_ibge":     l.ibge,
+		"naturezas_juridicas": l.natures,
+		"paises":              l.countries,
+		"qualificacoes":       l.qualifications,
+	}
+}
+
+func saveDictionaries(db metaStore, l *lookups) error {
+	b, err := json.Marshal(l.dictionaries(), json.Deterministic(true))
+	if err != nil {
+		return fmt.Errorf("could not serialize the dictionaries: %w", err)
+	}
+	slog.Info("Saving the dictionaries to the database…")
+	return db.MetaSave(DictionariesKey, string(b))
+}
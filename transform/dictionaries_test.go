@@ -0,0 +1,34 @@
+package transform
+
+import (
+	"encoding/json/v2"
+	"testing"
+)
+
+func TestSaveDictionaries(t *testing.T) {
+	l, err := newLookups(testdata)
+	if err != nil {
+		t.Fatalf("expected no error creating the lookups, got %s", err)
+	}
+	db := newTestDB()
+	if err := saveDictionaries(db, &l); err != nil {
+		t.Fatalf("expected no error saving the dictionaries, got %s", err)
+	}
+	v, err := db.MetaRead(DictionariesKey)
+	if err != nil {
+		t.Fatalf("expected the dictionaries in the metadata, got %s", err)
+	}
+	var got map[string]map[string]string
+	if err := json.Unmarshal([]byte(v), &got); err != nil {
+		t.Fatalf("expected the dictionaries to be a valid JSON, got %s", err)
+	}
+	if len(got) != 7 {
+		t.Errorf("expected 7 dictionaries, got %d", len(got))
+	}
+	if got["municipios_ibge"]["9701"] != "5300108" {
+		t.Errorf("expected the ibge code of 9701 to be 5300108, got %s", got["municipios_ibge"]["9701"])
+	}
+	if got["paises"]["367"] != "Inglaterra" {
+		t.Errorf("expected country 367 to be Inglaterra, got %s", got["paises"]["367"])
+	}
+}
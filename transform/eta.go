@@ -0,0 +1,212 @@
+package transform
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// durations of the stages of previous runs are saved in the meta table, so the
+// progress output can estimate how long the transform still takes
+const (
+	stageDurationsKey = "stage-durations"
+	maxStageRuns      = 5
+	etaRefresh        = 5 * time.Second
+)
+
+const (
+	keyValueStage = "key-value"
+	jsonStage     = "json"
+	postLoadStage = "post-load"
+)
+
+var stages = [...]string{keyValueStage, jsonStage, postLoadStage}
+
+type stageRun struct {
+	Seconds float64 `json:"seconds"`
+	Total   int64   `json:"total"` // items processed, 0 for stages without a progress bar
+}
+
+// eta estimates the time remaining for the whole transform using the average
+// of the previous runs for each stage. A nil eta makes no estimates.
+type eta struct {
+	sync.Mutex
+	history map[string][]stageRun
+	runs    map[string]stageRun
+	stage   int
+	total   int64
+	started time.Time
+}
+
+func newETA(m metaStore) *eta {
+	e := eta{history: make(map[string][]stageRun), runs: make(map[string]stageRun), stage: -1}
+	v, err := m.MetaRead(stageDurationsKey)
+	if err != nil {
+		slog.Debug("No durations of previous transforms", "error", err)
+		return &e
+	}
+	if err := json.Unmarshal([]byte(v), &e.history); err != nil {
+		slog.Warn("Could not parse durations of previous transforms", "error", err)
+	}
+	return &e
+}
+
+// average returns the average duration and total of the previous runs of a
+// stage, or false if there are none.
+func (e *eta) average(s string) (stageRun, bool) {
+	rs := e.history[s]
+	if len(rs) == 0 {
+		return stageRun{}, false
+	}
+	var a stageRun
+	for _, r := range rs {
+		a.Seconds += r.Seconds
+		a.Total += r.Total
+	}
+	a.Seconds /= float64(len(rs))
+	a.Total /= int64(len(rs))
+	return a, true
+}
+
+func (e *eta) start(s string, total int64) {
+	if e == nil {
+		return
+	}
+	e.Lock()
+	defer e.Unlock()
+	for i, n := range stages {
+		if n == s {
+			e.stage = i
+		}
+	}
+	e.total = total
+	e.started = time.Now()
+	if d, ok := e.remainingFor(0, e.started); ok {
+		slog.Info(fmt.Sprintf("Estimated time remaining for the transform: %s", formatETA(d)))
+	}
+}
+
+func (e *eta) finish() {
+	if e == nil {
+		return
+	}
+	e.Lock()
+	defer e.Unlock()
+	if e.stage < 0 {
+		return
+	}
+	e.runs[stages[e.stage]] = stageRun{time.Since(e.started).Seconds(), e.total}
+}
+
+// remainingFor expects the lock to be held.
+func (e *eta) remainingFor(done int64, now time.Time) (time.Duration, bool) {
+	if e.stage < 0 {
+		return 0, false
+	}
+	var r float64
+	el := now.Sub(e.started).Seconds()
+	a, ok := e.average(stages[e.stage])
+	switch {
+	case ok && a.Total > 0 && e.total > 0: // historical speed per item
+		r = a.Seconds / float64(a.Total) * float64(e.total-done)
+	case ok:
+		r = a.Seconds - el
+	case done > 0 && e.total > 0: // no history, use the speed of this run
+		r = el / float64(done) * float64(e.total-done)
+	default:
+		return 0, false
+	}
+	for _, s := range stages[e.stage+1:] {
+		a, ok := e.average(s)
+		if !ok {
+			return 0, false
+		}
+		r += a.Seconds
+	}
+	return time.Duration(max(r, 0) * float64(time.Second)), true
+}
+
+func (e *eta) remaining(done int64) (time.Duration, bool) {
+	if e == nil {
+		return 0, false
+	}
+	e.Lock()
+	defer e.Unlock()
+	return e.remainingFor(done, time.Now())
+}
+
+// follow keeps the description of the progress bar updated with the time
+// remaining until stop is called.
+func (e *eta) follow(bar *progressbar.ProgressBar, label string) (stop func()) {
+	if e == nil {
+		return func() {}
+	}
+	t := time.NewTicker(etaRefresh)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if d, ok := e.remaining(bar.State().CurrentNum); ok {
+					bar.Describe(fmt.Sprintf("%s (transform ~%s remaining)", label, formatETA(d)))
+				}
+			}
+		}
+	}()
+	return func() {
+		t.Stop()
+		close(done)
+	}
+}
+
+// save appends the durations of this run to the ones of the previous runs.
+func (e *eta) save(m metaStore) error {
+	if e == nil {
+		return nil
+	}
+	e.Lock()
+	defer e.Unlock()
+	for s, r := range e.runs {
+		rs := append(e.history[s], r)
+		e.history[s] = rs[max(len(rs)-maxStageRuns, 0):]
+	}
+	b, err := json.Marshal(e.history)
+	if err != nil {
+		return fmt.Errorf("could not serialize stage durations: %w", err)
+	}
+	return m.MetaSave(stageDurationsKey, string(b))
+}
+
+// mergeStageDurations appends the durations in v (as saved by save in another
+// metadata store) to the ones saved in m.
+func mergeStageDurations(m metaStore, v string) error {
+	var h map[string][]stageRun
+	if err := json.Unmarshal([]byte(v), &h); err != nil {
+		return fmt.Errorf("could not parse stage durations: %w", err)
+	}
+	e := newETA(m)
+	for s, rs := range h {
+		rs = append(e.history[s], rs...)
+		e.history[s] = rs[max(len(rs)-maxStageRuns, 0):]
+	}
+	return e.save(m)
+}
+
+func formatETA(d time.Duration) string {
+	if d < time.Minute {
+		return "<1m"
+	}
+	d = d.Round(time.Minute)
+	h := d / time.Hour
+	m := (d % time.Hour) / time.Minute
+	if h == 0 {
+		return fmt.Sprintf("%dm", m)
+	}
+	return fmt.Sprintf("%dh%02dm", h, m)
+}
@@ -0,0 +1,114 @@
+package transform
+
+import (
+	"encoding/json/v2"
+	"testing"
+	"time"
+)
+
+func TestETA(t *testing.T) {
+	db := newTestDB()
+	t.Run("without history", func(t *testing.T) {
+		e := newETA(db)
+		e.start(keyValueStage, 100)
+		if _, ok := e.remaining(0); ok {
+			t.Error("expected no estimate without history and progress")
+		}
+		e.started = time.Now().Add(-10 * time.Second)
+		if _, ok := e.remaining(50); ok {
+			t.Error("expected no estimate without history for the next stages")
+		}
+	})
+	t.Run("with history", func(t *testing.T) {
+		h := map[string][]stageRun{
+			keyValueStage: {{Seconds: 100, Total: 1000}, {Seconds: 300, Total: 1000}},
+			jsonStage:     {{Seconds: 600, Total: 10}},
+			postLoadStage: {{Seconds: 60}},
+		}
+		b, err := json.Marshal(h)
+		if err != nil {
+			t.Fatalf("could not serialize history: %s", err)
+		}
+		if err := db.MetaSave(stageDurationsKey, string(b)); err != nil {
+			t.Fatalf("could not save history: %s", err)
+		}
+		e := newETA(db)
+		e.start(keyValueStage, 2000)
+		got, ok := e.remaining(1000)
+		if !ok {
+			t.Fatal("expected an estimate")
+		}
+		if exp := 860 * time.Second; got != exp { // 1000 items at 0.2s each + 600s + 60s
+			t.Errorf("expected %s remaining, got %s", exp, got)
+		}
+		e.finish()
+		e.start(postLoadStage, 0)
+		e.started = time.Now().Add(-20 * time.Second)
+		got, ok = e.remaining(0)
+		if !ok {
+			t.Fatal("expected an estimate")
+		}
+		if got < 39*time.Second || got > 40*time.Second {
+			t.Errorf("expected ~40s remaining, got %s", got)
+		}
+		e.finish()
+		if err := e.save(db); err != nil {
+			t.Fatalf("expected no error saving durations, got %s", err)
+		}
+		v, err := db.MetaRead(stageDurationsKey)
+		if err != nil {
+			t.Fatalf("expected no error reading durations, got %s", err)
+		}
+		var saved map[string][]stageRun
+		if err := json.Unmarshal([]byte(v), &saved); err != nil {
+			t.Fatalf("could not parse saved durations: %s", err)
+		}
+		if len(saved[keyValueStage]) != 3 {
+			t.Errorf("expected 3 runs of %s, got %d", keyValueStage, len(saved[keyValueStage]))
+		}
+		if len(saved[jsonStage]) != 1 {
+			t.Errorf("expected 1 run of %s, got %d", jsonStage, len(saved[jsonStage]))
+		}
+		if len(saved[postLoadStage]) != 2 {
+			t.Errorf("expected 2 runs of %s, got %d", postLoadStage, len(saved[postLoadStage]))
+		}
+	})
+	t.Run("nil", func(t *testing.T) {
+		var e *eta
+		e.start(jsonStage, 42)
+		e.finish()
+		if _, ok := e.remaining(1); ok {
+			t.Error("expected no estimate from nil eta")
+		}
+	})
+}
+
+func TestFormatETA(t *testing.T) {
+	for _, tc := range []struct {
+		d        time.Duration
+		expected string
+	}{
+		{30 * time.Second, "<1m"},
+		{42 * time.Minute, "42m"},
+		{2*time.Hour + 15*time.Minute + 10*time.Second, "2h15m"},
+		{26*time.Hour + 5*time.Minute, "26h05m"},
+	} {
+		if got := formatETA(tc.d); got != tc.expected {
+			t.Errorf("expected %s to be formatted as %s, got %s", tc.d, tc.expected, got)
+		}
+	}
+}
+
+func TestMaxStageRuns(t *testing.T) {
+	db := newTestDB()
+	e := newETA(db)
+	for range maxStageRuns + 2 {
+		e.runs = map[string]stageRun{jsonStage: {Seconds: 1, Total: 1}}
+		if err := e.save(db); err != nil {
+			t.Fatalf("expected no error saving durations, got %s", err)
+		}
+	}
+	if got := len(e.history[jsonStage]); got != maxStageRuns {
+		t.Errorf("expected %d runs, got %d", maxStageRuns, got)
+	}
+}
@@ -0,0 +1,97 @@
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// fanOut writes the same data to many databases in a single transform, so the
+// source files and the key-value storage are read only once. Reads come from
+// the first database, the main one.
+type fanOut []database
+
+// FanOut combines the main database with other ones that should receive the
+// same data. Without other databases, it returns the main database as is.
+func FanOut[T database](main T, others ...T) database {
+	if len(others) == 0 {
+		return main
+	}
+	f := fanOut{main}
+	for _, db := range others {
+		f = append(f, db)
+	}
+	return f
+}
+
+// targetsOf returns the databases a transform writes to.
+func targetsOf(db database) []database {
+	if f, ok := db.(fanOut); ok {
+		return f
+	}
+	return []database{db}
+}
+
+func (f fanOut) each(fn func(database) error) error {
+	var errs []error
+	for i, db := range f {
+		if err := fn(db); err != nil {
+			errs = append(errs, fmt.Errorf("database #%d: %w", i+1, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f fanOut) PreLoad() error  { return f.each(func(db database) error { return db.PreLoad() }) }
+func (f fanOut) PostLoad() error { return f.each(func(db database) error { return db.PostLoad() }) }
+func (f fanOut) SaveEvents() error {
+	return f.each(func(db database) error { return db.SaveEvents() })
+}
+
+func (f fanOut) CreateExtraIndexes(idxs []string) error {
+	return f.each(func(db database) error { return db.CreateExtraIndexes(idxs) })
+}
+
+func (f fanOut) MetaSave(k, v string) error {
+	return f.each(func(db database) error { return db.MetaSave(k, v) })
+}
+
+// targetsError tells which databases of a fan-out failed to save a batch, by
+// their position (the main database being 0), so the quarantine replays the
+// batch only to them: the others already have these companies.
+type targetsError struct {
+	targets []int
+	err     error
+}
+
+func (e *targetsError) Error() string { return e.err.Error() }
+func (e *targetsError) Unwrap() error { return e.err }
+
+// CreateCompanies sends the batch to all databases at the same time, so the
+// slowest one sets the pace.
+func (f fanOut) CreateCompanies(b [][]string) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(f))
+	for i, db := range f {
+		wg.Go(func() {
+			if err := db.CreateCompanies(b); err != nil {
+				errs[i] = fmt.Errorf("database #%d: %w", i+1, err)
+			}
+		})
+	}
+	wg.Wait()
+	var ts []int
+	for i, err := range errs {
+		if err != nil {
+			ts = append(ts, i)
+		}
+	}
+	if len(ts) == 0 {
+		return nil
+	}
+	return &targetsError{ts, errors.Join(errs...)}
+}
+
+func (f fanOut) MetaRead(k string) (string, error) { return f[0].MetaRead(k) }
+
+func (f fanOut) RowCounts() (map[string]int64, error) { return f[0].RowCounts() }
@@ -0,0 +1,39 @@
+package transform
+
+import "testing"
+
+func TestFanOut(t *testing.T) {
+	main, other := newTestDB(), newTestDB()
+	if db := FanOut(main); db != database(main) {
+		t.Errorf("expected the main database without other databases, got %v", db)
+	}
+	db := FanOut(main, other)
+	if err := db.CreateCompanies([][]string{{"33683111000280", "{}"}}); err != nil {
+		t.Fatalf("expected no error creating companies, got %s", err)
+	}
+	for i, d := range []inMemoryDB{main, other} {
+		if _, err := d.GetCompany("33683111000280"); err != nil {
+			t.Errorf("expected the company in database #%d, got %s", i+1, err)
+		}
+	}
+	if err := db.MetaSave("answer", "42"); err != nil {
+		t.Fatalf("expected no error saving metadata, got %s", err)
+	}
+	if v, err := other.MetaRead("answer"); err != nil || v != "42" {
+		t.Errorf("expected metadata in the other database, got %q (%v)", v, err)
+	}
+	c := newRowCounts()
+	c.add("33683111000280")
+	if err := reconcileRowCounts(db, c); err != nil {
+		t.Errorf("expected no error reconciling row counts, got %s", err)
+	}
+	if err := other.CreateCompanies([][]string{{"19131243000197", "{}"}}); err != nil {
+		t.Fatalf("expected no error creating companies, got %s", err)
+	}
+	if err := reconcileRowCounts(db, c); err == nil {
+		t.Error("expected an error reconciling row counts with an extra company in the other database")
+	}
+	if err := FanOut[database](main, failingDB{newTestDB()}).CreateCompanies([][]string{{"19131243000197", "{}"}}); err == nil {
+		t.Error("expected an error when one of the databases fails")
+	}
+}
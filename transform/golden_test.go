@@ -0,0 +1,119 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json/jsontext"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// run `go test ./transform -run TestGolden -update` after changing the JSON
+// output on purpose, and review the diff of the golden files
+var update = flag.Bool("update", false, "update the golden files with the output of the transform")
+
+var golden = filepath.Join(testdata, "golden")
+
+// goldenOf formats a company JSON as it is saved in the golden files:
+// indented, so the diffs are readable, but otherwise byte-for-byte what the
+// transform sends to the database.
+func goldenOf(t *testing.T, s string) []byte {
+	v := jsontext.Value(s)
+	if err := v.Indent(); err != nil {
+		t.Fatalf("expected valid json, got %s: %s", err, s)
+	}
+	return append(v, '\n')
+}
+
+// firstDiff returns the first line that differs, to make failures readable.
+func firstDiff(a, b []byte) string {
+	as, bs := strings.Split(string(a), "\n"), strings.Split(string(b), "\n")
+	for i := range max(len(as), len(bs)) {
+		var x, y string
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		if x != y {
+			return fmt.Sprintf("line %d: expected %s, got %s", i+1, strings.TrimSpace(x), strings.TrimSpace(y))
+		}
+	}
+	return ""
+}
+
+func TestGolden(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		privacy bool
+	}{
+		{"privacy", true},
+		{"no-privacy", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newTestDB()
+			if err := Transform(testdata, db, 2, 2, 2, tc.privacy, DefaultCapitalBands, false, BadgerKVEngine, 0, t.TempDir()); err != nil {
+				t.Fatalf("expected no error transforming the sample data, got %s", err)
+			}
+			dir := filepath.Join(golden, tc.name)
+			if *update {
+				updateGolden(t, dir, db.cnpj.data)
+				return
+			}
+			compareGolden(t, dir, db.cnpj.data)
+		})
+	}
+}
+
+func updateGolden(t *testing.T, dir string, cs map[string]string) {
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for n, s := range cs {
+		if err := os.WriteFile(filepath.Join(dir, n+".json"), goldenOf(t, s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Logf("%d golden files updated in %s", len(cs), dir)
+}
+
+func compareGolden(t *testing.T, dir string, cs map[string]string) {
+	ls, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) == 0 {
+		t.Fatalf("no golden files in %s (run with -update to create them)", dir)
+	}
+	var expected []string
+	for _, pth := range ls {
+		expected = append(expected, strings.TrimSuffix(filepath.Base(pth), ".json"))
+	}
+	for n := range cs {
+		if !slices.Contains(expected, n) {
+			t.Errorf("company %s is not in the golden files (run with -update if it is expected)", n)
+		}
+	}
+	for _, n := range expected {
+		s, ok := cs[n]
+		if !ok {
+			t.Errorf("expected company %s to be created", n)
+			continue
+		}
+		want, err := os.ReadFile(filepath.Join(dir, n+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := goldenOf(t, s); !bytes.Equal(got, want) {
+			t.Errorf("company %s differs from the golden file (run with -update if it is expected), %s", n, firstDiff(want, got))
+		}
+	}
+}
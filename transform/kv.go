@@ -7,12 +7,12 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
-	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cuducos/go-cnpj"
-	"github.com/dgraph-io/badger/v4"
 	"github.com/schollz/progressbar/v3"
 	"golang.org/x/sync/errgroup"
 )
@@ -68,82 +68,114 @@ func newKVItem(s sourceType, l *lookups, r []string) (i item, err error) {
 	return i, nil
 }
 
-type badgerStorage struct {
-	db   *badger.DB
-	path string
+const (
+	// BadgerKVEngine is the default key-value engine, faster when there is
+	// plenty of memory
+	BadgerKVEngine = "badger"
+
+	// PebbleKVEngine is the alternative key-value engine, more predictable
+	// with a small memory budget
+	PebbleKVEngine = "pebble"
+)
+
+// KVEngines lists the key-value engines available for the transform.
+var KVEngines = []string{BadgerKVEngine, PebbleKVEngine}
+
+// kvEngine is the low-level key-value storage used by the transform.
+type kvEngine interface {
+	get([]byte) ([]byte, bool, error)         // false if the key does not exist
+	iterate([]byte, func([]byte) error) error // values of keys with a prefix, in key order
+	set([]byte, []byte) error
+	setBatch([][]byte, [][]byte) error
+	garbageCollect()
+	close() error
 }
 
-func (kv *badgerStorage) garbageCollect() {
-	for {
-		err := kv.db.RunValueLogGC(0.5)
-		if err == badger.ErrRejected { // db already closed or more than one gc running
-			return
-		}
-		if err == badger.ErrNoRewrite { // no garbage to collect
-			return
-		}
-		if err != nil {
-			slog.Error("Error running garbage collection", "error", err)
-			return
-		}
-	}
+type keyValueStorage struct {
+	db   kvEngine
+	path string
+	eta  *eta
 }
 
-func (kv *badgerStorage) loadRow(r []string, s sourceType, l *lookups) error {
+func (kv *keyValueStorage) loadRow(r []string, s sourceType, l *lookups) error {
 	i, err := newKVItem(s, l, r)
 	if err != nil {
 		return fmt.Errorf("error creating an %s item: %w", s, err)
 	}
-	if err := kv.db.Update(func(tx *badger.Txn) error { return tx.Set(i.key, i.value) }); err != nil {
+	if err := kv.db.set(i.key, i.value); err != nil {
 		return fmt.Errorf("could not save key-value: %w", err)
 	}
 	return nil
 }
 
-func (kv *badgerStorage) loadSource(ctx context.Context, s *source, l *lookups, bar *progressbar.ProgressBar, m int) error {
-	g, ctx := errgroup.WithContext(ctx)
-	g.SetLimit(m)
+// loadFile loads a single source file using the writers group, recording a
+// checkpoint when it is done (and skipping it if it has a checkpoint already).
+func (kv *keyValueStorage) loadFile(ctx context.Context, a *archivedCSVs, s sourceType, l *lookups, bar *progressbar.ProgressBar, w *errgroup.Group) error {
+	c, err := kv.checkpointOf(a.path)
+	if err != nil {
+		return err
+	}
+	if c != nil {
+		slog.Debug("Skipping file already loaded", "path", a.path)
+		return bar.Add64(c.Rows)
+	}
+	var rows atomic.Int64
+	var wg sync.WaitGroup
 	ch := make(chan []string)
-	g.Go(func() error {
+	errs := make(chan error, 1)
+	go func() {
 		defer close(ch)
-		err := s.sendTo(ctx, ch)
-		if err == io.EOF {
-			return nil
+		if err := a.sendTo(ctx, ch); err != nil && err != io.EOF {
+			errs <- err
 		}
-		return err
-	})
-	g.Go(func() error {
-		for {
-			select {
-			case <-ctx.Done():
-				return nil
-			case r, ok := <-ch:
-				if !ok {
-					return nil
-				}
-				g.Go(func() error {
-					if err := kv.loadRow(r, s.kind, l); err != nil {
-						return err
-					}
-					return bar.Add(1)
-				})
+	}()
+	for r := range ch {
+		if ctx.Err() != nil {
+			continue
+		}
+		wg.Add(1)
+		w.Go(func() error {
+			defer wg.Done()
+			if err := kv.loadRow(r, s, l); err != nil {
+				return err
 			}
+			rows.Add(1)
+			return bar.Add(1)
+		})
+	}
+	wg.Wait()
+	select {
+	case err := <-errs:
+		return err
+	default:
+	}
+	if ctx.Err() != nil { // a row failed, the error is returned by the writers group
+		return nil
+	}
+	return kv.saveCheckpoint(a.path, rows.Load())
+}
 
-		}
-	})
-	return g.Wait()
+func (kv *keyValueStorage) loadSource(ctx context.Context, s *source, l *lookups, bar *progressbar.ProgressBar, m int) error {
+	w, ctx := errgroup.WithContext(ctx)
+	w.SetLimit(m)
+	var g errgroup.Group
+	for _, a := range s.readers {
+		g.Go(func() error {
+			return kv.loadFile(ctx, a, s.kind, l, bar, w)
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	return w.Wait()
 }
 
-func (kv *badgerStorage) load(dir string, l *lookups, m int) error {
-	srcs, t, err := newSources(dir, []sourceType{
-		base,
-		partners,
-		simpleTaxes,
-		noTaxes,
-		presumedProfit,
-		realProfit,
-		arbitratedProfit,
-	})
+func (kv *keyValueStorage) load(dir string, l *lookups, m int) error {
+	ks, err := kvSources(dir)
+	if err != nil {
+		return err
+	}
+	srcs, t, err := newSources(dir, ks)
 	if err != nil {
 		return fmt.Errorf("could not load sources: %w", err)
 	}
@@ -151,15 +183,19 @@ func (kv *badgerStorage) load(dir string, l *lookups, m int) error {
 	defer tic.Stop()
 	go func() {
 		for range tic.C {
-			kv.garbageCollect()
+			kv.db.garbageCollect()
 		}
 	}()
-	bar := progressbar.Default(t, "Processing base CNPJ, partners and taxes")
+	label := "Processing base CNPJ, partners and taxes"
+	bar := progressbar.Default(t, label)
 	defer func() {
 		if err := bar.Close(); err != nil {
 			slog.Warn("could not close the progress bar", "error", err)
 		}
 	}()
+	kv.eta.start(keyValueStage, t)
+	stop := kv.eta.follow(bar, label)
+	defer stop()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	g, ctx := errgroup.WithContext(ctx)
@@ -168,10 +204,14 @@ func (kv *badgerStorage) load(dir string, l *lookups, m int) error {
 			return kv.loadSource(ctx, src, l, bar, m)
 		})
 	}
-	return g.Wait()
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	kv.eta.finish()
+	return nil
 }
 
-func (kv *badgerStorage) enrichCompany(c *Company) error {
+func (kv *keyValueStorage) enrichCompany(c *Company) error {
 	n := cnpj.Base(c.CNPJ)
 	ps := make(chan []PartnerData)
 	bs := make(chan baseData)
@@ -235,26 +275,34 @@ func (kv *badgerStorage) enrichCompany(c *Company) error {
 	return nil
 }
 
-func (b *badgerStorage) close() error {
-	return b.db.Close()
+func (kv *keyValueStorage) close() error {
+	return kv.db.close()
 }
 
 type noLogger struct{}
 
-func (*noLogger) Errorf(string, ...any)   {}
-func (*noLogger) Warningf(string, ...any) {}
-func (*noLogger) Infof(string, ...any)    {}
-func (*noLogger) Debugf(string, ...any)   {}
+func (*noLogger) Errorf(string, ...any)     {}
+func (*noLogger) Warningf(string, ...any)   {}
+func (*noLogger) Infof(string, ...any)      {}
+func (*noLogger) Debugf(string, ...any)     {}
+func (*noLogger) Fatalf(f string, a ...any) { panic(fmt.Sprintf(f, a...)) }
 
-func newBadgerStorage(dir string, ro bool) (*badgerStorage, error) {
-	opt := badger.DefaultOptions(dir).WithReadOnly(ro)
-	slog.Debug("Creating temporary key-value storage", "path", dir)
-	if os.Getenv("DEBUG") == "" {
-		opt = opt.WithLogger(&noLogger{})
+// newKeyValueStorage opens the key-value storage in dir using one of the
+// KVEngines. mem is the memory budget in MB (0 uses the engine defaults).
+func newKeyValueStorage(engine, dir string, mem int) (*keyValueStorage, error) {
+	slog.Debug("Creating temporary key-value storage", "engine", engine, "path", dir, "memory", mem)
+	var db kvEngine
+	var err error
+	switch engine {
+	case BadgerKVEngine:
+		db, err = newBadgerEngine(dir, mem)
+	case PebbleKVEngine:
+		db, err = newPebbleEngine(dir, mem)
+	default:
+		return nil, fmt.Errorf("unknown key-value engine %s, the options are: %s", engine, strings.Join(KVEngines, ", "))
 	}
-	db, err := badger.Open(opt)
 	if err != nil {
-		return nil, fmt.Errorf("error creating badger key-value object: %w", err)
+		return nil, err
 	}
-	return &badgerStorage{db: db, path: dir}, nil
+	return &keyValueStorage{db: db, path: dir}, nil
 }
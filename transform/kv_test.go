@@ -1,13 +1,12 @@
 package transform
 
 import (
-	"bytes"
+	"fmt"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/cuducos/minha-receita/testutils"
-	"github.com/dgraph-io/badger/v4"
 )
 
 var (
@@ -15,14 +14,23 @@ var (
 	expectedTaxregime = []byte(`{"ano":2022,"cnpj_da_scp":"CNPJ DA SCP","forma_de_tributacao":"FORMA DE TRIBUTAÇÃO","quantidade_de_escrituracoes":42}`)
 )
 
-func TestBadgerStorageClose(t *testing.T) {
-	kv, err := newBadgerStorage(t.TempDir(), false)
-	if err != nil {
-		t.Errorf("expected no error creating badger storage, got %s", err)
-	}
-	if err := kv.close(); err != nil {
-		t.Errorf("expected no error closing badger storage, got %s", err)
+func TestKeyValueStorageClose(t *testing.T) {
+	for _, e := range KVEngines {
+		t.Run(e, func(t *testing.T) {
+			kv, err := newKeyValueStorage(e, t.TempDir(), 0)
+			if err != nil {
+				t.Fatalf("expected no error creating %s storage, got %s", e, err)
+			}
+			if err := kv.close(); err != nil {
+				t.Errorf("expected no error closing %s storage, got %s", e, err)
+			}
+		})
 	}
+	t.Run("unknown engine", func(t *testing.T) {
+		if _, err := newKeyValueStorage("leveldb", t.TempDir(), 0); err == nil {
+			t.Error("expected error creating storage with unknown engine, got nil")
+		}
+	})
 }
 
 func TestNewItem(t *testing.T) {
@@ -63,14 +71,24 @@ func TestNewItem(t *testing.T) {
 }
 
 func TestLoad(t *testing.T) {
+	for _, e := range KVEngines {
+		for _, mem := range []int{0, 64} {
+			t.Run(fmt.Sprintf("%s with %dMB", e, mem), func(t *testing.T) {
+				testLoad(t, e, mem)
+			})
+		}
+	}
+}
+
+func testLoad(t *testing.T, e string, mem int) {
 	t.Run("single values", func(t *testing.T) {
 		l, err := newLookups(testdata)
 		if err != nil {
 			t.Fatalf("could not create lookups: %s", err)
 		}
-		kv, err := newBadgerStorage(t.TempDir(), false)
+		kv, err := newKeyValueStorage(e, t.TempDir(), mem)
 		if err != nil {
-			t.Fatalf("could not create badger storage: %s", err)
+			t.Fatalf("could not create key-value storage: %s", err)
 		}
 		defer func() {
 			if err := kv.close(); err != nil {
@@ -94,9 +112,9 @@ func TestLoad(t *testing.T) {
 		if err != nil {
 			t.Fatalf("could not create lookups: %s", err)
 		}
-		kv, err := newBadgerStorage(t.TempDir(), false)
+		kv, err := newKeyValueStorage(e, t.TempDir(), mem)
 		if err != nil {
-			t.Fatalf("could not create badger storage: %s", err)
+			t.Fatalf("could not create key-value storage: %s", err)
 		}
 		defer func() {
 			if err := kv.close(); err != nil {
@@ -130,7 +148,7 @@ func TestEnrichCompany(t *testing.T) {
 	if err != nil {
 		t.Fatalf("could not create lookups: %s", err)
 	}
-	kv, err := newBadgerStorage(t.TempDir(), false)
+	kv, err := newKeyValueStorage(BadgerKVEngine, t.TempDir(), 0)
 	if err != nil {
 		t.Fatalf("could not create badger storage: %s", err)
 	}
@@ -203,42 +221,27 @@ func TestEnrichCompany(t *testing.T) {
 	}
 }
 
-func assertKeyValue(t *testing.T, kv *badgerStorage, key, value string) {
-	err := kv.db.View(func(tx *badger.Txn) error {
-		i, err := tx.Get([]byte(key))
-		if err != nil {
-			return err
-		}
-		got, err := i.ValueCopy(nil)
-		if err != nil {
-			return err
-		}
-		if string(got) != value {
-			t.Errorf("expected %s to be %s, got %s", string(key), value, string(got))
-		}
-		return nil
-	})
+func assertKeyValue(t *testing.T, kv *keyValueStorage, key, value string) {
+	got, ok, err := kv.db.get([]byte(key))
 	if err != nil {
-		t.Fatalf("could not read %s: %s", string(key), err)
+		t.Fatalf("could not read %s: %s", key, err)
+	}
+	if !ok {
+		t.Fatalf("expected %s to exist", key)
+	}
+	if string(got) != value {
+		t.Errorf("expected %s to be %s, got %s", key, value, string(got))
 	}
 }
 
-func assertKeyValues(t *testing.T, kv *badgerStorage, prefix string, value []string) {
-	err := kv.db.View(func(tx *badger.Txn) error {
-		var got []string
-		it := tx.NewIterator(badger.DefaultIteratorOptions)
-		defer it.Close()
-		for it.Seek([]byte(prefix)); it.Valid() && bytes.HasPrefix(it.Item().Key(), []byte(prefix)); it.Next() {
-			v, err := it.Item().ValueCopy(nil)
-			if err != nil {
-				return err
-			}
-			got = append(got, string(v))
-		}
-		testutils.AssertArraysHaveSameItems(t, value, got)
+func assertKeyValues(t *testing.T, kv *keyValueStorage, prefix string, value []string) {
+	var got []string
+	err := kv.db.iterate([]byte(prefix), func(v []byte) error {
+		got = append(got, string(v))
 		return nil
 	})
 	if err != nil {
-		t.Fatalf("expected no error searchinmg key-value storage for %s, got %s", string(prefix), err)
+		t.Fatalf("expected no error searchinmg key-value storage for %s, got %s", prefix, err)
 	}
+	testutils.AssertArraysHaveSameItems(t, value, got)
 }
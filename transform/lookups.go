@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log/slog"
 	"strings"
+
+	"github.com/cuducos/minha-receita/warnings"
 )
 
 var separator = ';'
@@ -153,6 +155,7 @@ func (c *Company) municipio(l *lookups, v string) error {
 	ibge, ok := l.ibge[*i]
 	if !ok {
 		slog.Warn("Could not find city IBGE code", "city", *c.Municipio, "uf", c.UF, "code", *i)
+		warnings.Add(warnings.Transform, "city without IBGE code", fmt.Sprintf("%s (%s)", *c.Municipio, c.UF))
 		return nil
 	}
 	c.CodigoMunicipioIBGE, err = toInt(ibge)
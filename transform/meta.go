@@ -0,0 +1,48 @@
+package transform
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/cuducos/minha-receita/warnings"
+)
+
+// localMeta is the metadata saved without a database (see LoadKeyValue).
+type localMeta interface {
+	metaStore
+	MetaAll() (map[string]string, error)
+	MetaDelete(string) error
+}
+
+// ReconcileMeta moves the metadata saved without a database to the database:
+// the durations of the stages are appended to the ones in the database, the
+// warnings are included in the ones of this run, and the other keys are copied
+// as they are.
+func ReconcileMeta(from localMeta, to metaStore) error {
+	m, err := from.MetaAll()
+	if err != nil {
+		return err
+	}
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		switch k {
+		case stageDurationsKey:
+			err = mergeStageDurations(to, m[k])
+		case warnings.MetaKey:
+			err = warnings.MergeJSON(m[k])
+		default:
+			err = to.MetaSave(k, m[k])
+		}
+		if err != nil {
+			return fmt.Errorf("could not move %s from the local metadata: %w", k, err)
+		}
+		if err := from.MetaDelete(k); err != nil {
+			return err
+		}
+	}
+	if len(m) > 0 {
+		slog.Info("Local metadata moved to the database", "keys", len(m))
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package transform
+
+import (
+	"encoding/json/v2"
+	"maps"
+	"testing"
+
+	"github.com/cuducos/minha-receita/warnings"
+)
+
+type inMemoryLocalMeta struct{ inMemoryDB }
+
+func (i inMemoryLocalMeta) MetaAll() (map[string]string, error) {
+	i.meta.lock.RLock()
+	defer i.meta.lock.RUnlock()
+	return maps.Clone(i.meta.data), nil
+}
+
+func (i inMemoryLocalMeta) MetaDelete(k string) error {
+	i.meta.lock.Lock()
+	defer i.meta.lock.Unlock()
+	delete(i.meta.data, k)
+	return nil
+}
+
+func TestReconcileMeta(t *testing.T) {
+	local := inMemoryLocalMeta{newTestDB()}
+	db := newTestDB()
+	for k, v := range map[string]string{
+		stageDurationsKey: `{"key-value":[{"seconds":2,"total":0}]}`,
+		warnings.MetaKey:  `[{"stage":"transform","kind":"city without IBGE code","count":3}]`,
+		"checksums":       `{"Empresas0.zip":{}}`,
+	} {
+		if err := local.MetaSave(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.MetaSave(stageDurationsKey, `{"key-value":[{"seconds":1,"total":0}],"json":[{"seconds":3,"total":1}]}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReconcileMeta(local, db); err != nil {
+		t.Fatalf("expected no error reconciling metadata, got %s", err)
+	}
+	if m, _ := local.MetaAll(); len(m) != 0 {
+		t.Errorf("expected local metadata to be empty, got %v", m)
+	}
+	if v, err := db.MetaRead("checksums"); err != nil || v != `{"Empresas0.zip":{}}` {
+		t.Errorf("expected checksums to be copied, got %s (%v)", v, err)
+	}
+	v, err := db.MetaRead(stageDurationsKey)
+	if err != nil {
+		t.Fatalf("expected no error reading durations, got %s", err)
+	}
+	var h map[string][]stageRun
+	if err := json.Unmarshal([]byte(v), &h); err != nil {
+		t.Fatalf("expected no error parsing durations, got %s", err)
+	}
+	if len(h[keyValueStage]) != 2 || len(h[jsonStage]) != 1 {
+		t.Errorf("expected local durations to be appended, got %v", h)
+	}
+	var found bool
+	for _, w := range warnings.Report() {
+		if w.Kind == "city without IBGE code" && w.Count >= 3 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected local warnings to be included in this run, got %v", warnings.Report())
+	}
+}
@@ -0,0 +1,96 @@
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cockroachdb/pebble/v2"
+)
+
+type pebbleEngine struct{ db *pebble.DB }
+
+func (e *pebbleEngine) get(k []byte) ([]byte, bool, error) {
+	v, c, err := e.db.Get(k)
+	if errors.Is(err, pebble.ErrNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer c.Close()
+	return append([]byte{}, v...), true, nil
+}
+
+// upperBound is the first key after all the keys starting with the prefix.
+func upperBound(pre []byte) []byte {
+	u := append([]byte{}, pre...)
+	for i := len(u) - 1; i >= 0; i-- {
+		u[i]++
+		if u[i] != 0 {
+			return u[:i+1]
+		}
+	}
+	return nil // prefix is all 0xff, no upper bound
+}
+
+func (e *pebbleEngine) iterate(pre []byte, f func([]byte) error) error {
+	it, err := e.db.NewIter(&pebble.IterOptions{LowerBound: pre, UpperBound: upperBound(pre)})
+	if err != nil {
+		return err
+	}
+	for it.First(); it.Valid(); it.Next() {
+		v, err := it.ValueAndErr()
+		if err != nil {
+			it.Close()
+			return err
+		}
+		if err := f(v); err != nil {
+			it.Close()
+			return err
+		}
+	}
+	return it.Close()
+}
+
+// writes are not synced: pebble's write-ahead log survives the process
+// crashing, and the key-value storage is temporary anyway
+func (e *pebbleEngine) set(k, v []byte) error { return e.db.Set(k, v, pebble.NoSync) }
+
+func (e *pebbleEngine) setBatch(ks, vs [][]byte) error {
+	b := e.db.NewBatch()
+	defer b.Close()
+	for n, k := range ks {
+		if err := b.Set(k, vs[n], nil); err != nil {
+			return err
+		}
+	}
+	return b.Commit(pebble.NoSync)
+}
+
+// garbageCollect is a no-op since pebble compacts in the background.
+func (e *pebbleEngine) garbageCollect() {}
+
+func (e *pebbleEngine) close() error { return e.db.Close() }
+
+// newPebbleEngine opens a Pebble storage. With a memory budget (in MB), half
+// of it goes to the block cache and the other half to the memtables.
+func newPebbleEngine(dir string, mem int) (*pebbleEngine, error) {
+	opt := &pebble.Options{}
+	if os.Getenv("DEBUG") == "" {
+		opt.Logger = &noLogger{}
+	}
+	if mem > 0 {
+		b := int64(mem) << 20
+		c := pebble.NewCache(b / 2)
+		defer c.Unref() // pebble keeps its own reference
+		opt.Cache = c
+		opt.MemTableSize = uint64(b / 4)
+		opt.MemTableStopWritesThreshold = 2
+	}
+	db, err := pebble.Open(dir, opt)
+	if err != nil {
+		return nil, fmt.Errorf("error creating pebble key-value object: %w", err)
+	}
+	return &pebbleEngine{db}, nil
+}
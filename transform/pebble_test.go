@@ -0,0 +1,18 @@
+package transform
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestUpperBound(t *testing.T) {
+	for _, tc := range []struct{ prefix, expected []byte }{
+		{[]byte("p-123"), []byte("p-124")},
+		{[]byte{'a', 0xff}, []byte("b")},
+		{[]byte{0xff, 0xff}, nil},
+	} {
+		if got := upperBound(tc.prefix); !bytes.Equal(got, tc.expected) {
+			t.Errorf("expected upper bound of %q to be %q, got %q", tc.prefix, tc.expected, got)
+		}
+	}
+}
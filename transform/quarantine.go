@@ -0,0 +1,157 @@
+package transform
+
+import (
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// QuarantineDir is the directory, within the data directory, where batches
+// that failed to be saved to the database are kept to be replayed later.
+const QuarantineDir = "quarantine"
+
+// errQuarantined is returned by a transform that finished but had to
+// quarantine batches, so scripts notice the data is incomplete.
+var errQuarantined = errors.New("some batches could not be saved and were quarantined")
+
+// quarantinedBatch is the content of a quarantine file: the batch as sent to
+// the database, and the error it failed with, so the operator knows what to
+// fix before replaying it. With --also-load-to, Targets are the databases that
+// failed, by their position in the fan-out (empty meaning all of them).
+type quarantinedBatch struct {
+	Error     string     `json:"error"`
+	Targets   []int      `json:"targets,omitempty"`
+	Companies [][]string `json:"companies"`
+}
+
+func writeQuarantinedBatch(pth string, q quarantinedBatch) error {
+	b, err := json.Marshal(q)
+	if err != nil {
+		return fmt.Errorf("could not serialize quarantine file %s: %w", pth, err)
+	}
+	if err := os.WriteFile(pth, b, 0644); err != nil {
+		return fmt.Errorf("could not write quarantine file %s: %w", pth, err)
+	}
+	return nil
+}
+
+// quarantineBatch writes a batch that failed to be saved to a new file in dir
+// and returns the path of this file.
+func quarantineBatch(dir string, b [][]string, cause error) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("could not create quarantine directory %s: %w", dir, err)
+	}
+	f, err := os.CreateTemp(dir, "batch-*.json")
+	if err != nil {
+		return "", fmt.Errorf("could not create quarantine file in %s: %w", dir, err)
+	}
+	defer f.Close()
+	q := quarantinedBatch{Error: cause.Error(), Companies: b}
+	var t *targetsError
+	if errors.As(cause, &t) {
+		q.Targets = t.targets
+	}
+	if err := json.MarshalWrite(f, q); err != nil {
+		return "", fmt.Errorf("could not write quarantine file %s: %w", f.Name(), err)
+	}
+	return f.Name(), nil
+}
+
+// replayBatch saves the batch to the databases that failed to save it,
+// returning the ones that fail again.
+func replayBatch(q quarantinedBatch, dbs []database) ([]int, error) {
+	ts := q.Targets
+	if len(ts) == 0 {
+		ts = make([]int, len(dbs))
+		for i := range dbs {
+			ts[i] = i
+		}
+	}
+	for _, i := range ts {
+		if i < 0 || i >= len(dbs) {
+			return nil, fmt.Errorf("batch failed in database #%d, but only %d databases were given", i+1, len(dbs))
+		}
+	}
+	var failed []int
+	var errs []error
+	for _, i := range ts {
+		if err := dbs[i].CreateCompanies(q.Companies); err != nil {
+			failed = append(failed, i)
+			errs = append(errs, fmt.Errorf("database #%d: %w", i+1, err))
+		}
+	}
+	return failed, errors.Join(errs...)
+}
+
+// ReplayQuarantine retries saving the batches quarantined in dir, only to the
+// databases that failed to save them (db being the same fan-out used in the
+// transform). Each batch saved is removed from the quarantine, and the ones
+// that fail again are kept for another attempt, with the databases still
+// missing them. Once the quarantine is empty, the changes of the load are
+// recorded in the event log.
+func ReplayQuarantine(dir string, db database) error {
+	ps, err := filepath.Glob(filepath.Join(dir, "batch-*.json"))
+	if err != nil {
+		return fmt.Errorf("could not list quarantine files in %s: %w", dir, err)
+	}
+	if len(ps) == 0 {
+		slog.Info("No batches in quarantine", "directory", dir)
+		return nil
+	}
+	var errs []error
+	var n int
+	for _, p := range ps {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not read quarantine file %s: %w", p, err))
+			continue
+		}
+		var q quarantinedBatch
+		if err := json.Unmarshal(b, &q); err != nil {
+			errs = append(errs, fmt.Errorf("could not parse quarantine file %s: %w", p, err))
+			continue
+		}
+		ts, err := replayBatch(q, targetsOf(db))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error saving quarantined batch %s: %w", p, err))
+			if len(ts) > 0 { // the databases that saved it now are not retried
+				q.Error, q.Targets = err.Error(), ts
+				if err := writeQuarantinedBatch(p, q); err != nil {
+					slog.Warn("could not update quarantine file", "path", p, "error", err)
+				}
+			}
+			continue
+		}
+		if err := os.Remove(p); err != nil {
+			errs = append(errs, fmt.Errorf("could not remove replayed quarantine file %s: %w", p, err))
+			continue
+		}
+		n += len(q.Companies)
+	}
+	slog.Info("Quarantine replayed", "batches", len(ps)-len(errs), "companies", n, "failed", len(errs))
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return saveEvents(db, dir)
+}
+
+// saveEvents records the changes of the load in the event log, unless there
+// are batches in the quarantine dir q: their companies would be recorded as
+// deleted, so the events wait for the quarantine to be replayed.
+func saveEvents(db database, q string) error {
+	if q != "" {
+		ps, err := filepath.Glob(filepath.Join(q, "batch-*.json"))
+		if err != nil {
+			return fmt.Errorf("could not list quarantine files in %s: %w", q, err)
+		}
+		if len(ps) > 0 {
+			slog.Warn("Skipping the event log until the quarantine is replayed", "batches", len(ps), "directory", q)
+			return nil
+		}
+	}
+	slog.Info("Recording the changes of this load in the event log…")
+	return db.SaveEvents()
+}
@@ -0,0 +1,233 @@
+package transform
+
+import (
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+type failingDB struct{ inMemoryDB }
+
+func (failingDB) CreateCompanies([][]string) error { return errors.New("bad row") }
+
+func TestQuarantine(t *testing.T) {
+	kv, err := newKeyValueStorage(BadgerKVEngine, t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("expected no error creating badger, got %s", err)
+	}
+	defer func() {
+		if err := kv.close(); err != nil {
+			t.Errorf("expected no error closing key-value storage, got %s", err)
+		}
+	}()
+	l, err := newLookups(testdata)
+	if err != nil {
+		t.Fatalf("expected no errors creating look up tables, got %v", err)
+	}
+	if err := kv.load(testdata, &l, 1024); err != nil {
+		t.Fatalf("expected no error loading values to badger, got %s", err)
+	}
+	q := filepath.Join(t.TempDir(), QuarantineDir)
+	r, err := createJSONRecordsTask(testdata, failingDB{newTestDB()}, &l, kv, 2, false, DefaultCapitalBands)
+	if err != nil {
+		t.Fatalf("expected no error creating task, got %s", err)
+	}
+	r.quarantine = q
+	if err = r.run(2); err != nil {
+		t.Fatalf("expected no error running task with quarantine, got %s", err)
+	}
+	ps, err := filepath.Glob(filepath.Join(q, "batch-*.json"))
+	if err != nil {
+		t.Fatalf("expected no error listing quarantine, got %s", err)
+	}
+	if n := r.quarantined.Load(); n == 0 || int(n) != len(ps) {
+		t.Errorf("expected as many quarantine files as quarantined batches, got %d files and %d batches", len(ps), n)
+	}
+	if err := ReplayQuarantine(q, failingDB{newTestDB()}); err == nil {
+		t.Error("expected an error replaying with the cause not fixed")
+	}
+	if ps, _ := filepath.Glob(filepath.Join(q, "batch-*.json")); len(ps) == 0 {
+		t.Error("expected the quarantine to be kept after a failed replay")
+	}
+	db := newTestDB()
+	if err := ReplayQuarantine(q, db); err != nil {
+		t.Errorf("expected no error replaying quarantine, got %s", err)
+	}
+	if _, err := db.GetCompany("33683111000280"); err != nil {
+		t.Errorf("expected the company to be saved by the replay, got %s", err)
+	}
+	if ps, _ := filepath.Glob(filepath.Join(q, "batch-*.json")); len(ps) != 0 {
+		t.Errorf("expected an empty quarantine after the replay, got %d files", len(ps))
+	}
+}
+
+func TestQuarantineDisabled(t *testing.T) {
+	kv, err := newKeyValueStorage(BadgerKVEngine, t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("expected no error creating badger, got %s", err)
+	}
+	defer func() {
+		if err := kv.close(); err != nil {
+			t.Errorf("expected no error closing key-value storage, got %s", err)
+		}
+	}()
+	l, err := newLookups(testdata)
+	if err != nil {
+		t.Fatalf("expected no errors creating look up tables, got %v", err)
+	}
+	if err := kv.load(testdata, &l, 1024); err != nil {
+		t.Fatalf("expected no error loading values to badger, got %s", err)
+	}
+	r, err := createJSONRecordsTask(testdata, failingDB{newTestDB()}, &l, kv, 2, false, DefaultCapitalBands)
+	if err != nil {
+		t.Fatalf("expected no error creating task, got %s", err)
+	}
+	if err = r.run(2); err == nil {
+		t.Error("expected an error running task without quarantine")
+	}
+}
+
+type eventsDB struct {
+	inMemoryDB
+	saved *int
+}
+
+func (db eventsDB) SaveEvents() error {
+	*db.saved++
+	return nil
+}
+
+func TestSaveEvents(t *testing.T) {
+	q := t.TempDir()
+	var n int
+	db := eventsDB{newTestDB(), &n}
+	if _, err := quarantineBatch(q, [][]string{{"33683111000280", "{}"}}, errors.New("bad row")); err != nil {
+		t.Fatalf("expected no error quarantining a batch, got %s", err)
+	}
+	if err := saveEvents(db, q); err != nil {
+		t.Errorf("expected no error skipping the events, got %s", err)
+	}
+	if n != 0 {
+		t.Error("expected the events to wait for the quarantine to be replayed")
+	}
+	if err := ReplayQuarantine(q, db); err != nil {
+		t.Errorf("expected no error replaying the quarantine, got %s", err)
+	}
+	if n != 1 {
+		t.Errorf("expected the events to be saved after the replay, got %d calls", n)
+	}
+}
+
+// uniqueDB rejects companies it already has, like the unique index of the
+// databases.
+type uniqueDB struct{ inMemoryDB }
+
+func (db uniqueDB) CreateCompanies(cs [][]string) error {
+	for _, c := range cs {
+		if _, err := db.GetCompany(c[0]); err == nil {
+			return fmt.Errorf("duplicated company %s", c[0])
+		}
+	}
+	return db.inMemoryDB.CreateCompanies(cs)
+}
+
+func TestQuarantineFanOut(t *testing.T) {
+	q := t.TempDir()
+	main, other := uniqueDB{newTestDB()}, uniqueDB{newTestDB()}
+	b := [][]string{{"33683111000280", "{}"}}
+	err := FanOut[database](main, failingDB{newTestDB()}, other).CreateCompanies(b)
+	if err == nil {
+		t.Fatal("expected an error when one of the databases fails")
+	}
+	p, err := quarantineBatch(q, b, err)
+	if err != nil {
+		t.Fatalf("expected no error quarantining a batch, got %s", err)
+	}
+	if err := ReplayQuarantine(q, FanOut[database](main, failingDB{newTestDB()}, other)); err == nil {
+		t.Error("expected an error replaying with the cause not fixed")
+	}
+	c, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatalf("expected the quarantine file to be kept, got %s", err)
+	}
+	var got quarantinedBatch
+	if err := json.Unmarshal(c, &got); err != nil {
+		t.Fatalf("expected no error reading the quarantine file, got %s", err)
+	}
+	if !slices.Equal(got.Targets, []int{1}) {
+		t.Errorf("expected only the second database in the quarantine file, got %v", got.Targets)
+	}
+	if err := ReplayQuarantine(q, FanOut[database](main, uniqueDB{newTestDB()}, other)); err != nil {
+		t.Errorf("expected no error replaying only to the database that failed, got %s", err)
+	}
+	if err := ReplayQuarantine(q, FanOut[database](main, other)); err != nil {
+		t.Errorf("expected no error replaying an empty quarantine, got %s", err)
+	}
+	if _, err := quarantineBatch(q, b, &targetsError{[]int{2}, errors.New("bad row")}); err != nil {
+		t.Fatalf("expected no error quarantining a batch, got %s", err)
+	}
+	if err := ReplayQuarantine(q, main); err == nil {
+		t.Error("expected an error replaying to fewer databases than the transform")
+	}
+}
+
+func TestQuarantineFailsTransform(t *testing.T) {
+	q := t.TempDir()
+	err := Transform(testdata, failingDB{newTestDB()}, 2, 2, 2, false, DefaultCapitalBands, false, BadgerKVEngine, 0, q)
+	if !errors.Is(err, errQuarantined) {
+		t.Errorf("expected the transform to fail with quarantined batches, got %v", err)
+	}
+	if ps, _ := filepath.Glob(filepath.Join(q, "batch-*.json")); len(ps) == 0 {
+		t.Error("expected batches in the quarantine")
+	}
+}
+
+func TestQuarantineStopsAfterConsecutiveFailures(t *testing.T) {
+	kv, err := newKeyValueStorage(BadgerKVEngine, t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("expected no error creating badger, got %s", err)
+	}
+	defer func() {
+		if err := kv.close(); err != nil {
+			t.Errorf("expected no error closing key-value storage, got %s", err)
+		}
+	}()
+	l, err := newLookups(testdata)
+	if err != nil {
+		t.Fatalf("expected no errors creating look up tables, got %v", err)
+	}
+	if err := kv.load(testdata, &l, 1024); err != nil {
+		t.Fatalf("expected no error loading values to badger, got %s", err)
+	}
+	for _, tc := range []struct {
+		desc string
+		db   database
+		ok   bool
+	}{
+		{"failing database", failingDB{newTestDB()}, false},
+		{"working database", newTestDB(), true},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			r, err := createJSONRecordsTask(testdata, tc.db, &l, kv, 2, false, DefaultCapitalBands)
+			if err != nil {
+				t.Fatalf("expected no error creating task, got %s", err)
+			}
+			r.quarantine = filepath.Join(t.TempDir(), QuarantineDir)
+			r.failures.Store(maxConsecutiveFailures - 1)
+			err = r.run(2)
+			if tc.ok && (err != nil || r.failures.Load() != 0) {
+				t.Errorf("expected a saved batch to reset the failures, got %v and %d failures", err, r.failures.Load())
+			}
+			if !tc.ok && err == nil {
+				t.Error("expected the task to stop after too many failures in a row")
+			}
+			if n := r.quarantined.Load(); n != 0 {
+				t.Errorf("expected no quarantined batches, got %d", n)
+			}
+		})
+	}
+}
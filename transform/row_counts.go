@@ -0,0 +1,131 @@
+package transform
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// rowCountsKey is the metadata key for the reconciliation of the row counts.
+const rowCountsKey = "row-counts"
+
+// rowCounts counts the companies saved per bucket of CNPJ prefix (the first
+// two digits), so the database can be checked against what the transform
+// sent to it.
+type rowCounts struct {
+	sync.Mutex
+	buckets map[string]int64
+}
+
+func newRowCounts() *rowCounts { return &rowCounts{buckets: make(map[string]int64)} }
+
+func bucketOf(n string) string {
+	if len(n) < 2 {
+		return n
+	}
+	return n[:2]
+}
+
+func (r *rowCounts) add(ns ...string) {
+	r.Lock()
+	defer r.Unlock()
+	for _, n := range ns {
+		r.buckets[bucketOf(n)]++
+	}
+}
+
+// checksumOf summarizes counts per bucket, so two sets of counts can be
+// compared by a single value.
+func checksumOf(m map[string]int64) string {
+	h := sha256.New()
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		if m[k] != 0 {
+			fmt.Fprintf(h, "%s:%d\n", k, m[k])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type bucketMismatch struct {
+	Expected int64 `json:"expected"`
+	Found    int64 `json:"found"`
+}
+
+// reconciliation is saved to the metadata table after each transform.
+type reconciliation struct {
+	Expected         int64                     `json:"expected"`
+	Found            int64                     `json:"found"`
+	ExpectedChecksum string                    `json:"expected_checksum"`
+	FoundChecksum    string                    `json:"found_checksum"`
+	Mismatches       map[string]bucketMismatch `json:"mismatches"`
+}
+
+func newReconciliation(expected, found map[string]int64) reconciliation {
+	r := reconciliation{
+		ExpectedChecksum: checksumOf(expected),
+		FoundChecksum:    checksumOf(found),
+		Mismatches:       make(map[string]bucketMismatch),
+	}
+	ks := make(map[string]struct{})
+	for k, n := range expected {
+		r.Expected += n
+		ks[k] = struct{}{}
+	}
+	for k, n := range found {
+		r.Found += n
+		ks[k] = struct{}{}
+	}
+	for k := range ks {
+		if expected[k] != found[k] {
+			r.Mismatches[k] = bucketMismatch{expected[k], found[k]}
+		}
+	}
+	return r
+}
+
+// reconcileRowCounts checks every database the transform wrote to, see
+// reconcileRowCountsOf.
+func reconcileRowCounts(db database, c *rowCounts) error {
+	var errs []error
+	for _, t := range targetsOf(db) {
+		if err := reconcileRowCountsOf(t, c); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reconcileRowCountsOf compares the companies in the database with the ones
+// saved by the transform, bucket by bucket, saves the result to the metadata
+// table and returns an error if they differ.
+func reconcileRowCountsOf(db database, c *rowCounts) error {
+	slog.Info("Checking the number of companies in the database…")
+	found, err := db.RowCounts()
+	if err != nil {
+		return fmt.Errorf("error counting companies in the database: %w", err)
+	}
+	c.Lock()
+	r := newReconciliation(c.buckets, found)
+	c.Unlock()
+	b, err := json.Marshal(r, json.Deterministic(true))
+	if err != nil {
+		return fmt.Errorf("error serializing row counts reconciliation: %w", err)
+	}
+	if err := db.MetaSave(rowCountsKey, string(b)); err != nil {
+		return fmt.Errorf("error saving row counts reconciliation: %w", err)
+	}
+	if len(r.Mismatches) > 0 {
+		for k, m := range r.Mismatches {
+			slog.Error("Row count mismatch", "prefix", k, "expected", m.Expected, "found", m.Found)
+		}
+		return fmt.Errorf("the database has %d companies, expected %d (%d CNPJ prefixes differ, see %s in the metadata table)", r.Found, r.Expected, len(r.Mismatches), rowCountsKey)
+	}
+	slog.Info("Number of companies checked!", "companies", r.Found, "checksum", r.FoundChecksum)
+	return nil
+}
@@ -0,0 +1,65 @@
+package transform
+
+import (
+	"encoding/json/v2"
+	"testing"
+)
+
+func TestNewReconciliation(t *testing.T) {
+	r := newReconciliation(
+		map[string]int64{"19": 2, "33": 1},
+		map[string]int64{"19": 2, "33": 1},
+	)
+	if r.Expected != 3 || r.Found != 3 {
+		t.Errorf("expected 3 companies expected and found, got %d and %d", r.Expected, r.Found)
+	}
+	if len(r.Mismatches) != 0 {
+		t.Errorf("expected no mismatches, got %v", r.Mismatches)
+	}
+	if r.ExpectedChecksum != r.FoundChecksum {
+		t.Errorf("expected equal checksums, got %s and %s", r.ExpectedChecksum, r.FoundChecksum)
+	}
+	r = newReconciliation(
+		map[string]int64{"19": 2, "33": 1},
+		map[string]int64{"19": 1, "42": 1},
+	)
+	exp := map[string]bucketMismatch{"19": {2, 1}, "33": {1, 0}, "42": {0, 1}}
+	if len(r.Mismatches) != len(exp) {
+		t.Errorf("expected %d mismatches, got %v", len(exp), r.Mismatches)
+	}
+	for k, m := range exp {
+		if r.Mismatches[k] != m {
+			t.Errorf("expected mismatch for %s to be %v, got %v", k, m, r.Mismatches[k])
+		}
+	}
+	if r.ExpectedChecksum == r.FoundChecksum {
+		t.Error("expected different checksums")
+	}
+}
+
+func TestReconcileRowCounts(t *testing.T) {
+	db := newTestDB()
+	if err := db.CreateCompanies([][]string{{"33683111000280", "{}"}, {"19131243000197", "{}"}}); err != nil {
+		t.Fatalf("expected no error creating companies, got %s", err)
+	}
+	c := newRowCounts()
+	c.add("33683111000280", "19131243000197")
+	if err := reconcileRowCounts(db, c); err != nil {
+		t.Errorf("expected no error reconciling row counts, got %s", err)
+	}
+	c.add("33683111000199")
+	if err := reconcileRowCounts(db, c); err == nil {
+		t.Error("expected an error reconciling row counts with a missing company")
+	}
+	v, err := db.MetaRead(rowCountsKey)
+	if err != nil {
+		t.Fatalf("expected no error reading the reconciliation, got %s", err)
+	}
+	var r reconciliation
+	if err := json.Unmarshal([]byte(v), &r); err != nil {
+		t.Fatalf("expected no error parsing the reconciliation, got %s", err)
+	}
+	if m := r.Mismatches["33"]; m.Expected != 2 || m.Found != 1 {
+		t.Errorf("expected 2 companies expected and 1 found in bucket 33, got %v", m)
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync/atomic"
 
+	"github.com/cuducos/minha-receita/download"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -52,6 +54,43 @@ const (
 	noTaxes          sourceType = "Imunes e Isentas"
 )
 
+// kvSourcesOf maps the types of files of the download to the sources loaded
+// to the key-value storage.
+var kvSourcesOf = map[string][]sourceType{
+	download.Companies:   {base},
+	download.Partners:    {partners},
+	download.SimpleTaxes: {simpleTaxes},
+	download.TaxRegimes:  {noTaxes, presumedProfit, realProfit, arbitratedProfit},
+}
+
+// kvSources lists the sources loaded to the key-value storage: all of them,
+// unless the download was limited with --only (see download.OnlyFile).
+func kvSources(dir string) ([]sourceType, error) {
+	only, err := download.LoadOnly(dir)
+	if err != nil {
+		return nil, err
+	}
+	ts := download.FileTypes
+	if only != nil {
+		if !slices.Contains(only, download.Venues) {
+			return nil, fmt.Errorf("the transform requires the %s files, but the download in %s was limited to %s", download.Venues, dir, strings.Join(only, ", "))
+		}
+		ts = only
+		var skip []string
+		for _, t := range download.FileTypes {
+			if !slices.Contains(only, t) && t != download.Venues {
+				skip = append(skip, t)
+			}
+		}
+		slog.Warn("Skipping the types of files not downloaded", "skipped", strings.Join(skip, ", "))
+	}
+	var srcs []sourceType
+	for _, t := range ts {
+		srcs = append(srcs, kvSourcesOf[t]...)
+	}
+	return srcs, nil
+}
+
 // being accumulative means a 1-to-many relationship: one company “accumulates”
 // more than one association with records from this source
 func (s sourceType) isAccumulative() bool {
@@ -211,6 +250,9 @@ func newSource(ctx context.Context, t sourceType, d string) (*source, error) {
 
 func newSources(dir string, kinds []sourceType) ([]*source, int64, error) {
 	srcs := []*source{}
+	if len(kinds) == 0 {
+		return srcs, 0, nil
+	}
 	ok := make(chan *source)
 	errs := make(chan error, 1)
 	done := atomic.Bool{}
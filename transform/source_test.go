@@ -2,9 +2,12 @@ package transform
 
 import (
 	"context"
+	"os"
 	"path/filepath"
 	"reflect"
 	"testing"
+
+	"github.com/cuducos/minha-receita/download"
 )
 
 func TestPathsForSource(t *testing.T) {
@@ -48,3 +51,40 @@ func TestSource(t *testing.T) {
 		t.Errorf("expected a source with 2 lines, got %d", s.total)
 	}
 }
+
+func TestKVSources(t *testing.T) {
+	all := []sourceType{base, partners, simpleTaxes, noTaxes, presumedProfit, realProfit, arbitratedProfit}
+	for _, tc := range []struct {
+		name     string
+		only     string
+		expected []sourceType
+		err      bool
+	}{
+		{"all files downloaded", "", all, false},
+		{"some files downloaded", "estabelecimentos\nempresas\n", []sourceType{base}, false},
+		{"without venues", "empresas\n", nil, true},
+		{"unknown file type", "estabelecimentos\nfiliais\n", nil, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tc.only != "" {
+				if err := os.WriteFile(filepath.Join(dir, download.OnlyFile), []byte(tc.only), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := kvSources(dir)
+			if tc.err {
+				if err == nil {
+					t.Error("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("expected no error, got %s", err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
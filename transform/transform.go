@@ -1,13 +1,16 @@
 package transform
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
-	"time"
+	"slices"
+	"strings"
 
 	"github.com/cuducos/minha-receita/download"
+	"github.com/cuducos/minha-receita/warnings"
 )
 
 const (
@@ -16,7 +19,7 @@ const (
 	MaxParallelDBQueries = 8
 
 	// MaxParallelKVWrites is the default for maximum number of parallels
-	// writes on the key-value storage (Badger)
+	// writes on the key-value storage
 	MaxParallelKVWrites = 1024
 
 	// BatchSize determines the size of the batches used to create the initial JSON
@@ -29,22 +32,40 @@ var extraIdexes = [...]string{
 	"cnaes_secundarios.codigo",
 	"codigo_municipio",
 	"codigo_municipio_ibge",
+	"codigo_faixa_capital_social",
 	"codigo_natureza_juridica",
+	"codigo_porte",
 	"qsa.cnpj_cpf_do_socio",
 	"uf",
 }
 
+// ExtraIndexes lists the indexes created after loading the companies, in
+// addition to the one of the CNPJ.
+func ExtraIndexes() []string { return slices.Clone(extraIdexes[:]) }
+
+// metaStore is where the metadata of the transform is saved: the database, or
+// a local store when running without one (see LoadKeyValue).
+type metaStore interface {
+	MetaSave(string, string) error
+	MetaRead(string) (string, error)
+}
+
 type database interface {
+	metaStore
 	PreLoad() error
 	CreateCompanies([][]string) error
 	PostLoad() error
 	CreateExtraIndexes([]string) error
-	MetaSave(string, string) error
+	RowCounts() (map[string]int64, error)
+	SaveEvents() error
 }
 
 type kvStorage interface {
 	load(string, *lookups, int) error
 	enrichCompany(*Company) error
+	isSaved(string) (bool, error)
+	markSaved([]string) error
+	expandSaved() (int, error)
 	close() error
 }
 
@@ -59,43 +80,88 @@ func saveUpdatedAt(db database, dir string) error {
 	return db.MetaSave("updated-at", string(v))
 }
 
-func createKeyValueStorage(dir string, pth string, l lookups, maxKV int) (err error) { // using named return so we can set it in the defer call
-	kv, err := newBadgerStorage(pth, false)
+// saveChecksums records the checksums of the source files, if they were
+// downloaded with a version that records them
+func saveChecksums(db database, dir string) error {
+	p := filepath.Join(dir, download.ChecksumsFile)
+	v, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", p, err)
+	}
+	slog.Info("Saving the checksums of the source files to the database…")
+	return db.MetaSave("checksums", string(v))
+}
+
+// saveWarnings records the warnings of the download (if it saved them in dir)
+// and of the transform.
+func saveWarnings(db database, dir string) error {
+	if err := warnings.Load(dir); err != nil {
+		return err
+	}
+	v, err := warnings.JSON()
+	if err != nil {
+		return err
+	}
+	slog.Info("Saving the warnings of this run to the database…")
+	return db.MetaSave(warnings.MetaKey, v)
+}
+
+func createKeyValueStorage(dir string, pth string, l lookups, maxKV int, e string, mem int, est *eta) (err error) { // using named return so we can set it in the defer call
+	kv, err := newKeyValueStorage(e, pth, mem)
 	if err != nil {
-		return fmt.Errorf("could not create badger storage: %w", err)
+		return fmt.Errorf("could not create key-value storage: %w", err)
 	}
+	kv.eta = est
 	defer func() {
 		if e := kv.close(); e != nil && err == nil {
 			err = fmt.Errorf("could not close key/value storage: %w", e)
 		}
 	}()
 	if err := kv.load(dir, &l, maxKV); err != nil {
-		return fmt.Errorf("error loading data to badger: %w", err)
+		return fmt.Errorf("error loading data to the key-value storage: %w", err)
 	}
 	return nil
 }
 
-func createJSONs(dir string, pth string, db database, l lookups, maxDB, batchSize int, privacy bool) error {
-	kv, err := newBadgerStorage(pth, true)
+// createJSONs saves the companies to the database, returning their row counts
+// and how many batches were quarantined.
+func createJSONs(dir string, pth string, db database, l lookups, maxDB, batchSize int, privacy bool, bs CapitalBands, e string, mem int, est *eta, q string, resume bool) (*rowCounts, int64, error) {
+	kv, err := newKeyValueStorage(e, pth, mem)
 	if err != nil {
-		return fmt.Errorf("could not create badger storage: %w", err)
+		return nil, 0, fmt.Errorf("could not create key-value storage: %w", err)
 	}
 	defer func() {
 		if err := kv.close(); err != nil {
 			slog.Warn("could not close key-value storage", "path", pth, "error", err)
 		}
 	}()
-	j, err := createJSONRecordsTask(dir, db, &l, kv, batchSize, privacy)
+	j, err := createJSONRecordsTask(dir, db, &l, kv, batchSize, privacy, bs)
 	if err != nil {
-		return fmt.Errorf("error creating new task for venues in %s: %w", dir, err)
+		return nil, 0, fmt.Errorf("error creating new task for venues in %s: %w", dir, err)
 	}
+	j.eta = est
+	j.quarantine = q
+	j.resume = resume
 	if err := j.run(maxDB); err != nil {
-		return fmt.Errorf("error writing venues to database: %w", err)
+		return nil, 0, fmt.Errorf("error writing venues to database: %w", err)
 	}
-	return saveUpdatedAt(db, dir)
+	if err := saveChecksums(db, dir); err != nil {
+		return nil, 0, err
+	}
+	if err := saveDictionaries(db, &l); err != nil {
+		return nil, 0, err
+	}
+	if err := saveUpdatedAt(db, dir); err != nil {
+		return nil, 0, err
+	}
+	return j.counts, j.quarantined.Load(), nil
 }
 
-func postLoad(db database) error {
+func postLoad(db database, est *eta) error {
+	est.start(postLoadStage, 0)
 	slog.Info("Consolidating the database…")
 	if err := db.PostLoad(); err != nil {
 		return err
@@ -106,30 +172,115 @@ func postLoad(db database) error {
 		return err
 	}
 	slog.Info("Indexes created!")
+	est.finish()
 	return nil
 }
 
+// prepareKeyValuePath creates the directory of the key-value storage for the
+// engine e, removing the one of a previous run unless resuming it.
+func prepareKeyValuePath(dir, e string, resume bool) (string, string, error) {
+	if !slices.Contains(KVEngines, e) {
+		return "", "", fmt.Errorf("unknown key-value engine %s, the options are: %s", e, strings.Join(KVEngines, ", "))
+	}
+	root, err := kvPath(dir)
+	if err != nil {
+		return "", "", fmt.Errorf("error creating temporary key-value storage: %w", err)
+	}
+	if !resume {
+		if err := os.RemoveAll(root); err != nil {
+			return "", "", fmt.Errorf("could not remove previous key-value storage %s: %w", root, err)
+		}
+	}
+	pth := filepath.Join(root, e) // resuming with another engine starts from scratch
+	if err := os.MkdirAll(pth, 0755); err != nil {
+		return "", "", fmt.Errorf("error creating temporary key-value storage: %w", err)
+	}
+	return root, pth, nil
+}
+
+// LoadKeyValue runs only the first step of the transform, loading the source
+// files to the key-value storage, which does not need a database. The
+// metadata goes to m (see ReconcileMeta), and the key-value storage is kept
+// so Transform can continue from it with resume.
+func LoadKeyValue(dir string, m metaStore, maxKV int, e string, mem int, resume bool) error {
+	_, pth, err := prepareKeyValuePath(dir, e, resume)
+	if err != nil {
+		return err
+	}
+	l, err := newLookups(dir)
+	if err != nil {
+		return fmt.Errorf("error creating look up tables from %s: %w", dir, err)
+	}
+	est := newETA(m)
+	if err := createKeyValueStorage(dir, pth, l, maxKV, e, mem, est); err != nil {
+		return err
+	}
+	slog.Info("Key-value storage loaded, run the transform with --resume to load the database", "path", pth)
+	if err := est.save(m); err != nil {
+		slog.Warn("could not save the durations of the transform stages", "error", err)
+	}
+	w, err := warnings.JSON()
+	if err != nil {
+		return err
+	}
+	return m.MetaSave(warnings.MetaKey, w)
+}
+
 // Transform the downloaded files for company venues creating a database record
-// per CNPJ
-func Transform(dir string, db database, maxDB, maxKV, s int, p bool) error {
-	pth, err := os.MkdirTemp("", fmt.Sprintf("minha-receita-%s-*", time.Now().Format("20060102150405")))
+// per CNPJ. If resume is true, it continues from the checkpoints recorded by a
+// previous run that failed. The key-value storage uses the engine e (one of
+// KVEngines) within a memory budget of mem MB (0 uses the engine defaults).
+// Batches that fail to be saved are written to the quarantine directory q
+// (see ReplayQuarantine) instead of stopping the transform, unless too many
+// batches fail in a row; in any case, the transform returns an error if any
+// batch was quarantined. The warnings of the download and of the transform are
+// saved to the metadata at the end.
+func Transform(dir string, db database, maxDB, maxKV, s int, p bool, bs CapitalBands, resume bool, e string, mem int, q string) (err error) { // using named return so we can set it in the defer call
+	root, pth, err := prepareKeyValuePath(dir, e, resume)
 	if err != nil {
-		return fmt.Errorf("error creating temporary key-value storage: %w", err)
+		return err
 	}
 	defer func() {
-		if err := os.RemoveAll(pth); err != nil {
-			slog.Error("could not remove temporary", "directory", pth, "error", err)
+		if err != nil && !errors.Is(err, errQuarantined) { // the replay does not need the key-value storage
+			slog.Info("The key-value storage was kept so the transform can be resumed with --resume", "path", pth)
+			return
+		}
+		if err := os.RemoveAll(root); err != nil {
+			slog.Error("could not remove temporary", "directory", root, "error", err)
 		}
 	}()
 	l, err := newLookups(dir)
 	if err != nil {
 		return fmt.Errorf("error creating look up tables from %s: %w", dir, err)
 	}
-	if err := createKeyValueStorage(dir, pth, l, 1024); err != nil {
+	est := newETA(db)
+	if err := createKeyValueStorage(dir, pth, l, 1024, e, mem, est); err != nil {
+		return err
+	}
+	c, n, err := createJSONs(dir, pth, db, l, maxDB, s, p, bs, e, mem, est, q, resume)
+	if err != nil {
+		return err
+	}
+	if err := postLoad(db, est); err != nil {
 		return err
 	}
-	if err := createJSONs(dir, pth, db, l, maxDB, s, p); err != nil {
+	if err := reconcileRowCounts(db, c); err != nil {
 		return err
 	}
-	return postLoad(db)
+	if err := saveEvents(db, q); err != nil {
+		return err
+	}
+	if err := saveWarnings(db, dir); err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("%w: %d batches in %s, fix the cause and run transform --replay-quarantine", errQuarantined, n, q)
+	}
+	if resume { // skipped files and companies would make the durations misleading
+		return nil
+	}
+	if err := est.save(db); err != nil {
+		slog.Warn("could not save the durations of the transform stages", "error", err)
+	}
+	return nil
 }
@@ -31,6 +31,7 @@ type inMemoryDB struct {
 
 func (i inMemoryDB) PreLoad() error                    { return nil }
 func (i inMemoryDB) PostLoad() error                   { return nil }
+func (i inMemoryDB) SaveEvents() error                 { return nil }
 func (i inMemoryDB) CreateExtraIndexes([]string) error { return nil }
 
 func (i inMemoryDB) CreateCompanies(cs [][]string) error {
@@ -49,6 +50,25 @@ func (i inMemoryDB) MetaSave(k, v string) error {
 	return nil
 }
 
+func (i inMemoryDB) MetaRead(k string) (string, error) {
+	i.meta.lock.RLock()
+	defer i.meta.lock.RUnlock()
+	if v, ok := i.meta.data[k]; ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("meta %s not found", k)
+}
+
+func (i inMemoryDB) RowCounts() (map[string]int64, error) {
+	i.cnpj.lock.RLock()
+	defer i.cnpj.lock.RUnlock()
+	m := make(map[string]int64)
+	for n := range i.cnpj.data {
+		m[n[:2]]++
+	}
+	return m, nil
+}
+
 func (i inMemoryDB) GetCompany(n string) (string, error) {
 	i.cnpj.lock.RLock()
 	defer i.cnpj.lock.RUnlock()
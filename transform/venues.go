@@ -4,12 +4,19 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"sync/atomic"
 
 	"github.com/cuducos/go-cnpj"
+	"github.com/cuducos/minha-receita/warnings"
 	"github.com/schollz/progressbar/v3"
 	"golang.org/x/sync/errgroup"
 )
 
+// maxConsecutiveFailures is the number of batches in a row that can fail to be
+// saved before the transform stops, as it is probably not a problem with the
+// data (e.g. the database is down or the credentials are wrong).
+const maxConsecutiveFailures = 10
+
 type venuesTask struct {
 	source    *source
 	lookups   *lookups
@@ -18,6 +25,14 @@ type venuesTask struct {
 	dir       string
 	db        database
 	batchSize int
+	bands     CapitalBands
+	eta       *eta
+	counts    *rowCounts
+	resume    bool // skips the companies saved by a previous run (see expandSaved)
+
+	quarantine  string // directory for batches that fail, empty to fail the task instead
+	quarantined atomic.Int64
+	failures    atomic.Int64 // consecutive batches that failed
 }
 
 func (t *venuesTask) saveBatch(b []Company) (int, error) {
@@ -25,15 +40,35 @@ func (t *venuesTask) saveBatch(b []Company) (int, error) {
 		return 0, nil
 	}
 	s := make([][]string, len(b))
+	ns := make([]string, len(b))
 	for i, c := range b {
 		j, err := c.JSON()
 		if err != nil {
 			return 0, fmt.Errorf("error getting company %s as json: %w", cnpj.Mask(c.CNPJ), err)
 		}
 		s[i] = []string{c.CNPJ, j}
+		ns[i] = c.CNPJ
 	}
 	if err := t.db.CreateCompanies(s); err != nil {
-		return 0, fmt.Errorf("error saving companies: %w", err)
+		if t.quarantine == "" {
+			return 0, fmt.Errorf("error saving companies: %w", err)
+		}
+		if n := t.failures.Add(1); n >= maxConsecutiveFailures {
+			return 0, fmt.Errorf("stopping after %d batches in a row failed to be saved, the database might be unavailable: %w", n, err)
+		}
+		p, qerr := quarantineBatch(t.quarantine, s, err)
+		if qerr != nil {
+			return 0, fmt.Errorf("error saving companies (%w) and quarantining them: %w", err, qerr)
+		}
+		t.quarantined.Add(1) // still marked as saved below, so --resume leaves them to the replay
+		slog.Warn("Batch quarantined", "companies", len(s), "path", p, "error", err)
+		warnings.Add(warnings.Transform, "batch quarantined", p)
+	} else {
+		t.failures.Store(0)
+		t.counts.add(ns...)
+	}
+	if err := t.kv.markSaved(ns); err != nil {
+		return 0, fmt.Errorf("error recording checkpoint for saved companies: %w", err)
 	}
 	return len(s), nil
 }
@@ -41,9 +76,18 @@ func (t *venuesTask) saveBatch(b []Company) (int, error) {
 func (t *venuesTask) consumeRows(ctx context.Context, q <-chan []string, done chan<- int) error {
 	ch := make(chan int)
 	errs := make(chan error, 1)
-	defer close(errs)
 	go func() {
+		defer close(ch) // the sender owns the channel, so it is never closed while sending
+		send := func(n int) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case ch <- n:
+				return true
+			}
+		}
 		var b []Company
+		var skipped int // companies saved by a previous run, see --resume
 		for {
 			select {
 			case <-ctx.Done():
@@ -55,14 +99,33 @@ func (t *venuesTask) consumeRows(ctx context.Context, q <-chan []string, done ch
 						errs <- err
 						return
 					}
-					ch <- n
+					send(n + skipped)
 					return
 				}
+				if t.resume && len(r) > 2 {
+					ok, err := t.kv.isSaved(r[0] + r[1] + r[2])
+					if err != nil {
+						errs <- err
+						return
+					}
+					if ok {
+						t.counts.add(r[0] + r[1] + r[2])
+						skipped++
+						if skipped >= t.batchSize {
+							if !send(skipped) {
+								return
+							}
+							skipped = 0
+						}
+						continue
+					}
+				}
 				c, err := newCompany(r, t.lookups, t.kv, t.privacy)
 				if err != nil {
 					errs <- fmt.Errorf("error parsing company from %q: %w", r, err)
 					return
 				}
+				c.faixaCapitalSocial(t.bands)
 				b = append(b, c)
 				if len(b) < t.batchSize {
 					continue
@@ -72,7 +135,9 @@ func (t *venuesTask) consumeRows(ctx context.Context, q <-chan []string, done ch
 					errs <- err
 					return
 				}
-				ch <- n
+				if !send(n) {
+					return
+				}
 				b = []Company{}
 			}
 		}
@@ -80,23 +145,31 @@ func (t *venuesTask) consumeRows(ctx context.Context, q <-chan []string, done ch
 	for {
 		select {
 		case <-ctx.Done():
-			close(ch)
 			return nil
 		case n, ok := <-ch:
 			if !ok {
+				select { // the sender might have stopped because of an error
+				case err := <-errs:
+					return err
+				default:
+					return nil
+				}
+			}
+			select {
+			case <-ctx.Done():
 				return nil
+			case done <- n:
 			}
-			done <- n
 		case err := <-errs:
-			close(ch)
 			return err
 		}
 	}
 }
 
 func (t *venuesTask) run(m int) error {
+	label := "Creating the JSON data for each CNPJ"
 	bar := progressbar.Default(int64(t.source.total))
-	bar.Describe("Creating the JSON data for each CNPJ")
+	bar.Describe(label)
 	defer func() {
 		if err := t.source.close(); err != nil {
 			slog.Warn("could not close source files", "error", err)
@@ -108,6 +181,16 @@ func (t *venuesTask) run(m int) error {
 	if err := t.db.PreLoad(); err != nil {
 		return fmt.Errorf("error preparing the database: %w", err)
 	}
+	if t.resume {
+		n, err := t.kv.expandSaved()
+		if err != nil {
+			return err
+		}
+		slog.Info("Skipping companies saved by the previous run", "companies", n)
+	}
+	t.eta.start(jsonStage, int64(t.source.total))
+	stop := t.eta.follow(bar, label)
+	defer stop()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	var g errgroup.Group
@@ -119,8 +202,7 @@ func (t *venuesTask) run(m int) error {
 		close(q)
 		return nil
 	})
-	ch := make(chan int)
-	defer close(ch)
+	ch := make(chan int) // not closed: consumers stop sending once ctx is canceled
 	for range m {
 		g.Go(func() error {
 			return t.consumeRows(ctx, q, ch)
@@ -142,13 +224,14 @@ func (t *venuesTask) run(m int) error {
 				return err
 			}
 			if bar.IsFinished() {
+				t.eta.finish()
 				return nil
 			}
 		}
 	}
 }
 
-func createJSONRecordsTask(dir string, db database, l *lookups, kv kvStorage, b int, p bool) (*venuesTask, error) {
+func createJSONRecordsTask(dir string, db database, l *lookups, kv kvStorage, b int, p bool, bs CapitalBands) (*venuesTask, error) {
 	v, err := newSource(context.Background(), venues, dir)
 	if err != nil {
 		return nil, fmt.Errorf("error creating a source for venues from %s: %w", dir, err)
@@ -161,6 +244,8 @@ func createJSONRecordsTask(dir string, db database, l *lookups, kv kvStorage, b
 		dir:       dir,
 		db:        db,
 		batchSize: b,
+		bands:     bs,
+		counts:    newRowCounts(),
 	}
 	return &t, nil
 }
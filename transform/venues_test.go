@@ -4,7 +4,7 @@ import "testing"
 
 func TestTaskRun(t *testing.T) {
 	db := newTestDB()
-	kv, err := newBadgerStorage(t.TempDir(), false)
+	kv, err := newKeyValueStorage(BadgerKVEngine, t.TempDir(), 0)
 	if err != nil {
 		t.Errorf("expected no error creating badger, got %s", err)
 	}
@@ -20,7 +20,7 @@ func TestTaskRun(t *testing.T) {
 	if err := kv.load(testdata, &lookups, 1024); err != nil {
 		t.Errorf("expected no error loading values to badger, got %s", err)
 	}
-	r, err := createJSONRecordsTask(testdata, db, &lookups, kv, 2, false)
+	r, err := createJSONRecordsTask(testdata, db, &lookups, kv, 2, false, DefaultCapitalBands)
 	if err != nil {
 		t.Errorf("expected no error creating task, got %s", err)
 	}
@@ -39,4 +39,7 @@ func TestTaskRun(t *testing.T) {
 	if c.CNPJ != expected {
 		t.Errorf("expected cnpj to be %s, got %s", expected, c.CNPJ)
 	}
+	if err := reconcileRowCounts(db, r.counts); err != nil {
+		t.Errorf("expected the companies counted to match the ones saved, got %s", err)
+	}
 }
@@ -0,0 +1,189 @@
+// Package warnings collects the non-fatal problems of a run (e.g. retried
+// downloads, rows fixed or skipped by the transform) into a structured report
+// shown at the end, so operators notice a degraded run without scrolling
+// through hours of logs.
+package warnings
+
+import (
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	// File is the name of the report saved in the data directory by the
+	// download, so the transform can include it in its own report.
+	File = "warnings.json"
+
+	// MetaKey is the metadata key for the report of the last transform.
+	MetaKey = "warnings"
+
+	// maxExamples limits the examples kept for each kind of warning.
+	maxExamples = 5
+)
+
+// Stages of a run that report warnings.
+const (
+	Download  = "download"
+	Transform = "transform"
+)
+
+// Warning groups the occurrences of the same kind of problem in a stage.
+type Warning struct {
+	Stage    string   `json:"stage"`
+	Kind     string   `json:"kind"`
+	Count    int64    `json:"count"`
+	Examples []string `json:"examples,omitempty"`
+}
+
+func (w *Warning) add(n int64, es ...string) {
+	w.Count += n
+	for _, e := range es {
+		if e == "" || len(w.Examples) >= maxExamples || slices.Contains(w.Examples, e) {
+			continue
+		}
+		w.Examples = append(w.Examples, e)
+	}
+}
+
+type key struct{ stage, kind string }
+
+// Collector is safe for concurrent use.
+type Collector struct {
+	sync.Mutex
+	warnings map[key]*Warning
+}
+
+// New creates an empty collector.
+func New() *Collector { return &Collector{warnings: make(map[key]*Warning)} }
+
+// Add records one occurrence of a kind of warning in a stage, with an
+// optional example (e.g. a URL or a file name).
+func (c *Collector) Add(stage, kind, example string) {
+	c.merge(Warning{Stage: stage, Kind: kind, Count: 1, Examples: []string{example}})
+}
+
+func (c *Collector) merge(w Warning) {
+	c.Lock()
+	defer c.Unlock()
+	k := key{w.Stage, w.Kind}
+	if _, ok := c.warnings[k]; !ok {
+		c.warnings[k] = &Warning{Stage: w.Stage, Kind: w.Kind}
+	}
+	c.warnings[k].add(w.Count, w.Examples...)
+}
+
+// Report returns the warnings sorted by stage and kind.
+func (c *Collector) Report() []Warning {
+	c.Lock()
+	defer c.Unlock()
+	r := make([]Warning, 0, len(c.warnings))
+	for _, w := range c.warnings {
+		r = append(r, Warning{w.Stage, w.Kind, w.Count, slices.Clone(w.Examples)})
+	}
+	slices.SortFunc(r, func(a, b Warning) int {
+		if n := strings.Compare(a.Stage, b.Stage); n != 0 {
+			return n
+		}
+		return strings.Compare(a.Kind, b.Kind)
+	})
+	return r
+}
+
+// JSON serializes the report (an empty array when there are no warnings).
+func (c *Collector) JSON() (string, error) {
+	b, err := json.Marshal(c.Report())
+	if err != nil {
+		return "", fmt.Errorf("could not serialize warnings: %w", err)
+	}
+	return string(b), nil
+}
+
+// Save writes the report to the File in the directory dir.
+func (c *Collector) Save(dir string) error {
+	s, err := c.JSON()
+	if err != nil {
+		return err
+	}
+	p := filepath.Join(dir, File)
+	if err := os.WriteFile(p, []byte(s), 0644); err != nil {
+		return fmt.Errorf("could not write %s: %w", p, err)
+	}
+	return nil
+}
+
+// Load merges the report saved in the directory dir, if any.
+func (c *Collector) Load(dir string) error {
+	p := filepath.Join(dir, File)
+	b, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", p, err)
+	}
+	if err := c.MergeJSON(string(b)); err != nil {
+		return fmt.Errorf("could not load %s: %w", p, err)
+	}
+	return nil
+}
+
+// MergeJSON merges a report serialized by JSON.
+func (c *Collector) MergeJSON(s string) error {
+	var ws []Warning
+	if err := json.Unmarshal([]byte(s), &ws); err != nil {
+		return fmt.Errorf("could not parse warnings: %w", err)
+	}
+	for _, w := range ws {
+		c.merge(w)
+	}
+	return nil
+}
+
+// Log prints the report, one line per kind of warning.
+func (c *Collector) Log() {
+	r := c.Report()
+	if len(r) == 0 {
+		slog.Info("No warnings in this run")
+		return
+	}
+	var t int64
+	for _, w := range r {
+		t += w.Count
+	}
+	slog.Warn("This run finished with warnings", "kinds", len(r), "total", t)
+	for _, w := range r {
+		slog.Warn(w.Kind, "stage", w.Stage, "count", w.Count, "examples", strings.Join(w.Examples, ", "))
+	}
+}
+
+// collector is shared by the stages of a run, since the problems happen deep
+// within them.
+var collector = New()
+
+// Add records a warning in the collector of this run.
+func Add(stage, kind, example string) { collector.Add(stage, kind, example) }
+
+// Report returns the warnings recorded in this run.
+func Report() []Warning { return collector.Report() }
+
+// JSON serializes the warnings recorded in this run.
+func JSON() (string, error) { return collector.JSON() }
+
+// Save writes the warnings recorded in this run to the directory dir.
+func Save(dir string) error { return collector.Save(dir) }
+
+// Load merges the warnings saved in the directory dir into this run.
+func Load(dir string) error { return collector.Load(dir) }
+
+// MergeJSON merges a report serialized by JSON into this run.
+func MergeJSON(s string) error { return collector.MergeJSON(s) }
+
+// Log prints the warnings recorded in this run.
+func Log() { collector.Log() }
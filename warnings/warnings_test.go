@@ -0,0 +1,69 @@
+package warnings
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestCollectorAdd(t *testing.T) {
+	c := New()
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Add(Transform, "NUL characters removed", fmt.Sprintf("Estabelecimentos%d.zip", i))
+		}()
+	}
+	wg.Wait()
+	c.Add(Download, "download failed", "https://example.com/Empresas0.zip")
+	c.Add(Download, "download failed", "https://example.com/Empresas0.zip")
+	r := c.Report()
+	if len(r) != 2 {
+		t.Fatalf("expected 2 kinds of warnings, got %v", r)
+	}
+	if r[0].Stage != Download || r[0].Count != 2 || len(r[0].Examples) != 1 {
+		t.Errorf("expected 2 failed downloads with one example, got %v", r[0])
+	}
+	if r[1].Stage != Transform || r[1].Count != 8 || len(r[1].Examples) != maxExamples {
+		t.Errorf("expected 8 encoding fixes with %d examples, got %v", maxExamples, r[1])
+	}
+}
+
+func TestCollectorSaveAndLoad(t *testing.T) {
+	d := t.TempDir()
+	c := New()
+	if err := c.Load(d); err != nil {
+		t.Errorf("expected no error loading from a directory without warnings, got %s", err)
+	}
+	c.Add(Download, "stale cached index page used", "https://example.com/")
+	if err := c.Save(d); err != nil {
+		t.Fatalf("expected no error saving warnings, got %s", err)
+	}
+	o := New()
+	o.Add(Download, "stale cached index page used", "https://example.com/other/")
+	o.Add(Transform, "city without IBGE code", "BRASILIA (DF)")
+	if err := o.Load(d); err != nil {
+		t.Fatalf("expected no error loading warnings, got %s", err)
+	}
+	r := o.Report()
+	if len(r) != 2 {
+		t.Fatalf("expected 2 kinds of warnings, got %v", r)
+	}
+	exp := []string{"https://example.com/other/", "https://example.com/"}
+	if r[0].Count != 2 || !slices.Equal(r[0].Examples, exp) {
+		t.Errorf("expected the saved warning to be merged, got %v", r[0])
+	}
+}
+
+func TestCollectorJSON(t *testing.T) {
+	s, err := New().JSON()
+	if err != nil {
+		t.Fatalf("expected no error serializing warnings, got %s", err)
+	}
+	if s != "[]" {
+		t.Errorf("expected an empty array without warnings, got %s", s)
+	}
+}